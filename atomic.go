@@ -1,8 +1,10 @@
 // ABOUTME: Atomic file operations for safe concurrent writes.
-// ABOUTME: Provides AtomicWrite (tmp+rename) and EnsureDir helpers.
+// ABOUTME: Provides AtomicWrite and AtomicWriteReader (tmp+rename), EnsureDir, and locked O_APPEND writes for log files.
 package mdstore
 
 import (
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 )
@@ -10,6 +12,41 @@ import (
 // AtomicWrite writes data to path atomically via tmp file + rename.
 // Creates parent directories if they don't exist.
 func AtomicWrite(path string, data []byte) error {
+	if err := checkWritable(path); err != nil {
+		return err
+	}
+
+	return atomicWrite(path, func(f *os.File) error {
+		_, err := f.Write(data)
+		return err
+	})
+}
+
+// AtomicWriteReader is AtomicWrite for content streamed from r, such as the body
+// ParseFrontmatterReader returns, so it never has to be held in memory. If reading r
+// fails, path is left as it was.
+func AtomicWriteReader(path string, r io.Reader) error {
+	if err := checkWritable(path); err != nil {
+		return err
+	}
+
+	return atomicWrite(path, func(f *os.File) error {
+		_, err := io.Copy(f, r)
+		return err
+	})
+}
+
+// atomicWrite writes path atomically, with fill writing the content to a temporary
+// file that then replaces it. Failures are logged.
+func atomicWrite(path string, fill func(f *os.File) error) error {
+	err := writeAndRename(path, fill)
+	if err != nil {
+		logf(slog.LevelError, "mdstore: atomic write failed", slog.String("path", path), slog.Any("error", err))
+	}
+	return err
+}
+
+func writeAndRename(path string, fill func(f *os.File) error) error {
 	dir := filepath.Dir(path)
 	if err := EnsureDir(dir); err != nil {
 		return err
@@ -21,7 +58,7 @@ func AtomicWrite(path string, data []byte) error {
 	}
 	tmpName := tmp.Name()
 
-	if _, err := tmp.Write(data); err != nil {
+	if err := fill(tmp); err != nil {
 		tmp.Close()
 		os.Remove(tmpName)
 		return err
@@ -41,5 +78,52 @@ func AtomicWrite(path string, data []byte) error {
 
 // EnsureDir creates a directory and all parents if they don't exist.
 func EnsureDir(path string) error {
+	if err := checkWritable(path); err != nil {
+		return err
+	}
 	return os.MkdirAll(path, 0o755)
 }
+
+// appendLocked appends data to path with a single O_APPEND write, under WithLock on
+// path's directory so it never races a rewrite of the file (compaction, rotation).
+// Creates the file and its parent directories if needed. If the file doesn't end in
+// a newline, say because it was edited by hand, one is written before data, so data
+// starts a line of its own.
+func appendLocked(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := EnsureDir(dir); err != nil {
+		return err
+	}
+	return WithLock(dir, func() error {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return err
+		}
+		last, err := lastByte(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if last >= 0 && last != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// lastByte returns f's last byte, or -1 if f is empty.
+func lastByte(f *os.File) (int, error) {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return -1, err
+	}
+	b := make([]byte, 1)
+	if _, err := f.ReadAt(b, info.Size()-1); err != nil {
+		return -1, err
+	}
+	return int(b[0]), nil
+}
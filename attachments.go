@@ -0,0 +1,335 @@
+// ABOUTME: Local files a markdown document links to, such as images beside it, and moving a document with them.
+// ABOUTME: Provides Attachments, MissingAttachmentsError, and MoveDocument, which rewrites relative links as it moves.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// MissingAttachmentsError is a document linking to local files that don't exist.
+type MissingAttachmentsError struct {
+	Path  string   // the document
+	Files []string // the missing files, as Attachments gives paths
+}
+
+func (e *MissingAttachmentsError) Error() string {
+	return fmt.Sprintf("mdstore: %s: missing attachments: %s", e.Path, strings.Join(e.Files, ", "))
+}
+
+// MoveOptions tunes MoveDocument.
+type MoveOptions struct {
+	// KeepAttachments leaves attachments where they are, rewriting the links to them
+	// instead.
+	KeepAttachments bool
+
+	// Overwrite replaces files at the new paths, of the document or its attachments;
+	// without it, MoveDocument fails with fs.ErrExist before moving anything.
+	Overwrite bool
+}
+
+// MoveResult is what MoveDocument did.
+type MoveResult struct {
+	Attachments []string // the attachments moved, at their new paths
+	Missing     []string // linked files that don't exist, left as they were
+	Rewritten   int      // the links whose destinations were rewritten
+}
+
+// Attachments returns the local files that body, the markdown document at docPath or
+// its body, links to or shows as images, in order of first link: the targets of its
+// inline links and images (see ExtractLinks) that are relative paths, taken from
+// docPath's directory, less any #fragment or ?query, with %-escapes decoded. URLs with
+// a scheme, "//host" and "/rooted" targets, wiki links, and links to other markdown
+// (*.md) documents aren't attachments, and neither are directories. Paths are joined
+// to docPath's directory with the OS's separator. Files that don't exist are left out
+// and listed in a *MissingAttachmentsError returned alongside the rest; any other
+// error checking a file is returned alone.
+func Attachments(docPath, body string) ([]string, error) {
+	var files, missing []string
+	for _, link := range ExtractLinks(body) {
+		file, ok := attachmentPath(docPath, link)
+		if !ok || slices.Contains(files, file) || slices.Contains(missing, file) {
+			continue
+		}
+		info, err := os.Stat(file)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			missing = append(missing, file)
+		case err != nil:
+			return nil, err
+		case info.Mode().IsRegular():
+			files = append(files, file)
+		}
+	}
+	if len(missing) > 0 {
+		return files, &MissingAttachmentsError{Path: docPath, Files: missing}
+	}
+	return files, nil
+}
+
+// MoveDocument moves the markdown document at oldPath to newPath, along with the
+// attachments it links to (see Attachments) under oldPath's directory, which keep
+// their places relative to it: with "a/post.md" moved to "b/post.md", "a/img/x.png"
+// goes to "b/img/x.png". The document's relative links to anything else, such as
+// other documents, files outside its directory, or missing attachments, are rewritten
+// to point where they did from the new place, keeping any #fragment or ?query; the
+// rest of the document is written as it was. Attachments other documents link to are
+// moved all the same, so pass opts.KeepAttachments to leave every attachment in place
+// and rewrite the links to them instead.
+//
+// Attachments are renamed first and the document written at newPath atomically, then
+// the old one removed; if a step fails, the renames already done are undone. It all
+// happens under WithLocks on the directories of the document and of its attachments,
+// old and new. Missing attachments aren't an error, and are listed in the result. A
+// missing document returns a *NotFoundError, and a file at a new path an error
+// wrapping fs.ErrExist, unless opts.Overwrite is set.
+func MoveDocument(oldPath, newPath string, opts MoveOptions) (MoveResult, error) {
+	if filepath.Clean(oldPath) == filepath.Clean(newPath) {
+		return MoveResult{}, fmt.Errorf("mdstore: move %s: old and new paths are the same", oldPath)
+	}
+	// The directories to lock depend on what the document links to, so they're found
+	// from a first read, and the move planned again under the locks; if the document
+	// changed to need others in between, the locks are taken again.
+	plan, err := planMove(oldPath, newPath, opts)
+	if err != nil {
+		return MoveResult{}, err
+	}
+	for {
+		dirs := plan.lockDirs()
+		var result MoveResult
+		retry := false
+		err := WithLocks(dirs, func() error {
+			plan, err = planMove(oldPath, newPath, opts)
+			if err != nil {
+				return err
+			}
+			if slices.ContainsFunc(plan.lockDirs(), func(dir string) bool { return !slices.Contains(dirs, dir) }) {
+				retry = true
+				return nil
+			}
+			result, err = plan.apply(opts)
+			return err
+		})
+		if err != nil {
+			return MoveResult{}, err
+		}
+		if !retry {
+			return result, nil
+		}
+	}
+}
+
+// movePlan is how MoveDocument moves a document.
+type movePlan struct {
+	oldPath, newPath string
+	content          string      // the document rewritten for newPath
+	moves            [][2]string // attachments' old and new paths
+	missing          []string
+	rewritten        int
+}
+
+// planMove reads the document at oldPath and plans its move to newPath.
+func planMove(oldPath, newPath string, opts MoveOptions) (*movePlan, error) {
+	data, err := os.ReadFile(oldPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &NotFoundError{Path: oldPath}
+	}
+	if err != nil {
+		return nil, err
+	}
+	content := string(data)
+	plan := &movePlan{oldPath: oldPath, newPath: newPath}
+
+	files, err := Attachments(oldPath, content)
+	var missingErr *MissingAttachmentsError
+	if errors.As(err, &missingErr) {
+		plan.missing = missingErr.Files
+	} else if err != nil {
+		return nil, err
+	}
+	oldDir, newDir := filepath.Dir(oldPath), filepath.Dir(newPath)
+	moved := make(map[string]string)
+	if !opts.KeepAttachments && oldDir != newDir {
+		for _, file := range files {
+			rel, err := filepath.Rel(oldDir, file)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			moved[file] = filepath.Join(newDir, rel)
+			plan.moves = append(plan.moves, [2]string{file, moved[file]})
+		}
+	}
+
+	// Every relative link is pointed, from newPath, at where its target will be. An
+	// image in a link's text comes after the link, so the edits are sorted.
+	type edit struct {
+		start, end int
+		dest       string
+	}
+	var edits []edit
+	for _, link := range ExtractLinks(content) {
+		if link.Kind != LinkMarkdown && link.Kind != LinkImage {
+			continue
+		}
+		p, suffix, ok := localLinkTarget(link.Target)
+		if !ok {
+			continue
+		}
+		target := filepath.Join(oldDir, filepath.FromSlash(p))
+		if to, ok := moved[target]; ok {
+			target = to
+		}
+		rel, err := filepath.Rel(newDir, target)
+		if err != nil {
+			continue
+		}
+		if rel = filepath.ToSlash(rel); rel == path.Clean(p) {
+			continue
+		}
+		if strings.HasPrefix(p, "./") && !strings.HasPrefix(rel, "../") {
+			rel = "./" + rel
+		}
+		open := link.Start
+		if link.Kind == LinkImage {
+			open++
+		}
+		_, start, end, _, _ := scanInlineLink(content[:link.End], open)
+		edits = append(edits, edit{start, end, formatLinkDestination(rel+suffix, content[start:end])})
+	}
+	slices.SortFunc(edits, func(a, b edit) int { return a.start - b.start })
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		b.WriteString(content[last:e.start])
+		b.WriteString(e.dest)
+		last = e.end
+	}
+	b.WriteString(content[last:])
+	plan.content = b.String()
+	plan.rewritten = len(edits)
+	return plan, nil
+}
+
+// lockDirs returns the directories plan touches, cleaned and absolute.
+func (plan *movePlan) lockDirs() []string {
+	var dirs []string
+	add := func(file string) {
+		dir, err := filepath.Abs(filepath.Dir(file))
+		if err == nil && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	add(plan.oldPath)
+	add(plan.newPath)
+	for _, move := range plan.moves {
+		add(move[0])
+		add(move[1])
+	}
+	return dirs
+}
+
+// apply carries out plan: attachments are renamed, undone if a later step fails, then
+// the document written and the old one removed.
+func (plan *movePlan) apply(opts MoveOptions) (MoveResult, error) {
+	if !opts.Overwrite {
+		for _, dst := range append([]string{plan.newPath}, moveTargets(plan.moves)...) {
+			if _, err := os.Lstat(dst); err == nil {
+				return MoveResult{}, fmt.Errorf("mdstore: move %s: %w", plan.oldPath, &fs.PathError{Op: "move", Path: dst, Err: fs.ErrExist})
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return MoveResult{}, err
+			}
+		}
+	}
+
+	var done [][2]string
+	undo := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			_ = os.Rename(done[i][1], done[i][0])
+		}
+	}
+	for _, move := range plan.moves {
+		if err := EnsureDir(filepath.Dir(move[1])); err != nil {
+			undo()
+			return MoveResult{}, err
+		}
+		if err := os.Rename(move[0], move[1]); err != nil {
+			undo()
+			return MoveResult{}, fmt.Errorf("mdstore: move %s: %w", plan.oldPath, err)
+		}
+		done = append(done, move)
+	}
+	if err := AtomicWrite(plan.newPath, []byte(plan.content)); err != nil {
+		undo()
+		return MoveResult{}, err
+	}
+	if err := os.Remove(plan.oldPath); err != nil {
+		return MoveResult{}, err
+	}
+	notifyGitWrite(plan.oldPath, plan.newPath)
+	for _, move := range plan.moves {
+		notifyGitWrite(move[0], move[1])
+	}
+	return MoveResult{Attachments: moveTargets(plan.moves), Missing: plan.missing, Rewritten: plan.rewritten}, nil
+}
+
+// moveTargets returns the new paths of moves.
+func moveTargets(moves [][2]string) []string {
+	var targets []string
+	for _, move := range moves {
+		targets = append(targets, move[1])
+	}
+	return targets
+}
+
+// attachmentPath returns the path of the local file link, in the document at docPath,
+// points to, if it's an attachment as Attachments has it.
+func attachmentPath(docPath string, link Link) (string, bool) {
+	if link.Kind != LinkMarkdown && link.Kind != LinkImage {
+		return "", false
+	}
+	p, _, ok := localLinkTarget(link.Target)
+	if !ok || path.Ext(p) == ".md" {
+		return "", false
+	}
+	return filepath.Join(filepath.Dir(docPath), filepath.FromSlash(p)), true
+}
+
+// localLinkTarget splits target, a link's destination, into a relative path, with
+// %-escapes decoded, and the #fragment or ?query after it, if it's a relative path.
+func localLinkTarget(target string) (p, suffix string, ok bool) {
+	p = target
+	if i := strings.IndexAny(target, "#?"); i >= 0 {
+		p, suffix = target[:i], target[i:]
+	}
+	if p == "" || urlScheme.MatchString(p) || strings.HasPrefix(p, "/") || strings.HasPrefix(p, `\`) {
+		return "", "", false
+	}
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	return p, suffix, true
+}
+
+// formatLinkDestination writes target as a link destination replacing old, as old
+// was written: %-escaped if it had escapes, in angle brackets if it had them or
+// target needs them, and otherwise with backslashes before any parentheses.
+func formatLinkDestination(target, old string) string {
+	p, suffix := target, ""
+	if i := strings.IndexAny(target, "#?"); i >= 0 {
+		p, suffix = target[:i], target[i:]
+	}
+	if strings.Contains(old, "%") {
+		return (&url.URL{Path: p}).EscapedPath() + suffix
+	}
+	if strings.HasPrefix(old, "<") || strings.ContainsAny(target, " \t<>") {
+		return "<" + strings.NewReplacer("<", `\<`, ">", `\>`).Replace(target) + ">"
+	}
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(target)
+}
@@ -0,0 +1,165 @@
+// ABOUTME: Tests for Attachments and MoveDocument: which links count, and link rewriting across directories.
+// ABOUTME: Covers moving attachments along or keeping them, missing files, existing targets, and undoing a failed move.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"img/a.png", "img/b c.png", "doc.pdf", "other.md"} {
+		writeIndexFile(t, dir, name, "x")
+	}
+	doc := filepath.Join(dir, "post.md")
+	body := "---\ncover: img/a.png\n---\n" +
+		"![A](./img/a.png) ![B](img/b%20c.png) [pdf](doc.pdf#page=2) [again](img/a.png)\n" +
+		"[other](other.md) [web](https://x.io/a.png) [root](/img/a.png) [[img/a.png]] [dir](img)\n" +
+		"[gone](missing.png) `![code](code.png)`\n"
+
+	files, err := Attachments(doc, body)
+	want := []string{filepath.Join(dir, "img", "a.png"), filepath.Join(dir, "img", "b c.png"), filepath.Join(dir, "doc.pdf")}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %q, want %q", files, want)
+	}
+	var missing *MissingAttachmentsError
+	if !errors.As(err, &missing) || missing.Path != doc || !reflect.DeepEqual(missing.Files, []string{filepath.Join(dir, "missing.png")}) {
+		t.Errorf("got %v, want missing.png reported", err)
+	}
+
+	if files, err := Attachments(doc, "No links."); files != nil || err != nil {
+		t.Errorf("got %q, %v", files, err)
+	}
+}
+
+func TestMoveDocument(t *testing.T) {
+	root := t.TempDir()
+	oldPath := filepath.Join(root, "drafts", "post.md")
+	newPath := filepath.Join(root, "posts", "2026", "post.md")
+	writeIndexFile(t, root, "drafts/img/a.png", "a")
+	writeIndexFile(t, root, "drafts/notes.md", "notes")
+	writeIndexFile(t, root, "shared/logo.png", "logo")
+	writeFileString(t, oldPath, "---\ntitle: Post\n---\n"+
+		"![A](./img/a.png \"Cover\") [notes](notes.md#todo) ![logo](../shared/logo.png)\n"+
+		"[web](https://x.io) [gone](./img/gone.png) [top](#top)\n")
+
+	result, err := MoveDocument(oldPath, newPath, MoveOptions{})
+	if err != nil {
+		t.Fatalf("MoveDocument failed: %v", err)
+	}
+	want := MoveResult{
+		Attachments: []string{filepath.Join(root, "posts", "2026", "img", "a.png")},
+		Missing:     []string{filepath.Join(root, "drafts", "img", "gone.png")},
+		Rewritten:   3,
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("result = %+v, want %+v", result, want)
+	}
+	if got, want := readFileString(t, newPath), "---\ntitle: Post\n---\n"+
+		"![A](./img/a.png \"Cover\") [notes](../../drafts/notes.md#todo) ![logo](../../shared/logo.png)\n"+
+		"[web](https://x.io) [gone](../../drafts/img/gone.png) [top](#top)\n"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := readFileString(t, filepath.Join(root, "posts", "2026", "img", "a.png")); got != "a" {
+		t.Errorf("attachment = %q", got)
+	}
+	for _, gone := range []string{oldPath, filepath.Join(root, "drafts", "img", "a.png")} {
+		if _, err := os.Stat(gone); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s still there: %v", gone, err)
+		}
+	}
+
+	// Every link still resolves to the file it named.
+	files, err := Attachments(newPath, readFileString(t, newPath))
+	var missing *MissingAttachmentsError
+	if len(files) != 2 || !errors.As(err, &missing) || len(missing.Files) != 1 {
+		t.Errorf("after the move: %q, %v", files, err)
+	}
+}
+
+func TestMoveDocument_KeepAttachments(t *testing.T) {
+	root := t.TempDir()
+	oldPath := filepath.Join(root, "a", "post.md")
+	writeIndexFile(t, root, "a/img/my pic.png", "p")
+	writeIndexFile(t, root, "a/img/x(1).png", "x")
+	writeFileString(t, oldPath, "![p](<./img/my pic.png>) ![q](img/my%20pic.png) ![x](img/x\\(1\\).png)\n")
+
+	newPath := filepath.Join(root, "b", "post.md")
+	result, err := MoveDocument(oldPath, newPath, MoveOptions{KeepAttachments: true})
+	if err != nil {
+		t.Fatalf("MoveDocument failed: %v", err)
+	}
+	if result.Attachments != nil || result.Rewritten != 3 {
+		t.Errorf("result = %+v", result)
+	}
+	if got, want := readFileString(t, newPath), "![p](<../a/img/my pic.png>) ![q](../a/img/my%20pic.png) ![x](../a/img/x\\(1\\).png)\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Within a directory, nothing needs rewriting.
+	renamed := filepath.Join(root, "b", "renamed.md")
+	if result, err := MoveDocument(newPath, renamed, MoveOptions{}); err != nil || result.Rewritten != 0 || result.Attachments != nil {
+		t.Errorf("rename: %+v, %v", result, err)
+	}
+}
+
+func TestMoveDocument_Errors(t *testing.T) {
+	root := t.TempDir()
+	oldPath := filepath.Join(root, "a", "post.md")
+	writeIndexFile(t, root, "a/img.png", "new")
+	writeIndexFile(t, root, "b/img.png", "old")
+	writeFileString(t, oldPath, "![i](img.png)\n")
+	newPath := filepath.Join(root, "b", "post.md")
+
+	if _, err := MoveDocument(oldPath, newPath, MoveOptions{}); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("attachment in the way: got %v, want fs.ErrExist", err)
+	}
+	if got := readFileString(t, filepath.Join(root, "a", "img.png")); got != "new" {
+		t.Errorf("attachment moved: %q", got)
+	}
+	if _, err := os.Stat(newPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("document written: %v", err)
+	}
+
+	if _, err := MoveDocument(oldPath, newPath, MoveOptions{Overwrite: true}); err != nil {
+		t.Fatalf("Overwrite: %v", err)
+	}
+	if got := readFileString(t, filepath.Join(root, "b", "img.png")); got != "new" {
+		t.Errorf("attachment not replaced: %q", got)
+	}
+
+	var notFound *NotFoundError
+	if _, err := MoveDocument(oldPath, newPath, MoveOptions{}); !errors.As(err, &notFound) {
+		t.Errorf("missing document: got %v, want a *NotFoundError", err)
+	}
+	if _, err := MoveDocument(newPath, newPath, MoveOptions{}); err == nil {
+		t.Error("moving a document onto itself should fail")
+	}
+}
+
+func TestMoveDocument_UndoesRenames(t *testing.T) {
+	root := t.TempDir()
+	oldPath := filepath.Join(root, "a", "post.md")
+	writeIndexFile(t, root, "a/img.png", "i")
+	writeFileString(t, oldPath, "![i](img.png)\n")
+	// The new path is a directory, so writing the document fails after the rename.
+	newPath := filepath.Join(root, "b", "post.md")
+	if err := os.MkdirAll(filepath.Join(newPath, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MoveDocument(oldPath, newPath, MoveOptions{Overwrite: true}); err == nil {
+		t.Fatal("MoveDocument onto a directory should fail")
+	}
+	if got := readFileString(t, filepath.Join(root, "a", "img.png")); got != "i" {
+		t.Errorf("rename not undone: %q", got)
+	}
+	if _, err := os.Stat(oldPath); err != nil {
+		t.Errorf("document removed: %v", err)
+	}
+}
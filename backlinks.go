@@ -0,0 +1,271 @@
+// ABOUTME: A persisted graph of the links between the markdown documents of a store, for finding what links to a page.
+// ABOUTME: Provides Backlinks, BacklinkDoc, BuildBacklinks, UpdateBacklinks, LoadBacklinks, and the For method.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// BacklinksFile is the name of the file, in the root of a store, in which
+// BuildBacklinks and UpdateBacklinks keep the graph. It's hidden, so walks of the
+// store pass over it.
+const BacklinksFile = ".backlinks.yaml"
+
+// Backlinks is the graph of the links between the markdown (*.md) documents of a
+// store, keyed by store-relative paths with forward slashes. Docs holds what each
+// document links to, as read from it; Reverse is worked out from Docs, and holds,
+// for each document, the documents that link to it. It's plain data, kept as YAML in
+// BacklinksFile.
+type Backlinks struct {
+	Docs    map[string]BacklinkDoc `yaml:"docs"`
+	Reverse map[string][]string    `yaml:"reverse,omitempty"` // sorted, without documents no one links to
+}
+
+// BacklinkDoc is one document of a Backlinks graph.
+type BacklinkDoc struct {
+	// Slug names the document to wiki links: its frontmatter slug field, or else its
+	// file name, without the extension, as Slugify writes it.
+	Slug string `yaml:"slug"`
+
+	// Links are the store-relative paths the document links to, with ResolveLink,
+	// including those of documents that don't exist yet. Sorted.
+	Links []string `yaml:"links,omitempty"`
+
+	// Wiki are the slugs of the pages its wiki links without a file extension name,
+	// such as home-page for [[Home Page]]. Sorted.
+	Wiki []string `yaml:"wiki,omitempty"`
+}
+
+// BuildBacklinks reads every markdown (*.md) file under root, found as BuildIndex
+// finds them, and builds the graph of the links between them, which it writes to
+// BacklinksFile in root, atomically, under WithLock on root. Links are found with
+// ExtractLinks, and those that ResolveLink resolves within the store are kept, less a
+// document's links to itself. A wiki link with a file extension, [[notes/todo.md]],
+// names a path from the root of the store; one without, [[Home Page]], names the
+// document whose slug (see BacklinkDoc) is the page's, as Slugify writes it. A file
+// that can't be read is left out, and its error joined into the one returned with
+// the rest of the graph.
+func BuildBacklinks(root string) (Backlinks, error) {
+	b, errs, err := buildBacklinks(root)
+	if err != nil {
+		return Backlinks{}, err
+	}
+	if err := WithLock(root, func() error {
+		return WriteYAML(filepath.Join(root, BacklinksFile), b)
+	}); err != nil {
+		return Backlinks{}, err
+	}
+	return b, errors.Join(errs...)
+}
+
+// UpdateBacklinks brings the graph in root's BacklinksFile up to date after the
+// documents at changedPaths, relative to root, were written or deleted, reading only
+// those. A deleted document is taken out of both sides of the graph: its own links,
+// and the lists of documents linking to it, though the links to it are kept for when
+// it's written again. Paths that aren't markdown files of the store, such as hidden
+// ones, are passed over. Without a BacklinksFile, the whole graph is built, as
+// BuildBacklinks builds it. The file is read, updated, and written under WithLock on
+// root; a changed file that can't be read keeps its old place in the graph, and its
+// error is joined into the one returned with the graph.
+func UpdateBacklinks(root string, changedPaths []string) (Backlinks, error) {
+	changed := make(map[string]*BacklinkDoc, len(changedPaths)) // nil for a deleted document
+	var errs []error
+	for _, p := range changedPaths {
+		rel := path.Clean(filepath.ToSlash(p))
+		if !isStoreDocument(rel) {
+			continue
+		}
+		doc, err := readBacklinkDoc(filepath.Join(root, filepath.FromSlash(rel)), rel)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			changed[rel] = nil
+		case err != nil:
+			errs = append(errs, err)
+		default:
+			changed[rel] = &doc
+		}
+	}
+
+	var b Backlinks
+	err := WithLock(root, func() error {
+		var err error
+		b, err = LoadBacklinks(root)
+		if errors.Is(err, fs.ErrNotExist) {
+			var buildErrs []error
+			if b, buildErrs, err = buildBacklinks(root); err != nil {
+				return err
+			}
+			errs = buildErrs // the changed files were read again, so their errors are here too
+		} else if err != nil {
+			return err
+		} else {
+			if b.Docs == nil {
+				b.Docs = make(map[string]BacklinkDoc, len(changed))
+			}
+			for rel, doc := range changed {
+				if doc == nil {
+					delete(b.Docs, rel)
+				} else {
+					b.Docs[rel] = *doc
+				}
+			}
+			b.link()
+		}
+		return WriteYAML(filepath.Join(root, BacklinksFile), b)
+	})
+	if err != nil {
+		return Backlinks{}, err
+	}
+	return b, errors.Join(errs...)
+}
+
+// LoadBacklinks reads the graph in root's BacklinksFile. A missing file returns a
+// *NotFoundError, which matches fs.ErrNotExist.
+func LoadBacklinks(root string) (Backlinks, error) {
+	var b Backlinks
+	err := ReadYAMLStrict(filepath.Join(root, BacklinksFile), &b)
+	return b, err
+}
+
+// For returns the store-relative paths of the documents that link to the document
+// at p, a store-relative path or the slug of a document, in order.
+func (b *Backlinks) For(p string) []string {
+	key := path.Clean(filepath.ToSlash(p))
+	if _, ok := b.Docs[key]; !ok {
+		if docPath, ok := b.slugs()[p]; ok {
+			key = docPath
+		}
+	}
+	return slices.Clone(b.Reverse[key])
+}
+
+// buildBacklinks reads the graph of root's documents, without writing it, returning
+// the errors of files it left out separately from that of the walk.
+func buildBacklinks(root string) (Backlinks, []error, error) {
+	b := Backlinks{Docs: make(map[string]BacklinkDoc)}
+	var errs []error
+	err := walkGlob(root, "*.md", func(file string, d fs.DirEntry) {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		rel = filepath.ToSlash(rel)
+		doc, err := readBacklinkDoc(file, rel)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		b.Docs[rel] = doc
+	})
+	if err != nil {
+		return Backlinks{}, nil, err
+	}
+	b.link()
+	return b, errs, nil
+}
+
+// readBacklinkDoc reads the slug and links of the document at file, whose
+// store-relative path is rel.
+func readBacklinkDoc(file, rel string) (BacklinkDoc, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return BacklinkDoc{}, err
+	}
+	var meta map[string]interface{}
+	if _, err := DecodeFrontmatter(file, string(data), &meta); err != nil {
+		return BacklinkDoc{}, err
+	}
+
+	doc := BacklinkDoc{Slug: Slugify(strings.TrimSuffix(path.Base(rel), path.Ext(rel)))}
+	if slug, ok := meta["slug"].(string); ok && strings.TrimSpace(slug) != "" {
+		doc.Slug = strings.TrimSpace(slug)
+	}
+	for _, link := range ExtractLinks(string(data)) {
+		target := link.Target
+		if link.Kind == LinkWiki {
+			page, _, _ := strings.Cut(target, "#")
+			if page == "" {
+				continue
+			}
+			if !hasFileExt(page) {
+				doc.Wiki = append(doc.Wiki, Slugify(path.Base(page)))
+				continue
+			}
+			target = "/" + page
+		}
+		if resolved, ok := ResolveLink(rel, target); ok && resolved != rel {
+			doc.Links = append(doc.Links, resolved)
+		}
+	}
+	slices.Sort(doc.Links)
+	doc.Links = slices.Compact(doc.Links)
+	slices.Sort(doc.Wiki)
+	doc.Wiki = slices.Compact(doc.Wiki)
+	return doc, nil
+}
+
+// link works out b.Reverse from b.Docs.
+func (b *Backlinks) link() {
+	slugs := b.slugs()
+	reverse := make(map[string][]string)
+	add := func(target, from string) {
+		if _, ok := b.Docs[target]; ok && target != from {
+			reverse[target] = append(reverse[target], from)
+		}
+	}
+	for from, doc := range b.Docs {
+		for _, target := range doc.Links {
+			add(target, from)
+		}
+		for _, slug := range doc.Wiki {
+			if target, ok := slugs[slug]; ok {
+				add(target, from)
+			}
+		}
+	}
+	for target, from := range reverse {
+		slices.Sort(from)
+		reverse[target] = slices.Compact(from)
+	}
+	b.Reverse = reverse
+}
+
+// slugs maps the slugs of b's documents to their paths. Where documents share a slug,
+// the first path, in order, has it.
+func (b *Backlinks) slugs() map[string]string {
+	slugs := make(map[string]string, len(b.Docs))
+	for docPath, doc := range b.Docs {
+		if other, ok := slugs[doc.Slug]; !ok || docPath < other {
+			slugs[doc.Slug] = docPath
+		}
+	}
+	return slugs
+}
+
+// isStoreDocument reports whether rel, a cleaned slash-separated path, names a
+// markdown file that a walk of the store would find: within it, and not hidden.
+func isStoreDocument(rel string) bool {
+	if path.Ext(rel) != ".md" || rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return false
+	}
+	for _, elem := range strings.Split(rel, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+// hasFileExt reports whether page, a wiki link's page, ends in a file extension, such
+// as .md or .png, rather than being a page name like "Release 2.0 notes".
+func hasFileExt(page string) bool {
+	ext := path.Ext(page)
+	return len(ext) > 1 && !strings.ContainsAny(ext, " \t")
+}
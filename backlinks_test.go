@@ -0,0 +1,159 @@
+// ABOUTME: Tests for the Backlinks graph: building, wiki links by slug, persistence, and incremental updates.
+// ABOUTME: Updates are checked as documents gain and lose links, are added, and are deleted.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBuildBacklinks(t *testing.T) {
+	root := writeIndexTree(t, map[string]string{
+		"index.md":        "Start at [hello](posts/hello.md), [[Second Post]], or [[about]].\nSee <https://example.com>.\n",
+		"posts/hello.md":  "---\nslug: hello\n---\nBack [home](../index.md), to [[#top]], and [me](#top).\n![pic](img/pic.png)\n",
+		"posts/second.md": "---\nslug: second-post\n---\n[[hello|Hi]] and [[notes/todo.md]] and [gone](/gone.md).\n",
+		"about.md":        "```\n[[index]]\n```\n[[Missing Page]]\n",
+		"notes/todo.md":   "[up](/index.md)\n",
+		".hidden/x.md":    "[[hello]]\n",
+	})
+	b, err := BuildBacklinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		doc  string
+		want []string
+	}{
+		{"index.md", []string{"notes/todo.md", "posts/hello.md"}},
+		{"posts/hello.md", []string{"index.md", "posts/second.md"}},
+		{"hello", []string{"index.md", "posts/second.md"}}, // by slug
+		{"second-post", []string{"index.md"}},
+		{"about.md", []string{"index.md"}},
+		{"notes/todo.md", []string{"posts/second.md"}},
+		{filepath.Join("notes", "todo.md"), []string{"posts/second.md"}},
+		{"posts/img/pic.png", nil}, // not a document
+		{"gone.md", nil},
+		{"missing-page", nil},
+	} {
+		if got := b.For(tc.doc); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("For(%q) = %v, want %v", tc.doc, got, tc.want)
+		}
+	}
+
+	wantHello := BacklinkDoc{Slug: "hello", Links: []string{"index.md", "posts/img/pic.png"}}
+	if got := b.Docs["posts/hello.md"]; !reflect.DeepEqual(got, wantHello) {
+		t.Errorf("Docs[posts/hello.md] = %+v, want %+v", got, wantHello)
+	}
+	if got := b.Docs["about.md"]; !reflect.DeepEqual(got.Wiki, []string{"missing-page"}) {
+		t.Errorf("about.md wiki links = %v", got.Wiki)
+	}
+	if _, ok := b.Docs[".hidden/x.md"]; ok {
+		t.Error("hidden document was read")
+	}
+
+	loaded, err := LoadBacklinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, b) {
+		t.Errorf("loaded %+v, want %+v", loaded, b)
+	}
+}
+
+func TestBuildBacklinks_BadFile(t *testing.T) {
+	root := writeIndexTree(t, map[string]string{
+		"good.md": "[[bad]]\n",
+		"bad.md":  "---\ntitle: [unclosed\n---\n",
+	})
+	b, err := BuildBacklinks(root)
+	var yerr *YAMLError
+	if !errors.As(err, &yerr) {
+		t.Fatalf("err = %v, want a *YAMLError", err)
+	}
+	if _, ok := b.Docs["good.md"]; !ok || len(b.Docs) != 1 {
+		t.Errorf("docs = %v", b.Docs)
+	}
+	if _, err := LoadBacklinks(root); err != nil {
+		t.Errorf("graph wasn't written: %v", err)
+	}
+
+	if _, err := BuildBacklinks(filepath.Join(root, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing root: err = %v", err)
+	}
+}
+
+func TestUpdateBacklinks(t *testing.T) {
+	root := writeIndexTree(t, map[string]string{
+		"a.md": "[b](b.md) and [[c]]\n",
+		"b.md": "[a](a.md)\n",
+		"c.md": "[[New Page]]\n",
+	})
+
+	// Without a graph file, the whole graph is built.
+	b, err := UpdateBacklinks(root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.For("c.md"); !reflect.DeepEqual(got, []string{"a.md"}) {
+		t.Fatalf("For(c.md) = %v", got)
+	}
+
+	// a.md drops its link to c.md; a new document takes the slug c.md links to.
+	writeIndexFile(t, root, "a.md", "[b](b.md)\n")
+	writeIndexFile(t, root, "sub/new.md", "---\nslug: new-page\n---\n[[a]]\n")
+	if b, err = UpdateBacklinks(root, []string{"a.md", filepath.Join("sub", "new.md"), "notes.txt", ".hidden.md"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		"a.md":       {"b.md", "sub/new.md"},
+		"b.md":       {"a.md"},
+		"sub/new.md": {"c.md"},
+	}
+	if !reflect.DeepEqual(b.Reverse, want) {
+		t.Errorf("Reverse = %v, want %v", b.Reverse, want)
+	}
+
+	// Deleting b.md takes it out of both sides, keeping a.md's link for its return.
+	if err := os.Remove(filepath.Join(root, "b.md")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err = UpdateBacklinks(root, []string{"b.md"}); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string][]string{"a.md": {"sub/new.md"}, "sub/new.md": {"c.md"}}
+	if _, ok := b.Docs["b.md"]; ok || !reflect.DeepEqual(b.Reverse, want) {
+		t.Errorf("after delete: docs %v, Reverse %v", b.Docs, b.Reverse)
+	}
+	writeIndexFile(t, root, "b.md", "back\n")
+	if b, err = UpdateBacklinks(root, []string{"b.md"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.For("b.md"); !reflect.DeepEqual(got, []string{"a.md"}) {
+		t.Errorf("after re-adding, For(b.md) = %v", got)
+	}
+
+	// The updates were persisted, and match a fresh build.
+	loaded, err := LoadBacklinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := BuildBacklinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, fresh) {
+		t.Errorf("updated graph %+v differs from a fresh build %+v", loaded, fresh)
+	}
+
+	// A changed file that can't be read keeps its place.
+	writeIndexFile(t, root, "c.md", "---\ntitle: [unclosed\n---\n")
+	b, err = UpdateBacklinks(root, []string{"c.md"})
+	if err == nil || !reflect.DeepEqual(b.Docs["c.md"].Wiki, []string{"new-page"}) {
+		t.Errorf("err = %v, c.md = %+v", err, b.Docs["c.md"])
+	}
+}
@@ -0,0 +1,61 @@
+// ABOUTME: Injectable time source for lock timeouts, stale checks, lease renewal, and holder timestamps.
+// ABOUTME: Provides Clock and SetClock; the default is the real clock.
+package mdstore
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the time source used by the lock code. Tests can install a fake one
+// with SetClock to exercise timeouts, staleness, and leases without real sleeps.
+type Clock interface {
+	Now() time.Time
+	// After delivers the current time once d has elapsed, like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// clockBox lets atomic.Pointer hold an interface value.
+type clockBox struct{ c Clock }
+
+var currentClock atomic.Pointer[clockBox]
+
+// SetClock replaces the time source for lock timeouts, retry waits, stale-lock and
+// lease expiry checks, lock-file refreshes, and holder timestamps. Lock file mtimes
+// written by the OS are still compared against it, so a fake clock should start near
+// the real time. Passing nil restores the real clock.
+func SetClock(c Clock) {
+	if c == nil {
+		currentClock.Store(nil)
+		return
+	}
+	currentClock.Store(&clockBox{c})
+}
+
+// clock returns the installed Clock.
+func clock() Clock {
+	if b := currentClock.Load(); b != nil {
+		return b.c
+	}
+	return realClock{}
+}
+
+// now is time.Now on the installed Clock.
+func now() time.Time {
+	return clock().Now()
+}
+
+// since is time.Since on the installed Clock.
+func since(t time.Time) time.Duration {
+	return clock().Now().Sub(t)
+}
+
+// after is time.After on the installed Clock.
+func after(d time.Duration) <-chan time.Time {
+	return clock().After(d)
+}
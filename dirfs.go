@@ -0,0 +1,127 @@
+// ABOUTME: A read-only fs.FS view of a store that hides the files mdstore keeps for itself.
+// ABOUTME: Provides DirFS, which filters lock files, temp files, journal markers, and the backlinks graph.
+package mdstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// DirFS returns a read-only view of the store at root, as os.DirFS gives one, less the
+// files mdstore keeps in it for itself: lock files (.lock and the .locks directory,
+// with their .steal and .readers companions, and .lease), the .lock-audit.yaml record
+// of broken locks, journal markers (.inprogress), AtomicWrite's temp files (.tmp-*),
+// and BacklinksFile. Other files, hidden ones and defaults files included, are there
+// as on disk. Opening, reading, or statting a hidden name, or anything under one,
+// fails with fs.ErrNotExist, and directory listings leave them out, all the way down,
+// including through fs.Sub. The result implements fs.ReadDirFS, fs.ReadFileFS, and
+// fs.StatFS, for code such as http.FS or html/template's ParseFS.
+//
+// Locks whose files SetLockDir puts elsewhere aren't in the store to begin with.
+func DirFS(root string) fs.FS {
+	return storeFS{fsys: os.DirFS(root)}
+}
+
+// storeFS is DirFS's view of a store.
+type storeFS struct {
+	fsys fs.FS
+}
+
+// Open implements fs.FS.
+func (s storeFS) Open(name string) (fs.File, error) {
+	if err := checkStoreFSName("open", name); err != nil {
+		return nil, err
+	}
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if dir, ok := f.(fs.ReadDirFile); ok {
+		return &storeDir{ReadDirFile: dir}, nil
+	}
+	return f, nil
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (s storeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if err := checkStoreFSName("readdir", name); err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(s.fsys, name)
+	return slices.DeleteFunc(entries, isInternalEntry), err
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (s storeFS) ReadFile(name string) ([]byte, error) {
+	if err := checkStoreFSName("readfile", name); err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(s.fsys, name)
+}
+
+// Stat implements fs.StatFS.
+func (s storeFS) Stat(name string) (fs.FileInfo, error) {
+	if err := checkStoreFSName("stat", name); err != nil {
+		return nil, err
+	}
+	return fs.Stat(s.fsys, name)
+}
+
+// storeDir is a directory opened from DirFS, whose listings leave out internal files.
+type storeDir struct {
+	fs.ReadDirFile
+}
+
+// ReadDir implements fs.ReadDirFile. With n > 0, it reads on past internal files
+// until it has n entries or the directory ends.
+func (d *storeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries, err := d.ReadDirFile.ReadDir(n)
+		return slices.DeleteFunc(entries, isInternalEntry), err
+	}
+	var out []fs.DirEntry
+	for len(out) < n {
+		entries, err := d.ReadDirFile.ReadDir(n - len(out))
+		out = append(out, slices.DeleteFunc(entries, isInternalEntry)...)
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(out) > 0 {
+				return out, nil
+			}
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// checkStoreFSName returns the error for op on name, in DirFS, if it's invalid or
+// internal, or within an internal directory.
+func checkStoreFSName(op, name string) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	for elem := range strings.SplitSeq(name, "/") {
+		if isInternalName(elem) {
+			return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+	}
+	return nil
+}
+
+// isInternalEntry reports whether e is a file mdstore keeps for itself.
+func isInternalEntry(e fs.DirEntry) bool {
+	return isInternalName(e.Name())
+}
+
+// isInternalName reports whether a file or directory named name is one mdstore keeps
+// for itself, as DirFS lists them.
+func isInternalName(name string) bool {
+	switch name {
+	case ".lock", ".locks", ".lease", lockAuditName, BacklinksFile:
+		return true
+	}
+	return strings.HasPrefix(name, ".lock.") || strings.HasPrefix(name, inProgressName) || strings.HasPrefix(name, ".tmp-")
+}
@@ -0,0 +1,141 @@
+// ABOUTME: Tests for DirFS: fstest.TestFS over a store holding locks, temp files, and other mdstore internals.
+// ABOUTME: Internal names must be invisible to Open, Stat, ReadFile, and listings, in subdirectories and through fs.Sub.
+package mdstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+// writeDirFSStore writes a store with documents and the files mdstore keeps beside
+// them, the lock files made by taking real locks, and returns its root.
+func writeDirFSStore(t *testing.T) string {
+	t.Helper()
+	root := writeIndexTree(t, map[string]string{
+		"a.md":                   "---\ntitle: A\n---\nBody\n",
+		"notes/b.md":             "# B\n",
+		"notes/deep/c.md":        "# C\n",
+		"img/logo.png":           "png",
+		".mdstore-defaults.yaml": "layout: post\n",
+		".hidden.md":             "user dotfiles stay\n",
+		".tmp-123456":            "half written",
+		"notes/.tmp-999":         "half written",
+		".inprogress":            "pid: 1\n",
+		".lock-audit.yaml":       "- dir: x\n",
+		".lease":                 "",
+		".lock.readers/r1":       "",
+	})
+	if err := WithLock(root, func() error {
+		return WithNamedLock(filepath.Join(root, "notes"), "reindex", func() error { return nil })
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WithLock(filepath.Join(root, "notes", "deep"), func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildBacklinks(root); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{".lock", "notes/.locks/reindex.lock", "notes/deep/.lock", BacklinksFile} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Fatalf("fixture lacks %s: %v", name, err)
+		}
+	}
+	return root
+}
+
+func TestDirFS(t *testing.T) {
+	root := writeDirFSStore(t)
+	fsys := DirFS(root)
+
+	visible := []string{".hidden.md", ".mdstore-defaults.yaml", "a.md", "img", "img/logo.png", "notes", "notes/b.md", "notes/deep", "notes/deep/c.md"}
+	if err := fstest.TestFS(fsys, visible...); err != nil {
+		t.Fatal(err)
+	}
+	var walked []string
+	if err := fs.WalkDir(fsys, ".", func(p string, _ fs.DirEntry, err error) error {
+		if p != "." {
+			walked = append(walked, p)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(walked, visible) {
+		t.Errorf("walked %q, want %q", walked, visible)
+	}
+
+	sub, err := fs.Sub(fsys, "notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(sub, "b.md", "deep", "deep/c.md"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fsys.(fs.ReadDirFS); !ok {
+		t.Error("DirFS should implement fs.ReadDirFS")
+	}
+	if _, ok := fsys.(fs.StatFS); !ok {
+		t.Error("DirFS should implement fs.StatFS")
+	}
+}
+
+func TestDirFS_InternalNamesInvisible(t *testing.T) {
+	root := writeDirFSStore(t)
+	fsys := DirFS(root)
+
+	for _, name := range []string{
+		".lock", ".tmp-123456", ".locks", "notes/.locks", "notes/.locks/reindex.lock",
+		"notes/.lock", "notes/deep/.lock", "notes/.tmp-999", ".inprogress",
+		".lock-audit.yaml", ".lease", ".lock.readers", ".lock.readers/r1", BacklinksFile,
+	} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q) = %v, want fs.ErrNotExist", name, err)
+		}
+		if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q) = %v, want fs.ErrNotExist", name, err)
+		}
+		if _, err := fs.ReadFile(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("ReadFile(%q) = %v, want fs.ErrNotExist", name, err)
+		}
+	}
+	if _, err := fs.ReadDir(fsys, "notes/.locks"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("ReadDir(notes/.locks) = %v, want fs.ErrNotExist", err)
+	}
+	sub, _ := fs.Sub(fsys, "notes")
+	if _, err := fs.Stat(sub, ".locks/reindex.lock"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Sub: Stat = %v, want fs.ErrNotExist", err)
+	}
+
+	// Listing a directory a few entries at a time passes over internal files too.
+	f, err := fsys.Open(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	for {
+		entries, err := f.(fs.ReadDirFile).ReadDir(1)
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("ReadDir(1) = %v, %v", entries, err)
+		}
+	}
+	slices.Sort(names)
+	if want := []string{".hidden.md", ".mdstore-defaults.yaml", "a.md", "img", "notes"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listed %q, want %q", names, want)
+	}
+}
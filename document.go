@@ -0,0 +1,170 @@
+// ABOUTME: Document ties a markdown file's frontmatter and body to a load/save lifecycle with conflict detection.
+// ABOUTME: Provides Document[T], LoadDocument, and the Save and SaveAs methods, built on WriteMarkdownFileOpts and Version.
+package mdstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Document is a markdown file held in memory: its frontmatter decoded into a T, and its
+// body. Load one with LoadDocument, change Meta and Body, and Save it; or fill in a
+// new one and Save it to create the file. A Document[yaml.Node] keeps the frontmatter's
+// comments and key order through a load and save.
+//
+// Saves are optimistic: Save fails with a *ConflictError, matching ErrConflict, if
+// the file's content changed since the Document was loaded or last saved, as
+// WriteYAMLIf does, unless Force is set. A Document isn't safe for concurrent use.
+type Document[T any] struct {
+	Path string
+	Meta T
+	Body string
+
+	// Options are used for every save, as WriteMarkdownFileOpts uses them. With
+	// AutoFields, Meta is read back from the file after a save, so it holds the fields
+	// filled in.
+	Options MarkdownOptions
+
+	// Force makes saves overwrite the file whatever it holds.
+	Force bool
+
+	// ModTime and Version are the file's modification time and Version when it was
+	// loaded or last saved. Both are zero for a Document not yet saved, whose first
+	// save fails if the file exists.
+	ModTime time.Time
+	Version Version
+
+	// CascadeRoot, if set, is the root of the store whose defaults cascade into
+	// Resolved (see ResolveMetadata) when the Document is loaded or saved.
+	CascadeRoot string
+
+	// Resolved is the frontmatter, as a generic map, with the defaults cascaded under
+	// it, if CascadeRoot is set; nil otherwise. Saves write Meta, not Resolved, so the
+	// defaults stay in their own files.
+	Resolved map[string]interface{}
+}
+
+// DocumentOptions controls LoadDocumentOpts.
+type DocumentOptions struct {
+	// CascadeRoot sets Document.CascadeRoot, so the document's Resolved metadata has
+	// the defaults of the store at CascadeRoot cascaded in.
+	CascadeRoot string
+}
+
+// LoadDocument reads the markdown file at path into a Document, decoding its
+// frontmatter as ReadMarkdownFile does, with the same errors, and normalizing its
+// body likewise. A missing file returns a *NotFoundError, which matches
+// fs.ErrNotExist; to create a file, Save a new Document instead.
+func LoadDocument[T any](path string) (*Document[T], error) {
+	return LoadDocumentOpts[T](path, DocumentOptions{})
+}
+
+// LoadDocumentOpts is LoadDocument with options.
+func LoadDocumentOpts[T any](path string, opts DocumentOptions) (*Document[T], error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, &NotFoundError{Path: path}
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Document[T]{Path: path, ModTime: info.ModTime(), Version: fileVersion(data), CascadeRoot: opts.CascadeRoot}
+	body, err := DecodeFrontmatter(path, string(data), &d.Meta)
+	if err != nil {
+		return nil, err
+	}
+	d.Body = normalizeMarkdownBody(body)
+	if err := d.resolve(path, string(data)); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Save writes d to d.Path with WriteMarkdownFileOpts, atomically and under WithLock on
+// its directory, having checked, under the lock, that the file is still as d last saw
+// it. On success, d's ModTime and Version are those of the file written.
+func (d *Document[T]) Save() error {
+	return d.save(d.Path, d.Version)
+}
+
+// SaveAs writes d to path, which must not exist unless it's d.Path or Force is set,
+// and makes it d's path from then on.
+func (d *Document[T]) SaveAs(path string) error {
+	expected := Version("")
+	if filepath.Clean(path) == filepath.Clean(d.Path) {
+		expected = d.Version
+	}
+	if err := d.save(path, expected); err != nil {
+		return err
+	}
+	d.Path = path
+	return nil
+}
+
+// save writes d to path if the file there is at version expected, or if d.Force is set.
+func (d *Document[T]) save(path string, expected Version) error {
+	check := func(content string) error {
+		if d.Force {
+			return nil
+		}
+		actual, err := currentVersion(path)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return &ConflictError{Path: path, Expected: expected, Actual: actual, Changes: frontmatterConflictChanges(path, content)}
+		}
+		return nil
+	}
+	// By pointer, so a yaml.Node renders as the document it is.
+	content, err := writeMarkdownFile(path, &d.Meta, d.Body, d.Options, check)
+	if err != nil {
+		return err
+	}
+
+	if d.Options.AutoFields != nil {
+		var meta T
+		if _, err := DecodeFrontmatter(path, content, &meta); err != nil {
+			return err
+		}
+		d.Meta = meta
+	}
+	d.Body = normalizeMarkdownBody(d.Body)
+	d.Version = fileVersion([]byte(content))
+	if info, err := os.Stat(path); err == nil {
+		d.ModTime = info.ModTime()
+	}
+	return d.resolve(path, content)
+}
+
+// resolve sets d.Resolved from content, the document at path, if d.CascadeRoot is set.
+func (d *Document[T]) resolve(path, content string) error {
+	if d.CascadeRoot == "" {
+		d.Resolved = nil
+		return nil
+	}
+	var meta map[string]interface{}
+	if _, err := DecodeFrontmatter(path, content, &meta); err != nil {
+		return err
+	}
+	resolved, err := ResolveMetadata(d.CascadeRoot, path, meta)
+	if err != nil {
+		return err
+	}
+	d.Resolved = resolved
+	return nil
+}
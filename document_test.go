@@ -0,0 +1,181 @@
+// ABOUTME: Tests for Document: loading, saving, new files, SaveAs, and optimistic conflict detection.
+// ABOUTME: Conflicts are provoked by writes between load and save, and by concurrent savers of one version.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+type docMeta struct {
+	Title string   `yaml:"title"`
+	Tags  []string `yaml:"tags,omitempty"`
+}
+
+func TestDocument_LoadSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.md")
+	writeFileString(t, path, "---\ntitle: Hello\n---\r\nBody.\r\n")
+
+	d, err := LoadDocument[docMeta](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Meta.Title != "Hello" || d.Body != "Body.\n" || d.Version == "" || d.ModTime.IsZero() {
+		t.Fatalf("loaded %+v", d)
+	}
+
+	d.Meta.Tags = []string{"go"}
+	d.Body = "New body."
+	loaded := d.Version
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFileString(t, path); got != "---\ntitle: Hello\ntags:\n    - go\n---\nNew body.\n" {
+		t.Errorf("file = %q", got)
+	}
+	if d.Version == loaded || d.Body != "New body.\n" {
+		t.Errorf("after save: version %q, body %q", d.Version, d.Body)
+	}
+
+	// Saving again, unchanged on disk, succeeds.
+	d.Meta.Title = "Again"
+	if err := d.Save(); err != nil {
+		t.Errorf("second save: %v", err)
+	}
+
+	if _, err := LoadDocument[docMeta](filepath.Join(t.TempDir(), "missing.md")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: err = %v", err)
+	}
+	writeFileString(t, path, "---\ntitle: [broken\n---\n")
+	if _, err := LoadDocument[docMeta](path); err == nil {
+		t.Error("expected an error for broken frontmatter")
+	}
+}
+
+func TestDocument_Conflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.md")
+	writeFileString(t, path, "---\ntitle: One\n---\n")
+	d, err := LoadDocument[docMeta](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFileString(t, path, "---\ntitle: Someone else's\n---\n")
+	d.Meta.Title = "Mine"
+	conflict := asConflict(t, d.Save())
+	if conflict.Expected != d.Version || conflict.Actual == d.Version {
+		t.Errorf("conflict = %+v", conflict)
+	}
+	if want := []Change{{Path: "title", Kind: ChangeModified, Old: "Someone else's", New: "Mine"}}; !reflect.DeepEqual(conflict.Changes, want) {
+		t.Errorf("conflict changes = %+v, want %+v", conflict.Changes, want)
+	}
+	if got := readFileString(t, path); got != "---\ntitle: Someone else's\n---\n" {
+		t.Errorf("conflicting save wrote %q", got)
+	}
+
+	// Force overwrites it.
+	d.Force = true
+	if err := d.Save(); err != nil {
+		t.Fatalf("forced save: %v", err)
+	}
+	if got := readFileString(t, path); got != "---\ntitle: Mine\n---\n" {
+		t.Errorf("forced save wrote %q", got)
+	}
+}
+
+func TestDocument_NewFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "new.md")
+	d := &Document[docMeta]{Path: path, Meta: docMeta{Title: "New"}, Body: "Fresh."}
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFileString(t, path); got != "---\ntitle: New\n---\nFresh.\n" {
+		t.Errorf("file = %q", got)
+	}
+
+	// A second new Document for the same path conflicts with the first.
+	other := &Document[docMeta]{Path: path, Meta: docMeta{Title: "Other"}}
+	asConflict(t, other.Save())
+
+	// SaveAs to a new path moves the Document there; to an existing one, it conflicts.
+	copyPath := filepath.Join(dir, "copy.md")
+	if err := d.SaveAs(copyPath); err != nil || d.Path != copyPath {
+		t.Fatalf("SaveAs: %v, path %q", err, d.Path)
+	}
+	if err := d.Save(); err != nil {
+		t.Errorf("save after SaveAs: %v", err)
+	}
+	asConflict(t, d.SaveAs(path))
+	if d.Path != copyPath {
+		t.Errorf("failed SaveAs changed the path to %q", d.Path)
+	}
+	if err := d.SaveAs(copyPath); err != nil {
+		t.Errorf("SaveAs to its own path: %v", err)
+	}
+}
+
+func TestDocument_ConcurrentSavers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.md")
+	writeFileString(t, path, "---\ntitle: Start\n---\n")
+
+	const savers = 8
+	var wg sync.WaitGroup
+	var saved, conflicts atomic.Int32
+	for i := 0; i < savers; i++ {
+		d, err := LoadDocument[docMeta](path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d.Body = string(rune('a' + i))
+			switch err := d.Save(); {
+			case err == nil:
+				saved.Add(1)
+			case errors.Is(err, ErrConflict):
+				conflicts.Add(1)
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if saved.Load() != 1 || conflicts.Load() != savers-1 {
+		t.Errorf("%d saved, %d conflicts; want 1 and %d", saved.Load(), conflicts.Load(), savers-1)
+	}
+}
+
+func TestDocument_NodeAndAutoFields(t *testing.T) {
+	useClock(t)
+	path := filepath.Join(t.TempDir(), "post.md")
+	writeFileString(t, path, "---\n# kept\ntitle: Node Doc # and this\n---\nBody.\n")
+
+	d, err := LoadDocument[yaml.Node](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Options.AutoFields = &AutoFields{Slug: "slug"}
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	want := "---\n# kept\ntitle: Node Doc # and this\nslug: node-doc\n---\nBody.\n"
+	if got := readFileString(t, path); got != want {
+		t.Errorf("file = %q, want %q", got, want)
+	}
+	// Meta was read back with the slug filled in.
+	if slug := yamlChild(yamlContentNode(&d.Meta), "slug"); slug == nil || slug.Value != "node-doc" {
+		t.Errorf("Meta lacks the slug: %+v", d.Meta)
+	}
+	if err := d.Save(); err != nil {
+		t.Errorf("save after AutoFields: %v", err)
+	}
+}
@@ -1,71 +1,509 @@
 // ABOUTME: Markdown frontmatter parsing and rendering utilities.
-// ABOUTME: Splits/joins YAML frontmatter (between --- delimiters) and markdown body text.
+// ABOUTME: Splits/joins YAML frontmatter (between --- delimiters) and markdown body text, and decodes it, TOML and JSON included.
 package mdstore
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
+	"sync/atomic"
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
 
 // ParseFrontmatter splits YAML frontmatter from markdown body.
 // Returns the raw YAML string (between --- delimiters) and the body text.
-// If no frontmatter found, returns empty yaml and full content as body.
+// The delimiters must be lines of their own, and the closing one may also be "..."
+// (see findFrontmatter).
+// If no frontmatter found, returns empty yaml and full content as body; so does
+// frontmatter over the size limit (see SetMaxYAMLSize). A UTF-8 byte order mark at the
+// start of content is skipped, and is part of neither the YAML nor the body.
 func ParseFrontmatter(content string) (yamlStr string, body string) {
-	// Normalize \r\n line endings to \n for consistent parsing
-	content = strings.ReplaceAll(content, "\r\n", "\n")
-	// Remove any stray \r characters
-	content = strings.ReplaceAll(content, "\r", "\n")
-	trimmed := strings.TrimSpace(content)
+	yamlStr, body, _, _ = splitFrontmatter(content)
+	return yamlStr, body
+}
+
+// ParseFrontmatterDelim is ParseFrontmatter for YAML frontmatter between custom
+// fences, such as the "= = =" lines some tools write: open must be the first line
+// that isn't blank, as "---" must be, and the block ends at the next line that is
+// close. Both are compared without surrounding blanks, and neither is a pattern. The
+// fences say what the block is, so, unlike "---" lines, they're taken as frontmatter
+// whatever is between them (see SetLenientFrontmatter). An empty open or close finds
+// no frontmatter.
+func ParseFrontmatterDelim(content, open, close string) (yamlStr string, body string) {
+	fm := scanDelimFrontmatter(content, strings.TrimSpace(open), strings.TrimSpace(close))
+	if fm.format == FormatNone || int64(fm.metaEnd-fm.metaStart) > currentMaxYAMLSize() {
+		return "", plainBody(content)
+	}
+	yamlStr = normalizeNewlines(content[fm.metaStart:fm.metaEnd])
+	body = strings.TrimRightFunc(normalizeNewlines(content[fm.bodyStart:]), unicode.IsSpace)
+	return yamlStr, body
+}
+
+// DecodeFrontmatter splits content like ParseFrontmatter, unmarshals the frontmatter
+// into dest, and returns the body. Without frontmatter, or with empty frontmatter,
+// dest is left untouched. Malformed YAML returns a *YAMLError whose line counts from
+// the top of content, so it points into the markdown file; path names that file in
+// the error and may be empty. Frontmatter over the size limit (see SetMaxYAMLSize)
+// returns a *FileTooLargeError. If dest implements Validator, the decoded value is validated.
+//
+// TOML frontmatter, between "+++" lines (see ParseFrontmatterFormat), is decoded too,
+// using dest's yaml tags, and so is a leading JSON object, using its json tags; their
+// errors are *FrontmatterError, and a "+++" block closed by "---" is a *FenceError.
+func DecodeFrontmatter(path, content string, dest interface{}) (body string, err error) {
+	return decodeFrontmatter(path, content, dest, FrontmatterOptions{})
+}
+
+// ParseFrontmatterAs splits content like ParseFrontmatter and decodes the frontmatter
+// into a T, returning it with the body. Without frontmatter it returns the zero T and
+// no error. Errors are those of DecodeFrontmatter, without a path; meta is the zero T
+// when there is one.
+func ParseFrontmatterAs[T any](content string) (meta T, body string, err error) {
+	return parseFrontmatterAs[T](content, FrontmatterOptions{})
+}
+
+// ParseFrontmatterAsStrictFields is ParseFrontmatterAs that fails on keys T has no
+// field for, such as a typo'd "tittle:", like ReadYAMLStrictFields.
+func ParseFrontmatterAsStrictFields[T any](content string) (meta T, body string, err error) {
+	return parseFrontmatterAs[T](content, FrontmatterOptions{StrictFields: true})
+}
+
+// FrontmatterOptions controls ParseFrontmatterAsOpts.
+type FrontmatterOptions struct {
+	// StrictFields fails on keys T has no field for, as ParseFrontmatterAsStrictFields does.
+	StrictFields bool
+
+	// StoredTimes reads plain time.Time fields, at any depth, as StoredTime reads
+	// itself: with ParseTime, so as FormatTime writes them, falling back to a date alone
+	// ("2006-01-02", as older files have them), quoted or not. An empty string reads as
+	// the zero time, and a value that's neither is a *YAMLError naming its line. It
+	// applies to YAML and TOML frontmatter; JSON has its own rules for times. The
+	// matching option for writing is YAMLOptions.StoredTimes.
+	StoredTimes bool
+}
+
+// ParseFrontmatterAsOpts is ParseFrontmatterAs with options.
+func ParseFrontmatterAsOpts[T any](content string, opts FrontmatterOptions) (meta T, body string, err error) {
+	return parseFrontmatterAs[T](content, opts)
+}
+
+func parseFrontmatterAs[T any](content string, opts FrontmatterOptions) (meta T, body string, err error) {
+	body, err = decodeFrontmatter("", content, &meta, opts)
+	if err != nil {
+		var zero T
+		return zero, body, err
+	}
+	return meta, body, nil
+}
+
+// decodeFrontmatter is DecodeFrontmatter with options.
+func decodeFrontmatter(path, content string, dest interface{}, opts FrontmatterOptions) (body string, err error) {
+	fm, raw, body, err := extractFrontmatter(content)
+	if err != nil {
+		return body, setFrontmatterErrorPath(err, path)
+	}
+	return body, decodeFrontmatterBlock(path, fm, raw, dest, opts)
+}
+
+// setFrontmatterErrorPath sets path on an error from extractFrontmatter and returns it.
+func setFrontmatterErrorPath(err error, path string) error {
+	switch e := err.(type) {
+	case *FileTooLargeError:
+		e.Path = path
+	case *FenceError:
+		e.Path = path
+	}
+	return err
+}
+
+// decodeFrontmatterBlock decodes raw, the frontmatter extractFrontmatter found as fm in
+// the file at path, into dest.
+func decodeFrontmatterBlock(path string, fm frontmatterBlock, raw string, dest interface{}, opts FrontmatterOptions) error {
+	switch fm.format {
+	case FormatNone:
+		return nil
+	case FormatTOML:
+		return decodeTOMLFrontmatter(path, raw, fm.line, dest, opts)
+	case FormatJSON:
+		return decodeJSONFrontmatter(path, raw, fm.line, dest, opts.StrictFields)
+	}
+	if isEmptyYAML([]byte(raw)) {
+		return nil
+	}
+	if err := checkYAMLAliases(path, []byte(raw), fm.line); err != nil {
+		return err
+	}
+	if err := decodeFrontmatterYAML([]byte(raw), dest, opts); err != nil {
+		return newYAMLError(path, err, fm.line)
+	}
+	return validate(path, dest)
+}
+
+// splitFrontmatter is ParseFrontmatter that also returns the 1-based line of content
+// on which the YAML starts, or 0 if there is no frontmatter. Frontmatter over the size
+// limit is left in the body and reported as a *FileTooLargeError without a path.
+func splitFrontmatter(content string) (yamlStr, body string, line int, tooLarge *FileTooLargeError) {
+	fm, raw, body, err := extractFrontmatter(content)
+	if fm.format != FormatYAML {
+		return "", plainBody(content), 0, nil
+	}
+	if err != nil {
+		return "", body, 0, err.(*FileTooLargeError)
+	}
+	return raw, body, fm.line, nil
+}
+
+// extractFrontmatter finds frontmatter of any format in content (see scanFrontmatter)
+// and returns it, without its fences, and the body, with line endings normalized to
+// \n and trailing whitespace trimmed from the body. Without frontmatter, body is the
+// whole content, less any byte order mark. Frontmatter over the size limit is left in the body and reported as a
+// *FileTooLargeError, and mismatched fences as a *FenceError, both without a path.
+func extractFrontmatter(content string) (fm frontmatterBlock, raw, body string, err error) {
+	fm, fenceErr := scanFrontmatter(content)
+	if fenceErr != nil {
+		return fm, "", plainBody(content), fenceErr
+	}
+	if fm.format == FormatNone {
+		return fm, "", plainBody(content), nil
+	}
+	if size, limit := int64(fm.metaEnd-fm.metaStart), currentMaxYAMLSize(); size > limit {
+		return fm, "", plainBody(content), &FileTooLargeError{Size: size, Limit: limit, Frontmatter: true}
+	}
+
+	raw = normalizeNewlines(content[fm.metaStart:fm.metaEnd])
+	body = strings.TrimRightFunc(normalizeNewlines(content[fm.bodyStart:]), unicode.IsSpace)
+	return fm, raw, body, nil
+}
+
+// utf8BOM is the byte order mark some Windows editors write at the start of UTF-8
+// files. It's skipped when looking for frontmatter and dropped from bodies, and never
+// written.
+const utf8BOM = "\uFEFF"
+
+// plainBody returns content, which has no frontmatter, as a body: without a byte
+// order mark, and with line endings normalized to \n.
+func plainBody(content string) string {
+	return normalizeNewlines(strings.TrimPrefix(content, utf8BOM))
+}
+
+// frontmatterBlock holds the format and byte offsets of frontmatter found in a document.
+type frontmatterBlock struct {
+	format    Format // FormatNone if there is no frontmatter
+	start     int    // the opening fence's line (JSON: its "{")
+	metaStart int    // the metadata, just after the opening fence's line break (JSON: its "{")
+	metaEnd   int    // the end of the metadata, before the line break ending its last line (JSON: after its "}")
+	bodyStart int    // the body, after the closing fence's line break
+	line      int    // the 1-based line on which the metadata starts
+}
+
+// findFrontmatter is scanFrontmatter for YAML frontmatter only.
+func findFrontmatter(content string) (frontmatterBlock, bool) {
+	fm, _ := scanFrontmatter(content)
+	return fm, fm.format == FormatYAML
+}
+
+// scanFrontmatter locates frontmatter in content, scanning it line by line: after
+// a UTF-8 byte order mark and any leading whitespace, a line of three or more dashes
+// ("---", or "----" as some tools write it) opens YAML frontmatter, and the next line
+// of exactly as many dashes, or "..." (YAML's document end marker), closes it; "+++"
+// opens TOML frontmatter, closed by "+++". Fence lines may carry trailing spaces or
+// tabs. "---" elsewhere in a line, as in a block scalar holding a horizontal rule,
+// isn't a fence, and neither is a dash line of another length. Lines end with \n, \r\n, or a lone \r. Unless SetLenientFrontmatter is on,
+// the text between YAML fences must also look like metadata (see looksLikeFrontmatter).
+// A "+++" block with no closing "+++" but a "---" line returns a *FenceError. A
+// leading "{" opens JSON frontmatter instead (see scanJSONFrontmatter).
+func scanFrontmatter(content string) (frontmatterBlock, *FenceError) {
+	lead, pos, line := frontmatterStart(content)
+	if strings.HasPrefix(content[lead:], "{") {
+		return scanJSONFrontmatter(content, lead, line), nil
+	}
+
+	text, next := nextLine(content, pos)
+	fm := frontmatterBlock{start: pos, metaStart: next, line: line + 1}
+	fence := strings.TrimSpace(text)
+	switch {
+	case isDashFence(fence):
+		fm.format = FormatYAML
+	case fence == "+++":
+		fm.format = FormatTOML
+	default:
+		return frontmatterBlock{}, nil
+	}
 
-	if !strings.HasPrefix(trimmed, "---") {
-		return "", content
+	var fenceErr *FenceError
+	for pos, line = next, fm.line; pos < len(content); pos, line = next, line+1 {
+		text, next = nextLine(content, pos)
+		closing := strings.TrimRight(text, " \t")
+		if !isClosingFence(fm.format, fence, closing) {
+			if fm.format == FormatTOML && closing == "---" && fenceErr == nil {
+				fenceErr = &FenceError{Line: line, Open: "+++", Close: "---"}
+			}
+			continue
+		}
+		fm.metaEnd = max(pos-lineBreakBefore(content, pos), fm.metaStart)
+		fm.bodyStart = next
+		if fm.format == FormatYAML && !lenientFrontmatter.Load() && !looksLikeFrontmatter(content[fm.metaStart:fm.metaEnd]) {
+			return frontmatterBlock{}, nil
+		}
+		return fm, nil
 	}
+	return frontmatterBlock{}, fenceErr
+}
 
-	// Find the closing ---
-	rest := trimmed[3:]
-	// Skip the newline after opening ---
-	if len(rest) > 0 && rest[0] == '\n' {
-		rest = rest[1:]
-	} else if len(rest) > 1 && rest[0] == '\r' && rest[1] == '\n' {
-		rest = rest[2:]
+// scanDelimFrontmatter locates YAML frontmatter between the fences open and close, as
+// ParseFrontmatterDelim describes them.
+func scanDelimFrontmatter(content, open, close string) frontmatterBlock {
+	_, pos, line := frontmatterStart(content)
+	text, next := nextLine(content, pos)
+	if open == "" || close == "" || strings.TrimSpace(text) != open {
+		return frontmatterBlock{}
 	}
+	fm := frontmatterBlock{format: FormatYAML, start: pos, metaStart: next, line: line + 1}
+	for pos = next; pos < len(content); pos = next {
+		text, next = nextLine(content, pos)
+		if strings.TrimSpace(text) == close {
+			fm.metaEnd = max(pos-lineBreakBefore(content, pos), fm.metaStart)
+			fm.bodyStart = next
+			return fm
+		}
+	}
+	return frontmatterBlock{}
+}
 
-	closingIdx := strings.Index(rest, "\n---")
-	if closingIdx < 0 {
-		// No closing delimiter found
-		return "", content
+// scanJSONFrontmatter locates JSON frontmatter: an object opening at content[start],
+// on the given line, and running to its matching "}", which must end its line. Braces
+// inside strings don't count. So that a body opening with a template tag such as
+// "{{ .Title }}" stays markdown, the object must start with a key or be empty; it's
+// otherwise left for the decoder to check.
+func scanJSONFrontmatter(content string, start, line int) frontmatterBlock {
+	if !jsonObjectKeyed(content[start:]) {
+		return frontmatterBlock{}
 	}
+	end := jsonObjectEnd(content[start:])
+	if end < 0 {
+		return frontmatterBlock{}
+	}
+	end += start
+	rest, next := nextLine(content, end)
+	if strings.TrimSpace(rest) != "" {
+		return frontmatterBlock{}
+	}
+	return frontmatterBlock{format: FormatJSON, start: start, metaStart: start, metaEnd: end, bodyStart: next, line: line}
+}
 
-	yamlStr = rest[:closingIdx]
+// jsonObjectKeyed reports whether the JSON object opening s starts with a key or is
+// empty, going by its first character after the "{".
+func jsonObjectKeyed(s string) bool {
+	inner := strings.TrimLeftFunc(s[1:], unicode.IsSpace)
+	return strings.HasPrefix(inner, `"`) || strings.HasPrefix(inner, "}")
+}
+
+// jsonObjectEnd returns the offset just past the "}" closing the JSON object that
+// opens at s[0], or -1 if it isn't closed.
+func jsonObjectEnd(s string) int {
+	var braces jsonBraces
+	return braces.scan(s)
+}
 
-	// Body is everything after the closing ---
-	afterClose := rest[closingIdx+4:] // len("\n---") == 4
-	// Trim a single leading newline from the body
-	if len(afterClose) > 0 && afterClose[0] == '\n' {
-		afterClose = afterClose[1:]
-	} else if len(afterClose) > 1 && afterClose[0] == '\r' && afterClose[1] == '\n' {
-		afterClose = afterClose[2:]
+// jsonBraces tracks the nesting of braces through JSON text fed to it in pieces.
+type jsonBraces struct {
+	depth             int
+	inString, escaped bool
+}
+
+// scan feeds s to b and returns the offset in s just past the "}" closing the
+// outermost object, or -1 if it's still open.
+func (b *jsonBraces) scan(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case b.escaped:
+			b.escaped = false
+		case b.inString && c == '\\':
+			b.escaped = true
+		case c == '"':
+			b.inString = !b.inString
+		case b.inString:
+		case c == '{':
+			b.depth++
+		case c == '}':
+			if b.depth--; b.depth == 0 {
+				return i + 1
+			}
+		}
 	}
+	return -1
+}
 
-	return yamlStr, afterClose
+// frontmatterStart returns where scanFrontmatter looks for an opening fence in
+// content: the offset of its first character that isn't a space or byte order mark,
+// and the offset and 1-based number of the line holding it, so the fence is a whole
+// line.
+func frontmatterStart(content string) (lead, lineStart, line int) {
+	bom := len(content) - len(strings.TrimPrefix(content, utf8BOM))
+	lead = len(content) - len(strings.TrimLeftFunc(content[bom:], unicode.IsSpace))
+	lineStart = max(strings.LastIndexAny(content[:lead], "\r\n")+1, bom)
+	return lead, lineStart, 1 + countLineBreaks(content[:lineStart])
+}
+
+// isDashFence reports whether a line, without surrounding blanks, is three or more
+// dashes, which open YAML frontmatter.
+func isDashFence(line string) bool {
+	return len(line) >= 3 && strings.Trim(line, "-") == ""
+}
+
+// isClosingFence reports whether a line, without trailing blanks, closes frontmatter
+// of the given format opened by fence.
+func isClosingFence(format Format, fence, line string) bool {
+	switch format {
+	case FormatYAML:
+		return line == fence || line == "..."
+	case FormatTOML:
+		return line == "+++"
+	}
+	return false
+}
+
+var lenientFrontmatter atomic.Bool
+
+// SetLenientFrontmatter switches between the two ways of telling frontmatter from a
+// document that opens with a "---" horizontal rule. By default, the text between the
+// fences is frontmatter only if it's empty, parses as a YAML mapping, or fails to
+// parse but opens with a "key:" line (so a typo in real frontmatter is still reported
+// as a *YAMLError); otherwise the fences are markdown and the whole document is body.
+// Lenient mode, the behavior of earlier versions, takes any pair of fences as
+// frontmatter.
+func SetLenientFrontmatter(enabled bool) {
+	lenientFrontmatter.Store(enabled)
+}
+
+// frontmatterKeyLine matches a line that opens a YAML mapping entry.
+var frontmatterKeyLine = regexp.MustCompile(`^[^\s#:\-][^:]*:(\s|$)`)
+
+// looksLikeFrontmatter reports whether yamlText, found between frontmatter fences,
+// is metadata rather than markdown (see SetLenientFrontmatter). Text over the size
+// limit is taken as frontmatter, to be reported as too large rather than parsed.
+func looksLikeFrontmatter(yamlText string) bool {
+	if strings.TrimSpace(yamlText) == "" || int64(len(yamlText)) > currentMaxYAMLSize() {
+		return true
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(normalizeNewlines(yamlText)), &doc); err != nil {
+		first, _ := nextLine(yamlText, 0)
+		return frontmatterKeyLine.MatchString(first)
+	}
+	if doc.Kind == 0 {
+		return true // comments only
+	}
+	root := doc.Content[0]
+	return root.Kind == yaml.MappingNode || (root.Kind == yaml.ScalarNode && root.Tag == "!!null")
+}
+
+// nextLine returns the line of content starting at pos, without its line break, and
+// the position after the line break.
+func nextLine(content string, pos int) (text string, next int) {
+	i := strings.IndexAny(content[pos:], "\r\n")
+	if i < 0 {
+		return content[pos:], len(content)
+	}
+	end := pos + i
+	if strings.HasPrefix(content[end:], "\r\n") {
+		return content[pos:end], end + 2
+	}
+	return content[pos:end], end + 1
+}
+
+// lineBreakBefore returns the length of the line break just before pos, 0 if none.
+func lineBreakBefore(content string, pos int) int {
+	switch {
+	case strings.HasSuffix(content[:pos], "\r\n"):
+		return 2
+	case strings.HasSuffix(content[:pos], "\n"), strings.HasSuffix(content[:pos], "\r"):
+		return 1
+	}
+	return 0
+}
+
+// countLineBreaks counts the line breaks in s, treating \r\n as one.
+func countLineBreaks(s string) int {
+	return strings.Count(s, "\n") + strings.Count(s, "\r") - strings.Count(s, "\r\n")
+}
+
+// normalizeNewlines converts \r\n and lone \r line endings to \n.
+func normalizeNewlines(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n")
 }
 
 // RenderFrontmatter renders YAML frontmatter + body into a complete markdown string.
-// metadata is marshaled to YAML between --- delimiters.
+// metadata is marshaled to YAML between --- delimiters. If metadata implements
+// Validator, it must pass first. Metadata with nothing in it, such as nil, an empty
+// map, or a struct whose fields are all omitted, renders as the body alone, with no
+// block, so a document without frontmatter stays that way through ParseFrontmatter
+// and back. A byte order mark at the start of body is dropped.
 func RenderFrontmatter(metadata interface{}, body string) (string, error) {
-	yamlBytes, err := yaml.Marshal(metadata)
+	return RenderFrontmatterOpts(metadata, body, YAMLOptions{})
+}
+
+// RenderFrontmatterAs is RenderFrontmatter for a typed meta, the inverse of
+// ParseFrontmatterAs.
+func RenderFrontmatterAs[T any](meta T, body string) (string, error) {
+	return RenderFrontmatter(meta, body)
+}
+
+// RenderFrontmatterAsOpts is RenderFrontmatterAs with explicit encoding options, as
+// RenderFrontmatterOpts takes them; opts.StoredTimes matches
+// FrontmatterOptions.StoredTimes for ParseFrontmatterAsOpts.
+func RenderFrontmatterAsOpts[T any](meta T, body string, opts YAMLOptions) (string, error) {
+	return RenderFrontmatterOpts(meta, body, opts)
+}
+
+// RenderFrontmatterOpts is RenderFrontmatter with explicit encoding options, so
+// frontmatter can match sidecar files written with WriteYAMLOpts. opts.Header is
+// ignored, and opts.Fence, if set, replaces the "---" lines. The fences and YAML end
+// lines with \n, and the body is written as given, unless opts.CRLF is set, when
+// every line of the document ends with \r\n.
+func RenderFrontmatterOpts(metadata interface{}, body string, opts YAMLOptions) (string, error) {
+	fence := "---"
+	if opts.Fence != "" {
+		if fence = opts.Fence; strings.ContainsAny(fence, "\r\n") || strings.TrimSpace(fence) == "" {
+			return "", fmt.Errorf("mdstore: frontmatter fence %q is not a line", fence)
+		}
+	}
+	if err := validate("", metadata); err != nil {
+		return "", err
+	}
+	yamlBytes, err := marshalYAML(metadata, opts)
 	if err != nil {
 		return "", err
 	}
 
 	var b strings.Builder
-	b.WriteString("---\n")
-	b.Write(yamlBytes)
-	b.WriteString("---\n")
-	if body != "" {
-		b.WriteString(body)
+	if !emptyYAMLDocument(yamlBytes) {
+		b.WriteString(fence + "\n")
+		b.Write(yamlBytes)
+		b.WriteString(fence + "\n")
 	}
+	b.WriteString(strings.TrimPrefix(body, utf8BOM))
 
+	if opts.CRLF {
+		return toCRLF(b.String()), nil
+	}
 	return b.String(), nil
 }
+
+// emptyYAMLDocument reports whether data, as marshalYAML returns it, holds no metadata:
+// an empty mapping, or null.
+func emptyYAMLDocument(data []byte) bool {
+	switch string(data) {
+	case "{}\n", "null\n":
+		return true
+	}
+	return false
+}
+
+// toCRLF converts s's line endings, whatever they are, to \r\n.
+func toCRLF(s string) string {
+	return strings.ReplaceAll(normalizeNewlines(s), "\n", "\r\n")
+}
@@ -0,0 +1,52 @@
+// ABOUTME: Benchmarks for frontmatter-only reads against whole-file reads of markdown documents.
+// ABOUTME: ReadFrontmatter's time should stay flat as the body grows; ReadMarkdownFile's grows with it.
+package mdstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var markdownBenchBodySizes = []int{1 << 10, 1 << 20, 16 << 20}
+
+// writeBenchDocument writes a post with typical frontmatter and a body of about
+// bodySize bytes, returning its path.
+func writeBenchDocument(b *testing.B, bodySize int) string {
+	b.Helper()
+	path := filepath.Join(b.TempDir(), "post.md")
+	content := "---\ntitle: Hello\npublished: 2026-02-05T10:04:05Z\nauthor:\n  name: Ada\ntags: [go, yaml]\n---\n" +
+		strings.Repeat("Some body text that goes on.\n", bodySize/29+1)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func BenchmarkReadFrontmatter(b *testing.B) {
+	for _, size := range markdownBenchBodySizes {
+		b.Run(fmt.Sprintf("body=%dKiB", size>>10), func(b *testing.B) {
+			path := writeBenchDocument(b, size)
+			for b.Loop() {
+				if _, _, err := ReadFrontmatter[postMeta](path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadMarkdownFile(b *testing.B) {
+	for _, size := range markdownBenchBodySizes {
+		b.Run(fmt.Sprintf("body=%dKiB", size>>10), func(b *testing.B) {
+			path := writeBenchDocument(b, size)
+			for b.Loop() {
+				if _, _, _, err := ReadMarkdownFile[postMeta](path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
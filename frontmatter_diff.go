@@ -0,0 +1,188 @@
+// ABOUTME: Differences between documents' frontmatter, by dotted path, for review tooling and change detection.
+// ABOUTME: Provides DiffFrontmatter, DiffMeta, and Change, which migration reports and conflict errors use too.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ChangeKind is what a Change is.
+type ChangeKind string
+
+const (
+	ChangeAdded    ChangeKind = "added"   // a value only the second document has
+	ChangeRemoved  ChangeKind = "removed" // a value only the first document has
+	ChangeModified ChangeKind = "changed" // a value both have, differently
+	ChangeBody     ChangeKind = "body"    // the bodies differ; DiffFrontmatter only
+)
+
+// Change is a difference between two documents' metadata, as DiffMeta finds it. It's
+// written as YAML with only the values its Kind has, so a change to or from false or
+// null still shows both.
+type Change struct {
+	// Path is the dotted path (see GetYAMLValue) of the value, with list indexes as
+	// keys, as "author.name" or "tags.1"; empty for ChangeBody.
+	Path string      `yaml:"path"`
+	Kind ChangeKind  `yaml:"kind"`
+	Old  interface{} `yaml:"old"` // the value in the first document, if Kind is removed or changed
+	New  interface{} `yaml:"new"` // the value in the second document, if Kind is added or changed
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (c Change) MarshalYAML() (interface{}, error) {
+	out := struct {
+		Path string       `yaml:"path,omitempty"`
+		Kind ChangeKind   `yaml:"kind"`
+		Old  *interface{} `yaml:"old,omitempty"`
+		New  *interface{} `yaml:"new,omitempty"`
+	}{Path: c.Path, Kind: c.Kind}
+	if c.Kind == ChangeRemoved || c.Kind == ChangeModified {
+		out.Old = &c.Old
+	}
+	if c.Kind == ChangeAdded || c.Kind == ChangeModified {
+		out.New = &c.New
+	}
+	return out, nil
+}
+
+// DiffMeta returns the differences between a and b, decoded frontmatter, in order of
+// path: values added, removed, or changed, whatever the order of their keys. Maps and
+// lists, as YAML decodes them, are compared deeply, a list item by item, so their
+// changes are those of the values in them; anything else, or a value that's a map in
+// one and not the other, is compared whole. Times are compared with time.Time.Equal.
+// Equal metadata, or two nil maps, has no differences.
+func DiffMeta(a, b map[string]interface{}) []Change {
+	var changes []Change
+	diffMetaMaps(nil, a, b, &changes)
+	return changes
+}
+
+// DiffFrontmatter returns the differences between the frontmatter of two documents,
+// decoded as DecodeFrontmatter decodes it, as DiffMeta finds them, followed by a
+// ChangeBody change if their bodies differ other than in line endings and trailing
+// whitespace. A document without frontmatter has none, so all of the other's values are
+// added or removed. Errors are DecodeFrontmatter's.
+func DiffFrontmatter(a, b string) ([]Change, error) {
+	var metaA, metaB map[string]interface{}
+	bodyA, err := DecodeFrontmatter("", a, &metaA)
+	if err != nil {
+		return nil, err
+	}
+	bodyB, err := DecodeFrontmatter("", b, &metaB)
+	if err != nil {
+		return nil, err
+	}
+	changes := DiffMeta(metaA, metaB)
+	if normalizeMarkdownBody(bodyA) != normalizeMarkdownBody(bodyB) {
+		changes = append(changes, Change{Kind: ChangeBody})
+	}
+	return changes, nil
+}
+
+// diffMetaMaps appends the differences between a and b, the maps at keys, to changes.
+func diffMetaMaps(keys []string, a, b map[string]interface{}, changes *[]Change) {
+	names := sortedKeys(a)
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		path := append(slices.Clone(keys), name)
+		av, inA := a[name]
+		bv, inB := b[name]
+		switch {
+		case !inB:
+			*changes = append(*changes, Change{Path: joinYAMLPath(path), Kind: ChangeRemoved, Old: av})
+		case !inA:
+			*changes = append(*changes, Change{Path: joinYAMLPath(path), Kind: ChangeAdded, New: bv})
+		default:
+			diffMetaValues(path, av, bv, changes)
+		}
+	}
+}
+
+// diffMetaValues appends the differences between a and b, the values at keys, to
+// changes.
+func diffMetaValues(keys []string, a, b interface{}, changes *[]Change) {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			diffMetaMaps(keys, av, bv, changes)
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			for i := range max(len(av), len(bv)) {
+				path := append(slices.Clone(keys), strconv.Itoa(i))
+				switch {
+				case i >= len(bv):
+					*changes = append(*changes, Change{Path: joinYAMLPath(path), Kind: ChangeRemoved, Old: av[i]})
+				case i >= len(av):
+					*changes = append(*changes, Change{Path: joinYAMLPath(path), Kind: ChangeAdded, New: bv[i]})
+				default:
+					diffMetaValues(path, av[i], bv[i], changes)
+				}
+			}
+			return
+		}
+	}
+	if !metaValuesEqual(a, b) {
+		*changes = append(*changes, Change{Path: joinYAMLPath(keys), Kind: ChangeModified, Old: a, New: b})
+	}
+}
+
+// metaValuesEqual reports whether a and b, values compared whole by DiffMeta, are equal.
+func metaValuesEqual(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// yamlConflictChanges returns the differences between the YAML file at path and src,
+// which a write found it changed since it was read, for a *ConflictError: nil unless
+// both are mappings, a missing file counting as an empty one.
+func yamlConflictChanges(path string, src interface{}) []Change {
+	var current map[string]interface{}
+	data, err := readFileMax(path, currentMaxYAMLSize())
+	if err == nil {
+		_, err = decodeYAMLData(path, data, &current)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	out, err := marshalYAML(src, YAMLOptions{})
+	if err != nil {
+		return nil
+	}
+	var next map[string]interface{}
+	if err := yaml.Unmarshal(out, &next); err != nil {
+		return nil
+	}
+	return DiffMeta(current, next)
+}
+
+// frontmatterConflictChanges is yamlConflictChanges for the markdown file at path and
+// content, what was to be written to it.
+func frontmatterConflictChanges(path, content string) []Change {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	changes, err := DiffFrontmatter(string(data), content)
+	if err != nil {
+		return nil
+	}
+	return changes
+}
@@ -0,0 +1,116 @@
+// ABOUTME: Tests for DiffMeta and DiffFrontmatter: nested paths, lists, times, bodies, and the YAML form of a Change.
+// ABOUTME: Conflict errors and migration reports that carry Changes are tested with their own features.
+package mdstore
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDiffMeta(t *testing.T) {
+	day := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	a := map[string]interface{}{
+		"title":  "Hello",
+		"draft":  true,
+		"date":   day,
+		"author": map[string]interface{}{"name": "Ada", "email": "ada@example.com"},
+		"tags":   []interface{}{"go", "yaml", "old"},
+		"a.b":    1,
+		"layout": map[string]interface{}{"wide": true},
+	}
+	b := map[string]interface{}{
+		"title":  "Hello",
+		"draft":  false,
+		"date":   day.In(time.FixedZone("X", 3600)), // the same instant
+		"author": map[string]interface{}{"name": "Grace", "url": "https://example.com"},
+		"tags":   []interface{}{"go", "toml"},
+		"a.b":    1,
+		"layout": "wide",
+		"weight": 3,
+	}
+	want := []Change{
+		{Path: `author.email`, Kind: ChangeRemoved, Old: "ada@example.com"},
+		{Path: `author.name`, Kind: ChangeModified, Old: "Ada", New: "Grace"},
+		{Path: `author.url`, Kind: ChangeAdded, New: "https://example.com"},
+		{Path: `draft`, Kind: ChangeModified, Old: true, New: false},
+		{Path: `layout`, Kind: ChangeModified, Old: map[string]interface{}{"wide": true}, New: "wide"},
+		{Path: `tags.1`, Kind: ChangeModified, Old: "yaml", New: "toml"},
+		{Path: `tags.2`, Kind: ChangeRemoved, Old: "old"},
+		{Path: `weight`, Kind: ChangeAdded, New: 3},
+	}
+	if got := DiffMeta(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffMeta =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := DiffMeta(a, a); got != nil {
+		t.Errorf("equal metadata has changes: %+v", got)
+	}
+	if got := DiffMeta(nil, map[string]interface{}{"x.y": 1}); !reflect.DeepEqual(got, []Change{{Path: `x\.y`, Kind: ChangeAdded, New: 1}}) {
+		t.Errorf("from nil = %+v", got)
+	}
+}
+
+func TestDiffFrontmatter(t *testing.T) {
+	a := "---\ntitle: Hello\ntags: [go]\n---\nBody\n"
+
+	// Key order and formatting don't matter; values do.
+	got, err := DiffFrontmatter(a, "---\ntags:\n  - go\ntitle: Hello\n---\nBody\n\n")
+	if err != nil || got != nil {
+		t.Errorf("reordered keys: %+v, %v", got, err)
+	}
+
+	got, err = DiffFrontmatter(a, "+++\ntitle = \"Hi\"\ntags = [\"go\"]\n+++\nNew body\n")
+	want := []Change{{Path: "title", Kind: ChangeModified, Old: "Hello", New: "Hi"}, {Kind: ChangeBody}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, %v; want %+v", got, err, want)
+	}
+
+	got, err = DiffFrontmatter("Body\n", a)
+	want = []Change{
+		{Path: "tags", Kind: ChangeAdded, New: []interface{}{"go"}},
+		{Path: "title", Kind: ChangeAdded, New: "Hello"},
+	}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("from no frontmatter: got %+v, %v; want %+v", got, err, want)
+	}
+
+	if _, err := DiffFrontmatter(a, "---\ntitle: [\n---\n"); err == nil {
+		t.Error("malformed frontmatter should fail")
+	}
+}
+
+func TestChange_YAML(t *testing.T) {
+	changes := []Change{
+		{Path: "draft", Kind: ChangeModified, Old: false, New: true},
+		{Path: "title", Kind: ChangeAdded, New: "Hi"},
+		{Path: "note", Kind: ChangeRemoved, Old: nil},
+		{Kind: ChangeBody},
+	}
+	out, err := yaml.Marshal(changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `- path: draft
+  kind: changed
+  old: false
+  new: true
+- path: title
+  kind: added
+  new: Hi
+- path: note
+  kind: removed
+  old: null
+- kind: body
+`
+	if string(out) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	var back []Change
+	if err := yaml.Unmarshal(out, &back); err != nil || !reflect.DeepEqual(back, changes) {
+		t.Errorf("read back %+v, %v", back, err)
+	}
+}
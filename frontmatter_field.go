@@ -0,0 +1,65 @@
+// ABOUTME: Dotted-path access to single frontmatter fields of a markdown document, for scripts and editor plugins.
+// ABOUTME: Provides Get/Set/DeleteFrontmatterField, the frontmatter counterparts of Get/Set/DeleteYAMLValue.
+package mdstore
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// GetFrontmatterField returns the value at a dotted path (see GetYAMLValue) in the
+// YAML frontmatter of content, decoded into an interface{}. found is false if there is
+// no frontmatter or no such field. Malformed frontmatter returns a *YAMLError whose
+// line counts from the top of content; TOML or JSON frontmatter returns an error.
+func GetFrontmatterField(content, dotted string) (value interface{}, found bool, err error) {
+	fm, raw, _, err := extractFrontmatter(content)
+	switch {
+	case err != nil:
+		return nil, false, err
+	case fm.format == FormatNone:
+		return nil, false, nil
+	case fm.format != FormatYAML:
+		return nil, false, notYAMLFrontmatterError("", fm.format)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil, false, newYAMLError("", err, fm.line)
+	}
+	if doc.Kind == 0 {
+		return nil, false, nil
+	}
+	node := yamlContentNode(&doc)
+	for _, key := range splitYAMLPath(dotted) {
+		if node = yamlChild(node, key); node == nil {
+			return nil, false, nil
+		}
+	}
+	if err := checkYAMLNodeAliases("", node, fm.line); err != nil {
+		return nil, false, err
+	}
+	if err := node.Decode(&value); err != nil {
+		return nil, false, newYAMLError("", err, fm.line)
+	}
+	return value, true, nil
+}
+
+// SetFrontmatterField sets the value at a dotted path in the frontmatter of content,
+// creating missing mappings along the way (see SetYAMLPath), and returns the new
+// content. A document without frontmatter gains a block. The body, the other fields,
+// and comments, including those on the field set, are kept as UpdateFrontmatter keeps
+// them.
+func SetFrontmatterField(content, dotted string, value interface{}) (string, error) {
+	return UpdateFrontmatter(content, func(doc *yaml.Node) error {
+		return SetYAMLPath(doc, dotted, value)
+	})
+}
+
+// DeleteFrontmatterField removes the mapping entry or sequence item at a dotted path
+// in the frontmatter of content, with its comments, and returns the new content. If
+// there's no such field, content is returned unchanged.
+func DeleteFrontmatterField(content, dotted string) (string, error) {
+	return UpdateFrontmatter(content, func(doc *yaml.Node) error {
+		deleteYAMLNodeKeys(doc, splitYAMLPath(dotted))
+		return nil
+	})
+}
@@ -0,0 +1,113 @@
+// ABOUTME: Tests for Get/Set/DeleteFrontmatterField: dotted paths, comments on the target field, and new blocks.
+// ABOUTME: Edits a commented post the way an editor plugin would and checks the rest of the document is untouched.
+package mdstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const commentedPost = "---\n" +
+	"# Post metadata\n" +
+	"title: Hello # shown in the index\n" +
+	"# Flip when it's ready.\n" +
+	"draft: true # keep hidden\n" +
+	"author:\n" +
+	"    name: Ada # pen name\n" +
+	"tags: [go, yaml]\n" +
+	"---\n" +
+	"# Hello\n\nBody.\n"
+
+func TestGetFrontmatterField(t *testing.T) {
+	for _, tc := range []struct {
+		dotted string
+		want   interface{}
+		found  bool
+	}{
+		{"title", "Hello", true},
+		{"draft", true, true},
+		{"author.name", "Ada", true},
+		{"author", map[string]interface{}{"name": "Ada"}, true},
+		{"tags", []interface{}{"go", "yaml"}, true},
+		{"tags.1", "yaml", true},
+		{"tags.2", nil, false},
+		{"missing", nil, false},
+		{"title.nested", nil, false},
+	} {
+		got, found, err := GetFrontmatterField(commentedPost, tc.dotted)
+		if err != nil || found != tc.found || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GetFrontmatterField(%q) = %v, %v, %v; want %v, %v", tc.dotted, got, found, err, tc.want, tc.found)
+		}
+	}
+
+	if _, found, err := GetFrontmatterField("# No frontmatter\n", "title"); found || err != nil {
+		t.Errorf("no frontmatter: %v, %v", found, err)
+	}
+	_, _, err := GetFrontmatterField("---\ntitle: Hello\nauthor: name: Jo\n---\n", "title")
+	if yamlErr := asYAMLError(t, err); yamlErr.Line != 3 {
+		t.Errorf("Line = %d, want 3", yamlErr.Line)
+	}
+	if _, _, err := GetFrontmatterField(tomlPost, "title"); err == nil {
+		t.Error("expected an error for TOML frontmatter")
+	}
+}
+
+func TestSetFrontmatterField(t *testing.T) {
+	for _, tc := range []struct {
+		name, dotted string
+		value        interface{}
+		old, new     string // the lines replaced; "" to expect the line added at the end
+	}{
+		{"commented field", "draft", false, "draft: true # keep hidden", "draft: false # keep hidden"},
+		{"nested commented field", "author.name", "Grace", "    name: Ada # pen name", "    name: Grace # pen name"},
+		{"new nested field", "author.email", "ada@example.com", "    name: Ada # pen name", "    name: Ada # pen name\n    email: ada@example.com"},
+		{"sequence item", "tags.0", "golang", "tags: [go, yaml]", "tags: [golang, yaml]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := SetFrontmatterField(commentedPost, tc.dotted, tc.value)
+			if err != nil {
+				t.Fatalf("SetFrontmatterField failed: %v", err)
+			}
+			want := strings.Replace(commentedPost, tc.old, tc.new, 1)
+			if got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+
+	got, err := SetFrontmatterField("# Hello\n", "meta.draft", false)
+	if err != nil || got != "---\nmeta:\n    draft: false\n---\n# Hello\n" {
+		t.Errorf("no frontmatter: %q, %v", got, err)
+	}
+	if _, err := SetFrontmatterField(commentedPost, "title.nested", 1); err == nil {
+		t.Error("expected an error setting below a scalar")
+	}
+	if got, err := SetFrontmatterField(tomlPost, "title", "x"); err == nil || got != tomlPost {
+		t.Errorf("TOML frontmatter: %q, %v", got, err)
+	}
+}
+
+func TestDeleteFrontmatterField(t *testing.T) {
+	got, err := DeleteFrontmatterField(commentedPost, "author.name")
+	if err != nil {
+		t.Fatalf("DeleteFrontmatterField failed: %v", err)
+	}
+	if strings.Contains(got, "Ada") || !strings.Contains(got, "title: Hello # shown in the index\n") ||
+		!strings.Contains(got, "draft: true # keep hidden\n") || !strings.HasSuffix(got, "---\n# Hello\n\nBody.\n") {
+		t.Errorf("got:\n%s", got)
+	}
+
+	got, err = DeleteFrontmatterField(commentedPost, "tags.1")
+	if err != nil || got != strings.Replace(commentedPost, "tags: [go, yaml]", "tags: [go]", 1) {
+		t.Errorf("sequence item: %v\n%s", err, got)
+	}
+	for _, dotted := range []string{"missing", "author.missing", "tags.5"} {
+		if got, err := DeleteFrontmatterField(commentedPost, dotted); err != nil || got != commentedPost {
+			t.Errorf("deleting %q changed the document: %v\n%s", dotted, err, got)
+		}
+	}
+	if got, err := DeleteFrontmatterField("# Hello\n", "title"); err != nil || got != "# Hello\n" {
+		t.Errorf("no frontmatter: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,217 @@
+// ABOUTME: Frontmatter formats other than YAML: detection, TOML and JSON decoding, and rendering in a given format.
+// ABOUTME: Provides ParseFrontmatterFormat and RenderFrontmatterFormat, and the errors for TOML and JSON frontmatter.
+package mdstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the format of a document's frontmatter, told apart by how it opens.
+type Format int
+
+const (
+	FormatNone Format = iota // no frontmatter
+	FormatYAML               // fenced with ---
+	FormatTOML               // fenced with +++
+	FormatJSON               // a JSON object, with no fences
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatNone:
+		return "none"
+	case FormatYAML:
+		return "yaml"
+	case FormatTOML:
+		return "toml"
+	case FormatJSON:
+		return "json"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ErrMismatchedFences is matched by a *FenceError with errors.Is.
+var ErrMismatchedFences = errors.New("mdstore: mismatched frontmatter fences")
+
+// FenceError reports frontmatter opened with one fence and closed with another, such
+// as a "+++" block ended by a "---" line.
+type FenceError struct {
+	Path  string // the file, if known
+	Line  int    // the 1-based line of the closing fence
+	Open  string // the opening fence
+	Close string // the closing fence
+}
+
+func (e *FenceError) Error() string {
+	return fmt.Sprintf("mdstore: %s: frontmatter opened with %q is closed with %q", location(e.Path, e.Line), e.Open, e.Close)
+}
+
+func (e *FenceError) Is(target error) bool {
+	return target == ErrMismatchedFences
+}
+
+// FrontmatterError reports TOML or JSON frontmatter that doesn't parse, or doesn't fit
+// the value it's decoded into. YAML frontmatter reports these as a *YAMLError.
+type FrontmatterError struct {
+	Path   string // the file, if known
+	Line   int    // the 1-based line of the problem, or where the frontmatter starts
+	Format Format
+	Err    error // the underlying error
+	msg    string
+}
+
+func (e *FrontmatterError) Error() string {
+	return fmt.Sprintf("mdstore: %s: %s frontmatter: %s", location(e.Path, e.Line), e.Format, e.msg)
+}
+
+func (e *FrontmatterError) Unwrap() error {
+	return e.Err
+}
+
+// location formats a file and line for an error message, leaving out what's unknown.
+func location(path string, line int) string {
+	switch {
+	case path == "":
+		return fmt.Sprintf("line %d", line)
+	case line == 0:
+		return path
+	}
+	return fmt.Sprintf("%s:%d", path, line)
+}
+
+// ParseFrontmatterFormat splits content into its frontmatter, without the fences, and
+// body, and reports the frontmatter's format: YAML between "---" lines, TOML between
+// "+++" lines, or JSON, an object opening the document as Hugo and a lot of Node
+// tooling write it, with its braces kept in raw. raw and body are as ParseFrontmatter
+// returns them. Content without frontmatter, with mismatched fences, or with
+// frontmatter over the size limit (see SetMaxYAMLSize) is all body, with FormatNone;
+// DecodeFrontmatter reports the last two.
+func ParseFrontmatterFormat(content string) (format Format, raw string, body string) {
+	fm, raw, body, err := extractFrontmatter(content)
+	if err != nil {
+		return FormatNone, "", body
+	}
+	return fm.format, raw, body
+}
+
+// decodeTOMLFrontmatter decodes TOML frontmatter starting on line firstLine of the
+// file at path into dest. The TOML goes through YAML on its way, so dest's yaml tags,
+// strict mode, and Validator apply as they do to YAML frontmatter.
+func decodeTOMLFrontmatter(path, raw string, firstLine int, dest interface{}, opts FrontmatterOptions) error {
+	var meta map[string]interface{}
+	if _, err := toml.Decode(raw, &meta); err != nil {
+		line, msg := firstLine, err.Error()
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			line, msg = parseErr.Position.Line+firstLine-1, parseErr.Message
+		}
+		return &FrontmatterError{Path: path, Line: line, Format: FormatTOML, Err: err, msg: msg}
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+
+	data, err := yaml.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := decodeFrontmatterYAML(data, dest, opts); err != nil {
+		// Lines in the error are lines of the intermediate YAML, so drop them.
+		yamlErr := newYAMLError("", err, 1).(*YAMLError)
+		return &FrontmatterError{Path: path, Line: firstLine, Format: FormatTOML, Err: err, msg: yamlErr.msg}
+	}
+	return validate(path, dest)
+}
+
+// decodeJSONFrontmatter decodes JSON frontmatter starting on line firstLine of the file
+// at path into dest, with encoding/json, so dest's json tags apply.
+func decodeJSONFrontmatter(path, raw string, firstLine int, dest interface{}, knownFields bool) error {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	if knownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(dest); err != nil {
+		offset := int64(0)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			offset = syntaxErr.Offset
+		case errors.As(err, &typeErr):
+			offset = typeErr.Offset
+		}
+		line := firstLine + strings.Count(raw[:min(offset, int64(len(raw)))], "\n")
+		return &FrontmatterError{Path: path, Line: line, Format: FormatJSON, Err: err, msg: strings.TrimPrefix(err.Error(), "json: ")}
+	}
+	return validate(path, dest)
+}
+
+// RenderFrontmatterFormat is RenderFrontmatter with the frontmatter written in the
+// given format, so a document read with ParseFrontmatterFormat can be written back
+// with its fences unchanged. TOML is encoded from metadata's YAML form, so yaml tags
+// apply; it must be a mapping, and nil values are left out, as TOML has no null.
+// JSON is encoded with encoding/json, indented by two spaces, and must be an object.
+// FormatNone returns the body alone, and so, as with RenderFrontmatter, does metadata
+// with nothing in it, in any format. A byte order mark at the start of body is dropped.
+func RenderFrontmatterFormat(format Format, metadata interface{}, body string) (string, error) {
+	body = strings.TrimPrefix(body, utf8BOM)
+	switch format {
+	case FormatNone:
+		return body, nil
+	case FormatYAML:
+		return RenderFrontmatter(metadata, body)
+	case FormatJSON:
+		return renderJSONFrontmatter(metadata, body)
+	case FormatTOML:
+	default:
+		return "", fmt.Errorf("mdstore: unknown frontmatter format %v", format)
+	}
+
+	if err := validate("", metadata); err != nil {
+		return "", err
+	}
+	yamlBytes, err := marshalYAML(metadata, YAMLOptions{})
+	if err != nil {
+		return "", err
+	}
+	var meta map[string]interface{}
+	if err := yaml.Unmarshal(yamlBytes, &meta); err != nil {
+		return "", fmt.Errorf("mdstore: TOML frontmatter must be a mapping: %w", err)
+	}
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(meta); err != nil {
+		return "", fmt.Errorf("mdstore: encoding TOML frontmatter: %w", err)
+	}
+	if buf.Len() == 0 {
+		return body, nil // nothing but nulls, or nothing at all
+	}
+
+	return "+++\n" + buf.String() + "+++\n" + body, nil
+}
+
+// renderJSONFrontmatter is RenderFrontmatterFormat for FormatJSON.
+func renderJSONFrontmatter(metadata interface{}, body string) (string, error) {
+	if err := validate("", metadata); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("mdstore: encoding JSON frontmatter: %w", err)
+	}
+	switch {
+	case string(data) == "null" || string(data) == "{}":
+		return body, nil
+	case data[0] != '{':
+		return "", fmt.Errorf("mdstore: JSON frontmatter must be an object, got %s", data)
+	}
+	return string(data) + "\n" + body, nil
+}
@@ -0,0 +1,243 @@
+// ABOUTME: Tests for frontmatter formats: detection, TOML and JSON decoding and their errors, and rendering in a format.
+// ABOUTME: Round-trips TOML and JSON posts through the same postMeta struct the YAML tests use, plus JSON fixtures.
+package mdstore
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const tomlPost = "+++\n" +
+	"title = \"Hello\"\n" +
+	"published = 2026-02-05T10:04:05Z\n" +
+	"tags = [\"go\", \"toml\"]\n" +
+	"\n" +
+	"[author]\n" +
+	"name = \"Ada\"\n" +
+	"+++\n" +
+	"# Hello\n"
+
+func TestParseFrontmatterFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name, content string
+		format        Format
+		raw, body     string
+	}{
+		{"yaml", "---\ntitle: A\n---\nbody\n", FormatYAML, "title: A", "body"},
+		{"toml", "+++\ntitle = \"A\"\n+++\nbody\n", FormatTOML, "title = \"A\"", "body"},
+		{"toml crlf", "+++\r\ntitle = \"A\"\r\n+++  \r\nbody\r\n", FormatTOML, "title = \"A\"", "body"},
+		{"empty toml", "+++\n+++\nbody", FormatTOML, "", "body"},
+		{"none", "# Just markdown\n", FormatNone, "", "# Just markdown\n"},
+		{"toml closed by dots", "+++\ntitle = \"A\"\n...\nbody\n", FormatNone, "", "+++\ntitle = \"A\"\n...\nbody\n"},
+		{"mismatched", "+++\ntitle = \"A\"\n---\nbody\n", FormatNone, "", "+++\ntitle = \"A\"\n---\nbody\n"},
+		{"json", "{\"title\": \"A\"}\nbody\n", FormatJSON, `{"title": "A"}`, "body"},
+		{"json crlf", "\r\n{\r\n  \"title\": \"A\"\r\n}  \r\nbody\r\n", FormatJSON, "{\n  \"title\": \"A\"\n}", "body"},
+		{"empty json", "{}\nbody", FormatJSON, "{}", "body"},
+		{"unclosed json", "{\"title\": \"A\"\nbody\n", FormatNone, "", "{\"title\": \"A\"\nbody\n"},
+		{"json then text", "{\"title\": \"A\"} body\n", FormatNone, "", "{\"title\": \"A\"} body\n"},
+		{"template tag", "{{ .Title }}\nbody\n", FormatNone, "", "{{ .Title }}\nbody\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			format, raw, body := ParseFrontmatterFormat(tc.content)
+			if format != tc.format || raw != tc.raw || body != tc.body {
+				t.Errorf("got %v, %q, %q; want %v, %q, %q", format, raw, body, tc.format, tc.raw, tc.body)
+			}
+		})
+	}
+
+	// ParseFrontmatter itself stays YAML-only.
+	if yamlStr, body := ParseFrontmatter(tomlPost); yamlStr != "" || body != tomlPost {
+		t.Errorf("ParseFrontmatter on TOML: %q, %q", yamlStr, body)
+	}
+}
+
+func TestParseFrontmatterAs_TOML(t *testing.T) {
+	meta, body, err := ParseFrontmatterAs[postMeta](tomlPost)
+	if err != nil {
+		t.Fatalf("ParseFrontmatterAs failed: %v", err)
+	}
+	want := postMeta{
+		Title:     "Hello",
+		Published: time.Date(2026, 2, 5, 10, 4, 5, 0, time.UTC),
+		Author:    postAuthor{Name: "Ada"},
+		Tags:      []string{"go", "toml"},
+	}
+	if !reflect.DeepEqual(meta, want) || body != "# Hello" {
+		t.Errorf("got %+v, %q", meta, body)
+	}
+
+	_, _, err = ParseFrontmatterAsStrictFields[postMeta]("+++\ntitle = \"A\"\ntittle = \"B\"\n+++\n")
+	var fmErr *FrontmatterError
+	if !errors.As(err, &fmErr) || fmErr.Line != 2 || fmErr.Format != FormatTOML || !strings.Contains(err.Error(), "tittle") {
+		t.Errorf("unknown key in strict mode: %v", err)
+	}
+
+	var cfg checkedConfig
+	_, err = DecodeFrontmatter("post.md", "+++\nname = \"\"\nlevel = \"low\"\n+++\n", &cfg)
+	asValidationError(t, err, "post.md")
+}
+
+func TestParseFrontmatterAs_JSONFixtures(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		want    postMeta
+		body    string
+	}{
+		{
+			fixture: "json-nested.md",
+			want: postMeta{
+				Title:  "Nested",
+				Author: postAuthor{Name: "Ada", Email: "ada@example.com"},
+				Extra:  map[string]string{"layout": "post", "series": "intro"},
+				Tags:   []string{"go", "json"},
+			},
+			body: "# Nested\n\nBody text.",
+		},
+		{
+			fixture: "json-braces-in-strings.md",
+			want: postMeta{
+				Title: `Braces } and { inside "strings" \`,
+				Extra: map[string]string{"template": "{{ .Title }}", "path": `C:\{dir}\`},
+			},
+			body: "\nA body with a } brace.",
+		},
+		{
+			fixture: "json-body-brace.md",
+			want:    postMeta{Title: "Body Brace"},
+			body:    `{"this": "is body, not frontmatter"}`,
+		},
+	} {
+		t.Run(tc.fixture, func(t *testing.T) {
+			_, content := copyFixture(t, tc.fixture)
+			if format, _, _ := ParseFrontmatterFormat(content); format != FormatJSON {
+				t.Fatalf("format = %v, want json", format)
+			}
+			meta, body, err := ParseFrontmatterAs[postMeta](content)
+			if err != nil {
+				t.Fatalf("ParseFrontmatterAs failed: %v", err)
+			}
+			if !reflect.DeepEqual(meta, tc.want) || body != tc.body {
+				t.Errorf("got %+v, %q; want %+v, %q", meta, body, tc.want, tc.body)
+			}
+		})
+	}
+}
+
+func TestDecodeFrontmatter_JSONErrors(t *testing.T) {
+	var meta postMeta
+	_, err := DecodeFrontmatter("post.md", "\n{\n  \"title\": \"A\",\n  \"tags\": 3\n}\n", &meta)
+	var fmErr *FrontmatterError
+	if !errors.As(err, &fmErr) || fmErr.Line != 4 || fmErr.Format != FormatJSON {
+		t.Fatalf("expected a *FrontmatterError on line 4, got %T: %v", err, err)
+	}
+	if !strings.HasPrefix(err.Error(), "mdstore: post.md:4: json frontmatter: cannot unmarshal number") {
+		t.Errorf("unexpected message: %v", err)
+	}
+
+	_, _, err = ParseFrontmatterAsStrictFields[postMeta]("{\"title\": \"A\", \"tittle\": \"B\"}\n")
+	if !errors.As(err, &fmErr) || !strings.Contains(err.Error(), "tittle") {
+		t.Errorf("unknown key in strict mode: %v", err)
+	}
+	_, err = DecodeFrontmatter("post.md", "{\"title\": \"A\",}\n", &meta)
+	if !errors.As(err, &fmErr) || fmErr.Line != 1 {
+		t.Errorf("syntax error: %v", err)
+	}
+	if _, err := UpdateFrontmatter("{\"title\": \"A\"}\n", func(*yaml.Node) error { return nil }); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("UpdateFrontmatter should refuse JSON frontmatter: %v", err)
+	}
+}
+
+func TestDecodeFrontmatter_TOMLErrors(t *testing.T) {
+	var meta postMeta
+	for _, tc := range []struct {
+		name, content string
+		line          int
+		message       string
+	}{
+		{"syntax", "\n+++\ntitle = \"A\"\ntags = [\n+++\n", 4, "post.md:4: toml frontmatter: "},
+		{"type", "+++\ntitle = \"A\"\ntags = 3\n+++\n", 2, "post.md:2: toml frontmatter: cannot unmarshal !!int `3` into []string"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeFrontmatter("post.md", tc.content, &meta)
+			var fmErr *FrontmatterError
+			if !errors.As(err, &fmErr) || fmErr.Path != "post.md" || fmErr.Line != tc.line {
+				t.Fatalf("expected a *FrontmatterError on line %d, got %T: %v", tc.line, err, err)
+			}
+			if !strings.HasPrefix(strings.TrimPrefix(err.Error(), "mdstore: "), tc.message) {
+				t.Errorf("unexpected message: %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeFrontmatter_MismatchedFences(t *testing.T) {
+	content := "+++\ntitle = \"A\"\n---\n# Body\n"
+	var meta postMeta
+	body, err := DecodeFrontmatter("post.md", content, &meta)
+	var fenceErr *FenceError
+	if !errors.As(err, &fenceErr) || !errors.Is(err, ErrMismatchedFences) {
+		t.Fatalf("expected a *FenceError, got %T: %v", err, err)
+	}
+	if fenceErr.Path != "post.md" || fenceErr.Line != 3 || fenceErr.Open != "+++" || fenceErr.Close != "---" || body != content {
+		t.Errorf("got %+v, body %q", fenceErr, body)
+	}
+	if got := err.Error(); got != `mdstore: post.md:3: frontmatter opened with "+++" is closed with "---"` {
+		t.Errorf("unexpected message: %s", got)
+	}
+
+	// A YAML block holding a "+++" line is fine.
+	if _, err := DecodeFrontmatter("post.md", "---\nnote: |\n  +++\n---\n", &meta); err != nil {
+		t.Errorf("YAML with a +++ line: %v", err)
+	}
+	if _, err := UpdateFrontmatter(content, func(*yaml.Node) error { return nil }); !errors.Is(err, ErrMismatchedFences) {
+		t.Errorf("UpdateFrontmatter: expected ErrMismatchedFences, got %v", err)
+	}
+}
+
+func TestRenderFrontmatterFormat_RoundTrip(t *testing.T) {
+	jsonPost := "{\n  \"title\": \"Hello\",\n  \"published\": \"2026-02-05T10:04:05Z\",\n  \"author\": {\"name\": \"Ada\"}\n}\n# Hello\n"
+	for _, content := range []string{tomlPost, jsonPost, "---\ntitle: Hello\n---\n# Hello\n"} {
+		format, _, body := ParseFrontmatterFormat(content)
+		meta, _, err := ParseFrontmatterAs[postMeta](content)
+		if err != nil {
+			t.Fatalf("ParseFrontmatterAs failed: %v", err)
+		}
+		out, err := RenderFrontmatterFormat(format, meta, body+"\n")
+		if err != nil {
+			t.Fatalf("RenderFrontmatterFormat failed: %v", err)
+		}
+		if got, _, _ := ParseFrontmatterFormat(out); got != format {
+			t.Errorf("rendered %v frontmatter as %v:\n%s", format, got, out)
+		}
+		again, _, err := ParseFrontmatterAs[postMeta](out)
+		if err != nil || !reflect.DeepEqual(again, meta) {
+			t.Errorf("round trip: %+v, %v; want %+v", again, err, meta)
+		}
+	}
+
+	out, err := RenderFrontmatterFormat(FormatTOML, map[string]interface{}{"title": "A", "draft": nil}, "body\n")
+	if err != nil || out != "+++\ntitle = \"A\"\n+++\nbody\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := RenderFrontmatterFormat(FormatTOML, []string{"a"}, ""); err == nil {
+		t.Error("expected an error for a TOML list")
+	}
+	out, err = RenderFrontmatterFormat(FormatJSON, map[string]interface{}{"title": "A"}, "body\n")
+	if err != nil || out != "{\n  \"title\": \"A\"\n}\nbody\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := RenderFrontmatterFormat(FormatJSON, []string{"a"}, ""); err == nil {
+		t.Error("expected an error for a JSON list")
+	}
+	if out, err := RenderFrontmatterFormat(FormatNone, postMeta{}, "body"); out != "body" || err != nil {
+		t.Errorf("FormatNone: %q, %v", out, err)
+	}
+	if _, err := UpdateFrontmatter(tomlPost, func(*yaml.Node) error { return nil }); err == nil {
+		t.Error("UpdateFrontmatter should refuse TOML frontmatter")
+	}
+}
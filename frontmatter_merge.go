@@ -0,0 +1,160 @@
+// ABOUTME: Deep merging of partial metadata into markdown frontmatter, for batch edits such as adding a tag everywhere.
+// ABOUTME: Provides MergeFrontmatter, MergeFrontmatterFile, and MergeFrontmatterGlob, with Opts variants taking MergeOptions.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MergeFrontmatter deep-merges partial into the frontmatter of content, as DeepMerge
+// merges maps, and returns the new content. The merge is made in place, as
+// UpdateFrontmatter makes changes: keys partial doesn't mention, comments, and the body
+// are kept, and new keys go at the end of their mapping, in sorted order. A document
+// without frontmatter gains a block. Only YAML frontmatter can be merged into.
+func MergeFrontmatter(content string, partial map[string]interface{}) (string, error) {
+	return MergeFrontmatterOpts(content, partial, MergeOptions{})
+}
+
+// MergeFrontmatterOpts is MergeFrontmatter with explicit options, like DeepMergeOpts:
+// for example, AppendLists and UniqueLists together add tags without repeating any.
+func MergeFrontmatterOpts(content string, partial map[string]interface{}, opts MergeOptions) (string, error) {
+	return updateFrontmatter("", content, mergeFrontmatterFunc(partial, opts))
+}
+
+// MergeFrontmatterFile runs MergeFrontmatter on the markdown file at path, as
+// UpdateFrontmatterFile does: under WithLock on its directory, writing the result
+// atomically if it changed.
+func MergeFrontmatterFile(path string, partial map[string]interface{}) error {
+	return MergeFrontmatterFileOpts(path, partial, MergeOptions{})
+}
+
+// MergeFrontmatterFileOpts is MergeFrontmatterFile with explicit options.
+func MergeFrontmatterFileOpts(path string, partial map[string]interface{}, opts MergeOptions) error {
+	return UpdateFrontmatterFile(path, mergeFrontmatterFunc(partial, opts))
+}
+
+// MergeFrontmatterGlob runs MergeFrontmatter on every markdown file under root whose
+// name matches glob ("*.md" if empty), walking the tree as TransformYAMLDir does:
+// under root's lock, skipping hidden files, and recording a failure on one file in the
+// report rather than stopping. Files the merge doesn't change aren't rewritten.
+func MergeFrontmatterGlob(root, glob string, partial map[string]interface{}) (TransformReport, error) {
+	return MergeFrontmatterGlobOpts(root, glob, partial, MergeOptions{})
+}
+
+// MergeFrontmatterGlobOpts is MergeFrontmatterGlob with explicit options.
+func MergeFrontmatterGlobOpts(root, glob string, partial map[string]interface{}, opts MergeOptions) (TransformReport, error) {
+	var report TransformReport
+	if glob == "" {
+		glob = "*.md"
+	}
+	merge := mergeFrontmatterFunc(partial, opts)
+	err := walkGlobLocked(root, glob, func(path string, _ fs.DirEntry) {
+		report.Matched++
+		changed, err := mergeFrontmatterGlobFile(path, merge)
+		switch {
+		case err != nil:
+			report.Failed = append(report.Failed, TransformError{Path: path, Err: err})
+		case changed:
+			report.Changed = append(report.Changed, path)
+		}
+	})
+	return report, err
+}
+
+// mergeFrontmatterGlobFile applies merge to the frontmatter of the file at path,
+// rewriting it if it changed. The caller holds the root lock.
+func mergeFrontmatterGlobFile(path string, merge func(doc *yaml.Node) error) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	content, err := updateFrontmatter(path, string(data), merge)
+	if err != nil || content == string(data) {
+		return false, err
+	}
+	return true, AtomicWrite(path, []byte(content))
+}
+
+// mergeFrontmatterFunc returns the UpdateFrontmatter function that merges partial.
+func mergeFrontmatterFunc(partial map[string]interface{}, opts MergeOptions) func(doc *yaml.Node) error {
+	return func(doc *yaml.Node) error {
+		return mergeYAMLNode(yamlContentNode(doc), partial, opts)
+	}
+}
+
+// mergeYAMLNode merges partial into the mapping node, as DeepMergeOpts would merge it
+// into the node's decoded value, keeping the comments of the nodes it replaces.
+func mergeYAMLNode(node *yaml.Node, partial map[string]interface{}, opts MergeOptions) error {
+	node = resolveYAMLAlias(node)
+	if isNullNode(node) {
+		node.Kind, node.Tag, node.Style, node.Value = yaml.MappingNode, "!!map", 0, ""
+	}
+	if node.Kind != yaml.MappingNode {
+		return errors.New("mdstore: can't merge into frontmatter that isn't a mapping")
+	}
+
+	keys := make([]string, 0, len(partial))
+	for key := range partial {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		sv := partial[key]
+		if sv == nil && opts.NilDeletes {
+			deleteYAMLNodeKeys(node, []string{key})
+			continue
+		}
+		var v yaml.Node
+		if err := v.Encode(sv); err != nil {
+			return fmt.Errorf("mdstore: merging %q: %w", key, err)
+		}
+		child := yamlMappingValue(node, key)
+		if child == nil {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, &v)
+			continue
+		}
+
+		target := resolveYAMLAlias(child)
+		sm, sIsMap := sv.(map[string]interface{})
+		switch {
+		case sIsMap && target.Kind == yaml.MappingNode:
+			if err := mergeYAMLNode(target, sm, opts); err != nil {
+				return err
+			}
+		case opts.AppendLists && isList(sv) && target.Kind == yaml.SequenceNode && v.Kind == yaml.SequenceNode:
+			for _, item := range v.Content {
+				if !opts.UniqueLists || !yamlSequenceHas(target, item) {
+					target.Content = append(target.Content, item)
+				}
+			}
+		default:
+			if target.Kind == v.Kind && target.Style&yaml.FlowStyle != 0 {
+				v.Style |= yaml.FlowStyle // a list written [a, b] stays that way
+			}
+			replaceYAMLNode(child, &v)
+		}
+	}
+	return nil
+}
+
+// yamlSequenceHas reports whether seq has an item that decodes to the same value as item.
+func yamlSequenceHas(seq, item *yaml.Node) bool {
+	var want interface{}
+	if item.Decode(&want) != nil {
+		return false
+	}
+	for _, existing := range seq.Content {
+		var got interface{}
+		if existing.Decode(&got) == nil && reflect.DeepEqual(got, want) {
+			return true
+		}
+	}
+	return false
+}
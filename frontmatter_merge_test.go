@@ -0,0 +1,200 @@
+// ABOUTME: Tests for MergeFrontmatter: deep merges that keep comments and the body, list modes, and new blocks.
+// ABOUTME: Also covers the locked file variant and adding a tag across a tree with MergeFrontmatterGlob.
+package mdstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeFrontmatter(t *testing.T) {
+	const post = "---\n" +
+		"title: Hello # the title\n" +
+		"tags: [go, yaml]\n" +
+		"author:\n" +
+		"  name: Ada\n" +
+		"  email: ada@example.com\n" +
+		"---\n" +
+		"# Hello\r\n\r\nBody, untouched.   \n"
+
+	for _, tc := range []struct {
+		name    string
+		content string
+		partial ymap
+		opts    MergeOptions
+		want    string
+	}{
+		{
+			name:    "scalar replaced, comment kept",
+			content: post,
+			partial: ymap{"title": "Goodbye"},
+			want:    strings.Replace(post, "title: Hello # the title", "title: Goodbye # the title", 1),
+		},
+		{
+			name:    "nested merge",
+			content: post,
+			partial: ymap{"author": ymap{"name": "Grace", "url": "https://example.com"}},
+			want:    strings.Replace(post, "  name: Ada\n  email: ada@example.com\n", "  name: Grace\n  email: ada@example.com\n  url: https://example.com\n", 1),
+		},
+		{
+			name:    "new keys sorted at the end",
+			content: post,
+			partial: ymap{"draft": true, "weight": 2},
+			want:    strings.Replace(post, "---\n# Hello", "draft: true\nweight: 2\n---\n# Hello", 1),
+		},
+		{
+			name:    "list replaced by default",
+			content: post,
+			partial: ymap{"tags": []string{"rust"}},
+			want:    strings.Replace(post, "tags: [go, yaml]", "tags: [rust]", 1),
+		},
+		{
+			name:    "list appended",
+			content: post,
+			partial: ymap{"tags": []string{"go", "toml"}},
+			opts:    MergeOptions{AppendLists: true},
+			want:    strings.Replace(post, "tags: [go, yaml]", "tags: [go, yaml, go, toml]", 1),
+		},
+		{
+			name:    "list appended uniquely",
+			content: post,
+			partial: ymap{"tags": []string{"go", "toml", "toml"}},
+			opts:    MergeOptions{AppendLists: true, UniqueLists: true},
+			want:    strings.Replace(post, "tags: [go, yaml]", "tags: [go, yaml, toml]", 1),
+		},
+		{
+			name:    "nothing new",
+			content: post,
+			partial: ymap{"tags": []string{"yaml"}, "author": ymap{"name": "Ada"}},
+			opts:    MergeOptions{AppendLists: true, UniqueLists: true},
+			want:    post,
+		},
+		{
+			name:    "nil deletes",
+			content: post,
+			partial: ymap{"author": ymap{"email": nil}, "missing": nil},
+			opts:    MergeOptions{NilDeletes: true},
+			want:    strings.Replace(post, "  email: ada@example.com\n", "", 1),
+		},
+		{
+			name:    "map replaces scalar",
+			content: "---\nauthor: Ada\n---\nbody\n",
+			partial: ymap{"author": ymap{"name": "Ada"}},
+			want:    "---\nauthor:\n    name: Ada\n---\nbody\n",
+		},
+		{
+			name:    "no frontmatter",
+			content: "# Hello\n",
+			partial: ymap{"tags": []string{"go"}},
+			opts:    MergeOptions{AppendLists: true, UniqueLists: true},
+			want:    "---\ntags:\n    - go\n---\n# Hello\n",
+		},
+		{
+			name:    "empty block",
+			content: "---\n---\n# Hello\n",
+			partial: ymap{"title": "Hello"},
+			want:    "---\ntitle: Hello\n---\n# Hello\n",
+		},
+		{
+			name:    "crlf",
+			content: "---\r\ntitle: Hello\r\n---\r\nbody\r\n",
+			partial: ymap{"draft": false},
+			want:    "---\r\ntitle: Hello\r\ndraft: false\r\n---\r\nbody\r\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := MergeFrontmatterOpts(tc.content, tc.partial, tc.opts)
+			if err != nil {
+				t.Fatalf("MergeFrontmatterOpts failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, tc.want)
+			}
+		})
+	}
+
+	// The result is what DeepMergeOpts makes of the decoded metadata.
+	partial := ymap{"tags": []interface{}{"toml"}, "author": ymap{"name": "Grace"}}
+	opts := MergeOptions{AppendLists: true}
+	out, err := MergeFrontmatterOpts(post, partial, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _, _ := ParseFrontmatterAs[ymap](post)
+	after, _, _ := ParseFrontmatterAs[ymap](out)
+	if want := DeepMergeOpts(before, partial, opts); !reflect.DeepEqual(after, want) {
+		t.Errorf("got %v, want %v", after, want)
+	}
+
+	if _, err := MergeFrontmatter("---\ntitle: [broken\n---\n", ymap{"a": 1}); err == nil {
+		t.Error("expected an error for malformed frontmatter")
+	}
+	if _, err := MergeFrontmatter(tomlPost, ymap{"a": 1}); err == nil {
+		t.Error("expected an error for TOML frontmatter")
+	}
+}
+
+func TestMergeFrontmatterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.md")
+	writeFileString(t, path, "---\ntags: [go]\n---\nbody\n")
+	if err := MergeFrontmatterFileOpts(path, ymap{"tags": []string{"go", "news"}}, MergeOptions{AppendLists: true, UniqueLists: true}); err != nil {
+		t.Fatalf("MergeFrontmatterFileOpts failed: %v", err)
+	}
+	if got := readFileString(t, path); got != "---\ntags: [go, news]\n---\nbody\n" {
+		t.Errorf("got %q", got)
+	}
+
+	missing := filepath.Join(t.TempDir(), "new.md")
+	if err := MergeFrontmatterFile(missing, ymap{"title": "New"}); err != nil {
+		t.Fatalf("MergeFrontmatterFile on a missing file: %v", err)
+	}
+	if got := readFileString(t, missing); got != "---\ntitle: New\n---\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMergeFrontmatterGlob(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"a.md":          "---\ntitle: A\ntags: [go]\n---\nA\n",
+		"sub/b.md":      "---\ntitle: B # keep\n---\nB\n",
+		"sub/tagged.md": "---\ntags: [news]\n---\n",
+		"bad.md":        "---\ntitle: [broken\n---\n",
+		"notes.txt":     "---\ntitle: not markdown\n---\n",
+		".hidden/c.md":  "---\ntitle: C\n---\n",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := EnsureDir(filepath.Dir(path)); err != nil {
+			t.Fatal(err)
+		}
+		writeFileString(t, path, content)
+	}
+
+	report, err := MergeFrontmatterGlobOpts(root, "", ymap{"tags": []string{"news"}}, MergeOptions{AppendLists: true, UniqueLists: true})
+	if err != nil {
+		t.Fatalf("MergeFrontmatterGlobOpts failed: %v", err)
+	}
+	if report.Matched != 4 || len(report.Failed) != 1 || filepath.Base(report.Failed[0].Path) != "bad.md" {
+		t.Errorf("got %+v", report)
+	}
+	if want := []string{filepath.Join(root, "a.md"), filepath.Join(root, "sub", "b.md")}; !reflect.DeepEqual(report.Changed, want) {
+		t.Errorf("Changed = %v, want %v", report.Changed, want)
+	}
+	for name, want := range map[string]string{
+		"a.md":          "---\ntitle: A\ntags: [go, news]\n---\nA\n",
+		"sub/b.md":      "---\ntitle: B # keep\ntags:\n    - news\n---\nB\n",
+		"sub/tagged.md": "---\ntags: [news]\n---\n",
+		"notes.txt":     "---\ntitle: not markdown\n---\n",
+		".hidden/c.md":  "---\ntitle: C\n---\n",
+	} {
+		if got := readFileString(t, filepath.Join(root, filepath.FromSlash(name))); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+
+	if _, err := MergeFrontmatterGlob(root, "[", ymap{"a": 1}); err == nil {
+		t.Error("expected an error for a bad pattern")
+	}
+}
@@ -0,0 +1,264 @@
+// ABOUTME: Batch frontmatter migrations across a store: renaming, deleting, and defaulting keys, or custom transforms.
+// ABOUTME: Provides MigrateFrontmatter, Migration, and MigrationReport, an audit record that WriteYAML can keep.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Migration describes the frontmatter changes MigrateFrontmatter makes to each file,
+// in this order: Rename, Delete, Defaults, and then Transform. Keys are dotted paths
+// (see SetYAMLPath).
+type Migration struct {
+	// Glob picks the files migrated, as TransformYAMLDir's pattern does. Default "*.md".
+	Glob string
+
+	// Rename maps keys to their new names, in order of the old keys. A file whose
+	// frontmatter has both a key and its new name fails, rather than losing a value.
+	Rename map[string]string
+
+	// Delete lists keys to remove.
+	Delete []string
+
+	// Defaults maps keys to values set where the key is missing, in order of the keys.
+	Defaults map[string]interface{}
+
+	// Transform, if set, is called last for each file, with its path and its
+	// frontmatter's document node to change in place, as UpdateFrontmatter calls fn.
+	// An error fails the file, leaving it unchanged.
+	Transform func(path string, node *yaml.Node) error
+
+	// InitMissing migrates files without frontmatter too, as if theirs were empty, so
+	// they gain a block if Defaults or Transform add fields. By default they're skipped.
+	InitMissing bool
+
+	// DryRun reports what would change, without writing anything.
+	DryRun bool
+}
+
+// MigrationReport is the outcome of MigrateFrontmatter, meant to be kept with
+// WriteYAML as a record of the migration. Paths are relative to Root, with forward
+// slashes.
+type MigrationReport struct {
+	Root    string            `yaml:"root"`
+	Time    time.Time         `yaml:"time"`
+	DryRun  bool              `yaml:"dry_run,omitempty"`
+	Matched int               `yaml:"matched"`           // files that matched the pattern
+	Changed []MigrationChange `yaml:"changed,omitempty"` // files rewritten (with DryRun, that would have been)
+	Skipped []string          `yaml:"skipped,omitempty"` // files without frontmatter, left alone
+	Failed  []MigrationError  `yaml:"failed,omitempty"`  // files that couldn't be read, migrated, or written
+}
+
+// MigrationChange is a file changed by MigrateFrontmatter, with what was done to it,
+// such as "rename date to published", "delete draft", "default status", or "transform",
+// and the differences that made in its frontmatter, as DiffFrontmatter finds them.
+type MigrationChange struct {
+	Path    string   `yaml:"path"`
+	Changes []string `yaml:"changes"`
+	Diff    []Change `yaml:"diff,omitempty"`
+}
+
+// MigrationError is a failure on one file during MigrateFrontmatter.
+type MigrationError struct {
+	Path    string `yaml:"path"`
+	Message string `yaml:"error"`
+	Err     error  `yaml:"-"`
+}
+
+func (e *MigrationError) Error() string {
+	return fmt.Sprintf("mdstore: migrate %s: %s", e.Path, e.Message)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// Err returns the per-file errors joined into one, or nil if there were none.
+func (r *MigrationReport) Err() error {
+	errs := make([]error, len(r.Failed))
+	for i := range r.Failed {
+		errs[i] = &r.Failed[i]
+	}
+	return errors.Join(errs...)
+}
+
+// MigrateFrontmatter applies m to the YAML frontmatter of every file under root that
+// matches m.Glob, found as TransformYAMLDir finds files, holding root's lock (see
+// WithRootLock) throughout. Each file is edited as UpdateFrontmatterFile edits it: its
+// body, the comments, key order, and untouched lines of its frontmatter, and its line
+// endings are kept, and it's rewritten atomically only if it changed. A failure on one
+// file, such as TOML frontmatter or a Transform error, is recorded in the report and
+// the migration goes on; the error return is for failures of the walk itself.
+func MigrateFrontmatter(root string, m Migration) (MigrationReport, error) {
+	report := MigrationReport{Root: root, Time: now(), DryRun: m.DryRun}
+	glob := m.Glob
+	if glob == "" {
+		glob = "*.md"
+	}
+	err := walkGlobLocked(root, glob, func(path string, _ fs.DirEntry) {
+		report.Matched++
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			rel = path
+		}
+		rel = filepath.ToSlash(rel)
+
+		changes, diff, skipped, err := migrateFrontmatterFile(path, m)
+		switch {
+		case err != nil:
+			report.Failed = append(report.Failed, MigrationError{Path: rel, Message: err.Error(), Err: err})
+		case skipped:
+			report.Skipped = append(report.Skipped, rel)
+		case len(changes) > 0:
+			report.Changed = append(report.Changed, MigrationChange{Path: rel, Changes: changes, Diff: diff})
+		}
+	})
+	return report, err
+}
+
+// migrateFrontmatterFile applies m to the file at path, returning what changed and its
+// differences, or whether it was skipped for having no frontmatter. The caller holds
+// the root lock.
+func migrateFrontmatterFile(path string, m Migration) (changes []string, diff []Change, skipped bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if fm, _ := scanFrontmatter(string(data)); fm.format == FormatNone && !m.InitMissing {
+		return nil, nil, true, nil
+	}
+
+	content, err := updateFrontmatter(path, string(data), func(doc *yaml.Node) error {
+		changes, err = applyMigration(path, doc, m)
+		return err
+	})
+	if err != nil || content == string(data) {
+		return nil, nil, false, err
+	}
+	if diff, err = DiffFrontmatter(string(data), content); err != nil {
+		return nil, nil, false, err
+	}
+	if !m.DryRun {
+		if err := AtomicWrite(path, []byte(content)); err != nil {
+			return nil, nil, false, err
+		}
+	}
+	return changes, diff, false, nil
+}
+
+// applyMigration applies m to doc, the frontmatter of the file at path, returning
+// what it changed.
+func applyMigration(path string, doc *yaml.Node, m Migration) ([]string, error) {
+	var changes []string
+	for _, from := range sortedKeys(m.Rename) {
+		to := m.Rename[from]
+		renamed, err := renameYAMLNodeKeys(doc, splitYAMLPath(from), splitYAMLPath(to))
+		if err != nil {
+			return nil, err
+		}
+		if renamed {
+			changes = append(changes, fmt.Sprintf("rename %s to %s", from, to))
+		}
+	}
+	for _, key := range m.Delete {
+		if deleteYAMLNodeKeys(doc, splitYAMLPath(key)) {
+			changes = append(changes, "delete "+key)
+		}
+	}
+	for _, key := range sortedKeys(m.Defaults) {
+		keys := splitYAMLPath(key)
+		if yamlNodeAt(doc, keys) != nil {
+			continue
+		}
+		if err := setYAMLNodeKeys(doc, keys, m.Defaults[key]); err != nil {
+			return nil, err
+		}
+		changes = append(changes, "default "+key)
+	}
+	if m.Transform != nil {
+		before, err := encodeYAMLNode(doc, 2)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Transform(path, doc); err != nil {
+			return nil, err
+		}
+		after, err := encodeYAMLNode(doc, 2)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(before, after) {
+			changes = append(changes, "transform")
+		}
+	}
+	return changes, nil
+}
+
+// renameYAMLNodeKeys moves the mapping entry at keys from to the path to, reporting
+// whether there was one. A rename within the same mapping keeps the entry's place and
+// comments; otherwise the value is set at to as SetYAMLPath sets it. It fails if to
+// is already set.
+func renameYAMLNodeKeys(root *yaml.Node, from, to []string) (bool, error) {
+	if len(from) == 0 || len(to) == 0 {
+		return false, errors.New("mdstore: empty YAML path")
+	}
+	parent := yamlNodeAt(root, from[:len(from)-1])
+	if parent == nil || parent.Kind != yaml.MappingNode {
+		return false, nil
+	}
+	i := -1
+	for j := 0; j+1 < len(parent.Content); j += 2 {
+		if parent.Content[j].Value == from[len(from)-1] {
+			i = j
+			break
+		}
+	}
+	if i < 0 || slices.Equal(from, to) {
+		return false, nil
+	}
+	if yamlNodeAt(root, to) != nil {
+		return false, fmt.Errorf("mdstore: rename %q to %q: %q is already set", joinYAMLPath(from), joinYAMLPath(to), joinYAMLPath(to))
+	}
+
+	key, value := parent.Content[i], parent.Content[i+1]
+	if len(from) == len(to) && slices.Equal(from[:len(from)-1], to[:len(to)-1]) {
+		key.Value = to[len(to)-1]
+		return true, nil
+	}
+	parent.Content = slices.Delete(parent.Content, i, i+2)
+	if err := setYAMLNodeKeys(root, to, nil); err != nil {
+		return false, err
+	}
+	*yamlNodeAt(root, to) = *value
+	return true, nil
+}
+
+// yamlNodeAt returns the node at keys in the tree root, or nil if there's none.
+func yamlNodeAt(root *yaml.Node, keys []string) *yaml.Node {
+	node := yamlContentNode(root)
+	for _, key := range keys {
+		if node = yamlChild(node, key); node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,185 @@
+// ABOUTME: Tests for MigrateFrontmatter: renames, deletes, defaults, transforms, dry runs, and per-file failures.
+// ABOUTME: Checks that bodies, comments, and line endings survive, and that the report round-trips through WriteYAML.
+package mdstore
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// migrateTree is a small store of markdown files for writeIndexTree.
+var migrateTree = map[string]string{
+	"a.md":          "---\n# kept\ntitle: A\ndate: 2026-01-02 # when\ndraft: true\n---\nBody of a.\n",
+	"posts/b.md":    "---\r\ntitle: B\r\ndate: 2026-03-04\r\n---\r\nBody\r\nof b.\r\n",
+	"posts/c.md":    "---\ntitle: C\npublished: 2026-05-06\nstatus: live\n---\nC.\n",
+	"plain.md":      "# No frontmatter\n",
+	"clash.md":      "---\ndate: 2026-01-01\npublished: 2026-02-02\n---\n",
+	"toml.md":       "+++\ndate = 2026-01-01\n+++\n",
+	".hidden/d.md":  "---\ndate: 2026-01-01\n---\n",
+	"notes/readme":  "---\ndate: 2026-01-01\n---\n",
+	"notes/e.txt":   "---\ndate: 2026-01-01\n---\n",
+	"notes/deep.md": "---\nmeta:\n  date: 2026-01-01\n---\n",
+}
+
+func TestMigrateFrontmatter(t *testing.T) {
+	useClock(t)
+	root := writeIndexTree(t, migrateTree)
+
+	report, err := MigrateFrontmatter(root, Migration{
+		Rename:   map[string]string{"date": "published", "meta.date": "published"},
+		Delete:   []string{"draft"},
+		Defaults: map[string]interface{}{"status": "draft"},
+	})
+	if err != nil {
+		t.Fatalf("MigrateFrontmatter failed: %v", err)
+	}
+
+	if report.Matched != 7 || report.Root != root || !report.Time.Equal(now()) {
+		t.Errorf("report = %+v", report)
+	}
+	want := []MigrationChange{
+		{Path: "a.md", Changes: []string{"rename date to published", "delete draft", "default status"}},
+		{Path: "notes/deep.md", Changes: []string{"rename meta.date to published", "default status"}},
+		{Path: "posts/b.md", Changes: []string{"rename date to published", "default status"}},
+	}
+	published := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	wantDiff := []Change{
+		{Path: "date", Kind: ChangeRemoved, Old: published},
+		{Path: "draft", Kind: ChangeRemoved, Old: true},
+		{Path: "published", Kind: ChangeAdded, New: published},
+		{Path: "status", Kind: ChangeAdded, New: "draft"},
+	}
+	if len(report.Changed) > 0 && !reflect.DeepEqual(report.Changed[0].Diff, wantDiff) {
+		t.Errorf("Diff = %+v, want %+v", report.Changed[0].Diff, wantDiff)
+	}
+	for i := range report.Changed {
+		report.Changed[i].Diff = nil
+	}
+	if !reflect.DeepEqual(report.Changed, want) {
+		t.Errorf("Changed = %+v, want %+v", report.Changed, want)
+	}
+	if !reflect.DeepEqual(report.Skipped, []string{"plain.md"}) {
+		t.Errorf("Skipped = %v", report.Skipped)
+	}
+	var failed []string
+	for _, f := range report.Failed {
+		failed = append(failed, f.Path)
+	}
+	if strings.Join(failed, " ") != "clash.md toml.md" {
+		t.Errorf("Failed = %+v", report.Failed)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), `"published" is already set`) {
+		t.Errorf("Err() = %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"a.md":          "---\n# kept\ntitle: A\npublished: 2026-01-02 # when\nstatus: draft\n---\nBody of a.\n",
+		"posts/b.md":    "---\r\ntitle: B\r\npublished: 2026-03-04\r\nstatus: draft\r\n---\r\nBody\r\nof b.\r\n",
+		"posts/c.md":    "---\ntitle: C\npublished: 2026-05-06\nstatus: live\n---\nC.\n",
+		"notes/deep.md": "---\nmeta: {}\npublished: 2026-01-01\nstatus: draft\n---\n",
+		"plain.md":      "# No frontmatter\n",
+		"clash.md":      "---\ndate: 2026-01-01\npublished: 2026-02-02\n---\n",
+		".hidden/d.md":  "---\ndate: 2026-01-01\n---\n",
+		"notes/readme":  "---\ndate: 2026-01-01\n---\n",
+	} {
+		if got := readFileString(t, filepath.Join(root, filepath.FromSlash(name))); got != content {
+			t.Errorf("%s = %q, want %q", name, got, content)
+		}
+	}
+}
+
+func TestMigrateFrontmatter_DryRun(t *testing.T) {
+	root := writeIndexTree(t, migrateTree)
+	before := readFileString(t, filepath.Join(root, "a.md"))
+
+	report, err := MigrateFrontmatter(root, Migration{Rename: map[string]string{"date": "published"}, DryRun: true})
+	if err != nil {
+		t.Fatalf("MigrateFrontmatter failed: %v", err)
+	}
+	if !report.DryRun || len(report.Changed) != 2 || len(report.Failed) != 2 {
+		t.Errorf("dry run should report the same outcome: %+v", report)
+	}
+	if got := readFileString(t, filepath.Join(root, "a.md")); got != before {
+		t.Errorf("dry run wrote a.md:\n%s", got)
+	}
+}
+
+func TestMigrateFrontmatter_InitMissingAndTransform(t *testing.T) {
+	root := writeIndexTree(t, migrateTree)
+	boom := errors.New("boom")
+
+	report, err := MigrateFrontmatter(root, Migration{
+		Glob:        "*.md",
+		InitMissing: true,
+		Defaults:    map[string]interface{}{"tags": []string{}},
+		Transform: func(path string, doc *yaml.Node) error {
+			if filepath.Base(path) == "c.md" {
+				return boom
+			}
+			if title := yamlNodeAt(doc, []string{"title"}); title != nil {
+				title.Value = strings.ToLower(title.Value)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("MigrateFrontmatter failed: %v", err)
+	}
+	if len(report.Skipped) != 0 {
+		t.Errorf("Skipped = %v, want none with InitMissing", report.Skipped)
+	}
+	if got := readFileString(t, filepath.Join(root, "plain.md")); got != "---\ntags: []\n---\n# No frontmatter\n" {
+		t.Errorf("plain.md = %q", got)
+	}
+	if got := readFileString(t, filepath.Join(root, "a.md")); !strings.Contains(got, "\ntitle: a\n") {
+		t.Errorf("a.md wasn't transformed:\n%s", got)
+	}
+	var found bool
+	for _, f := range report.Failed {
+		if f.Path == "posts/c.md" {
+			found = errors.Is(&f, boom)
+		}
+	}
+	if !found {
+		t.Errorf("Failed = %+v, want posts/c.md failing with boom", report.Failed)
+	}
+	if got := readFileString(t, filepath.Join(root, "posts", "c.md")); strings.Contains(got, "tags") {
+		t.Errorf("a failed transform still wrote c.md:\n%s", got)
+	}
+}
+
+func TestMigrateFrontmatter_ReportAsYAML(t *testing.T) {
+	root := writeIndexTree(t, migrateTree)
+	report, err := MigrateFrontmatter(root, Migration{Rename: map[string]string{"date": "published"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "migration.yaml")
+	if err := WriteYAML(path, report); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+	var back MigrationReport
+	if err := ReadYAML(path, &back); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if !back.Time.Equal(report.Time) {
+		t.Errorf("Time = %v, want %v", back.Time, report.Time)
+	}
+	back.Time, report.Time = time.Time{}, time.Time{}
+	for i := range report.Failed {
+		report.Failed[i].Err = nil // not kept
+	}
+	if !reflect.DeepEqual(back, report) {
+		t.Errorf("round trip = %+v, want %+v", back, report)
+	}
+	if text := readFileString(t, path); !strings.Contains(text, "error: ") {
+		t.Errorf("failures should keep their messages:\n%s", text)
+	}
+}
@@ -0,0 +1,99 @@
+// ABOUTME: Canonical formatting of markdown documents, so a formatter run over a store settles after one pass.
+// ABOUTME: Provides Normalize, which re-renders frontmatter and body in one fixed form and reports whether that changed anything.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Normalize returns content in canonical form, and whether that differs from content.
+// Normalize is idempotent: normalizing its result changes nothing. The canonical form
+// is:
+//
+//   - YAML frontmatter between "---" lines, however it was fenced, re-encoded from its
+//     yaml.Node tree with RenderFrontmatter's 4-space indent, so key order, comments,
+//     and quoting are kept; frontmatter that's empty, or only comments, stays so;
+//   - TOML and JSON frontmatter re-rendered as RenderFrontmatterFormat renders it, so
+//     keys are sorted, and TOML comments are lost;
+//   - the body as it was, less trailing blank lines and spaces, ending with a single
+//     line break unless it's empty;
+//   - no byte order mark, and every line ending with \n, or with \r\n if content's
+//     first line does.
+//
+// Content without frontmatter is normalized as a body alone. Malformed YAML is a
+// *YAMLError whose line counts from the top of content, and errors are otherwise those
+// of DecodeFrontmatter; so is frontmatter holding more than one YAML document, which
+// re-encoding would cut short. On error, content is returned unchanged.
+func Normalize(content string) (string, bool, error) {
+	fm, raw, body, err := extractFrontmatter(content)
+	if err != nil {
+		return content, false, err
+	}
+	if body = strings.TrimRightFunc(body, unicode.IsSpace); body != "" {
+		body += "\n"
+	}
+
+	var out string
+	switch fm.format {
+	case FormatNone:
+		out = body
+	case FormatYAML:
+		yamlBytes, err := normalizeYAMLFrontmatter(raw, fm.line)
+		if err != nil {
+			return content, false, err
+		}
+		out = "---\n" + string(yamlBytes) + "---\n" + body
+	default:
+		var meta map[string]interface{}
+		if err := decodeFrontmatterBlock("", fm, raw, &meta, FrontmatterOptions{}); err != nil {
+			return content, false, err
+		}
+		if out, err = RenderFrontmatterFormat(fm.format, meta, body); err != nil {
+			return content, false, err
+		}
+	}
+
+	if i := strings.IndexAny(content, "\r\n"); i >= 0 && strings.HasPrefix(content[i:], "\r\n") {
+		out = toCRLF(out)
+	}
+	return out, out != content, nil
+}
+
+// normalizeYAMLFrontmatter re-encodes raw, YAML frontmatter starting on the given line
+// of its document, as Normalize describes.
+func normalizeYAMLFrontmatter(raw string, line int) ([]byte, error) {
+	if err := checkYAMLAliases("", []byte(raw), line); err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(strings.NewReader(raw))
+	var doc yaml.Node
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			// Nothing but comments, or nothing at all: the comments are kept as they are.
+			if raw = strings.TrimRightFunc(raw, unicode.IsSpace); raw != "" {
+				raw += "\n"
+			}
+			return []byte(raw), nil
+		}
+		return nil, newYAMLError("", err, line)
+	}
+	var next yaml.Node
+	if err := dec.Decode(&next); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return nil, newYAMLError("", err, line)
+		}
+		return nil, newYAMLError("", fmt.Errorf("yaml: line %d: frontmatter holds more than one YAML document", next.Line), line)
+	}
+	out, err := encodeYAMLNode(&doc, 4)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(out, []byte("---\n")), nil
+}
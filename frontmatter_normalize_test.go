@@ -0,0 +1,199 @@
+// ABOUTME: Tests for Normalize: canonical output for each kind of document, and idempotence over a corpus.
+// ABOUTME: The corpus is every markdown fixture in testdata plus inline documents of awkward shapes.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{
+			name:    "canonical already",
+			content: "---\ntitle: Post\n---\nBody\n",
+			want:    "---\ntitle: Post\n---\nBody\n",
+		},
+		{
+			name:    "indentation and spacing",
+			content: "---\ntitle:   Post\nauthor:\n  name: Ada\ntags:\n- a\n-   b\n---\nBody\n",
+			want:    "---\ntitle: Post\nauthor:\n    name: Ada\ntags:\n    - a\n    - b\n---\nBody\n",
+		},
+		{
+			name:    "key order and comments kept",
+			content: "---\n# About the post\nzeta: 1 # last letter\nalpha: 2\n---\nBody\n",
+			want:    "---\n# About the post\nzeta: 1 # last letter\nalpha: 2\n---\nBody\n",
+		},
+		{
+			name:    "trailing blank lines",
+			content: "---\ntitle: Post\n---\nBody  \n\n\n",
+			want:    "---\ntitle: Post\n---\nBody\n",
+		},
+		{
+			name:    "no trailing newline",
+			content: "---\ntitle: Post\n---\nBody",
+			want:    "---\ntitle: Post\n---\nBody\n",
+		},
+		{
+			name:    "empty body",
+			content: "---\ntitle: Post\n---\n\n\n",
+			want:    "---\ntitle: Post\n---\n",
+		},
+		{
+			name:    "other fences",
+			content: "\n----\ntitle: Post\n----\nBody\n",
+			want:    "---\ntitle: Post\n---\nBody\n",
+		},
+		{
+			name:    "document end marker",
+			content: "---\ntitle: Post\n...\nBody\n",
+			want:    "---\ntitle: Post\n---\nBody\n",
+		},
+		{
+			name:    "empty frontmatter",
+			content: "---\n---\nBody\n",
+			want:    "---\n---\nBody\n",
+		},
+		{
+			name:    "only comments",
+			content: "---\n# draft  \n---\nBody\n",
+			want:    "---\n# draft\n---\nBody\n",
+		},
+		{
+			name:    "no frontmatter",
+			content: "# Title\n\nBody text.\n\n",
+			want:    "# Title\n\nBody text.\n",
+		},
+		{
+			name:    "no frontmatter, opening rule",
+			content: "---\n\nNot metadata.\n\n---\nMore",
+			want:    "---\n\nNot metadata.\n\n---\nMore\n",
+		},
+		{
+			name:    "empty document",
+			content: "\n\n",
+			want:    "",
+		},
+		{
+			name:    "byte order mark",
+			content: "\ufeff---\ntitle: Post\n---\nBody\n",
+			want:    "---\ntitle: Post\n---\nBody\n",
+		},
+		{
+			name:    "crlf",
+			content: "---\r\ntitle:  Post\r\ntags:\r\n  - a\r\n---\r\nBody\r\nmore\r\n\r\n",
+			want:    "---\r\ntitle: Post\r\ntags:\r\n    - a\r\n---\r\nBody\r\nmore\r\n",
+		},
+		{
+			name:    "crlf without frontmatter",
+			content: "# Title\r\n\r\nBody\n",
+			want:    "# Title\r\n\r\nBody\r\n",
+		},
+		{
+			name:    "mixed line endings",
+			content: "---\ntitle: Post\r\n---\rBody\r\n",
+			want:    "---\ntitle: Post\n---\nBody\n",
+		},
+		{
+			name:    "toml",
+			content: "+++\ntitle = \"Post\"\ndraft = true\n+++\nBody\n",
+			want:    "+++\ndraft = true\ntitle = \"Post\"\n+++\nBody\n",
+		},
+		{
+			name:    "json",
+			content: "{\"title\": \"Post\", \"draft\": true}\nBody\n",
+			want:    "{\n  \"draft\": true,\n  \"title\": \"Post\"\n}\nBody\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, changed, err := Normalize(tc.content)
+			if err != nil {
+				t.Fatalf("Normalize failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+			if changed != (tc.content != tc.want) {
+				t.Errorf("changed = %v", changed)
+			}
+		})
+	}
+}
+
+func TestNormalize_Errors(t *testing.T) {
+	_, content := copyFixture(t, "broken-frontmatter.md")
+	got, changed, err := Normalize(content)
+	var yamlErr *YAMLError
+	if !errors.As(err, &yamlErr) || yamlErr.Line != 5 {
+		t.Errorf("broken frontmatter: got %v, want a *YAMLError on line 5", err)
+	}
+	if got != content || changed {
+		t.Errorf("content should be returned unchanged, got %q, %v", got, changed)
+	}
+
+	content = "----\ntitle: Post\n---\nmore: yes\n----\nBody\n"
+	if _, _, err := Normalize(content); !errors.As(err, &yamlErr) || yamlErr.Line != 3 {
+		t.Errorf("two documents: got %v, want a *YAMLError on line 3", err)
+	}
+
+	var fenceErr *FenceError
+	if _, _, err := Normalize("+++\ntitle = \"Post\"\n---\nBody\n"); !errors.As(err, &fenceErr) {
+		t.Errorf("mismatched fences: got %v, want a *FenceError", err)
+	}
+}
+
+// Normalizing a normalized document changes nothing, whatever the document.
+func TestNormalize_Idempotent(t *testing.T) {
+	corpus := map[string]string{
+		"nested comments":   "---\n# head\n\nserver:\n  # the port\n  port: 8080 # http\n\n  workers: 4\n# foot\n---\nBody\n",
+		"flow and quotes":   "---\ntags: [a, 'b c', \"d\"]\nmeta: {x: 1, y: [2, 3]}\nnote: 'it''s'\n---\nBody\n",
+		"block scalars":     "---\nsummary: |\n  Intro\n  ---\n  More\nfolded: >-\n  one\n  two\n---\n# Body\n",
+		"anchors":           "---\nbase: &base\n  a: 1\nderived:\n  <<: *base\n  b: 2\n---\nBody\n",
+		"times and numbers": "---\ndate: 2026-01-02\npublished: 2026-02-05T10:04:05Z\nweight: 1.50\nid: 007\n---\n",
+		"long string":       "---\ndescription: " + strings.Repeat("a long description ", 20) + "end\n---\nBody\n",
+		"unicode":           "---\ntitle: Café — 日本語\n---\n\n본문입니다.\n",
+		"crlf comments":     "---\r\n# note\r\na:   1\r\n---\r\nBody\r\n",
+		"null":              "---\nnull\n---\nBody",
+		"list frontmatter":  "---\n- a\n- b\n---\nBody",
+		"leading blanks":    "\n\n---\ntitle: Post\n---\n\n\nBody\n\n",
+		"toml nested":       "+++\ntitle = \"Post\"\ndate = 2026-01-02T03:04:05Z\n[author]\nname = \"Ada\"\ntags = [\"a\", \"b\"]\n+++\nBody\n",
+		"json numbers":      "{\"weight\": 1.50, \"big\": 12345678901234567890, \"list\": [1, 2.5]}\nBody\n",
+		"body only":         "Just text",
+		"blank":             "",
+	}
+	matches, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus[path] = string(data)
+	}
+
+	for name, content := range corpus {
+		t.Run(name, func(t *testing.T) {
+			once, _, err := Normalize(content)
+			if err != nil {
+				if name == filepath.Join("testdata", "broken-frontmatter.md") {
+					return
+				}
+				t.Fatalf("Normalize failed: %v", err)
+			}
+			twice, changed, err := Normalize(once)
+			if err != nil {
+				t.Fatalf("second Normalize failed: %v", err)
+			}
+			if changed || twice != once {
+				t.Errorf("not idempotent:\nonce:  %q\ntwice: %q", once, twice)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+// ABOUTME: Frontmatter-only reads of markdown files and streams, for indexing or storing documents without buffering their bodies.
+// ABOUTME: Provides ReadFrontmatter and ParseFrontmatterReader, which read line by line only as far as the end of the frontmatter.
+package mdstore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// ReadFrontmatter reads the frontmatter of the markdown file at path and decodes it
+// into a T, without reading the body: the file is read line by line only as far as
+// the end of the frontmatter, so indexing many large documents costs what their
+// frontmatter does rather than what the files do. found reports whether the file has
+// frontmatter; without it, meta is the zero T and err is nil.
+//
+// Frontmatter is detected and decoded as DecodeFrontmatter does, in any format and with
+// the same errors, including a *FileTooLargeError for frontmatter over the size limit
+// (see SetMaxYAMLSize); no more than that is held in memory. An opening fence that is
+// never closed is scanned to the end of the file to tell that it isn't frontmatter.
+// On error, meta is the zero T.
+func ReadFrontmatter[T any](path string) (meta T, found bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return meta, false, err
+	}
+	defer f.Close()
+
+	head, err := readFrontmatterHead(path, bufio.NewReader(f), currentMaxYAMLSize(), false)
+	var fm frontmatterBlock
+	var raw string
+	if err == nil {
+		fm, raw, _, err = extractFrontmatter(head)
+		err = setFrontmatterErrorPath(err, path)
+	}
+	if err != nil {
+		return meta, errors.Is(err, ErrFileTooLarge), err
+	}
+	if err := decodeFrontmatterBlock(path, fm, raw, &meta, FrontmatterOptions{}); err != nil {
+		var zero T
+		return zero, true, err
+	}
+	return meta, fm.format != FormatNone, nil
+}
+
+// ParseFrontmatterReader is ParseFrontmatter for a document read from r, such as an
+// upload: it reads only as far as the end of the YAML frontmatter and returns body
+// positioned at the start of the body, to be streamed on, e.g. to AtomicWriteReader.
+// The body's bytes are passed on as they are, without the line ending normalization
+// and trimming ParseFrontmatter applies. Without YAML frontmatter, yamlStr is empty and
+// body yields the whole document, less any byte order mark, including what was read
+// looking for it. Frontmatter over the size limit (see SetMaxYAMLSize), or an opening
+// fence not closed within it, returns a *FileTooLargeError, with body still yielding
+// the whole document; a read error returns a nil body.
+func ParseFrontmatterReader(r io.Reader) (yamlStr string, body io.Reader, err error) {
+	br := bufio.NewReader(r)
+	head, err := readFrontmatterHead("", br, currentMaxYAMLSize(), true)
+	var tooLarge *FileTooLargeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return "", io.MultiReader(strings.NewReader(strings.TrimPrefix(head, utf8BOM)), br), err
+	case err != nil:
+		return "", nil, err
+	}
+
+	fm, raw, _, err := extractFrontmatter(head)
+	if fm.format != FormatYAML || err != nil {
+		if !errors.As(err, &tooLarge) {
+			err = nil // mismatched fences: no frontmatter, as for ParseFrontmatter
+		}
+		return "", io.MultiReader(strings.NewReader(strings.TrimPrefix(head, utf8BOM)), br), err
+	}
+	return raw, io.MultiReader(strings.NewReader(head[fm.bodyStart:]), br), nil
+}
+
+// readFrontmatterHead reads the start of a markdown file from r, up to and including
+// the line that closes its frontmatter, which is all extractFrontmatter needs to find
+// it; without frontmatter it stops after the first line that isn't blank. Frontmatter
+// over limit bytes isn't kept: it's reported as a *FileTooLargeError once closed, and
+// mismatched fences as a *FenceError, as extractFrontmatter would report them; if it's
+// never closed there's no frontmatter, and the head is empty. With stream set, nothing
+// read is dropped: the read stops with a *FileTooLargeError as soon as the frontmatter
+// passes the limit, and the head holds everything read.
+func readFrontmatterHead(path string, r *bufio.Reader, limit int64, stream bool) (string, error) {
+	var b strings.Builder
+	var offset int64 // bytes read before the current line
+	n := 0           // the current line's number
+
+	// Skip a byte order mark and blank lines up to the opening fence, or JSON's opening
+	// brace.
+	var line, text string
+	for {
+		var err error
+		line, err = readFrontmatterLine(r)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		n++
+		b.WriteString(line)
+		if n == 1 {
+			text = strings.TrimPrefix(line, utf8BOM)
+		} else {
+			text = line
+		}
+		if strings.TrimSpace(text) != "" || err == io.EOF {
+			break
+		}
+		offset += int64(len(line))
+	}
+
+	var format Format
+	var braces jsonBraces
+	metaStart := offset + int64(len(line))
+	fence := strings.TrimSpace(text)
+	switch trimmed := strings.TrimLeftFunc(text, unicode.IsSpace); {
+	case isDashFence(fence):
+		format = FormatYAML
+	case fence == "+++":
+		format = FormatTOML
+	case strings.HasPrefix(trimmed, "{"):
+		format = FormatJSON
+		metaStart = offset + int64(len(line)-len(trimmed))
+		if braces.scan(trimmed) >= 0 {
+			return b.String(), nil
+		}
+	default:
+		return b.String(), nil
+	}
+
+	var (
+		kept      = true // whether b still holds everything read
+		jsonKeyed bool   // whether the JSON object starts with a key, once b is dropped
+		breakLen  int    // the length of the line break ending the previous line
+		fenceLine int    // the first "---" line in TOML frontmatter
+	)
+	for {
+		offset += int64(len(line))
+		breakLen = len(line) - len(strings.TrimRight(line, "\r\n"))
+		if kept && offset-metaStart > limit+2 {
+			if stream {
+				return b.String(), &FileTooLargeError{Path: path, Size: offset - metaStart, Limit: limit, Frontmatter: true}
+			}
+			// Past the limit, whatever the last line break: stop keeping what's read.
+			jsonKeyed = format == FormatJSON && jsonObjectKeyed(b.String()[metaStart:])
+			kept = false
+			b = strings.Builder{}
+		}
+
+		var err error
+		line, err = readFrontmatterLine(r)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+		n++
+		if kept {
+			b.WriteString(line)
+		}
+
+		var closed bool
+		size := offset - metaStart
+		switch text := strings.TrimRight(line, "\r\n"); format {
+		case FormatJSON:
+			if end := braces.scan(line); end >= 0 {
+				if !kept && (!jsonKeyed || strings.TrimSpace(line[end:]) != "") {
+					return "", nil
+				}
+				closed, size = true, size+int64(end)
+			}
+		default:
+			closing := strings.TrimRight(text, " \t")
+			if isClosingFence(format, fence, closing) {
+				closed, size = true, max(size-int64(breakLen), 0)
+			} else if format == FormatTOML && closing == "---" && fenceLine == 0 {
+				fenceLine = n
+			}
+		}
+		if closed {
+			if kept {
+				return b.String(), nil
+			}
+			return "", &FileTooLargeError{Path: path, Size: size, Limit: limit, Frontmatter: true}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if kept {
+		return b.String(), nil // the whole file: extractFrontmatter sorts it out
+	}
+	if fenceLine > 0 {
+		return "", &FenceError{Path: path, Line: fenceLine, Open: "+++", Close: "---"}
+	}
+	return "", nil
+}
+
+// readFrontmatterLine reads a line from r, with its line break: \n, \r\n, or a lone \r,
+// as nextLine splits lines. At the end of the input it returns io.EOF, with the last
+// line if it has no line break.
+func readFrontmatterLine(r *bufio.Reader) (string, error) {
+	var b []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return string(b), err
+		}
+		b = append(b, c)
+		switch c {
+		case '\n':
+			return string(b), nil
+		case '\r':
+			if next, err := r.Peek(1); err == nil && next[0] == '\n' {
+				r.ReadByte()
+				b = append(b, '\n')
+			}
+			return string(b), nil
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// ABOUTME: Tests for ReadFrontmatter: parity with DecodeFrontmatter across formats, line endings, and size limits.
+// ABOUTME: Also checks that the body is never read, and ParseFrontmatterReader against ParseFrontmatter on chunked input.
+package mdstore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// frontmatterParityCases are documents ReadFrontmatter must read as DecodeFrontmatter does.
+var frontmatterParityCases = map[string]string{
+	"yaml":                "---\ntitle: Hello\ntags: [a, b]\n---\n# Hello\n",
+	"yaml crlf":           "---\r\ntitle: Hello\r\n---\r\n# Hello\r\n",
+	"yaml lone cr":        "---\rtitle: Hello\r---\r# Hello\r",
+	"yaml dots":           "---\ntitle: Hello\n...\nbody\n",
+	"yaml empty":          "---\n---\nbody\n",
+	"yaml no body":        "---\ntitle: Hello\n---",
+	"yaml leading blanks": "\n  \n---\ntitle: Hello\n---\n",
+	"yaml malformed":      "---\ntitle: [Hello\n---\nbody\n",
+	"yaml rule in block":  "---\nnote: |\n  ---\n  more\n---\nbody\n",
+	"thematic break":      "---\n\nSome prose.\n\n---\nMore.\n",
+	"unclosed":            "---\ntitle: Hello\n# Hello\n",
+	"no frontmatter":      "# Hello\n\n---\ntitle: no\n---\n",
+	"empty file":          "",
+	"blank file":          "\n\n",
+	"toml":                "+++\ntitle = \"Hello\"\n[author]\nname = \"Ada\"\n+++\nbody\n",
+	"toml mismatched":     "+++\ntitle = \"Hello\"\n---\nbody\n",
+	"toml malformed":      "+++\ntitle = \n+++\n",
+	"json":                "{\n  \"title\": \"Hello\",\n  \"extra\": {\"a\": \"}\"}\n}\nbody\n",
+	"json one line":       "{\"title\": \"Hello\"}\nbody\n",
+	"json then text":      "{\"title\": \"Hello\"} body\n",
+	"json unclosed":       "{\"title\": \"Hello\"\nbody\n",
+	"template":            "{{ .Title }}\nbody\n",
+	"bom":                 "\xEF\xBB\xBF---\ntitle: Hello\n---\nbody\n",
+	"bom json":            "\xEF\xBB\xBF{\"title\": \"Hello\"}\nbody\n",
+	"bom blank lines":     "\xEF\xBB\xBF\n\n+++\ntitle = \"Hello\"\n+++\n",
+}
+
+func checkFrontmatterParity(t *testing.T, name, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "doc.md")
+	writeFileString(t, path, content)
+
+	var want map[string]interface{}
+	_, wantErr := DecodeFrontmatter(path, content, &want)
+	format, _, _ := ParseFrontmatterFormat(content)
+
+	got, found, err := ReadFrontmatter[map[string]interface{}](path)
+	if (err == nil) != (wantErr == nil) || (err != nil && err.Error() != wantErr.Error()) {
+		t.Fatalf("%s: error %v, want %v", name, err, wantErr)
+	}
+	if wantErr == nil && (found != (format != FormatNone) || !reflect.DeepEqual(got, want)) {
+		t.Errorf("%s: got %v, found %v; want %v, found %v", name, got, found, want, format != FormatNone)
+	}
+}
+
+func TestReadFrontmatter_Parity(t *testing.T) {
+	for name, content := range frontmatterParityCases {
+		checkFrontmatterParity(t, name, content)
+	}
+}
+
+func TestReadFrontmatter_ParitySizeLimit(t *testing.T) {
+	setMaxYAMLSize(t, 32)
+	long := strings.Repeat("x", 40)
+	for name, content := range map[string]string{
+		"yaml at limit":         "---\ntitle: " + strings.Repeat("x", 32-7) + "\n---\n",
+		"yaml over by one":      "---\ntitle: " + strings.Repeat("x", 32-6) + "\n---\n",
+		"yaml over by one crlf": "---\r\ntitle: " + strings.Repeat("x", 32-6) + "\r\n---\r\n",
+		"yaml over":             "---\ntitle: a\nsummary: " + long + "\nmore: " + long + "\n---\nbody\n",
+		"yaml over unclosed":    "---\ntitle: a\nsummary: " + long + "\nmore: " + long + "\nbody\n",
+		"toml over":             "+++\ntitle = \"" + long + "\"\nmore = \"" + long + "\"\n+++\n",
+		"toml over mismatched":  "+++\ntitle = \"" + long + "\"\nmore = \"" + long + "\"\n---\nbody\n",
+		"json over":             "{\n\"title\": \"" + long + "\",\n\"more\": \"" + long + "\"\n}\nbody\n",
+		"json over then text":   "{\n\"title\": \"" + long + "\",\n\"more\": \"" + long + "\"\n} text\n",
+		"json over not keyed":   "{\n\n\n" + strings.Repeat(" ", 40) + "\n{" + long + "}\n}\n",
+	} {
+		checkFrontmatterParity(t, name, content)
+	}
+}
+
+func TestReadFrontmatter_SkipsBody(t *testing.T) {
+	for _, head := range []string{
+		"---\ntitle: Hello\n---\n",
+		"+++\ntitle = \"Hello\"\n+++\n",
+		"{\n  \"title\": \"Hello\"\n}\n",
+		"# No frontmatter\n",
+	} {
+		// Reading past head fails.
+		r := io.MultiReader(strings.NewReader(head), iotest.ErrReader(errors.New("read the body")))
+		got, err := readFrontmatterHead("post.md", bufio.NewReader(r), DefaultMaxYAMLSize, false)
+		if err != nil || got != head {
+			t.Errorf("readFrontmatterHead(%q) = %q, %v", head, got, err)
+		}
+	}
+}
+
+func TestReadFrontmatter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.md")
+	writeFileString(t, path, tomlPost)
+	meta, found, err := ReadFrontmatter[postMeta](path)
+	if err != nil || !found || meta.Title != "Hello" || meta.Author.Name != "Ada" {
+		t.Errorf("got %+v, %v, %v", meta, found, err)
+	}
+
+	writeFileString(t, path, "---\nname: ''\nlevel: low\n---\n")
+	_, found, err = ReadFrontmatter[checkedConfig](path)
+	asValidationError(t, err, path)
+	if !found {
+		t.Error("invalid frontmatter should still be found")
+	}
+
+	if _, found, err := ReadFrontmatter[postMeta](filepath.Join(t.TempDir(), "missing.md")); !errors.Is(err, fs.ErrNotExist) || found {
+		t.Errorf("missing file: %v, %v", found, err)
+	}
+}
+
+func TestParseFrontmatterReader(t *testing.T) {
+	cases := map[string]string{
+		"bom crlf":  "\xEF\xBB\xBF---\r\ntitle: Hello\r\n---\r\n# Hello\r\n",
+		"long body": "---\ntitle: Hello\n---\n" + strings.Repeat("Some body text.\n", 1000),
+	}
+	for name, content := range frontmatterParityCases {
+		cases[name] = content
+	}
+	for name, content := range cases {
+		for chunking, wrap := range map[string]func(io.Reader) io.Reader{
+			"one byte": iotest.OneByteReader,
+			"half":     iotest.HalfReader,
+		} {
+			yamlStr, body, err := ParseFrontmatterReader(wrap(strings.NewReader(content)))
+			if err != nil {
+				t.Errorf("%s, %s: %v", name, chunking, err)
+				continue
+			}
+			rest, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("%s, %s: reading body: %v", name, chunking, err)
+			}
+
+			// The frontmatter is ParseFrontmatter's, and the body the rest of the stream.
+			wantYAML, _ := ParseFrontmatter(content)
+			wantBody := strings.TrimPrefix(content, utf8BOM)
+			if format, _, _ := ParseFrontmatterFormat(content); format == FormatYAML {
+				wantBody = StripFrontmatter(content)
+			}
+			if yamlStr != wantYAML || string(rest) != wantBody {
+				t.Errorf("%s, %s: got %q, %q; want %q, %q", name, chunking, yamlStr, rest, wantYAML, wantBody)
+			}
+		}
+	}
+}
+
+func TestParseFrontmatterReader_SizeLimit(t *testing.T) {
+	setMaxYAMLSize(t, 32)
+	for _, content := range []string{
+		"---\ntitle: a\nsummary: " + strings.Repeat("x", 40) + "\n---\nbody\n",
+		"---\ntitle: " + strings.Repeat("x", 32-6) + "\n---\nbody\n",
+		"---\n" + strings.Repeat("line\n", 1000),
+	} {
+		yamlStr, body, err := ParseFrontmatterReader(iotest.OneByteReader(strings.NewReader(content)))
+		if tooLarge := asFileTooLarge(t, err); !strings.HasPrefix(tooLarge.Error(), "mdstore: frontmatter is ") {
+			t.Errorf("unexpected message: %v", err)
+		}
+		if yamlStr != "" || body == nil {
+			t.Fatalf("got %q, %v", yamlStr, body)
+		}
+		// Nothing read is lost.
+		if rest, err := io.ReadAll(body); err != nil || string(rest) != content {
+			t.Errorf("body = %q, %v; want the whole document", rest, err)
+		}
+	}
+
+	// The frontmatter is read no further than the limit.
+	r := io.MultiReader(strings.NewReader("---\n"+strings.Repeat("key: value\n", 10)), iotest.ErrReader(errors.New("read too far")))
+	if _, _, err := ParseFrontmatterReader(r); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("expected ErrFileTooLarge, got %v", err)
+	}
+	_, body, err := ParseFrontmatterReader(iotest.ErrReader(errors.New("boom")))
+	if err == nil || body != nil {
+		t.Errorf("read error: %v, %v", body, err)
+	}
+}
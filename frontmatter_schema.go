@@ -0,0 +1,314 @@
+// ABOUTME: Declarative frontmatter checks: required keys, expected kinds, and allowed values, reported by line.
+// ABOUTME: Provides Schema, SchemaField, FieldKind, SchemaError, and ValidateFrontmatter.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldKind is the kind of value a SchemaField expects.
+type FieldKind int
+
+const (
+	KindAny    FieldKind = iota // any value
+	KindString                  // a string; numbers, booleans, and unquoted dates aren't
+	KindNumber                  // an integer or a float
+	KindBool                    // true or false
+	KindTime                    // a YAML timestamp, or a string ParseTime accepts
+	KindList                    // a sequence
+	KindMap                     // a mapping
+)
+
+func (k FieldKind) String() string {
+	switch k {
+	case KindAny:
+		return "any value"
+	case KindString:
+		return "a string"
+	case KindNumber:
+		return "a number"
+	case KindBool:
+		return "a boolean"
+	case KindTime:
+		return "a time"
+	case KindList:
+		return "a list"
+	case KindMap:
+		return "a mapping"
+	}
+	return fmt.Sprintf("FieldKind(%d)", int(k))
+}
+
+// SchemaField describes one frontmatter field.
+type SchemaField struct {
+	// Required fields must be present, and neither null nor an empty string.
+	Required bool
+
+	// Kind is the kind of value the field holds. A null value passes for a field that
+	// isn't required.
+	Kind FieldKind
+
+	// Enum, if set, lists the allowed values of a scalar field, or of each item of a
+	// list field, compared as they're written.
+	Enum []string
+}
+
+// Schema describes the frontmatter a document must have, keyed by dotted path (see
+// GetYAMLValue), so "author.name" describes the name field of the author mapping. It's
+// a focused subset of what JSON Schema can say: enough to keep documents missing a
+// title, or with tags that aren't a list, out of a store.
+type Schema map[string]SchemaField
+
+// SchemaError reports a frontmatter field that doesn't match its Schema, or
+// frontmatter that can't be checked at all, such as malformed YAML, with an empty Key.
+type SchemaError struct {
+	Key     string // the field's dotted path
+	Line    int    // the 1-based line of the document the problem is on
+	Problem string // what's wrong, e.g. "expected a list, got a string"
+}
+
+func (e *SchemaError) Error() string {
+	return "mdstore: " + e.describe()
+}
+
+func (e *SchemaError) describe() string {
+	if e.Key == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Problem)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Key, e.Problem)
+}
+
+// SchemaErrors is every problem ValidateFrontmatter found, as one error, which a
+// *ValidationError wraps when a write fails its schema (see MarkdownOptions).
+type SchemaErrors []SchemaError
+
+func (e SchemaErrors) Error() string {
+	problems := make([]string, len(e))
+	for i := range e {
+		problems[i] = e[i].describe()
+	}
+	return strings.Join(problems, "; ")
+}
+
+// ValidateFrontmatter checks the frontmatter of content against schema and returns
+// every problem it finds, in the order of the lines they're on, or nil if there are
+// none. Lines count from the top of content; a required field that's missing is
+// reported on the line of its parent key, or of the opening fence for a top-level
+// field, or line 1 if there's no frontmatter at all. YAML, TOML, and JSON frontmatter
+// are checked alike, though TOML reports every problem on its opening fence. Frontmatter
+// that can't be read, or isn't a mapping, is reported as a single problem.
+func ValidateFrontmatter(content string, schema Schema) []SchemaError {
+	fm, raw, _, err := extractFrontmatter(content)
+	if err != nil {
+		return []SchemaError{frontmatterSchemaError(err, 1)}
+	}
+
+	var doc yaml.Node
+	checker := schemaChecker{firstLine: fm.line, openLine: max(fm.line-1, 1)}
+	switch fm.format {
+	case FormatNone:
+		checker.openLine = 1
+	case FormatYAML:
+		err = yaml.Unmarshal([]byte(raw), &doc)
+		if err != nil {
+			err = newYAMLError("", err, fm.line)
+		}
+	case FormatJSON:
+		// JSON is YAML, so once encoding/json has said it's JSON, the node tree has
+		// lines; where YAML disagrees, as it can about tabs, it goes without.
+		var meta interface{}
+		if err = decodeJSONFrontmatter("", raw, fm.line, &meta, false); err == nil && yaml.Unmarshal([]byte(raw), &doc) != nil {
+			doc = yaml.Node{}
+			err, checker.flat = doc.Encode(meta), true
+		}
+		checker.openLine = fm.line
+	case FormatTOML:
+		var meta map[string]interface{}
+		if err = decodeTOMLFrontmatter("", raw, fm.line, &meta, FrontmatterOptions{}); err == nil && len(meta) > 0 {
+			err = doc.Encode(meta)
+		}
+		checker.flat = true
+	}
+	if err != nil {
+		return []SchemaError{frontmatterSchemaError(err, checker.openLine)}
+	}
+
+	root := &doc
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		root = resolveYAMLAlias(doc.Content[0])
+	}
+	if root.Kind != yaml.MappingNode && !(root.Kind == yaml.ScalarNode && root.ShortTag() == "!!null") && root.Kind != 0 {
+		return []SchemaError{{Line: checker.line(root.Line), Problem: "frontmatter must be a mapping, got " + describeSchemaNode(root)}}
+	}
+
+	keys := make([]string, 0, len(schema))
+	for key := range schema {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		checker.checkField(root, key, schema[key])
+	}
+	slices.SortStableFunc(checker.errs, func(a, b SchemaError) int {
+		return a.Line - b.Line
+	})
+	return checker.errs
+}
+
+// schemaChecker collects the SchemaErrors for one document.
+type schemaChecker struct {
+	firstLine int  // the line of content that node line 1 is
+	openLine  int  // the line of the opening fence, or of JSON's opening brace
+	flat      bool // node lines mean nothing, so report everything on openLine
+	errs      []SchemaError
+}
+
+// line converts a node line to a line of the document.
+func (c *schemaChecker) line(nodeLine int) int {
+	if c.flat || nodeLine == 0 {
+		return c.openLine
+	}
+	return c.firstLine + nodeLine - 1
+}
+
+func (c *schemaChecker) report(key string, nodeLine int, format string, args ...interface{}) {
+	c.errs = append(c.errs, SchemaError{Key: key, Line: c.line(nodeLine), Problem: fmt.Sprintf(format, args...)})
+}
+
+// checkField checks the field at the dotted path key, under the mapping root.
+func (c *schemaChecker) checkField(root *yaml.Node, key string, field SchemaField) {
+	node, keyLine := root, 0
+	for _, name := range splitYAMLPath(key) {
+		node = resolveYAMLAlias(node)
+		var next *yaml.Node
+		if node.Kind == yaml.MappingNode {
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == name {
+					next, keyLine = node.Content[i+1], node.Content[i].Line
+				}
+			}
+		} else if next = yamlChild(node, name); next != nil {
+			keyLine = next.Line
+		}
+		if next == nil {
+			if field.Required {
+				c.report(key, keyLine, "required, but missing")
+			}
+			return
+		}
+		node = next
+	}
+	node = resolveYAMLAlias(node)
+
+	if node.Kind == yaml.ScalarNode && (node.ShortTag() == "!!null" || (node.ShortTag() == "!!str" && node.Value == "")) {
+		if field.Required {
+			c.report(key, keyLine, "required, but empty")
+		}
+		return
+	}
+	if !schemaKindMatches(node, field.Kind) {
+		c.report(key, keyLine, "expected %s, got %s", field.Kind, describeSchemaNode(node))
+		return
+	}
+	if len(field.Enum) == 0 {
+		return
+	}
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if !slices.Contains(field.Enum, node.Value) {
+			c.report(key, keyLine, "%q is not one of %s", node.Value, strings.Join(field.Enum, ", "))
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			item = resolveYAMLAlias(item)
+			if item.Kind != yaml.ScalarNode || !slices.Contains(field.Enum, item.Value) {
+				c.report(fmt.Sprintf("%s.%d", key, i), item.Line, "%s is not one of %s", describeYAMLNode(item), strings.Join(field.Enum, ", "))
+			}
+		}
+	default:
+		c.report(key, keyLine, "expected one of %s, got %s", strings.Join(field.Enum, ", "), describeSchemaNode(node))
+	}
+}
+
+// schemaKindMatches reports whether node, which isn't null, is of kind.
+func schemaKindMatches(node *yaml.Node, kind FieldKind) bool {
+	switch kind {
+	case KindString:
+		return node.Kind == yaml.ScalarNode && node.ShortTag() == "!!str"
+	case KindNumber:
+		return node.Kind == yaml.ScalarNode && (node.ShortTag() == "!!int" || node.ShortTag() == "!!float")
+	case KindBool:
+		return node.Kind == yaml.ScalarNode && node.ShortTag() == "!!bool"
+	case KindTime:
+		if node.Kind != yaml.ScalarNode {
+			return false
+		}
+		if node.ShortTag() == "!!timestamp" {
+			return true
+		}
+		_, err := ParseTime(node.Value)
+		return node.ShortTag() == "!!str" && err == nil
+	case KindList:
+		return node.Kind == yaml.SequenceNode
+	case KindMap:
+		return node.Kind == yaml.MappingNode
+	}
+	return true
+}
+
+// describeSchemaNode names the kind of value node holds, for a SchemaError.
+func describeSchemaNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	switch node.ShortTag() {
+	case "!!str":
+		return "a string"
+	case "!!int", "!!float":
+		return "a number"
+	case "!!bool":
+		return "a boolean"
+	case "!!timestamp":
+		return "a time"
+	case "!!null":
+		return "null"
+	}
+	return "a value"
+}
+
+// resolveYAMLAlias returns the node an alias node refers to, or node itself.
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		return node.Alias
+	}
+	return node
+}
+
+// frontmatterSchemaError reports frontmatter that couldn't be read as a SchemaError,
+// on the line the error names, or line if it names none.
+func frontmatterSchemaError(err error, line int) SchemaError {
+	e := SchemaError{Line: line, Problem: strings.TrimPrefix(err.Error(), "mdstore: ")}
+	var yamlErr *YAMLError
+	var fmErr *FrontmatterError
+	var fenceErr *FenceError
+	switch {
+	case errors.As(err, &yamlErr):
+		e.Problem = yamlErr.msg
+		if yamlErr.Line > 0 {
+			e.Line = yamlErr.Line
+		}
+	case errors.As(err, &fmErr):
+		e.Line, e.Problem = fmErr.Line, fmt.Sprintf("%s frontmatter: %s", fmErr.Format, fmErr.msg)
+	case errors.As(err, &fenceErr):
+		e.Line, e.Problem = fenceErr.Line, fmt.Sprintf("frontmatter opened with %q is closed with %q", fenceErr.Open, fenceErr.Close)
+	}
+	return e
+}
@@ -0,0 +1,282 @@
+// ABOUTME: Table tests for ValidateFrontmatter: required keys, kinds, enums, nested paths, and the lines problems are on.
+// ABOUTME: Covers YAML, TOML, and JSON frontmatter, unreadable frontmatter, and WriteMarkdownFileOpts with MustValidate.
+package mdstore
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var postSchema = Schema{
+	"title":       {Required: true, Kind: KindString},
+	"tags":        {Kind: KindList},
+	"published":   {Kind: KindTime},
+	"draft":       {Kind: KindBool},
+	"weight":      {Kind: KindNumber},
+	"status":      {Kind: KindString, Enum: []string{"draft", "review", "live"}},
+	"author":      {Kind: KindMap},
+	"author.name": {Required: true, Kind: KindString},
+}
+
+func TestValidateFrontmatter(t *testing.T) {
+	for _, tc := range []struct {
+		name, content string
+		want          []SchemaError
+	}{
+		{
+			name:    "valid",
+			content: "---\ntitle: Hello\ntags: [go]\npublished: 2026-02-05T10:04:05Z\ndraft: false\nweight: 1.5\nstatus: live\nauthor:\n  name: Ada\n---\nbody\n",
+		},
+		{
+			name:    "missing title",
+			content: "---\nauthor:\n  name: Ada\n---\n",
+			want:    []SchemaError{{Key: "title", Line: 1, Problem: "required, but missing"}},
+		},
+		{
+			name:    "null title",
+			content: "---\ntitle:\nauthor: {name: Ada}\n---\n",
+			want:    []SchemaError{{Key: "title", Line: 2, Problem: "required, but empty"}},
+		},
+		{
+			name:    "empty title",
+			content: "---\ntitle: ''\nauthor: {name: Ada}\n---\n",
+			want:    []SchemaError{{Key: "title", Line: 2, Problem: "required, but empty"}},
+		},
+		{
+			name:    "tags not a list",
+			content: "---\ntitle: Hello\ntags: go, yaml\nauthor: {name: Ada}\n---\n",
+			want:    []SchemaError{{Key: "tags", Line: 3, Problem: "expected a list, got a string"}},
+		},
+		{
+			name:    "tags a mapping",
+			content: "---\ntitle: Hello\nauthor: {name: Ada}\ntags:\n  go: true\n---\n",
+			want:    []SchemaError{{Key: "tags", Line: 4, Problem: "expected a list, got a mapping"}},
+		},
+		{
+			name:    "number for a string",
+			content: "---\ntitle: 42\nauthor: {name: Ada}\n---\n",
+			want:    []SchemaError{{Key: "title", Line: 2, Problem: "expected a string, got a number"}},
+		},
+		{
+			name:    "quoted number is a string",
+			content: "---\ntitle: '42'\nauthor: {name: Ada}\n---\n",
+		},
+		{
+			name:    "bad time",
+			content: "---\ntitle: Hello\nauthor: {name: Ada}\npublished: last tuesday\n---\n",
+			want:    []SchemaError{{Key: "published", Line: 4, Problem: "expected a time, got a string"}},
+		},
+		{
+			name:    "quoted time",
+			content: "---\ntitle: Hello\nauthor: {name: Ada}\npublished: '2026-02-05T10:04:05+01:00'\n---\n",
+		},
+		{
+			name:    "date",
+			content: "---\ntitle: Hello\nauthor: {name: Ada}\npublished: 2026-02-05\n---\n",
+		},
+		{
+			name:    "string for a bool",
+			content: "---\ntitle: Hello\nauthor: {name: Ada}\ndraft: 'yes'\n---\n",
+			want:    []SchemaError{{Key: "draft", Line: 4, Problem: "expected a boolean, got a string"}},
+		},
+		{
+			name:    "bool for a number",
+			content: "---\ntitle: Hello\nauthor: {name: Ada}\nweight: true\n---\n",
+			want:    []SchemaError{{Key: "weight", Line: 4, Problem: "expected a number, got a boolean"}},
+		},
+		{
+			name:    "null optional field",
+			content: "---\ntitle: Hello\nauthor: {name: Ada}\ntags: ~\ndraft:\n---\n",
+		},
+		{
+			name:    "enum",
+			content: "---\ntitle: Hello\nauthor: {name: Ada}\nstatus: published\n---\n",
+			want:    []SchemaError{{Key: "status", Line: 4, Problem: `"published" is not one of draft, review, live`}},
+		},
+		{
+			name:    "missing nested",
+			content: "---\ntitle: Hello\nauthor:\n  email: ada@example.com\n---\n",
+			want:    []SchemaError{{Key: "author.name", Line: 3, Problem: "required, but missing"}},
+		},
+		{
+			name:    "missing parent",
+			content: "---\ntitle: Hello\n---\n",
+			want:    []SchemaError{{Key: "author.name", Line: 1, Problem: "required, but missing"}},
+		},
+		{
+			name:    "parent not a mapping",
+			content: "---\ntitle: Hello\nauthor: Ada\n---\n",
+			want: []SchemaError{
+				{Key: "author", Line: 3, Problem: "expected a mapping, got a string"},
+				{Key: "author.name", Line: 3, Problem: "required, but missing"},
+			},
+		},
+		{
+			name:    "several, in line order",
+			content: "\n---\ntags: go\ndraft: 1\nauthor: {}\n---\nbody\n",
+			want: []SchemaError{
+				{Key: "title", Line: 2, Problem: "required, but missing"},
+				{Key: "tags", Line: 3, Problem: "expected a list, got a string"},
+				{Key: "draft", Line: 4, Problem: "expected a boolean, got a number"},
+				{Key: "author.name", Line: 5, Problem: "required, but missing"},
+			},
+		},
+		{
+			name:    "alias",
+			content: "---\ntitle: &t Hello\nauthor:\n  name: *t\n---\n",
+		},
+		{
+			name:    "crlf",
+			content: "---\r\ntitle: Hello\r\ntags: go\r\nauthor: {name: Ada}\r\n---\r\n",
+			want:    []SchemaError{{Key: "tags", Line: 3, Problem: "expected a list, got a string"}},
+		},
+		{
+			name:    "no frontmatter",
+			content: "# Hello\n",
+			want: []SchemaError{
+				{Key: "author.name", Line: 1, Problem: "required, but missing"},
+				{Key: "title", Line: 1, Problem: "required, but missing"},
+			},
+		},
+		{
+			name:    "empty frontmatter",
+			content: "\n---\n---\n",
+			want: []SchemaError{
+				{Key: "author.name", Line: 2, Problem: "required, but missing"},
+				{Key: "title", Line: 2, Problem: "required, but missing"},
+			},
+		},
+		{
+			name:    "malformed",
+			content: "---\ntitle: Hello\ntags: [go\n---\n",
+			want:    []SchemaError{{Line: 2, Problem: "did not find expected ',' or ']'"}},
+		},
+		{
+			name:    "mismatched fences",
+			content: "+++\ntitle = \"Hello\"\n---\n",
+			want:    []SchemaError{{Line: 3, Problem: `frontmatter opened with "+++" is closed with "---"`}},
+		},
+		{
+			name:    "json",
+			content: "{\n  \"title\": \"Hello\",\n  \"tags\": \"go\",\n  \"author\": {\"name\": \"Ada\"},\n  \"published\": \"2026-02-05T10:04:05Z\"\n}\nbody\n",
+			want:    []SchemaError{{Key: "tags", Line: 3, Problem: "expected a list, got a string"}},
+		},
+		{
+			name:    "json with tabs",
+			content: "{\n\t\"title\": 1,\n\t\"author\": {\"name\": \"Ada\"}\n}\n",
+			want:    []SchemaError{{Key: "title", Line: 2, Problem: "expected a string, got a number"}},
+		},
+		{
+			name:    "json syntax error",
+			content: "{\n  \"title\": \"Hello\",\n  \"tags\": [,]\n}\n",
+			want:    []SchemaError{{Line: 3, Problem: "json frontmatter: invalid character ',' looking for beginning of value"}},
+		},
+		{
+			name:    "toml",
+			content: "\n+++\ntitle = \"Hello\"\ntags = \"go\"\npublished = 2026-02-05T10:04:05Z\n[author]\nemail = \"ada@example.com\"\n+++\n",
+			want: []SchemaError{
+				{Key: "author.name", Line: 2, Problem: "required, but missing"},
+				{Key: "tags", Line: 2, Problem: "expected a list, got a string"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ValidateFrontmatter(tc.content, postSchema)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateFrontmatter_Enums(t *testing.T) {
+	schema := Schema{
+		"tags":  {Kind: KindList, Enum: []string{"go", "yaml"}},
+		"color": {Enum: []string{"red", "1"}},
+	}
+	for _, tc := range []struct {
+		name, content string
+		want          []SchemaError
+	}{
+		{"allowed", "---\ntags: [go, yaml]\ncolor: red\n---\n", nil},
+		{"number compared as written", "---\ncolor: 1\n---\n", nil},
+		{
+			name:    "list items",
+			content: "---\ntags:\n  - go\n  - rust\n  - [nested]\n---\n",
+			want: []SchemaError{
+				{Key: "tags.1", Line: 4, Problem: `"rust" is not one of go, yaml`},
+				{Key: "tags.2", Line: 5, Problem: "a list is not one of go, yaml"},
+			},
+		},
+		{
+			name:    "any kind",
+			content: "---\ncolor: {r: 255}\n---\n",
+			want:    []SchemaError{{Key: "color", Line: 2, Problem: "expected one of red, 1, got a mapping"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ValidateFrontmatter(tc.content, schema)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSchemaError_Messages(t *testing.T) {
+	errs := ValidateFrontmatter("---\ntags: go\n---\n", postSchema)
+	if len(errs) != 3 {
+		t.Fatalf("got %+v", errs)
+	}
+	if got, want := errs[1].Error(), "mdstore: line 1: title: required, but missing"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	want := "line 1: author.name: required, but missing; line 1: title: required, but missing; line 2: tags: expected a list, got a string"
+	if got := SchemaErrors(errs).Error(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	malformed := ValidateFrontmatter("---\ntitle: [\n---\n", postSchema)
+	if len(malformed) != 1 || malformed[0].Key != "" || malformed[0].Error() != "mdstore: line 2: "+malformed[0].Problem {
+		t.Errorf("got %+v", malformed)
+	}
+}
+
+func TestValidateFrontmatter_NotAMapping(t *testing.T) {
+	// Only lenient mode takes a list between fences for frontmatter.
+	SetLenientFrontmatter(true)
+	t.Cleanup(func() { SetLenientFrontmatter(false) })
+	got := ValidateFrontmatter("---\n- title\n---\n", postSchema)
+	if want := []SchemaError{{Line: 2, Problem: "frontmatter must be a mapping, got a list"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteMarkdownFileOpts_MustValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.md")
+	opts := MarkdownOptions{MustValidate: Schema{"title": {Required: true, Kind: KindString}, "tags": {Kind: KindList}}}
+
+	err := WriteMarkdownFileOpts(path, map[string]interface{}{"tags": "go"}, "body", opts)
+	var verr *ValidationError
+	var schemaErrs SchemaErrors
+	if !errors.As(err, &verr) || verr.Path != path || !errors.As(err, &schemaErrs) || len(schemaErrs) != 2 {
+		t.Fatalf("expected a *ValidationError wrapping two SchemaErrors, got %v", err)
+	}
+	if want := "mdstore: " + path + ": validation failed: line 1: title: required, but missing; line 2: tags: expected a list, got a string"; err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if _, _, found, _ := ReadMarkdownFile[postMeta](path); found {
+		t.Error("an invalid document was written")
+	}
+
+	if err := WriteMarkdownFileOpts(path, postMeta{Title: "Hello", Tags: []string{"go"}}, "body", opts); err != nil {
+		t.Fatalf("valid document: %v", err)
+	}
+	// The schema isn't switched off with the Validator hook.
+	SetValidation(false)
+	t.Cleanup(func() { SetValidation(true) })
+	if err := WriteMarkdownFileOpts(path, postMeta{}, "body", opts); !errors.As(err, &schemaErrs) {
+		t.Errorf("expected SchemaErrors with validation off, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+// ABOUTME: Where frontmatter sits in a document, for editors that highlight, fold, or replace it.
+// ABOUTME: Provides HasFrontmatter, StripFrontmatter, and FrontmatterSpan, with byte offsets into the original string.
+package mdstore
+
+// FrontmatterSpan returns the byte offsets of the whole frontmatter block in content,
+// fences included, whatever its format: start is where the opening fence's line
+// begins (for JSON, the "{"), and end is just past the closing fence's line break, or
+// the end of content if it has none. The offsets are into content as given, so a
+// leading byte order mark or blank lines come before start and \r\n line breaks count
+// as two bytes. content[:start] + block + content[end:] replaces the block with
+// another. ok is false if there is no frontmatter, or its fences don't match. The
+// size limit doesn't apply: frontmatter too large to decode still has a span.
+func FrontmatterSpan(content string) (start, end int, ok bool) {
+	fm, _ := scanFrontmatter(content)
+	if fm.format == FormatNone {
+		return 0, 0, false
+	}
+	return fm.start, fm.bodyStart, true
+}
+
+// HasFrontmatter reports whether content starts with frontmatter, in any format (see
+// FrontmatterSpan).
+func HasFrontmatter(content string) bool {
+	_, _, ok := FrontmatterSpan(content)
+	return ok
+}
+
+// StripFrontmatter returns content without its frontmatter block: the body exactly as
+// it is in content, unlike the normalized body ParseFrontmatter returns. Content
+// without frontmatter is returned unchanged.
+func StripFrontmatter(content string) string {
+	if _, end, ok := FrontmatterSpan(content); ok {
+		return content[end:]
+	}
+	return content
+}
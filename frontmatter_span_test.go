@@ -0,0 +1,124 @@
+// ABOUTME: Tests for FrontmatterSpan, HasFrontmatter, and StripFrontmatter: byte offsets across formats, line endings, and BOMs.
+// ABOUTME: Checks each span against the expected block text, splices replacements in, and cross-checks the fixtures.
+package mdstore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestFrontmatterSpan(t *testing.T) {
+	const bom = "\xEF\xBB\xBF"
+	for _, tc := range []struct {
+		name          string
+		before, block string // the text before the block, and the block itself
+		after         string // the rest of the document
+	}{
+		{"yaml", "", "---\ntitle: A\n---\n", "Body\n"},
+		{"crlf", "", "---\r\ntitle: A\r\n---\r\n", "Body\r\n"},
+		{"lone cr", "", "---\rtitle: A\r---\r", "Body\r"},
+		{"mixed line endings", "", "---\r\ntitle: A\n---\r", "Body\n"},
+		{"bom", bom, "---\ntitle: A\n---\n", "Body\n"},
+		{"bom crlf", bom, "---\r\ntitle: A\r\n---\r\n", "Body\r\n"},
+		{"leading blank lines", "\n \t\n", "---\ntitle: A\n---\n", "Body\n"},
+		{"bom and blank lines", bom + "\r\n\r\n", "---\r\ntitle: A\r\n---\r\n", "Body\r\n"},
+		{"indented opening fence", "", "  ---\ntitle: A\n---\n", "Body\n"},
+		{"fences with trailing blanks", "", "--- \t\ntitle: A\n---  \n", "Body\n"},
+		{"dots", "", "---\ntitle: A\n...\n", "Body\n"},
+		{"empty", "", "---\n---\n", "Body\n"},
+		{"no body", "", "---\ntitle: A\n---\n", ""},
+		{"no final line break", "", "---\ntitle: A\n---", ""},
+		{"blank line after", "", "---\ntitle: A\n---\n", "\n\nBody\n"},
+		{"rule in block scalar", "", "---\nnote: |\n  ---\n---\n", "Body\n"},
+		{"toml", "", "+++\ntitle = \"A\"\n+++\n", "Body\n"},
+		{"toml crlf bom", bom, "+++\r\ntitle = \"A\"\r\n+++\r\n", "Body\r\n"},
+		{"json", "", "{\n  \"title\": \"A\"\n}\n", "Body\n"},
+		{"json one line", "", "{\"title\": \"A\"}\n", "{\"body\": true}\n"},
+		{"json trailing blanks", "", "{\"title\": \"A\"}  \r\n", "Body\r\n"},
+		{"json indented", "\n  ", "{\"title\": \"}\"}\n", "Body\n"},
+		{"json bom", bom, "{\"title\": \"A\"}\n", "Body\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			content := tc.before + tc.block + tc.after
+			wantStart := len(tc.before)
+			start, end, ok := FrontmatterSpan(content)
+			if !ok || start != wantStart || end != wantStart+len(tc.block) {
+				t.Fatalf("FrontmatterSpan = %d, %d, %v; want %d, %d (%q)", start, end, ok, wantStart, wantStart+len(tc.block), tc.block)
+			}
+			if !HasFrontmatter(content) {
+				t.Error("HasFrontmatter = false")
+			}
+			if got := StripFrontmatter(content); got != tc.after {
+				t.Errorf("StripFrontmatter = %q, want %q", got, tc.after)
+			}
+
+			// Splicing a block in over the span replaces the frontmatter and nothing else.
+			spliced := content[:start] + "---\ntitle: B\n---\n" + content[end:]
+			var meta map[string]string
+			body, err := DecodeFrontmatter("doc.md", spliced, &meta)
+			if err != nil || meta["title"] != "B" || body != strings.TrimRightFunc(normalizeNewlines(tc.after), unicode.IsSpace) {
+				t.Errorf("after splicing: %v, %q, %v", meta, body, err)
+			}
+		})
+	}
+}
+
+func TestFrontmatterSpan_None(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty":           "",
+		"plain":           "# Title\n\nBody\n",
+		"thematic break":  "---\n\nSome prose.\n\n---\nMore.\n",
+		"unclosed":        "---\ntitle: A\n",
+		"mismatched":      "+++\ntitle = \"A\"\n---\nBody\n",
+		"text before":     "Intro\n---\ntitle: A\n---\n",
+		"bom after blank": "\n\xEF\xBB\xBF---\ntitle: A\n---\n",
+		"template":        "{{ .Title }}\n",
+		"json then text":  "{\"title\": \"A\"} Body\n",
+	} {
+		if start, end, ok := FrontmatterSpan(content); ok || start != 0 || end != 0 {
+			t.Errorf("%s: FrontmatterSpan = %d, %d, %v", name, start, end, ok)
+		}
+		if HasFrontmatter(content) || StripFrontmatter(content) != content {
+			t.Errorf("%s: expected no frontmatter", name)
+		}
+	}
+
+	// Frontmatter over the size limit isn't decoded, but it's still there.
+	setMaxYAMLSize(t, 8)
+	content := "---\ntitle: a long title\n---\nBody\n"
+	if yamlStr, _ := ParseFrontmatter(content); yamlStr != "" || !HasFrontmatter(content) {
+		t.Errorf("oversized frontmatter: %q, %v", yamlStr, HasFrontmatter(content))
+	}
+}
+
+func TestFrontmatterSpan_Fixtures(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := string(data)
+		start, end, ok := FrontmatterSpan(content)
+		format, _, body := ParseFrontmatterFormat(content)
+		if ok != (format != FormatNone) {
+			t.Errorf("%s: span found %v, format %v", path, ok, format)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if strings.TrimSpace(content[:start]) != "" {
+			t.Errorf("%s: span starts after content: %q", path, content[:start])
+		}
+		if got := strings.TrimRightFunc(normalizeNewlines(content[end:]), unicode.IsSpace); got != body {
+			t.Errorf("%s: text after the span is %q, body is %q", path, got, body)
+		}
+	}
+}
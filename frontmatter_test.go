@@ -0,0 +1,465 @@
+// ABOUTME: Tests for typed frontmatter: ParseFrontmatterAs, its strict-fields variant, and RenderFrontmatterAs.
+// ABOUTME: Uses a post struct with nested types and time fields, round-tripped through render and parse.
+package mdstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type postAuthor struct {
+	Name  string `yaml:"name"`
+	Email string `yaml:"email,omitempty"`
+}
+
+type postMeta struct {
+	Title     string            `yaml:"title"`
+	Published time.Time         `yaml:"published"`
+	Updated   StoredTime        `yaml:"updated,omitempty"`
+	Author    postAuthor        `yaml:"author"`
+	Tags      []string          `yaml:"tags,omitempty"`
+	Extra     map[string]string `yaml:"extra,omitempty"`
+	Draft     bool              `yaml:"draft,omitempty"`
+}
+
+func TestParseFrontmatterAs(t *testing.T) {
+	content := "---\n" +
+		"title: Hello\n" +
+		"published: 2026-02-05T10:04:05Z\n" +
+		"updated: '2026-02-06T11:00:00+01:00'\n" +
+		"author:\n  name: Ada\n" +
+		"tags: [go, yaml]\n" +
+		"extra: {lang: en}\n" +
+		"---\n# Hello\n"
+
+	meta, body, err := ParseFrontmatterAs[postMeta](content)
+	if err != nil {
+		t.Fatalf("ParseFrontmatterAs failed: %v", err)
+	}
+	want := postMeta{
+		Title:     "Hello",
+		Published: time.Date(2026, 2, 5, 10, 4, 5, 0, time.UTC),
+		Author:    postAuthor{Name: "Ada"},
+		Tags:      []string{"go", "yaml"},
+		Extra:     map[string]string{"lang": "en"},
+	}
+	if !meta.Updated.Equal(time.Date(2026, 2, 6, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Updated = %v", meta.Updated)
+	}
+	meta.Updated = StoredTime{}
+	if !reflect.DeepEqual(meta, want) || body != "# Hello" {
+		t.Errorf("got %+v, %q", meta, body)
+	}
+
+	// Pointers work too.
+	ptr, _, err := ParseFrontmatterAs[*postMeta](content)
+	if err != nil || ptr == nil || ptr.Author.Name != "Ada" {
+		t.Errorf("pointer meta: %+v, %v", ptr, err)
+	}
+}
+
+func TestParseFrontmatterAs_NoFrontmatter(t *testing.T) {
+	for _, content := range []string{"", "# Just a body\n", "---\n---\nbody\n"} {
+		meta, body, err := ParseFrontmatterAs[postMeta](content)
+		if err != nil || !reflect.DeepEqual(meta, postMeta{}) {
+			t.Errorf("%q: got %+v, %v", content, meta, err)
+		}
+		if _, want := ParseFrontmatter(content); body != want {
+			t.Errorf("%q: body = %q, want %q", content, body, want)
+		}
+	}
+}
+
+func TestParseFrontmatterAs_Errors(t *testing.T) {
+	content := "---\ntitle: Hello\npublished: [not, a, time]\n---\nbody\n"
+	meta, body, err := ParseFrontmatterAs[postMeta](content)
+	e := asYAMLError(t, err)
+	if e.Path != "" || e.Line != 3 || meta.Title != "" || body != "body" {
+		t.Errorf("got %+v, meta %+v, body %q", e, meta, body)
+	}
+
+	typo := "---\ntitle: Hello\ntittle: Oops\n---\n"
+	if _, _, err := ParseFrontmatterAs[postMeta](typo); err != nil {
+		t.Errorf("lenient parse should ignore unknown keys: %v", err)
+	}
+	_, _, err = ParseFrontmatterAsStrictFields[postMeta](typo)
+	if e := asYAMLError(t, err); e.Line != 3 || !strings.Contains(err.Error(), "tittle") {
+		t.Errorf("strict parse: %v", err)
+	}
+
+	_, _, err = ParseFrontmatterAs[checkedConfig]("---\nname: ''\nlevel: low\n---\n")
+	asValidationError(t, err, "")
+}
+
+func TestRenderFrontmatterAs_RoundTrip(t *testing.T) {
+	meta := postMeta{
+		Title:     "Round trip",
+		Published: time.Date(2026, 2, 5, 10, 4, 5, 500, time.UTC),
+		Updated:   StoredTime{time.Date(2026, 2, 6, 0, 0, 0, 0, time.UTC)},
+		Author:    postAuthor{Name: "Ada", Email: "ada@example.com"},
+		Tags:      []string{"a"},
+		Draft:     true,
+	}
+	content, err := RenderFrontmatterAs(meta, "Body.\n")
+	if err != nil {
+		t.Fatalf("RenderFrontmatterAs failed: %v", err)
+	}
+	if want, _ := RenderFrontmatter(meta, "Body.\n"); content != want {
+		t.Errorf("RenderFrontmatterAs should match RenderFrontmatter:\n%s\nwant:\n%s", content, want)
+	}
+
+	back, body, err := ParseFrontmatterAsStrictFields[postMeta](content)
+	if err != nil || body != "Body." {
+		t.Fatalf("parse back: %q, %v", body, err)
+	}
+	if !back.Published.Equal(meta.Published) || !back.Updated.Equal(meta.Updated.Time) {
+		t.Errorf("times changed: %v, %v", back.Published, back.Updated)
+	}
+	back.Published, back.Updated = meta.Published, meta.Updated
+	if !reflect.DeepEqual(back, meta) {
+		t.Errorf("round trip got %+v, want %+v", back, meta)
+	}
+}
+
+func TestParseFrontmatter_Delimiters(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, yaml, body string
+	}{
+		{
+			name:    "dashes in a block scalar",
+			content: "---\ntitle: Post\nsummary: |\n  Intro\n  ---\n  More\n---\nBody\n",
+			yaml:    "title: Post\nsummary: |\n  Intro\n  ---\n  More",
+			body:    "Body",
+		},
+		{
+			name:    "dashes starting a value",
+			content: "---\nrule: ---x\nsep: ----\n---\nBody",
+			yaml:    "rule: ---x\nsep: ----",
+			body:    "Body",
+		},
+		{
+			name:    "trailing spaces on the fences",
+			content: "---  \ntitle: Post\n--- \t\nBody",
+			yaml:    "title: Post",
+			body:    "Body",
+		},
+		{
+			name:    "document end marker",
+			content: "---\ntitle: Post\n...\nBody",
+			yaml:    "title: Post",
+			body:    "Body",
+		},
+		{
+			name:    "crlf",
+			content: "---\r\ntitle: Post\r\n---  \r\nBody\r\nmore\r\n",
+			yaml:    "title: Post",
+			body:    "Body\nmore",
+		},
+		{
+			name:    "lone cr",
+			content: "---\rtitle: Post\r---\rBody",
+			yaml:    "title: Post",
+			body:    "Body",
+		},
+		{
+			name:    "empty",
+			content: "---\n---\nBody",
+			yaml:    "",
+			body:    "Body",
+		},
+		{
+			name:    "leading blank lines",
+			content: "\n  \n---\ntitle: Post\n---\nBody",
+			yaml:    "title: Post",
+			body:    "Body",
+		},
+		{
+			name:    "longer fences",
+			content: "----\ntitle: Post\nnote: |\n  ---\n----\nBody",
+			yaml:    "title: Post\nnote: |\n  ---",
+			body:    "Body",
+		},
+		{
+			name:    "longer fence closed by document end marker",
+			content: "-----\ntitle: Post\n...\nBody",
+			yaml:    "title: Post",
+			body:    "Body",
+		},
+		{
+			name:    "longer rule is not a fence",
+			content: "----\ntitle: Post\n---\nBody",
+			body:    "----\ntitle: Post\n---\nBody",
+		},
+		{
+			name:    "two dashes are not a fence",
+			content: "--\ntitle: Post\n--\nBody",
+			body:    "--\ntitle: Post\n--\nBody",
+		},
+		{
+			name:    "no closing line",
+			content: "---\ntitle: Post\nsummary: a --- b\n",
+			body:    "---\ntitle: Post\nsummary: a --- b\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			yamlStr, body := ParseFrontmatter(tc.content)
+			if yamlStr != tc.yaml || body != tc.body {
+				t.Errorf("got %q, %q; want %q, %q", yamlStr, body, tc.yaml, tc.body)
+			}
+		})
+	}
+}
+
+// A "----" fence once left its extra dash in front of the first key.
+func TestParseFrontmatterAs_FourDashFences(t *testing.T) {
+	content := "----\ntitle: Post\ntags: [a]\n----\nBody\n"
+	meta, body, err := ParseFrontmatterAs[map[string]interface{}](content)
+	if err != nil {
+		t.Fatalf("ParseFrontmatterAs failed: %v", err)
+	}
+	want := map[string]interface{}{"title": "Post", "tags": []interface{}{"a"}}
+	if !reflect.DeepEqual(meta, want) || body != "Body" {
+		t.Errorf("got %v, %q; want %v, %q", meta, body, want, "Body")
+	}
+
+	path := filepath.Join(t.TempDir(), "post.md")
+	writeFileString(t, path, content)
+	read, _, err := ReadFrontmatter[map[string]interface{}](path)
+	if err != nil || !reflect.DeepEqual(read, want) {
+		t.Errorf("ReadFrontmatter got %v, %v; want %v", read, err, want)
+	}
+}
+
+func TestParseFrontmatterDelim(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, open, close, yaml, body string
+	}{
+		{
+			name:    "custom fences",
+			content: "= = =\ntitle: Post\n= = =\nBody\n",
+			open:    "= = =",
+			close:   "= = =",
+			yaml:    "title: Post",
+			body:    "Body",
+		},
+		{
+			name:    "different open and close",
+			content: "\ufeff\n<!--meta  \r\ntitle: Post\r\n-->\r\nBody\r\n",
+			open:    "<!--meta",
+			close:   "-->",
+			yaml:    "title: Post",
+			body:    "Body",
+		},
+		{
+			name:    "dashes between custom fences",
+			content: "= = =\n---\ntitle: Post\n= = =\nBody",
+			open:    "= = =",
+			close:   "= = =",
+			yaml:    "---\ntitle: Post",
+			body:    "Body",
+		},
+		{
+			name:    "not closed",
+			content: "= = =\ntitle: Post\nBody",
+			open:    "= = =",
+			close:   "= = =",
+			body:    "= = =\ntitle: Post\nBody",
+		},
+		{
+			name:    "no opening fence",
+			content: "---\ntitle: Post\n---\nBody",
+			open:    "= = =",
+			close:   "= = =",
+			body:    "---\ntitle: Post\n---\nBody",
+		},
+		{
+			name:    "empty fence",
+			content: "\ntitle: Post\n\nBody",
+			body:    "\ntitle: Post\n\nBody",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			yamlStr, body := ParseFrontmatterDelim(tc.content, tc.open, tc.close)
+			if yamlStr != tc.yaml || body != tc.body {
+				t.Errorf("got %q, %q; want %q, %q", yamlStr, body, tc.yaml, tc.body)
+			}
+		})
+	}
+}
+
+func TestRenderFrontmatterOpts_Fence(t *testing.T) {
+	meta := map[string]string{"title": "Post"}
+	content, err := RenderFrontmatterOpts(meta, "Body\n", YAMLOptions{Fence: "----"})
+	if err != nil {
+		t.Fatalf("RenderFrontmatterOpts failed: %v", err)
+	}
+	if want := "----\ntitle: Post\n----\nBody\n"; content != want {
+		t.Errorf("got %q, want %q", content, want)
+	}
+	if yamlStr, body := ParseFrontmatter(content); yamlStr != "title: Post" || body != "Body" {
+		t.Errorf("parse back got %q, %q", yamlStr, body)
+	}
+
+	content, err = RenderFrontmatterOpts(meta, "Body\n", YAMLOptions{Fence: "= = =", CRLF: true})
+	if err != nil {
+		t.Fatalf("RenderFrontmatterOpts failed: %v", err)
+	}
+	if want := "= = =\r\ntitle: Post\r\n= = =\r\nBody\r\n"; content != want {
+		t.Errorf("got %q, want %q", content, want)
+	}
+	if yamlStr, body := ParseFrontmatterDelim(content, "= = =", "= = ="); yamlStr != "title: Post" || body != "Body" {
+		t.Errorf("parse back got %q, %q", yamlStr, body)
+	}
+
+	for _, fence := range []string{" ", "---\n---"} {
+		if _, err := RenderFrontmatterOpts(meta, "Body\n", YAMLOptions{Fence: fence}); err == nil {
+			t.Errorf("fence %q should fail", fence)
+		}
+	}
+}
+
+func TestDecodeFrontmatter_BlockScalarWithRule(t *testing.T) {
+	content := "---\ntitle: Post\nsummary: |\n  Intro\n\n  ---\n\n  More\ntags: [a]\n---\n# Post\n"
+	var meta struct {
+		Summary string   `yaml:"summary"`
+		Tags    []string `yaml:"tags"`
+	}
+	body, err := DecodeFrontmatter("post.md", content, &meta)
+	if err != nil || meta.Summary != "Intro\n\n---\n\nMore\n" || len(meta.Tags) != 1 || body != "# Post" {
+		t.Errorf("got %+v, %q, %v", meta, body, err)
+	}
+
+	_, err = DecodeFrontmatter("post.md", "\n\n---\r\ntitle: ok\r\ntags: [\r\n---\r\n", &meta)
+	if e := asYAMLError(t, err); e.Line != 5 {
+		t.Errorf("line should count from the top of the file, got %d: %v", e.Line, err)
+	}
+}
+
+func TestParseFrontmatter_ThematicBreak(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, yaml string
+		frontmatter         bool
+	}{
+		{"rule then prose", "---\n\nSome prose.\n\nMore prose.\n", "", false},
+		{"rule, prose, later rule", "---\n\nSome prose.\n\n---\n\nNext section.\n", "", false},
+		{"rule, list, later rule", "---\n\n- one\n- two\n\n---\nEnd\n", "", false},
+		{"rule, odd prose, later rule", "---\n\nDon't: stop: here\n---\nEnd\n", "", false},
+		{"empty frontmatter", "---\n---\nBody\n", "", true},
+		{"comments only", "---\n# nothing yet\n---\nBody\n", "# nothing yet", true},
+		{"null", "---\n~\n---\nBody\n", "~", true},
+		{"mapping", "---\ntitle: Post\n---\nBody\n", "title: Post", true},
+		{"malformed mapping", "---\ntitle: [broken\n---\nBody\n", "title: [broken", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			yamlStr, body := ParseFrontmatter(tc.content)
+			if tc.frontmatter {
+				if yamlStr != tc.yaml || body != "Body" {
+					t.Errorf("expected frontmatter, got %q, %q", yamlStr, body)
+				}
+				return
+			}
+			if yamlStr != "" || body != tc.content {
+				t.Errorf("expected no frontmatter, got %q, %q", yamlStr, body)
+			}
+			var meta map[string]interface{}
+			if body, err := DecodeFrontmatter("doc.md", tc.content, &meta); err != nil || meta != nil || body != tc.content {
+				t.Errorf("DecodeFrontmatter: %v, %v, %q", meta, err, body)
+			}
+		})
+	}
+
+	// A typo in real frontmatter is still reported rather than passed off as body.
+	var meta map[string]interface{}
+	_, err := DecodeFrontmatter("doc.md", "---\ntitle: [broken\n---\nBody\n", &meta)
+	asYAMLError(t, err)
+}
+
+func TestSetLenientFrontmatter(t *testing.T) {
+	SetLenientFrontmatter(true)
+	t.Cleanup(func() { SetLenientFrontmatter(false) })
+
+	content := "---\n\nSome prose.\n\n---\n\nNext section.\n"
+	yamlStr, body := ParseFrontmatter(content)
+	if yamlStr != "\nSome prose.\n" || body != "\nNext section." {
+		t.Errorf("lenient mode got %q, %q", yamlStr, body)
+	}
+	SetLenientFrontmatter(false)
+	if yamlStr, _ := ParseFrontmatter(content); yamlStr != "" {
+		t.Errorf("strict mode got %q", yamlStr)
+	}
+}
+
+func TestParseFrontmatter_BOM(t *testing.T) {
+	const bom = "\xEF\xBB\xBF"
+	for _, tc := range []struct {
+		name, content, yaml, body string
+	}{
+		{"frontmatter", bom + "---\ntitle: Post\n---\nBody\n", "title: Post", "Body"},
+		{"crlf frontmatter", bom + "---\r\ntitle: Post\r\n---\r\nBody\r\n", "title: Post", "Body"},
+		{"blank lines", bom + "\n\n---\ntitle: Post\n---\nBody\n", "title: Post", "Body"},
+		// Without frontmatter the mark is dropped from the body all the same.
+		{"no frontmatter", bom + "# Post\n\nBody\n", "", "# Post\n\nBody\n"},
+		{"only a mark", bom, "", ""},
+		// A mark anywhere but the very start is content.
+		{"mark after blank line", "\n" + bom + "---\ntitle: Post\n---\n", "", "\n" + bom + "---\ntitle: Post\n---\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			yamlStr, body := ParseFrontmatter(tc.content)
+			if yamlStr != tc.yaml || body != tc.body {
+				t.Errorf("got %q, %q; want %q, %q", yamlStr, body, tc.yaml, tc.body)
+			}
+			var meta map[string]string
+			if _, err := DecodeFrontmatter("post.md", tc.content, &meta); err != nil || (tc.yaml != "") != (meta["title"] == "Post") {
+				t.Errorf("DecodeFrontmatter: %v, %v", meta, err)
+			}
+		})
+	}
+
+	// Rendering never writes a mark, even when the body came with one.
+	out, err := RenderFrontmatter(map[string]string{"title": "Post"}, bom+"Body\n")
+	if err != nil || strings.Contains(out, bom) {
+		t.Errorf("RenderFrontmatter wrote a byte order mark: %q, %v", out, err)
+	}
+	// UpdateFrontmatter edits bytes in place, so it keeps the mark first.
+	out, err = UpdateFrontmatter(bom+"Body\n", func(doc *yaml.Node) error {
+		return SetYAMLPath(doc, "title", "Post")
+	})
+	if err != nil || out != bom+"---\ntitle: Post\n---\nBody\n" {
+		t.Errorf("UpdateFrontmatter = %q, %v", out, err)
+	}
+}
+
+func TestFrontmatter_CRLFRoundTrip(t *testing.T) {
+	_, content := copyFixture(t, "post.crlf.md")
+
+	yamlStr, body := ParseFrontmatter(content)
+	if strings.Contains(yamlStr, "\r") || strings.Contains(body, "\r") {
+		t.Errorf("stray \\r in %q / %q", yamlStr, body)
+	}
+	meta, body, err := ParseFrontmatterAsStrictFields[postMeta](content)
+	if err != nil {
+		t.Fatalf("ParseFrontmatterAsStrictFields failed: %v", err)
+	}
+	if meta.Title != "Hello" || meta.Author.Name != "Ada" || len(meta.Tags) != 2 || meta.Tags[1] != "windows" {
+		t.Errorf("got %+v", meta)
+	}
+
+	out, err := RenderFrontmatterOpts(meta, body+"\n", YAMLOptions{Indent: 2, CRLF: true})
+	if err != nil {
+		t.Fatalf("RenderFrontmatterOpts failed: %v", err)
+	}
+	if out != content {
+		t.Errorf("round trip differs:\n got %q\nwant %q", out, content)
+	}
+
+	// LF stays the default; a CRLF body is written as given.
+	out, err = RenderFrontmatterOpts(meta, "Body\r\n", YAMLOptions{Indent: 2})
+	if err != nil || !strings.HasPrefix(out, "---\ntitle: Hello\n") || !strings.HasSuffix(out, "---\nBody\r\n") {
+		t.Errorf("default line endings: %q, %v", out, err)
+	}
+}
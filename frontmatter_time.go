@@ -0,0 +1,187 @@
+// ABOUTME: Opt-in StoredTime handling of plain time.Time fields, for frontmatter read and YAML written.
+// ABOUTME: Rewrites the time scalars of a decoded yaml.Node tree by the destination's type before it's decoded.
+package mdstore
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	yamlUnmarshalType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+)
+
+// decodeFrontmatterYAML unmarshals the YAML data into dest as opts says: failing on
+// unknown keys with StrictFields, and reading time.Time fields as StoredTime does
+// with StoredTimes.
+func decodeFrontmatterYAML(data []byte, dest interface{}, opts FrontmatterOptions) error {
+	if !opts.StoredTimes {
+		if opts.StrictFields {
+			return decodeYAMLKnownFields(data, dest)
+		}
+		return yaml.Unmarshal(data, dest)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	var errs []string
+	storeTimeNodes(&doc, reflect.TypeOf(dest), &errs)
+	if len(errs) > 0 {
+		return &yaml.TypeError{Errors: errs}
+	}
+	if !opts.StrictFields {
+		return doc.Decode(dest)
+	}
+	// A Node can't refuse unknown fields, so it goes back to text for a Decoder that can.
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return decodeYAMLKnownFields(buf.Bytes(), dest)
+}
+
+// storeTimeNodes walks node as yaml.v3 will decode it into a t, rewriting each scalar
+// bound for a time.Time into a form yaml.v3 reads as StoredTime would read it, and
+// adding a message, with its line, to errs for each that isn't a time. Types that
+// unmarshal themselves, such as StoredTime, and interface{} values are left alone, as
+// are aliases, whose anchors are rewritten where they're bound for a time.
+func storeTimeNodes(node *yaml.Node, t reflect.Type, errs *[]string) {
+	if node.Kind == yaml.DocumentNode {
+		for _, child := range node.Content {
+			storeTimeNodes(child, t, errs)
+		}
+		return
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case node.Kind == yaml.AliasNode:
+		return
+	case t == timeType:
+		storeTimeNode(node, errs)
+		return
+	case reflect.PointerTo(t).Implements(yamlUnmarshalType):
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields, rest := yamlStructFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if ft, ok := fields[node.Content[i].Value]; ok {
+				storeTimeNodes(node.Content[i+1], ft, errs)
+			} else if rest != nil {
+				storeTimeNodes(node.Content[i+1], rest, errs)
+			}
+		}
+	case reflect.Map:
+		if node.Kind == yaml.MappingNode {
+			for i := 1; i < len(node.Content); i += 2 {
+				storeTimeNodes(node.Content[i], t.Elem(), errs)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind == yaml.SequenceNode {
+			for _, item := range node.Content {
+				storeTimeNodes(item, t.Elem(), errs)
+			}
+		}
+	}
+}
+
+// storeTimeNode rewrites node, bound for a time.Time, as a timestamp in FormatTime's
+// form, or as null if it's empty.
+func storeTimeNode(node *yaml.Node, errs *[]string) {
+	if node.Kind != yaml.ScalarNode {
+		*errs = append(*errs, fmt.Sprintf("line %d: cannot unmarshal %s into a time: expected RFC3339", node.Line, describeYAMLNode(node)))
+		return
+	}
+	if node.ShortTag() == "!!null" {
+		return
+	}
+	if node.Value == "" {
+		node.Value, node.Tag, node.Style = "null", "!!null", 0
+		return
+	}
+	parsed, err := ParseTime(node.Value)
+	if err != nil {
+		if parsed, err = time.Parse(time.DateOnly, node.Value); err != nil {
+			*errs = append(*errs, fmt.Sprintf("line %d: cannot unmarshal %s into a time: expected RFC3339 or a date", node.Line, describeYAMLNode(node)))
+			return
+		}
+	}
+	node.Value, node.Tag, node.Style = FormatTime(parsed), "!!timestamp", 0
+}
+
+// yamlStructFields maps the keys yaml.v3 decodes into a struct of type t to their
+// fields' types, following inlined structs, and returns the value type of an inlined
+// map, which takes the other keys, if t has one.
+func yamlStructFields(t reflect.Type) (fields map[string]reflect.Type, rest reflect.Type) {
+	fields = make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("yaml")
+		if (f.PkgPath != "" && !f.Anonymous) || tag == "-" {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		if !strings.Contains(","+flags+",", ",inline,") {
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fields[name] = f.Type
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		switch ft.Kind() {
+		case reflect.Struct:
+			inner, innerRest := yamlStructFields(ft)
+			for name, innerType := range inner {
+				if _, taken := fields[name]; !taken {
+					fields[name] = innerType
+				}
+			}
+			if innerRest != nil {
+				rest = innerRest
+			}
+		case reflect.Map:
+			rest = ft.Elem()
+		}
+	}
+	return fields, rest
+}
+
+// nullZeroTimes rewrites the zero time.Time timestamps of node, as yaml.v3 encodes a
+// Go value, as null, as StoredTime writes the zero time. Items of lists are left as
+// they are, since yaml.v3 drops the nulls of a list it decodes into a slice.
+func nullZeroTimes(node *yaml.Node) {
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 1 && child.Kind == yaml.ScalarNode && child.ShortTag() == "!!timestamp" {
+			if t, err := ParseTime(child.Value); err == nil && t.IsZero() {
+				child.Value, child.Tag, child.Style = "null", "!!null", 0
+			}
+			continue
+		}
+		nullZeroTimes(child)
+	}
+}
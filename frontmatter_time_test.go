@@ -0,0 +1,121 @@
+// ABOUTME: Tests for the StoredTimes options: plain time.Time fields read with ParseTime and written with FormatTime.
+// ABOUTME: Round trips of nanosecond times, date-only and quoted inputs, zero and empty values, and nested fields.
+package mdstore
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+type timedPost struct {
+	Title      string               `yaml:"title"`
+	Date       time.Time            `yaml:"date"`
+	Updated    *time.Time           `yaml:"updated,omitempty"`
+	Events     []time.Time          `yaml:"events,omitempty"`
+	Due        map[string]time.Time `yaml:"due,omitempty"`
+	Stored     StoredTime           `yaml:"stored,omitempty"`
+	timedExtra `yaml:",inline"`
+}
+
+type timedExtra struct {
+	Published time.Time `yaml:"published,omitempty"`
+}
+
+var storedTimes = FrontmatterOptions{StoredTimes: true}
+
+func TestStoredTimes_RoundTrip(t *testing.T) {
+	date := time.Date(2026, 2, 5, 10, 30, 0, 123456789, time.FixedZone("", -5*3600))
+	updated := date.Add(time.Nanosecond)
+	post := timedPost{
+		Title:      "Times",
+		Date:       date,
+		Updated:    &updated,
+		Events:     []time.Time{date.UTC(), {}},
+		Due:        map[string]time.Time{"draft": date.Add(time.Hour)},
+		Stored:     StoredTime{date},
+		timedExtra: timedExtra{Published: date},
+	}
+	content, err := RenderFrontmatterAsOpts(post, "Body.\n", YAMLOptions{StoredTimes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"date: 2026-02-05T10:30:00.123456789-05:00\n", "- 0001-01-01T00:00:00Z\n", "published: 2026-02-05T10:30:00.123456789-05:00\n"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("rendered frontmatter lacks %q:\n%s", want, content)
+		}
+	}
+
+	got, body, err := ParseFrontmatterAsOpts[timedPost](content, storedTimes)
+	if err != nil || strings.TrimSpace(body) != "Body." {
+		t.Fatalf("ParseFrontmatterAsOpts: %v, body %q", err, body)
+	}
+	if !got.Date.Equal(date) || got.Date.Format(time.RFC3339Nano) != FormatTime(date) {
+		t.Errorf("Date = %v, want %v", got.Date, date)
+	}
+	if got.Updated == nil || !got.Updated.Equal(updated) {
+		t.Errorf("Updated = %v, want %v", got.Updated, updated)
+	}
+	if len(got.Events) != 2 || !got.Events[0].Equal(date) || !got.Events[1].IsZero() {
+		t.Errorf("Events = %v", got.Events)
+	}
+	if !got.Due["draft"].Equal(date.Add(time.Hour)) || !got.Stored.Equal(date) || !got.Published.Equal(date) {
+		t.Errorf("Due = %v, Stored = %v, Published = %v", got.Due, got.Stored, got.Published)
+	}
+}
+
+func TestStoredTimes_Inputs(t *testing.T) {
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	for _, tc := range []struct {
+		name, content string
+		want          time.Time
+	}{
+		{"date only", "---\ndate: 2024-01-15\n---\n", day},
+		{"quoted date only", "---\ndate: '2024-01-15'\n---\n", day},
+		{"quoted RFC3339", "---\ndate: \"2024-01-15T00:00:00Z\"\n---\n", day},
+		{"nanoseconds", "---\ndate: 2024-01-15T00:00:00.000000001Z\n---\n", day.Add(time.Nanosecond)},
+		{"empty string", "---\ndate: ''\n---\n", time.Time{}},
+		{"null", "---\ndate: null\n---\n", time.Time{}},
+		{"missing", "---\ntitle: x\n---\n", time.Time{}},
+		{"toml string", "+++\ndate = \"2024-01-15\"\n+++\n", day},
+		{"toml datetime", "+++\ndate = 2024-01-15T00:00:00Z\n+++\n", day},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _, err := ParseFrontmatterAsOpts[timedPost](tc.content, storedTimes)
+			if err != nil || !got.Date.Equal(tc.want) {
+				t.Errorf("Date = %v, %v; want %v", got.Date, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestStoredTimes_Errors(t *testing.T) {
+	_, _, err := ParseFrontmatterAsOpts[timedPost]("---\ntitle: x\ndate: soon\nevents: [2024-01-15, later]\n---\n", storedTimes)
+	yamlErr := asYAMLError(t, err)
+	if yamlErr.Line != 3 || !strings.Contains(err.Error(), `"soon"`) || !strings.Contains(err.Error(), "(and 1 more)") {
+		t.Errorf("err = %v (line %d)", err, yamlErr.Line)
+	}
+
+	_, _, err = ParseFrontmatterAsOpts[timedPost]("---\ndate: 2024-01-15\ntittle: x\n---\n", FrontmatterOptions{StoredTimes: true, StrictFields: true})
+	if yamlErr := asYAMLError(t, err); yamlErr.Line != 3 || !strings.Contains(err.Error(), "tittle") {
+		t.Errorf("strict err = %v (line %d)", err, yamlErr.Line)
+	}
+	if _, _, err := ParseFrontmatterAsOpts[timedPost]("---\ndate: '2024-01-15'\n---\n", FrontmatterOptions{StoredTimes: true, StrictFields: true}); err != nil {
+		t.Errorf("strict: %v", err)
+	}
+}
+
+func TestStoredTimes_OptIn(t *testing.T) {
+	// Without the option, yaml.v3's rules apply, as they always have.
+	if _, _, err := ParseFrontmatterAs[timedPost]("---\ndate: '2024-01-15'\n---\n"); err == nil {
+		t.Error("a quoted date decoded without StoredTimes")
+	}
+	content, err := RenderFrontmatterAs(timedPost{Title: "x"}, "")
+	if err != nil || !strings.Contains(content, "date: 0001-01-01T00:00:00Z\n") {
+		t.Errorf("RenderFrontmatterAs = %q, %v", content, err)
+	}
+	content, err = RenderFrontmatterAsOpts(timedPost{Title: "x"}, "", YAMLOptions{StoredTimes: true})
+	if err != nil || content != "---\ntitle: x\ndate: null\n---\n" {
+		t.Errorf("RenderFrontmatterAsOpts = %q, %v", content, err)
+	}
+}
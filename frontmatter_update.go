@@ -0,0 +1,127 @@
+// ABOUTME: Comment-preserving frontmatter updates that leave the markdown body byte-for-byte intact.
+// ABOUTME: Provides UpdateFrontmatter and UpdateFrontmatterFile, built on the yaml.Node helpers behind UpdateYAMLNode.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// UpdateFrontmatter changes the frontmatter of content through its yaml.Node tree, as
+// UpdateYAMLNode does for a file, and returns the new content. Only the bytes between
+// the delimiters are replaced: the body, the delimiters, and the line endings are kept
+// exactly, and so are the comments, key order, and untouched lines of the frontmatter.
+// fn gets the document node; without frontmatter it gets an empty mapping, and the
+// result gains a frontmatter block unless the mapping is still empty. If fn returns an
+// error, or changes nothing, content is returned unchanged with the error. Malformed
+// frontmatter returns a *YAMLError whose line counts from the top of content; TOML or
+// JSON frontmatter, and mismatched fences (see FenceError), return an error too.
+func UpdateFrontmatter(content string, fn func(node *yaml.Node) error) (string, error) {
+	return updateFrontmatter("", content, fn)
+}
+
+// UpdateFrontmatterFile runs UpdateFrontmatter on the markdown file at path under
+// WithLock on its directory, writing the result atomically if it changed. A missing
+// file is treated as empty, and created if fn adds metadata.
+func UpdateFrontmatterFile(path string, fn func(node *yaml.Node) error) error {
+	return WithLock(filepath.Dir(path), func() error {
+		data, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		content, err := updateFrontmatter(path, string(data), fn)
+		if err != nil || content == string(data) {
+			return err
+		}
+		return AtomicWrite(path, []byte(content))
+	})
+}
+
+func updateFrontmatter(path, content string, fn func(node *yaml.Node) error) (string, error) {
+	fm, fenceErr := scanFrontmatter(content)
+	if fenceErr != nil {
+		fenceErr.Path = path
+		return content, fenceErr
+	}
+	if fm.format == FormatTOML || fm.format == FormatJSON {
+		return content, notYAMLFrontmatterError(path, fm.format)
+	}
+	found := fm.format == FormatYAML
+	var src []byte
+	line := 1
+	if found {
+		if size, limit := int64(fm.metaEnd-fm.metaStart), currentMaxYAMLSize(); size > limit {
+			return content, &FileTooLargeError{Path: path, Size: size, Limit: limit, Frontmatter: true}
+		}
+		line = fm.line
+		if yamlText := normalizeNewlines(content[fm.metaStart:fm.metaEnd]); yamlText != "" {
+			src = []byte(yamlText + "\n")
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return content, newYAMLError(path, err, line)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	indent := detectYAMLIndent(src)
+	before, err := encodeYAMLNode(&doc, indent)
+	if err != nil {
+		return content, err
+	}
+	if err := fn(&doc); err != nil {
+		return content, err
+	}
+	after, err := encodeYAMLNode(&doc, indent)
+	if err != nil {
+		return content, err
+	}
+	if bytes.Equal(before, after) {
+		return content, nil
+	}
+
+	yamlText := strings.TrimSuffix(string(keepYAMLFormatting(src, before, after)), "\n")
+	if strings.TrimSpace(yamlText) == "{}" && len(bytes.TrimSpace(src)) == 0 {
+		return content, nil // nothing to add
+	}
+	nl := "\n"
+	if (found && strings.HasSuffix(content[:fm.metaStart], "\r\n")) || (!found && strings.Contains(content, "\r\n")) {
+		nl = "\r\n"
+		yamlText = strings.ReplaceAll(yamlText, "\n", "\r\n")
+	}
+
+	// Splice the new block over the old one's span (see FrontmatterSpan).
+	start, end := fm.start, fm.bodyStart
+	var block string
+	if found {
+		if rest := content[fm.metaEnd:]; !strings.HasPrefix(rest, "\n") && !strings.HasPrefix(rest, "\r") {
+			yamlText += nl // the closing delimiter directly follows the opening one
+		}
+		// The fences stay exactly as they were.
+		block = content[fm.start:fm.metaStart] + yamlText + content[fm.metaEnd:fm.bodyStart]
+	} else {
+		// A new block goes after any byte order mark, which stays first.
+		start = len(content) - len(strings.TrimPrefix(content, utf8BOM))
+		end = start
+		block = "---" + nl + yamlText + nl + "---" + nl
+	}
+	return content[:start] + block + content[end:], nil
+}
+
+// notYAMLFrontmatterError reports frontmatter, in the file at path if known, that
+// can't be edited because it's in another format.
+func notYAMLFrontmatterError(path string, format Format) error {
+	if path != "" {
+		path += ": "
+	}
+	return fmt.Errorf("mdstore: %sfrontmatter is %s; only YAML frontmatter can be edited", path, strings.ToUpper(format.String()))
+}
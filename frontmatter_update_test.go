@@ -0,0 +1,135 @@
+// ABOUTME: Tests for UpdateFrontmatter and UpdateFrontmatterFile: untouched bodies, comments, CRLF, and new blocks.
+// ABOUTME: Bumps an "updated" field the way a bot would and checks that nothing else in the document moves.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// bumpUpdated sets the "updated" field, as a bot keeping documents current would.
+func bumpUpdated(node *yaml.Node) error {
+	return SetYAMLPath(node, "updated", "2026-03-01")
+}
+
+func TestUpdateFrontmatter(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{
+			name: "keeps body and comments",
+			content: "---\n# Post metadata\ntitle: Hello # the title\nupdated: '2026-01-01'\n\ntags: [b, a]\n---\n" +
+				"Body with trailing spaces   \n\n\n  and no final newline",
+			want: "---\n# Post metadata\ntitle: Hello # the title\nupdated: '2026-03-01'\n\ntags: [b, a]\n---\n" +
+				"Body with trailing spaces   \n\n\n  and no final newline",
+		},
+		{
+			name:    "adds a key",
+			content: "---\ntitle: Hello\n---\n\n# Hello\n",
+			want:    "---\ntitle: Hello\nupdated: \"2026-03-01\"\n---\n\n# Hello\n",
+		},
+		{
+			name:    "crlf",
+			content: "---\r\ntitle: Hello\r\nupdated: x\r\n---\r\nBody\r\n",
+			want:    "---\r\ntitle: Hello\r\nupdated: \"2026-03-01\"\r\n---\r\nBody\r\n",
+		},
+		{
+			name:    "no frontmatter",
+			content: "# Just a body\n",
+			want:    "---\nupdated: \"2026-03-01\"\n---\n# Just a body\n",
+		},
+		{
+			name:    "no frontmatter, crlf",
+			content: "# Just a body\r\n",
+			want:    "---\r\nupdated: \"2026-03-01\"\r\n---\r\n# Just a body\r\n",
+		},
+		{
+			name:    "empty frontmatter",
+			content: "---\n\n---\nBody",
+			want:    "---\nupdated: \"2026-03-01\"\n---\nBody",
+		},
+		{
+			name:    "empty frontmatter, no blank line",
+			content: "---\n---\nBody",
+			want:    "---\nupdated: \"2026-03-01\"\n---\nBody",
+		},
+		{
+			name:    "dashes in a block scalar",
+			content: "---\nsummary: |\n  Intro\n  ---\n  More\n---\nBody",
+			want:    "---\nsummary: |\n  Intro\n  ---\n  More\nupdated: \"2026-03-01\"\n---\nBody",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := UpdateFrontmatter(tc.content, bumpUpdated)
+			if err != nil {
+				t.Fatalf("UpdateFrontmatter failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateFrontmatter_Unchanged(t *testing.T) {
+	noop := func(*yaml.Node) error { return nil }
+	for _, content := range []string{
+		"",
+		"# Just a body",
+		"---\ntitle:    Hello\n---\n  Body  ",
+	} {
+		if got, err := UpdateFrontmatter(content, noop); err != nil || got != content {
+			t.Errorf("no-op on %q gave %q, %v", content, got, err)
+		}
+	}
+
+	errAbort := errors.New("abort")
+	content := "---\ntitle: Hello\n---\nBody\n"
+	got, err := UpdateFrontmatter(content, func(node *yaml.Node) error {
+		_ = SetYAMLPath(node, "title", "changed")
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) || got != content {
+		t.Errorf("failed update gave %q, %v", got, err)
+	}
+
+	// Errors point into the document, as DecodeFrontmatter's do.
+	bad := "\n---\ntitle: Hello\ntags: [broken\n---\nBody\n"
+	var meta map[string]interface{}
+	_, decodeErr := DecodeFrontmatter("", bad, &meta)
+	got, err = UpdateFrontmatter(bad, bumpUpdated)
+	if e := asYAMLError(t, err); e.Line != asYAMLError(t, decodeErr).Line || got != bad {
+		t.Errorf("malformed frontmatter: %v (decode: %v), %q", err, decodeErr, got)
+	}
+}
+
+func TestUpdateFrontmatterFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "post.md")
+	writeFileString(t, path, "---\ntitle: Hello # keep\n---\nBody without newline")
+
+	if err := UpdateFrontmatterFile(path, bumpUpdated); err != nil {
+		t.Fatalf("UpdateFrontmatterFile failed: %v", err)
+	}
+	if got := readFileString(t, path); got != "---\ntitle: Hello # keep\nupdated: \"2026-03-01\"\n---\nBody without newline" {
+		t.Errorf("file holds %q", got)
+	}
+
+	missing := filepath.Join(dir, "new.md")
+	if err := UpdateFrontmatterFile(missing, func(*yaml.Node) error { return nil }); err != nil {
+		t.Fatalf("no-op on a missing file: %v", err)
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a no-op update created the file: %v", err)
+	}
+	if err := UpdateFrontmatterFile(missing, bumpUpdated); err != nil {
+		t.Fatalf("UpdateFrontmatterFile failed: %v", err)
+	}
+	if got := readFileString(t, missing); got != "---\nupdated: \"2026-03-01\"\n---\n" {
+		t.Errorf("new file holds %q", got)
+	}
+}
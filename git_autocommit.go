@@ -0,0 +1,355 @@
+// ABOUTME: Automatic git commits of the files written under a store root, batched and made in the background.
+// ABOUTME: Provides EnableGitAutoCommit, GitOptions, FlushGitAutoCommit, and DisableGitAutoCommit.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultGitMessage is the commit message GitOptions.Message defaults to.
+const DefaultGitMessage = "mdstore: update {{paths}}"
+
+// defaultGitDelay is how long a root's writes must pause before they're committed.
+const defaultGitDelay = time.Second
+
+// defaultGitMaxDelayFactor is how many Delays GitOptions.MaxDelay defaults to.
+const defaultGitMaxDelayFactor = 10
+
+// GitOptions tunes EnableGitAutoCommit.
+type GitOptions struct {
+	// Message is the commit message, with {{name}} placeholders as templates have
+	// them (see NewFromTemplate): paths, the committed paths relative to the root,
+	// sorted and joined with ", "; count, how many there are; and date and datetime,
+	// the current time as templates have them. Default DefaultGitMessage.
+	Message string
+
+	// Delay is how long writes under the root must pause before they're committed, so
+	// a burst of them becomes one commit. Default one second.
+	Delay time.Duration
+
+	// MaxDelay is the longest a write waits to be committed, counted from the first
+	// write since the last commit, so writes that never pause are still committed.
+	// Default ten times Delay; it's never less than Delay.
+	MaxDelay time.Duration
+
+	// OnError, if set, is called, on the background goroutine, with each commit that
+	// fails; otherwise the failure is logged (see SetLogger) at Error level.
+	OnError func(err error)
+
+	// Git is the git executable. Default "git", found on the PATH.
+	Git string
+}
+
+// gitAutoCommit commits the files written under one root.
+type gitAutoCommit struct {
+	root string // canonical
+	opts GitOptions
+
+	mu      sync.Mutex
+	pending map[string]bool // paths relative to root, with forward slashes
+
+	kick  chan struct{}   // a write happened; buffered, so writers never wait
+	flush chan chan error // commit now, and reply
+	stop  chan chan error // commit now, reply, and exit
+	done  chan struct{}   // closed once run exits
+}
+
+var (
+	gitAutoCommitMu       sync.Mutex // serializes changes to currentGitAutoCommits
+	currentGitAutoCommits atomic.Pointer[[]*gitAutoCommit]
+)
+
+// EnableGitAutoCommit commits, with git, the files WriteYAML, WriteMarkdownFile (and
+// the Document methods that use it), and MoveDocument write or remove under root,
+// which must be in a git work tree. Once writes under root pause for opts.Delay, or
+// opts.MaxDelay after the first of them, whichever is sooner, the paths written since
+// the last commit are staged, with git add, and committed, with git commit, those
+// paths alone, so other changes staged in the repository are left as they are; paths
+// with nothing to commit are passed over, and without any, there's no commit. mdstore's own files, as DirFS leaves out, aren't committed.
+//
+// Commits are made on a goroutine of their own, so writes never wait for git, and a
+// commit that fails doesn't fail the write: it's passed to opts.OnError, or logged,
+// and its paths are kept for the next commit, made after the next write or flush.
+// If root isn't in a git work tree, or git can't be run, auto-commit is left off
+// and a warning logged (see SetLogger). Enabling a root again replaces its options,
+// committing what's pending first. The error is for a Message naming an unknown
+// variable.
+func EnableGitAutoCommit(root string, opts GitOptions) error {
+	if opts.Message == "" {
+		opts.Message = DefaultGitMessage
+	}
+	if opts.Delay <= 0 {
+		opts.Delay = defaultGitDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = defaultGitMaxDelayFactor * opts.Delay
+	}
+	opts.MaxDelay = max(opts.MaxDelay, opts.Delay)
+	if opts.Git == "" {
+		opts.Git = "git"
+	}
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(opts.Message, -1) {
+		if m[1] != "" && !slices.Contains([]string{"paths", "count", "date", "datetime"}, m[1]) {
+			return fmt.Errorf("mdstore: git auto-commit message: unknown variable %q", m[1])
+		}
+	}
+
+	g := &gitAutoCommit{
+		root:    canonicalPath(root),
+		opts:    opts,
+		pending: make(map[string]bool),
+		kick:    make(chan struct{}, 1),
+		flush:   make(chan chan error),
+		stop:    make(chan chan error),
+		done:    make(chan struct{}),
+	}
+	if out, err := g.git("rev-parse", "--is-inside-work-tree"); err != nil || strings.TrimSpace(out) != "true" {
+		if err == nil {
+			err = errors.New("not in a git work tree")
+		}
+		logf(slog.LevelWarn, "mdstore: git auto-commit disabled", slog.String("root", root), slog.String("error", err.Error()))
+		return nil
+	}
+
+	gitAutoCommitMu.Lock()
+	defer gitAutoCommitMu.Unlock()
+	var next []*gitAutoCommit
+	if p := currentGitAutoCommits.Load(); p != nil {
+		for _, old := range *p {
+			if old.root == g.root {
+				old.report(old.close())
+				continue
+			}
+			next = append(next, old)
+		}
+	}
+	next = append(next, g)
+	currentGitAutoCommits.Store(&next)
+	go g.run()
+	return nil
+}
+
+// FlushGitAutoCommit commits what's been written under root since the last commit
+// now, without waiting for the delay, and returns the error of that commit, if any,
+// rather than passing it to GitOptions.OnError. It does nothing for a root without
+// auto-commit.
+func FlushGitAutoCommit(root string) error {
+	g := findGitAutoCommit(canonicalPath(root))
+	if g == nil {
+		return nil
+	}
+	reply := make(chan error)
+	select {
+	case g.flush <- reply:
+		return <-reply
+	case <-g.done:
+		return nil
+	}
+}
+
+// DisableGitAutoCommit turns auto-commit off for root, committing what's pending
+// first, and returns that commit's error, if any.
+func DisableGitAutoCommit(root string) error {
+	root = canonicalPath(root)
+	gitAutoCommitMu.Lock()
+	defer gitAutoCommitMu.Unlock()
+	p := currentGitAutoCommits.Load()
+	if p == nil {
+		return nil
+	}
+	var err error
+	next := slices.DeleteFunc(slices.Clone(*p), func(g *gitAutoCommit) bool {
+		if g.root != root {
+			return false
+		}
+		err = g.close()
+		return true
+	})
+	if len(next) == 0 {
+		currentGitAutoCommits.Store(nil)
+	} else {
+		currentGitAutoCommits.Store(&next)
+	}
+	return err
+}
+
+// findGitAutoCommit returns the auto-commit of root, a canonical path, or nil.
+func findGitAutoCommit(root string) *gitAutoCommit {
+	if p := currentGitAutoCommits.Load(); p != nil {
+		for _, g := range *p {
+			if g.root == root {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// notifyGitWrite tells the auto-commits of the roots holding paths, just written or
+// removed, about them. It returns at once, without any when none are enabled.
+func notifyGitWrite(paths ...string) {
+	p := currentGitAutoCommits.Load()
+	if p == nil {
+		return
+	}
+	for _, path := range paths {
+		c := canonicalPath(path)
+		for _, g := range *p {
+			rel, err := filepath.Rel(g.root, c)
+			if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			if slices.ContainsFunc(strings.Split(rel, "/"), isInternalName) {
+				continue
+			}
+			g.mu.Lock()
+			g.pending[rel] = true
+			g.mu.Unlock()
+			select {
+			case g.kick <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// run commits g's writes once they pause for the delay, or the max delay after the
+// first of them, or when asked, until g is closed.
+func (g *gitAutoCommit) run() {
+	defer close(g.done)
+	// timer restarts with each write; deadline starts with the first since a commit.
+	var timer, deadline <-chan time.Time
+	for {
+		select {
+		case <-g.kick:
+			if deadline == nil {
+				deadline = after(g.opts.MaxDelay)
+			}
+			timer = after(g.opts.Delay)
+		case <-timer:
+			timer, deadline = nil, nil
+			g.report(g.commit())
+		case <-deadline:
+			timer, deadline = nil, nil
+			g.report(g.commit())
+		case reply := <-g.flush:
+			timer, deadline = nil, nil
+			reply <- g.commit()
+		case reply := <-g.stop:
+			reply <- g.commit()
+			return
+		}
+	}
+}
+
+// report passes err, a failed commit's error, to g's OnError, or logs it.
+func (g *gitAutoCommit) report(err error) {
+	switch {
+	case err == nil:
+	case g.opts.OnError != nil:
+		g.opts.OnError(err)
+	default:
+		logf(slog.LevelError, "mdstore: git auto-commit failed", slog.String("root", g.root), slog.String("error", err.Error()))
+	}
+}
+
+// close stops g's goroutine, committing what's pending, and returns that commit's
+// error.
+func (g *gitAutoCommit) close() error {
+	reply := make(chan error)
+	select {
+	case g.stop <- reply:
+		return <-reply
+	case <-g.done:
+		return nil
+	}
+}
+
+// commit stages and commits the paths pending in g, if any have changes. If it fails,
+// they're pending again, for the next commit.
+func (g *gitAutoCommit) commit() (err error) {
+	g.mu.Lock()
+	paths := slices.Sorted(maps.Keys(g.pending))
+	clear(g.pending)
+	g.mu.Unlock()
+	defer func() {
+		if err != nil {
+			g.mu.Lock()
+			for _, p := range paths {
+				g.pending[p] = true
+			}
+			g.mu.Unlock()
+		}
+	}()
+
+	// A path that's gone can only be staged if git tracks it: one written and then
+	// moved away before a commit never was.
+	var missing []string
+	for _, p := range paths {
+		if _, err := os.Lstat(filepath.Join(g.root, filepath.FromSlash(p))); errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 {
+		out, err := g.git(append([]string{"ls-files", "-z", "--"}, missing...)...)
+		if err != nil {
+			return err
+		}
+		tracked := strings.Split(out, "\x00")
+		paths = slices.DeleteFunc(paths, func(p string) bool {
+			return slices.Contains(missing, p) && !slices.Contains(tracked, p)
+		})
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	if _, err := g.git(append([]string{"add", "-A", "--"}, paths...)...); err != nil {
+		return err
+	}
+	out, err := g.git(append([]string{"diff", "--cached", "--name-only", "--relative", "-z", "--"}, paths...)...)
+	if err != nil || out == "" {
+		return err
+	}
+	changed := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	t := now()
+	msg := templatePlaceholder.ReplaceAllStringFunc(g.opts.Message, func(m string) string {
+		return fillPlaceholder(m, map[string]string{
+			"paths":    strings.Join(changed, ", "),
+			"count":    strconv.Itoa(len(changed)),
+			"date":     t.Format(time.DateOnly),
+			"datetime": FormatTime(t),
+		})
+	})
+	_, err = g.git(append([]string{"commit", "-q", "-m", msg, "--"}, changed...)...)
+	return err
+}
+
+// git runs git with args in g's root, returning its standard output. Paths are
+// taken literally, not as patterns.
+func (g *gitAutoCommit) git(args ...string) (string, error) {
+	cmd := exec.Command(g.opts.Git, args...)
+	cmd.Dir = g.root
+	cmd.Env = append(os.Environ(), "GIT_LITERAL_PATHSPECS=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("mdstore: git %s in %s: %w: %s", args[0], g.root, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
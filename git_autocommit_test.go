@@ -0,0 +1,295 @@
+// ABOUTME: Tests for EnableGitAutoCommit against real git repositories made in temp dirs.
+// ABOUTME: Covers batching a burst of writes, debouncing and MaxDelay on the fake clock, moves, failures and retries, and roots outside git.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// initGitRepo makes a git repository in a temp dir, isolated from the user's git
+// configuration, and returns its root.
+func initGitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, kv := range [][2]string{{"GIT_AUTHOR_NAME", "Ada"}, {"GIT_AUTHOR_EMAIL", "ada@example.com"}, {"GIT_COMMITTER_NAME", "Ada"}, {"GIT_COMMITTER_EMAIL", "ada@example.com"}} {
+		t.Setenv(kv[0], kv[1])
+	}
+	root := t.TempDir()
+	runGit(t, root, "init", "-q")
+	return root
+}
+
+// runGit runs git in root and returns its output, trimmed.
+func runGit(t *testing.T, root string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitCommits returns the subjects of root's commits, newest first.
+func gitCommits(t *testing.T, root string) []string {
+	t.Helper()
+	if runGit(t, root, "rev-list", "--all", "--count") == "0" {
+		return nil
+	}
+	return strings.Split(runGit(t, root, "log", "--format=%s"), "\n")
+}
+
+func enableGitAutoCommit(t *testing.T, root string, opts GitOptions) {
+	t.Helper()
+	if err := EnableGitAutoCommit(root, opts); err != nil {
+		t.Fatalf("EnableGitAutoCommit failed: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := DisableGitAutoCommit(root); err != nil {
+			t.Errorf("DisableGitAutoCommit failed: %v", err)
+		}
+	})
+}
+
+func TestGitAutoCommit_Burst(t *testing.T) {
+	root := initGitRepo(t)
+	writeFileString(t, filepath.Join(root, "untracked.txt"), "not mdstore's")
+	enableGitAutoCommit(t, root, GitOptions{Message: "notes: {{count}} files: {{paths}}", Delay: time.Hour})
+
+	if err := WriteMarkdownFile(filepath.Join(root, "a.md"), map[string]string{"title": "A"}, "Body\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteMarkdownFile(filepath.Join(root, "notes", "b.md"), map[string]string{"title": "B"}, "Body\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteYAML(filepath.Join(root, "config.yaml"), testItem{Name: "x", Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildBacklinks(root); err != nil {
+		t.Fatal(err)
+	}
+	if got := gitCommits(t, root); got != nil {
+		t.Fatalf("committed before the delay: %q", got)
+	}
+
+	if err := FlushGitAutoCommit(root); err != nil {
+		t.Fatalf("FlushGitAutoCommit failed: %v", err)
+	}
+	if got, want := gitCommits(t, root), []string{"notes: 3 files: a.md, config.yaml, notes/b.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commits = %q, want %q", got, want)
+	}
+	if got, want := runGit(t, root, "ls-files"), "a.md\nconfig.yaml\nnotes/b.md"; got != want {
+		t.Errorf("tracked:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Writing what's already committed, or nothing, makes no commit.
+	if err := WriteYAML(filepath.Join(root, "config.yaml"), testItem{Name: "x", Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := FlushGitAutoCommit(root); err != nil {
+		t.Fatalf("FlushGitAutoCommit failed: %v", err)
+	}
+	if err := FlushGitAutoCommit(root); err != nil {
+		t.Fatalf("FlushGitAutoCommit failed: %v", err)
+	}
+	if got := gitCommits(t, root); len(got) != 1 {
+		t.Errorf("commits = %q, want one", got)
+	}
+}
+
+func TestGitAutoCommit_Debounce(t *testing.T) {
+	root := initGitRepo(t)
+	clk := useClock(t)
+	errs := make(chan error, 10)
+	enableGitAutoCommit(t, root, GitOptions{Delay: time.Second, OnError: func(err error) { errs <- err }})
+
+	// Each write puts the commit off for another Delay. The first also arms MaxDelay.
+	if err := WriteYAML(filepath.Join(root, "a.yaml"), testItem{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for clk.Waiters() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(900 * time.Millisecond)
+	if err := WriteYAML(filepath.Join(root, "b.yaml"), testItem{Name: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	for clk.Waiters() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(200 * time.Millisecond)
+	if got := gitCommits(t, root); got != nil {
+		t.Fatalf("committed before the writes paused: %q", got)
+	}
+
+	clk.Advance(800 * time.Millisecond)
+	var got []string
+	for deadline := time.Now().Add(10 * time.Second); got == nil && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		got = gitCommits(t, root)
+	}
+	if want := []string{"mdstore: update a.yaml, b.yaml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commits = %q, want %q", got, want)
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("OnError: %v", err)
+	default:
+	}
+}
+
+func TestGitAutoCommit_MaxDelay(t *testing.T) {
+	root := initGitRepo(t)
+	clk := useClock(t)
+	enableGitAutoCommit(t, root, GitOptions{Delay: time.Second, MaxDelay: 3 * time.Second})
+
+	// Writes every half Delay never pause, but are committed MaxDelay after the first.
+	names := []string{"a.yaml", "b.yaml", "c.yaml", "d.yaml", "e.yaml", "f.yaml"}
+	for i, name := range names {
+		if err := WriteYAML(filepath.Join(root, name), testItem{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+		// The MaxDelay deadline, this write's Delay, and, after the first, the last one's.
+		for clk.Waiters() < min(i+2, 3) {
+			time.Sleep(time.Millisecond)
+		}
+		if got := gitCommits(t, root); got != nil {
+			t.Fatalf("committed before MaxDelay: %q", got)
+		}
+		clk.Advance(500 * time.Millisecond)
+	}
+
+	var got []string
+	for deadline := time.Now().Add(10 * time.Second); got == nil && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		got = gitCommits(t, root)
+	}
+	if want := []string{"mdstore: update " + strings.Join(names, ", ")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commits = %q, want %q", got, want)
+	}
+}
+
+func TestGitAutoCommit_Move(t *testing.T) {
+	root := initGitRepo(t)
+	enableGitAutoCommit(t, root, GitOptions{Delay: time.Hour})
+	if err := WriteMarkdownFile(filepath.Join(root, "drafts", "post.md"), map[string]string{"title": "Post"}, "![i](img.png)\n"); err != nil {
+		t.Fatal(err)
+	}
+	writeFileString(t, filepath.Join(root, "drafts", "img.png"), "png")
+	runGit(t, root, "add", "drafts/img.png")
+	if err := FlushGitAutoCommit(root); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MoveDocument(filepath.Join(root, "drafts", "post.md"), filepath.Join(root, "posts", "post.md"), MoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Written and moved on before a commit: never tracked, so only the new path counts.
+	if err := WriteYAML(filepath.Join(root, "tmp.yaml"), testItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MoveDocument(filepath.Join(root, "posts", "post.md"), filepath.Join(root, "posts", "final.md"), MoveOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := FlushGitAutoCommit(root); err != nil {
+		t.Fatalf("FlushGitAutoCommit failed: %v", err)
+	}
+	if got, want := runGit(t, root, "ls-files"), "posts/final.md\nposts/img.png\ntmp.yaml"; got != want {
+		t.Errorf("tracked:\n%s\nwant:\n%s", got, want)
+	}
+	if got := gitCommits(t, root); len(got) != 2 {
+		t.Errorf("commits = %q, want two", got)
+	}
+}
+
+func TestGitAutoCommit_Errors(t *testing.T) {
+	root := initGitRepo(t)
+	if err := EnableGitAutoCommit(root, GitOptions{Message: "{{nope}}"}); err == nil {
+		t.Error("an unknown message variable should fail")
+	}
+
+	// A hook refusing the commit fails it, but not the write.
+	writeFileString(t, filepath.Join(root, ".git", "hooks", "pre-commit"), "#!/bin/sh\nexit 1\n")
+	if err := os.Chmod(filepath.Join(root, ".git", "hooks", "pre-commit"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 10)
+	enableGitAutoCommit(t, root, GitOptions{Delay: 10 * time.Millisecond, OnError: func(err error) { errs <- err }})
+	if err := WriteYAML(filepath.Join(root, "a.yaml"), testItem{Name: "a"}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	select {
+	case err := <-errs:
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || !strings.Contains(err.Error(), "git commit") {
+			t.Errorf("OnError got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("OnError not called")
+	}
+
+	if err := WriteYAML(filepath.Join(root, "b.yaml"), testItem{Name: "b"}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := FlushGitAutoCommit(root); err == nil {
+		// The delay may have passed first, sending the error to OnError instead.
+		select {
+		case <-errs:
+		case <-time.After(10 * time.Second):
+			t.Error("FlushGitAutoCommit: the failure went nowhere")
+		}
+	}
+	if got := gitCommits(t, root); got != nil {
+		t.Errorf("commits = %q", got)
+	}
+
+	// The failed commits' paths are kept, and committed once git lets them be.
+	if err := os.Remove(filepath.Join(root, ".git", "hooks", "pre-commit")); err != nil {
+		t.Fatal(err)
+	}
+	if err := FlushGitAutoCommit(root); err != nil {
+		t.Fatalf("FlushGitAutoCommit failed: %v", err)
+	}
+	if got, want := gitCommits(t, root), []string{"mdstore: update a.yaml, b.yaml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commits = %q, want %q", got, want)
+	}
+}
+
+func TestGitAutoCommit_NotARepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	t.Setenv("GIT_CEILING_DIRECTORIES", os.TempDir())
+	root := t.TempDir()
+	logs := captureLogs(t)
+
+	if err := EnableGitAutoCommit(root, GitOptions{}); err != nil {
+		t.Fatalf("EnableGitAutoCommit failed: %v", err)
+	}
+	recs := logs.records(t)
+	if len(recs) != 1 || recs[0]["msg"] != "mdstore: git auto-commit disabled" || recs[0]["level"] != "WARN" {
+		t.Errorf("logged %v, want one warning", recs)
+	}
+	if err := WriteYAML(filepath.Join(root, "a.yaml"), testItem{Name: "a"}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := FlushGitAutoCommit(root); err != nil {
+		t.Errorf("FlushGitAutoCommit: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".git")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf(".git made: %v", err)
+	}
+	if err := EnableGitAutoCommit(root, GitOptions{Git: filepath.Join(root, "no-such-git")}); err != nil {
+		t.Errorf("missing git: %v", err)
+	}
+}
@@ -1,5 +1,11 @@
 module github.com/harperreed/mdstore
 
-go 1.24
+go 1.24.0
 
 require gopkg.in/yaml.v3 v3.0.1
+
+require golang.org/x/sys v0.41.0
+
+require golang.org/x/crypto v0.48.0
+
+require github.com/BurntSushi/toml v1.6.0
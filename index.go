@@ -0,0 +1,246 @@
+// ABOUTME: A persisted index of the frontmatter of markdown files under a directory, for lookups without opening every file.
+// ABOUTME: Provides Index, IndexEntry, BuildIndex(Opts), WriteIndex, LoadIndex, and the Refresh and ByField methods.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Index maps the markdown files under a directory to a few of their frontmatter
+// fields, so a slug, title, or tag can be looked up without opening every file. It's
+// plain data, written and read as YAML with WriteIndex and LoadIndex.
+type Index struct {
+	Fields  []string      `yaml:"fields"`            // the dotted paths (see GetYAMLValue) indexed
+	Stats   *StatsOptions `yaml:"stats,omitempty"`   // if set, each entry has its body's Stats
+	Cascade bool          `yaml:"cascade,omitempty"` // if set, fields include cascaded defaults
+	Entries []IndexEntry  `yaml:"entries"`           // one per file, sorted by Path
+
+	// Workers is the number of files Refresh reads at once; if 0, runtime.GOMAXPROCS.
+	// It isn't written with the index.
+	Workers int `yaml:"-"`
+}
+
+// IndexOptions controls BuildIndexOpts.
+type IndexOptions struct {
+	// Stats, if set, has each entry store its body's Stats, computed with these options
+	// (see BodyStatsOpts). The whole of each file is read, rather than its frontmatter.
+	Stats *StatsOptions
+
+	// Cascade indexes each file's fields with the defaults of the directories above it
+	// merged under them, as ResolveMetadata merges them, with the indexed directory as
+	// the root.
+	Cascade bool
+
+	// Workers is the number of files read at once; if 0, runtime.GOMAXPROCS. The
+	// index is the same however many there are.
+	Workers int
+}
+
+// IndexEntry is one file of an Index.
+type IndexEntry struct {
+	Path    string                 `yaml:"path"`  // relative to the indexed directory, with forward slashes
+	ModTime time.Time              `yaml:"mtime"` // the file's modification time when it was read
+	Size    int64                  `yaml:"size"`  // the file's size when it was read
+	Fields  map[string]interface{} `yaml:"fields,omitempty"`
+	Stats   *Stats                 `yaml:"stats,omitempty"` // with Index.Stats set
+
+	// Defaults is the latest modification time of the defaults files cascaded into
+	// Fields, with Index.Cascade set, when they were read; zero if there were none.
+	Defaults time.Time `yaml:"defaults,omitempty"`
+}
+
+// BuildIndex reads the frontmatter of every markdown (*.md) file under root with
+// ReadFrontmatter, so only as far as the end of each file's frontmatter, and indexes
+// the named fields, by dotted path, of each. Files are found as TransformYAMLDir finds
+// them, skipping hidden files and directories. Files without frontmatter, or without
+// some of the fields, are indexed with what they have. Files are read on a pool of
+// runtime.GOMAXPROCS workers, fed by the walk as it goes (see IndexOptions.Workers). A
+// file that can't be read is left out, and its error joined, in order of path, into
+// the one returned with the rest of the index.
+func BuildIndex(root string, fields []string) (Index, error) {
+	return BuildIndexOpts(root, fields, IndexOptions{})
+}
+
+// BuildIndexOpts is BuildIndex with options.
+func BuildIndexOpts(root string, fields []string, opts IndexOptions) (Index, error) {
+	idx := Index{Fields: slices.Clone(fields), Stats: opts.Stats, Cascade: opts.Cascade, Workers: opts.Workers}
+	err := idx.Refresh(root)
+	return idx, err
+}
+
+// Refresh brings idx up to date with the markdown files under root, as BuildIndex
+// would build it, reading only the files that are new or whose size or modification
+// time differ from their entries'. A file changed without either changing, within the
+// file system's timestamp resolution, keeps its old entry. So does an entry whose
+// stats were computed with other options; set idx.Stats before building, or clear
+// idx.Entries when changing it. With idx.Cascade, a file is read again, too, when the
+// latest modification time of its defaults files differs from its entry's. Errors are
+// as for BuildIndex; if root can't be walked, idx is left as it was.
+func (idx *Index) Refresh(root string) error {
+	known := make(map[string]IndexEntry, len(idx.Entries))
+	for _, entry := range idx.Entries {
+		known[entry.Path] = entry
+	}
+
+	// Files are read on idx.Workers goroutines, each result kept at the file's place
+	// in the walk, so the entries and errors come out in the same order however the
+	// reads are scheduled.
+	var mu sync.Mutex
+	var entries []*IndexEntry
+	var errs []error
+	record := func(i int, entry *IndexEntry, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		for len(entries) <= i {
+			entries, errs = append(entries, nil), append(errs, nil)
+		}
+		entries[i], errs[i] = entry, err
+	}
+	var cascaded sync.Map // each directory's cascadeModTime, once read
+	err := walkGlobWorkers(root, "*.md", idx.Workers, nil, func(i int, path string, d fs.DirEntry) {
+		entry, err := idx.refreshEntry(root, path, d, known, &cascaded)
+		record(i, entry, err)
+	})
+	if err != nil {
+		return err
+	}
+
+	kept := make([]IndexEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry != nil {
+			kept = append(kept, *entry)
+		}
+	}
+	slices.SortFunc(kept, func(a, b IndexEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	idx.Entries = kept
+	return errors.Join(errs...)
+}
+
+// refreshEntry returns the entry for the file at path, under root, for Refresh: its
+// entry in known, if it's unchanged, or else one read from the file. cascaded caches
+// the cascadeModTime of each directory.
+func (idx *Index) refreshEntry(root, path string, d fs.DirEntry, known map[string]IndexEntry, cascaded *sync.Map) (*IndexEntry, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+	rel = filepath.ToSlash(rel)
+	var defaults time.Time
+	if idx.Cascade {
+		if cached, ok := cascaded.Load(filepath.Dir(path)); ok {
+			defaults = cached.(time.Time)
+		} else {
+			if defaults, err = cascadeModTime(root, path); err != nil {
+				return nil, err
+			}
+			cascaded.Store(filepath.Dir(path), defaults)
+		}
+	}
+	if entry, ok := known[rel]; ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) && (idx.Stats == nil || entry.Stats != nil) && entry.Defaults.Equal(defaults) {
+		return &entry, nil
+	}
+
+	entry := IndexEntry{Path: rel, ModTime: info.ModTime().UTC(), Size: info.Size(), Defaults: defaults}
+	meta, stats, err := readIndexFile(path, idx.Stats)
+	if err == nil && idx.Cascade {
+		meta, err = ResolveMetadata(root, path, meta)
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry.Stats = stats
+	for _, field := range idx.Fields {
+		if v, ok := lookupMetaPath(meta, splitYAMLPath(field)); ok {
+			if entry.Fields == nil {
+				entry.Fields = make(map[string]interface{}, len(idx.Fields))
+			}
+			entry.Fields[field] = v
+		}
+	}
+	return &entry, nil
+}
+
+// ByField returns the paths, relative to the indexed directory, of the files whose
+// field, one of idx.Fields, is value, or is a list holding value. Values are compared
+// as fmt.Sprint writes them, so a weight of 2 matches "2".
+func (idx *Index) ByField(field, value string) []string {
+	var paths []string
+	for _, entry := range idx.Entries {
+		v, ok := entry.Fields[field]
+		if !ok {
+			continue
+		}
+		if list, isList := v.([]interface{}); isList {
+			if slices.ContainsFunc(list, func(item interface{}) bool { return fmt.Sprint(item) == value }) {
+				paths = append(paths, entry.Path)
+			}
+		} else if fmt.Sprint(v) == value {
+			paths = append(paths, entry.Path)
+		}
+	}
+	return paths
+}
+
+// WriteIndex writes idx to the YAML file at path, atomically, under WithLock on
+// path's directory.
+func WriteIndex(path string, idx Index) error {
+	return WithLock(filepath.Dir(path), func() error {
+		return WriteYAML(path, idx)
+	})
+}
+
+// LoadIndex reads an Index written by WriteIndex. A missing file returns a
+// *NotFoundError, which matches fs.ErrNotExist.
+func LoadIndex(path string) (Index, error) {
+	var idx Index
+	err := ReadYAMLStrict(path, &idx)
+	return idx, err
+}
+
+// readIndexFile reads the frontmatter of the markdown file at path, and with
+// statsOpts set, the stats of its body, reading the whole file only then.
+func readIndexFile(path string, statsOpts *StatsOptions) (map[string]interface{}, *Stats, error) {
+	if statsOpts == nil {
+		meta, _, err := ReadFrontmatter[map[string]interface{}](path)
+		return meta, nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var meta map[string]interface{}
+	if _, err := DecodeFrontmatter(path, string(data), &meta); err != nil {
+		return nil, nil, err
+	}
+	stats := BodyStatsOpts(string(data), *statsOpts)
+	return meta, &stats, nil
+}
+
+// lookupMetaPath returns the value at keys in decoded frontmatter.
+func lookupMetaPath(meta map[string]interface{}, keys []string) (interface{}, bool) {
+	var v interface{} = meta
+	for _, key := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,27 @@
+// ABOUTME: Benchmarks for BuildIndex over a generated store of a few thousand posts, by number of workers.
+// ABOUTME: Shows how the worker pool scales the per-file open and frontmatter decode that dominate a build.
+package mdstore
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func BenchmarkBuildIndex(b *testing.B) {
+	root := writeSearchBenchStore(b, 4000)
+	counts := []int{1, 2, 4, 8}
+	if n := runtime.GOMAXPROCS(0); !slices.Contains(counts, n) {
+		counts = append(counts, n)
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := BuildIndexOpts(root, []string{"title", "tags", "date"}, IndexOptions{Workers: workers}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
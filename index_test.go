@@ -0,0 +1,223 @@
+// ABOUTME: Tests for the frontmatter Index: building, lookups by field, persistence, and incremental refreshes.
+// ABOUTME: Refreshes are checked as files are added, changed, and deleted, and for skipping unchanged files.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeIndexTree writes markdown files under a temp dir and returns its root.
+func writeIndexTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		writeIndexFile(t, root, name, content)
+	}
+	return root
+}
+
+func writeIndexFile(t *testing.T, root, name, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+	writeFileString(t, path, content)
+}
+
+func TestBuildIndex(t *testing.T) {
+	root := writeIndexTree(t, map[string]string{
+		"hello.md":         "---\nslug: hello\ntitle: Hello\ntags: [golang, yaml]\nauthor:\n  name: Ada\n---\n# Hello\n",
+		"posts/second.md":  "+++\nslug = \"second\"\ntitle = \"Second\"\ntags = [\"golang\"]\n+++\n",
+		"posts/no-meta.md": "# Just a body\n",
+		"notes.txt":        "---\nslug: not-markdown\n---\n",
+		".drafts/d.md":     "---\nslug: hidden\n---\n",
+	})
+
+	idx, err := BuildIndex(root, []string{"slug", "title", "tags", "author.name"})
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+	var paths []string
+	for _, entry := range idx.Entries {
+		paths = append(paths, entry.Path)
+	}
+	if want := []string{"hello.md", "posts/no-meta.md", "posts/second.md"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("indexed %v, want %v", paths, want)
+	}
+
+	hello := idx.Entries[0]
+	info, err := os.Stat(filepath.Join(root, "hello.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hello.ModTime.Equal(info.ModTime()) || hello.Size != info.Size() {
+		t.Errorf("hello.md: mtime %v, size %d; want %v, %d", hello.ModTime, hello.Size, info.ModTime(), info.Size())
+	}
+	want := map[string]interface{}{"slug": "hello", "title": "Hello", "tags": []interface{}{"golang", "yaml"}, "author.name": "Ada"}
+	if !reflect.DeepEqual(hello.Fields, want) {
+		t.Errorf("hello.md fields = %v, want %v", hello.Fields, want)
+	}
+	if idx.Entries[1].Fields != nil {
+		t.Errorf("no-meta.md fields = %v", idx.Entries[1].Fields)
+	}
+
+	for _, tc := range []struct {
+		field, value string
+		want         []string
+	}{
+		{"tags", "golang", []string{"hello.md", "posts/second.md"}},
+		{"tags", "yaml", []string{"hello.md"}},
+		{"slug", "second", []string{"posts/second.md"}},
+		{"author.name", "Ada", []string{"hello.md"}},
+		{"slug", "missing", nil},
+		{"draft", "true", nil},
+	} {
+		if got := idx.ByField(tc.field, tc.value); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ByField(%q, %q) = %v, want %v", tc.field, tc.value, got, tc.want)
+		}
+	}
+
+	if _, err := BuildIndex(filepath.Join(root, "missing"), nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing root: %v", err)
+	}
+}
+
+func TestBuildIndex_BadFile(t *testing.T) {
+	root := writeIndexTree(t, map[string]string{
+		"good.md": "---\nslug: good\n---\n",
+		"bad.md":  "---\nslug: [broken\n---\n",
+	})
+	idx, err := BuildIndex(root, []string{"slug"})
+	var yamlErr *YAMLError
+	if !errors.As(err, &yamlErr) || yamlErr.Path != filepath.Join(root, "bad.md") {
+		t.Fatalf("expected a *YAMLError for bad.md, got %v", err)
+	}
+	if len(idx.Entries) != 1 || idx.Entries[0].Path != "good.md" {
+		t.Errorf("got %+v", idx.Entries)
+	}
+
+	// Once fixed, the next refresh picks it up.
+	writeIndexFile(t, root, "bad.md", "---\nslug: fixed\n---\n")
+	if err := idx.Refresh(root); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if got := idx.ByField("slug", "fixed"); !reflect.DeepEqual(got, []string{"bad.md"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+// However many workers read the files, the index and its errors are the same.
+func TestBuildIndex_Workers(t *testing.T) {
+	files := make(map[string]string)
+	for i := range 200 {
+		name := fmt.Sprintf("%02d/post-%03d.md", i%7, i)
+		files[name] = fmt.Sprintf("---\nslug: post-%d\ntags: [t%d]\n---\nBody %d.\n", i, i%3, i)
+		if i%40 == 0 {
+			files[name] = "---\nslug: [broken\n---\n"
+		}
+	}
+	root := writeIndexTree(t, files)
+
+	want, wantErr := BuildIndexOpts(root, []string{"slug", "tags"}, IndexOptions{Workers: 1, Stats: &StatsOptions{}})
+	if wantErr == nil || len(want.Entries) != 195 {
+		t.Fatalf("sequential: %d entries, %v", len(want.Entries), wantErr)
+	}
+	for _, workers := range []int{0, 2, 8, 64} {
+		idx, err := BuildIndexOpts(root, []string{"slug", "tags"}, IndexOptions{Workers: workers, Stats: &StatsOptions{}})
+		if err == nil || err.Error() != wantErr.Error() {
+			t.Errorf("workers %d: err = %v, want %v", workers, err, wantErr)
+		}
+		if !reflect.DeepEqual(idx.Entries, want.Entries) {
+			t.Errorf("workers %d: entries differ", workers)
+		}
+
+		// Refreshing concurrently keeps unchanged entries and rereads the rest.
+		writeIndexFile(t, root, "00/post-000.md", "---\nslug: fixed\n---\n")
+		if err := idx.Refresh(root); err == nil || len(idx.Entries) != 196 || len(idx.ByField("slug", "fixed")) != 1 {
+			t.Errorf("workers %d: refresh gave %d entries, %v", workers, len(idx.Entries), err)
+		}
+		writeIndexFile(t, root, "00/post-000.md", files["00/post-000.md"])
+	}
+}
+
+func TestIndex_Refresh(t *testing.T) {
+	root := writeIndexTree(t, map[string]string{
+		"keep.md":   "---\nslug: keep\n---\n",
+		"change.md": "---\nslug: before\n---\n",
+		"delete.md": "---\nslug: delete\n---\n",
+	})
+	idx, err := BuildIndex(root, []string{"slug"})
+	if err != nil {
+		t.Fatalf("BuildIndex failed: %v", err)
+	}
+
+	// Round trip through the index file between refreshes, as a process would.
+	indexPath := filepath.Join(root, "index.yaml")
+	if err := WriteIndex(indexPath, idx); err != nil {
+		t.Fatalf("WriteIndex failed: %v", err)
+	}
+	loaded, err := LoadIndex(indexPath)
+	if err != nil {
+		t.Fatalf("LoadIndex failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Fields, idx.Fields) || len(loaded.Entries) != 3 {
+		t.Fatalf("loaded %+v", loaded)
+	}
+	for i := range loaded.Entries {
+		if !loaded.Entries[i].ModTime.Equal(idx.Entries[i].ModTime) {
+			t.Errorf("%s: mtime %v, want %v", loaded.Entries[i].Path, loaded.Entries[i].ModTime, idx.Entries[i].ModTime)
+		}
+	}
+
+	later := time.Now().Add(time.Hour)
+	writeIndexFile(t, root, "change.md", "---\nslug: after\n---\n")
+	if err := os.Chtimes(filepath.Join(root, "change.md"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "delete.md")); err != nil {
+		t.Fatal(err)
+	}
+	writeIndexFile(t, root, "sub/add.md", "---\nslug: add\n---\n")
+
+	// keep.md changes without its size or mtime changing, which Refresh can't see:
+	// its entry stays as it was, which shows it wasn't read again.
+	keep := filepath.Join(root, "keep.md")
+	info, err := os.Stat(keep)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFileString(t, keep, "---\nslug: kept\n---\n")
+	if err := os.Chtimes(keep, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loaded.Refresh(root); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	got := map[string]interface{}{}
+	for _, entry := range loaded.Entries {
+		got[entry.Path] = entry.Fields["slug"]
+	}
+	want := map[string]interface{}{"keep.md": "keep", "change.md": "after", "sub/add.md": "add"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after refresh: %v, want %v", got, want)
+	}
+	if paths := loaded.ByField("slug", "delete"); paths != nil {
+		t.Errorf("deleted file still indexed: %v", paths)
+	}
+	if !loaded.Entries[0].ModTime.Equal(later) {
+		t.Errorf("change.md mtime = %v, want %v", loaded.Entries[0].ModTime, later)
+	}
+
+	if _, err := LoadIndex(filepath.Join(root, "missing.yaml")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing index: %v", err)
+	}
+}
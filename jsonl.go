@@ -0,0 +1,148 @@
+// ABOUTME: JSON Lines (NDJSON) log files: one JSON record per line, for interop with jq and log pipelines.
+// ABOUTME: Provides AppendJSONL, ReadJSONL, ScanJSONL, RotateJSONL, and PartialLineError for crash-truncated tails.
+package mdstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrPartialLine matches (via errors.Is) any PartialLineError.
+var ErrPartialLine = errors.New("mdstore: partial JSONL line")
+
+// PartialLineError reports an unterminated, unparseable last line in a JSONL file,
+// typically left by a crash in the middle of an append. Every complete record before
+// it has already been delivered.
+type PartialLineError struct {
+	Path   string
+	Line   int   // 1-based line number of the partial line
+	Offset int64 // byte offset where the partial line starts
+	Data   []byte
+}
+
+func (e *PartialLineError) Error() string {
+	return fmt.Sprintf("mdstore: %s: partial line %d at offset %d (%d bytes)", e.Path, e.Line, e.Offset, len(e.Data))
+}
+
+// Is reports whether target is ErrPartialLine.
+func (e *PartialLineError) Is(target error) bool {
+	return target == ErrPartialLine
+}
+
+// AppendJSONL appends item to the JSONL file at path as one line, marshaled with
+// encoding/json and written with a single O_APPEND write under WithLock on path's
+// directory. Creates the file and its parent directories if needed.
+func AppendJSONL(path string, item interface{}) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return appendLocked(path, append(data, '\n'))
+}
+
+// ReadJSONL reads every record in the JSONL file at path.
+// Returns nil (not error) if the file doesn't exist, like ReadYAML. If the file ends in
+// a partial line, the complete records are returned along with a *PartialLineError.
+func ReadJSONL[T any](path string) ([]T, error) {
+	var items []T
+	err := ScanJSONL(path, func(raw json.RawMessage) error {
+		var item T
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return err
+		}
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// ScanJSONL calls fn with each record in the JSONL file at path, in order, without
+// holding the whole file in memory. Blank lines are skipped. A malformed line stops
+// the scan with an error naming it, as does the first error from fn. A final line
+// without a newline is delivered if it is valid JSON; otherwise it is reported as a
+// *PartialLineError after every complete record. A missing file is not an error.
+//
+// fn must not retain raw, which is reused between calls.
+func ScanJSONL(path string, fn func(json.RawMessage) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for line := 1; ; line++ {
+		data, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// Longer than the buffer; copy what we have before reading the rest.
+			head := append([]byte(nil), data...)
+			var rest []byte
+			rest, err = r.ReadBytes('\n')
+			data = append(head, rest...)
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		complete := err == nil
+		start := offset
+		offset += int64(len(data))
+
+		record := bytes.TrimSpace(data)
+		switch {
+		case len(record) == 0:
+		case !complete && !json.Valid(record):
+			return &PartialLineError{Path: path, Line: line, Offset: start, Data: append([]byte(nil), data...)}
+		case !json.Valid(record):
+			return fmt.Errorf("mdstore: %s: line %d: invalid JSON", path, line)
+		default:
+			if err := fn(record); err != nil {
+				return err
+			}
+		}
+		if !complete {
+			return nil
+		}
+	}
+}
+
+// RotateJSONL renames the JSONL file at path to a timestamped archive alongside it once
+// it has grown to maxBytes or more, so the next AppendJSONL starts a fresh file. The
+// archive of events.jsonl is named like events.2026-02-05T10-04-05.123456789Z.jsonl:
+// the time in UTC, to the nanosecond, so names sort in the order they were made, and
+// with dashes for colons, so they're valid on every platform.
+// Returns the archive's path, or "" if the file was missing or still under maxBytes.
+// Runs under WithLock on path's directory, so no append is lost mid-rotation.
+func RotateJSONL(path string, maxBytes int64) (string, error) {
+	var archive string
+	err := WithLock(filepath.Dir(path), func() error {
+		info, err := os.Stat(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info.Size() < maxBytes {
+			return nil
+		}
+
+		name := rotatedName(path)
+		if err := os.Rename(path, name); err != nil {
+			return err
+		}
+		archive = name
+		return nil
+	})
+	return archive, err
+}
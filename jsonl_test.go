@@ -0,0 +1,208 @@
+// ABOUTME: Tests for JSON Lines log files: appending, reading, scanning, and rotation.
+// ABOUTME: Covers concurrent appends, crash-truncated final lines, and malformed records.
+package mdstore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harperreed/mdstore/internal/clocktest"
+)
+
+type jsonlEvent struct {
+	Kind string `json:"kind"`
+	N    int    `json:"n"`
+}
+
+func TestAppendJSONL_ReadBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "events.jsonl")
+
+	for i := 0; i < 3; i++ {
+		if err := AppendJSONL(path, jsonlEvent{Kind: "tick", N: i}); err != nil {
+			t.Fatalf("AppendJSONL failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	want := "{\"kind\":\"tick\",\"n\":0}\n{\"kind\":\"tick\",\"n\":1}\n{\"kind\":\"tick\",\"n\":2}\n"
+	if string(data) != want {
+		t.Errorf("file content:\n%s\nwant:\n%s", data, want)
+	}
+
+	events, err := ReadJSONL[jsonlEvent](path)
+	if err != nil {
+		t.Fatalf("ReadJSONL failed: %v", err)
+	}
+	if len(events) != 3 || events[2].N != 2 {
+		t.Errorf("unexpected events: %+v", events)
+	}
+}
+
+func TestAppendJSONL_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := AppendJSONL(path, jsonlEvent{Kind: "tick", N: i}); err != nil {
+				t.Errorf("AppendJSONL failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	events, err := ReadJSONL[jsonlEvent](path)
+	if err != nil {
+		t.Fatalf("ReadJSONL failed: %v", err)
+	}
+	if len(events) != n {
+		t.Errorf("expected %d events, got %d", n, len(events))
+	}
+}
+
+func TestReadJSONL_MissingFile(t *testing.T) {
+	events, err := ReadJSONL[jsonlEvent](filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err != nil {
+		t.Fatalf("ReadJSONL should return nil for missing file, got: %v", err)
+	}
+	if events != nil {
+		t.Errorf("expected no events, got %v", events)
+	}
+}
+
+func TestScanJSONL_PartialFinalLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	content := "{\"kind\":\"a\",\"n\":1}\n\n{\"kind\":\"b\",\"n\":2}\n{\"kind\":\"c\",\"n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var kinds []string
+	err := ScanJSONL(path, func(raw json.RawMessage) error {
+		var e jsonlEvent
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		kinds = append(kinds, e.Kind)
+		return nil
+	})
+	if !errors.Is(err, ErrPartialLine) {
+		t.Fatalf("expected ErrPartialLine, got %v", err)
+	}
+	var partial *PartialLineError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected *PartialLineError, got %T", err)
+	}
+	if partial.Line != 4 || partial.Offset != int64(strings.LastIndex(content, "\n")+1) {
+		t.Errorf("partial line reported at line %d offset %d", partial.Line, partial.Offset)
+	}
+	if strings.Join(kinds, ",") != "a,b" {
+		t.Errorf("complete records should still be delivered, got %v", kinds)
+	}
+
+	events, err := ReadJSONL[jsonlEvent](path)
+	if !errors.Is(err, ErrPartialLine) || len(events) != 2 {
+		t.Errorf("ReadJSONL = %d events, %v; want 2 events and ErrPartialLine", len(events), err)
+	}
+}
+
+func TestScanJSONL_UnterminatedValidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte("{\"n\":1}\n{\"n\":2}"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	events, err := ReadJSONL[jsonlEvent](path)
+	if err != nil {
+		t.Fatalf("ReadJSONL failed: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected 2 events, got %d", len(events))
+	}
+}
+
+func TestScanJSONL_MalformedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	if err := os.WriteFile(path, []byte("{\"n\":1}\nnot json\n{\"n\":3}\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	_, err := ReadJSONL[jsonlEvent](path)
+	if err == nil || errors.Is(err, ErrPartialLine) || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error naming line 2, got %v", err)
+	}
+}
+
+func TestScanJSONL_LongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	long := strings.Repeat("x", 100_000)
+	if err := AppendJSONL(path, jsonlEvent{Kind: long}); err != nil {
+		t.Fatalf("AppendJSONL failed: %v", err)
+	}
+	if err := AppendJSONL(path, jsonlEvent{Kind: "short"}); err != nil {
+		t.Fatalf("AppendJSONL failed: %v", err)
+	}
+
+	events, err := ReadJSONL[jsonlEvent](path)
+	if err != nil {
+		t.Fatalf("ReadJSONL failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Kind != long || events[1].Kind != "short" {
+		t.Errorf("long line not read intact: %d events", len(events))
+	}
+}
+
+func TestRotateJSONL(t *testing.T) {
+	SetClock(clocktest.New(time.Date(2026, 2, 5, 10, 4, 5, 0, time.UTC)))
+	t.Cleanup(func() { SetClock(nil) })
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.jsonl")
+
+	if err := AppendJSONL(path, jsonlEvent{Kind: "a"}); err != nil {
+		t.Fatalf("AppendJSONL failed: %v", err)
+	}
+
+	archive, err := RotateJSONL(path, 1<<20)
+	if err != nil || archive != "" {
+		t.Fatalf("small file should not rotate: %q, %v", archive, err)
+	}
+
+	archive, err = RotateJSONL(path, 10)
+	if err != nil {
+		t.Fatalf("RotateJSONL failed: %v", err)
+	}
+	if want := filepath.Join(dir, "events.2026-02-05T10-04-05.000000000Z.jsonl"); archive != want {
+		t.Errorf("archive = %q, want %q", archive, want)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("original file should be gone after rotation")
+	}
+	archived, err := ReadJSONL[jsonlEvent](archive)
+	if err != nil || len(archived) != 1 {
+		t.Errorf("archive should hold the rotated record: %v, %v", archived, err)
+	}
+
+	if err := AppendJSONL(path, jsonlEvent{Kind: "b"}); err != nil {
+		t.Fatalf("AppendJSONL after rotation failed: %v", err)
+	}
+	events, err := ReadJSONL[jsonlEvent](path)
+	if err != nil || len(events) != 1 || events[0].Kind != "b" {
+		t.Errorf("new file should hold only the new record: %v, %v", events, err)
+	}
+
+	if archive, err := RotateJSONL(filepath.Join(dir, "missing.jsonl"), 10); err != nil || archive != "" {
+		t.Errorf("missing file should not rotate: %q, %v", archive, err)
+	}
+}
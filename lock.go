@@ -1,3 +1,225 @@
-// ABOUTME: Lock interface for serializing file writes.
-// ABOUTME: Declares WithLock; platform-specific implementations in lock_unix.go and lock_windows.go.
+// ABOUTME: Lock handle and WithLock variants for serializing file writes.
+// ABOUTME: Declares AcquireLock/Lock; platform-specific OS locking in lock_unix.go and lock_windows.go.
 package mdstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// errLockBusy is returned internally when a single non-blocking attempt finds the lock held.
+var errLockBusy = errors.New("mdstore: lock is busy")
+
+// Lock is a held exclusive lock on a directory, obtained from AcquireLock.
+// It must be released with Release once the critical section is over.
+type Lock struct {
+	dir  string
+	name string // empty for the whole-directory lock
+
+	// wait and acquired are only recorded when a lock observer is installed.
+	wait     time.Duration
+	acquired time.Time
+	queued   int // in-process waiters ahead of this acquisition
+
+	journal bool // run critical sections under a .inprogress marker (LockOptions.Journal)
+
+	mu     sync.Mutex
+	unlock func() error // nil once released
+}
+
+// AcquireLock acquires an exclusive file lock on <dir>/.lock and returns a handle.
+// Use it when the lock must outlive a single function call; otherwise prefer WithLock.
+// A handle that is garbage collected without Release is released (with a warning, see SetLogger).
+func AcquireLock(dir string) (*Lock, error) {
+	return acquireLock(context.Background(), dir, "", LockOptions{}, false)
+}
+
+// AcquireLockOpts is AcquireLock with explicit tuning, like WithLockOpts.
+func AcquireLockOpts(dir string, opts LockOptions) (*Lock, error) {
+	return acquireLock(context.Background(), dir, "", opts, false)
+}
+
+// acquireLock is the shared core of every lock entry point.
+// With try set it makes a single attempt and returns errLockBusy if the lock is held.
+// An empty name selects the whole-directory lock, otherwise the named lock (see WithNamedLock).
+// Acquisition goes through the Locker installed with SetLocker, if any.
+func acquireLock(ctx context.Context, dir, name string, opts LockOptions, try bool) (*Lock, error) {
+	if err := checkLockWritable(dir, name); err != nil {
+		return nil, err
+	}
+	if err := checkNotHeld(ctx, dir, name); err != nil {
+		return nil, err
+	}
+
+	p := newAcquireParams(ctx, opts, try)
+	p.dir = dir
+	stopWatch := watchSlowLock(dir, name, p.start)
+
+	var unlock func() error
+	var queued int
+	var err error
+	if lk := installedLocker(); lk != nil {
+		unlock, err = acquireViaLocker(lk, lockKey(dir, name), p)
+	} else {
+		unlock, queued, err = acquireFileLock(dir, name, p)
+	}
+	stopWatch()
+	if err != nil {
+		if obs := lockObserver(); obs != nil {
+			obs(LockEvent{Dir: dir, Name: name, Wait: since(p.start), Queued: queued, TimedOut: errors.Is(err, ErrLockTimeout)})
+		}
+		return nil, err
+	}
+
+	l := &Lock{dir: dir, name: name, queued: queued, journal: opts.Journal, unlock: unlock}
+	if lockObserver() != nil {
+		l.acquired = now()
+		l.wait = l.acquired.Sub(p.start)
+	}
+	runtime.SetFinalizer(l, (*Lock).finalize)
+	return l, nil
+}
+
+// acquireFileLock takes the built-in file lock on dir (or its named lock), after
+// shared locks on any lock roots containing dir (see SetLockRoots).
+func acquireFileLock(dir, name string, p acquireParams) (func() error, int, error) {
+	releaseRoots, err := acquireRootsShared(dir, p, false)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	unlock, queued, err := acquirePath(lockPathFor(dir, name), p)
+	if releaseRoots == nil {
+		return unlock, queued, err
+	}
+	if err != nil {
+		releaseRoots()
+		return nil, queued, err
+	}
+
+	return func() error {
+		err := unlock()
+		if rerr := releaseRoots(); err == nil {
+			err = rerr
+		}
+		return err
+	}, queued, nil
+}
+
+// Dir returns the directory the lock was acquired on.
+func (l *Lock) Dir() string {
+	return l.dir
+}
+
+// Release releases the lock. Calling Release more than once is a no-op.
+func (l *Lock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.unlock == nil {
+		return nil
+	}
+
+	unlock := l.unlock
+	l.unlock = nil
+	runtime.SetFinalizer(l, nil)
+	err := unlock()
+
+	// Report after unlocking so a slow observer never extends the hold time.
+	if obs := lockObserver(); obs != nil && !l.acquired.IsZero() {
+		obs(LockEvent{Dir: l.dir, Name: l.name, Wait: l.wait, Hold: since(l.acquired), Queued: l.queued, Acquired: true})
+	}
+
+	return err
+}
+
+// run executes fn and then releases the lock. The release is deferred so it also
+// happens if fn panics (or calls runtime.Goexit): a recovered panic in a critical
+// section never leaves the lock held or its lock file lingering.
+// In journal mode fn runs under the lock's .inprogress marker (see runJournaled).
+func (l *Lock) run(fn func() error) error {
+	defer l.Release()
+	if l.journal {
+		return runJournaled([]string{l.dir}, []string{inProgressPath(l.dir, l.name)}, fn)
+	}
+	return fn()
+}
+
+// finalize releases a leaked lock so it doesn't wedge the store forever.
+func (l *Lock) finalize() {
+	logf(slog.LevelWarn, "mdstore: lock garbage collected without Release; releasing", slog.String("dir", l.dir), slog.String("name", l.name))
+	_ = l.Release()
+}
+
+// WithLock acquires an exclusive file lock on <dir>/.lock, executes fn, then releases.
+// Only serializes writes — reads don't need locking.
+// This is the whole-directory lock; it is independent of named locks (see WithNamedLock).
+func WithLock(dir string, fn func() error) error {
+	return WithLockContext(context.Background(), dir, fn)
+}
+
+// WithLockContext is WithLock with cancellation: acquisition stops waiting when ctx is done.
+// If ctx has a deadline it replaces the default acquisition timeout. fn doesn't receive
+// ctx; to bound only the wait for the lock, use WithLockDeadline.
+func WithLockContext(ctx context.Context, dir string, fn func() error) error {
+	l, err := acquireLock(ctx, dir, "", LockOptions{}, false)
+	if err != nil {
+		return err
+	}
+	return l.run(fn)
+}
+
+// WithLockDeadline is WithLock waiting at most acquireTimeout for the lock; once
+// acquired, fn runs for as long as it needs. Unlike WithLockContext, where a single
+// ctx must cover both, nothing limits fn here. On expiry it returns a *LockTimeoutError.
+// A non-positive acquireTimeout uses the default timeout.
+func WithLockDeadline(dir string, acquireTimeout time.Duration, fn func() error) error {
+	return WithLockOpts(dir, LockOptions{Timeout: acquireTimeout}, fn)
+}
+
+// TryWithLock runs fn under the lock only if it can be acquired without waiting.
+// Returns false (and no error) without calling fn if another holder has the lock.
+func TryWithLock(dir string, fn func() error) (bool, error) {
+	l, err := acquireLock(context.Background(), dir, "", LockOptions{}, true)
+	if errors.Is(err, errLockBusy) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, l.run(fn)
+}
+
+// WithLockOpts is WithLock with explicit tuning; zero-valued fields of opts use the defaults.
+func WithLockOpts(dir string, opts LockOptions, fn func() error) error {
+	l, err := acquireLock(context.Background(), dir, "", opts, false)
+	if err != nil {
+		return err
+	}
+	return l.run(fn)
+}
+
+// WithNamedLock runs fn under the named lock <dir>/.locks/<name>.lock, creating .locks as needed.
+// Names are slugified to stay filesystem-safe. Named locks are independent of each other and
+// of the whole-directory WithLock, so callers choose their granularity: writers to different
+// collections under one root can use different names and never block each other.
+func WithNamedLock(dir, name string, fn func() error) error {
+	l, err := acquireLock(context.Background(), dir, name, LockOptions{}, false)
+	if err != nil {
+		return err
+	}
+	return l.run(fn)
+}
+
+// WithNamedLockOpts is WithNamedLock with explicit tuning, like WithLockOpts.
+func WithNamedLockOpts(dir, name string, opts LockOptions, fn func() error) error {
+	l, err := acquireLock(context.Background(), dir, name, opts, false)
+	if err != nil {
+		return err
+	}
+	return l.run(fn)
+}
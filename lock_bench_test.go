@@ -0,0 +1,50 @@
+// ABOUTME: Benchmarks for WithLock: uncontended, contended in-process, and contended by another process.
+// ABOUTME: The cross-process case uses a hammering child from the harness in lock_process_test.go.
+package mdstore
+
+import (
+	"sync"
+	"testing"
+)
+
+func BenchmarkWithLock_Uncontended(b *testing.B) {
+	dir := b.TempDir()
+	noop := func() error { return nil }
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := WithLock(dir, noop); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWithLock_InProcessContention(b *testing.B) {
+	dir := b.TempDir()
+	noop := func() error { return nil }
+
+	b.ReportAllocs()
+	b.SetParallelism(4)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := WithLock(dir, noop); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkWithLock_CrossProcessContention(b *testing.B) {
+	dir := b.TempDir()
+	startLockChild(b, "hammer", dir, StrategyDefault)
+	noop := func() error { return nil }
+
+	var once sync.Once
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := WithLock(dir, noop); err != nil {
+			once.Do(func() { b.Error(err) })
+		}
+	}
+}
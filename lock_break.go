@@ -0,0 +1,142 @@
+// ABOUTME: Operator-facing lock breaking with safety checks and an audit trail in .lock-audit.yaml beside the lock.
+// ABOUTME: Provides BreakLock, BreakOptions, and LockAuditEntry.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// testHookAfterBreakRename, if set, runs once BreakLock has moved the lock file aside,
+// before it rechecks it. Tests use it to act in the window between the two.
+var testHookAfterBreakRename func(aside string)
+
+// lockAuditName is the file beside a directory's lock file recording every broken lock.
+const lockAuditName = ".lock-audit.yaml"
+
+// BreakOptions controls BreakLock. The zero value is the safe default: a lock that
+// looks held, or is younger than 30s, is left alone.
+type BreakOptions struct {
+	// MinAge is how old a lock file recording a holder must be before it may be
+	// broken. Default 30s, the same age after which remote holders count as stale.
+	MinAge time.Duration
+
+	// Force breaks the lock even if it is younger than MinAge or appears held.
+	// Breaking a live lock lets two writers into the critical section.
+	Force bool
+
+	// Reason is recorded in the audit log.
+	Reason string
+}
+
+// LockAuditEntry is one record in .lock-audit.yaml, appended whenever a lock is broken.
+type LockAuditEntry struct {
+	Broken StoredTime  `yaml:"broken"`
+	By     string      `yaml:"by"`               // process that broke the lock, e.g. "pid 4242 on hostA (mdctl)"
+	Path   string      `yaml:"path"`             // lock file that was removed
+	Holder *LockHolder `yaml:"holder,omitempty"` // holder recorded in the broken lock, if any
+	Age    string      `yaml:"age"`              // age of the lock file when broken
+	Forced bool        `yaml:"forced,omitempty"`
+	Reason string      `yaml:"reason,omitempty"`
+}
+
+// BreakLock removes dir's lock file (see SetLockDir) after checking that it is safe
+// to: unless opts.Force is set, it returns a *LockHeldError if IsLocked reports the
+// lock as held, and refuses to break a lock file with a recorded holder younger than
+// opts.MinAge. Only force a break on locks IsLockStale reports as abandoned.
+// The file is renamed aside before removal and rechecked, so a process that acquires
+// the lock in the meantime keeps it. Each break appends a LockAuditEntry to
+// .lock-audit.yaml beside the lock file: in dir, or where SetLockDir puts dir's
+// locks, so a data directory kept free of lock files stays that way. A missing lock
+// file is not an error.
+func BreakLock(dir string, opts BreakOptions) error {
+	if err := checkLockWritable(dir, ""); err != nil {
+		return err
+	}
+	if opts.MinAge <= 0 {
+		opts.MinAge = staleLockAge
+	}
+
+	lockPath := lockPathFor(dir, "")
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	age := since(info.ModTime())
+
+	held, holder, err := lockIsHeld(lockPath)
+	if err != nil {
+		return err
+	}
+	if !opts.Force {
+		if held {
+			return &LockHeldError{Dir: dir, Path: lockPath, Holder: holder}
+		}
+		if holder != nil && age < opts.MinAge {
+			return fmt.Errorf("mdstore: lock %s is only %v old (minimum %v to break it)", lockPath, age.Round(time.Millisecond), opts.MinAge)
+		}
+	}
+
+	aside, ok := renameAside(lockPath)
+	if !ok {
+		if _, err := os.Stat(lockPath); errors.Is(err, fs.ErrNotExist) {
+			return nil // removed by someone else meanwhile
+		}
+		return fmt.Errorf("mdstore: could not move lock %s aside", lockPath)
+	}
+	if testHookAfterBreakRename != nil {
+		testHookAfterBreakRename(aside)
+	}
+	if !opts.Force && !sameHolderUnheld(aside, holder) {
+		// Acquired between the checks and the rename: give it back. If yet another
+		// process made a lock file meanwhile, the one moved aside is left where it is:
+		// removing it would leave its holder believing it holds a lock no one can see.
+		if err := os.Link(aside, lockPath); err != nil {
+			return fmt.Errorf("mdstore: lock %s was acquired while being broken, then made again by another process; the acquired lock file is left at %s: %w", lockPath, aside, err)
+		}
+		os.Remove(aside)
+		h, _, _ := readLockHolder(lockPath)
+		return &LockHeldError{Dir: dir, Path: lockPath, Holder: h}
+	}
+	if err := os.Remove(aside); err != nil {
+		return err
+	}
+
+	logf(slog.LevelWarn, "mdstore: lock broken", slog.String("path", lockPath), slog.Bool("forced", opts.Force))
+	by := currentHolder()
+	by.Acquired = StoredTime{}
+	entry := LockAuditEntry{
+		Broken: StoredTime{now()},
+		By:     by.String(),
+		Path:   lockPath,
+		Holder: holder,
+		Age:    age.Round(time.Millisecond).String(),
+		Forced: opts.Force,
+		Reason: opts.Reason,
+	}
+	if err := AppendYAML(filepath.Join(lockBaseDir(dir), lockAuditName), entry); err != nil {
+		return fmt.Errorf("mdstore: lock %s broken but not audited: %w", lockPath, err)
+	}
+	return nil
+}
+
+// sameHolderUnheld reports whether the lock file at path is not held at the OS level
+// and still records holder (nil meaning no holder).
+func sameHolderUnheld(path string, holder *LockHolder) bool {
+	if held, err := probeOSLock(path); err != nil || held {
+		return false
+	}
+	h, _, err := readLockHolder(path)
+	if err != nil || (h == nil) != (holder == nil) {
+		return false
+	}
+	return h == nil || h.sameAs(holder)
+}
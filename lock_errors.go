@@ -0,0 +1,60 @@
+// ABOUTME: Typed lock errors for callers that need to branch on failure causes.
+// ABOUTME: Provides ErrLockTimeout/LockTimeoutError with holder and wait details, and ErrLockHeld/LockHeldError.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLockTimeout matches (via errors.Is) any LockTimeoutError.
+var ErrLockTimeout = errors.New("mdstore: lock timeout")
+
+// LockTimeoutError reports a lock acquisition that gave up waiting.
+type LockTimeoutError struct {
+	Dir    string        // directory whose lock was requested
+	Path   string        // lock file that was contended
+	Waited time.Duration // how long acquisition was allowed to wait
+	Holder *LockHolder   // recorded holder, if the lock file had one
+}
+
+func (e *LockTimeoutError) Error() string {
+	if e.Holder != nil {
+		return fmt.Sprintf("mdstore: lock timeout after %v on %s: held by %s", e.Waited, e.Path, e.Holder)
+	}
+	return fmt.Sprintf("mdstore: lock timeout after %v on %s", e.Waited, e.Path)
+}
+
+// Is reports whether target is ErrLockTimeout.
+func (e *LockTimeoutError) Is(target error) bool {
+	return target == ErrLockTimeout
+}
+
+// newLockTimeoutError builds the timeout error for lockPath, naming the holder when known.
+func newLockTimeoutError(dir, lockPath string, waited time.Duration) *LockTimeoutError {
+	h, _, _ := readLockHolder(lockPath)
+	return &LockTimeoutError{Dir: dir, Path: lockPath, Waited: waited, Holder: h}
+}
+
+// ErrLockHeld matches (via errors.Is) any LockHeldError.
+var ErrLockHeld = errors.New("mdstore: lock held")
+
+// LockHeldError reports a lock that could not be broken because it appears held.
+type LockHeldError struct {
+	Dir    string      // directory whose lock was to be broken
+	Path   string      // lock file
+	Holder *LockHolder // recorded holder, if the lock file had one
+}
+
+func (e *LockHeldError) Error() string {
+	if e.Holder != nil {
+		return fmt.Sprintf("mdstore: lock %s is held by %s", e.Path, e.Holder)
+	}
+	return fmt.Sprintf("mdstore: lock %s is held", e.Path)
+}
+
+// Is reports whether target is ErrLockHeld.
+func (e *LockHeldError) Is(target error) bool {
+	return target == ErrLockHeld
+}
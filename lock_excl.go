@@ -0,0 +1,144 @@
+// ABOUTME: Portable O_CREATE|O_EXCL lock-file strategy with stale lock detection.
+// ABOUTME: Used as the Windows fallback when kernel byte-range locks are unavailable; keeps held locks fresh.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// testHookBeforeStaleRemove, if set, runs after a stale lock is re-verified and
+// before it is removed. Tests use it to widen the steal window.
+var testHookBeforeStaleRemove func()
+
+// testHookBeforeGuardClear, if set, runs after a steal guard is found stale and
+// before it is cleared. Tests use it to widen the window between the two.
+var testHookBeforeGuardClear func()
+
+// lockExclusiveCreate acquires lockPath by creating it with O_EXCL, retrying per p.
+// Stale locks (see lockIsStale) are removed and acquisition retried.
+// Returns a function that releases the lock by removing the file.
+func lockExclusiveCreate(lockPath string, p acquireParams) (func() error, error) {
+	err := p.poll(lockPath, func() (bool, error) {
+		for {
+			f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+			if err == nil {
+				// Lock acquired; record the holder best-effort so diagnostics never block acquisition
+				f.Write(holderPayload())
+				f.Close()
+				return true, nil
+			}
+
+			// Check for stale lock; after breaking one, retry immediately
+			if stale, _ := lockIsStale(lockPath, p.opts.StaleAge); !stale || !breakStaleLock(lockPath, p.opts.StaleAge) {
+				return false, nil
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stopTouching := startLockToucher(lockPath, p.opts.StaleAge)
+
+	return func() error {
+		stopTouching()
+		err := os.Remove(lockPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed externally; nothing left to release.
+			return nil
+		}
+		return err
+	}, nil
+}
+
+// breakStaleLock removes lockPath if it is still stale and reports whether it did.
+// Waiters that observe the same stale lock serialize on an O_EXCL guard file and
+// re-verify staleness while holding it, so a lock freshly re-created by the winning
+// waiter can never be removed by a slower one.
+func breakStaleLock(lockPath string, staleAge time.Duration) bool {
+	guardPath := lockPath + ".steal"
+
+	g, err := os.OpenFile(guardPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		// Another waiter is mid-steal. Only clear the guard if that waiter died holding it.
+		if info, statErr := os.Stat(guardPath); statErr == nil && since(info.ModTime()) > staleAge {
+			clearStaleGuard(guardPath, staleAge)
+		}
+		return false
+	}
+	defer func() {
+		// Remove the guard only while it's still ours.
+		if sameFileAsPath(g, guardPath) {
+			os.Remove(guardPath)
+		}
+		g.Close()
+	}()
+
+	if stale, _ := lockIsStale(lockPath, staleAge); !stale {
+		return false
+	}
+
+	if h, ok, _ := readLockHolder(lockPath); ok {
+		logf(slog.LevelWarn, "mdstore: removing stale lock", slog.String("path", lockPath), slog.String("holder", h.String()))
+	}
+
+	if testHookBeforeStaleRemove != nil {
+		testHookBeforeStaleRemove()
+	}
+
+	// A guard cleared as stale meanwhile lets another waiter steal too; leave it to them.
+	if !sameFileAsPath(g, guardPath) {
+		return false
+	}
+	return os.Remove(lockPath) == nil
+}
+
+// clearStaleGuard removes the steal guard at guardPath, found older than staleAge,
+// the way takeOverLease clears a lease: it's renamed aside, which only one waiter can
+// do, and its age checked again on the renamed file. If it was replaced by a fresh
+// guard after it was found stale, that guard is put back instead.
+func clearStaleGuard(guardPath string, staleAge time.Duration) {
+	if testHookBeforeGuardClear != nil {
+		testHookBeforeGuardClear()
+	}
+	aside, ok := renameAside(guardPath)
+	if !ok {
+		return
+	}
+	defer os.Remove(aside)
+
+	if info, err := os.Stat(aside); err == nil && since(info.ModTime()) <= staleAge {
+		// Fresh: restore it unless a new guard already exists.
+		os.Link(aside, guardPath)
+	}
+}
+
+// startLockToucher refreshes lockPath's mtime every staleAge/3 until the returned
+// stop function is called, so a long-running holder is never mistaken for an abandoned
+// one by waiters that judge staleness by age. stop waits for the toucher to exit.
+func startLockToucher(lockPath string, staleAge time.Duration) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	interval := staleAge / 3
+
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-done:
+				return
+			case t := <-after(interval):
+				os.Chtimes(lockPath, t, t)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
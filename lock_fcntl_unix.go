@@ -0,0 +1,125 @@
+// ABOUTME: POSIX fcntl byte-range lock strategy (StrategyFcntl) for NFS clients that mistranslate flock.
+// ABOUTME: Tracks held lock files so this process never opens and closes a second fd on them.
+
+//go:build !windows
+
+package mdstore
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// POSIX record locks belong to the process, and closing any fd on the file drops
+// them all. fcntlHeld maps each lock file this process holds with StrategyFcntl to
+// the fd holding it, so diagnostics can read through that fd instead of opening
+// (and closing) another one.
+var (
+	fcntlHeldMu sync.Mutex
+	fcntlHeld   = map[string]*os.File{} // keyed by absolute lock path
+)
+
+// fcntlKey returns the fcntlHeld key for lockPath.
+func fcntlKey(lockPath string) string {
+	abs, err := filepath.Abs(lockPath)
+	if err != nil {
+		return filepath.Clean(lockPath)
+	}
+	return abs
+}
+
+// lockFcntl acquires an exclusive fcntl write lock on all of lockPath. It polls the
+// non-blocking F_SETLK rather than blocking in F_SETLKW, which could not honor p's
+// timeout or cancellation, and shares the holder plumbing of the flock strategy.
+// The in-process lock layer guarantees a single acquirer per path in this process,
+// which fcntl itself can't: a second lock from the same process always succeeds.
+func lockFcntl(lockPath string, p acquireParams) (func() error, error) {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.poll(lockPath, func() (bool, error) {
+		for {
+			lk := unix.Flock_t{Type: unix.F_WRLCK, Whence: io.SeekStart}
+			err := unix.FcntlFlock(f.Fd(), unix.F_SETLK, &lk)
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EACCES) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			if sameFileAsPath(f, lockPath) {
+				return true, nil
+			}
+
+			// The file was removed or replaced while we waited; lock the new one instead.
+			f.Close() // drops the lock on the orphaned file
+			if f, err = os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644); err != nil {
+				return false, err
+			}
+		}
+	})
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+
+	key := fcntlKey(lockPath)
+	fcntlHeldMu.Lock()
+	fcntlHeld[key] = f
+	fcntlHeldMu.Unlock()
+
+	// Record the holder best-effort; diagnostics must never fail an acquisition.
+	if f.Truncate(0) == nil {
+		f.WriteAt(holderPayload(), 0)
+	}
+
+	return func() error {
+		fcntlHeldMu.Lock()
+		delete(fcntlHeld, key)
+		fcntlHeldMu.Unlock()
+
+		// Clear holder info so an unlocked file doesn't name a stale owner.
+		f.Truncate(0)
+		lk := unix.Flock_t{Type: unix.F_UNLCK, Whence: io.SeekStart}
+		unix.FcntlFlock(f.Fd(), unix.F_SETLK, &lk)
+		return f.Close()
+	}, nil
+}
+
+// fcntlLockedByOther reports whether another process holds an fcntl lock on any part
+// of f's file. This process's own locks never conflict with it, so don't count.
+func fcntlLockedByOther(f *os.File) (bool, error) {
+	lk := unix.Flock_t{Type: unix.F_WRLCK, Whence: io.SeekStart}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_GETLK, &lk); err != nil {
+		return false, err
+	}
+	return lk.Type != unix.F_UNLCK, nil
+}
+
+// readHeldFcntl returns lockPath's contents if this process holds it with
+// StrategyFcntl, reading through the holding fd; ok is false otherwise.
+func readHeldFcntl(lockPath string) (data []byte, ok bool) {
+	fcntlHeldMu.Lock()
+	defer fcntlHeldMu.Unlock()
+
+	f, ok := fcntlHeld[fcntlKey(lockPath)]
+	if !ok {
+		return nil, false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, true
+	}
+	data = make([]byte, fi.Size())
+	n, _ := f.ReadAt(data, 0)
+	return data[:n], true
+}
@@ -0,0 +1,213 @@
+// ABOUTME: Tests for the POSIX fcntl lock strategy.
+// ABOUTME: Uses a helper process to observe the lock, since fcntl locks don't conflict within one process.
+
+//go:build !windows
+
+package mdstore
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// fcntlProbeEnv names the lock file TestHelperFcntlProbe should probe.
+const fcntlProbeEnv = "MDSTORE_FCNTL_PROBE"
+
+// fcntlHoldEnv names the directory TestHelperFcntlHold should lock.
+const fcntlHoldEnv = "MDSTORE_FCNTL_HOLD"
+
+// TestHelperFcntlProbe is not a real test: run as a subprocess by fcntlLockedElsewhere,
+// it exits 0 if the lock file is free and 3 if another process holds an fcntl lock on it.
+func TestHelperFcntlProbe(t *testing.T) {
+	path := os.Getenv(fcntlProbeEnv)
+	if path == "" {
+		t.Skip("helper process only")
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		os.Exit(2)
+	}
+	lk := unix.Flock_t{Type: unix.F_WRLCK, Whence: io.SeekStart}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_GETLK, &lk); err != nil {
+		os.Exit(2)
+	}
+	if lk.Type != unix.F_UNLCK {
+		os.Exit(3)
+	}
+	os.Exit(0)
+}
+
+// fcntlLockedElsewhere reports whether another process sees an fcntl lock on path.
+func fcntlLockedElsewhere(t *testing.T, path string) bool {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable failed: %v", err)
+	}
+	cmd := exec.Command(exe, "-test.run=^TestHelperFcntlProbe$")
+	cmd.Env = append(os.Environ(), fcntlProbeEnv+"="+path)
+	err = cmd.Run()
+	if err == nil {
+		return false
+	}
+	if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() == 3 {
+		return true
+	}
+	t.Fatalf("probe process failed: %v", err)
+	return false
+}
+
+// TestHelperFcntlHold is not a real test: run as a subprocess by holdFcntlElsewhere,
+// it locks the directory with StrategyFcntl, says so on stdout, and holds the lock
+// until stdin is closed.
+func TestHelperFcntlHold(t *testing.T) {
+	dir := os.Getenv(fcntlHoldEnv)
+	if dir == "" {
+		t.Skip("helper process only")
+	}
+
+	err := WithLockStrategy(dir, StrategyFcntl, func() error {
+		os.Stdout.WriteString("locked\n")
+		io.Copy(io.Discard, os.Stdin)
+		return nil
+	})
+	if err != nil {
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+// holdFcntlElsewhere has another process lock dir with StrategyFcntl, returning once
+// it holds the lock and releasing it when the test ends.
+func holdFcntlElsewhere(t *testing.T, dir string) {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable failed: %v", err)
+	}
+	cmd := exec.Command(exe, "-test.run=^TestHelperFcntlHold$")
+	cmd.Env = append(os.Environ(), fcntlHoldEnv+"="+dir)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting holder process failed: %v", err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("holder process failed: %v", err)
+		}
+	})
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "locked\n" {
+		t.Fatalf("holder process: %q, %v", line, err)
+	}
+}
+
+func TestStrategyFcntl_SeenHeldByOtherProcesses(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+	holdFcntlElsewhere(t, dir)
+
+	// Make the lock look remote and long held, so only the fcntl lock protects it.
+	writeHolder(t, dir, remoteHolder)
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if locked, h, err := IsLocked(dir); err != nil || !locked || h == nil || h.PID != remoteHolder.PID {
+		t.Errorf("IsLocked = (%v, %+v, %v), want held", locked, h, err)
+	}
+	if err := BreakLock(dir, BreakOptions{}); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("BreakLock = %v, want ErrLockHeld", err)
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("refused break removed the lock file: %v", err)
+	}
+}
+
+func TestStrategyFcntl_HeldAndReleased(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+
+	err := WithLockStrategy(dir, StrategyFcntl, func() error {
+		if !fcntlLockedElsewhere(t, lockPath) {
+			t.Error("fcntl lock not visible to another process")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLockStrategy failed: %v", err)
+	}
+
+	if fcntlLockedElsewhere(t, lockPath) {
+		t.Error("fcntl lock still held after release")
+	}
+}
+
+func TestStrategyFcntl_DiagnosticsKeepLock(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+
+	err := WithLockStrategy(dir, StrategyFcntl, func() error {
+		// Each of these would drop the lock if it opened and closed the file.
+		h, found, err := LockInfo(dir)
+		if err != nil || !found || h.PID != os.Getpid() {
+			t.Errorf("LockInfo: got (%v, %v, %v)", h, found, err)
+		}
+		if locked, _, err := IsLocked(dir); err != nil || !locked {
+			t.Errorf("IsLocked: got (%v, %v)", locked, err)
+		}
+		if stale, err := IsLockStale(dir); err != nil || stale {
+			t.Errorf("IsLockStale: got (%v, %v)", stale, err)
+		}
+
+		if !fcntlLockedElsewhere(t, lockPath) {
+			t.Error("diagnostics dropped the fcntl lock")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLockStrategy failed: %v", err)
+	}
+}
+
+func TestStrategyFcntl_GoroutinesExclude(t *testing.T) {
+	dir := t.TempDir()
+	opts := LockOptions{Strategy: StrategyFcntl}
+
+	l, err := AcquireLockOpts(dir, opts)
+	if err != nil {
+		t.Fatalf("AcquireLockOpts failed: %v", err)
+	}
+
+	// fcntl can't tell goroutines apart; the in-process layer must.
+	ran, err := TryWithLock(dir, func() error { return nil })
+	if ran || err != nil {
+		t.Errorf("second goroutine got the lock: (%v, %v)", ran, err)
+	}
+	l.Release()
+}
+
+func TestStrategyFcntl_RootLockMatrix(t *testing.T) {
+	checkRootLockMatrix(t, StrategyFcntl)
+}
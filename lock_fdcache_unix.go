@@ -0,0 +1,174 @@
+// ABOUTME: Small LRU cache of open .lock file descriptors so repeated flocks skip open/close.
+// ABOUTME: Entries are checked out exclusively and revalidated by inode against the path.
+
+//go:build !windows
+
+package mdstore
+
+import (
+	"bytes"
+	"container/list"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// lockFDCacheSize bounds how many idle lock file descriptors are kept open.
+const lockFDCacheSize = 64
+
+// lockFD is an open lock file plus the identity of the inode it was opened on.
+type lockFD struct {
+	path  string
+	f     *os.File
+	dev   uint64
+	ino   uint64
+	inUse bool // guarded by lockFDs.mu
+}
+
+// current reports whether path still names the inode fd was opened on. A lock file
+// removed (e.g. by BreakLock) or replaced since then must be reopened: a flock on the
+// old inode would not exclude processes that open the new one.
+func (fd *lockFD) current() bool {
+	var st syscall.Stat_t
+	if err := syscall.Stat(fd.path, &st); err != nil {
+		return false
+	}
+	return uint64(st.Dev) == fd.dev && st.Ino == fd.ino
+}
+
+// openLockFD opens (creating if needed) the lock file at path.
+func openLockFD(path string) (*lockFD, error) {
+	fd := &lockFD{path: path}
+	if err := fd.open(); err != nil {
+		return nil, err
+	}
+	return fd, nil
+}
+
+// open (re)opens fd.path, recording the inode it names now.
+func (fd *lockFD) open() error {
+	f, err := os.OpenFile(fd.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &st); err != nil {
+		f.Close()
+		return err
+	}
+	fd.f, fd.dev, fd.ino = f, uint64(st.Dev), st.Ino
+	return nil
+}
+
+// reopen swaps a stale fd for one on the file currently at fd.path, in place.
+// The caller must hold the fd checked out.
+func (fd *lockFD) reopen() error {
+	fd.f.Close()
+	return fd.open()
+}
+
+// spaces backs blank; holder payloads are well under its length.
+var spaces = bytes.Repeat([]byte{' '}, 256)
+
+// writeHolder writes payload at the start of the lock file, padding it with spaces
+// over any longer content an earlier holder left, and returns the bytes written.
+// Overwriting instead of truncating keeps acquisition cheap: shrinking a file costs
+// several times more than rewriting a block already in the page cache.
+func (fd *lockFD) writeHolder(payload []byte) int {
+	var st syscall.Stat_t
+	if err := syscall.Fstat(int(fd.f.Fd()), &st); err == nil && st.Size > int64(len(payload)) {
+		payload = append(payload, blanks(int(st.Size)-len(payload))...)
+	}
+	n, _ := fd.f.WriteAt(payload, 0)
+	return n
+}
+
+// blank overwrites the first n bytes of the lock file with spaces, which parse as an
+// empty holder, so a released lock file names no owner.
+func (fd *lockFD) blank(n int) {
+	fd.f.WriteAt(blanks(n), 0)
+}
+
+// blanks returns n spaces.
+func blanks(n int) []byte {
+	if n <= len(spaces) {
+		return spaces[:n]
+	}
+	return bytes.Repeat([]byte{' '}, n)
+}
+
+// lockFDCache holds lock fds in LRU order. A cached fd is only reused while idle:
+// checking it out marks it in use, so no two acquisitions ever share an fd (flock is
+// per open file, so sharing one would let a second holder "acquire" the first one's lock).
+type lockFDCache struct {
+	mu      sync.Mutex
+	lru     *list.List // of *lockFD, most recently used at the front
+	entries map[string]*list.Element
+}
+
+var lockFDs = &lockFDCache{lru: list.New(), entries: map[string]*list.Element{}}
+
+// get checks out an fd for path, reusing the cached one when it is idle and opening a
+// fresh one otherwise. A reused fd may refer to a file since removed or replaced:
+// callers must check current() after locking it, as flockPath does, and reopen.
+func (c *lockFDCache) get(path string) (*lockFD, error) {
+	c.mu.Lock()
+	var fd *lockFD
+	if e, ok := c.entries[path]; ok && !e.Value.(*lockFD).inUse {
+		fd = e.Value.(*lockFD)
+		fd.inUse = true
+	}
+	c.mu.Unlock()
+
+	if fd == nil {
+		return openLockFD(path)
+	}
+	return fd, nil
+}
+
+// put returns an unlocked fd for reuse. An fd opened outside the cache is added to
+// it unless path already has one, evicting the least recently used idle fd if full.
+func (c *lockFDCache) put(fd *lockFD) {
+	c.mu.Lock()
+	if e, ok := c.entries[fd.path]; ok {
+		if e.Value.(*lockFD) == fd {
+			fd.inUse = false
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+		fd.f.Close()
+		return
+	}
+
+	c.entries[fd.path] = c.lru.PushFront(fd)
+	var evicted *lockFD
+	if c.lru.Len() > lockFDCacheSize {
+		for e := c.lru.Back(); e != nil; e = e.Prev() {
+			if old := e.Value.(*lockFD); !old.inUse {
+				evicted = c.lru.Remove(e).(*lockFD)
+				delete(c.entries, evicted.path)
+				break
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	if evicted != nil {
+		evicted.f.Close()
+	}
+}
+
+// drop closes fd and forgets it, for fds in an unknown state after an error.
+func (c *lockFDCache) drop(fd *lockFD) {
+	c.mu.Lock()
+	if e, ok := c.entries[fd.path]; ok && e.Value.(*lockFD) == fd {
+		c.lru.Remove(e)
+		delete(c.entries, fd.path)
+	}
+	c.mu.Unlock()
+
+	fd.f.Close()
+}
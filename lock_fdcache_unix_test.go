@@ -0,0 +1,237 @@
+// ABOUTME: Tests and benchmarks for the Unix lock fd cache.
+// ABOUTME: Covers fd reuse, reopening after the lock file is removed, eviction, and holder blanking.
+
+//go:build !windows
+
+package mdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// cachedLockFD returns the idle cached fd for path, or nil.
+func cachedLockFD(path string) *lockFD {
+	lockFDs.mu.Lock()
+	defer lockFDs.mu.Unlock()
+
+	if e, ok := lockFDs.entries[path]; ok && !e.Value.(*lockFD).inUse {
+		return e.Value.(*lockFD)
+	}
+	return nil
+}
+
+func TestLockFDCache_ReusesFD(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+
+	if err := WithLock(dir, func() error { return nil }); err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+	first := cachedLockFD(lockPath)
+	if first == nil {
+		t.Fatal("lock fd was not cached after release")
+	}
+
+	err := WithLock(dir, func() error {
+		if cachedLockFD(lockPath) != nil {
+			t.Error("fd should be in use while held")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+	if cachedLockFD(lockPath) != first {
+		t.Error("second acquisition did not reuse the cached fd")
+	}
+}
+
+func TestLockFDCache_ReopensRemovedLockFile(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+
+	if err := WithLock(dir, func() error { return nil }); err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+	if cachedLockFD(lockPath) == nil {
+		t.Fatal("lock fd was not cached after release")
+	}
+
+	if err := BreakLock(dir, BreakOptions{}); err != nil {
+		t.Fatalf("BreakLock failed: %v", err)
+	}
+
+	err := WithLock(dir, func() error {
+		// The lock must be on the file that now exists at the path, so an
+		// independent opener sees it as held.
+		if _, err := os.Stat(lockPath); err != nil {
+			t.Errorf("lock file not recreated: %v", err)
+		}
+		if held, err := probeOSLock(lockPath); err != nil || !held {
+			t.Error("lock held on the removed inode instead of the current file")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+
+	if fd := cachedLockFD(lockPath); fd == nil || !fd.current() {
+		t.Error("expected the cached fd to refer to the recreated file")
+	}
+}
+
+func TestLockFDCache_ReplacedWhileWaiting(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+
+	// Hold the original file through an uncached fd, as another process would.
+	other, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer other.Close()
+	if err := syscall.Flock(int(other.Fd()), syscall.LOCK_EX); err != nil {
+		t.Fatalf("Flock failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- WithLock(dir, func() error { return nil }) }()
+
+	// The holder removes the file and releases; the waiter must not settle
+	// for a lock on the orphaned inode.
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	syscall.Flock(int(other.Fd()), syscall.LOCK_UN)
+
+	if err := <-done; err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+	if fd := cachedLockFD(lockPath); fd == nil || !fd.current() {
+		t.Error("cached fd does not refer to the current lock file")
+	}
+}
+
+func TestLockFDCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	base := t.TempDir()
+	params := newAcquireParams(context.Background(), LockOptions{}, false)
+
+	var paths []string
+	for i := 0; i <= lockFDCacheSize; i++ {
+		lockPath := filepath.Join(base, fmt.Sprintf("%03d.lock", i))
+		unlock, err := lockFile(lockPath, params)
+		if err != nil {
+			t.Fatalf("lockFile failed: %v", err)
+		}
+		unlock()
+		paths = append(paths, lockPath)
+	}
+
+	if cachedLockFD(paths[0]) != nil {
+		t.Error("least recently used fd was not evicted")
+	}
+	if cachedLockFD(paths[len(paths)-1]) == nil {
+		t.Error("most recently used fd missing from cache")
+	}
+
+	lockFDs.mu.Lock()
+	size := lockFDs.lru.Len()
+	lockFDs.mu.Unlock()
+	if size > lockFDCacheSize {
+		t.Errorf("cache holds %d fds, limit is %d", size, lockFDCacheSize)
+	}
+}
+
+func TestLockFile_BlanksHolderInsteadOfTruncating(t *testing.T) {
+	dir := t.TempDir()
+	// A crashed holder with a long record left behind.
+	lockPath := writeHolder(t, dir, LockHolder{PID: 4242, Hostname: "some-other-host", Executable: strings.Repeat("x", 300)})
+
+	err := WithLock(dir, func() error {
+		h, found, err := LockInfo(dir)
+		if err != nil || !found || h.PID != os.Getpid() || h.Executable == strings.Repeat("x", 300) {
+			t.Errorf("holder not rewritten over longer leftover content: %+v, %v, %v", h, found, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+
+	if h, found, err := LockInfo(dir); found || err != nil {
+		t.Errorf("released lock file still names a holder: %+v, %v", h, err)
+	}
+	if locked, _, err := IsLocked(dir); locked || err != nil {
+		t.Errorf("released lock reported as locked: %v", err)
+	}
+	if data, _ := os.ReadFile(lockPath); strings.TrimSpace(string(data)) != "" {
+		t.Errorf("released lock file not blank: %q", data)
+	}
+}
+
+func BenchmarkLockFile_CachedFD(b *testing.B) {
+	lockPath := filepath.Join(b.TempDir(), ".lock")
+	params := newAcquireParams(context.Background(), LockOptions{}, false)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		unlock, err := lockFile(lockPath, params)
+		if err != nil {
+			b.Fatal(err)
+		}
+		unlock()
+	}
+}
+
+// uncachedLockFile is lockFile as it was before fds were cached: open, flock, and
+// close on every acquisition. BenchmarkLockFile_OpenPerCall measures it for comparison.
+func uncachedLockFile(lockPath string, p acquireParams) (func() error, error) {
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.poll(lockPath, func() (bool, error) {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if f.Truncate(0) == nil {
+		f.WriteAt(holderPayload(), 0)
+	}
+
+	return func() error {
+		f.Truncate(0)
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return f.Close()
+	}, nil
+}
+
+func BenchmarkLockFile_OpenPerCall(b *testing.B) {
+	lockPath := filepath.Join(b.TempDir(), ".lock")
+	params := newAcquireParams(context.Background(), LockOptions{}, false)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		unlock, err := uncachedLockFile(lockPath, params)
+		if err != nil {
+			b.Fatal(err)
+		}
+		unlock()
+	}
+}
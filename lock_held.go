@@ -0,0 +1,55 @@
+// ABOUTME: Held-lock tracking through contexts, so a call chain re-locking what it holds fails fast.
+// ABOUTME: Provides WithLockTracked and ErrLockAlreadyHeld.
+package mdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrLockAlreadyHeld is returned when a context shows that the calling chain already
+// holds the lock it asks for, which would otherwise wait on itself until timing out.
+var ErrLockAlreadyHeld = errors.New("mdstore: lock already held by this call chain")
+
+type heldLocksKey struct{}
+
+// heldLocks is an immutable list of the lock keys (see lockKey) held by a call chain.
+type heldLocks struct {
+	key    string
+	parent *heldLocks
+}
+
+// WithLockTracked is WithLockContext for code that threads ctx through its critical
+// sections: fn receives a ctx recording that dir's lock is held. A lock acquisition
+// given that ctx (or one derived from it) for the same directory, by WithLockTracked,
+// WithLockContext, or WithLockValueContext, returns ErrLockAlreadyHeld immediately
+// instead of deadlocking. Goroutines started by fn inherit the record, so pass them a
+// fresh ctx if they should wait for fn's lock rather than fail.
+func WithLockTracked(ctx context.Context, dir string, fn func(ctx context.Context) error) error {
+	l, err := acquireLock(ctx, dir, "", LockOptions{}, false)
+	if err != nil {
+		return err
+	}
+
+	held, _ := ctx.Value(heldLocksKey{}).(*heldLocks)
+	inner := context.WithValue(ctx, heldLocksKey{}, &heldLocks{key: lockKey(dir, ""), parent: held})
+	return l.run(func() error { return fn(inner) })
+}
+
+// checkNotHeld returns ErrLockAlreadyHeld if ctx records dir's lock (or named lock)
+// as held by the calling chain.
+func checkNotHeld(ctx context.Context, dir, name string) error {
+	held, _ := ctx.Value(heldLocksKey{}).(*heldLocks)
+	if held == nil {
+		return nil
+	}
+
+	key := lockKey(dir, name)
+	for h := held; h != nil; h = h.parent {
+		if h.key == key {
+			return fmt.Errorf("%w: %s", ErrLockAlreadyHeld, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// ABOUTME: Lock holder metadata written into .lock files for diagnostics.
+// ABOUTME: Provides LockHolder and LockInfo for reading who holds a lock.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LockHolder describes the process holding a lock, as recorded in the .lock file.
+type LockHolder struct {
+	PID        int        `yaml:"pid"`
+	Hostname   string     `yaml:"hostname"`
+	Executable string     `yaml:"executable"`
+	Acquired   StoredTime `yaml:"acquired"`
+}
+
+// String renders the holder for error messages, e.g. "pid 4242 on hostA since ...".
+func (h *LockHolder) String() string {
+	s := fmt.Sprintf("pid %d on %s", h.PID, h.Hostname)
+	if h.Executable != "" {
+		s += fmt.Sprintf(" (%s)", h.Executable)
+	}
+	if !h.Acquired.IsZero() {
+		s += " since " + FormatTime(h.Acquired.Time)
+	}
+	return s
+}
+
+// sameAs reports whether h and o record the same holder, acquiring at the same instant.
+func (h *LockHolder) sameAs(o *LockHolder) bool {
+	return h.PID == o.PID && h.Hostname == o.Hostname && h.Executable == o.Executable &&
+		h.Acquired.Equal(o.Acquired.Time)
+}
+
+var (
+	holderIdentityOnce sync.Once
+	holderIdentity     LockHolder
+	holderPrefix       []byte // holderIdentity marshaled without Acquired
+)
+
+// loadHolderIdentity fills in the parts of this process's holder metadata that never change.
+func loadHolderIdentity() {
+	holderIdentityOnce.Do(func() {
+		holderIdentity.PID = os.Getpid()
+		holderIdentity.Hostname, _ = os.Hostname()
+		if exe, err := os.Executable(); err == nil {
+			holderIdentity.Executable = filepath.Base(exe)
+		}
+		holderPrefix, _ = yaml.Marshal(struct {
+			PID        int    `yaml:"pid"`
+			Hostname   string `yaml:"hostname"`
+			Executable string `yaml:"executable"`
+		}{holderIdentity.PID, holderIdentity.Hostname, holderIdentity.Executable})
+	})
+}
+
+// currentHolder returns holder metadata for this process, stamped with the current time.
+func currentHolder() LockHolder {
+	loadHolderIdentity()
+
+	h := holderIdentity
+	h.Acquired = StoredTime{now()}
+	return h
+}
+
+// holderPayload returns the YAML payload written into a freshly acquired lock file.
+// Only the timestamp is formatted per call, keeping hot lock paths cheap; the result
+// is what yaml.Marshal makes of currentHolder().
+func holderPayload() []byte {
+	loadHolderIdentity()
+
+	buf := make([]byte, 0, len(holderPrefix)+48)
+	buf = append(buf, holderPrefix...)
+	buf = append(buf, "acquired: "...)
+	buf = strconv.AppendQuote(buf, FormatTime(now()))
+	return append(buf, '\n')
+}
+
+// LockInfo reports the holder recorded in dir's lock file (<dir>/.lock unless redirected by SetLockDir).
+// Returns found=false (and no error) if the lock file is missing, empty, or unparseable.
+func LockInfo(dir string) (*LockHolder, bool, error) {
+	return readLockHolder(lockPathFor(dir, ""))
+}
+
+// readLockHolder parses holder metadata from a lock file, degrading gracefully on garbage.
+func readLockHolder(lockPath string) (*LockHolder, bool, error) {
+	data, held := readHeldFcntl(lockPath)
+	if !held {
+		var err error
+		if data, err = os.ReadFile(lockPath); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+	}
+
+	var h LockHolder
+	if err := yaml.Unmarshal(data, &h); err != nil || h.PID == 0 {
+		return nil, false, nil
+	}
+
+	return &h, true, nil
+}
@@ -0,0 +1,194 @@
+// ABOUTME: In-process lock layer that serializes goroutines before touching the OS lock.
+// ABOUTME: Grants the lock in FIFO order; the OS lock is handed over while contended.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sync"
+)
+
+// dirLock serializes the goroutines of this process that want one lock file.
+// Waiters queue for tickets and are granted the lock in arrival order. The OS-level
+// lock is taken by the first owner and kept while the queue is non-empty, so a
+// contended handoff costs no syscalls.
+type dirLock struct {
+	// held and queue are guarded by dirLocksMu.
+	held  bool
+	queue []chan struct{} // waiting tickets, oldest first; closed when granted
+
+	unlock func() error // releases the OS lock; non-nil while held, owned by the current holder
+}
+
+var (
+	dirLocksMu sync.Mutex
+	dirLocks   = map[string]*dirLock{}
+)
+
+// canonicalDir returns the key identifying dir in the in-process lock table:
+// an absolute, cleaned path with symlinks resolved where possible.
+func canonicalDir(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return filepath.Clean(dir)
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	return abs
+}
+
+// acquirePath takes the in-process lock on lockPath, then the OS lock if this process
+// doesn't already hold it. Returns a function that releases both as appropriate, and
+// the number of goroutines that were queued ahead of this one.
+func acquirePath(lockPath string, p acquireParams) (func() error, int, error) {
+	key, cached, err := lockPathKey(lockPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dl, ticket, queued := enqueue(key, p.try)
+	if ticket != nil {
+		if err := dl.await(key, ticket, lockPath, p); err != nil {
+			return nil, queued, err
+		}
+	} else if dl == nil {
+		return nil, queued, errLockBusy
+	}
+
+	if dl.unlock == nil {
+		unlock, err := lockWithStrategy(lockPath, p)
+		if cached && errors.Is(err, fs.ErrNotExist) {
+			// The directory was removed since it was cached; recreate it and retry.
+			lockPathKeys.Delete(lockPath)
+			if err = EnsureDir(filepath.Dir(lockPath)); err == nil {
+				unlock, err = lockWithStrategy(lockPath, p)
+			}
+		}
+		if err != nil {
+			dl.release(key)
+			return nil, queued, err
+		}
+		dl.unlock = unlock
+	}
+
+	return func() error { return dl.release(key) }, queued, nil
+}
+
+// lockPathKeys caches the in-process key of every absolute lock path whose directory
+// is known to exist, so uncontended acquisitions skip EnsureDir and symlink resolution.
+// Symlinks in a lock path are therefore resolved once per process.
+var lockPathKeys sync.Map // lock path -> key
+
+// lockPathKey returns the in-process key for lockPath, creating its directory on first
+// use. cached reports whether the key came from lockPathKeys without touching the disk.
+func lockPathKey(lockPath string) (key string, cached bool, err error) {
+	if k, ok := lockPathKeys.Load(lockPath); ok {
+		return k.(string), true, nil
+	}
+
+	dir := filepath.Dir(lockPath)
+	if err := EnsureDir(dir); err != nil {
+		return "", false, err
+	}
+	key = filepath.Join(canonicalDir(dir), filepath.Base(lockPath))
+	// Relative paths depend on the working directory, so only absolute ones are cached.
+	if filepath.IsAbs(lockPath) {
+		lockPathKeys.Store(lockPath, key)
+	}
+	return key, false, nil
+}
+
+// enqueue registers interest in key. If the lock is free it is granted immediately
+// (ticket is nil); otherwise a ticket to wait on is returned, along with the number
+// of waiters ahead of it. In try mode a busy lock returns a nil dirLock instead.
+func enqueue(key string, try bool) (dl *dirLock, ticket chan struct{}, queued int) {
+	dirLocksMu.Lock()
+	defer dirLocksMu.Unlock()
+
+	dl, ok := dirLocks[key]
+	if !ok {
+		dl = &dirLock{}
+		dirLocks[key] = dl
+	}
+
+	if !dl.held {
+		dl.held = true
+		return dl, nil, 0
+	}
+	if try {
+		return nil, nil, len(dl.queue)
+	}
+
+	ticket = make(chan struct{})
+	queued = len(dl.queue)
+	dl.queue = append(dl.queue, ticket)
+	return dl, ticket, queued
+}
+
+// await waits for ticket to be granted, honoring p's context and deadline.
+// A waiter that gives up is removed from the queue; if its ticket was granted
+// in the meantime it keeps the lock, since the grant and the give-up raced.
+func (dl *dirLock) await(key string, ticket chan struct{}, lockPath string, p acquireParams) error {
+	var err error
+	select {
+	case <-ticket:
+		return nil
+	case <-p.ctx.Done():
+		err = p.ctxErr(lockPath)
+	case <-after(p.deadline.Sub(now())):
+		err = p.timeoutError(lockPath)
+	}
+
+	dirLocksMu.Lock()
+	defer dirLocksMu.Unlock()
+
+	for i, t := range dl.queue {
+		if t == ticket {
+			dl.queue = append(dl.queue[:i], dl.queue[i+1:]...)
+			return err
+		}
+	}
+	return nil // granted while we were giving up
+}
+
+// release hands the lock to the oldest waiter, keeping the OS lock held for it,
+// or, if nobody is waiting, drops the OS lock and forgets key.
+func (dl *dirLock) release(key string) error {
+	dirLocksMu.Lock()
+	handed := dl.handOff()
+	dirLocksMu.Unlock()
+	if handed {
+		return nil
+	}
+
+	// Stay registered as the holder while unlocking, so a new arrival queues here
+	// instead of reaching the OS lock before it is dropped. That matters for fcntl
+	// locks, which a second acquisition from this process would silently share.
+	var err error
+	if dl.unlock != nil {
+		err = dl.unlock()
+		dl.unlock = nil
+	}
+
+	dirLocksMu.Lock()
+	defer dirLocksMu.Unlock()
+	if !dl.handOff() { // a waiter that arrived meanwhile takes the OS lock afresh
+		dl.held = false
+		delete(dirLocks, key)
+	}
+	return err
+}
+
+// handOff grants the lock to the oldest waiter, if any, and reports whether it did.
+// The caller must hold dirLocksMu.
+func (dl *dirLock) handOff() bool {
+	if len(dl.queue) == 0 {
+		return false
+	}
+	next := dl.queue[0]
+	dl.queue = dl.queue[1:]
+	close(next)
+	return true
+}
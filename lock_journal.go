@@ -0,0 +1,123 @@
+// ABOUTME: Opt-in journal mode that marks a directory dirty while a critical section runs.
+// ABOUTME: Provides DirtyError, IsDirty, and ClearDirty for recovering from failed critical sections.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// inProgressName is the journal marker left in a data directory while a journaled
+// critical section runs; named locks use inProgressName + "-" + slug.
+const inProgressName = ".inprogress"
+
+// DirtyError reports a journaled critical section (see LockOptions.Journal) that
+// returned an error, leaving its .inprogress markers in place.
+type DirtyError struct {
+	Dirs []string // directories that may be half-updated
+	Err  error    // the critical section's error
+}
+
+func (e *DirtyError) Error() string {
+	return fmt.Sprintf("mdstore: %s left dirty: %v", strings.Join(e.Dirs, ", "), e.Err)
+}
+
+// Unwrap returns the critical section's error.
+func (e *DirtyError) Unwrap() error {
+	return e.Err
+}
+
+// inProgressPath returns the journal marker for dir's whole-directory lock, or its named lock.
+func inProgressPath(dir, name string) string {
+	if name == "" {
+		return filepath.Join(dir, inProgressName)
+	}
+	return filepath.Join(dir, inProgressName+"-"+Slugify(name))
+}
+
+// runJournaled writes the holder into every marker, runs fn, and removes the markers
+// only if fn succeeds. If fn returns an error the markers stay and a *DirtyError
+// naming dirs is returned; if fn panics the markers stay and the panic continues.
+func runJournaled(dirs, markers []string, fn func() error) error {
+	payload := holderPayload()
+	for i, marker := range markers {
+		if err := AtomicWrite(marker, payload); err != nil {
+			for _, written := range markers[:i] {
+				os.Remove(written)
+			}
+			return err
+		}
+	}
+
+	if err := fn(); err != nil {
+		return &DirtyError{Dirs: dirs, Err: err}
+	}
+
+	var errs []error
+	for _, marker := range markers {
+		if err := os.Remove(marker); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsDirty reports whether a journaled critical section on dir (whole-directory or
+// named) failed or is still running, and who ran it. The holder is nil if the
+// marker is unreadable.
+func IsDirty(dir string) (bool, *LockHolder, error) {
+	markers, err := dirtyMarkers(dir)
+	if err != nil || len(markers) == 0 {
+		return false, nil, err
+	}
+
+	h, _, err := readLockHolder(markers[0])
+	if err != nil {
+		return true, nil, err
+	}
+	return true, h, nil
+}
+
+// ClearDirty removes dir's journal markers once recovery tooling has dealt with the
+// half-updated state. A clean directory is not an error.
+func ClearDirty(dir string) error {
+	if err := checkWritable(dir); err != nil {
+		return err
+	}
+	markers, err := dirtyMarkers(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, marker := range markers {
+		if err := os.Remove(marker); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// dirtyMarkers lists dir's journal markers, the whole-directory marker first.
+func dirtyMarkers(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var markers []string
+	for _, e := range entries {
+		if name := e.Name(); name == inProgressName || strings.HasPrefix(name, inProgressName+"-") {
+			markers = append(markers, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(markers)
+	return markers, nil
+}
@@ -0,0 +1,234 @@
+// ABOUTME: Lease-style locks for long-running work: the holder renews a timestamp, others take over on expiry.
+// ABOUTME: Provides WithLease and ErrLeaseLost; independent of the flock/LockFileEx lock files.
+package mdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrLeaseLost is the context cause (and WithLease error) when a lease could not be
+// renewed in time, so another process may have taken it over.
+var ErrLeaseLost = errors.New("mdstore: lease lost")
+
+// leaseRecord is the content of a lease file: the holder plus its renewal state.
+type leaseRecord struct {
+	LockHolder `yaml:",inline"`
+	Renewed    StoredTime `yaml:"renewed"` // time of the last renewal
+	TTL        string     `yaml:"ttl"`     // time.Duration string
+}
+
+// leasePath returns dir's lease file (see SetLockDir).
+func leasePath(dir string) string {
+	return filepath.Join(lockBaseDir(dir), ".lease")
+}
+
+// WithLease runs fn while holding a lease on dir that expires ttl after its last renewal.
+// The lease is renewed every ttl/3. If a renewal fails or comes too late, fn's context
+// is canceled with cause ErrLeaseLost and WithLease reports ErrLeaseLost, since another
+// process may have taken the lease over.
+//
+// Waiting processes take over a lease whose holder stopped renewing for longer than
+// its ttl (or, on this host, died), by atomically renaming the lease file aside.
+// Acquisition waits up to the default lock timeout or 4/3 of ttl, whichever is longer.
+// Leases are independent of WithLock and the other lock files.
+func WithLease(dir string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	if ttl <= 0 {
+		return fmt.Errorf("mdstore: lease ttl must be positive, got %v", ttl)
+	}
+	if err := checkLockWritable(dir, ""); err != nil {
+		return err
+	}
+	path := leasePath(dir)
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	p := newAcquireParams(context.Background(), LockOptions{Timeout: max(lockTimeout, ttl*4/3)}, false)
+	p.dir = dir
+
+	holder := currentHolder()
+	var f *os.File
+	err := p.poll(path, func() (bool, error) {
+		for {
+			var err error
+			f, err = createLease(path, holder, ttl)
+			if err == nil {
+				return true, nil
+			}
+			if !errors.Is(err, fs.ErrExist) {
+				return false, err
+			}
+			if !leaseExpired(path) || !takeOverLease(path) {
+				return false, nil
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stop := startLeaseRenewal(f, holder, ttl, cancel)
+	defer func() {
+		stop()
+		releaseLease(f)
+	}()
+
+	err = fn(ctx)
+	if errors.Is(context.Cause(ctx), ErrLeaseLost) {
+		if err == nil {
+			return ErrLeaseLost
+		}
+		return errors.Join(ErrLeaseLost, err)
+	}
+	return err
+}
+
+// createLease creates the lease file with O_EXCL and records this process as holder.
+// The returned file stays open so renewals can verify it is still the lease file.
+func createLease(path string, holder LockHolder, ttl time.Duration) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeLeaseRecord(f, holder, ttl); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return f, nil
+}
+
+// writeLeaseRecord rewrites the lease record in f with a fresh renewal time.
+func writeLeaseRecord(f *os.File, holder LockHolder, ttl time.Duration) error {
+	rec := leaseRecord{LockHolder: holder, Renewed: StoredTime{now()}, TTL: ttl.String()}
+	data, err := yaml.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(data, 0)
+	return err
+}
+
+// leaseExpired reports whether the lease file at path belongs to a holder that has
+// stopped renewing for longer than its ttl, or that died on this host. A record that
+// can't be parsed (e.g. mid-rewrite) is judged by the file's mtime against staleLockAge.
+func leaseExpired(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	var rec leaseRecord
+	data, err := os.ReadFile(path)
+	if err != nil || yaml.Unmarshal(data, &rec) != nil || rec.PID == 0 {
+		return since(info.ModTime()) > staleLockAge
+	}
+
+	if rec.Hostname == currentHolder().Hostname && !pidAlive(rec.PID) {
+		return true
+	}
+	ttl, err := time.ParseDuration(rec.TTL)
+	if err != nil || rec.Renewed.IsZero() {
+		return since(info.ModTime()) > staleLockAge
+	}
+	return since(rec.Renewed.Time) > ttl
+}
+
+// takeOverLease atomically moves an expired lease file aside and deletes it, reporting
+// whether it did. Only one waiter's rename can succeed; if the holder renewed just
+// before the rename, the file is put back.
+func takeOverLease(path string) bool {
+	aside, ok := renameAside(path)
+	if !ok {
+		return false
+	}
+	defer os.Remove(aside)
+
+	if !leaseExpired(aside) {
+		// Renewed in the meantime: restore it unless a new holder already exists.
+		os.Link(aside, path)
+		return false
+	}
+	return true
+}
+
+// renameAside renames path to a unique sibling and returns the new name.
+func renameAside(path string) (string, bool) {
+	aside := fmt.Sprintf("%s.aside-%d-%x", path, os.Getpid(), rand.Uint64())
+	if err := os.Rename(path, aside); err != nil {
+		return "", false
+	}
+	return aside, true
+}
+
+// sameFileAsPath reports whether path still names the file open as f.
+func sameFileAsPath(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	return err == nil && os.SameFile(fi, pi)
+}
+
+// startLeaseRenewal rewrites the lease record every ttl/3 until stopped. If the lease
+// file is no longer f, or renewals fell behind by more than ttl, it cancels with
+// ErrLeaseLost and stops renewing. The returned stop function waits for it to exit.
+func startLeaseRenewal(f *os.File, holder LockHolder, ttl time.Duration, cancel context.CancelCauseFunc) (stop func()) {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	path := f.Name()
+
+	go func() {
+		defer close(exited)
+		last := now()
+		for {
+			select {
+			case <-done:
+				return
+			case t := <-after(ttl / 3):
+				if t.Sub(last) > ttl || !sameFileAsPath(f, path) || writeLeaseRecord(f, holder, ttl) != nil {
+					logf(slog.LevelWarn, "mdstore: lease lost", slog.String("path", path))
+					cancel(ErrLeaseLost)
+					return
+				}
+				last = t
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+// releaseLease removes the lease file if it is still ours, using the same rename as a
+// takeover so a lease taken over meanwhile is never deleted, then closes f.
+func releaseLease(f *os.File) {
+	defer f.Close()
+
+	path := f.Name()
+	aside, ok := renameAside(path)
+	if !ok {
+		return
+	}
+	if !sameFileAsPath(f, aside) {
+		os.Link(aside, path) // someone else's lease: put it back
+	}
+	os.Remove(aside)
+}
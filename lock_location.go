@@ -0,0 +1,53 @@
+// ABOUTME: Resolves where lock files live, optionally outside the data directory.
+// ABOUTME: Provides SetLockDir and HashedLockDir for redirecting locks to e.g. /run or os.TempDir().
+package mdstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"sync/atomic"
+)
+
+var currentLockDirMapper atomic.Pointer[func(string) string]
+
+// SetLockDir redirects lock files: mapper receives a data directory and returns the
+// directory that should hold its .lock file and .locks/ named locks. Pass nil to
+// restore the default of keeping locks inside the data directory.
+//
+// Mutual exclusion only holds between processes that agree on the mapping: every
+// process sharing a store must install the same mapper (or none).
+func SetLockDir(mapper func(dataDir string) string) {
+	if mapper == nil {
+		currentLockDirMapper.Store(nil)
+		return
+	}
+	currentLockDirMapper.Store(&mapper)
+}
+
+// HashedLockDir returns a mapper for SetLockDir that places each data directory's
+// locks under base in a subdirectory named by a hash of the canonical data path,
+// so different stores never share a lock file.
+func HashedLockDir(base string) func(dataDir string) string {
+	return func(dataDir string) string {
+		sum := sha256.Sum256([]byte(canonicalDir(dataDir)))
+		return filepath.Join(base, hex.EncodeToString(sum[:8]))
+	}
+}
+
+// lockBaseDir returns the directory holding dir's lock files.
+func lockBaseDir(dir string) string {
+	if p := currentLockDirMapper.Load(); p != nil {
+		return (*p)(dir)
+	}
+	return dir
+}
+
+// lockPathFor returns the lock file for dir, or for the named lock within dir.
+func lockPathFor(dir, name string) string {
+	base := lockBaseDir(dir)
+	if name == "" {
+		return filepath.Join(base, ".lock")
+	}
+	return filepath.Join(base, ".locks", Slugify(name)+".lock")
+}
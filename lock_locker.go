@@ -0,0 +1,247 @@
+// ABOUTME: Pluggable Locker interface so lock usage can be routed to e.g. a distributed mutex.
+// ABOUTME: Provides SetLocker, the file-based FileLocker default, and an in-memory MemoryLocker.
+package mdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Locker runs fn while holding an exclusive lock identified by key.
+// ctx bounds acquisition; implementations must not run fn if ctx is done first.
+//
+// Keys are canonical directory paths (see lockKey) for whole-directory locks,
+// and "<dir>:<slug>" for named locks (see WithNamedLock). Past the volume name, a
+// ":" or "%" in the path is escaped as "%3A" or "%25", so the only colon there is
+// the one before a name.
+type Locker interface {
+	WithLock(ctx context.Context, key string, fn func() error) error
+}
+
+// TryLocker is implemented by Lockers that can attempt a lock without waiting.
+// TryWithLock requires it once a custom Locker is installed.
+type TryLocker interface {
+	Locker
+	// TryWithLock runs fn only if the lock is free, reporting whether it ran.
+	TryWithLock(ctx context.Context, key string, fn func() error) (bool, error)
+}
+
+var currentLocker atomic.Pointer[Locker]
+
+// SetLocker routes every package-level lock (WithLock and its variants, named locks,
+// AcquireLock, WithLocks) through l. Pass nil to restore the built-in file locks.
+// LockOptions tuning other than Timeout only applies to the built-in file locks.
+// Root locks (see SetLockRoots) are only taken by the built-in locks and FileLocker.
+//
+// As with SetLockDir, mutual exclusion only holds between processes that use the same Locker.
+func SetLocker(l Locker) {
+	if l == nil {
+		currentLocker.Store(nil)
+		return
+	}
+	currentLocker.Store(&l)
+}
+
+// installedLocker returns the Locker set with SetLocker, or nil for the built-in file locks.
+func installedLocker() Locker {
+	if p := currentLocker.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// lockKey returns the Locker key for dir's whole-directory lock, or its named lock.
+func lockKey(dir, name string) string {
+	dir = canonicalDir(dir)
+	vol := filepath.VolumeName(dir)
+	key := vol + lockKeyEscaper.Replace(dir[len(vol):])
+	if name != "" {
+		key += ":" + Slugify(name)
+	}
+	return key
+}
+
+var (
+	lockKeyEscaper   = strings.NewReplacer("%", "%25", ":", "%3A")
+	lockKeyUnescaper = strings.NewReplacer("%25", "%", "%3A", ":")
+)
+
+// splitLockKey reverses lockKey. A colon only separates a name when it comes after
+// the volume name, so volume names like C: are left alone.
+func splitLockKey(key string) (dir, name string) {
+	vol := filepath.VolumeName(key)
+	rest := key[len(vol):]
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 {
+		rest, name = rest[:i], rest[i+1:]
+	}
+	return vol + lockKeyUnescaper.Replace(rest), name
+}
+
+// acquireViaLocker holds l's lock on key for the caller by running a critical section
+// that blocks until the returned release function is called. Acquisition honors p's
+// deadline and context like the file locks do.
+func acquireViaLocker(l Locker, key string, p acquireParams) (func() error, error) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	acquired := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan error, 1)
+
+	hold := func() error {
+		close(acquired)
+		<-release
+		return nil
+	}
+
+	if p.try {
+		tl, ok := l.(TryLocker)
+		if !ok {
+			cancel()
+			return nil, fmt.Errorf("mdstore: locker %T does not support TryWithLock", l)
+		}
+		go func() {
+			ran, err := tl.TryWithLock(ctx, key, hold)
+			if !ran && err == nil {
+				err = errLockBusy
+			}
+			done <- err
+		}()
+	} else {
+		go func() { done <- l.WithLock(ctx, key, hold) }()
+	}
+
+	select {
+	case <-acquired:
+	case err := <-done:
+		cancel()
+		if err == nil {
+			return nil, fmt.Errorf("mdstore: locker %T returned without running the critical section", l)
+		}
+		if p.ctx.Err() != nil {
+			return nil, p.ctxErr(key)
+		}
+		return nil, err
+	case <-after(p.deadline.Sub(now())):
+		cancel()
+		// The lock may have been granted as we gave up; if so, keep it.
+		select {
+		case <-acquired:
+		case <-done:
+			return nil, p.timeoutError(key)
+		}
+	}
+
+	return func() error {
+		close(release)
+		err := <-done
+		cancel()
+		return err
+	}, nil
+}
+
+// FileLocker is the built-in Locker: flock on Unix, LockFileEx on Windows, or the
+// strategy chosen in Options, with lock files placed as described by SetLockDir
+// and root locks taken as described by SetLockRoots.
+// The zero value uses the package defaults.
+type FileLocker struct {
+	Options LockOptions
+}
+
+// WithLock takes the file lock for key and runs fn.
+func (f FileLocker) WithLock(ctx context.Context, key string, fn func() error) error {
+	unlock, err := f.acquire(ctx, key, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+// TryWithLock runs fn under the file lock for key only if it is free.
+func (f FileLocker) TryWithLock(ctx context.Context, key string, fn func() error) (bool, error) {
+	unlock, err := f.acquire(ctx, key, true)
+	if errors.Is(err, errLockBusy) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	return true, fn()
+}
+
+func (f FileLocker) acquire(ctx context.Context, key string, try bool) (func() error, error) {
+	dir, name := splitLockKey(key)
+	if err := checkLockWritable(dir, name); err != nil {
+		return nil, err
+	}
+	p := newAcquireParams(ctx, f.Options, try)
+	p.dir = dir
+
+	unlock, _, err := acquireFileLock(dir, name, p)
+	return unlock, err
+}
+
+// MemoryLocker is a Locker that only excludes goroutines of this process.
+// It is useful in tests and for single-process deployments on filesystems without
+// working file locks. The zero value is ready to use; it must not be copied after use.
+type MemoryLocker struct {
+	mu   sync.Mutex
+	held map[string]chan struct{} // closed when the key is released
+}
+
+// WithLock waits for key to be free or ctx to be done, then runs fn.
+func (m *MemoryLocker) WithLock(ctx context.Context, key string, fn func() error) error {
+	for {
+		freed, ok := m.tryAcquire(key)
+		if ok {
+			break
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer m.release(key)
+	return fn()
+}
+
+// TryWithLock runs fn only if key is free.
+func (m *MemoryLocker) TryWithLock(ctx context.Context, key string, fn func() error) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if _, ok := m.tryAcquire(key); !ok {
+		return false, nil
+	}
+	defer m.release(key)
+	return true, fn()
+}
+
+// tryAcquire takes key if it is free; otherwise it returns a channel closed on release.
+func (m *MemoryLocker) tryAcquire(key string) (<-chan struct{}, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if freed, busy := m.held[key]; busy {
+		return freed, false
+	}
+	if m.held == nil {
+		m.held = map[string]chan struct{}{}
+	}
+	m.held[key] = make(chan struct{})
+	return nil, true
+}
+
+func (m *MemoryLocker) release(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	close(m.held[key])
+	delete(m.held, key)
+}
@@ -0,0 +1,71 @@
+// ABOUTME: Ordered multi-directory locking for operations spanning several stores.
+// ABOUTME: Provides WithLocks/WithLocksOpts, which acquire locks in a global order to prevent deadlocks.
+package mdstore
+
+import (
+	"context"
+	"sort"
+)
+
+// WithLocks acquires the whole-directory lock on every dir, executes fn, then releases.
+// Directories are canonicalized, deduplicated, and locked in sorted order so concurrent
+// callers can never deadlock by requesting the same set in different orders. Each lock
+// uses the normal per-lock timeout; if any acquisition fails, the locks already held are
+// released (in reverse order) before the error is returned.
+func WithLocks(dirs []string, fn func() error) error {
+	return WithLocksOpts(dirs, LockOptions{}, fn)
+}
+
+// WithLocksOpts is WithLocks with explicit tuning applied to each acquisition, like WithLockOpts.
+func WithLocksOpts(dirs []string, opts LockOptions, fn func() error) error {
+	ordered, err := orderedLockDirs(dirs)
+	if err != nil {
+		return err
+	}
+
+	held := make([]*Lock, 0, len(ordered))
+	defer func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].Release()
+		}
+	}()
+
+	for _, dir := range ordered {
+		l, err := acquireLock(context.Background(), dir, "", opts, false)
+		if err != nil {
+			return err
+		}
+		held = append(held, l)
+	}
+
+	if opts.Journal {
+		markers := make([]string, len(ordered))
+		for i, dir := range ordered {
+			markers[i] = inProgressPath(dir, "")
+		}
+		return runJournaled(ordered, markers, fn)
+	}
+	return fn()
+}
+
+// orderedLockDirs returns the canonical forms of dirs, deduplicated and sorted.
+func orderedLockDirs(dirs []string) ([]string, error) {
+	seen := make(map[string]bool, len(dirs))
+	ordered := make([]string, 0, len(dirs))
+
+	for _, dir := range dirs {
+		// Canonicalization resolves symlinks, which requires the directory to exist.
+		if err := EnsureDir(dir); err != nil {
+			return nil, err
+		}
+		c := canonicalDir(dir)
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		ordered = append(ordered, c)
+	}
+
+	sort.Strings(ordered)
+	return ordered, nil
+}
@@ -0,0 +1,62 @@
+// ABOUTME: Optional lock contention observer for metrics and diagnostics.
+// ABOUTME: Provides LockEvent, SetLockObserver, and a log/slog-based observer.
+package mdstore
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// LockEvent describes one lock acquisition, reported after the lock is released
+// (or after acquisition failed).
+type LockEvent struct {
+	Dir      string
+	Name     string        // named lock, or empty for the whole-directory lock
+	Wait     time.Duration // time spent waiting to acquire
+	Hold     time.Duration // time the lock was held; zero if never acquired
+	Queued   int           // in-process waiters already queued when this acquisition arrived
+	Acquired bool          // false if acquisition failed or found the lock busy
+	TimedOut bool          // acquisition gave up because its deadline passed
+}
+
+var currentLockObserver atomic.Pointer[func(LockEvent)]
+
+// SetLockObserver installs fn to receive a LockEvent for every lock acquisition
+// made through WithLock, WithLockContext, TryWithLock, or AcquireLock.
+// Observers run outside the critical section. Pass nil to remove the observer.
+func SetLockObserver(fn func(ev LockEvent)) {
+	if fn == nil {
+		currentLockObserver.Store(nil)
+		return
+	}
+	currentLockObserver.Store(&fn)
+}
+
+// lockObserver returns the installed observer, or nil.
+func lockObserver() func(LockEvent) {
+	if p := currentLockObserver.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// SlogLockObserver returns an observer that logs each LockEvent at Debug level.
+// A nil logger uses slog.Default().
+func SlogLockObserver(logger *slog.Logger) func(LockEvent) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return func(ev LockEvent) {
+		logger.LogAttrs(context.Background(), slog.LevelDebug, "mdstore lock",
+			slog.String("dir", ev.Dir),
+			slog.String("name", ev.Name),
+			slog.Duration("wait", ev.Wait),
+			slog.Duration("hold", ev.Hold),
+			slog.Int("queued", ev.Queued),
+			slog.Bool("acquired", ev.Acquired),
+			slog.Bool("timed_out", ev.TimedOut),
+		)
+	}
+}
@@ -0,0 +1,151 @@
+// ABOUTME: Lock acquisition tuning: timeout, retry backoff with jitter, strategy, and stale age.
+// ABOUTME: Provides LockOptions and the shared polling loop used by every lock strategy.
+package mdstore
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+const (
+	lockTimeout          = 10 * time.Second
+	lockRetryInterval    = 10 * time.Millisecond
+	lockMaxRetryInterval = 250 * time.Millisecond
+	lockRetryJitter      = 0.2 // ±20% of each retry interval
+)
+
+// LockOptions tunes lock acquisition. Zero-valued fields use the package defaults.
+type LockOptions struct {
+	// Timeout bounds how long acquisition waits. Default 10s.
+	// A context deadline that comes sooner takes precedence.
+	Timeout time.Duration
+
+	// RetryInterval is the first wait between attempts; it doubles after each
+	// failed attempt up to MaxRetryInterval, with ±20% jitter. Defaults 10ms and 250ms.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+
+	// Strategy selects the OS-level locking mechanism. Default StrategyDefault.
+	Strategy LockStrategy
+
+	// StaleAge is how old a lock file held by another host must be before
+	// file-removal strategies treat it as abandoned (see IsLockStale). Default 30s.
+	// Holders refresh their lock file every StaleAge/3, so every process sharing
+	// a store should use the same value.
+	StaleAge time.Duration
+
+	// Journal marks the data directory dirty while the critical section runs: a
+	// .inprogress file naming the holder is written before fn and removed only if fn
+	// succeeds. If fn fails the marker stays and a *DirtyError is returned; see IsDirty.
+	Journal bool
+}
+
+// withDefaults fills zero-valued fields with the package defaults.
+func (o LockOptions) withDefaults() LockOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = lockTimeout
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = lockRetryInterval
+	}
+	if o.MaxRetryInterval <= 0 {
+		o.MaxRetryInterval = lockMaxRetryInterval
+	}
+	if o.MaxRetryInterval < o.RetryInterval {
+		o.MaxRetryInterval = o.RetryInterval
+	}
+	if o.StaleAge <= 0 {
+		o.StaleAge = staleLockAge
+	}
+	return o
+}
+
+// acquireParams controls how long a single acquisition may wait.
+type acquireParams struct {
+	dir      string // directory being locked, for error reporting
+	ctx      context.Context
+	opts     LockOptions // with defaults applied
+	try      bool        // make a single attempt instead of waiting
+	start    time.Time   // when the acquisition began
+	deadline time.Time   // give up waiting after this instant
+}
+
+func newAcquireParams(ctx context.Context, opts LockOptions, try bool) acquireParams {
+	p := acquireParams{ctx: ctx, opts: opts.withDefaults(), try: try, start: now()}
+	p.deadline = p.start.Add(p.opts.Timeout)
+	if deadline, ok := ctx.Deadline(); ok && (opts.Timeout <= 0 || deadline.Before(p.deadline)) {
+		// A ctx deadline replaces the default timeout, or shortens an explicit one.
+		p.deadline = deadline
+	}
+	return p
+}
+
+// timeout returns the total time the acquisition was allowed to wait.
+func (p acquireParams) timeout() time.Duration {
+	return p.deadline.Sub(p.start)
+}
+
+// timeoutError reports that acquiring lockPath ran out of time.
+func (p acquireParams) timeoutError(lockPath string) error {
+	return newLockTimeoutError(p.dir, lockPath, p.timeout())
+}
+
+// lockSleep waits between lock attempts. Tests replace it to observe retry intervals.
+var lockSleep = sleepContext
+
+// sleepContext waits d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-after(d):
+		return nil
+	}
+}
+
+// jitter spreads d by ±lockRetryJitter so contending waiters don't wake in lockstep.
+func jitter(d time.Duration) time.Duration {
+	f := 1 + lockRetryJitter*(2*rand.Float64()-1)
+	return time.Duration(float64(d) * f)
+}
+
+// poll calls attempt until it acquires the lock or fails, backing off exponentially
+// with jitter between attempts. Stops with errLockBusy in try mode, ctx's error on
+// cancellation, or a lock timeout error once the deadline passes.
+func (p acquireParams) poll(lockPath string, attempt func() (bool, error)) error {
+	interval := p.opts.RetryInterval
+
+	for {
+		ok, err := attempt()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+
+		if p.try {
+			return errLockBusy
+		}
+		remaining := p.deadline.Sub(now())
+		if remaining <= 0 {
+			return p.timeoutError(lockPath)
+		}
+
+		if err := lockSleep(p.ctx, min(jitter(interval), remaining)); err != nil {
+			return p.ctxErr(lockPath)
+		}
+		interval = min(interval*2, p.opts.MaxRetryInterval)
+	}
+}
+
+// ctxErr converts a finished ctx into the acquisition error: a ctx deadline is
+// reported as a lock timeout like the default deadline, cancellation as ctx.Err().
+func (p acquireParams) ctxErr(lockPath string) error {
+	if errors.Is(p.ctx.Err(), context.DeadlineExceeded) {
+		return p.timeoutError(lockPath)
+	}
+	return p.ctx.Err()
+}
@@ -0,0 +1,283 @@
+// ABOUTME: Cross-process lock tests: re-executes the test binary to contend for locks from real child processes.
+// ABOUTME: Covers inter-process exclusion per strategy, stale takeover after a holder dies, and timeouts naming the holder.
+package mdstore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Environment passed to TestHelperLockChild.
+const (
+	lockChildMode     = "MDSTORE_LOCK_CHILD"    // contend, hold, die-holding, or hammer
+	lockChildDir      = "MDSTORE_LOCK_DIR"      // directory to lock
+	lockChildStrategy = "MDSTORE_LOCK_STRATEGY" // LockStrategy as an integer
+	lockChildIters    = "MDSTORE_LOCK_ITERS"    // contend: number of critical sections
+	lockChildLog      = "MDSTORE_LOCK_LOG"      // contend: shared file for enter/exit markers
+	lockChildReady    = "MDSTORE_LOCK_READY"    // hold, die-holding, hammer: created once running
+)
+
+// TestHelperLockChild is not a real test: run as a subprocess by startLockChild, it
+// locks a directory as instructed by its environment and exits 1 on any error.
+func TestHelperLockChild(t *testing.T) {
+	mode := os.Getenv(lockChildMode)
+	if mode == "" {
+		t.Skip("helper process only")
+	}
+
+	dir := os.Getenv(lockChildDir)
+	strategy, _ := strconv.Atoi(os.Getenv(lockChildStrategy))
+	opts := LockOptions{Strategy: LockStrategy(strategy), Timeout: time.Minute}
+	ready := func() { os.WriteFile(os.Getenv(lockChildReady), nil, 0o644) }
+	fail := func(err error) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	switch mode {
+	case "contend":
+		iters, _ := strconv.Atoi(os.Getenv(lockChildIters))
+		log, err := os.OpenFile(os.Getenv(lockChildLog), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			fail(err)
+		}
+		pid := os.Getpid()
+		for i := 0; i < iters; i++ {
+			err := WithLockOpts(dir, opts, func() error {
+				fmt.Fprintf(log, "enter %d\n", pid)
+				time.Sleep(time.Millisecond)
+				_, err := fmt.Fprintf(log, "exit %d\n", pid)
+				return err
+			})
+			if err != nil {
+				fail(err)
+			}
+		}
+
+	case "hold":
+		if _, err := AcquireLockOpts(dir, opts); err != nil {
+			fail(err)
+		}
+		ready()
+		time.Sleep(time.Minute) // until killed
+
+	case "die-holding":
+		if _, err := AcquireLockOpts(dir, opts); err != nil {
+			fail(err)
+		}
+		ready()
+		os.Exit(0) // without releasing
+
+	case "hammer":
+		ready()
+		for {
+			WithLockOpts(dir, opts, func() error {
+				time.Sleep(100 * time.Microsecond)
+				return nil
+			})
+			// Leave gaps, or flock's lack of fairness would starve the parent.
+			time.Sleep(time.Millisecond)
+		}
+
+	default:
+		fail(fmt.Errorf("unknown mode %q", mode))
+	}
+	os.Exit(0)
+}
+
+// lockChild is a running TestHelperLockChild process.
+type lockChild struct {
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	done   chan struct{} // closed once the child has exited
+	err    error         // exit error, valid after done
+}
+
+// startLockChild starts a child process locking dir in the given mode. For modes that
+// signal readiness it waits until the child is running (holding the lock, if it takes one).
+// The child is killed at the end of the test if still running.
+func startLockChild(tb testing.TB, mode, dir string, strategy LockStrategy, env ...string) *lockChild {
+	tb.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		tb.Fatalf("Executable failed: %v", err)
+	}
+	ready := filepath.Join(tb.TempDir(), "ready")
+
+	c := &lockChild{cmd: exec.Command(exe, "-test.run=^TestHelperLockChild$"), done: make(chan struct{})}
+	c.cmd.Env = append(os.Environ(),
+		lockChildMode+"="+mode,
+		lockChildDir+"="+dir,
+		lockChildStrategy+"="+strconv.Itoa(int(strategy)),
+		lockChildReady+"="+ready,
+	)
+	c.cmd.Env = append(c.cmd.Env, env...)
+	c.cmd.Stderr = &c.stderr
+	if err := c.cmd.Start(); err != nil {
+		tb.Fatalf("starting child failed: %v", err)
+	}
+	go func() {
+		c.err = c.cmd.Wait()
+		close(c.done)
+	}()
+	tb.Cleanup(func() {
+		c.cmd.Process.Kill()
+		<-c.done
+	})
+
+	if mode == "contend" {
+		return c
+	}
+	timeout := time.After(30 * time.Second)
+	for {
+		if _, err := os.Stat(ready); err == nil {
+			return c
+		}
+		select {
+		case <-c.done:
+			if _, err := os.Stat(ready); err == nil && c.err == nil {
+				return c // got ready and exited, as die-holding does
+			}
+			tb.Fatalf("child %s exited before getting ready: %v: %s", mode, c.err, c.stderr.String())
+		case <-timeout:
+			tb.Fatalf("child %s did not get ready", mode)
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// wait waits for the child to exit and fails the test if it reported an error.
+func (c *lockChild) wait(tb testing.TB) {
+	tb.Helper()
+	<-c.done
+	if c.err != nil {
+		tb.Errorf("child %d failed: %v: %s", c.cmd.Process.Pid, c.err, c.stderr.String())
+	}
+}
+
+// crossProcessStrategies returns the strategies to exercise across processes.
+func crossProcessStrategies() []LockStrategy {
+	strategies := []LockStrategy{StrategyDefault, StrategyPortable}
+	if runtime.GOOS != "windows" {
+		strategies = append(strategies, StrategyFcntl)
+	}
+	return strategies
+}
+
+// checkMarkers verifies that the enter/exit markers in log never interleave, and
+// returns how many critical sections they record.
+func checkMarkers(t *testing.T, log string) int {
+	t.Helper()
+
+	f, err := os.Open(log)
+	if err != nil {
+		t.Fatalf("opening marker log failed: %v", err)
+	}
+	defer f.Close()
+
+	sections := 0
+	inside := ""
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		kind, pid, _ := strings.Cut(scanner.Text(), " ")
+		switch {
+		case kind == "enter" && inside == "":
+			inside = pid
+		case kind == "exit" && inside == pid:
+			inside = ""
+			sections++
+		default:
+			t.Fatalf("line %d: %q while process %q was inside the critical section", line, scanner.Text(), inside)
+		}
+	}
+	if inside != "" {
+		t.Errorf("process %s never left the critical section", inside)
+	}
+	return sections
+}
+
+func TestCrossProcess_MutualExclusion(t *testing.T) {
+	children, iters := 4, 25
+	if testing.Short() {
+		children, iters = 2, 5
+	}
+
+	for _, strategy := range crossProcessStrategies() {
+		t.Run(fmt.Sprintf("strategy%d", strategy), func(t *testing.T) {
+			dir := t.TempDir()
+			log := filepath.Join(t.TempDir(), "markers")
+
+			var wg sync.WaitGroup
+			for i := 0; i < children; i++ {
+				c := startLockChild(t, "contend", dir, strategy, lockChildIters+"="+strconv.Itoa(iters), lockChildLog+"="+log)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.wait(t)
+				}()
+			}
+			wg.Wait()
+
+			if got := checkMarkers(t, log); got != children*iters {
+				t.Errorf("recorded %d critical sections, want %d", got, children*iters)
+			}
+		})
+	}
+}
+
+func TestCrossProcess_TimeoutNamesHolder(t *testing.T) {
+	for _, strategy := range crossProcessStrategies() {
+		t.Run(fmt.Sprintf("strategy%d", strategy), func(t *testing.T) {
+			dir := t.TempDir()
+			c := startLockChild(t, "hold", dir, strategy)
+
+			err := WithLockOpts(dir, LockOptions{Strategy: strategy, Timeout: 50 * time.Millisecond}, func() error {
+				t.Error("lock granted while another process holds it")
+				return nil
+			})
+			var timeoutErr *LockTimeoutError
+			if !errors.As(err, &timeoutErr) {
+				t.Fatalf("expected LockTimeoutError, got %v", err)
+			}
+			if timeoutErr.Holder == nil || timeoutErr.Holder.PID != c.cmd.Process.Pid {
+				t.Errorf("timeout should name the child %d as holder, got %+v", c.cmd.Process.Pid, timeoutErr.Holder)
+			}
+			if locked, h, err := IsLocked(dir); err != nil || !locked || h == nil || h.PID != c.cmd.Process.Pid {
+				t.Errorf("IsLocked = %v, %+v, %v; want held by the child", locked, h, err)
+			}
+		})
+	}
+}
+
+func TestCrossProcess_HolderDiesLockTakenOver(t *testing.T) {
+	for _, strategy := range crossProcessStrategies() {
+		t.Run(fmt.Sprintf("strategy%d", strategy), func(t *testing.T) {
+			dir := t.TempDir()
+			c := startLockChild(t, "die-holding", dir, strategy)
+			c.wait(t)
+
+			// Kernel locks die with the process; file-based ones are stolen from the dead PID.
+			err := WithLockOpts(dir, LockOptions{Strategy: strategy, Timeout: 5 * time.Second}, func() error {
+				if h, found, _ := LockInfo(dir); !found || h.PID != os.Getpid() {
+					t.Errorf("lock file should name this process after takeover, got %+v", h)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Errorf("lock of a dead holder not taken over: %v", err)
+			}
+		})
+	}
+}
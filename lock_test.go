@@ -0,0 +1,2609 @@
+// ABOUTME: Tests for the lock handle API and lock-related helpers.
+// ABOUTME: Covers AcquireLock/Release lifecycle, leak recovery, holder metadata, and stale detection.
+package mdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/harperreed/mdstore/internal/clocktest"
+	"gopkg.in/yaml.v3"
+)
+
+// acquireWithin tries to acquire the lock on dir in the background and reports
+// whether it succeeded before the timeout.
+func acquireWithin(t *testing.T, dir string, timeout time.Duration) bool {
+	t.Helper()
+
+	done := make(chan *Lock, 1)
+	go func() {
+		l, err := AcquireLock(dir)
+		if err != nil {
+			t.Errorf("AcquireLock failed: %v", err)
+			done <- nil
+			return
+		}
+		done <- l
+	}()
+
+	select {
+	case l := <-done:
+		if l != nil {
+			l.Release()
+		}
+		return l != nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// useClock installs a fake clock, starting at the real time so lock file mtimes
+// compare sensibly, for the duration of the test.
+func useClock(t *testing.T) *clocktest.Clock {
+	t.Helper()
+	clk := clocktest.New(time.Now())
+	SetClock(clk)
+	t.Cleanup(func() { SetClock(nil) })
+	return clk
+}
+
+// driveUntil runs fn in the background, advancing clk by step whenever n goroutines
+// are asleep on it, and returns fn's error once it finishes.
+func driveUntil(clk *clocktest.Clock, n int, step time.Duration, fn func() error) error {
+	done := make(chan struct{})
+	var err error
+	go func() {
+		defer close(done)
+		err = fn()
+	}()
+	clk.Drive(done, n, step)
+	return err
+}
+
+// defaultAcquireParams returns the parameters a plain WithLock call would use.
+func defaultAcquireParams() acquireParams {
+	return newAcquireParams(context.Background(), LockOptions{}, false)
+}
+
+// --- AcquireLock tests ---
+
+func TestAcquireLock_Basic(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+
+	if l.Dir() != dir {
+		t.Errorf("got Dir()=%q, want %q", l.Dir(), dir)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+}
+
+func TestAcquireLock_ExcludesOthersUntilRelease(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		WithLock(dir, func() error { return nil })
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("second acquisition succeeded while lock was held")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("second acquisition did not proceed after Release")
+	}
+}
+
+func TestAcquireLock_DoubleRelease(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("first Release failed: %v", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatalf("second Release should be a no-op, got: %v", err)
+	}
+}
+
+func TestAcquireLock_ReleaseAfterExternalRemoval(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, ".lock")); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	if err := l.Release(); err != nil {
+		t.Fatalf("Release after external removal failed: %v", err)
+	}
+
+	if !acquireWithin(t, dir, 5*time.Second) {
+		t.Fatal("could not reacquire lock after release")
+	}
+}
+
+func TestAcquireLock_LeakedHandleIsReleased(t *testing.T) {
+	dir := t.TempDir()
+
+	func() {
+		if _, err := AcquireLock(dir); err != nil {
+			t.Fatalf("AcquireLock failed: %v", err)
+		}
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		WithLock(dir, func() error { return nil })
+		close(done)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case <-done:
+			return
+		case <-deadline:
+			t.Fatal("leaked lock was never released by the finalizer")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestWithLock_ReleasesForNextCaller(t *testing.T) {
+	dir := t.TempDir()
+
+	if err := WithLock(dir, func() error { return nil }); err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+
+	if !acquireWithin(t, dir, 5*time.Second) {
+		t.Fatal("lock still held after WithLock returned")
+	}
+}
+
+// --- LockInfo tests ---
+
+func TestLockInfo_WhileHeld(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WithLock(dir, func() error {
+		h, found, err := LockInfo(dir)
+		if err != nil {
+			t.Fatalf("LockInfo failed: %v", err)
+		}
+		if !found {
+			t.Fatal("expected holder info while lock is held")
+		}
+		if h.PID != os.Getpid() {
+			t.Errorf("got pid=%d, want %d", h.PID, os.Getpid())
+		}
+		if h.Acquired.IsZero() {
+			t.Error("acquired timestamp missing")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+}
+
+func TestLockInfo_NoLockFile(t *testing.T) {
+	h, found, err := LockInfo(t.TempDir())
+	if err != nil {
+		t.Fatalf("LockInfo failed: %v", err)
+	}
+	if found || h != nil {
+		t.Errorf("expected no holder, got %+v", h)
+	}
+}
+
+func TestLockInfo_GarbageLockFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".lock"), []byte(":::not yaml[[["), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	h, found, err := LockInfo(dir)
+	if err != nil {
+		t.Fatalf("LockInfo should degrade gracefully, got: %v", err)
+	}
+	if found || h != nil {
+		t.Errorf("expected no holder for garbage file, got %+v", h)
+	}
+}
+
+func TestLockTimeoutError_IncludesHolder(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+	content := "pid: 4242\nhostname: hostA\nexecutable: app\nacquired: \"2024-01-15T10:30:00Z\"\n"
+	if err := os.WriteFile(lockPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	err := newLockTimeoutError(dir, lockPath, 10*time.Second)
+	want := "held by pid 4242 on hostA (app) since 2024-01-15T10:30:00Z"
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q should contain %q", err.Error(), want)
+	}
+}
+
+// --- IsLockStale / BreakLock tests ---
+
+// writeHolder writes a fake holder record into <dir>/.lock.
+func writeHolder(t *testing.T, dir string, h LockHolder) string {
+	t.Helper()
+
+	lockPath := filepath.Join(dir, ".lock")
+	data, err := yaml.Marshal(h)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if err := os.WriteFile(lockPath, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return lockPath
+}
+
+// deadPID returns the PID of a process that has already exited.
+func deadPID(t *testing.T) int {
+	t.Helper()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("Executable failed: %v", err)
+	}
+	cmd := exec.Command(exe, "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("helper process failed: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestIsLockStale_HeldBySelf(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WithLock(dir, func() error {
+		stale, err := IsLockStale(dir)
+		if err != nil {
+			t.Fatalf("IsLockStale failed: %v", err)
+		}
+		if stale {
+			t.Error("lock held by a live process reported stale")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+}
+
+func TestIsLockStale_DeadPIDSameHost(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	writeHolder(t, dir, LockHolder{PID: deadPID(t), Hostname: host})
+
+	stale, err := IsLockStale(dir)
+	if err != nil {
+		t.Fatalf("IsLockStale failed: %v", err)
+	}
+	if !stale {
+		t.Error("lock held by a dead PID should be stale")
+	}
+}
+
+func TestIsLockStale_OtherHostUsesAge(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := writeHolder(t, dir, LockHolder{PID: 4242, Hostname: "some-other-host"})
+
+	stale, err := IsLockStale(dir)
+	if err != nil {
+		t.Fatalf("IsLockStale failed: %v", err)
+	}
+	if stale {
+		t.Error("fresh lock from another host should not be stale")
+	}
+
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	stale, err = IsLockStale(dir)
+	if err != nil {
+		t.Fatalf("IsLockStale failed: %v", err)
+	}
+	if !stale {
+		t.Error("old lock from another host should be stale")
+	}
+}
+
+func TestIsLockStale_Missing(t *testing.T) {
+	stale, err := IsLockStale(t.TempDir())
+	if err != nil {
+		t.Fatalf("IsLockStale failed: %v", err)
+	}
+	if stale {
+		t.Error("missing lock should not be stale")
+	}
+}
+
+func TestBreakLock(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := writeHolder(t, dir, LockHolder{PID: 4242, Hostname: "some-other-host"})
+
+	if err := BreakLock(dir, BreakOptions{Force: true}); err != nil {
+		t.Fatalf("BreakLock failed: %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists after BreakLock: %v", err)
+	}
+
+	if err := BreakLock(dir, BreakOptions{}); err != nil {
+		t.Errorf("BreakLock on missing lock should be a no-op, got: %v", err)
+	}
+}
+
+// readLockAudit returns dir's lock audit entries.
+func readLockAudit(t *testing.T, dir string) []LockAuditEntry {
+	t.Helper()
+	var entries []LockAuditEntry
+	if err := ReadYAML(filepath.Join(dir, ".lock-audit.yaml"), &entries); err != nil {
+		t.Fatalf("reading audit log failed: %v", err)
+	}
+	return entries
+}
+
+func TestBreakLock_StaleLockBrokenAndAudited(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := writeHolder(t, dir, remoteHolder)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(lockPath, old, old)
+
+	if err := BreakLock(dir, BreakOptions{Reason: "holder host decommissioned"}); err != nil {
+		t.Fatalf("BreakLock failed: %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists: %v", err)
+	}
+
+	entries := readLockAudit(t, dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %+v", entries)
+	}
+	e := entries[0]
+	if e.Holder == nil || e.Holder.PID != remoteHolder.PID || e.Forced || e.Reason != "holder host decommissioned" {
+		t.Errorf("unexpected audit entry: %+v", e)
+	}
+	if !strings.Contains(e.By, fmt.Sprintf("pid %d", os.Getpid())) || e.Path != lockPath || e.Broken.IsZero() {
+		t.Errorf("audit entry doesn't say who broke which lock when: %+v", e)
+	}
+}
+
+func TestBreakLock_RefusesFreshLocks(t *testing.T) {
+	dir := t.TempDir()
+
+	// A remote holder that refreshed its lock just now counts as held.
+	lockPath := writeHolder(t, dir, remoteHolder)
+	err := BreakLock(dir, BreakOptions{})
+	var held *LockHeldError
+	if !errors.As(err, &held) || !errors.Is(err, ErrLockHeld) || held.Holder == nil || held.Holder.PID != remoteHolder.PID {
+		t.Errorf("expected LockHeldError naming the holder, got %v", err)
+	}
+
+	// A dead local holder is stale, but its lock is younger than MinAge.
+	host, _ := os.Hostname()
+	writeHolder(t, dir, LockHolder{PID: deadPID(t), Hostname: host})
+	if err := BreakLock(dir, BreakOptions{}); err == nil || errors.Is(err, ErrLockHeld) {
+		t.Errorf("expected a minimum age refusal, got %v", err)
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("refused break removed the lock file: %v", err)
+	}
+	if entries := readLockAudit(t, dir); len(entries) != 0 {
+		t.Errorf("refused breaks were audited: %+v", entries)
+	}
+
+	if err := BreakLock(dir, BreakOptions{MinAge: time.Nanosecond}); err != nil {
+		t.Errorf("dead holder older than MinAge not broken: %v", err)
+	}
+}
+
+func TestBreakLock_RefusesLiveLock(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WithLock(dir, func() error {
+		err := BreakLock(dir, BreakOptions{MinAge: time.Nanosecond})
+		if !errors.Is(err, ErrLockHeld) {
+			t.Errorf("expected ErrLockHeld for a lock held by this process, got %v", err)
+		}
+		if locked, h, _ := IsLocked(dir); !locked || h == nil || h.PID != os.Getpid() {
+			t.Errorf("refused break disturbed the holder: %v %+v", locked, h)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+}
+
+func TestBreakLock_GiveBackRace(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := writeHolder(t, dir, remoteHolder)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(lockPath, old, old)
+
+	// Between the checks and the rename a new holder took the lock, and between the
+	// rename and the give-back a third made a fresh lock file.
+	taker := LockHolder{PID: 5151, Hostname: "taker-host"}
+	third := LockHolder{PID: 6161, Hostname: "third-host"}
+	var asidePath string
+	testHookAfterBreakRename = func(aside string) {
+		asidePath = aside
+		data, _ := yaml.Marshal(taker)
+		os.WriteFile(aside, data, 0o644)
+		writeHolder(t, dir, third)
+	}
+	defer func() { testHookAfterBreakRename = nil }()
+
+	err := BreakLock(dir, BreakOptions{})
+	if err == nil || !strings.Contains(err.Error(), lockPath) || !strings.Contains(err.Error(), asidePath) {
+		t.Fatalf("expected an error naming both lock files, got %v", err)
+	}
+	if h, _, _ := readLockHolder(asidePath); h == nil || h.PID != taker.PID {
+		t.Errorf("the taken lock file wasn't left aside: %+v", h)
+	}
+	if h, _, _ := readLockHolder(lockPath); h == nil || h.PID != third.PID {
+		t.Errorf("the fresh lock file was disturbed: %+v", h)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".lock-audit.yaml")); !os.IsNotExist(err) {
+		t.Errorf("a failed break was audited: %v", err)
+	}
+}
+
+func TestBreakLock_AuditBesideRedirectedLock(t *testing.T) {
+	dataDir := t.TempDir()
+	lockBase := t.TempDir()
+	SetLockDir(HashedLockDir(lockBase))
+	t.Cleanup(func() { SetLockDir(nil) })
+
+	mapped := HashedLockDir(lockBase)(dataDir)
+	if err := os.MkdirAll(mapped, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lockPath := writeHolder(t, mapped, remoteHolder)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(lockPath, old, old)
+
+	if err := BreakLock(dataDir, BreakOptions{Reason: "moved"}); err != nil {
+		t.Fatalf("BreakLock failed: %v", err)
+	}
+	if entries := readLockAudit(t, mapped); len(entries) != 1 || entries[0].Path != lockPath {
+		t.Errorf("audit beside the lock = %+v", entries)
+	}
+	if entries, _ := os.ReadDir(dataDir); len(entries) != 0 {
+		t.Errorf("BreakLock wrote into the data directory: %v", entries)
+	}
+}
+
+func TestBreakLock_Force(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := writeHolder(t, dir, remoteHolder)
+
+	if err := BreakLock(dir, BreakOptions{Force: true, Reason: "stuck"}); err != nil {
+		t.Fatalf("forced BreakLock failed: %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file still exists: %v", err)
+	}
+	if entries := readLockAudit(t, dir); len(entries) != 1 || !entries[0].Forced {
+		t.Errorf("expected a forced audit entry, got %+v", entries)
+	}
+
+	matches, _ := filepath.Glob(lockPath + ".aside-*")
+	if len(matches) != 0 {
+		t.Errorf("break left files behind: %v", matches)
+	}
+}
+
+// --- IsLocked tests ---
+
+func TestIsLocked_Unlocked(t *testing.T) {
+	dir := t.TempDir()
+
+	locked, h, err := IsLocked(dir)
+	if err != nil || locked || h != nil {
+		t.Fatalf("missing lock file: got (%v, %v, %v)", locked, h, err)
+	}
+
+	if err := WithLock(dir, func() error { return nil }); err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+	locked, h, err = IsLocked(dir)
+	if err != nil || locked || h != nil {
+		t.Errorf("released lock: got (%v, %v, %v)", locked, h, err)
+	}
+}
+
+func TestIsLocked_Locked(t *testing.T) {
+	for _, strategy := range []LockStrategy{StrategyDefault, StrategyPortable} {
+		dir := t.TempDir()
+
+		err := WithLockStrategy(dir, strategy, func() error {
+			locked, h, err := IsLocked(dir)
+			if err != nil {
+				t.Fatalf("IsLocked failed: %v", err)
+			}
+			if !locked {
+				t.Errorf("strategy %v: held lock reported unlocked", strategy)
+			}
+			if h == nil || h.PID != os.Getpid() {
+				t.Errorf("strategy %v: got holder %v, want this process", strategy, h)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("WithLockStrategy failed: %v", err)
+		}
+	}
+}
+
+func TestIsLocked_DoesNotDisturbHolder(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	for i := 0; i < 10; i++ {
+		if locked, _, err := IsLocked(dir); err != nil || !locked {
+			t.Fatalf("probe %d: got (%v, %v)", i, locked, err)
+		}
+	}
+	if osLockFreeWithin(t, dir, 50*time.Millisecond) {
+		t.Error("probing released the holder's lock")
+	}
+}
+
+func TestIsLocked_Stale(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	pid := deadPID(t)
+	lockPath := writeHolder(t, dir, LockHolder{PID: pid, Hostname: host})
+
+	locked, h, err := IsLocked(dir)
+	if err != nil {
+		t.Fatalf("IsLocked failed: %v", err)
+	}
+	if locked {
+		t.Error("stale lock reported locked")
+	}
+	if h == nil || h.PID != pid {
+		t.Errorf("expected abandoned holder pid %d, got %v", pid, h)
+	}
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("IsLocked must not remove a stale lock: %v", err)
+	}
+}
+
+// --- lockExclusiveCreate tests ---
+
+func TestLockExclusiveCreate_AcquireRelease(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), ".lock")
+
+	unlock, err := lockExclusiveCreate(lockPath, defaultAcquireParams())
+	if err != nil {
+		t.Fatalf("lockExclusiveCreate failed: %v", err)
+	}
+
+	h, found, err := readLockHolder(lockPath)
+	if err != nil || !found {
+		t.Fatalf("expected holder metadata, found=%v err=%v", found, err)
+	}
+	if h.PID != os.Getpid() {
+		t.Errorf("got pid=%d, want %d", h.PID, os.Getpid())
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file should be removed on release: %v", err)
+	}
+}
+
+func TestLockExclusiveCreate_TakesOverStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	lockPath := writeHolder(t, dir, LockHolder{PID: deadPID(t), Hostname: host})
+
+	unlock, err := lockExclusiveCreate(lockPath, defaultAcquireParams())
+	if err != nil {
+		t.Fatalf("lockExclusiveCreate failed: %v", err)
+	}
+	defer unlock()
+
+	h, found, _ := readLockHolder(lockPath)
+	if !found || h.PID != os.Getpid() {
+		t.Errorf("stale lock was not taken over, holder=%+v", h)
+	}
+}
+
+// stealConcurrently has waiters goroutines take lockPath with lockExclusiveCreate at
+// once, and returns how many of them removed a stale lock and the most that held it
+// at the same time.
+func stealConcurrently(t *testing.T, lockPath string, waiters int) (steals, maxConcurrent int64) {
+	t.Helper()
+	var current int64
+	testHookBeforeStaleRemove = func() {
+		atomic.AddInt64(&steals, 1)
+		// Widen the window between deciding to steal and removing the lock.
+		time.Sleep(20 * time.Millisecond)
+	}
+	defer func() { testHookBeforeStaleRemove = nil }()
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			unlock, err := lockExclusiveCreate(lockPath, defaultAcquireParams())
+			if err != nil {
+				t.Errorf("lockExclusiveCreate failed: %v", err)
+				return
+			}
+
+			cur := atomic.AddInt64(&current, 1)
+			for {
+				old := atomic.LoadInt64(&maxConcurrent)
+				if cur <= old || atomic.CompareAndSwapInt64(&maxConcurrent, old, cur) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt64(&current, -1)
+
+			if err := unlock(); err != nil {
+				t.Errorf("unlock failed: %v", err)
+			}
+		}()
+	}
+
+	close(start)
+	wg.Wait()
+	return atomic.LoadInt64(&steals), atomic.LoadInt64(&maxConcurrent)
+}
+
+func TestLockExclusiveCreate_OnlyOneStealSucceeds(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	lockPath := writeHolder(t, dir, LockHolder{PID: deadPID(t), Hostname: host})
+
+	steals, maxConcurrent := stealConcurrently(t, lockPath, 8)
+	if steals != 1 {
+		t.Errorf("expected exactly 1 stale lock steal, got %d", steals)
+	}
+	if maxConcurrent > 1 {
+		t.Errorf("stale steal let %d holders in concurrently", maxConcurrent)
+	}
+}
+
+func TestLockExclusiveCreate_StaleGuard(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	lockPath := writeHolder(t, dir, LockHolder{PID: deadPID(t), Hostname: host})
+
+	// A waiter died mid-steal, leaving its guard behind.
+	guardPath := lockPath + ".steal"
+	writeFileString(t, guardPath, "")
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(guardPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+	// Waiters that found it stale clear it one by one, the later ones after a fresh
+	// guard has taken its place.
+	var clears int64
+	testHookBeforeGuardClear = func() {
+		time.Sleep(time.Duration(atomic.AddInt64(&clears, 1)) * 10 * time.Millisecond)
+	}
+	defer func() { testHookBeforeGuardClear = nil }()
+
+	steals, maxConcurrent := stealConcurrently(t, lockPath, 8)
+	if steals != 1 {
+		t.Errorf("expected exactly 1 stale lock steal, got %d", steals)
+	}
+	if maxConcurrent > 1 {
+		t.Errorf("stale steal let %d holders in concurrently", maxConcurrent)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".lock.") {
+			t.Errorf("left behind %s", e.Name())
+		}
+	}
+}
+
+// --- In-process lock layer tests ---
+
+// osLockFreeWithin reports whether the OS-level lock on dir can be taken directly,
+// bypassing the in-process layer, before the timeout.
+func osLockFreeWithin(t *testing.T, dir string, timeout time.Duration) bool {
+	t.Helper()
+
+	done := make(chan func() error, 1)
+	go func() {
+		unlock, err := lockFile(filepath.Join(dir, ".lock"), defaultAcquireParams())
+		if err != nil {
+			done <- nil
+			return
+		}
+		done <- unlock
+	}()
+
+	select {
+	case unlock := <-done:
+		if unlock != nil {
+			unlock()
+		}
+		return unlock != nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestAcquirePath_DropsOSLockAfterLastWaiter(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := WithLock(dir, func() error { return nil }); err != nil {
+				t.Errorf("WithLock failed: %v", err)
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	l.Release()
+	wg.Wait()
+
+	dirLocksMu.Lock()
+	remaining := len(dirLocks)
+	dirLocksMu.Unlock()
+	if remaining != 0 {
+		t.Errorf("expected in-process lock table to be empty, has %d entries", remaining)
+	}
+
+	if !osLockFreeWithin(t, dir, 5*time.Second) {
+		t.Error("OS lock still held after the last in-process waiter finished")
+	}
+}
+
+func TestCanonicalDir_ResolvesSymlinks(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "store")
+	link := filepath.Join(base, "link")
+
+	if err := EnsureDir(dir); err != nil {
+		t.Fatalf("EnsureDir failed: %v", err)
+	}
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	if canonicalDir(dir) != canonicalDir(link) {
+		t.Errorf("symlinked dir keyed differently: %q vs %q", canonicalDir(dir), canonicalDir(link))
+	}
+	if canonicalDir(dir+string(filepath.Separator)) != canonicalDir(dir) {
+		t.Error("trailing separator changed the key")
+	}
+}
+
+// waitForQueue blocks until n goroutines are queued on dir's lock, failing the test after a second.
+func waitForQueue(t *testing.T, dir string, n int) {
+	t.Helper()
+
+	key := filepath.Join(canonicalDir(dir), ".lock")
+	deadline := time.Now().Add(time.Second)
+	for {
+		dirLocksMu.Lock()
+		queued := 0
+		if dl, ok := dirLocks[key]; ok {
+			queued = len(dl.queue)
+		}
+		dirLocksMu.Unlock()
+
+		if queued >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d queued waiters, have %d", n, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAcquirePath_FIFOOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+
+	const n = 32
+	var mu sync.Mutex
+	var order []int
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := WithLock(dir, func() error {
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Errorf("WithLock %d failed: %v", i, err)
+			}
+		}()
+		// Enqueue one at a time so arrival order is well defined.
+		waitForQueue(t, dir, i+1)
+	}
+
+	l.Release()
+	wg.Wait()
+
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("completion order %v does not match request order", order)
+		}
+	}
+}
+
+func TestAcquirePath_RecreatesRemovedDir(t *testing.T) {
+	for _, strategy := range []LockStrategy{StrategyDefault, StrategyPortable} {
+		dir := filepath.Join(t.TempDir(), "store")
+		opts := LockOptions{Strategy: strategy}
+		noop := func() error { return nil }
+
+		if err := WithLockOpts(dir, opts, noop); err != nil {
+			t.Fatalf("strategy %v: WithLockOpts failed: %v", strategy, err)
+		}
+		// The directory is now cached as existing; remove it behind the cache's back.
+		if err := os.RemoveAll(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err := WithLockOpts(dir, opts, noop); err != nil {
+			t.Errorf("strategy %v: lock after removing the dir failed: %v", strategy, err)
+		}
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("strategy %v: dir not recreated: %v", strategy, err)
+		}
+	}
+}
+
+func TestAcquirePath_AbandonedWaiterLeavesQueue(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- WithLockContext(ctx, dir, func() error { return nil }) }()
+	waitForQueue(t, dir, 1)
+
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	l.Release()
+	if !acquireWithin(t, dir, time.Second) {
+		t.Error("lock was handed to an abandoned waiter")
+	}
+}
+
+// --- TryWithLock / WithLockContext tests ---
+
+func TestTryWithLock_Free(t *testing.T) {
+	dir := t.TempDir()
+	called := false
+
+	ok, err := TryWithLock(dir, func() error {
+		called = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TryWithLock failed: %v", err)
+	}
+	if !ok || !called {
+		t.Errorf("expected fn to run, ok=%v called=%v", ok, called)
+	}
+}
+
+func TestTryWithLock_Busy(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	called := false
+	ok, err := TryWithLock(dir, func() error {
+		called = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TryWithLock should not error on a busy lock, got: %v", err)
+	}
+	if ok || called {
+		t.Errorf("fn should not run while lock is held, ok=%v called=%v", ok, called)
+	}
+}
+
+func TestWithLockContext_Canceled(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	err = WithLockContext(ctx, dir, func() error {
+		t.Error("fn should not run")
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWithLockContext_DeadlineIsLockTimeout(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	err = WithLockContext(ctx, dir, func() error { return nil })
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("expected lock timeout error, got %v", err)
+	}
+}
+
+func TestWithLockDeadline_FnOutlivesAcquireTimeout(t *testing.T) {
+	dir := t.TempDir()
+	timeout := 20 * time.Millisecond
+
+	err := WithLockDeadline(dir, timeout, func() error {
+		time.Sleep(3 * timeout)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("fn running past the acquire timeout failed: %v", err)
+	}
+}
+
+func TestWithLockDeadline_TimesOutAcquiring(t *testing.T) {
+	dir := t.TempDir()
+	timeout := 20 * time.Millisecond
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	ran := false
+	err = WithLockDeadline(dir, timeout, func() error { ran = true; return nil })
+	var timeoutErr *LockTimeoutError
+	if !errors.As(err, &timeoutErr) || timeoutErr.Waited != timeout {
+		t.Errorf("expected LockTimeoutError after %v, got %v", timeout, err)
+	}
+	if ran {
+		t.Error("fn ran without the lock")
+	}
+}
+
+// --- SetLockObserver tests ---
+
+// recordLockEvents installs an observer for the duration of the test and returns
+// a function that snapshots the events seen so far.
+func recordLockEvents(t *testing.T) func() []LockEvent {
+	t.Helper()
+
+	var mu sync.Mutex
+	var events []LockEvent
+	SetLockObserver(func(ev LockEvent) {
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	})
+	t.Cleanup(func() { SetLockObserver(nil) })
+
+	return func() []LockEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]LockEvent(nil), events...)
+	}
+}
+
+func TestSetLockObserver_WaitAndHold(t *testing.T) {
+	dir := t.TempDir()
+	events := recordLockEvents(t)
+
+	err := WithLock(dir, func() error {
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+
+	got := events()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(got))
+	}
+	if !got[0].Acquired || got[0].TimedOut {
+		t.Errorf("unexpected event flags: %+v", got[0])
+	}
+	if got[0].Hold < 20*time.Millisecond {
+		t.Errorf("hold duration too short: %v", got[0].Hold)
+	}
+	if got[0].Dir != dir {
+		t.Errorf("got dir=%q, want %q", got[0].Dir, dir)
+	}
+}
+
+func TestSetLockObserver_TimedOutAndBusy(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	events := recordLockEvents(t)
+
+	TryWithLock(dir, func() error { return nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	WithLockContext(ctx, dir, func() error { return nil })
+
+	got := events()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(got))
+	}
+	if got[0].Acquired || got[0].TimedOut {
+		t.Errorf("busy try should be neither acquired nor timed out: %+v", got[0])
+	}
+	if got[1].Acquired || !got[1].TimedOut {
+		t.Errorf("expected timed-out event, got %+v", got[1])
+	}
+}
+
+func TestSetLockObserver_ReportsQueueLength(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+
+	events := recordLockEvents(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WithLock(dir, func() error { return nil })
+		}()
+		waitForQueue(t, dir, i+1)
+	}
+	l.Release()
+	wg.Wait()
+
+	got := events()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(got))
+	}
+	// Waiters are granted in order and saw 0, 1 and 2 others ahead of them.
+	for i, ev := range got {
+		if ev.Queued != i {
+			t.Errorf("event %d: Queued=%d, want %d", i, ev.Queued, i)
+		}
+	}
+}
+
+func TestSetLockObserver_RunsOutsideCriticalSection(t *testing.T) {
+	dir := t.TempDir()
+
+	free := make(chan bool, 1)
+	SetLockObserver(func(ev LockEvent) {
+		free <- osLockFreeWithin(t, dir, time.Second)
+	})
+	t.Cleanup(func() { SetLockObserver(nil) })
+
+	if err := WithLock(dir, func() error { return nil }); err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+
+	if !<-free {
+		t.Error("observer ran while the lock was still held")
+	}
+}
+
+// --- WithNamedLock tests ---
+
+// runsWithin reports whether fn completes before the timeout.
+func runsWithin(timeout time.Duration, fn func()) bool {
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestWithNamedLock_CreatesSlugifiedLockFile(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WithNamedLock(dir, "My Posts!", func() error {
+		h, found, err := readLockHolder(filepath.Join(dir, ".locks", "my-posts.lock"))
+		if err != nil || !found {
+			t.Errorf("expected holder in named lock file, found=%v err=%v", found, err)
+		} else if h.PID != os.Getpid() {
+			t.Errorf("got pid=%d, want %d", h.PID, os.Getpid())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithNamedLock failed: %v", err)
+	}
+}
+
+func TestWithNamedLock_IndependentNames(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WithNamedLock(dir, "posts", func() error {
+		ok := runsWithin(time.Second, func() {
+			WithNamedLock(dir, "drafts", func() error { return nil })
+		})
+		if !ok {
+			t.Error("different named locks blocked each other")
+		}
+
+		ok = runsWithin(time.Second, func() {
+			WithLock(dir, func() error { return nil })
+		})
+		if !ok {
+			t.Error("named lock blocked the whole-directory lock")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithNamedLock failed: %v", err)
+	}
+}
+
+func TestWithNamedLock_SameNameSerializes(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WithNamedLock(dir, "posts", func() error {
+		ok := runsWithin(50*time.Millisecond, func() {
+			WithNamedLock(dir, "posts", func() error { return nil })
+		})
+		if ok {
+			t.Error("same named lock was acquired twice")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithNamedLock failed: %v", err)
+	}
+}
+
+// --- WithLocks tests ---
+
+func TestWithLocks_OppositeOrderNoDeadlock(t *testing.T) {
+	base := t.TempDir()
+	a := filepath.Join(base, "a")
+	b := filepath.Join(base, "b")
+
+	var inside, maxInside int64
+	var wg sync.WaitGroup
+
+	worker := func(dirs []string) {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			err := WithLocks(dirs, func() error {
+				cur := atomic.AddInt64(&inside, 1)
+				for {
+					old := atomic.LoadInt64(&maxInside)
+					if cur <= old || atomic.CompareAndSwapInt64(&maxInside, old, cur) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt64(&inside, -1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("WithLocks failed: %v", err)
+				return
+			}
+		}
+	}
+
+	ok := runsWithin(20*time.Second, func() {
+		wg.Add(2)
+		go worker([]string{a, b})
+		go worker([]string{b, a})
+		wg.Wait()
+	})
+	if !ok {
+		t.Fatal("WithLocks deadlocked on opposite lock orders")
+	}
+	if maxInside > 1 {
+		t.Errorf("critical sections overlapped: max=%d", maxInside)
+	}
+}
+
+func TestWithLocks_DeduplicatesDirs(t *testing.T) {
+	dir := t.TempDir()
+
+	ok := runsWithin(5*time.Second, func() {
+		err := WithLocks([]string{dir, dir + string(filepath.Separator), dir}, func() error { return nil })
+		if err != nil {
+			t.Errorf("WithLocks failed: %v", err)
+		}
+	})
+	if !ok {
+		t.Fatal("WithLocks deadlocked on duplicate dirs")
+	}
+}
+
+func TestWithLocks_ReleasesHeldLocksOnFailure(t *testing.T) {
+	base := t.TempDir()
+	a := filepath.Join(base, "a")
+	b := filepath.Join(base, "b")
+
+	// A directory where b's lock file should be makes the second acquisition fail
+	// after the first lock (a sorts first) is already held.
+	if err := EnsureDir(filepath.Join(b, ".lock")); err != nil {
+		t.Fatalf("EnsureDir failed: %v", err)
+	}
+
+	err := WithLocks([]string{b, a}, func() error {
+		t.Error("fn should not run")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected WithLocks to fail")
+	}
+
+	if !acquireWithin(t, a, time.Second) {
+		t.Error("lock on the first directory leaked after a later failure")
+	}
+}
+
+// --- Backoff tests ---
+
+func TestPoll_BackoffGrowsWithJitter(t *testing.T) {
+	var sleeps []time.Duration
+	lockSleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	defer func() { lockSleep = sleepContext }()
+
+	const failures = 8
+	attempts := 0
+	p := newAcquireParams(context.Background(), LockOptions{}, false)
+	err := p.poll("unused", func() (bool, error) {
+		attempts++
+		return attempts > failures, nil
+	})
+	if err != nil {
+		t.Fatalf("poll failed: %v", err)
+	}
+
+	if len(sleeps) != failures {
+		t.Fatalf("expected %d sleeps, got %d", failures, len(sleeps))
+	}
+
+	base := lockRetryInterval
+	jittered := false
+	for i, d := range sleeps {
+		lo := time.Duration(float64(base) * (1 - lockRetryJitter))
+		hi := time.Duration(float64(base) * (1 + lockRetryJitter))
+		if d < lo || d > hi {
+			t.Errorf("sleep %d: got %v, want within [%v, %v]", i, d, lo, hi)
+		}
+		if d != base {
+			jittered = true
+		}
+		base = min(base*2, lockMaxRetryInterval)
+	}
+
+	if !jittered {
+		t.Error("retry intervals were not jittered")
+	}
+	if sleeps[len(sleeps)-1] < sleeps[0]*10 {
+		t.Errorf("retry intervals did not grow: %v", sleeps)
+	}
+}
+
+func TestPoll_CustomIntervals(t *testing.T) {
+	var sleeps []time.Duration
+	lockSleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	defer func() { lockSleep = sleepContext }()
+
+	opts := LockOptions{RetryInterval: 100 * time.Millisecond, MaxRetryInterval: 200 * time.Millisecond}
+	attempts := 0
+	p := newAcquireParams(context.Background(), opts, false)
+	p.poll("unused", func() (bool, error) {
+		attempts++
+		return attempts > 4, nil
+	})
+
+	max := time.Duration(float64(200*time.Millisecond) * (1 + lockRetryJitter))
+	for i, d := range sleeps {
+		if d > max {
+			t.Errorf("sleep %d: %v exceeds the configured cap", i, d)
+		}
+	}
+	if sleeps[0] < 80*time.Millisecond {
+		t.Errorf("first sleep %v ignores the configured initial interval", sleeps[0])
+	}
+}
+
+func TestWithLockOpts_Timeout(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	start := time.Now()
+	err = WithLockOpts(dir, LockOptions{Timeout: 50 * time.Millisecond}, func() error { return nil })
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected lock timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout not honored, waited %v", elapsed)
+	}
+}
+
+func TestLockOptions_SubSecondTimeoutEverywhere(t *testing.T) {
+	for _, strategy := range []LockStrategy{StrategyDefault, StrategyPortable} {
+		dir := t.TempDir()
+		opts := LockOptions{Timeout: 30 * time.Millisecond, RetryInterval: time.Millisecond, Strategy: strategy}
+
+		// Hold both locks at the OS level, as another process would.
+		for _, name := range []string{"", "posts"} {
+			lockPath := lockPathFor(dir, name)
+			if err := EnsureDir(filepath.Dir(lockPath)); err != nil {
+				t.Fatalf("EnsureDir failed: %v", err)
+			}
+			unlock, err := lockWithStrategy(lockPath, newAcquireParams(context.Background(), opts, false))
+			if err != nil {
+				t.Fatalf("strategy %v: holding lock %q failed: %v", strategy, name, err)
+			}
+			defer unlock()
+		}
+
+		noop := func() error { return nil }
+		variants := map[string]func() error{
+			"WithLockOpts":      func() error { return WithLockOpts(dir, opts, noop) },
+			"WithNamedLockOpts": func() error { return WithNamedLockOpts(dir, "posts", opts, noop) },
+			"WithLocksOpts":     func() error { return WithLocksOpts([]string{dir}, opts, noop) },
+			"WithLockValueOpts": func() error {
+				_, err := WithLockValueOpts(dir, opts, func() (int, error) { return 0, nil })
+				return err
+			},
+			"AcquireLockOpts": func() error {
+				l, err := AcquireLockOpts(dir, opts)
+				if err == nil {
+					l.Release()
+				}
+				return err
+			},
+		}
+		for name, fn := range variants {
+			start := time.Now()
+			err := fn()
+			if !errors.Is(err, ErrLockTimeout) {
+				t.Errorf("strategy %v: %s: expected lock timeout, got %v", strategy, name, err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("strategy %v: %s: timeout not honored, waited %v", strategy, name, elapsed)
+			}
+		}
+	}
+}
+
+func TestLockOptions_StaleAgeDefault(t *testing.T) {
+	if got := (LockOptions{}).withDefaults().StaleAge; got != staleLockAge {
+		t.Errorf("default StaleAge = %v, want %v", got, staleLockAge)
+	}
+	if got := (LockOptions{StaleAge: time.Second}).withDefaults().StaleAge; got != time.Second {
+		t.Errorf("explicit StaleAge overridden: %v", got)
+	}
+}
+
+// --- Portable (link) strategy tests ---
+
+func TestLockLinked_MutualExclusion(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+
+	var current, maxConcurrent int64
+	var wg sync.WaitGroup
+
+	// Call the strategy directly so goroutines contend on the filesystem
+	// rather than being serialized by the in-process layer.
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				unlock, err := lockLinked(lockPath, defaultAcquireParams())
+				if err != nil {
+					t.Errorf("lockLinked failed: %v", err)
+					return
+				}
+				cur := atomic.AddInt64(&current, 1)
+				for {
+					old := atomic.LoadInt64(&maxConcurrent)
+					if cur <= old || atomic.CompareAndSwapInt64(&maxConcurrent, old, cur) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt64(&current, -1)
+				unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxConcurrent > 1 {
+		t.Errorf("portable lock admitted %d holders concurrently", maxConcurrent)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Errorf("expected no leftover files, got %v", names)
+	}
+}
+
+func TestWithLockStrategy_PortableRecordsHolder(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WithLockStrategy(dir, StrategyPortable, func() error {
+		h, found, err := LockInfo(dir)
+		if err != nil || !found {
+			t.Fatalf("expected holder info, found=%v err=%v", found, err)
+		}
+		if h.PID != os.Getpid() {
+			t.Errorf("got pid=%d, want %d", h.PID, os.Getpid())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLockStrategy failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, ".lock")); !os.IsNotExist(err) {
+		t.Errorf("portable lock file should be removed on release: %v", err)
+	}
+}
+
+func TestWithLockStrategy_PortableTakesOverStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	host, _ := os.Hostname()
+	writeHolder(t, dir, LockHolder{PID: deadPID(t), Hostname: host})
+
+	ok := runsWithin(5*time.Second, func() {
+		if err := WithLockStrategy(dir, StrategyPortable, func() error { return nil }); err != nil {
+			t.Errorf("WithLockStrategy failed: %v", err)
+		}
+	})
+	if !ok {
+		t.Fatal("portable strategy did not take over a stale lock")
+	}
+}
+
+// --- Lock freshness tests ---
+
+// remoteHolder is holder metadata that can only be judged stale by age.
+var remoteHolder = LockHolder{PID: 4242, Hostname: "some-other-host"}
+
+func TestLockExclusiveCreate_LongHolderNotStolen(t *testing.T) {
+	clk := useClock(t)
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+	staleAge := 150 * time.Millisecond
+
+	unlock, err := lockExclusiveCreate(lockPath, newAcquireParams(context.Background(), LockOptions{StaleAge: staleAge}, false))
+	if err != nil {
+		t.Fatalf("lockExclusiveCreate failed: %v", err)
+	}
+	defer unlock()
+
+	// Make the holder look remote so only the mtime protects it.
+	writeHolder(t, dir, remoteHolder)
+
+	// The holder's toucher and the waiter's retry sleep: the holder outlives StaleAge
+	// many times over without being stolen.
+	err = driveUntil(clk, 2, 10*time.Millisecond, func() error {
+		p := newAcquireParams(context.Background(), LockOptions{Timeout: 2 * time.Second, StaleAge: staleAge}, false)
+		stolen, err := lockExclusiveCreate(lockPath, p)
+		if err == nil {
+			stolen()
+			t.Error("a live long-running holder had its lock stolen")
+		}
+		return err
+	})
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("expected lock timeout, got %v", err)
+	}
+}
+
+func TestLockExclusiveCreate_AbandonedLockStolen(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := writeHolder(t, dir, remoteHolder)
+	clk := useClock(t)
+
+	err := driveUntil(clk, 1, 10*time.Millisecond, func() error {
+		p := newAcquireParams(context.Background(), LockOptions{Timeout: 2 * time.Second, StaleAge: 150 * time.Millisecond}, false)
+		unlock, err := lockExclusiveCreate(lockPath, p)
+		if err == nil {
+			unlock()
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("abandoned lock was not taken over: %v", err)
+	}
+}
+
+// --- WithLockValue tests ---
+
+func TestWithLockValue_ReturnsResult(t *testing.T) {
+	dir := t.TempDir()
+
+	got, err := WithLockValue(dir, func() (int, error) {
+		return 42, nil
+	})
+	if err != nil {
+		t.Fatalf("WithLockValue failed: %v", err)
+	}
+	if got != 42 {
+		t.Errorf("got %d, want 42", got)
+	}
+}
+
+func TestWithLockValue_PropagatesFnError(t *testing.T) {
+	dir := t.TempDir()
+	sentinel := errors.New("boom")
+
+	got, err := WithLockValue(dir, func() (string, error) {
+		return "partial", sentinel
+	})
+	if !errors.Is(err, sentinel) {
+		t.Errorf("expected fn error, got %v", err)
+	}
+	if got != "partial" {
+		t.Errorf("got %q, want fn's value alongside its error", got)
+	}
+}
+
+func TestWithLockValueContext_TimeoutReturnsZero(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	got, err := WithLockValueContext(ctx, dir, func() (*testItem, error) {
+		t.Error("fn should not run")
+		return &testItem{Name: "x"}, nil
+	})
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("expected lock timeout, got %v", err)
+	}
+	if got != nil {
+		t.Errorf("expected zero value on timeout, got %+v", got)
+	}
+}
+
+func TestWithLockValueOpts_Strategies(t *testing.T) {
+	for _, strategy := range []LockStrategy{StrategyDefault, StrategyPortable} {
+		dir := t.TempDir()
+
+		got, err := WithLockValueOpts(dir, LockOptions{Strategy: strategy}, func() (int, error) {
+			h, found, _ := LockInfo(dir)
+			if !found || h.PID != os.Getpid() {
+				t.Errorf("strategy %d: lock not held during fn", strategy)
+			}
+			return 7, nil
+		})
+		if err != nil {
+			t.Fatalf("strategy %d: WithLockValueOpts failed: %v", strategy, err)
+		}
+		if got != 7 {
+			t.Errorf("strategy %d: got %d, want 7", strategy, got)
+		}
+	}
+}
+
+// --- LockTimeoutError tests ---
+
+func TestLockTimeoutError_StructuredFields(t *testing.T) {
+	dir := t.TempDir()
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	err = WithLockOpts(dir, LockOptions{Timeout: 40 * time.Millisecond}, func() error { return nil })
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("expected ErrLockTimeout, got %v", err)
+	}
+
+	var te *LockTimeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected *LockTimeoutError, got %T", err)
+	}
+	if te.Dir != dir {
+		t.Errorf("got Dir=%q, want %q", te.Dir, dir)
+	}
+	if te.Path != filepath.Join(dir, ".lock") {
+		t.Errorf("got Path=%q", te.Path)
+	}
+	if te.Waited != 40*time.Millisecond {
+		t.Errorf("got Waited=%v, want 40ms", te.Waited)
+	}
+	if te.Holder == nil || te.Holder.PID != os.Getpid() {
+		t.Errorf("expected holder with our pid, got %+v", te.Holder)
+	}
+}
+
+func TestLockTimeoutError_FromOSLevelWait(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, ".lock")
+
+	unlock, err := lockLinked(lockPath, defaultAcquireParams())
+	if err != nil {
+		t.Fatalf("lockLinked failed: %v", err)
+	}
+	defer unlock()
+
+	p := newAcquireParams(context.Background(), LockOptions{Timeout: 40 * time.Millisecond}, false)
+	p.dir = dir
+	_, err = lockLinked(lockPath, p)
+
+	var te *LockTimeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected *LockTimeoutError, got %v", err)
+	}
+	if te.Dir != dir || te.Holder == nil {
+		t.Errorf("unexpected fields: %+v", te)
+	}
+}
+
+// --- Panic safety tests ---
+
+// panicUnderLock runs a panicking critical section and recovers the panic.
+func panicUnderLock(t *testing.T, dir string, strategy LockStrategy) {
+	t.Helper()
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("expected panic %q to propagate, got %v", "boom", r)
+		}
+	}()
+
+	WithLockStrategy(dir, strategy, func() error {
+		panic("boom")
+	})
+}
+
+func TestWithLock_PanicReleasesLock(t *testing.T) {
+	for _, strategy := range []LockStrategy{StrategyDefault, StrategyPortable} {
+		dir := t.TempDir()
+
+		panicUnderLock(t, dir, strategy)
+
+		if strategy == StrategyPortable {
+			if _, err := os.Stat(filepath.Join(dir, ".lock")); !os.IsNotExist(err) {
+				t.Errorf("portable lock file lingered after panic: %v", err)
+			}
+		}
+
+		ok, err := TryWithLock(dir, func() error { return nil })
+		if err != nil {
+			t.Fatalf("strategy %d: TryWithLock failed: %v", strategy, err)
+		}
+		if !ok {
+			t.Errorf("strategy %d: lock still held after a recovered panic", strategy)
+		}
+	}
+}
+
+// --- SetLockDir tests ---
+
+func TestSetLockDir_RedirectsAllLockFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	lockBase := t.TempDir()
+
+	SetLockDir(HashedLockDir(lockBase))
+	t.Cleanup(func() { SetLockDir(nil) })
+
+	mapped := HashedLockDir(lockBase)(dataDir)
+
+	err := WithLock(dataDir, func() error {
+		h, found, err := LockInfo(dataDir)
+		if err != nil || !found || h.PID != os.Getpid() {
+			t.Errorf("LockInfo did not follow the mapping: found=%v err=%v", found, err)
+		}
+		if _, err := os.Stat(filepath.Join(mapped, ".lock")); err != nil {
+			t.Errorf("expected lock file in mapped dir: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+
+	if _, err := TryWithLock(dataDir, func() error { return nil }); err != nil {
+		t.Fatalf("TryWithLock failed: %v", err)
+	}
+	if err := WithNamedLock(dataDir, "posts", func() error { return nil }); err != nil {
+		t.Fatalf("WithNamedLock failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(mapped, ".locks", "posts.lock")); err != nil {
+		t.Errorf("expected named lock in mapped dir: %v", err)
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("data dir should stay untouched, has %d entries", len(entries))
+	}
+}
+
+func TestHashedLockDir_DistinctPerDataDir(t *testing.T) {
+	base := t.TempDir()
+	mapper := HashedLockDir(base)
+
+	a := mapper(filepath.Join(base, "store-a"))
+	b := mapper(filepath.Join(base, "store-b"))
+	if a == b {
+		t.Errorf("different data dirs mapped to the same lock dir %q", a)
+	}
+
+	if again := mapper(filepath.Join(base, "store-a") + string(filepath.Separator)); again != a {
+		t.Errorf("equivalent paths mapped differently: %q vs %q", again, a)
+	}
+}
+
+// --- Locker tests ---
+
+// keyRecorder is a Locker that records the keys it is asked to lock.
+type keyRecorder struct {
+	MemoryLocker
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *keyRecorder) WithLock(ctx context.Context, key string, fn func() error) error {
+	r.mu.Lock()
+	r.keys = append(r.keys, key)
+	r.mu.Unlock()
+	return r.MemoryLocker.WithLock(ctx, key, fn)
+}
+
+// useLocker installs l for the duration of the test.
+func useLocker(t *testing.T, l Locker) {
+	t.Helper()
+	SetLocker(l)
+	t.Cleanup(func() { SetLocker(nil) })
+}
+
+func TestSetLocker_RoutesAllLockUsage(t *testing.T) {
+	dir := t.TempDir()
+	rec := &keyRecorder{}
+	useLocker(t, rec)
+
+	if err := WithLock(dir, func() error { return nil }); err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+	if err := WithNamedLock(dir, "My Posts", func() error { return nil }); err != nil {
+		t.Fatalf("WithNamedLock failed: %v", err)
+	}
+	if _, err := WithLockValue(dir, func() (int, error) { return 1, nil }); err != nil {
+		t.Fatalf("WithLockValue failed: %v", err)
+	}
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	l.Release()
+
+	want := []string{canonicalDir(dir), canonicalDir(dir) + ":my-posts", canonicalDir(dir), canonicalDir(dir)}
+	if strings.Join(rec.keys, "|") != strings.Join(want, "|") {
+		t.Errorf("got keys %q, want %q", rec.keys, want)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("custom locker should not create lock files, dir has %d entries", len(entries))
+	}
+}
+
+func TestSetLocker_MemoryLockerExcludes(t *testing.T) {
+	dir := t.TempDir()
+	useLocker(t, &MemoryLocker{})
+
+	var active, maxActive int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := WithLock(dir, func() error {
+				n := atomic.AddInt32(&active, 1)
+				for {
+					m := atomic.LoadInt32(&maxActive)
+					if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&active, -1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("WithLock failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxActive != 1 {
+		t.Errorf("expected at most 1 holder at a time, saw %d", maxActive)
+	}
+}
+
+func TestSetLocker_TimeoutAndTry(t *testing.T) {
+	dir := t.TempDir()
+	mem := &MemoryLocker{}
+	useLocker(t, mem)
+
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go mem.WithLock(context.Background(), lockKey(dir, ""), func() error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+	defer close(release)
+
+	err := WithLockOpts(dir, LockOptions{Timeout: 50 * time.Millisecond}, func() error { return nil })
+	if !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("expected ErrLockTimeout, got %v", err)
+	}
+
+	ran, err := TryWithLock(dir, func() error { return nil })
+	if ran || err != nil {
+		t.Errorf("TryWithLock on busy key: got (%v, %v)", ran, err)
+	}
+}
+
+// blockingOnlyLocker implements Locker but not TryLocker.
+type blockingOnlyLocker struct{ mem MemoryLocker }
+
+func (b *blockingOnlyLocker) WithLock(ctx context.Context, key string, fn func() error) error {
+	return b.mem.WithLock(ctx, key, fn)
+}
+
+func TestSetLocker_TryUnsupported(t *testing.T) {
+	var l Locker = &blockingOnlyLocker{}
+	if _, ok := l.(TryLocker); ok {
+		t.Fatal("test locker unexpectedly implements TryLocker")
+	}
+	useLocker(t, l)
+
+	ran, err := TryWithLock(t.TempDir(), func() error { return nil })
+	if ran || err == nil {
+		t.Errorf("expected an error from TryWithLock, got (%v, %v)", ran, err)
+	}
+}
+
+func TestFileLocker_MatchesBuiltInLocks(t *testing.T) {
+	dir := t.TempDir()
+	useLocker(t, FileLocker{})
+
+	err := WithNamedLock(dir, "posts", func() error {
+		if _, err := os.Stat(filepath.Join(dir, ".locks", "posts.lock")); err != nil {
+			t.Errorf("expected named lock file: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithNamedLock failed: %v", err)
+	}
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	defer l.Release()
+
+	// The built-in path must see the FileLocker's lock as held.
+	SetLocker(nil)
+	ran, err := TryWithLock(dir, func() error { return nil })
+	if ran || err != nil {
+		t.Errorf("built-in TryWithLock should find the lock busy, got (%v, %v)", ran, err)
+	}
+}
+
+func TestSplitLockKey(t *testing.T) {
+	tests := []struct{ key, dir, name string }{
+		{"/data/notes", "/data/notes", ""},
+		{"/data/notes:posts", "/data/notes", "posts"},
+		{"/data/snap%3A2024", "/data/snap:2024", ""},
+		{"/data/snap%3A2024:posts", "/data/snap:2024", "posts"},
+		{"/data/100%25%3Adone", "/data/100%:done", ""},
+	}
+	if runtime.GOOS == "windows" {
+		tests = []struct{ key, dir, name string }{
+			{`C:\data`, `C:\data`, ""},
+			{`C:\data:posts`, `C:\data`, "posts"},
+			{`C:\data%25`, `C:\data%`, ""},
+		}
+	}
+	for _, tt := range tests {
+		dir, name := splitLockKey(tt.key)
+		if dir != tt.dir || name != tt.name {
+			t.Errorf("splitLockKey(%q) = (%q, %q), want (%q, %q)", tt.key, dir, name, tt.dir, tt.name)
+		}
+	}
+
+	// Keys round-trip whatever the directory is called.
+	for _, base := range []string{"notes", "snap:2024", "a%3Ab", "x:"} {
+		if runtime.GOOS == "windows" && strings.Contains(base, ":") {
+			continue
+		}
+		dir := filepath.Join(t.TempDir(), base)
+		for _, name := range []string{"", "posts"} {
+			gotDir, gotName := splitLockKey(lockKey(dir, name))
+			if gotDir != canonicalDir(dir) || gotName != name {
+				t.Errorf("splitLockKey(lockKey(%q, %q)) = (%q, %q)", dir, name, gotDir, gotName)
+			}
+		}
+	}
+}
+
+func TestFileLocker_ColonInDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("colons aren't allowed in Windows file names")
+	}
+	root := t.TempDir()
+	dir := filepath.Join(root, "snap:2024")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	useLocker(t, FileLocker{})
+
+	err := WithLock(dir, func() error {
+		if _, err := os.Stat(filepath.Join(dir, ".lock")); err != nil {
+			t.Errorf("expected %s/.lock: %v", dir, err)
+		}
+		// The built-in path must see the FileLocker's lock as held.
+		SetLocker(nil)
+		defer SetLocker(FileLocker{})
+		ran, err := TryWithLock(dir, func() error { return nil })
+		if ran || err != nil {
+			t.Errorf("built-in TryWithLock should find the lock busy, got (%v, %v)", ran, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "snap")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stray directory made: %v", err)
+	}
+}
+
+// --- Lock root tests ---
+
+// useLockRoots registers roots for the duration of the test.
+func useLockRoots(t *testing.T, roots ...string) {
+	t.Helper()
+	SetLockRoots(roots...)
+	t.Cleanup(func() { SetLockRoots() })
+}
+
+func TestWithRootLock_BlockingMatrix(t *testing.T) {
+	for _, strategy := range []LockStrategy{StrategyDefault, StrategyPortable} {
+		checkRootLockMatrix(t, strategy)
+	}
+}
+
+// checkRootLockMatrix verifies that collections under a root are independent of each
+// other and mutually exclusive with the root lock.
+func checkRootLockMatrix(t *testing.T, strategy LockStrategy) {
+	t.Helper()
+
+	root := t.TempDir()
+	a, b := filepath.Join(root, "a"), filepath.Join(root, "b")
+	useLockRoots(t, root)
+	opts := LockOptions{Timeout: 50 * time.Millisecond, Strategy: strategy}
+	noop := func() error { return nil }
+
+	// Collection vs collection: independent.
+	err := WithLockOpts(a, opts, func() error {
+		if err := WithLockOpts(b, opts, noop); err != nil {
+			t.Errorf("strategy %v: collection b blocked by collection a: %v", strategy, err)
+		}
+
+		// Collection vs root: the root waits for collection writers.
+		if err := WithRootLockOpts(root, opts, noop); !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("strategy %v: root lock taken while a collection was locked: %v", strategy, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("strategy %v: WithLockOpts failed: %v", strategy, err)
+	}
+
+	// Root vs collection: collection writers wait for the root holder.
+	err = WithRootLockOpts(root, opts, func() error {
+		for _, dir := range []string{a, b, root} {
+			if err := WithLockOpts(dir, opts, noop); !errors.Is(err, ErrLockTimeout) {
+				t.Errorf("strategy %v: %s locked during root lock: %v", strategy, dir, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("strategy %v: WithRootLockOpts failed: %v", strategy, err)
+	}
+
+	if err := WithLockOpts(a, opts, noop); err != nil {
+		t.Errorf("strategy %v: collection still blocked after root lock released: %v", strategy, err)
+	}
+}
+
+func TestWithRootLock_WaitsForCollectionWriters(t *testing.T) {
+	root := t.TempDir()
+	useLockRoots(t, root)
+
+	l, err := AcquireLock(filepath.Join(root, "posts"))
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	var released atomic.Bool
+	time.AfterFunc(50*time.Millisecond, func() {
+		released.Store(true)
+		l.Release()
+	})
+
+	err = WithRootLock(root, func() error {
+		if !released.Load() {
+			t.Error("root lock acquired while a collection writer was active")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithRootLock failed: %v", err)
+	}
+}
+
+func TestWithRootLock_TryWithLockReportsBusy(t *testing.T) {
+	root := t.TempDir()
+	useLockRoots(t, root)
+
+	err := WithRootLock(root, func() error {
+		ran, err := TryWithLock(filepath.Join(root, "posts"), func() error { return nil })
+		if ran || err != nil {
+			t.Errorf("TryWithLock during root lock: got (%v, %v)", ran, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithRootLock failed: %v", err)
+	}
+}
+
+func TestWithRootLock_IgnoresDirsOutsideRoots(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	useLockRoots(t, root)
+
+	err := WithRootLock(root, func() error {
+		ran, err := TryWithLock(outside, func() error { return nil })
+		if !ran || err != nil {
+			t.Errorf("dir outside the root was blocked: (%v, %v)", ran, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithRootLock failed: %v", err)
+	}
+}
+
+func TestReaderCount_StaleMarkerIgnored(t *testing.T) {
+	root := t.TempDir()
+	useLockRoots(t, root)
+
+	// A reader that died without removing its marker must not block the root forever.
+	readers := rootLockPath(root) + ".readers"
+	if err := EnsureDir(readers); err != nil {
+		t.Fatalf("EnsureDir failed: %v", err)
+	}
+	host, _ := os.Hostname()
+	data, _ := yaml.Marshal(LockHolder{PID: deadPID(t), Hostname: host})
+	if err := os.WriteFile(filepath.Join(readers, "dead"), data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	opts := LockOptions{Timeout: time.Second, Strategy: StrategyPortable}
+	if err := WithRootLockOpts(root, opts, func() error { return nil }); err != nil {
+		t.Fatalf("WithRootLockOpts failed: %v", err)
+	}
+	if entries, _ := os.ReadDir(readers); len(entries) != 0 {
+		t.Errorf("stale reader marker not cleaned up: %d entries", len(entries))
+	}
+}
+
+// --- Journal tests ---
+
+func TestJournal_SuccessClearsMarker(t *testing.T) {
+	dir := t.TempDir()
+
+	err := WithLockOpts(dir, LockOptions{Journal: true}, func() error {
+		dirty, h, err := IsDirty(dir)
+		if err != nil || !dirty || h == nil || h.PID != os.Getpid() {
+			t.Errorf("marker missing during critical section: (%v, %v, %v)", dirty, h, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLockOpts failed: %v", err)
+	}
+
+	if dirty, _, err := IsDirty(dir); err != nil || dirty {
+		t.Errorf("marker left after success: (%v, %v)", dirty, err)
+	}
+}
+
+func TestJournal_FailureLeavesMarker(t *testing.T) {
+	dir := t.TempDir()
+	boom := errors.New("boom")
+
+	err := WithLockOpts(dir, LockOptions{Journal: true}, func() error { return boom })
+
+	var dirtyErr *DirtyError
+	if !errors.As(err, &dirtyErr) || !errors.Is(err, boom) {
+		t.Fatalf("expected DirtyError wrapping boom, got %v", err)
+	}
+	if len(dirtyErr.Dirs) != 1 || dirtyErr.Dirs[0] != dir {
+		t.Errorf("got dirs %v, want [%s]", dirtyErr.Dirs, dir)
+	}
+
+	dirty, h, err := IsDirty(dir)
+	if err != nil || !dirty || h == nil || h.PID != os.Getpid() {
+		t.Fatalf("expected dirty dir naming this process, got (%v, %v, %v)", dirty, h, err)
+	}
+
+	if err := ClearDirty(dir); err != nil {
+		t.Fatalf("ClearDirty failed: %v", err)
+	}
+	if dirty, _, _ := IsDirty(dir); dirty {
+		t.Error("still dirty after ClearDirty")
+	}
+	if err := ClearDirty(dir); err != nil {
+		t.Errorf("ClearDirty on a clean dir should be a no-op, got %v", err)
+	}
+}
+
+func TestJournal_PanicLeavesMarker(t *testing.T) {
+	dir := t.TempDir()
+
+	func() {
+		defer func() { recover() }()
+		WithLockOpts(dir, LockOptions{Journal: true}, func() error { panic("boom") })
+	}()
+
+	if dirty, _, _ := IsDirty(dir); !dirty {
+		t.Error("panicking critical section should leave the dir dirty")
+	}
+	if ran, err := TryWithLock(dir, func() error { return nil }); !ran || err != nil {
+		t.Errorf("lock not released after panic: (%v, %v)", ran, err)
+	}
+}
+
+func TestJournal_OffByDefault(t *testing.T) {
+	dir := t.TempDir()
+
+	WithLock(dir, func() error {
+		if dirty, _, _ := IsDirty(dir); dirty {
+			t.Error("journal marker written without LockOptions.Journal")
+		}
+		return errors.New("boom")
+	})
+	if dirty, _, _ := IsDirty(dir); dirty {
+		t.Error("failed non-journaled section left a marker")
+	}
+}
+
+func TestJournal_NamedAndMultiLocks(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	opts := LockOptions{Journal: true}
+	boom := errors.New("boom")
+
+	if err := WithNamedLockOpts(a, "posts", opts, func() error { return boom }); !errors.Is(err, boom) {
+		t.Fatalf("expected boom, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(a, ".inprogress-posts")); err != nil {
+		t.Errorf("named lock marker missing: %v", err)
+	}
+	if dirty, _, _ := IsDirty(a); !dirty {
+		t.Error("named lock marker not reported by IsDirty")
+	}
+
+	err := WithLocksOpts([]string{a, b}, opts, func() error { return boom })
+	var dirtyErr *DirtyError
+	if !errors.As(err, &dirtyErr) || len(dirtyErr.Dirs) != 2 {
+		t.Fatalf("expected DirtyError for both dirs, got %v", err)
+	}
+	if dirty, _, _ := IsDirty(b); !dirty {
+		t.Error("multi-lock marker missing")
+	}
+
+	if _, err := WithLockValueOpts(b, opts, func() (int, error) { return 1, nil }); err != nil {
+		t.Fatalf("WithLockValueOpts failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(b, ".inprogress")); err == nil {
+		// The successful run rewrote and then removed the whole-dir marker.
+		t.Error("successful journaled run left its marker")
+	}
+}
+
+// --- Lease tests ---
+
+func TestWithLease_RenewalKeepsLease(t *testing.T) {
+	clk := useClock(t)
+	dir := t.TempDir()
+	ttl := 150 * time.Millisecond
+
+	err := WithLease(dir, ttl, func(ctx context.Context) error {
+		// The renewer and this wait: outlive the ttl many times over.
+		return driveUntil(clk, 2, 10*time.Millisecond, func() error {
+			select {
+			case <-ctx.Done():
+				return context.Cause(ctx)
+			case <-clk.After(20 * ttl):
+			}
+			if leaseExpired(leasePath(dir)) {
+				t.Error("renewed lease looks expired")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("WithLease failed: %v", err)
+	}
+	if _, err := os.Stat(leasePath(dir)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("lease file not removed on return: %v", err)
+	}
+}
+
+func TestWithLease_ExcludesWhileHeld(t *testing.T) {
+	clk := useClock(t)
+	dir := t.TempDir()
+	ttl := 150 * time.Millisecond
+
+	err := WithLease(dir, ttl, func(ctx context.Context) error {
+		// The holder's renewer and the second caller's retry sleep.
+		err := driveUntil(clk, 2, 50*time.Millisecond, func() error {
+			return WithLease(dir, ttl, func(context.Context) error {
+				t.Error("lease granted while another caller holds it")
+				return nil
+			})
+		})
+		if !errors.Is(err, ErrLockTimeout) {
+			t.Errorf("expected lock timeout, got %v", err)
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatalf("holder's lease failed: %v", err)
+	}
+}
+
+func TestWithLease_TakesOverExpiredLease(t *testing.T) {
+	dir := t.TempDir()
+	path := leasePath(dir)
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A remote holder that stopped renewing an hour ago.
+	rec := leaseRecord{
+		LockHolder: LockHolder{PID: 4242, Hostname: "some-other-host"},
+		Renewed:    StoredTime{time.Now().Add(-time.Hour)},
+		TTL:        "1s",
+	}
+	data, _ := yaml.Marshal(rec)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	ran := false
+	if err := WithLease(dir, time.Second, func(ctx context.Context) error { ran = true; return nil }); err != nil {
+		t.Fatalf("WithLease failed: %v", err)
+	}
+	if !ran || time.Since(start) > 2*time.Second {
+		t.Errorf("expired lease not taken over promptly (ran=%v, %v)", ran, time.Since(start))
+	}
+
+	matches, _ := filepath.Glob(path + ".aside-*")
+	if len(matches) != 0 {
+		t.Errorf("takeover left files behind: %v", matches)
+	}
+}
+
+func TestWithLease_WaitsForLiveLease(t *testing.T) {
+	dir := t.TempDir()
+	path := leasePath(dir)
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A remote holder that renewed just now is not taken over.
+	rec := leaseRecord{
+		LockHolder: LockHolder{PID: 4242, Hostname: "some-other-host"},
+		Renewed:    StoredTime{time.Now()},
+		TTL:        "1h",
+	}
+	data, _ := yaml.Marshal(rec)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if takeOverLease(path) {
+		t.Fatal("live lease taken over")
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != string(data) {
+		t.Errorf("live lease not restored after takeover attempt: %q, %v", got, err)
+	}
+}
+
+func TestWithLease_CancelsWhenLost(t *testing.T) {
+	clk := useClock(t)
+	dir := t.TempDir()
+	ttl := 150 * time.Millisecond
+
+	err := WithLease(dir, ttl, func(ctx context.Context) error {
+		// Simulate a takeover: the lease file is replaced by another holder's.
+		path := leasePath(dir)
+		os.Remove(path)
+		if err := os.WriteFile(path, []byte("pid: 1\nhostname: elsewhere\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		// The renewer and this wait.
+		return driveUntil(clk, 2, 10*time.Millisecond, func() error {
+			select {
+			case <-ctx.Done():
+				if !errors.Is(context.Cause(ctx), ErrLeaseLost) {
+					t.Errorf("unexpected cause: %v", context.Cause(ctx))
+				}
+				return ctx.Err()
+			case <-clk.After(5 * ttl):
+				t.Error("context not canceled after the lease was lost")
+				return nil
+			}
+		})
+	})
+	if !errors.Is(err, ErrLeaseLost) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected ErrLeaseLost joined with fn's error, got %v", err)
+	}
+
+	// Releasing must leave the new holder's lease alone.
+	if got, _ := os.ReadFile(leasePath(dir)); !strings.Contains(string(got), "elsewhere") {
+		t.Errorf("release removed another holder's lease: %q", got)
+	}
+}
+
+func TestWithLease_RejectsNonPositiveTTL(t *testing.T) {
+	if err := WithLease(t.TempDir(), 0, func(context.Context) error { return nil }); err == nil {
+		t.Error("expected error for zero ttl")
+	}
+}
+
+// --- WithLockTracked tests ---
+
+func TestWithLockTracked_ReentryFailsFast(t *testing.T) {
+	dir := t.TempDir()
+
+	var inner error
+	start := time.Now()
+	err := WithLockTracked(context.Background(), dir, func(ctx context.Context) error {
+		// Without tracking this waits on itself until the 10s lock timeout.
+		inner = WithLockContext(ctx, dir, func() error { return nil })
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithLockTracked failed: %v", err)
+	}
+	if !errors.Is(inner, ErrLockAlreadyHeld) {
+		t.Errorf("expected ErrLockAlreadyHeld, got %v", inner)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("re-entry took %v to fail", elapsed)
+	}
+}
+
+func TestWithLockTracked_NestedDifferentLocks(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+
+	err := WithLockTracked(context.Background(), a, func(ctx context.Context) error {
+		return WithLockTracked(ctx, b, func(ctx context.Context) error {
+			if _, err := WithLockValueContext(ctx, a, func() (int, error) { return 0, nil }); !errors.Is(err, ErrLockAlreadyHeld) {
+				t.Errorf("outer lock not tracked through nested call: %v", err)
+			}
+			// Named locks are independent of the whole-directory lock.
+			return WithNamedLock(a, "posts", func() error { return nil })
+		})
+	})
+	if err != nil {
+		t.Fatalf("nested locks on different dirs failed: %v", err)
+	}
+
+	// After release, the same ctx locks normally.
+	if err := WithLockContext(context.Background(), a, func() error { return nil }); err != nil {
+		t.Errorf("lock after tracked release failed: %v", err)
+	}
+}
+
+func TestWithLockTracked_OtherGoroutinesStillWait(t *testing.T) {
+	dir := t.TempDir()
+	released := make(chan struct{})
+
+	var other error
+	var wg sync.WaitGroup
+	err := WithLockTracked(context.Background(), dir, func(ctx context.Context) error {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// A ctx without the record waits for the lock instead of failing.
+			other = WithLockContext(context.Background(), dir, func() error {
+				select {
+				case <-released:
+				default:
+					t.Error("lock granted while still held")
+				}
+				return nil
+			})
+		}()
+		waitForQueue(t, dir, 1)
+		close(released)
+		return nil
+	})
+	wg.Wait()
+	if err != nil || other != nil {
+		t.Errorf("unexpected errors: %v, %v", err, other)
+	}
+}
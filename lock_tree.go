@@ -0,0 +1,233 @@
+// ABOUTME: Hierarchical locks: writers under a lock root share its root lock, WithRootLock takes it exclusively.
+// ABOUTME: Provides SetLockRoots and WithRootLock, plus a reader-count convention for strategies without shared locks.
+package mdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+var currentLockRoots atomic.Pointer[[]string]
+
+// SetLockRoots declares directories whose whole subtree can be locked at once with
+// WithRootLock. Once set, every lock on a directory inside a root (including the root
+// itself, and named locks) first takes a shared lock on the root's lock file, so:
+//
+//   - writers of different collections under one root stay independent of each other;
+//   - WithRootLock(root) waits for all of them to finish, and blocks new ones until it returns.
+//
+// Like SetLockDir, this must be configured identically in every process sharing the
+// store. Root locks are not taken through a custom Locker (see SetLocker). Calling
+// SetLockRoots with no arguments removes all roots.
+func SetLockRoots(roots ...string) {
+	if len(roots) == 0 {
+		currentLockRoots.Store(nil)
+		return
+	}
+
+	canon := make([]string, len(roots))
+	for i, root := range roots {
+		canon[i] = canonicalDir(root)
+	}
+	// Outermost roots first, so nested roots are always locked in the same order.
+	sort.Slice(canon, func(i, j int) bool { return len(canon[i]) < len(canon[j]) })
+	currentLockRoots.Store(&canon)
+}
+
+// WithRootLock runs fn while holding root's lock exclusively, which excludes every
+// lock under root (see SetLockRoots). It waits for current holders to finish.
+func WithRootLock(root string, fn func() error) error {
+	return WithRootLockOpts(root, LockOptions{}, fn)
+}
+
+// WithRootLockOpts is WithRootLock with explicit tuning, like WithLockOpts.
+func WithRootLockOpts(root string, opts LockOptions, fn func() error) error {
+	if err := checkLockWritable(root, ""); err != nil {
+		return err
+	}
+
+	p := newAcquireParams(context.Background(), opts, false)
+	p.dir = root
+
+	// An enclosing root's maintenance must still exclude this one.
+	releaseOuter, err := acquireRootsShared(root, p, true)
+	if err != nil {
+		return err
+	}
+	if releaseOuter != nil {
+		defer releaseOuter()
+	}
+
+	unlock, err := lockRoot(root, p, false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fn()
+}
+
+// rootLockPath returns the lock file guarding root's subtree.
+func rootLockPath(root string) string {
+	return filepath.Join(lockBaseDir(root), ".root.lock")
+}
+
+// lockRootsOf returns the registered roots containing dir, outermost first.
+// With excludeSelf set, a root equal to dir is left out.
+func lockRootsOf(dir string, excludeSelf bool) []string {
+	p := currentLockRoots.Load()
+	if p == nil {
+		return nil
+	}
+
+	c := canonicalDir(dir)
+	var roots []string
+	for _, root := range *p {
+		if c == root && !excludeSelf || strings.HasPrefix(c, root+string(filepath.Separator)) {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// acquireRootsShared takes a shared lock on every root containing dir. It returns a nil
+// release function when dir is under no root.
+func acquireRootsShared(dir string, p acquireParams, excludeSelf bool) (func() error, error) {
+	roots := lockRootsOf(dir, excludeSelf)
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	held := make([]func() error, 0, len(roots))
+	release := func() error {
+		var err error
+		for i := len(held) - 1; i >= 0; i-- {
+			if uerr := held[i](); err == nil {
+				err = uerr
+			}
+		}
+		return err
+	}
+
+	for _, root := range roots {
+		unlock, err := lockRoot(root, p, true)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, unlock)
+	}
+	return release, nil
+}
+
+// lockRoot takes root's lock file in shared or exclusive mode using p's strategy.
+func lockRoot(root string, p acquireParams, shared bool) (func() error, error) {
+	lockPath := rootLockPath(root)
+	if err := EnsureDir(filepath.Dir(lockPath)); err != nil {
+		return nil, err
+	}
+
+	var exclusive func(string, acquireParams) (func() error, error)
+	switch p.opts.Strategy {
+	case StrategyDefault:
+		if shared {
+			return lockTreeShared(lockPath, p)
+		}
+		return lockTreeExclusive(lockPath, p)
+	case StrategyPortable:
+		exclusive = lockLinked
+	case StrategyFcntl:
+		// fcntl locks are per process, so goroutines must be kept apart in-process.
+		exclusive = func(lockPath string, p acquireParams) (func() error, error) {
+			unlock, _, err := acquirePath(lockPath, p)
+			return unlock, err
+		}
+	default:
+		return nil, fmt.Errorf("mdstore: unknown lock strategy %d", p.opts.Strategy)
+	}
+
+	if shared {
+		return readerCountShared(lockPath, p, exclusive)
+	}
+	return readerCountExclusive(lockPath, p, exclusive)
+}
+
+// readerCountShared implements a shared lock for strategies that only offer exclusive
+// locks. Under the exclusive lock (so no exclusive holder is active), the reader leaves
+// a marker file in <lockPath>.readers and then releases the exclusive lock. Markers
+// record their holder and are kept fresh, so abandoned ones are detected as stale.
+func readerCountShared(lockPath string, p acquireParams, exclusive func(string, acquireParams) (func() error, error)) (func() error, error) {
+	unlock, err := exclusive(lockPath, p)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	readers := lockPath + ".readers"
+	if err := EnsureDir(readers); err != nil {
+		return nil, err
+	}
+	marker := filepath.Join(readers, fmt.Sprintf("%d-%x", os.Getpid(), rand.Uint64()))
+	if err := os.WriteFile(marker, holderPayload(), 0o644); err != nil {
+		return nil, err
+	}
+	stopTouching := startLockToucher(marker, p.opts.StaleAge)
+
+	return func() error {
+		stopTouching()
+		err := os.Remove(marker)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}, nil
+}
+
+// readerCountExclusive takes the exclusive lock, which stops new readers, and then
+// waits until every live reader marker is gone.
+func readerCountExclusive(lockPath string, p acquireParams, exclusive func(string, acquireParams) (func() error, error)) (func() error, error) {
+	unlock, err := exclusive(lockPath, p)
+	if err != nil {
+		return nil, err
+	}
+
+	readers := lockPath + ".readers"
+	err = p.poll(lockPath, func() (bool, error) {
+		return noLiveReaders(readers, p)
+	})
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// noLiveReaders reports whether the readers directory holds no live markers,
+// removing markers left behind by readers that died.
+func noLiveReaders(readers string, p acquireParams) (bool, error) {
+	entries, err := os.ReadDir(readers)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	for _, e := range entries {
+		marker := filepath.Join(readers, e.Name())
+		stale, err := lockIsStale(marker, p.opts.StaleAge)
+		if err != nil || !stale {
+			return false, nil
+		}
+		os.Remove(marker)
+	}
+	return true, nil
+}
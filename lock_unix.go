@@ -1,35 +1,118 @@
-// ABOUTME: Unix implementation of WithLock using syscall.Flock (LOCK_EX).
-// ABOUTME: Provides exclusive file locking for serializing writes on Unix systems.
+// ABOUTME: Unix implementation of lockFile using syscall.Flock (LOCK_EX|LOCK_NB) polling on cached fds.
+// ABOUTME: Provides exclusive file locking for writes, and shared/exclusive root locks, on Unix systems.
 
 //go:build !windows
 
 package mdstore
 
 import (
+	"errors"
 	"os"
-	"path/filepath"
 	"syscall"
 )
 
-// WithLock acquires an exclusive file lock on <dir>/.lock, executes fn, then releases.
-// Only serializes writes — reads don't need locking.
-func WithLock(dir string, fn func() error) error {
-	lockPath := filepath.Join(dir, ".lock")
+// lockFile acquires an exclusive flock on lockPath and returns a function that releases it.
+// Polls with LOCK_NB so acquisition honors p's timeout and cancellation, matching Windows.
+// The file descriptor comes from, and is returned to, the lock fd cache (see lockFDCache).
+func lockFile(lockPath string, p acquireParams) (func() error, error) {
+	return flockPath(lockPath, p, syscall.LOCK_EX)
+}
+
+// lockTreeShared takes a shared flock on a root lock file (see SetLockRoots).
+func lockTreeShared(lockPath string, p acquireParams) (func() error, error) {
+	return flockPath(lockPath, p, syscall.LOCK_SH)
+}
+
+// lockTreeExclusive takes an exclusive flock on a root lock file, which waits out
+// every shared holder.
+func lockTreeExclusive(lockPath string, p acquireParams) (func() error, error) {
+	return flockPath(lockPath, p, syscall.LOCK_EX)
+}
+
+// flockPath implements lockFile for either lock mode. Only exclusive holders record
+// themselves in the file, since shared holders would overwrite each other.
+func flockPath(lockPath string, p acquireParams, how int) (func() error, error) {
+	fd, err := lockFDs.get(lockPath)
+	if err != nil {
+		return nil, err
+	}
+	exclusive := how == syscall.LOCK_EX
+
+	err = p.poll(lockPath, func() (bool, error) {
+		for {
+			err := syscall.Flock(int(fd.f.Fd()), how|syscall.LOCK_NB)
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			if fd.current() {
+				return true, nil
+			}
 
-	if err := EnsureDir(dir); err != nil {
-		return err
+			// The file was removed or replaced while we waited; lock the new one instead.
+			syscall.Flock(int(fd.f.Fd()), syscall.LOCK_UN)
+			if err := fd.reopen(); err != nil {
+				return false, err
+			}
+		}
+	})
+	if err != nil {
+		lockFDs.drop(fd)
+		return nil, err
+	}
+
+	// Record the holder best-effort; diagnostics must never fail an acquisition.
+	var written int
+	if exclusive {
+		written = fd.writeHolder(holderPayload())
 	}
 
-	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	return func() error {
+		// Clear holder info so an unlocked file doesn't name a stale owner.
+		// Unlocking an fd whose file was unlinked is harmless; it is revalidated after the next flock.
+		if exclusive {
+			fd.blank(written)
+		}
+		if err := syscall.Flock(int(fd.f.Fd()), syscall.LOCK_UN); err != nil {
+			lockFDs.drop(fd)
+			return err
+		}
+		lockFDs.put(fd)
+		return nil
+	}, nil
+}
+
+// probeOSLock reports whether another file descriptor holds a flock on lockPath, or
+// another process an fcntl lock (StrategyFcntl), which flock doesn't conflict with.
+// It briefly takes the flock on a separate descriptor and releases it immediately,
+// and asks after fcntl locks with F_GETLK, so it never blocks or disturbs a real
+// holder. Returns fs.ErrNotExist if lockPath is missing.
+func probeOSLock(lockPath string) (bool, error) {
+	f, err := os.Open(lockPath)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer f.Close()
 
-	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
-		return err
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return true, nil
 	}
-	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	if err != nil {
+		return false, err
+	}
+	syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	return fcntlLockedByOther(f)
+}
 
-	return fn()
+// pidAlive reports whether a process with the given PID is running on this host.
+// Uses signal 0, which checks existence and permissions without delivering a signal.
+func pidAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
 }
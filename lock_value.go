@@ -0,0 +1,37 @@
+// ABOUTME: Generic lock helpers that return a value from the critical section.
+// ABOUTME: Provides WithLockValue and its context and options variants.
+package mdstore
+
+import "context"
+
+// WithLockValue runs fn under the lock on dir and returns its result.
+// On acquisition failure the zero value of T is returned with the error.
+func WithLockValue[T any](dir string, fn func() (T, error)) (T, error) {
+	return lockValue(context.Background(), dir, LockOptions{}, fn)
+}
+
+// WithLockValueContext is WithLockValue with cancellation, like WithLockContext.
+func WithLockValueContext[T any](ctx context.Context, dir string, fn func() (T, error)) (T, error) {
+	return lockValue(ctx, dir, LockOptions{}, fn)
+}
+
+// WithLockValueOpts is WithLockValue with explicit tuning and strategy, like WithLockOpts.
+func WithLockValueOpts[T any](dir string, opts LockOptions, fn func() (T, error)) (T, error) {
+	return lockValue(context.Background(), dir, opts, fn)
+}
+
+func lockValue[T any](ctx context.Context, dir string, opts LockOptions, fn func() (T, error)) (T, error) {
+	l, err := acquireLock(ctx, dir, "", opts, false)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	var v T
+	err = l.run(func() error {
+		var err error
+		v, err = fn()
+		return err
+	})
+	return v, err
+}
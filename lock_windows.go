@@ -1,54 +1,152 @@
-// ABOUTME: Windows implementation of WithLock using O_CREATE|O_EXCL retry loop.
-// ABOUTME: Provides exclusive file locking with stale lock detection for Windows systems.
+// ABOUTME: Windows implementation of lockFile using LockFileEx on the .lock file handle.
+// ABOUTME: Falls back to O_CREATE|O_EXCL (and reader-count root locks) on filesystems without byte-range locks.
 
 //go:build windows
 
 package mdstore
 
 import (
-	"fmt"
+	"errors"
+	"io/fs"
 	"os"
-	"path/filepath"
-	"time"
-)
 
-const (
-	lockRetryInterval = 50 * time.Millisecond
-	lockTimeout       = 10 * time.Second
-	staleLockAge      = 30 * time.Second
+	"golang.org/x/sys/windows"
 )
 
-// WithLock acquires an exclusive file lock on <dir>/.lock, executes fn, then releases.
-// Uses O_CREATE|O_EXCL retry loop with stale lock detection on Windows.
-func WithLock(dir string, fn func() error) error {
-	lockPath := filepath.Join(dir, ".lock")
+// lockRangeOffsetHigh places the locked byte far past the holder metadata so
+// LockInfo can still read the file while the lock is held (Windows locks are mandatory).
+const lockRangeOffsetHigh = 0x7fffffff
+
+// stillActive is the exit code GetExitCodeProcess reports for a running process.
+const stillActive = 259
 
-	if err := EnsureDir(dir); err != nil {
-		return err
+// errLockFileExUnsupported signals that LockFileEx can't be used on this filesystem.
+var errLockFileExUnsupported = errors.New("mdstore: LockFileEx unsupported")
+
+// lockFile acquires an exclusive lock on lockPath and returns a function that releases it.
+// Uses LockFileEx so the kernel releases the lock if the process dies; falls back to the
+// O_EXCL retry loop with stale detection when LockFileEx fails.
+func lockFile(lockPath string, p acquireParams) (func() error, error) {
+	unlock, err := lockFileEx(lockPath, p, true)
+	if errors.Is(err, errLockFileExUnsupported) {
+		return lockExclusiveCreate(lockPath, p)
 	}
+	return unlock, err
+}
 
-	deadline := time.Now().Add(lockTimeout)
+// lockTreeShared takes a shared LockFileEx lock on a root lock file (see SetLockRoots),
+// falling back to the reader-count convention where byte-range locks are unsupported.
+func lockTreeShared(lockPath string, p acquireParams) (func() error, error) {
+	unlock, err := lockFileEx(lockPath, p, false)
+	if errors.Is(err, errLockFileExUnsupported) {
+		return readerCountShared(lockPath, p, lockExclusiveCreate)
+	}
+	return unlock, err
+}
 
-	for {
-		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
-		if err == nil {
-			// Lock acquired
-			f.Close()
-			defer os.Remove(lockPath)
-			return fn()
-		}
+// lockTreeExclusive takes an exclusive LockFileEx lock on a root lock file, which
+// waits out every shared holder, with the same fallback as lockTreeShared.
+func lockTreeExclusive(lockPath string, p acquireParams) (func() error, error) {
+	unlock, err := lockFileEx(lockPath, p, true)
+	if errors.Is(err, errLockFileExUnsupported) {
+		return readerCountExclusive(lockPath, p, lockExclusiveCreate)
+	}
+	return unlock, err
+}
+
+// lockFileEx acquires lockPath by polling a non-blocking LockFileEx, exclusively or
+// shared. Only exclusive holders record themselves in the file, since shared holders
+// would overwrite each other.
+func lockFileEx(lockPath string, p acquireParams, exclusive bool) (func() error, error) {
+	// Note whether we created the file: if LockFileEx turns out to be unsupported,
+	// a file we created would look like a held lock to the O_EXCL fallback.
+	created := true
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		created = false
+		f, err = os.OpenFile(lockPath, os.O_RDWR, 0o644)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h := windows.Handle(f.Fd())
+	ol := &windows.Overlapped{OffsetHigh: lockRangeOffsetHigh}
+
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if exclusive {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
 
-		// Check for stale lock
-		info, statErr := os.Stat(lockPath)
-		if statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+	err = p.poll(lockPath, func() (bool, error) {
+		err := windows.LockFileEx(h, flags, 0, 1, 0, ol)
+		if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+			return false, nil
+		}
+		if err != nil {
+			return false, errLockFileExUnsupported
+		}
+		return true, nil
+	})
+	if err != nil {
+		f.Close()
+		if created && errors.Is(err, errLockFileExUnsupported) {
 			os.Remove(lockPath)
-			continue
 		}
+		return nil, err
+	}
+
+	// Record the holder best-effort; diagnostics must never fail an acquisition.
+	if exclusive && f.Truncate(0) == nil {
+		f.WriteAt(holderPayload(), 0)
+	}
+
+	// probeOSLock can't see byte-range locks, so keep the file fresh for IsLocked,
+	// IsLockStale, and BreakLock, which judge it by its age.
+	stopTouching := startLockToucher(lockPath, p.opts.StaleAge)
 
-		if time.Now().After(deadline) {
-			return fmt.Errorf("mdstore: lock timeout after %v on %s", lockTimeout, lockPath)
+	return func() error {
+		stopTouching()
+		// Clear holder info so an unlocked file doesn't name a stale owner.
+		if exclusive {
+			f.Truncate(0)
 		}
+		windows.UnlockFileEx(h, 0, 1, 0, ol)
+		return f.Close()
+	}, nil
+}
+
+// probeOSLock only checks that lockPath exists. Rather than briefly taking the
+// byte-range lock, IsLocked judges Windows locks by the recorded holder and its
+// freshness: LockFileEx holders, like O_EXCL ones, refresh the file's mtime while
+// they run (see startLockToucher).
+func probeOSLock(lockPath string) (bool, error) {
+	_, err := os.Stat(lockPath)
+	return false, err
+}
+
+// lockFcntl reports that StrategyFcntl, a POSIX mechanism, is unavailable on Windows.
+func lockFcntl(lockPath string, p acquireParams) (func() error, error) {
+	return nil, errors.New("mdstore: StrategyFcntl is not supported on Windows")
+}
+
+// readHeldFcntl always reports false: Windows never holds fcntl locks.
+func readHeldFcntl(lockPath string) ([]byte, bool) {
+	return nil, false
+}
+
+// pidAlive reports whether a process with the given PID is running on this host.
+func pidAlive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// Access denied means the process exists but belongs to someone else.
+		return errors.Is(err, windows.ERROR_ACCESS_DENIED)
+	}
+	defer windows.CloseHandle(h)
 
-		time.Sleep(lockRetryInterval)
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return true
 	}
+	return code == stillActive
 }
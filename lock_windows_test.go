@@ -0,0 +1,49 @@
+// ABOUTME: Tests for the Windows LockFileEx strategy.
+// ABOUTME: Checks that holders keep the lock file fresh, since probeOSLock judges Windows locks by age.
+
+//go:build windows
+
+package mdstore
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFileEx_KeepsLockFresh(t *testing.T) {
+	clk := useClock(t)
+	lockPath := filepath.Join(t.TempDir(), ".lock")
+	staleAge := 150 * time.Millisecond
+
+	unlock, err := lockFileEx(lockPath, newAcquireParams(context.Background(), LockOptions{StaleAge: staleAge}, false), true)
+	if err != nil {
+		t.Fatalf("lockFileEx failed: %v", err)
+	}
+	defer unlock()
+
+	// Held for many times StaleAge, the file is touched every StaleAge/3.
+	for i := 0; i < 9; i++ {
+		for clk.Waiters() < 1 {
+			time.Sleep(time.Millisecond)
+		}
+		clk.Advance(staleAge / 3)
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+			info, err := os.Stat(lockPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if since(info.ModTime()) < staleAge/3 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("lock file not touched: %v old after %v held", since(info.ModTime()), time.Duration(i+1)*staleAge/3)
+			}
+		}
+	}
+	if stale, err := lockIsStale(lockPath, staleAge); err != nil || stale {
+		t.Errorf("lockIsStale = %v, %v for a live holder", stale, err)
+	}
+}
@@ -0,0 +1,73 @@
+// ABOUTME: Optional structured logging of lock and write diagnostics via log/slog.
+// ABOUTME: Provides SetLogger and SetSlowLockThreshold; silent unless a logger is installed.
+package mdstore
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// defaultSlowLockThreshold is how long an acquisition may wait before it is logged.
+const defaultSlowLockThreshold = time.Second
+
+var (
+	currentLogger     atomic.Pointer[slog.Logger]
+	slowLockThreshold atomic.Int64 // nanoseconds; 0 means defaultSlowLockThreshold
+)
+
+// SetLogger installs l to receive diagnostics: lock acquisitions still waiting after
+// the slow-lock threshold (Warn, with the current holder), stale lock removals (Warn),
+// abandoned Lock handles (Warn), and AtomicWrite failures (Error). Logging is best-effort
+// and never changes what a call returns. Pass nil to go back to logging nothing.
+func SetLogger(l *slog.Logger) {
+	currentLogger.Store(l)
+}
+
+// SetSlowLockThreshold sets how long a lock acquisition may wait before SetLogger's
+// logger is warned about it. Zero or negative restores the default of one second.
+func SetSlowLockThreshold(d time.Duration) {
+	slowLockThreshold.Store(int64(max(d, 0)))
+}
+
+// logf logs msg at level to the installed logger, if any.
+func logf(level slog.Level, msg string, attrs ...slog.Attr) {
+	if l := currentLogger.Load(); l != nil {
+		l.LogAttrs(context.Background(), level, msg, attrs...)
+	}
+}
+
+// watchSlowLock warns the installed logger if the acquisition of dir's lock (or named
+// lock) is still waiting after the slow-lock threshold. The returned function must be
+// called once acquisition finishes, successfully or not.
+func watchSlowLock(dir, name string, start time.Time) (stop func()) {
+	if currentLogger.Load() == nil {
+		return func() {}
+	}
+
+	threshold := time.Duration(slowLockThreshold.Load())
+	if threshold <= 0 {
+		threshold = defaultSlowLockThreshold
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-after(threshold):
+		}
+
+		attrs := []slog.Attr{
+			slog.String("dir", dir),
+			slog.String("name", name),
+			slog.Duration("waited", since(start)),
+		}
+		if h, found, _ := readLockHolder(lockPathFor(dir, name)); found {
+			attrs = append(attrs, slog.String("holder", h.String()))
+		}
+		logf(slog.LevelWarn, "mdstore: slow lock acquisition", attrs...)
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,156 @@
+// ABOUTME: Tests for the optional slog diagnostics installed with SetLogger.
+// ABOUTME: Covers slow lock warnings, stale lock removal, and AtomicWrite failures.
+package mdstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for the concurrent writes of a slog handler.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records decodes the JSON log lines written so far.
+func (b *syncBuffer) records(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("bad log line %q: %v", line, err)
+		}
+		out = append(out, rec)
+	}
+	return out
+}
+
+// captureLogs installs a JSON logger for the duration of the test.
+func captureLogs(t *testing.T) *syncBuffer {
+	t.Helper()
+	buf := &syncBuffer{}
+	SetLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { SetLogger(nil) })
+	return buf
+}
+
+func TestSetLogger_SlowLockWarning(t *testing.T) {
+	clk := useClock(t)
+	dir := t.TempDir()
+	logs := captureLogs(t)
+	SetSlowLockThreshold(20 * time.Millisecond)
+	t.Cleanup(func() { SetSlowLockThreshold(0) })
+
+	l, err := AcquireLock(dir)
+	if err != nil {
+		t.Fatalf("AcquireLock failed: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- WithLock(dir, func() error { return nil }) }()
+
+	// Once the waiter's slow-lock watcher and queue deadline are armed, pass the threshold.
+	for clk.Waiters() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(50 * time.Millisecond)
+
+	var rec map[string]any
+	for deadline := time.Now().Add(5 * time.Second); rec == nil && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, r := range logs.records(t) {
+			if r["msg"] == "mdstore: slow lock acquisition" {
+				rec = r
+			}
+		}
+	}
+	l.Release()
+	if err := <-done; err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+
+	if rec == nil {
+		t.Fatal("no slow lock warning logged")
+	}
+	if rec["level"] != "WARN" || rec["dir"] != dir || rec["waited"] == nil {
+		t.Errorf("unexpected record: %v", rec)
+	}
+	if holder, _ := rec["holder"].(string); !strings.Contains(holder, "pid") {
+		t.Errorf("expected holder info, got %v", rec)
+	}
+}
+
+func TestSetLogger_FastLockIsQuiet(t *testing.T) {
+	logs := captureLogs(t)
+
+	if err := WithLock(t.TempDir(), func() error { return nil }); err != nil {
+		t.Fatalf("WithLock failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if recs := logs.records(t); len(recs) != 0 {
+		t.Errorf("expected no logs for an uncontended lock, got %v", recs)
+	}
+}
+
+func TestSetLogger_StaleLockRemoval(t *testing.T) {
+	dir := t.TempDir()
+	logs := captureLogs(t)
+	lockPath := writeHolder(t, dir, remoteHolder)
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+
+	unlock, err := lockExclusiveCreate(lockPath, newAcquireParams(context.Background(), LockOptions{}, false))
+	if err != nil {
+		t.Fatalf("lockExclusiveCreate failed: %v", err)
+	}
+	unlock()
+
+	recs := logs.records(t)
+	if len(recs) != 1 || recs[0]["msg"] != "mdstore: removing stale lock" || recs[0]["path"] != lockPath {
+		t.Errorf("expected one stale lock record, got %v", recs)
+	}
+}
+
+func TestSetLogger_AtomicWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+	logs := captureLogs(t)
+
+	// A regular file where the parent directory should be makes the write fail.
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	path := filepath.Join(blocker, "out.yaml")
+
+	if err := AtomicWrite(path, []byte("x")); err == nil {
+		t.Fatal("expected AtomicWrite to fail")
+	}
+
+	recs := logs.records(t)
+	if len(recs) != 1 || recs[0]["level"] != "ERROR" || recs[0]["path"] != path || recs[0]["error"] == nil {
+		t.Errorf("expected one error record with path, got %v", recs)
+	}
+}
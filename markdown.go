@@ -0,0 +1,108 @@
+// ABOUTME: File-level helpers for markdown documents with YAML frontmatter.
+// ABOUTME: Provides ReadMarkdownFile and WriteMarkdownFile(Opts), composing the frontmatter helpers with ReadYAML-style reads and locked atomic writes.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// ReadMarkdownFile reads the markdown file at path and decodes its frontmatter into a
+// T (see DecodeFrontmatter), returning it with the body. Like ReadYAMLExists, a missing
+// file returns the zero T, an empty body, and found false, with no error; a file
+// without frontmatter returns the zero T and its whole content as the body. Line
+// endings are normalized to \n, and the body ends in a single newline unless it's
+// empty, as WriteMarkdownFile writes it.
+func ReadMarkdownFile[T any](path string) (meta T, body string, found bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return meta, "", false, nil
+		}
+		return meta, "", false, err
+	}
+	body, err = DecodeFrontmatter(path, string(data), &meta)
+	if err != nil {
+		var zero T
+		return zero, "", true, err
+	}
+	return meta, normalizeMarkdownBody(body), true, nil
+}
+
+// WriteMarkdownFile renders meta as frontmatter above body (see RenderFrontmatter) and
+// writes the result to path atomically, under WithLock on path's directory. The body
+// is written with a single trailing newline, or none if it's empty. If meta implements
+// Validator, it must pass first.
+func WriteMarkdownFile[T any](path string, meta T, body string) error {
+	return WriteMarkdownFileOpts(path, meta, body, MarkdownOptions{})
+}
+
+// MarkdownOptions controls WriteMarkdownFileOpts.
+type MarkdownOptions struct {
+	// MustValidate, if set, is a Schema the rendered frontmatter must pass (see
+	// ValidateFrontmatter). If it doesn't, nothing is written, and the error is a
+	// *ValidationError wrapping the SchemaErrors. It's checked whether or not the
+	// Validator hook is on (see SetValidation).
+	MustValidate Schema
+
+	// AutoFields, if set, names housekeeping fields filled in as the file is written:
+	// a slug made from the title, unique in the directory, and the times of the first
+	// and latest writes (see AutoFields and DefaultAutoFields). They're filled in
+	// under the directory lock, after a Validator on meta runs and before MustValidate
+	// is checked.
+	AutoFields *AutoFields
+}
+
+// WriteMarkdownFileOpts is WriteMarkdownFile with options.
+func WriteMarkdownFileOpts[T any](path string, meta T, body string, opts MarkdownOptions) error {
+	_, err := writeMarkdownFile(path, meta, body, opts, nil)
+	return err
+}
+
+// writeMarkdownFile is WriteMarkdownFileOpts that, if check is set, calls it under the
+// lock before writing, with the content rendered, writing nothing if it fails, and
+// returns the content written.
+func writeMarkdownFile[T any](path string, meta T, body string, opts MarkdownOptions, check func(content string) error) (string, error) {
+	content, err := RenderFrontmatter(meta, normalizeMarkdownBody(body))
+	if err != nil {
+		return "", err
+	}
+	err = WithLock(filepath.Dir(path), func() error {
+		if check != nil {
+			if err := check(content); err != nil {
+				return err
+			}
+		}
+		if opts.AutoFields != nil {
+			if content, err = fillAutoFields(path, content, *opts.AutoFields); err != nil {
+				return err
+			}
+		}
+		if opts.MustValidate != nil {
+			if errs := ValidateFrontmatter(content, opts.MustValidate); len(errs) > 0 {
+				return &ValidationError{Path: path, Err: SchemaErrors(errs)}
+			}
+		}
+		return AtomicWrite(path, []byte(content))
+	})
+	if err != nil {
+		return "", err
+	}
+	notifyGitWrite(path)
+	return content, nil
+}
+
+// normalizeMarkdownBody converts body's line endings to \n and makes it end with a
+// single newline, or leaves it empty if it's only whitespace.
+func normalizeMarkdownBody(body string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.TrimRightFunc(body, unicode.IsSpace)
+	if body == "" {
+		return ""
+	}
+	return body + "\n"
+}
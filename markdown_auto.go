@@ -0,0 +1,161 @@
+// ABOUTME: Housekeeping frontmatter fields kept by WriteMarkdownFileOpts: a unique slug and created/updated times.
+// ABOUTME: Provides AutoFields and DefaultAutoFields; the fields are filled in under the directory lock.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AutoFields names the frontmatter fields WriteMarkdownFileOpts keeps up to date (see
+// MarkdownOptions.AutoFields), by dotted path (see GetYAMLValue). A field left empty
+// here is left alone.
+type AutoFields struct {
+	// Slug, if empty in the metadata written, is set to the slug the file already has,
+	// or else to Slugify of the Title field, made unique among the markdown files
+	// beside it with UniqueSlug: their slug fields and their file names, less ".md".
+	Slug string
+
+	// Title is the field slugs are made from. Default "title".
+	Title string
+
+	// Created, if empty in the metadata written, is set to the file's created time
+	// when it has one, or else to the time of the write, so it's that of the first.
+	Created string
+
+	// Updated is set to the time of every write.
+	Updated string
+}
+
+// DefaultAutoFields names the usual fields: slug, title, created, and updated.
+var DefaultAutoFields = AutoFields{Slug: "slug", Title: "title", Created: "created", Updated: "updated"}
+
+// fillAutoFields sets the fields of content, rendered for the markdown file at path,
+// that fields names, as AutoFields describes. It's called under WithLock on path's
+// directory, so the slugs of the files beside it can't change meanwhile.
+func fillAutoFields(path, content string, fields AutoFields) (string, error) {
+	var meta, existing map[string]interface{}
+	if _, err := DecodeFrontmatter(path, content, &meta); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if _, err := DecodeFrontmatter(path, string(data), &existing); err != nil {
+			return "", err
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return "", err
+	}
+
+	set := make(map[string]interface{})
+	stamp := FormatTime(now())
+	if fields.Slug != "" && isBlankAutoField(meta, fields.Slug) {
+		if slug, ok := lookupMetaPath(existing, splitYAMLPath(fields.Slug)); ok && !isBlankAutoField(existing, fields.Slug) {
+			set[fields.Slug] = slug
+		} else {
+			titleField := fields.Title
+			if titleField == "" {
+				titleField = "title"
+			}
+			title, _ := lookupMetaPath(meta, splitYAMLPath(titleField))
+			taken, err := siblingSlugs(path, fields.Slug)
+			if err != nil {
+				return "", err
+			}
+			set[fields.Slug] = UniqueSlug(autoFieldText(title), func(s string) bool { return taken[s] })
+		}
+	}
+	if fields.Created != "" && isBlankAutoField(meta, fields.Created) {
+		if created, ok := lookupMetaPath(existing, splitYAMLPath(fields.Created)); ok && !isBlankAutoField(existing, fields.Created) {
+			set[fields.Created] = autoFieldText(created)
+		} else {
+			set[fields.Created] = stamp
+		}
+	}
+	if fields.Updated != "" {
+		set[fields.Updated] = stamp
+	}
+	if len(set) == 0 {
+		return content, nil
+	}
+
+	return updateFrontmatter(path, content, func(doc *yaml.Node) error {
+		for _, field := range []string{fields.Slug, fields.Created, fields.Updated} {
+			if value, ok := set[field]; ok {
+				if err := SetYAMLPath(doc, field, value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// isBlankAutoField reports whether the field at dotted in meta is missing, null, an
+// empty string, or the zero time, as a zero time.Time or StoredTime is written.
+func isBlankAutoField(meta map[string]interface{}, dotted string) bool {
+	v, ok := lookupMetaPath(meta, splitYAMLPath(dotted))
+	if !ok {
+		return true
+	}
+	switch v := v.(type) {
+	case nil:
+		return true
+	case time.Time:
+		return v.IsZero()
+	case string:
+		if t, err := ParseTime(v); err == nil {
+			return t.IsZero()
+		}
+		return strings.TrimSpace(v) == ""
+	}
+	return false
+}
+
+// autoFieldText is the text of a decoded frontmatter value, with times as FormatTime
+// writes them.
+func autoFieldText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return FormatTime(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// siblingSlugs returns the slugs taken by the markdown files in path's directory
+// other than path: their names without ".md", and their slug fields, at the dotted
+// path slugField. Hidden files are passed over, and so are the slug fields of files
+// whose frontmatter can't be read.
+func siblingSlugs(path, slugField string) (map[string]bool, error) {
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	taken := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".md" || name == filepath.Base(path) {
+			continue
+		}
+		taken[strings.TrimSuffix(name, ".md")] = true
+		meta, _, err := ReadFrontmatter[map[string]interface{}](filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		if slug, ok := lookupMetaPath(meta, splitYAMLPath(slugField)); ok && slug != nil {
+			taken[autoFieldText(slug)] = true
+		}
+	}
+	return taken, nil
+}
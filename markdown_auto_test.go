@@ -0,0 +1,136 @@
+// ABOUTME: Tests for WriteMarkdownFileOpts with AutoFields: slugs from titles, created and updated times.
+// ABOUTME: First saves, re-saves keeping created, explicit slugs, custom field names, and slug collisions.
+package mdstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type autoPost struct {
+	Title   string     `yaml:"title"`
+	Slug    string     `yaml:"slug,omitempty"`
+	Created StoredTime `yaml:"created,omitempty"`
+	Updated StoredTime `yaml:"updated,omitempty"`
+}
+
+var autoOpts = MarkdownOptions{AutoFields: &DefaultAutoFields}
+
+func TestWriteMarkdownFileOpts_AutoFields(t *testing.T) {
+	clk := useClock(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "post.md")
+	first := clk.Now()
+
+	// The first save fills in all three.
+	if err := WriteMarkdownFileOpts(path, autoPost{Title: "Hello, World!"}, "Body.", autoOpts); err != nil {
+		t.Fatal(err)
+	}
+	meta, body, _, err := ReadMarkdownFile[autoPost](path)
+	if err != nil || body != "Body.\n" {
+		t.Fatalf("ReadMarkdownFile: %v, %q", err, body)
+	}
+	if meta.Slug != "hello-world" || !meta.Created.Equal(first) || !meta.Updated.Equal(first) {
+		t.Errorf("after first save: %+v", meta)
+	}
+
+	// A re-save of metadata without them keeps the slug and created, and bumps updated.
+	clk.Advance(time.Hour)
+	if err := WriteMarkdownFileOpts(path, autoPost{Title: "Renamed"}, "Body.", autoOpts); err != nil {
+		t.Fatal(err)
+	}
+	meta, _, _, _ = ReadMarkdownFile[autoPost](path)
+	if meta.Slug != "hello-world" || !meta.Created.Equal(first) || !meta.Updated.Equal(first.Add(time.Hour)) {
+		t.Errorf("after re-save: %+v", meta)
+	}
+
+	// Values in the metadata are written as they are, updated aside.
+	clk.Advance(time.Hour)
+	created := first.Add(-24 * time.Hour)
+	explicit := autoPost{Title: "x", Slug: "my-own", Created: StoredTime{created}, Updated: StoredTime{created}}
+	if err := WriteMarkdownFileOpts(path, explicit, "", autoOpts); err != nil {
+		t.Fatal(err)
+	}
+	meta, _, _, _ = ReadMarkdownFile[autoPost](path)
+	if meta.Slug != "my-own" || !meta.Created.Equal(created) || !meta.Updated.Equal(first.Add(2*time.Hour)) {
+		t.Errorf("after explicit save: %+v", meta)
+	}
+
+	// Without AutoFields, nothing is added.
+	plain := filepath.Join(dir, "plain.md")
+	if err := WriteMarkdownFile(plain, autoPost{Title: "Plain"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFileString(t, plain); got != "---\ntitle: Plain\n---\n" {
+		t.Errorf("plain write = %q", got)
+	}
+}
+
+func TestWriteMarkdownFileOpts_AutoFieldsCollisions(t *testing.T) {
+	useClock(t)
+	dir := t.TempDir()
+	writeFileString(t, filepath.Join(dir, "hello.md"), "# A file named hello\n")
+	writeFileString(t, filepath.Join(dir, "other.md"), "---\nslug: hello-2\n---\n")
+	writeFileString(t, filepath.Join(dir, ".hidden.md"), "---\nslug: hello-3\n---\n")
+	writeFileString(t, filepath.Join(dir, "broken.md"), "---\nslug: [hello-4\n---\n")
+
+	path := filepath.Join(dir, "new.md")
+	if err := WriteMarkdownFileOpts(path, autoPost{Title: "Hello"}, "", autoOpts); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _, _, _ := ReadMarkdownFile[autoPost](path); meta.Slug != "hello-3" {
+		t.Errorf("slug = %q, want hello-3", meta.Slug)
+	}
+
+	// Concurrent saves under the directory lock never claim the same slug.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := filepath.Join(dir, fmt.Sprintf("concurrent-%d.md", i))
+			if err := WriteMarkdownFileOpts(p, autoPost{Title: "Same"}, "", autoOpts); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	seen := make(map[string]bool)
+	for i := 0; i < 8; i++ {
+		meta, _, _, err := ReadMarkdownFile[autoPost](filepath.Join(dir, fmt.Sprintf("concurrent-%d.md", i)))
+		if err != nil || seen[meta.Slug] {
+			t.Errorf("concurrent-%d: slug %q, %v", i, meta.Slug, err)
+		}
+		seen[meta.Slug] = true
+	}
+}
+
+func TestWriteMarkdownFileOpts_CustomAutoFields(t *testing.T) {
+	useClock(t)
+	path := filepath.Join(t.TempDir(), "doc.md")
+	fields := AutoFields{Slug: "meta.id", Title: "name", Updated: "meta.modified"}
+	meta := map[string]interface{}{"name": "Custom Names", "created": "left alone"}
+	if err := WriteMarkdownFileOpts(path, meta, "", MarkdownOptions{AutoFields: &fields}); err != nil {
+		t.Fatal(err)
+	}
+	got := readFileString(t, path)
+	for _, want := range []string{"id: custom-names\n", "modified: ", "created: left alone\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("file lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "slug:") || strings.Contains(got, "updated:") {
+		t.Errorf("default fields were written:\n%s", got)
+	}
+
+	// MustValidate sees the filled-in fields.
+	schema := Schema{"slug": {Required: true}}
+	err := WriteMarkdownFileOpts(filepath.Join(t.TempDir(), "v.md"), autoPost{Title: "V"}, "", MarkdownOptions{AutoFields: &DefaultAutoFields, MustValidate: schema})
+	if err != nil {
+		t.Errorf("MustValidate: %v", err)
+	}
+}
@@ -0,0 +1,307 @@
+// ABOUTME: Excerpts of markdown bodies for list views: the text before <!--more-->, or else the first paragraph.
+// ABOUTME: Provides ExtractExcerpt and ExcerptOptions; markdown is lightly stripped, and truncation keeps runes and emoji whole.
+package mdstore
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ExcerptOptions controls ExtractExcerpt's cutting of a first paragraph. The zero
+// value doesn't cut.
+type ExcerptOptions struct {
+	// MaxWords, if positive, is the most words, runs of text between spaces, kept.
+	MaxWords int
+
+	// MaxChars, if positive, is the most characters (runes) kept, ellipsis included.
+	// The cut falls between words, or between CJK characters, where it can, and never
+	// inside an emoji sequence or before a combining mark.
+	MaxChars int
+
+	// Ellipsis ends an excerpt that was cut with "…".
+	Ellipsis bool
+}
+
+var (
+	// excerptMarker matches the <!--more--> marker, with or without spaces inside.
+	excerptMarker = regexp.MustCompile(`<!--\s*more\s*-->`)
+
+	// excerptHTML matches an HTML comment or tag at the start of the text.
+	excerptHTML = regexp.MustCompile(`^(?:<!--.*?-->|</?[A-Za-z][A-Za-z0-9-]*(?:\s[^<>]*)?/?>)`)
+
+	// excerptBlockMarker matches a list item's marker, with any task box after it.
+	excerptBlockMarker = regexp.MustCompile(`^(?:[-*+]|\d{1,9}[.)])(?:[ \t]+\[[ xX]\])?(?:[ \t]+|$)`)
+)
+
+// ExtractExcerpt returns a plain-text teaser of the markdown document or body, whose
+// frontmatter, if any, is passed over. If body has a <!--more--> marker outside code
+// blocks, the excerpt is everything before it, uncut, with its paragraphs, headings
+// included, separated by blank lines. Otherwise it's the first paragraph, leaving out
+// headings and paragraphs with no text, such as a lone image, cut as opts says.
+//
+// Markdown is lightly stripped: links and wiki links become their text; images, HTML
+// tags, and comments are dropped; and so are the markers of emphasis, code spans,
+// lists, and block quotes. Fenced code blocks are skipped. Runs of whitespace become
+// single spaces.
+func ExtractExcerpt(body string, opts ExcerptOptions) string {
+	body = strings.TrimPrefix(StripFrontmatter(body), utf8BOM)
+
+	end := -1
+	scanMarkdownLines(body, func(line markdownLine) bool {
+		if loc := excerptMarker.FindStringIndex(line.text); loc != nil && !line.inCode {
+			end = line.offset + loc[0]
+			return false
+		}
+		return true
+	})
+	if end >= 0 {
+		return strings.Join(excerptParagraphs(body[:end], true, 0), "\n\n")
+	}
+
+	paragraphs := excerptParagraphs(body, false, 1)
+	if len(paragraphs) == 0 {
+		return ""
+	}
+	return cutExcerpt(paragraphs[0], opts)
+}
+
+// excerptParagraphs returns the stripped text of body's paragraphs with any, up to
+// limit of them if it's positive. With headings set, headings are paragraphs of their
+// own; otherwise they're left out.
+func excerptParagraphs(body string, headings bool, limit int) []string {
+	var paragraphs, current []string
+	flush := func() {
+		if text := stripInlineMarkdown(strings.Join(current, " ")); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+		current = nil
+	}
+	scanMarkdownLines(body, func(line markdownLine) bool {
+		switch {
+		case line.inCode || strings.TrimSpace(line.text) == "":
+			flush()
+		case len(current) > 0 && isSetextUnderline(line.text):
+			if !headings {
+				current = nil
+			}
+			flush()
+		case isThematicBreak(line.text):
+			flush()
+		default:
+			if _, title, ok := atxHeading(line.text); ok {
+				flush()
+				if headings {
+					current = []string{title}
+					flush()
+				}
+			} else {
+				current = append(current, stripBlockMarkers(line.text))
+			}
+		}
+		return limit <= 0 || len(paragraphs) < limit
+	})
+	if limit <= 0 || len(paragraphs) < limit {
+		flush()
+	}
+	return paragraphs
+}
+
+// isSetextUnderline reports whether text, after a paragraph line, underlines it as a
+// heading: a run of = or of -, indented by at most three spaces.
+func isSetextUnderline(text string) bool {
+	rest := strings.TrimLeft(text, " ")
+	if len(text)-len(rest) > 3 {
+		return false
+	}
+	rest = strings.TrimRight(rest, " \t")
+	return rest != "" && (strings.Trim(rest, "=") == "" || strings.Trim(rest, "-") == "")
+}
+
+// isThematicBreak reports whether text is a rule: three or more *, -, or _ characters,
+// all the same, with nothing else but spaces.
+func isThematicBreak(text string) bool {
+	rest := strings.TrimLeft(text, " ")
+	if len(text)-len(rest) > 3 {
+		return false
+	}
+	compact := strings.NewReplacer(" ", "", "\t", "").Replace(rest)
+	return len(compact) >= 3 && strings.Trim(compact, compact[:1]) == "" && strings.Contains("*-_", compact[:1])
+}
+
+// stripBlockMarkers removes the block quote and list markers from the start of text.
+func stripBlockMarkers(text string) string {
+	text = strings.TrimLeft(text, " \t")
+	for {
+		switch {
+		case strings.HasPrefix(text, ">"):
+			text = strings.TrimLeft(text[1:], " \t")
+		case excerptBlockMarker.MatchString(text):
+			text = text[len(excerptBlockMarker.FindString(text)):]
+		default:
+			return text
+		}
+	}
+}
+
+// stripInlineMarkdown returns text without its inline markdown, as ExtractExcerpt
+// describes, and with its whitespace collapsed.
+func stripInlineMarkdown(text string) string {
+	links := scanInlineLinks(text, 0)
+	var b strings.Builder
+	next := 0
+	for i := 0; i < len(text); {
+		for next < len(links) && links[next].Start < i {
+			next++ // inside a link already written, as a badge's image is
+		}
+		if next < len(links) && links[next].Start == i {
+			switch link := links[next]; link.Kind {
+			case LinkMarkdown:
+				b.WriteString(stripInlineMarkdown(link.Title))
+			case LinkWiki, LinkAutolink:
+				b.WriteString(link.Title)
+			}
+			i = links[next].End
+			continue
+		}
+
+		c := text[i]
+		switch {
+		case c == '\\' && escapeLen(text, i) == 2:
+			b.WriteByte(text[i+1])
+			i += 2
+		case c == '`':
+			end := skipCodeSpan(text, i)
+			n := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			if end > i+n {
+				b.WriteString(strings.TrimSpace(text[i+n : end-n]))
+			} else {
+				b.WriteString(text[i:end])
+			}
+			i = end
+		case c == '<':
+			if tag := excerptHTML.FindString(text[i:]); tag != "" {
+				b.WriteByte(' ')
+				i += len(tag)
+			} else {
+				b.WriteByte(c)
+				i++
+			}
+		case c == '*' || c == '_' || c == '~':
+			n := len(text[i:]) - len(strings.TrimLeft(text[i:], text[i:i+1]))
+			if !isEmphasisRun(text, i, n) {
+				b.WriteString(text[i : i+n])
+			}
+			i += n
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// isEmphasisRun reports whether the run of n *, _, or ~ characters at i in text marks
+// emphasis or strikethrough, rather than being text: it must touch text on one side,
+// and a _ run can't be inside a word, as in snake_case, nor a ~ run be a single ~.
+func isEmphasisRun(text string, i, n int) bool {
+	before, after := ' ', ' '
+	if i > 0 {
+		before, _ = utf8.DecodeLastRuneInString(text[:i])
+	}
+	if i+n < len(text) {
+		after, _ = utf8.DecodeRuneInString(text[i+n:])
+	}
+	if unicode.IsSpace(before) && unicode.IsSpace(after) {
+		return false
+	}
+	switch text[i] {
+	case '_':
+		return !(isWordRune(before) && isWordRune(after))
+	case '~':
+		return n >= 2
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// cutExcerpt cuts text as opts says.
+func cutExcerpt(text string, opts ExcerptOptions) string {
+	cut := false
+	if opts.MaxWords > 0 {
+		if words := strings.Fields(text); len(words) > opts.MaxWords {
+			text, cut = strings.Join(words[:opts.MaxWords], " "), true
+		}
+	}
+	if opts.MaxChars > 0 && utf8.RuneCountInString(text) > opts.MaxChars {
+		limit := opts.MaxChars
+		if opts.Ellipsis {
+			limit--
+		}
+		text, cut = truncateRunes(text, limit), true
+	}
+	if !cut {
+		return text
+	}
+	text = strings.TrimRightFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(",;:.-–—、，。", r)
+	})
+	if opts.Ellipsis {
+		text += "…"
+	}
+	return text
+}
+
+// truncateRunes returns the longest prefix of text of at most limit runes that ends
+// between words, or else anywhere that doesn't split a character, as
+// ExcerptOptions.MaxChars describes.
+func truncateRunes(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	fallback := 0
+	for j := limit; j > 0; j-- {
+		if joinsPrevious(runes, j) {
+			continue
+		}
+		prev, r := runes[j-1], runes[j]
+		if unicode.IsSpace(prev) || unicode.IsSpace(r) || isCJK(prev) || isCJK(r) {
+			return string(runes[:j])
+		}
+		if fallback == 0 {
+			fallback = j
+		}
+	}
+	return string(runes[:fallback])
+}
+
+// joinsPrevious reports whether runes[j] belongs to the same character as
+// runes[j-1]: a combining mark, a variation selector, an emoji modifier or tag, either
+// side of a zero-width joiner, or the second of a pair of flag letters.
+func joinsPrevious(runes []rune, j int) bool {
+	prev, r := runes[j-1], runes[j]
+	switch {
+	case prev == '\u200d' || r == '\u200d':
+		return true
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector):
+		return true
+	case r >= 0x1F3FB && r <= 0x1F3FF, r >= 0xE0020 && r <= 0xE007F: // skin tones, tags
+		return true
+	case isRegionalIndicator(r) && isRegionalIndicator(prev):
+		n := 0
+		for k := j - 1; k >= 0 && isRegionalIndicator(runes[k]); k-- {
+			n++
+		}
+		return n%2 == 1
+	}
+	return false
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
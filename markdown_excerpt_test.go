@@ -0,0 +1,90 @@
+// ABOUTME: Tests for ExtractExcerpt: the <!--more--> marker, the first-paragraph fallback, and markdown stripping.
+// ABOUTME: Truncation cases check word and CJK boundaries, and that emoji sequences and combining marks stay whole.
+package mdstore
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExtractExcerpt(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		want       string
+	}{
+		{"empty", "", ""},
+		{"first paragraph", "First line\ncontinues here.\n\nSecond paragraph.\n", "First line continues here."},
+		{"after heading", "# Title\n\nIntro text.\n\nMore.\n", "Intro text."},
+		{"setext heading", "Title\n=====\n\nIntro.\n", "Intro."},
+		{"rule", "Before the rule\n***\nAfter.\n", "Before the rule"},
+		{"image only", "![banner](banner.png)\n\nReal text.\n", "Real text."},
+		{"html comment", "<!-- toc -->\n\nText <b>bold</b>.\n", "Text bold ."},
+		{"links", "See [the *docs*](docs.md \"Docs\") and <https://example.com>.\n", "See the docs and https://example.com."},
+		{"badge", "[![build](ci.svg)](https://ci) Passing.\n", "Passing."},
+		{"wiki", "Read [[Home Page]] and [[notes/todo|the list]].\n", "Read Home Page and the list."},
+		{"emphasis", "Some **bold**, _italic_, and ~~struck~~ text.\n", "Some bold, italic, and struck text."},
+		{"intraword", "Call snake_case_name with 2 * 3 and un*frigging*real.\n", "Call snake_case_name with 2 * 3 and unfriggingreal."},
+		{"code span", "Run `go test` or ``a `b` c``; `unclosed.\n", "Run go test or a `b` c; `unclosed."},
+		{"escapes", "Not \\*emphasis\\* nor \\[a link](x).\n", "Not *emphasis* nor [a link](x)."},
+		{"list", "- [x] done\n- item two\n1. numbered\n", "done item two numbered"},
+		{"quote", "> quoted\n> > nested\n", "quoted nested"},
+		{"code fence", "```\ncode first\n```\n\nProse.\n", "Prose."},
+		{"frontmatter", "---\ntitle: T\n---\nBody text.\n", "Body text."},
+		{"crlf", "One\r\ntwo.\r\n\r\nThree.\r\n", "One two."},
+		{"marker", "# Title\n\nIntro *one*.\n\nIntro two.\n<!--more-->\nRest.\n", "Title\n\nIntro one.\n\nIntro two."},
+		{"marker with spaces", "Teaser. <!-- more --> Rest.\n", "Teaser."},
+		{"marker in code", "Intro.\n\n```\n<!--more-->\n```\n\nRest.\n", "Intro."},
+		{"marker first", "<!--more-->\nRest.\n", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ExtractExcerpt(tc.body, ExcerptOptions{}); got != tc.want {
+				t.Errorf("ExtractExcerpt = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestExtractExcerpt_Cut(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		opts       ExcerptOptions
+		want       string
+	}{
+		{"fits", "Short text.", ExcerptOptions{MaxWords: 2, MaxChars: 11, Ellipsis: true}, "Short text."},
+		{"words", "one two three four", ExcerptOptions{MaxWords: 2}, "one two"},
+		{"words ellipsis", "one, two, three", ExcerptOptions{MaxWords: 2, Ellipsis: true}, "one, two…"},
+		{"chars at word", "The quick brown fox", ExcerptOptions{MaxChars: 12}, "The quick"},
+		{"chars ellipsis", "The quick brown fox", ExcerptOptions{MaxChars: 11, Ellipsis: true}, "The quick…"},
+		{"chars exact word", "The quick brown", ExcerptOptions{MaxChars: 9}, "The quick"},
+		{"one long word", "Supercalifragilistic", ExcerptOptions{MaxChars: 6, Ellipsis: true}, "Super…"},
+		{"chinese", "我爱读书，也爱写作。", ExcerptOptions{MaxChars: 6, Ellipsis: true}, "我爱读书…"},
+		{"japanese", "コーヒーを飲む", ExcerptOptions{MaxChars: 4}, "コーヒー"},
+		{"combining marks", "e\u0301e\u0301e\u0301", ExcerptOptions{MaxChars: 3}, "e\u0301"},
+		{"zwj family", "ab👨‍👩‍👧", ExcerptOptions{MaxChars: 4}, "ab"},
+		{"skin tone", "hi 👍🏽", ExcerptOptions{MaxChars: 4}, "hi"},
+		{"flags", "🇯🇵🇫🇷🇩🇪", ExcerptOptions{MaxChars: 3}, "🇯🇵"},
+		{"variation selector", "ok❤️", ExcerptOptions{MaxChars: 3}, "ok"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ExtractExcerpt(tc.body, tc.opts)
+			if got != tc.want {
+				t.Errorf("ExtractExcerpt = %q, want %q", got, tc.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("ExtractExcerpt = %q, not valid UTF-8", got)
+			}
+			if tc.opts.MaxChars > 0 && utf8.RuneCountInString(got) > tc.opts.MaxChars {
+				t.Errorf("ExtractExcerpt = %q, longer than %d characters", got, tc.opts.MaxChars)
+			}
+		})
+	}
+}
+
+func TestExtractExcerpt_MarkerNotCut(t *testing.T) {
+	body := strings.Repeat("word ", 50) + "\n<!--more-->\nrest\n"
+	got := ExtractExcerpt(body, ExcerptOptions{MaxWords: 3, Ellipsis: true})
+	if want := strings.TrimSpace(strings.Repeat("word ", 50)); got != want {
+		t.Errorf("ExtractExcerpt = %q, want the whole teaser", got)
+	}
+}
@@ -0,0 +1,136 @@
+// ABOUTME: Heading outlines of markdown bodies, with renderer-style anchor IDs, and tables of contents built from them.
+// ABOUTME: Provides ExtractHeadings, Heading, and RenderTOC; ATX and setext headings are found outside code blocks.
+package mdstore
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Heading is a heading of a markdown body, as ExtractHeadings finds it.
+type Heading struct {
+	Level int    // 1 to 6; a setext heading is 1 underlined with =, 2 with -
+	Text  string // its text, with inline markdown stripped as ExtractExcerpt strips it
+
+	// ID is its anchor, unique within the document: the text made into a slug as
+	// Slugify makes one, but dropping apostrophes and keeping the letters and digits of
+	// every script, as GitHub and Hugo do, so "What's New?" is whats-new and "Café"
+	// is café. A slug already taken gets "-2", "-3", and so on, as UniqueSlug adds
+	// them, so a second "FAQ" is faq-2.
+	ID string
+
+	// Offset is the byte offset, in the string passed to ExtractHeadings, of the start
+	// of the heading's first line: the text of a setext heading, not its underline.
+	Offset int
+}
+
+// ExtractHeadings returns the headings of the markdown document or body, in order:
+// ATX headings ("## Title") and setext headings (a paragraph underlined with === or
+// ---). Headings inside fenced code blocks aren't headings, and frontmatter at the
+// start of body is passed over, as ExtractLinks passes over it. A heading with no
+// text, such as a lone "#", is left out.
+func ExtractHeadings(body string) []Heading {
+	base := len(body) - len(StripFrontmatter(body))
+	if strings.HasPrefix(body[base:], utf8BOM) {
+		base += len(utf8BOM)
+	}
+
+	var headings []Heading
+	taken := make(map[string]bool)
+	add := func(level int, text string, offset int) {
+		if text = stripInlineMarkdown(text); text == "" {
+			return
+		}
+		id := headingID(text)
+		for n := 2; taken[id]; n++ {
+			id = fmt.Sprintf("%s-%d", headingID(text), n)
+		}
+		taken[id] = true
+		headings = append(headings, Heading{Level: level, Text: text, ID: id, Offset: base + offset})
+	}
+
+	// The lines of the paragraph so far, which an underline would make a heading,
+	// unless it's a list item or quote, which can't be underlined.
+	var paragraph []string
+	paragraphStart, inBlock := 0, false
+	scanMarkdownLines(body[base:], func(line markdownLine) bool {
+		switch {
+		case line.inCode || strings.TrimSpace(line.text) == "":
+			paragraph, inBlock = nil, false
+		case len(paragraph) > 0 && isSetextUnderline(line.text):
+			level := 1
+			if strings.TrimSpace(line.text)[0] == '-' {
+				level = 2
+			}
+			add(level, strings.Join(paragraph, " "), paragraphStart)
+			paragraph = nil
+		case isThematicBreak(line.text):
+			paragraph, inBlock = nil, false
+		default:
+			if level, title, ok := atxHeading(line.text); ok {
+				add(level, title, line.offset)
+				paragraph, inBlock = nil, false
+				return true
+			}
+			if len(paragraph) == 0 && !inBlock {
+				inBlock = stripBlockMarkers(line.text) != strings.TrimLeft(line.text, " \t")
+				paragraphStart = line.offset
+			}
+			if !inBlock {
+				paragraph = append(paragraph, strings.TrimSpace(line.text))
+			}
+		}
+		return true
+	})
+	return headings
+}
+
+// headingID makes text into an anchor, as Heading.ID describes.
+func headingID(text string) string {
+	text = strings.NewReplacer("'", "", "’", "").Replace(strings.ToLower(text))
+	var b strings.Builder
+	hyphen := false
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	if b.Len() == 0 {
+		return untitled
+	}
+	return b.String()
+}
+
+// RenderTOC renders headings as a table of contents: a nested markdown list of links
+// to their anchors, each heading under the nearest one before it of a lower level,
+// and those with no such heading at the top. Headings deeper than maxDepth, a level
+// from 1 to 6, are left out; 0 keeps them all. Each item is "- [Text](#ID)",
+// indented by two spaces a step. Nothing is rendered for no headings.
+func RenderTOC(headings []Heading, maxDepth int) string {
+	var b strings.Builder
+	var open []int // the levels of the headings the next one may be under
+	for _, h := range headings {
+		if maxDepth > 0 && h.Level > maxDepth {
+			continue
+		}
+		for len(open) > 0 && open[len(open)-1] >= h.Level {
+			open = open[:len(open)-1]
+		}
+		fmt.Fprintf(&b, "%s- [%s](#%s)\n", strings.Repeat("  ", len(open)), escapeLinkText(h.Text), h.ID)
+		open = append(open, h.Level)
+	}
+	return b.String()
+}
+
+// escapeLinkText escapes the characters of text that would end or break the text of
+// a markdown link.
+func escapeLinkText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(text)
+}
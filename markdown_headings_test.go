@@ -0,0 +1,76 @@
+// ABOUTME: Tests for ExtractHeadings and RenderTOC: ATX and setext styles, code fences, anchors, and nesting.
+// ABOUTME: Duplicate and non-ASCII headings check that anchors stay distinct and close to what renderers produce.
+package mdstore
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractHeadings(t *testing.T) {
+	body := "---\ntitle: Doc\n---\n" +
+		"# Intro\n" +
+		"Some text.\n\n" +
+		"Setext One\n===\n\n" +
+		"Setext *Two*\nwrapped\n---\n\n" +
+		"```md\n# Not a heading\n```\n\n" +
+		"## FAQ ##\n\n" +
+		"### What's [new](new.md)?\n\n" +
+		"## FAQ\n\n" +
+		"## `code` & Café\n\n" +
+		"- item\n---\n\n" +
+		"#\n\n" +
+		"####### seven\n\n" +
+		"## FAQ 2\n"
+	got := ExtractHeadings(body)
+	want := []Heading{
+		{Level: 1, Text: "Intro", ID: "intro", Offset: strings.Index(body, "# Intro")},
+		{Level: 1, Text: "Setext One", ID: "setext-one", Offset: strings.Index(body, "Setext One")},
+		{Level: 2, Text: "Setext Two wrapped", ID: "setext-two-wrapped", Offset: strings.Index(body, "Setext *Two*")},
+		{Level: 2, Text: "FAQ", ID: "faq", Offset: strings.Index(body, "## FAQ ##")},
+		{Level: 3, Text: "What's new?", ID: "whats-new", Offset: strings.Index(body, "### What")},
+		{Level: 2, Text: "FAQ", ID: "faq-2", Offset: strings.Index(body, "## FAQ\n")},
+		{Level: 2, Text: "code & Café", ID: "code-café", Offset: strings.Index(body, "## `code`")},
+		{Level: 2, Text: "FAQ 2", ID: "faq-2-2", Offset: strings.Index(body, "## FAQ 2")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractHeadings =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestExtractHeadings_IDs(t *testing.T) {
+	for _, tc := range []struct{ text, want string }{
+		{"Hello, World!", "hello-world"},
+		{"It’s 2026", "its-2026"},
+		{"  Spaces  ", "spaces"},
+		{"日本語の見出し", "日本語の見出し"},
+		{"Ünïcödé Text", "ünïcödé-text"},
+		{"🎉", "untitled"},
+	} {
+		if got := ExtractHeadings("# " + tc.text + "\n"); len(got) != 1 || got[0].ID != tc.want {
+			t.Errorf("ExtractHeadings(%q) = %+v, want ID %q", tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestRenderTOC(t *testing.T) {
+	headings := ExtractHeadings("## Install\n### From [source]\n#### Deep\n## Use\n# Top\n### Skipped a level\n")
+	want := "- [Install](#install)\n" +
+		"  - [From \\[source\\]](#from-source)\n" +
+		"    - [Deep](#deep)\n" +
+		"- [Use](#use)\n" +
+		"- [Top](#top)\n" +
+		"  - [Skipped a level](#skipped-a-level)\n"
+	if got := RenderTOC(headings, 0); got != want {
+		t.Errorf("RenderTOC =\n%s\nwant\n%s", got, want)
+	}
+
+	want = "- [Install](#install)\n  - [From \\[source\\]](#from-source)\n- [Use](#use)\n- [Top](#top)\n  - [Skipped a level](#skipped-a-level)\n"
+	if got := RenderTOC(headings, 3); got != want {
+		t.Errorf("RenderTOC(3) =\n%s\nwant\n%s", got, want)
+	}
+	if got := RenderTOC(nil, 0); got != "" {
+		t.Errorf("RenderTOC(nil) = %q", got)
+	}
+}
@@ -0,0 +1,412 @@
+// ABOUTME: Outgoing links of markdown bodies: inline links, images, wiki links, and autolinks, outside of code.
+// ABOUTME: Provides ExtractLinks, Link, LinkKind, and ResolveLink, which turns a link target into a store-relative path.
+package mdstore
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// LinkKind says what sort of reference a Link is.
+type LinkKind int
+
+const (
+	LinkMarkdown LinkKind = iota // [text](target)
+	LinkWiki                     // [[Page]] or [[Page|alias]]
+	LinkImage                    // ![alt](target)
+	LinkAutolink                 // <https://example.com> or <ada@example.com>
+)
+
+func (k LinkKind) String() string {
+	switch k {
+	case LinkMarkdown:
+		return "markdown"
+	case LinkWiki:
+		return "wikilink"
+	case LinkImage:
+		return "image"
+	case LinkAutolink:
+		return "autolink"
+	}
+	return fmt.Sprintf("LinkKind(%d)", int(k))
+}
+
+// Link is a reference from a markdown body, as ExtractLinks finds it.
+type Link struct {
+	Kind LinkKind
+
+	// Target is where the link points: its destination as written, without angle
+	// brackets, title, or backslash escapes; a wiki link's page; or an autolink's URL,
+	// with mailto: before an email address.
+	Target string
+
+	// Title is the link's text, an image's alt text, a wiki link's alias or, without one,
+	// its page, or an autolink's text, as written.
+	Title string
+
+	// Start and End are the byte offsets, in the string passed to ExtractLinks, of the
+	// link's first byte ("[", "!", or "<") and of the byte after its last.
+	Start, End int
+}
+
+// ExtractLinks returns the links of the markdown document or body, in order:
+// inline links and images ([text](target "title") and ![alt](target)), wiki links
+// ([[Page]] and [[Page|alias]]), and autolinks (<https://example.com>). Links inside
+// fenced code blocks and code spans, or written with escaped brackets, aren't links,
+// and neither is a link within another link's text, as CommonMark has it, though an
+// image there is. Frontmatter at the start of body is passed over, as BodyStats
+// passes over it. Reference links ([text][ref]) aren't resolved, and are left out.
+func ExtractLinks(body string) []Link {
+	base := len(body) - len(StripFrontmatter(body))
+	var links []Link
+
+	// Inline markup can't cross a blank line or a code block, so each run of other
+	// lines, a paragraph or so, is scanned on its own.
+	start, end := -1, -1
+	flush := func() {
+		if start >= 0 {
+			links = append(links, scanInlineLinks(body[start:end], start)...)
+			start = -1
+		}
+	}
+	scanMarkdownLines(body[base:], func(line markdownLine) bool {
+		if line.inCode || strings.TrimSpace(line.text) == "" {
+			flush()
+			return true
+		}
+		if start < 0 {
+			start = base + line.offset
+		}
+		end = base + line.offset + len(line.text)
+		return true
+	})
+	flush()
+	return links
+}
+
+// scanInlineLinks returns the links in text, a run of lines outside code blocks,
+// whose offsets are from base.
+func scanInlineLinks(text string, base int) []Link {
+	var links []Link
+	for i := 0; i < len(text); {
+		switch text[i] {
+		case '\\':
+			i += escapeLen(text, i)
+			continue
+		case '`':
+			i = skipCodeSpan(text, i)
+			continue
+		case '<':
+			if link, n, ok := parseAutolink(text[i:]); ok {
+				link.Start, link.End = base+i, base+i+n
+				links = append(links, link)
+				i += n
+				continue
+			}
+		case '!':
+			if strings.HasPrefix(text[i+1:], "[") && !strings.HasPrefix(text[i+1:], "[[") {
+				if label, target, end, ok := parseInlineLink(text, i+1); ok {
+					links = append(links, Link{Kind: LinkImage, Target: target, Title: label, Start: base + i, End: base + end})
+					i = end
+					continue
+				}
+			}
+		case '[':
+			if target, alias, n, ok := parseWikiLink(text[i:]); ok {
+				links = append(links, Link{Kind: LinkWiki, Target: target, Title: alias, Start: base + i, End: base + i + n})
+				i += n
+				continue
+			}
+			if label, target, end, ok := parseInlineLink(text, i); ok {
+				// A link can't hold another link, so an inner one wins and this bracket is
+				// plain text; images inside, as in a badge, are links of their own.
+				inner := scanInlineLinks(label, base+i+1)
+				if !containsNonImage(inner) {
+					links = append(links, Link{Kind: LinkMarkdown, Target: target, Title: label, Start: base + i, End: base + end})
+					links = append(links, inner...)
+					i = end
+					continue
+				}
+			}
+		}
+		i++
+	}
+	return links
+}
+
+// containsNonImage reports whether links holds a link other than an image.
+func containsNonImage(links []Link) bool {
+	for _, link := range links {
+		if link.Kind != LinkImage {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWikiLink parses a wiki link at the start of text, returning its page and its
+// alias, or its page again without one, and its length.
+func parseWikiLink(text string) (target, alias string, n int, ok bool) {
+	if !strings.HasPrefix(text, "[[") {
+		return "", "", 0, false
+	}
+	end := strings.Index(text[2:], "]]")
+	if end < 0 {
+		return "", "", 0, false
+	}
+	inner := text[2 : 2+end]
+	if strings.ContainsAny(inner, "[]\r\n") {
+		return "", "", 0, false
+	}
+	target, alias, hasAlias := strings.Cut(inner, "|")
+	target, alias = strings.TrimSpace(target), strings.TrimSpace(alias)
+	if target == "" {
+		return "", "", 0, false
+	}
+	if !hasAlias || alias == "" {
+		alias = target
+	}
+	return target, alias, end + 4, true
+}
+
+// parseInlineLink parses an inline link, [label](destination "title"), whose "[" is at
+// open in text, returning its label, its destination unescaped, and the offset just
+// past its ")".
+func parseInlineLink(text string, open int) (label, target string, end int, ok bool) {
+	closing, destStart, destEnd, end, ok := scanInlineLink(text, open)
+	if !ok {
+		return "", "", 0, false
+	}
+	target = text[destStart:destEnd]
+	if strings.HasPrefix(target, "<") {
+		target = target[1 : len(target)-1]
+	}
+	return text[open+1 : closing], unescapeMarkdown(target), end, true
+}
+
+// scanInlineLink finds the parts of the inline link whose "[" is at open in text:
+// the offset of the "]" closing its label, the span of its destination as written,
+// angle brackets and all, and the offset just past its ")".
+func scanInlineLink(text string, open int) (closing, destStart, destEnd, end int, ok bool) {
+	// The label ends at the "]" matching open, passing over escapes and code spans.
+	closing = -1
+	depth := 0
+	for i := open; i < len(text) && closing < 0; {
+		switch text[i] {
+		case '\\':
+			i += escapeLen(text, i)
+			continue
+		case '`':
+			i = skipCodeSpan(text, i)
+			continue
+		case '[':
+			depth++
+		case ']':
+			if depth--; depth == 0 {
+				closing = i
+			}
+		}
+		i++
+	}
+	if closing < 0 || !strings.HasPrefix(text[closing+1:], "(") {
+		return 0, 0, 0, 0, false
+	}
+
+	destStart = skipLinkSpace(text, closing+2)
+	_, pos, ok := parseLinkDestination(text, destStart)
+	if !ok {
+		return 0, 0, 0, 0, false
+	}
+	destEnd = pos
+	if next := skipLinkSpace(text, pos); next > pos && next < len(text) && strings.IndexByte(`"'(`, text[next]) >= 0 {
+		if pos, ok = skipLinkTitle(text, next); !ok {
+			return 0, 0, 0, 0, false
+		}
+	}
+	pos = skipLinkSpace(text, pos)
+	if pos >= len(text) || text[pos] != ')' {
+		return 0, 0, 0, 0, false
+	}
+	return closing, destStart, destEnd, pos + 1, true
+}
+
+// parseLinkDestination parses the destination of an inline link at pos in text, either
+// <bracketed> or a run without spaces whose parentheses balance, returning it as
+// written and the offset after it.
+func parseLinkDestination(text string, pos int) (target string, end int, ok bool) {
+	if strings.HasPrefix(text[pos:], "<") {
+		for i := pos + 1; i < len(text); i++ {
+			switch text[i] {
+			case '\\':
+				i += escapeLen(text, i) - 1
+			case '>':
+				return text[pos+1 : i], i + 1, true
+			case '<', '\n', '\r':
+				return "", 0, false
+			}
+		}
+		return "", 0, false
+	}
+
+	depth := 0
+	i := pos
+	for ; i < len(text); i++ {
+		c := text[i]
+		if c == '\\' {
+			i += escapeLen(text, i) - 1
+			continue
+		}
+		if c <= ' ' || c == 0x7f {
+			break
+		}
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+	}
+	if depth != 0 {
+		return "", 0, false
+	}
+	return text[pos:i], i, true
+}
+
+// skipLinkTitle returns the offset just past the link title, in double or single quotes
+// or parentheses, that starts at pos in text.
+func skipLinkTitle(text string, pos int) (int, bool) {
+	closer := text[pos]
+	if closer == '(' {
+		closer = ')'
+	}
+	for i := pos + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i += escapeLen(text, i) - 1
+		case closer:
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// skipLinkSpace returns the offset of the first byte at or after pos in text that isn't
+// a space, a tab, or a line break.
+func skipLinkSpace(text string, pos int) int {
+	for pos < len(text) && strings.IndexByte(" \t\r\n", text[pos]) >= 0 {
+		pos++
+	}
+	return pos
+}
+
+// skipCodeSpan returns the offset after the code span whose opening backticks are at
+// pos in text, or after those backticks alone if nothing closes them, which are then
+// plain text.
+func skipCodeSpan(text string, pos int) int {
+	n := len(text[pos:]) - len(strings.TrimLeft(text[pos:], "`"))
+	for i := pos + n; i < len(text); {
+		j := strings.IndexByte(text[i:], '`')
+		if j < 0 {
+			break
+		}
+		i += j
+		run := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+		if run == n {
+			return i + run
+		}
+		i += run
+	}
+	return pos + n
+}
+
+// escapeLen returns the length of the backslash escape at pos in text: 2 for a
+// backslash before ASCII punctuation, and 1 for a backslash that escapes nothing.
+func escapeLen(text string, pos int) int {
+	if pos+1 < len(text) && isASCIIPunct(text[pos+1]) {
+		return 2
+	}
+	return 1
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+// unescapeMarkdown removes the backslashes of backslash escapes from s.
+func unescapeMarkdown(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && escapeLen(s, i) == 2 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+var (
+	uriAutolink   = regexp.MustCompile(`^<([A-Za-z][A-Za-z0-9+.-]{1,31}:[^\x00-\x20<>]*)>`)
+	emailAutolink = regexp.MustCompile("^<([a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*)>")
+)
+
+// parseAutolink parses an autolink at the start of text, returning it, without
+// offsets, and its length.
+func parseAutolink(text string) (Link, int, bool) {
+	if m := uriAutolink.FindStringSubmatch(text); m != nil {
+		return Link{Kind: LinkAutolink, Target: m[1], Title: m[1]}, len(m[0]), true
+	}
+	if m := emailAutolink.FindStringSubmatch(text); m != nil {
+		return Link{Kind: LinkAutolink, Target: "mailto:" + m[1], Title: m[1]}, len(m[0]), true
+	}
+	return Link{}, 0, false
+}
+
+// urlScheme matches the scheme at the start of an absolute URL, such as https: or mailto:.
+var urlScheme = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9+.-]*:`)
+
+// ResolveLink resolves target, a link's target in the document at docPath, to the path,
+// relative to the store as docPath is, of what it links to. A relative target is taken
+// from docPath's directory, and one starting with "/" from the root of the store; any
+// #fragment or ?query is dropped and %-escapes decoded, so a target of "#section" is
+// docPath itself. ResolveLink returns false for a target outside the store: a URL
+// with a scheme, such as https: or mailto:, one starting with "//", or a path that
+// climbs above the root. The path uses forward slashes, though docPath may use the
+// OS's separator.
+//
+// A wiki link's page is resolved as a relative path; callers that name pages by slug
+// or title should look them up themselves.
+func ResolveLink(docPath, target string) (string, bool) {
+	docPath = path.Clean(filepath.ToSlash(docPath))
+	if i := strings.IndexAny(target, "#?"); i >= 0 {
+		target = target[:i]
+	}
+	if target == "" {
+		return docPath, true
+	}
+	if urlScheme.MatchString(target) || strings.HasPrefix(target, "//") {
+		return "", false
+	}
+	if unescaped, err := url.PathUnescape(target); err == nil {
+		target = unescaped
+	}
+
+	var resolved string
+	if strings.HasPrefix(target, "/") {
+		resolved = strings.TrimPrefix(path.Clean(target), "/")
+	} else {
+		resolved = path.Join(path.Dir(docPath), target)
+	}
+	if resolved == "" || resolved == "." || resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", false
+	}
+	return resolved, true
+}
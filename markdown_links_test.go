@@ -0,0 +1,102 @@
+// ABOUTME: Tests for ExtractLinks and ResolveLink: every link kind, and links in code, escapes, and nesting.
+// ABOUTME: The links of testdata/links.md are checked against a golden listing, rewritten with -update.
+package mdstore
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractLinks_Fixture(t *testing.T) {
+	_, content := copyFixture(t, "links.md")
+	var got strings.Builder
+	for _, link := range ExtractLinks(content) {
+		fmt.Fprintf(&got, "%-8s %-40q %-24q %q\n", link.Kind, link.Target, link.Title, content[link.Start:link.End])
+	}
+	checkGolden(t, "links.golden.txt", []byte(got.String()))
+}
+
+func TestExtractLinks(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		want       []Link
+	}{
+		{"empty", "", nil},
+		{"markdown", "A [link](a.md).", []Link{{LinkMarkdown, "a.md", "link", 2, 14}}},
+		{"image", "![alt](i.png)", []Link{{LinkImage, "i.png", "alt", 0, 13}}},
+		{"wiki", "[[Page]]", []Link{{LinkWiki, "Page", "Page", 0, 8}}},
+		{"wiki alias", "[[page|Alias]]", []Link{{LinkWiki, "page", "Alias", 0, 14}}},
+		{"autolink", "<https://x.io>", []Link{{LinkAutolink, "https://x.io", "https://x.io", 0, 14}}},
+		{"email", "<a@b.co>", []Link{{LinkAutolink, "mailto:a@b.co", "a@b.co", 0, 8}}},
+		{"empty target", "[x]()", []Link{{LinkMarkdown, "", "x", 0, 5}}},
+		{"title", `[x](a.md 'T')`, []Link{{LinkMarkdown, "a.md", "x", 0, 13}}},
+		{"paren title", `[x](a.md (T))`, []Link{{LinkMarkdown, "a.md", "x", 0, 13}}},
+		{"offsets after frontmatter", "---\na: 1\n---\n[x](y)", []Link{{LinkMarkdown, "y", "x", 13, 19}}},
+		{"offsets after bom", utf8BOM + "[x](y)", []Link{{LinkMarkdown, "y", "x", 3, 9}}},
+		{"crlf", "a\r\n[x](y)\r\n", []Link{{LinkMarkdown, "y", "x", 3, 9}}},
+		{"link in heading", "# [x](y)", []Link{{LinkMarkdown, "y", "x", 2, 8}}},
+		{"code span with link", "`[x](y)` [z](w)", []Link{{LinkMarkdown, "w", "z", 9, 15}}},
+		{"backticks in label", "[`]`](y)", []Link{{LinkMarkdown, "y", "`]`", 0, 8}}},
+		{"code span across lines", "`a\n[x](y)` b", nil},
+		{"code span across paragraphs", "`a\n\n[x](y)`", []Link{{LinkMarkdown, "y", "x", 4, 10}}},
+		{"unmatched backticks", "``a` [x](y)", []Link{{LinkMarkdown, "y", "x", 5, 11}}},
+		{"escaped image", `\![x](y)`, []Link{{LinkMarkdown, "y", "x", 2, 8}}},
+		{"escaped paren", `[x](a\)b)`, []Link{{LinkMarkdown, "a)b", "x", 0, 9}}},
+		{"unbalanced parens", "[x](a(b)", nil},
+		{"space in target", "[x](a b)", nil},
+		{"unclosed title", `[x](a "t)`, nil},
+		{"unclosed angle", "[x](<a)", nil},
+		{"bang wiki", "![[embed.png]]", []Link{{LinkWiki, "embed.png", "embed.png", 1, 14}}},
+		{"wiki newline", "[[a\nb]]", nil},
+		{"triple brackets", "[[[a]]]", []Link{{LinkWiki, "a", "a", 1, 6}}},
+		{"link in wiki alias", "[[a|[b](c)]]", []Link{{LinkMarkdown, "c", "b", 4, 10}}},
+		{"badge", "[![b](i.svg)](u)", []Link{{LinkMarkdown, "u", "![b](i.svg)", 0, 16}, {LinkImage, "i.svg", "b", 1, 12}}},
+		{"link in link", "[a [b](c) d](e)", []Link{{LinkMarkdown, "c", "b", 3, 9}}},
+		{"autolink in link", "[<https://x.io>](e)", []Link{{LinkAutolink, "https://x.io", "https://x.io", 1, 15}}},
+		{"html is not an autolink", "<a href=\"x\">", nil},
+		{"space in autolink", "<https://x.io/a b>", nil},
+		{"fence", "```\n[x](y)\n```\n[z](w)", []Link{{LinkMarkdown, "w", "z", 15, 21}}},
+		{"unclosed fence", "[z](w)\n~~~\n[x](y)\n", []Link{{LinkMarkdown, "w", "z", 0, 6}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ExtractLinks(tc.body); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ExtractLinks = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveLink(t *testing.T) {
+	for _, tc := range []struct {
+		doc, target, want string
+		ok                bool
+	}{
+		{"posts/hello.md", "world.md", "posts/world.md", true},
+		{"posts/hello.md", "./world.md", "posts/world.md", true},
+		{"posts/hello.md", "../about.md", "about.md", true},
+		{"posts/2026/hello.md", "../../img/a.png", "img/a.png", true},
+		{"posts/hello.md", "/about.md", "about.md", true},
+		{"posts/hello.md", "/../about.md", "about.md", true},
+		{"hello.md", "sub/page.md#section", "sub/page.md", true},
+		{"hello.md", "page.md?raw=1", "page.md", true},
+		{"posts/hello.md", "#section", "posts/hello.md", true},
+		{"posts/hello.md", "my%20file.md", "posts/my file.md", true},
+		{"posts/hello.md", "100%.md", "posts/100%.md", true},
+		{"posts/hello.md", "Home Page", "posts/Home Page", true},
+		{"hello.md", "../outside.md", "", false},
+		{"posts/hello.md", "../../outside.md", "", false},
+		{"hello.md", "/", "", false},
+		{"hello.md", "..", "", false},
+		{"hello.md", "https://example.com/a.md", "", false},
+		{"hello.md", "mailto:ada@example.com", "", false},
+		{"hello.md", "//cdn.example.com/a.js", "", false},
+	} {
+		t.Run(tc.doc+" "+tc.target, func(t *testing.T) {
+			if got, ok := ResolveLink(tc.doc, tc.target); got != tc.want || ok != tc.ok {
+				t.Errorf("ResolveLink(%q, %q) = %q, %v; want %q, %v", tc.doc, tc.target, got, ok, tc.want, tc.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// ABOUTME: Line scanning of markdown bodies that knows which lines are inside fenced code blocks.
+// ABOUTME: Shared by the body helpers, so a heading-looking line inside ``` or ~~~ fences is never taken for a heading.
+package mdstore
+
+import (
+	"strings"
+)
+
+// markdownLine is a line of a markdown body, as scanMarkdownLines yields it.
+type markdownLine struct {
+	text   string // the line, without its line break
+	number int    // its 1-based number within the body
+	offset int    // the byte offset of its start within the body
+	inCode bool   // whether it's part of a fenced code block, fences included
+}
+
+// scanMarkdownLines calls fn with each line of body, in order, until fn returns false.
+// Fenced code blocks are found as CommonMark finds them: a fence is three or more
+// backticks or tildes indented by at most three spaces, closed by a fence of the same
+// character at least as long with nothing after it, or by the end of the body.
+func scanMarkdownLines(body string, fn func(line markdownLine) bool) {
+	var open string // the fence of the code block we're in, if any
+	for pos, number := 0, 1; pos < len(body); number++ {
+		text, next := nextLine(body, pos)
+		line := markdownLine{text: text, number: number, offset: pos}
+		fence, info, isFence := codeFence(text)
+		switch {
+		case open == "" && isFence:
+			open, line.inCode = fence, true
+		case open != "":
+			line.inCode = true
+			if isFence && fence[0] == open[0] && len(fence) >= len(open) && info == "" {
+				open = ""
+			}
+		}
+		if !fn(line) {
+			return
+		}
+		pos = next
+	}
+}
+
+// codeFence reports whether text is a code fence, returning the fence itself and the
+// info string after it, such as a language name.
+func codeFence(text string) (fence, info string, ok bool) {
+	rest := strings.TrimLeft(text, " ")
+	if len(text)-len(rest) > 3 || (!strings.HasPrefix(rest, "```") && !strings.HasPrefix(rest, "~~~")) {
+		return "", "", false
+	}
+	n := len(rest) - len(strings.TrimLeft(rest, rest[:1]))
+	fence, info = rest[:n], strings.TrimSpace(rest[n:])
+	if fence[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false // an inline code span, not a fence
+	}
+	return fence, info, true
+}
+
+// atxHeading parses text as an ATX heading ("## Title"), returning its level, 1 to 6,
+// and its text, without the markers or any closing run of #s.
+func atxHeading(text string) (level int, title string, ok bool) {
+	rest := strings.TrimLeft(text, " ")
+	if len(text)-len(rest) > 3 {
+		return 0, "", false
+	}
+	level = len(rest) - len(strings.TrimLeft(rest, "#"))
+	rest = rest[level:]
+	if level == 0 || level > 6 || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+		return 0, "", false
+	}
+
+	title = strings.TrimSpace(rest)
+	if closing := strings.TrimRight(title, "#"); closing == "" {
+		title = ""
+	} else if len(closing) < len(title) && (strings.HasSuffix(closing, " ") || strings.HasSuffix(closing, "\t")) {
+		title = strings.TrimSpace(closing)
+	}
+	return level, title, true
+}
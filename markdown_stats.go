@@ -0,0 +1,106 @@
+// ABOUTME: Word counts and reading times for markdown bodies, leaving out frontmatter and fenced code blocks.
+// ABOUTME: Provides BodyStats, BodyStatsOpts, Stats, and StatsOptions; CJK text is counted by character.
+package mdstore
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Default reading speeds for StatsOptions.
+const (
+	DefaultWordsPerMinute    = 200
+	DefaultCJKCharsPerMinute = 500
+)
+
+// Stats describes the text of a markdown body.
+type Stats struct {
+	Words          int `yaml:"words"`   // words, with each CJK character counted as one
+	Chars          int `yaml:"chars"`   // characters other than whitespace
+	ReadingMinutes int `yaml:"minutes"` // estimated reading time, rounded up
+}
+
+// StatsOptions controls BodyStatsOpts. Zero fields take the defaults.
+type StatsOptions struct {
+	// WordsPerMinute is the reading speed for text written with spaces between words.
+	// Default DefaultWordsPerMinute.
+	WordsPerMinute int `yaml:"words_per_minute,omitempty"`
+
+	// CJKCharsPerMinute is the reading speed for Chinese and Japanese text, which is
+	// counted by character. Default DefaultCJKCharsPerMinute.
+	CJKCharsPerMinute int `yaml:"cjk_chars_per_minute,omitempty"`
+}
+
+// BodyStats counts the words and characters of a markdown body and estimates its
+// reading time, with the default StatsOptions. Frontmatter at the start of body, in
+// any format, is left out, so a whole document can be passed as well as the body
+// ParseFrontmatter returns, and so are fenced code blocks.
+//
+// Words are runs of text between whitespace that hold at least one letter or digit,
+// so markdown's bullets and rules aren't words. Chinese and Japanese are written
+// without spaces, so each Han, Hiragana, or Katakana character counts as a word, and
+// is read at CJKCharsPerMinute; Korean, which spaces its words, is counted by word.
+func BodyStats(body string) Stats {
+	return BodyStatsOpts(body, StatsOptions{})
+}
+
+// BodyStatsOpts is BodyStats with explicit reading speeds.
+func BodyStatsOpts(body string, opts StatsOptions) Stats {
+	body = strings.TrimPrefix(StripFrontmatter(body), utf8BOM)
+	wpm, cpm := opts.WordsPerMinute, opts.CJKCharsPerMinute
+	if wpm <= 0 {
+		wpm = DefaultWordsPerMinute
+	}
+	if cpm <= 0 {
+		cpm = DefaultCJKCharsPerMinute
+	}
+
+	var stats Stats
+	var words, cjk int
+	scanMarkdownLines(body, func(line markdownLine) bool {
+		if line.inCode {
+			return true
+		}
+		inWord, hasLetter := false, false
+		endWord := func() {
+			if inWord && hasLetter {
+				words++
+			}
+			inWord, hasLetter = false, false
+		}
+		for _, r := range line.text {
+			switch {
+			case unicode.IsSpace(r):
+				endWord()
+				continue
+			case isCJK(r):
+				endWord()
+				cjk++
+			default:
+				inWord = true
+				hasLetter = hasLetter || unicode.IsLetter(r) || unicode.IsDigit(r)
+			}
+			stats.Chars++
+		}
+		endWord()
+		return true
+	})
+
+	stats.Words = words + cjk
+	if stats.Words > 0 {
+		// Minutes, rounded up, in units of 1/(wpm*cpm) of a minute to stay in integers.
+		units := words*cpm + cjk*wpm
+		stats.ReadingMinutes = (units + wpm*cpm - 1) / (wpm * cpm)
+	}
+	return stats
+}
+
+// isCJK reports whether r is a Han, Hiragana, or Katakana character, which are
+// written without spaces between words, or one of the marks written within their words.
+func isCJK(r rune) bool {
+	switch r {
+	case 'ー', '々': // the long vowel and repetition marks, which Unicode leaves out of the scripts
+		return true
+	}
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r)
+}
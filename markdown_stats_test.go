@@ -0,0 +1,130 @@
+// ABOUTME: Tests for BodyStats word and character counts and reading times, and the Index stats option.
+// ABOUTME: Mixed English, Japanese, Chinese, and Korean fixtures check the CJK heuristic; code and frontmatter are left out.
+package mdstore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBodyStats(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		want       Stats
+	}{
+		{"empty", "", Stats{}},
+		{"english", "The quick brown fox\njumps over the lazy dog.\n", Stats{Words: 9, Chars: 36, ReadingMinutes: 1}},
+		{"punctuation", "Well -- it's done, isn't it?\n", Stats{Words: 5, Chars: 23, ReadingMinutes: 1}},
+		{"markdown syntax", "# Title\n\n- one\n* two\n\n---\n\n> quoted\n", Stats{Words: 4, Chars: 24, ReadingMinutes: 1}},
+		{"digits", "Released in 2026, version 2.\n", Stats{Words: 5, Chars: 24, ReadingMinutes: 1}},
+		{"accents", "Café naïve résumé\n", Stats{Words: 3, Chars: 15, ReadingMinutes: 1}},
+		{"crlf", "one two\r\nthree\r\n", Stats{Words: 3, Chars: 11, ReadingMinutes: 1}},
+		{"code fence", "Before.\n```sh\necho not counted\n```\nAfter.\n", Stats{Words: 2, Chars: 13, ReadingMinutes: 1}},
+		{"tilde fence", "~~~\nhidden words\n~~~\nshown\n", Stats{Words: 1, Chars: 5, ReadingMinutes: 1}},
+		{"unclosed fence", "Text\n```\nall code\nto the end\n", Stats{Words: 1, Chars: 4, ReadingMinutes: 1}},
+		{"yaml frontmatter", "---\ntitle: Not Counted\n---\nCounted.\n", Stats{Words: 1, Chars: 8, ReadingMinutes: 1}},
+		{"toml frontmatter", "+++\ntitle = \"no\"\n+++\nyes\n", Stats{Words: 1, Chars: 3, ReadingMinutes: 1}},
+		{"bom", utf8BOM + "---\na: 1\n---\nword\n", Stats{Words: 1, Chars: 4, ReadingMinutes: 1}},
+		{"chinese", "我爱读书。\n", Stats{Words: 4, Chars: 5, ReadingMinutes: 1}},
+		{"japanese", "コーヒーを飲む\n", Stats{Words: 7, Chars: 7, ReadingMinutes: 1}},
+		{"japanese in latin", "Read東京now\n", Stats{Words: 4, Chars: 9, ReadingMinutes: 1}},
+		{"korean", "서울은 한국의 수도입니다\n", Stats{Words: 3, Chars: 11, ReadingMinutes: 1}},
+		{"two minutes", strings.Repeat("word ", 201), Stats{Words: 201, Chars: 804, ReadingMinutes: 2}},
+		{"cjk minutes", strings.Repeat("字", 501), Stats{Words: 501, Chars: 501, ReadingMinutes: 2}},
+		{"mixed minutes", strings.Repeat("word ", 100) + strings.Repeat("字", 250), Stats{Words: 350, Chars: 650, ReadingMinutes: 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := BodyStats(tc.body); got != tc.want {
+				t.Errorf("BodyStats = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBodyStats_Fixtures(t *testing.T) {
+	for _, tc := range []struct {
+		fixture string
+		want    Stats
+	}{
+		// 4 + 6 English words and 17 Han and kana; "#" and "。" are characters, not words.
+		{"stats-mixed.md", Stats{Words: 27, Chars: 64, ReadingMinutes: 1}},
+		// Hangul is spaced into words, so it's counted as English is.
+		{"stats-korean.md", Stats{Words: 6, Chars: 23, ReadingMinutes: 1}},
+	} {
+		t.Run(tc.fixture, func(t *testing.T) {
+			_, content := copyFixture(t, tc.fixture)
+			if got := BodyStats(content); got != tc.want {
+				t.Errorf("BodyStats = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBodyStatsOpts(t *testing.T) {
+	body := strings.Repeat("word ", 300) + strings.Repeat("字", 300)
+	for _, tc := range []struct {
+		name    string
+		opts    StatsOptions
+		minutes int
+	}{
+		{"defaults", StatsOptions{}, 3},                                        // 1.5 + 0.6
+		{"fast", StatsOptions{WordsPerMinute: 300, CJKCharsPerMinute: 300}, 2}, // 1 + 1
+		{"slow english", StatsOptions{WordsPerMinute: 100}, 4},                 // 3 + 0.6
+		{"negative is default", StatsOptions{WordsPerMinute: -1, CJKCharsPerMinute: -1}, 3},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := BodyStatsOpts(body, tc.opts); got.ReadingMinutes != tc.minutes || got.Words != 600 {
+				t.Errorf("BodyStatsOpts = %+v, want 600 words, %d minutes", got, tc.minutes)
+			}
+		})
+	}
+}
+
+func TestBuildIndexOpts_Stats(t *testing.T) {
+	root := writeIndexTree(t, map[string]string{
+		"a.md": "---\nslug: a\n---\nOne two three.\n```\nskipped code\n```\n",
+		"b.md": "日本語\n",
+	})
+	idx, err := BuildIndexOpts(root, []string{"slug"}, IndexOptions{Stats: &StatsOptions{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Stats{
+		"a.md": {Words: 3, Chars: 12, ReadingMinutes: 1},
+		"b.md": {Words: 3, Chars: 3, ReadingMinutes: 1},
+	}
+	for _, entry := range idx.Entries {
+		if entry.Stats == nil || *entry.Stats != want[entry.Path] {
+			t.Errorf("%s: stats %+v, want %+v", entry.Path, entry.Stats, want[entry.Path])
+		}
+	}
+	if got := idx.ByField("slug", "a"); len(got) != 1 || got[0] != "a.md" {
+		t.Errorf("ByField = %v", got)
+	}
+
+	// An index built without stats gains them on a refresh once asked for them.
+	plain, err := BuildIndex(root, nil)
+	if err != nil || plain.Entries[0].Stats != nil {
+		t.Fatalf("BuildIndex: %v, %+v", err, plain.Entries)
+	}
+	plain.Stats = &StatsOptions{}
+	if err := plain.Refresh(root); err != nil {
+		t.Fatal(err)
+	}
+	if s := plain.Entries[0].Stats; s == nil || *s != want["a.md"] {
+		t.Errorf("after refresh, stats %+v", s)
+	}
+
+	// Stats survive a round trip through the index file.
+	path := root + "/index.yaml"
+	if err := WriteIndex(path, idx); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Stats == nil || loaded.Entries[1].Stats == nil || *loaded.Entries[1].Stats != want["b.md"] {
+		t.Errorf("loaded %+v", loaded)
+	}
+}
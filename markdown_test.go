@@ -0,0 +1,110 @@
+// ABOUTME: Tests for ReadMarkdownFile and WriteMarkdownFile: round trips, missing files, CRLF, and empty bodies.
+// ABOUTME: Reuses the postMeta type from the frontmatter tests.
+package mdstore
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMarkdownFile_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "posts", "hello.md")
+	meta := postMeta{
+		Title:     "Hello",
+		Published: time.Date(2026, 2, 5, 10, 4, 5, 0, time.UTC),
+		Author:    postAuthor{Name: "Ada"},
+	}
+
+	for _, tc := range []struct {
+		name, body, want string
+	}{
+		{"plain", "# Hello\n\nText.\n", "# Hello\n\nText.\n"},
+		{"no newline", "# Hello", "# Hello\n"},
+		{"extra newlines", "# Hello\n\n\n", "# Hello\n"},
+		{"crlf", "# Hello\r\n\r\nText.\r\n", "# Hello\n\nText.\n"},
+		{"empty", "", ""},
+		{"whitespace", "\n  \n", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := WriteMarkdownFile(path, meta, tc.body); err != nil {
+				t.Fatalf("WriteMarkdownFile failed: %v", err)
+			}
+			if got, want := readFileString(t, path), "---\ntitle: Hello\npublished: 2026-02-05T10:04:05Z\nauthor:\n    name: Ada\n---\n"+tc.want; got != want {
+				t.Errorf("file holds:\n%q\nwant:\n%q", got, want)
+			}
+
+			back, body, found, err := ReadMarkdownFile[postMeta](path)
+			if err != nil || !found {
+				t.Fatalf("ReadMarkdownFile = %v, %v", found, err)
+			}
+			if !reflect.DeepEqual(back, meta) || body != tc.want {
+				t.Errorf("read back %+v, %q", back, body)
+			}
+		})
+	}
+}
+
+func TestReadMarkdownFile(t *testing.T) {
+	dir := t.TempDir()
+
+	meta, body, found, err := ReadMarkdownFile[postMeta](filepath.Join(dir, "missing.md"))
+	if err != nil || found || body != "" || !reflect.DeepEqual(meta, postMeta{}) {
+		t.Errorf("missing file: %+v, %q, %v, %v", meta, body, found, err)
+	}
+
+	for name, tc := range map[string]struct {
+		content, title, body string
+	}{
+		"crlf.md":    {"---\r\ntitle: Windows\r\n---\r\n# Body\r\nline two\r\n", "Windows", "# Body\nline two\n"},
+		"plain.md":   {"# No frontmatter\n\n", "", "# No frontmatter\n"},
+		"only-fm.md": {"---\ntitle: Empty body\n---\n", "Empty body", ""},
+		"empty.md":   {"", "", ""},
+	} {
+		path := filepath.Join(dir, name)
+		writeFileString(t, path, tc.content)
+		meta, body, found, err := ReadMarkdownFile[postMeta](path)
+		if err != nil || !found || meta.Title != tc.title || body != tc.body {
+			t.Errorf("%s: got %q, %q, %v, %v", name, meta.Title, body, found, err)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.md")
+	writeFileString(t, bad, "---\ntitle: [broken\n---\nBody\n")
+	_, _, found, err = ReadMarkdownFile[postMeta](bad)
+	if e := asYAMLError(t, err); e.Path != bad || !found {
+		t.Errorf("malformed frontmatter: %+v, found %v", e, found)
+	}
+}
+
+func TestWriteMarkdownFile_Validates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.md")
+	var verr *ValidationError
+	if err := WriteMarkdownFile(path, checkedConfig{Level: "low"}, "body"); !errors.As(err, &verr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	if _, _, found, _ := ReadMarkdownFile[checkedConfig](path); found {
+		t.Error("an invalid document was written")
+	}
+}
+
+func TestWriteMarkdownFile_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.md")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := WriteMarkdownFile(path, postAuthor{Name: "writer"}, "body\n"); err != nil {
+				t.Errorf("WriteMarkdownFile failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if meta, body, _, err := ReadMarkdownFile[postAuthor](path); err != nil || meta.Name != "writer" || body != "body\n" {
+		t.Errorf("got %+v, %q, %v", meta, body, err)
+	}
+}
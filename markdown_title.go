@@ -0,0 +1,109 @@
+// ABOUTME: Document titles: the frontmatter title, else the first # heading of the body, else "untitled".
+// ABOUTME: Provides ExtractTitle, TitleSource, and EnsureTitle, which writes a heading's title into the frontmatter.
+package mdstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TitleSource says where ExtractTitle found a title.
+type TitleSource int
+
+const (
+	TitleUntitled    TitleSource = iota // nowhere: the title is "untitled"
+	TitleFrontmatter                    // the frontmatter's title field
+	TitleHeading                        // the body's first level-1 heading
+)
+
+func (s TitleSource) String() string {
+	switch s {
+	case TitleUntitled:
+		return "untitled"
+	case TitleFrontmatter:
+		return "frontmatter"
+	case TitleHeading:
+		return "heading"
+	}
+	return fmt.Sprintf("TitleSource(%d)", int(s))
+}
+
+// untitled is the title of a document that has none, as Slugify names an empty title.
+const untitled = "untitled"
+
+// ExtractTitle returns the title of the markdown document content: its frontmatter's
+// title field, in any format, if that's set to something other than an empty string;
+// otherwise the text of the body's first level-1 ATX heading ("# Title"), leaving out
+// lines inside fenced code blocks; otherwise "untitled". Frontmatter that doesn't
+// decode is passed over, as if it had no title.
+func ExtractTitle(content string) (title string, source TitleSource) {
+	var meta map[string]interface{}
+	body, err := DecodeFrontmatter("", content, &meta)
+	if err == nil {
+		switch v := meta["title"].(type) {
+		case nil, map[string]interface{}, []interface{}:
+		default:
+			if title = strings.TrimSpace(fmt.Sprint(v)); title != "" {
+				return title, TitleFrontmatter
+			}
+		}
+	} else {
+		_, _, body = ParseFrontmatterFormat(content)
+	}
+
+	if title, ok := firstHeading(body); ok {
+		return title, TitleHeading
+	}
+	return untitled, TitleUntitled
+}
+
+// firstHeading returns the text of the first non-empty level-1 ATX heading in body
+// outside fenced code blocks.
+func firstHeading(body string) (title string, ok bool) {
+	scanMarkdownLines(body, func(line markdownLine) bool {
+		if line.inCode {
+			return true
+		}
+		if level, text, isHeading := atxHeading(line.text); isHeading && level == 1 && text != "" {
+			title, ok = text, true
+			return false
+		}
+		return true
+	})
+	return title, ok
+}
+
+// EnsureTitle gives the markdown file at path a title field in its frontmatter if it
+// has none, taking it from the body's first heading (see ExtractTitle), and returns
+// the file's title. A file with no heading either is left alone, and its title is
+// "untitled". The file is rewritten as UpdateFrontmatterFile rewrites it: under
+// WithLock on its directory, atomically, with the rest of the frontmatter and the body
+// kept as they were.
+func EnsureTitle(path string) (string, error) {
+	var title string
+	err := WithLock(filepath.Dir(path), func() error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var source TitleSource
+		if title, source = ExtractTitle(string(data)); source != TitleHeading {
+			return nil
+		}
+		content, err := updateFrontmatter(path, string(data), func(doc *yaml.Node) error {
+			return SetYAMLPath(doc, "title", title)
+		})
+		if err != nil || content == string(data) {
+			return err
+		}
+		return AtomicWrite(path, []byte(content))
+	})
+	if err != nil {
+		return "", err
+	}
+	return title, nil
+}
@@ -0,0 +1,86 @@
+// ABOUTME: Tests for ExtractTitle and EnsureTitle, and the fence-aware line scanning behind them.
+// ABOUTME: Heading-looking lines inside ``` and ~~~ blocks, nested and unclosed fences, and ATX edge cases.
+package mdstore
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractTitle(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, title string
+		source               TitleSource
+	}{
+		{"frontmatter", "---\ntitle: From Meta\n---\n# From Heading\n", "From Meta", TitleFrontmatter},
+		{"toml frontmatter", "+++\ntitle = \"TOML\"\n+++\n# Heading\n", "TOML", TitleFrontmatter},
+		{"json frontmatter", "{\"title\": \"JSON\"}\n# Heading\n", "JSON", TitleFrontmatter},
+		{"number title", "---\ntitle: 1984\n---\n", "1984", TitleFrontmatter},
+		{"heading", "---\ndate: 2026-02-05\n---\nIntro.\n\n# The Heading\n", "The Heading", TitleHeading},
+		{"empty title", "---\ntitle: ''\n---\n# Heading\n", "Heading", TitleHeading},
+		{"list title", "---\ntitle: [a, b]\n---\n# Heading\n", "Heading", TitleHeading},
+		{"no frontmatter", "# Just a Heading\n\nText.\n", "Just a Heading", TitleHeading},
+		{"malformed frontmatter", "---\ntitle: [broken\n---\n# Heading\n", "Heading", TitleHeading},
+		{"h2 only", "## Not a title\n", "untitled", TitleUntitled},
+		{"h2 first", "## Section\n\n# Title\n", "Title", TitleHeading},
+		{"closing hashes", "# Title ##\n", "Title", TitleHeading},
+		{"hash in text", "# C# for beginners\n", "C# for beginners", TitleHeading},
+		{"no space", "#hashtag\n# Title\n", "Title", TitleHeading},
+		{"indented", "   # Indented\n", "Indented", TitleHeading},
+		{"indented code", "    # Code\n", "untitled", TitleUntitled},
+		{"empty heading", "#\n# Title\n", "Title", TitleHeading},
+		{"crlf", "\r\nText\r\n# Title\r\n", "Title", TitleHeading},
+		{"nothing", "Just text.\n", "untitled", TitleUntitled},
+		{"empty", "", "untitled", TitleUntitled},
+
+		// Code fences.
+		{"backtick fence", "```\n# not a title\n```\n# Title\n", "Title", TitleHeading},
+		{"tilde fence", "~~~ sh\n# comment\n~~~\n# Title\n", "Title", TitleHeading},
+		{"fence with info", "```python\n# comment\n```\n# Title\n", "Title", TitleHeading},
+		{"indented fence", "  ```\n# comment\n  ```\n# Title\n", "Title", TitleHeading},
+		{"four-space fence is code", "    ```\n# Title\n", "Title", TitleHeading},
+		{"longer closing fence", "```\n# a\n`````\n# Title\n", "Title", TitleHeading},
+		{"shorter fence doesn't close", "````\n```\n# a\n````\n# Title\n", "Title", TitleHeading},
+		{"other char doesn't close", "```\n~~~\n# a\n```\n# Title\n", "Title", TitleHeading},
+		{"fence with text doesn't close", "```\n# a\n``` not closed\n# b\n```\n# Title\n", "Title", TitleHeading},
+		{"unclosed fence", "Text\n```\n# inside forever\n", "untitled", TitleUntitled},
+		{"inline code span", "```not a fence```\n# Title\n", "Title", TitleHeading},
+		{"crlf fence", "```\r\n# a\r\n```\r\n# Title\r\n", "Title", TitleHeading},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			title, source := ExtractTitle(tc.content)
+			if title != tc.title || source != tc.source {
+				t.Errorf("got %q, %v; want %q, %v", title, source, tc.title, tc.source)
+			}
+		})
+	}
+}
+
+func TestEnsureTitle(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name, content, title, want string
+	}{
+		{"from heading", "---\ndate: 2026-02-05 # keep\n---\n# Hello\n\nBody.\n", "Hello", "---\ndate: 2026-02-05 # keep\ntitle: Hello\n---\n# Hello\n\nBody.\n"},
+		{"no frontmatter", "# Hello\n", "Hello", "---\ntitle: Hello\n---\n# Hello\n"},
+		{"already titled", "---\ntitle: Meta\n---\n# Hello\n", "Meta", "---\ntitle: Meta\n---\n# Hello\n"},
+		{"untitled", "Just text.\n", "untitled", "Just text.\n"},
+		{"code only", "```\n# comment\n```\n", "untitled", "```\n# comment\n```\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name+".md")
+			writeFileString(t, path, tc.content)
+			title, err := EnsureTitle(path)
+			if err != nil || title != tc.title {
+				t.Fatalf("EnsureTitle = %q, %v; want %q", title, err, tc.title)
+			}
+			if got := readFileString(t, path); got != tc.want {
+				t.Errorf("file holds %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	if _, err := EnsureTitle(filepath.Join(dir, "missing.md")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
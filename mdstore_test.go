@@ -3,12 +3,17 @@
 package mdstore
 
 import (
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -76,6 +81,28 @@ func TestAtomicWrite_CreatesParentDirs(t *testing.T) {
 	}
 }
 
+func TestAtomicWriteReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.txt")
+	if err := AtomicWriteReader(path, iotest.OneByteReader(strings.NewReader("streamed"))); err != nil {
+		t.Fatalf("AtomicWriteReader failed: %v", err)
+	}
+	if got := readFileString(t, path); got != "streamed" {
+		t.Errorf("got %q, want %q", got, "streamed")
+	}
+
+	// A failed read leaves the file as it was, with no temp file behind.
+	failing := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))
+	if err := AtomicWriteReader(path, failing); err == nil || err.Error() != "connection reset" {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	if got := readFileString(t, path); got != "streamed" {
+		t.Errorf("file changed to %q", got)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+}
+
 // --- EnsureDir tests ---
 
 func TestEnsureDir_Create(t *testing.T) {
@@ -245,6 +272,299 @@ func TestReadYAML_Malformed(t *testing.T) {
 	}
 }
 
+func TestReadYAML_EmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.yaml")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var result map[string]interface{}
+	if err := ReadYAML(path, &result); err != nil {
+		t.Fatalf("ReadYAML failed on empty file: %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected nil result for empty file, got %v", result)
+	}
+}
+
+// --- ReadYAMLExists tests ---
+
+func TestReadYAMLExists_ExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.yaml")
+	if err := os.WriteFile(path, []byte("name: Alice\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var result map[string]interface{}
+	found, err := ReadYAMLExists(path, &result)
+	if err != nil {
+		t.Fatalf("ReadYAMLExists failed: %v", err)
+	}
+	if !found {
+		t.Error("expected found=true for existing file")
+	}
+	if result["name"] != "Alice" {
+		t.Errorf("got name=%v, want Alice", result["name"])
+	}
+}
+
+func TestReadYAMLExists_MissingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nonexistent.yaml")
+
+	result := map[string]interface{}{"keep": true}
+	found, err := ReadYAMLExists(path, &result)
+	if err != nil {
+		t.Fatalf("ReadYAMLExists should return nil for missing file, got: %v", err)
+	}
+	if found {
+		t.Error("expected found=false for missing file")
+	}
+	if result["keep"] != true {
+		t.Errorf("dest should be untouched for missing file, got %v", result)
+	}
+}
+
+func TestReadYAMLExists_EmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.yaml")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var result []string
+	found, err := ReadYAMLExists(path, &result)
+	if err != nil {
+		t.Fatalf("ReadYAMLExists failed on empty file: %v", err)
+	}
+	if !found {
+		t.Error("expected found=true for empty file")
+	}
+	if len(result) != 0 {
+		t.Errorf("expected no items for empty file, got %v", result)
+	}
+}
+
+// --- ReadYAMLStrict tests ---
+
+func TestReadYAMLStrict_ExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.yaml")
+	if err := os.WriteFile(path, []byte("name: Alice\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var result map[string]interface{}
+	if err := ReadYAMLStrict(path, &result); err != nil {
+		t.Fatalf("ReadYAMLStrict failed: %v", err)
+	}
+	if result["name"] != "Alice" {
+		t.Errorf("got name=%v, want Alice", result["name"])
+	}
+}
+
+func TestReadYAMLStrict_MissingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "nonexistent.yaml")
+
+	var result map[string]interface{}
+	err := ReadYAMLStrict(path, &result)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	var nf *NotFoundError
+	if !errors.As(err, &nf) || nf.Path != path {
+		t.Errorf("expected NotFoundError for %s, got %#v", path, err)
+	}
+}
+
+func TestReadYAMLStrict_EmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "empty.yaml")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var result map[string]interface{}
+	if err := ReadYAMLStrict(path, &result); err != nil {
+		t.Fatalf("ReadYAMLStrict should accept an empty file, got: %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected nil result for empty file, got %v", result)
+	}
+}
+
+// --- ReadYAMLOrDefault / EnsureYAML tests ---
+
+type defaultsConfig struct {
+	Name    string `yaml:"name"`
+	Port    int    `yaml:"port"`
+	Verbose bool   `yaml:"verbose"`
+}
+
+var configDefaults = defaultsConfig{Name: "app", Port: 8080}
+
+func TestReadYAMLOrDefault_Absent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	cfg, err := ReadYAMLOrDefault(path, configDefaults)
+	if err != nil {
+		t.Fatalf("ReadYAMLOrDefault failed: %v", err)
+	}
+	if cfg != configDefaults {
+		t.Errorf("got %+v, want defaults %+v", cfg, configDefaults)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("ReadYAMLOrDefault should not create the file")
+	}
+}
+
+func TestReadYAMLOrDefault_Present(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("port: 9090\nverbose: true\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	cfg, err := ReadYAMLOrDefault(path, configDefaults)
+	if err != nil {
+		t.Fatalf("ReadYAMLOrDefault failed: %v", err)
+	}
+	want := defaultsConfig{Name: "app", Port: 9090, Verbose: true}
+	if cfg != want {
+		t.Errorf("got %+v, want %+v (unset keys keep defaults)", cfg, want)
+	}
+}
+
+func TestReadYAMLOrDefault_Malformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(":::not valid yaml[[["), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	cfg, err := ReadYAMLOrDefault(path, configDefaults)
+	if err == nil {
+		t.Error("expected error for malformed YAML, got nil")
+	}
+	if cfg != configDefaults {
+		t.Errorf("on error got %+v, want defaults", cfg)
+	}
+}
+
+func TestEnsureYAML_CreatesThenReads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	cfg, created, err := EnsureYAML(path, configDefaults)
+	if err != nil || !created || cfg != configDefaults {
+		t.Fatalf("first EnsureYAML = %+v, %v, %v; want defaults, created", cfg, created, err)
+	}
+	var onDisk defaultsConfig
+	if err := ReadYAML(path, &onDisk); err != nil || onDisk != configDefaults {
+		t.Errorf("defaults not written: %+v, %v", onDisk, err)
+	}
+
+	if err := SetYAMLValue(path, "port", 7070); err != nil {
+		t.Fatalf("SetYAMLValue failed: %v", err)
+	}
+	cfg, created, err = EnsureYAML(path, configDefaults)
+	if err != nil || created || cfg.Port != 7070 {
+		t.Errorf("second EnsureYAML = %+v, %v, %v; want the edited file, not created", cfg, created, err)
+	}
+}
+
+func TestEnsureYAML_ConcurrentCreatesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	const n = 20
+	var wg sync.WaitGroup
+	var createdCount int64
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg, created, err := EnsureYAML(path, configDefaults)
+			if err != nil {
+				t.Errorf("EnsureYAML failed: %v", err)
+				return
+			}
+			if cfg != configDefaults {
+				t.Errorf("got %+v, want defaults", cfg)
+			}
+			if created {
+				atomic.AddInt64(&createdCount, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if createdCount != 1 {
+		t.Errorf("file created %d times, want exactly 1", createdCount)
+	}
+}
+
+// --- ReadYAMLStrictFields tests ---
+
+type strictFieldsDoc struct {
+	Title string   `yaml:"title"`
+	Tags  []string `yaml:"tags"`
+}
+
+func TestReadYAMLStrictFields_ExactMatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc.yaml")
+	if err := os.WriteFile(path, []byte("title: Hello\ntags: [a, b]\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var doc strictFieldsDoc
+	if err := ReadYAMLStrictFields(path, &doc); err != nil {
+		t.Fatalf("ReadYAMLStrictFields failed: %v", err)
+	}
+	if doc.Title != "Hello" || len(doc.Tags) != 2 {
+		t.Errorf("unexpected doc: %+v", doc)
+	}
+}
+
+func TestReadYAMLStrictFields_UnknownKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc.yaml")
+	if err := os.WriteFile(path, []byte("tags: [a]\ntite: Hello\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	var doc strictFieldsDoc
+	err := ReadYAMLStrictFields(path, &doc)
+	if err == nil {
+		t.Fatal("expected error for unknown key, got nil")
+	}
+	for _, want := range []string{path + ":2:", "tite"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %q", err, want)
+		}
+	}
+
+	// The lenient reader still accepts the file.
+	if err := ReadYAML(path, &doc); err != nil {
+		t.Errorf("ReadYAML should ignore unknown keys, got: %v", err)
+	}
+}
+
+func TestReadYAMLStrictFields_MissingOrEmpty(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.yaml")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing.yaml"), empty} {
+		var doc strictFieldsDoc
+		if err := ReadYAMLStrictFields(path, &doc); err != nil {
+			t.Errorf("ReadYAMLStrictFields(%s) should return nil, got: %v", filepath.Base(path), err)
+		}
+	}
+}
+
 // --- WriteYAML tests ---
 
 func TestWriteYAML_Basic(t *testing.T) {
@@ -293,6 +613,218 @@ func TestWriteYAML_Overwrite(t *testing.T) {
 	}
 }
 
+// --- Empty value tests ---
+
+func TestWriteYAML_EmptyValues(t *testing.T) {
+	var nilSlice []testItem
+	var nilMap map[string]int
+	var nilPtr *testItem
+
+	for _, tc := range []struct {
+		name      string
+		src       interface{}
+		canonical string
+	}{
+		{"nil", nil, ""},
+		{"nil pointer", nilPtr, ""},
+		{"nil slice", nilSlice, "[]\n"},
+		{"empty slice", []testItem{}, "[]\n"},
+		{"nil map", nilMap, "{}\n"},
+		{"empty map", map[string]int{}, "{}\n"},
+		{"pointer to empty slice", &[]string{}, "[]\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			canonical := filepath.Join(dir, "canonical.yaml")
+			omitted := filepath.Join(dir, "omitted.yaml")
+
+			if err := WriteYAML(canonical, tc.src); err != nil {
+				t.Fatalf("WriteYAML failed: %v", err)
+			}
+			if err := WriteYAMLOpts(omitted, tc.src, YAMLOptions{Empty: EmptyFile}); err != nil {
+				t.Fatalf("WriteYAMLOpts failed: %v", err)
+			}
+
+			if got := readFileString(t, canonical); got != tc.canonical {
+				t.Errorf("WriteYAML wrote %q, want %q", got, tc.canonical)
+			}
+			if got := readFileString(t, omitted); got != "" {
+				t.Errorf("EmptyFile wrote %q, want an empty file", got)
+			}
+
+			// An omitted value reads back like a missing file.
+			m := map[string]int{"keep": 1}
+			if err := ReadYAML(omitted, &m); err != nil || m["keep"] != 1 {
+				t.Errorf("ReadYAML of an empty file should leave dest untouched, got %v (%v)", m, err)
+			}
+		})
+	}
+}
+
+func TestWriteYAML_NonEmptyUnaffected(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.yaml")
+	if err := WriteYAMLOpts(path, []int{1}, YAMLOptions{Empty: EmptyFile}); err != nil {
+		t.Fatalf("WriteYAMLOpts failed: %v", err)
+	}
+	if got := readFileString(t, path); got != "- 1\n" {
+		t.Errorf("got %q, want %q", got, "- 1\n")
+	}
+}
+
+func TestReadYAML_EmptyFileLikeMissing(t *testing.T) {
+	dir := t.TempDir()
+	for _, content := range []string{"", "  \n\t\n", "null\n", "~\n", "# only a comment\n"} {
+		path := filepath.Join(dir, "file.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		m := map[string]int{"keep": 1}
+		s := []string{"keep"}
+		if err := ReadYAML(path, &m); err != nil {
+			t.Errorf("ReadYAML(%q) into map failed: %v", content, err)
+		}
+		if err := ReadYAML(path, &s); err != nil {
+			t.Errorf("ReadYAML(%q) into slice failed: %v", content, err)
+		}
+		if m["keep"] != 1 || len(s) != 1 {
+			t.Errorf("ReadYAML(%q) should leave dest untouched like a missing file, got %v and %v", content, m, s)
+		}
+	}
+}
+
+func TestAppendYAML_AfterEmptyWrites(t *testing.T) {
+	dir := t.TempDir()
+	for _, src := range []interface{}{nil, []testItem{}} {
+		for _, opts := range []YAMLOptions{{}, {Empty: EmptyFile}} {
+			path := filepath.Join(dir, "items.yaml")
+			if err := WriteYAMLOpts(path, src, opts); err != nil {
+				t.Fatalf("WriteYAMLOpts failed: %v", err)
+			}
+			if err := AppendYAML(path, testItem{Name: "x"}); err != nil {
+				t.Fatalf("AppendYAML after %v failed: %v", src, err)
+			}
+			var items []testItem
+			if err := ReadYAML(path, &items); err != nil || len(items) != 1 {
+				t.Errorf("expected 1 item, got %v (%v)", items, err)
+			}
+		}
+	}
+}
+
+// --- WriteYAMLOpts / RenderFrontmatterOpts golden tests ---
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// checkGolden compares got with testdata/<name>, rewriting the file under -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("updating golden file failed: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file failed: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("output differs from %s:\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+	}
+}
+
+type goldenConfig struct {
+	Title       string            `yaml:"title"`
+	Description string            `yaml:"description"`
+	Server      map[string]int    `yaml:"server"`
+	Tags        []string          `yaml:"tags"`
+	Owners      []goldenOwner     `yaml:"owners"`
+	Labels      map[string]string `yaml:"labels"`
+}
+
+type goldenOwner struct {
+	Name  string `yaml:"name"`
+	Email string `yaml:"email"`
+}
+
+var goldenValue = goldenConfig{
+	Title:       "Golden",
+	Description: strings.Repeat("a long description that must stay on a single line ", 3),
+	Server:      map[string]int{"port": 8080, "workers": 4},
+	Tags:        []string{"alpha", "beta"},
+	Owners:      []goldenOwner{{Name: "Ada", Email: "ada@example.com"}},
+	Labels:      map[string]string{"env": "prod"},
+}
+
+func TestWriteYAMLOpts_Golden(t *testing.T) {
+	for _, tc := range []struct {
+		golden string
+		opts   YAMLOptions
+	}{
+		{"config.indent4.golden.yaml", YAMLOptions{}},
+		{"config.indent2.golden.yaml", YAMLOptions{Indent: 2, NoWrap: true}},
+		{"config.crlf.golden.yaml", YAMLOptions{CRLF: true}},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := WriteYAMLOpts(path, goldenValue, tc.opts); err != nil {
+				t.Fatalf("WriteYAMLOpts failed: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("ReadFile failed: %v", err)
+			}
+			checkGolden(t, tc.golden, data)
+
+			var back goldenConfig
+			if err := ReadYAML(path, &back); err != nil {
+				t.Fatalf("ReadYAML failed: %v", err)
+			}
+			if back.Description != goldenValue.Description || back.Owners[0] != goldenValue.Owners[0] {
+				t.Errorf("round trip lost data: %+v", back)
+			}
+		})
+	}
+}
+
+func TestWriteYAML_MatchesMarshal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := WriteYAML(path, goldenValue); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	want, err := yaml.Marshal(goldenValue)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != string(want) {
+		t.Errorf("WriteYAML should keep yaml.Marshal's format:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestRenderFrontmatterOpts_Golden(t *testing.T) {
+	for _, tc := range []struct {
+		golden string
+		opts   YAMLOptions
+	}{
+		{"frontmatter.indent4.golden.md", YAMLOptions{}},
+		{"frontmatter.indent2.golden.md", YAMLOptions{Indent: 2}},
+		{"frontmatter.crlf.golden.md", YAMLOptions{CRLF: true}},
+	} {
+		t.Run(tc.golden, func(t *testing.T) {
+			got, err := RenderFrontmatterOpts(goldenValue, "# Golden\n\nBody.\n", tc.opts)
+			if err != nil {
+				t.Fatalf("RenderFrontmatterOpts failed: %v", err)
+			}
+			checkGolden(t, tc.golden, []byte(got))
+		})
+	}
+}
+
 // --- AppendYAML tests ---
 
 type testItem struct {
@@ -373,6 +905,148 @@ func TestAppendYAML_Multiple(t *testing.T) {
 	}
 }
 
+// --- UpdateYAML / AppendYAMLLocked tests ---
+
+func TestUpdateYAML_ModifiesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "counter.yaml")
+
+	for i := 0; i < 3; i++ {
+		err := UpdateYAML(dir, path, func(m *map[string]int) error {
+			if *m == nil {
+				*m = map[string]int{}
+			}
+			(*m)["count"]++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("UpdateYAML failed: %v", err)
+		}
+	}
+
+	var m map[string]int
+	if err := ReadYAML(path, &m); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if m["count"] != 3 {
+		t.Errorf("got count=%d, want 3", m["count"])
+	}
+}
+
+func TestUpdateYAML_ErrorLeavesFileUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "items.yaml")
+	if err := WriteYAML(path, []testItem{{Name: "keep", Value: 1}}); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+
+	boom := errors.New("boom")
+	err := UpdateYAML(dir, path, func(items *[]testItem) error {
+		*items = nil
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+
+	var items []testItem
+	if err := ReadYAML(path, &items); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if len(items) != 1 || items[0].Name != "keep" {
+		t.Errorf("file changed despite error: %+v", items)
+	}
+}
+
+func TestAppendYAMLLocked_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "items.yaml")
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- AppendYAMLLocked(dir, path, testItem{Name: "item", Value: i})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("AppendYAMLLocked failed: %v", err)
+		}
+	}
+
+	var items []testItem
+	if err := ReadYAML(path, &items); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if len(items) != n {
+		t.Fatalf("expected %d items, got %d", n, len(items))
+	}
+	seen := make(map[int]bool)
+	for _, it := range items {
+		seen[it.Value] = true
+	}
+	if len(seen) != n {
+		t.Errorf("expected %d distinct items, got %d", n, len(seen))
+	}
+}
+
+// --- AppendYAMLAll tests ---
+
+func TestAppendYAMLAll_AppendsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "items.yaml")
+
+	if err := AppendYAML(path, testItem{Name: "first", Value: 0}); err != nil {
+		t.Fatalf("AppendYAML failed: %v", err)
+	}
+	batch := []testItem{{Name: "a", Value: 1}, {Name: "b", Value: 2}, {Name: "c", Value: 3}}
+	if err := AppendYAMLAll(path, batch); err != nil {
+		t.Fatalf("AppendYAMLAll failed: %v", err)
+	}
+	if err := AppendYAMLItems(path, testItem{Name: "d", Value: 4}, testItem{Name: "e", Value: 5}); err != nil {
+		t.Fatalf("AppendYAMLItems failed: %v", err)
+	}
+
+	var items []testItem
+	if err := ReadYAML(path, &items); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if len(items) != 6 {
+		t.Fatalf("expected 6 items, got %d", len(items))
+	}
+	for i, it := range items {
+		if it.Value != i {
+			t.Errorf("item %d out of order: %+v", i, it)
+		}
+	}
+}
+
+func TestAppendYAMLAll_EmptyIsNoop(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "items.yaml")
+
+	if err := AppendYAMLAll(path, []testItem(nil)); err != nil {
+		t.Fatalf("AppendYAMLAll failed: %v", err)
+	}
+	if err := AppendYAMLItems[testItem](path); err != nil {
+		t.Fatalf("AppendYAMLItems failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("empty append should not touch the directory, found %d entries", len(entries))
+	}
+}
+
 // --- ParseFrontmatter tests ---
 
 func TestParseFrontmatter_WithFrontmatter(t *testing.T) {
@@ -501,6 +1175,77 @@ func TestRenderFrontmatter_ComplexStruct(t *testing.T) {
 	}
 }
 
+func TestRenderFrontmatter_EmptyMetadata(t *testing.T) {
+	type optional struct {
+		Title string   `yaml:"title,omitempty" json:"title,omitempty"`
+		Tags  []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+	}
+	for name, meta := range map[string]interface{}{
+		"nil":          nil,
+		"empty map":    map[string]interface{}{},
+		"nil map":      map[string]string(nil),
+		"empty struct": optional{},
+		"nil pointer":  (*optional)(nil),
+	} {
+		got, err := RenderFrontmatter(meta, "# Body\n")
+		if err != nil || got != "# Body\n" {
+			t.Errorf("%s: got %q, %v; want the body alone", name, got, err)
+		}
+		for _, format := range []Format{FormatTOML, FormatJSON} {
+			if got, err := RenderFrontmatterFormat(format, meta, "# Body\n"); err != nil || got != "# Body\n" {
+				t.Errorf("%s as %v: got %q, %v; want the body alone", name, format, got, err)
+			}
+		}
+	}
+	if got, _ := RenderFrontmatterFormat(FormatTOML, map[string]interface{}{"draft": nil}, "body"); got != "body" {
+		t.Errorf("TOML with only nulls: got %q", got)
+	}
+	if got, _ := RenderFrontmatterOpts(nil, "a\nb\n", YAMLOptions{CRLF: true}); got != "a\r\nb\r\n" {
+		t.Errorf("CRLF: got %q", got)
+	}
+
+	// A field that's set still gets a block.
+	if got, _ := RenderFrontmatter(optional{Title: "A"}, "body"); got != "---\ntitle: A\n---\nbody" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRenderFrontmatter_NoMetadataRoundTrip(t *testing.T) {
+	for _, content := range []string{
+		"# Hello\n\nJust a body.\n",
+		"",
+		"---\n---\n# Hello\n",
+		"---\r\n---\r\n# Hello\r\n",
+		"---\n\n...\n# Hello\n",
+		"---\n{}\n---\n# Hello\n",
+		"\n\n---\n---\n",
+	} {
+		// Twice round, the document settles on the body alone.
+		doc := content
+		for range 2 {
+			yamlStr, body := ParseFrontmatter(doc)
+			if yamlStr != "" && yamlStr != "{}" {
+				t.Fatalf("%q: frontmatter %q", content, yamlStr)
+			}
+			var meta map[string]interface{}
+			if err := yaml.Unmarshal([]byte(yamlStr), &meta); err != nil {
+				t.Fatal(err)
+			}
+			out, err := RenderFrontmatter(meta, body)
+			if err != nil {
+				t.Fatalf("%q: %v", content, err)
+			}
+			if out != body {
+				t.Errorf("%q: rendered %q, want the body %q", content, out, body)
+			}
+			doc = out
+		}
+		if !HasFrontmatter(content) && doc != content {
+			t.Errorf("%q: changed to %q", content, doc)
+		}
+	}
+}
+
 // --- Slugify tests ---
 
 func TestSlugify_Basic(t *testing.T) {
@@ -0,0 +1,105 @@
+// ABOUTME: Deep merging of generic YAML maps, for applying partial overrides to documents and metadata.
+// ABOUTME: Provides DeepMerge, DeepMergeOpts, MergeOptions, and the file-level MergeYAML and MergeYAMLOpts.
+package mdstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+)
+
+// MergeOptions controls DeepMergeOpts and MergeYAMLOpts.
+type MergeOptions struct {
+	// AppendLists appends src's list to dst's instead of replacing it.
+	AppendLists bool
+
+	// UniqueLists, with AppendLists, leaves out items of src's list that dst's already
+	// has, or that come earlier in src's, as when adding a tag.
+	UniqueLists bool
+
+	// NilDeletes makes a nil value in src delete the key from the result,
+	// instead of setting it to null.
+	NilDeletes bool
+}
+
+// DeepMerge returns dst with src merged in, using the default MergeOptions: nested
+// maps are merged key by key, and for anything else (scalars, lists, or a map meeting
+// a non-map) src's value wins. Neither argument is modified, though the result may
+// share nested values with them. Nested maps only merge as map[string]interface{},
+// the type ReadYAML produces for generic documents.
+func DeepMerge(dst, src map[string]interface{}) map[string]interface{} {
+	return DeepMergeOpts(dst, src, MergeOptions{})
+}
+
+// DeepMergeOpts is DeepMerge with explicit options.
+func DeepMergeOpts(dst, src map[string]interface{}, opts MergeOptions) map[string]interface{} {
+	out := make(map[string]interface{}, len(dst)+len(src))
+	for k, v := range dst {
+		out[k] = v
+	}
+
+	for k, sv := range src {
+		if sv == nil && opts.NilDeletes {
+			delete(out, k)
+			continue
+		}
+		dv, ok := out[k]
+		if !ok {
+			out[k] = sv
+			continue
+		}
+
+		dm, dIsMap := dv.(map[string]interface{})
+		sm, sIsMap := sv.(map[string]interface{})
+		switch {
+		case dIsMap && sIsMap:
+			out[k] = DeepMergeOpts(dm, sm, opts)
+		case opts.AppendLists && isList(dv) && isList(sv):
+			out[k] = appendLists(dv, sv, opts.UniqueLists)
+		default:
+			out[k] = sv
+		}
+	}
+	return out
+}
+
+// isList reports whether v is a slice or array (but not []byte, which YAML encodes as a string).
+func isList(v interface{}) bool {
+	if _, ok := v.([]byte); ok {
+		return false
+	}
+	k := reflect.ValueOf(v).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
+// appendLists returns the elements of a followed by those of b, as a new []interface{}.
+// With unique set, elements of b equal to one already in the result are left out.
+func appendLists(a, b interface{}, unique bool) []interface{} {
+	av, bv := reflect.ValueOf(a), reflect.ValueOf(b)
+	out := make([]interface{}, 0, av.Len()+bv.Len())
+	for i := 0; i < av.Len(); i++ {
+		out = append(out, av.Index(i).Interface())
+	}
+	for i := 0; i < bv.Len(); i++ {
+		item := bv.Index(i).Interface()
+		if !unique || !slices.ContainsFunc(out, func(v interface{}) bool { return reflect.DeepEqual(v, item) }) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// MergeYAML deep-merges partial into the YAML mapping stored at path (see DeepMerge)
+// and writes the result back atomically, under WithLock on path's directory. A missing
+// or empty file is treated as an empty mapping.
+func MergeYAML(path string, partial map[string]interface{}) error {
+	return MergeYAMLOpts(path, partial, MergeOptions{})
+}
+
+// MergeYAMLOpts is MergeYAML with explicit options, like DeepMergeOpts.
+func MergeYAMLOpts(path string, partial map[string]interface{}, opts MergeOptions) error {
+	return UpdateYAML(filepath.Dir(path), path, func(doc *map[string]interface{}) error {
+		*doc = DeepMergeOpts(*doc, partial, opts)
+		return nil
+	})
+}
@@ -0,0 +1,192 @@
+// ABOUTME: Table-driven tests for DeepMerge semantics and the file-level MergeYAML.
+// ABOUTME: Covers nested maps, type conflicts, list replacement vs append (unique or not), and nil-as-delete.
+package mdstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type ymap = map[string]interface{}
+
+func TestDeepMergeOpts(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		dst, src ymap
+		opts     MergeOptions
+		want     ymap
+	}{
+		{
+			name: "disjoint keys",
+			dst:  ymap{"a": 1},
+			src:  ymap{"b": 2},
+			want: ymap{"a": 1, "b": 2},
+		},
+		{
+			name: "scalar conflict src wins",
+			dst:  ymap{"a": 1, "b": "x"},
+			src:  ymap{"a": 2},
+			want: ymap{"a": 2, "b": "x"},
+		},
+		{
+			name: "nested maps merge",
+			dst:  ymap{"server": ymap{"host": "localhost", "port": 8080, "tls": ymap{"on": false, "cert": "a.pem"}}},
+			src:  ymap{"server": ymap{"port": 9090, "tls": ymap{"on": true}}},
+			want: ymap{"server": ymap{"host": "localhost", "port": 9090, "tls": ymap{"on": true, "cert": "a.pem"}}},
+		},
+		{
+			name: "map replaces scalar",
+			dst:  ymap{"a": "flat"},
+			src:  ymap{"a": ymap{"nested": 1}},
+			want: ymap{"a": ymap{"nested": 1}},
+		},
+		{
+			name: "scalar replaces map",
+			dst:  ymap{"a": ymap{"nested": 1}},
+			src:  ymap{"a": "flat"},
+			want: ymap{"a": "flat"},
+		},
+		{
+			name: "list replaces map",
+			dst:  ymap{"a": ymap{"nested": 1}},
+			src:  ymap{"a": []interface{}{1}},
+			opts: MergeOptions{AppendLists: true},
+			want: ymap{"a": []interface{}{1}},
+		},
+		{
+			name: "lists replaced by default",
+			dst:  ymap{"tags": []interface{}{"a", "b"}},
+			src:  ymap{"tags": []interface{}{"c"}},
+			want: ymap{"tags": []interface{}{"c"}},
+		},
+		{
+			name: "lists appended with option",
+			dst:  ymap{"tags": []interface{}{"a", "b"}},
+			src:  ymap{"tags": []string{"c"}},
+			opts: MergeOptions{AppendLists: true},
+			want: ymap{"tags": []interface{}{"a", "b", "c"}},
+		},
+		{
+			name: "unique lists skip items already there",
+			dst:  ymap{"tags": []interface{}{"a", "b"}},
+			src:  ymap{"tags": []string{"b", "c", "c"}},
+			opts: MergeOptions{AppendLists: true, UniqueLists: true},
+			want: ymap{"tags": []interface{}{"a", "b", "c"}},
+		},
+		{
+			name: "unique lists need append",
+			dst:  ymap{"tags": []interface{}{"a"}},
+			src:  ymap{"tags": []interface{}{"a"}},
+			opts: MergeOptions{UniqueLists: true},
+			want: ymap{"tags": []interface{}{"a"}},
+		},
+		{
+			name: "nested lists appended",
+			dst:  ymap{"x": ymap{"tags": []interface{}{"a"}}},
+			src:  ymap{"x": ymap{"tags": []interface{}{"b"}}},
+			opts: MergeOptions{AppendLists: true},
+			want: ymap{"x": ymap{"tags": []interface{}{"a", "b"}}},
+		},
+		{
+			name: "list meets scalar with append",
+			dst:  ymap{"tags": "one"},
+			src:  ymap{"tags": []interface{}{"two"}},
+			opts: MergeOptions{AppendLists: true},
+			want: ymap{"tags": []interface{}{"two"}},
+		},
+		{
+			name: "nil sets null by default",
+			dst:  ymap{"a": 1, "b": 2},
+			src:  ymap{"a": nil},
+			want: ymap{"a": nil, "b": 2},
+		},
+		{
+			name: "nil deletes with option",
+			dst:  ymap{"a": 1, "b": 2},
+			src:  ymap{"a": nil, "missing": nil},
+			opts: MergeOptions{NilDeletes: true},
+			want: ymap{"b": 2},
+		},
+		{
+			name: "nested nil deletes",
+			dst:  ymap{"server": ymap{"host": "h", "debug": true}},
+			src:  ymap{"server": ymap{"debug": nil}},
+			opts: MergeOptions{NilDeletes: true},
+			want: ymap{"server": ymap{"host": "h"}},
+		},
+		{
+			name: "nil dst",
+			dst:  nil,
+			src:  ymap{"a": 1},
+			want: ymap{"a": 1},
+		},
+		{
+			name: "nil src",
+			dst:  ymap{"a": 1},
+			src:  nil,
+			want: ymap{"a": 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := DeepMergeOpts(tc.dst, tc.src, tc.opts)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %#v, want %#v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeepMerge_DoesNotModifyInputs(t *testing.T) {
+	dst := ymap{"server": ymap{"port": 8080}, "tags": []interface{}{"a"}}
+	src := ymap{"server": ymap{"port": 9090}, "tags": []interface{}{"b"}}
+
+	DeepMergeOpts(dst, src, MergeOptions{AppendLists: true})
+
+	if dst["server"].(ymap)["port"] != 8080 || len(dst["tags"].([]interface{})) != 1 {
+		t.Errorf("dst was modified: %v", dst)
+	}
+	if src["server"].(ymap)["port"] != 9090 || len(src["tags"].([]interface{})) != 1 {
+		t.Errorf("src was modified: %v", src)
+	}
+}
+
+func TestMergeYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	base := ymap{"name": "app", "server": ymap{"host": "localhost", "port": 8080}, "tags": []interface{}{"a"}}
+	if err := WriteYAML(path, base); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+
+	if err := MergeYAML(path, ymap{"server": ymap{"port": 9090}}); err != nil {
+		t.Fatalf("MergeYAML failed: %v", err)
+	}
+	if err := MergeYAMLOpts(path, ymap{"tags": []interface{}{"b"}, "name": nil}, MergeOptions{AppendLists: true, NilDeletes: true}); err != nil {
+		t.Fatalf("MergeYAMLOpts failed: %v", err)
+	}
+
+	var got ymap
+	if err := ReadYAML(path, &got); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	want := ymap{"server": ymap{"host": "localhost", "port": 9090}, "tags": []interface{}{"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+}
+
+func TestMergeYAML_MissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.yaml")
+
+	if err := MergeYAML(path, ymap{"a": ymap{"b": 1}}); err != nil {
+		t.Fatalf("MergeYAML failed: %v", err)
+	}
+
+	var got ymap
+	if err := ReadYAML(path, &got); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, ymap{"a": ymap{"b": 1}}) {
+		t.Errorf("got %#v", got)
+	}
+}
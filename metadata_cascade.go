@@ -0,0 +1,143 @@
+// ABOUTME: Cascading metadata defaults: _defaults.yaml files whose values apply to every document beneath their directory.
+// ABOUTME: Provides ResolveMetadata; defaults files are read through a CachedYAML, so unchanged ones aren't read again.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultsFile is the name of the file in a directory of a store whose metadata
+// applies to every document beneath it (see ResolveMetadata). HiddenDefaultsFile is
+// read instead where there's no DefaultsFile.
+const (
+	DefaultsFile       = "_defaults.yaml"
+	HiddenDefaultsFile = ".mdstore-defaults.yaml"
+)
+
+// defaultsCache holds the defaults files read, revalidated by stat on each read.
+var defaultsCache = NewCachedYAML[map[string]interface{}](0)
+
+// ResolveMetadata returns docMeta, the frontmatter of the document at docPath, a path
+// under root such as filepath.Join(root, "posts/a.md"), with the defaults of the
+// directories from root down to the document's merged under it, as Hugo cascades
+// them. Each directory's defaults are its DefaultsFile, or else its
+// HiddenDefaultsFile, read with ReadYAML; a deeper directory's override a shallower
+// one's, and the document's own values override them all. Values merge as DeepMerge
+// merges them, so nested maps merge key by key, and anything else is replaced. The
+// result shares nothing with the cached defaults, and neither argument is modified.
+func ResolveMetadata(root, docPath string, docMeta map[string]interface{}) (map[string]interface{}, error) {
+	dirs, err := cascadeDirs(root, docPath)
+	if err != nil {
+		return nil, err
+	}
+	meta := make(map[string]interface{})
+	for _, dir := range dirs {
+		defaults, err := readDefaults(dir)
+		if err != nil {
+			return nil, err
+		}
+		meta = DeepMerge(meta, defaults)
+	}
+	return DeepMerge(meta, docMeta), nil
+}
+
+// cascadeModTime returns the latest modification time of the defaults files that
+// apply to the document at docPath, under root, or the zero time if there are none.
+func cascadeModTime(root, docPath string) (time.Time, error) {
+	dirs, err := cascadeDirs(root, docPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var latest time.Time
+	for _, dir := range dirs {
+		_, info, err := findDefaults(dir)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info != nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest.UTC(), nil
+}
+
+// cascadeDirs returns the directories from root down to that of docPath.
+func cascadeDirs(root, docPath string) ([]string, error) {
+	rel, err := filepath.Rel(root, filepath.Dir(docPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("mdstore: %s is not under %s", docPath, root)
+	}
+	dirs := []string{root}
+	if rel == "." {
+		return dirs, nil
+	}
+	dir := root
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, elem)
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// readDefaults returns a copy of dir's defaults, or nil if it has none.
+func readDefaults(dir string) (map[string]interface{}, error) {
+	path, info, err := findDefaults(dir)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	defaults, err := defaultsCache.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	// Cached values are shared, so the caller gets its own to merge into.
+	copied, _ := cloneMeta(defaults).(map[string]interface{})
+	return copied, nil
+}
+
+// findDefaults returns the path and file info of dir's defaults file, or a nil info
+// if it has none.
+func findDefaults(dir string) (string, fs.FileInfo, error) {
+	for _, name := range []string{DefaultsFile, HiddenDefaultsFile} {
+		path := filepath.Join(dir, name)
+		info, err := os.Stat(path)
+		switch {
+		case err == nil:
+			return path, info, nil
+		case !errors.Is(err, fs.ErrNotExist):
+			return "", nil, err
+		}
+	}
+	return "", nil, nil
+}
+
+// cloneMeta returns a deep copy of v, a value decoded from YAML: its maps and lists
+// are copied, and anything else is kept.
+func cloneMeta(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = cloneMeta(item)
+		}
+		return out
+	case []interface{}:
+		if v == nil {
+			return v
+		}
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = cloneMeta(item)
+		}
+		return out
+	}
+	return v
+}
@@ -0,0 +1,180 @@
+// ABOUTME: Tests for ResolveMetadata's cascade of _defaults.yaml files, and its use by the Index and Document.
+// ABOUTME: Covers override order across three levels, the hidden defaults file, edits to defaults, and paths outside the root.
+package mdstore
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeCascadeTree writes a store with defaults at three levels and returns its root.
+func writeCascadeTree(t *testing.T) string {
+	t.Helper()
+	return writeIndexTree(t, map[string]string{
+		DefaultsFile:                    "layout: page\nauthor: {name: Ada, email: ada@example.com}\ntags: [site]\n",
+		"blog/" + DefaultsFile:          "layout: post\nauthor: {name: Grace}\n",
+		"blog/2026/" + DefaultsFile:     "year: 2026\ntags: [archive]\n",
+		"blog/2026/hello.md":            "---\ntitle: Hello\nlayout: special\n---\n",
+		"blog/2026/plain.md":            "# No frontmatter\n",
+		"notes/" + HiddenDefaultsFile:   "kind: note\n",
+		"notes/todo.md":                 "---\ntitle: Todo\n---\n",
+		"docs/" + DefaultsFile:          "kind: doc\n",
+		"docs/" + HiddenDefaultsFile:    "kind: ignored\n",
+		"docs/guide.md":                 "---\n---\n",
+		"top.md":                        "---\nauthor: {email: me@example.com}\n---\n",
+		"blog/2026/draft/" + "wip.md":   "---\nyear: 2027\n---\n",
+		"blog/2026/draft/" + "empty.md": "",
+	})
+}
+
+func TestResolveMetadata(t *testing.T) {
+	root := writeCascadeTree(t)
+	for _, tc := range []struct {
+		doc  string
+		meta map[string]interface{}
+		want map[string]interface{}
+	}{
+		{"blog/2026/hello.md", map[string]interface{}{"title": "Hello", "layout": "special"}, map[string]interface{}{
+			"title": "Hello", "layout": "special", "year": 2026, "tags": []interface{}{"archive"},
+			"author": map[string]interface{}{"name": "Grace", "email": "ada@example.com"},
+		}},
+		{"blog/2026/draft/wip.md", map[string]interface{}{"year": 2027}, map[string]interface{}{
+			"layout": "post", "year": 2027, "tags": []interface{}{"archive"},
+			"author": map[string]interface{}{"name": "Grace", "email": "ada@example.com"},
+		}},
+		{"top.md", map[string]interface{}{"author": map[string]interface{}{"email": "me@example.com"}}, map[string]interface{}{
+			"layout": "page", "tags": []interface{}{"site"},
+			"author": map[string]interface{}{"name": "Ada", "email": "me@example.com"},
+		}},
+		{"notes/todo.md", nil, map[string]interface{}{
+			"layout": "page", "tags": []interface{}{"site"}, "kind": "note",
+			"author": map[string]interface{}{"name": "Ada", "email": "ada@example.com"},
+		}},
+		{"docs/guide.md", nil, map[string]interface{}{
+			"layout": "page", "tags": []interface{}{"site"}, "kind": "doc",
+			"author": map[string]interface{}{"name": "Ada", "email": "ada@example.com"},
+		}},
+	} {
+		t.Run(tc.doc, func(t *testing.T) {
+			got, err := ResolveMetadata(root, filepath.Join(root, filepath.FromSlash(tc.doc)), tc.meta)
+			if err != nil {
+				t.Fatalf("ResolveMetadata failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ResolveMetadata =\n%v\nwant\n%v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveMetadata_DefaultsChange(t *testing.T) {
+	root := writeCascadeTree(t)
+	doc := filepath.Join(root, "blog", "2026", "hello.md")
+
+	got, err := ResolveMetadata(root, doc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The result is the caller's; changing it leaves the cached defaults alone.
+	got["author"].(map[string]interface{})["name"] = "changed"
+	got["tags"].([]interface{})[0] = "changed"
+	if again, _ := ResolveMetadata(root, doc, nil); again["author"].(map[string]interface{})["name"] != "Grace" || again["tags"].([]interface{})[0] != "archive" {
+		t.Errorf("a change to a result reached the cache: %v", again)
+	}
+
+	if err := WriteYAML(filepath.Join(root, "blog", DefaultsFile), map[string]interface{}{"layout": "essay"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = ResolveMetadata(root, doc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["layout"] != "essay" || got["author"].(map[string]interface{})["name"] != "Ada" {
+		t.Errorf("after editing blog's defaults: %v", got)
+	}
+
+	if err := os.Remove(filepath.Join(root, "blog", "2026", DefaultsFile)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = ResolveMetadata(root, doc, nil); got["year"] != nil {
+		t.Errorf("after deleting 2026's defaults: %v", got)
+	}
+}
+
+func TestResolveMetadata_Errors(t *testing.T) {
+	root := writeCascadeTree(t)
+	if _, err := ResolveMetadata(filepath.Join(root, "blog"), filepath.Join(root, "top.md"), nil); err == nil {
+		t.Error("expected an error for a document outside the root")
+	}
+	writeIndexFile(t, root, "bad/"+DefaultsFile, "- not a mapping\n")
+	if _, err := ResolveMetadata(root, filepath.Join(root, "bad", "x.md"), nil); err == nil {
+		t.Error("expected an error for defaults that aren't a mapping")
+	}
+}
+
+func TestBuildIndex_Cascade(t *testing.T) {
+	root := writeCascadeTree(t)
+	idx, err := BuildIndexOpts(root, []string{"layout", "author.name"}, IndexOptions{Cascade: true})
+	if err != nil {
+		t.Fatalf("BuildIndexOpts failed: %v", err)
+	}
+	if got := idx.ByField("layout", "post"); !reflect.DeepEqual(got, []string{"blog/2026/draft/empty.md", "blog/2026/draft/wip.md", "blog/2026/plain.md"}) {
+		t.Errorf(`ByField("layout", "post") = %v`, got)
+	}
+	if got := idx.ByField("author.name", "Grace"); len(got) != 4 {
+		t.Errorf(`ByField("author.name", "Grace") = %v`, got)
+	}
+
+	// Editing defaults, without touching the documents, is picked up by Refresh.
+	path := filepath.Join(root, "blog", DefaultsFile)
+	writeFileString(t, path, "layout: essay\n")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Refresh(root); err != nil {
+		t.Fatal(err)
+	}
+	if got := idx.ByField("layout", "essay"); len(got) != 3 {
+		t.Errorf(`after editing defaults, ByField("layout", "essay") = %v`, got)
+	}
+
+	plain, err := BuildIndex(root, []string{"layout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plain.ByField("layout", "essay"); len(got) != 0 {
+		t.Errorf("without Cascade, defaults were indexed: %v", got)
+	}
+}
+
+func TestDocument_Cascade(t *testing.T) {
+	root := writeCascadeTree(t)
+	path := filepath.Join(root, "blog", "2026", "hello.md")
+
+	d, err := LoadDocumentOpts[docMeta](path, DocumentOptions{CascadeRoot: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Meta.Title != "Hello" || d.Resolved["layout"] != "special" || d.Resolved["year"] != 2026 {
+		t.Fatalf("loaded meta %+v, resolved %v", d.Meta, d.Resolved)
+	}
+
+	d.Meta.Title = "Changed"
+	if err := d.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFileString(t, path); got != "---\ntitle: Changed\n---\n" {
+		t.Errorf("defaults were saved into the file: %q", got)
+	}
+	if d.Resolved["title"] != "Changed" || d.Resolved["year"] != 2026 {
+		t.Errorf("after save, resolved %v", d.Resolved)
+	}
+
+	if plain, err := LoadDocument[docMeta](path); err != nil || plain.Resolved != nil {
+		t.Errorf("without a CascadeRoot: resolved %v, err %v", plain.Resolved, err)
+	}
+}
@@ -0,0 +1,167 @@
+// ABOUTME: Tests for read-only roots installed with SetReadOnly.
+// ABOUTME: Covers refused mutations, untouched filesystems, working reads, and canonical path matching.
+package mdstore
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// useReadOnly marks roots read-only for the duration of the test.
+func useReadOnly(t *testing.T, roots ...string) {
+	t.Helper()
+	SetReadOnly(roots...)
+	t.Cleanup(func() { SetReadOnly() })
+}
+
+// listTree returns every path under root, relative and sorted.
+func listTree(t *testing.T, root string) []string {
+	t.Helper()
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestSetReadOnly_RefusesMutationsWithoutTouchingFiles(t *testing.T) {
+	root := t.TempDir()
+	store := filepath.Join(root, "posts")
+	if err := WriteYAML(filepath.Join(store, "index.yaml"), []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	before := listTree(t, root)
+	useReadOnly(t, root)
+
+	ran := false
+	fn := func() error { ran = true; return nil }
+	calls := map[string]func() error{
+		"AtomicWrite": func() error { return AtomicWrite(filepath.Join(store, "new.md"), []byte("x")) },
+		"EnsureDir":   func() error { return EnsureDir(filepath.Join(store, "sub")) },
+		"WriteYAML":   func() error { return WriteYAML(filepath.Join(store, "index.yaml"), []string{"b"}) },
+		"AppendYAML":  func() error { return AppendYAML(filepath.Join(store, "index.yaml"), "b") },
+		"WithLock":    func() error { return WithLock(store, fn) },
+		"WithLockOpts": func() error {
+			return WithLockOpts(store, LockOptions{Strategy: StrategyPortable}, fn)
+		},
+		"WithNamedLock": func() error { return WithNamedLock(store, "posts", fn) },
+		"TryWithLock": func() error {
+			_, err := TryWithLock(store, fn)
+			return err
+		},
+		"WithLocks": func() error { return WithLocks([]string{store}, fn) },
+		"AcquireLock": func() error {
+			l, err := AcquireLock(store)
+			if err == nil {
+				l.Release()
+			}
+			return err
+		},
+		"WithRootLock": func() error { return WithRootLock(root, fn) },
+		"WithLease": func() error {
+			return WithLease(store, time.Second, func(context.Context) error { return fn() })
+		},
+		"FileLocker": func() error { return FileLocker{}.WithLock(context.Background(), lockKey(store, ""), fn) },
+		"BreakLock":  func() error { return BreakLock(store, BreakOptions{}) },
+		"ClearDirty": func() error { return ClearDirty(store) },
+	}
+	for name, call := range calls {
+		err := call()
+		var roErr *ReadOnlyError
+		if !errors.Is(err, ErrReadOnly) || !errors.As(err, &roErr) {
+			t.Errorf("%s: expected ErrReadOnly, got %v", name, err)
+		}
+	}
+
+	if ran {
+		t.Error("critical section ran under a read-only root")
+	}
+	if after := listTree(t, root); !slices.Equal(after, before) {
+		t.Errorf("read-only root was modified:\nbefore %v\nafter  %v", before, after)
+	}
+}
+
+func TestSetReadOnly_ReadsStillWork(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "index.yaml")
+	if err := WriteYAML(path, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	useReadOnly(t, root)
+
+	var got []string
+	if err := ReadYAML(path, &got); err != nil || len(got) != 1 {
+		t.Errorf("ReadYAML under read-only root: %v, %v", got, err)
+	}
+	if locked, _, err := IsLocked(root); err != nil || locked {
+		t.Errorf("IsLocked under read-only root: %v, %v", locked, err)
+	}
+	if _, found, err := LockInfo(root); err != nil || found {
+		t.Errorf("LockInfo under read-only root: %v, %v", found, err)
+	}
+	if dirty, _, err := IsDirty(root); err != nil || dirty {
+		t.Errorf("IsDirty under read-only root: %v, %v", dirty, err)
+	}
+}
+
+func TestSetReadOnly_CanonicalMatching(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "snap")
+	sibling := filepath.Join(base, "snapshot") // shares root's name as a prefix
+	if err := EnsureDir(root); err != nil {
+		t.Fatal(err)
+	}
+	useReadOnly(t, root)
+
+	if err := WithLock(sibling, func() error { return nil }); err != nil {
+		t.Errorf("sibling with a common name prefix was treated as read-only: %v", err)
+	}
+
+	link := filepath.Join(base, "link")
+	if err := os.Symlink(root, link); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	if err := AtomicWrite(filepath.Join(link, "new", "file.md"), []byte("x")); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("write through a symlink into the root: expected ErrReadOnly, got %v", err)
+	}
+	if err := WithLock(filepath.Join(base, ".", "snap"), func() error { return nil }); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("unclean path into the root: expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestSetReadOnly_LockDirUnderRoot(t *testing.T) {
+	locks := t.TempDir()
+	SetLockDir(HashedLockDir(locks))
+	t.Cleanup(func() { SetLockDir(nil) })
+	useReadOnly(t, locks)
+
+	if err := WithLock(t.TempDir(), func() error { return nil }); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("lock file under a read-only root: expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestSetReadOnly_ClearedWithNoArgs(t *testing.T) {
+	root := t.TempDir()
+	SetReadOnly(root)
+	SetReadOnly()
+
+	if err := AtomicWrite(filepath.Join(root, "a.md"), []byte("x")); err != nil {
+		t.Errorf("write after clearing read-only roots failed: %v", err)
+	}
+}
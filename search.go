@@ -0,0 +1,348 @@
+// ABOUTME: Search of a store's markdown files: body text or regexp matches with context, narrowed by frontmatter filters.
+// ABOUTME: Provides Search, Query, Result, Match, and the Filter constructors; files are scanned, optionally in parallel.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Query says what Search looks for.
+type Query struct {
+	// Text, if set, is a substring a line of the body must hold.
+	Text string
+
+	// Regexp, if set, is an expression a line of the body must match. With Text, a
+	// line must have both.
+	Regexp *regexp.Regexp
+
+	// IgnoreCase matches Text and Regexp without regard to case: Text as
+	// strings.ToLower lowercases, and Regexp as (?i) has it.
+	IgnoreCase bool
+
+	// Filters are predicates every matching document's frontmatter must satisfy.
+	Filters []Filter
+
+	// Context is the number of lines kept before and after each matching line.
+	Context int
+
+	// Fields are the dotted paths (see GetYAMLValue) of the frontmatter fields each
+	// Result carries. If empty, it carries them all.
+	Fields []string
+
+	// Glob picks the files searched, as TransformYAMLDir's pattern does. Default "*.md".
+	Glob string
+
+	// Offset and Limit page through the results: the first Offset are passed over, and
+	// no more than Limit, if positive, are returned.
+	Offset, Limit int
+
+	// Workers is the number of files read at once; if 0, runtime.GOMAXPROCS. The
+	// results are the same however many there are.
+	Workers int
+}
+
+// Filter is a frontmatter predicate of a Query, called with a document's frontmatter,
+// which is empty if it has none.
+type Filter func(meta map[string]interface{}) bool
+
+// Result is a document Search found.
+type Result struct {
+	Path    string                 // relative to the root searched, with forward slashes
+	Meta    map[string]interface{} // its frontmatter, or the Query's Fields of it
+	Matches []Match                // its matching lines, in order; none for a Query without Text or Regexp
+}
+
+// Match is a matching line of a document's body.
+type Match struct {
+	Line   int      // its 1-based number within the file, frontmatter included
+	Text   string   // the line, without its line break
+	Before []string // up to Query.Context lines before it
+	After  []string // up to Query.Context lines after it
+}
+
+// FieldEquals returns a Filter for documents whose field, a dotted path, is value,
+// compared as Index.ByField compares values.
+func FieldEquals(field, value string) Filter {
+	keys := splitYAMLPath(field)
+	return func(meta map[string]interface{}) bool {
+		v, ok := lookupMetaPath(meta, keys)
+		return ok && v != nil && fmt.Sprint(v) == value
+	}
+}
+
+// FieldContains returns a Filter for documents whose field, a dotted path, holds
+// substr, without regard to case.
+func FieldContains(field, substr string) Filter {
+	keys := splitYAMLPath(field)
+	substr = strings.ToLower(substr)
+	return func(meta map[string]interface{}) bool {
+		v, ok := lookupMetaPath(meta, keys)
+		return ok && v != nil && strings.Contains(strings.ToLower(fmt.Sprint(v)), substr)
+	}
+}
+
+// TagIn returns a Filter for documents whose field, a dotted path, is one of tags, or
+// is a list holding one of them, as "tags: [go, yaml]" holds go.
+func TagIn(field string, tags ...string) Filter {
+	keys := splitYAMLPath(field)
+	return func(meta map[string]interface{}) bool {
+		v, ok := lookupMetaPath(meta, keys)
+		if !ok || v == nil {
+			return false
+		}
+		list, isList := v.([]interface{})
+		if !isList {
+			list = []interface{}{v}
+		}
+		return slices.ContainsFunc(list, func(item interface{}) bool {
+			return item != nil && slices.Contains(tags, fmt.Sprint(item))
+		})
+	}
+}
+
+// DateRange returns a Filter for documents whose field, a dotted path, is a time from
+// from, inclusive, to to, exclusive. A zero from or to leaves that end open. Times
+// are YAML timestamps, such as 2026-01-02, or strings ParseTime parses.
+func DateRange(field string, from, to time.Time) Filter {
+	keys := splitYAMLPath(field)
+	return func(meta map[string]interface{}) bool {
+		v, _ := lookupMetaPath(meta, keys)
+		var t time.Time
+		switch v := v.(type) {
+		case time.Time:
+			t = v
+		case string:
+			parsed, err := ParseTime(v)
+			if err != nil {
+				return false
+			}
+			t = parsed
+		default:
+			return false
+		}
+		return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+	}
+}
+
+// Search returns the markdown documents under root, found as BuildIndex finds them,
+// that satisfy q: in order of path, those whose frontmatter passes every Filter and,
+// if q has Text or a Regexp, whose body has a matching line. Frontmatter is read
+// first, as ReadFrontmatter reads it, so a document that fails a Filter costs only
+// its frontmatter; bodies are read only to be matched. Files are scanned on a pool of
+// workers (see Query.Workers), fed by the walk as it goes, and with a Limit, no more
+// are handed out once the results are found. A file that can't be read is left out,
+// and its error joined, in order of path, into the one returned with the results.
+func Search(root string, q Query) ([]Result, error) {
+	match, err := q.lineMatcher()
+	if err != nil {
+		return nil, err
+	}
+	glob := q.Glob
+	if glob == "" {
+		glob = "*.md"
+	}
+
+	// Files are scanned on q.Workers goroutines, each result kept at the file's place
+	// in the walk. Once the files up to some place have all been scanned and hold the
+	// results asked for, no more are handed out, and what came after is dropped, so the
+	// results and errors are those of a scan in order, however it's scheduled.
+	want := -1
+	if q.Limit > 0 {
+		want = max(q.Offset, 0) + q.Limit
+	}
+	var mu sync.Mutex
+	var results []*Result
+	var errs []error
+	var scanned []bool
+	done, found := 0, 0 // the files up to done are scanned, and found of them match
+	stop := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return found == want
+	}
+	err = walkGlobWorkers(root, glob, q.Workers, stop, func(i int, path string, _ fs.DirEntry) {
+		r, err := searchFile(root, path, q, match)
+		mu.Lock()
+		defer mu.Unlock()
+		for len(results) <= i {
+			results, errs, scanned = append(results, nil), append(errs, nil), append(scanned, false)
+		}
+		results[i], errs[i], scanned[i] = r, err, true
+		for ; done < len(scanned) && scanned[done] && found != want; done++ {
+			if results[done] != nil {
+				found++
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == want {
+		results, errs = results[:done], errs[:done]
+	}
+
+	var out []Result
+	skip := max(q.Offset, 0)
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+		out = append(out, *r)
+	}
+	return out, errors.Join(errs...)
+}
+
+// lineMatcher returns the test a line of a body must pass, or nil if q matches no
+// text.
+func (q *Query) lineMatcher() (func(line string) bool, error) {
+	var tests []func(string) bool
+	if q.Text != "" {
+		if q.IgnoreCase {
+			text := strings.ToLower(q.Text)
+			tests = append(tests, func(line string) bool { return strings.Contains(strings.ToLower(line), text) })
+		} else {
+			text := q.Text
+			tests = append(tests, func(line string) bool { return strings.Contains(line, text) })
+		}
+	}
+	if q.Regexp != nil {
+		re := q.Regexp
+		if q.IgnoreCase {
+			var err error
+			if re, err = regexp.Compile("(?i)" + re.String()); err != nil {
+				return nil, fmt.Errorf("mdstore: search: %w", err)
+			}
+		}
+		tests = append(tests, re.MatchString)
+	}
+	if len(tests) == 0 {
+		return nil, nil
+	}
+	return func(line string) bool {
+		for _, test := range tests {
+			if !test(line) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+// mayMatch reports whether content could have a line matching q, checking the whole
+// of it for q.Text at once before it's split into lines.
+func (q *Query) mayMatch(content string) bool {
+	switch {
+	case q.Text == "":
+		return true
+	case q.IgnoreCase:
+		return strings.Contains(strings.ToLower(content), strings.ToLower(q.Text))
+	}
+	return strings.Contains(content, q.Text)
+}
+
+// searchFile returns the Result for the file at path, under root, or nil if it
+// doesn't satisfy q.
+func searchFile(root, path string, q Query, match func(string) bool) (*Result, error) {
+	var meta map[string]interface{}
+	readMeta := len(q.Filters) > 0 || match == nil
+	if readMeta {
+		var err error
+		if meta, _, err = ReadFrontmatter[map[string]interface{}](path); err != nil {
+			return nil, err
+		}
+		if !passesFilters(meta, q.Filters) {
+			return nil, nil
+		}
+	}
+	var matches []Match
+	if match != nil {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		content := string(data)
+		if !q.mayMatch(content) {
+			return nil, nil
+		}
+		if matches = matchLines(content, match, q.Context); len(matches) == 0 {
+			return nil, nil
+		}
+		if !readMeta {
+			if _, err := DecodeFrontmatter(path, content, &meta); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Result{Path: filepath.ToSlash(rel), Meta: meta, Matches: matches}
+	if len(q.Fields) > 0 {
+		r.Meta = make(map[string]interface{}, len(q.Fields))
+		for _, field := range q.Fields {
+			if v, ok := lookupMetaPath(meta, splitYAMLPath(field)); ok {
+				r.Meta[field] = v
+			}
+		}
+	}
+	return r, nil
+}
+
+// passesFilters reports whether meta satisfies every one of filters.
+func passesFilters(meta map[string]interface{}, filters []Filter) bool {
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	for _, filter := range filters {
+		if !filter(meta) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLines returns the lines of content's body that pass match, numbered from the
+// top of content, with context lines around each.
+func matchLines(content string, match func(string) bool, context int) []Match {
+	start := len(content) - len(StripFrontmatter(content))
+	first := 1 + countLineBreaks(content[:start])
+	lines := strings.Split(strings.TrimSuffix(content[start:], "\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	if first == 1 {
+		lines[0] = strings.TrimPrefix(lines[0], utf8BOM)
+	}
+
+	var matches []Match
+	for i, line := range lines {
+		if !match(line) {
+			continue
+		}
+		m := Match{Line: first + i, Text: line}
+		if context > 0 {
+			m.Before = slices.Clone(lines[max(i-context, 0):i])
+			m.After = slices.Clone(lines[i+1 : min(i+1+context, len(lines))])
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
@@ -0,0 +1,55 @@
+// ABOUTME: Benchmarks for Search over a store of a thousand posts with bodies of about 8KiB.
+// ABOUTME: Queries range from frontmatter filters alone to case-insensitive body text, paged and with a worker pool.
+package mdstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSearchBenchStore writes n posts, each with a body of about 8KiB, under a temp
+// dir and returns its root.
+func writeSearchBenchStore(b *testing.B, n int) string {
+	b.Helper()
+	root := b.TempDir()
+	body := strings.Repeat("Some body text that goes on and on about nothing much.\n", 150)
+	for i := range n {
+		dir := filepath.Join(root, fmt.Sprintf("%02d", i%20))
+		if err := EnsureDir(dir); err != nil {
+			b.Fatal(err)
+		}
+		tag := []string{"go", "yaml", "rust", "notes"}[i%4]
+		content := fmt.Sprintf("---\ntitle: Post %d\ntags: [%s]\ndate: 2026-%02d-01\n---\n%sThe needle %d.\n", i, tag, i%12+1, body, i)
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("post-%d.md", i)), []byte(content), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return root
+}
+
+func BenchmarkSearch(b *testing.B) {
+	root := writeSearchBenchStore(b, 1000)
+	for _, bc := range []struct {
+		name string
+		q    Query
+	}{
+		{"filter", Query{Filters: []Filter{TagIn("tags", "go")}}},
+		{"text", Query{Text: "needle 99"}},
+		{"text/ignorecase", Query{Text: "NEEDLE 99", IgnoreCase: true}},
+		{"text/filtered", Query{Text: "needle", Filters: []Filter{TagIn("tags", "go")}}},
+		{"text/workers=1", Query{Text: "needle 99", Workers: 1}},
+		{"text/workers=8", Query{Text: "needle 99", Workers: 8}},
+		{"text/limit=10", Query{Text: "needle", Limit: 10}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := Search(root, bc.q); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
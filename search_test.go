@@ -0,0 +1,225 @@
+// ABOUTME: Tests for Search: body text and regexp matches, context lines, frontmatter filters, and pagination.
+// ABOUTME: Parallel searches must return what sequential ones do, in the same order.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// writeSearchTree writes a small store of posts and returns its root.
+func writeSearchTree(t *testing.T) string {
+	t.Helper()
+	return writeIndexTree(t, map[string]string{
+		"a.md":           "---\ntitle: Alpha\ntags: [go, yaml]\ndate: 2026-01-15\nauthor:\n  name: Ada\n---\nFirst line.\nThe Gopher says hi.\nLast line.\n",
+		"b.md":           "---\ntitle: Beta\ntags: [rust]\ndate: \"2026-03-01T10:00:00Z\"\n---\r\nNo gophers here?\r\nOnly crabs.\r\n",
+		"posts/c.md":     "---\ntitle: Gamma go\ntags: go\ndate: 2025-12-31\n---\ngopher one\nfiller\ngopher two\n",
+		"posts/d.md":     "Just a body about a GOPHER.\n",
+		"notes.txt":      "gopher in a text file\n",
+		".hidden/e.md":   "gopher hidden\n",
+		"posts/title.md": "---\ntitle: gopher in the title only\n---\nnothing\n",
+	})
+}
+
+func resultPaths(results []Result) []string {
+	paths := []string{}
+	for _, r := range results {
+		paths = append(paths, r.Path)
+	}
+	return paths
+}
+
+func TestSearch_Text(t *testing.T) {
+	root := writeSearchTree(t)
+
+	results, err := Search(root, Query{Text: "gopher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultPaths(results), []string{"b.md", "posts/c.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+
+	results, err = Search(root, Query{Text: "gopher", IgnoreCase: true, Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultPaths(results), []string{"a.md", "b.md", "posts/c.md", "posts/d.md"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("paths = %v, want %v", got, want)
+	}
+	if got, want := results[0].Matches, []Match{{Line: 9, Text: "The Gopher says hi.", Before: []string{"First line."}, After: []string{"Last line."}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("a.md matches = %+v, want %+v", got, want)
+	}
+	if got, want := results[1].Matches, []Match{{Line: 6, Text: "No gophers here?", Before: []string{}, After: []string{"Only crabs."}}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("b.md matches = %+v, want %+v", got, want)
+	}
+	if got := results[2].Matches; len(got) != 2 || got[0].Line != 6 || got[1].Line != 8 || !reflect.DeepEqual(got[1].Before, []string{"filler"}) {
+		t.Errorf("posts/c.md matches = %+v", got)
+	}
+	if got := results[3]; got.Meta != nil || got.Matches[0].Line != 1 {
+		t.Errorf("posts/d.md = %+v", got)
+	}
+	if results[0].Meta["title"] != "Alpha" {
+		t.Errorf("a.md meta = %v", results[0].Meta)
+	}
+}
+
+func TestSearch_Regexp(t *testing.T) {
+	root := writeSearchTree(t)
+	results, err := Search(root, Query{Regexp: regexp.MustCompile(`^gopher \w+$`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].Matches) != 2 {
+		t.Errorf("results = %+v", results)
+	}
+
+	results, err = Search(root, Query{Regexp: regexp.MustCompile(`a (gopher)`), IgnoreCase: true, Text: "body"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultPaths(results); !reflect.DeepEqual(got, []string{"posts/d.md"}) {
+		t.Errorf("Text and Regexp together: %v", got)
+	}
+}
+
+func TestSearch_Filters(t *testing.T) {
+	root := writeSearchTree(t)
+	day := func(s string) time.Time {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	for _, tc := range []struct {
+		name    string
+		filters []Filter
+		want    []string
+	}{
+		{"equals", []Filter{FieldEquals("title", "Beta")}, []string{"b.md"}},
+		{"nested equals", []Filter{FieldEquals("author.name", "Ada")}, []string{"a.md"}},
+		{"contains", []Filter{FieldContains("title", "GO")}, []string{"posts/c.md", "posts/title.md"}},
+		{"tag in list", []Filter{TagIn("tags", "go")}, []string{"a.md", "posts/c.md"}},
+		{"tag in several", []Filter{TagIn("tags", "rust", "yaml")}, []string{"a.md", "b.md"}},
+		{"date range", []Filter{DateRange("date", day("2026-01-01"), day("2026-03-01"))}, []string{"a.md"}},
+		{"open range", []Filter{DateRange("date", day("2026-01-01"), time.Time{})}, []string{"a.md", "b.md"}},
+		{"all of them", []Filter{TagIn("tags", "go"), DateRange("date", time.Time{}, day("2026-01-01"))}, []string{"posts/c.md"}},
+		{"missing field", []Filter{FieldEquals("nope", "")}, []string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := Search(root, Query{Filters: tc.filters})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resultPaths(results); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("paths = %v, want %v", got, tc.want)
+			}
+			for _, r := range results {
+				if r.Matches != nil {
+					t.Errorf("%s: matches without Text: %+v", r.Path, r.Matches)
+				}
+			}
+		})
+	}
+
+	results, err := Search(root, Query{Text: "gopher", IgnoreCase: true, Filters: []Filter{TagIn("tags", "go")}, Fields: []string{"title", "author.name"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resultPaths(results); !reflect.DeepEqual(got, []string{"a.md", "posts/c.md"}) {
+		t.Errorf("paths = %v", got)
+	}
+	if want := map[string]interface{}{"title": "Alpha", "author.name": "Ada"}; !reflect.DeepEqual(results[0].Meta, want) {
+		t.Errorf("Fields meta = %v, want %v", results[0].Meta, want)
+	}
+}
+
+func TestSearch_Pages(t *testing.T) {
+	root := writeSearchTree(t)
+	all, err := Search(root, Query{Text: "gopher", IgnoreCase: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, workers := range []int{0, 1, 3} {
+		var pages [][]string
+		for offset := 0; offset < 6; offset += 3 {
+			page, err := Search(root, Query{Text: "gopher", IgnoreCase: true, Offset: offset, Limit: 3, Workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pages = append(pages, resultPaths(page))
+		}
+		want := [][]string{resultPaths(all)[:3], resultPaths(all)[3:]}
+		if !reflect.DeepEqual(pages, want) {
+			t.Errorf("workers %d: pages = %v, want %v", workers, pages, want)
+		}
+	}
+
+	parallel, err := Search(root, Query{Text: "gopher", IgnoreCase: true, Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parallel, all) {
+		t.Errorf("parallel = %+v, want %+v", parallel, all)
+	}
+}
+
+// However many workers scan the files, a search returns the same results and errors,
+// including when a limit stops it early.
+func TestSearch_Workers(t *testing.T) {
+	files := make(map[string]string)
+	for i := range 150 {
+		name := fmt.Sprintf("%02d/post-%03d.md", i%5, i)
+		files[name] = fmt.Sprintf("---\ntitle: Post %d\ntags: [t%d]\n---\nline\nneedle %d\n", i, i%3, i)
+		if i%25 == 0 {
+			files[name] = "---\ntitle: [broken\n---\nneedle\n"
+		}
+	}
+	root := writeIndexTree(t, files)
+
+	for _, q := range []Query{
+		{Text: "needle"},
+		{Text: "needle", Filters: []Filter{TagIn("tags", "t1")}, Context: 1},
+		{Text: "needle", Offset: 10, Limit: 5},
+		{Regexp: regexp.MustCompile(`needle \d+5$`), Limit: 3},
+		{Filters: []Filter{FieldContains("title", "post 1")}, Limit: 100},
+	} {
+		q.Workers = 1
+		want, wantErr := Search(root, q)
+		for _, workers := range []int{0, 2, 16} {
+			q.Workers = workers
+			got, err := Search(root, q)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%+v: got %v, want %v", q, resultPaths(got), resultPaths(want))
+			}
+			if fmt.Sprint(err) != fmt.Sprint(wantErr) {
+				t.Errorf("%+v: err = %v, want %v", q, err, wantErr)
+			}
+		}
+	}
+}
+
+func TestSearch_Errors(t *testing.T) {
+	root := writeSearchTree(t)
+	writeIndexFile(t, root, "bad.md", "---\ntitle: [broken\n---\ngopher\n")
+
+	results, err := Search(root, Query{Text: "gopher"})
+	var yerr *YAMLError
+	if !errors.As(err, &yerr) {
+		t.Errorf("err = %v, want the bad file's *YAMLError", err)
+	}
+	if got := resultPaths(results); !reflect.DeepEqual(got, []string{"b.md", "posts/c.md"}) {
+		t.Errorf("paths = %v", got)
+	}
+
+	if _, err := Search(filepath.Join(root, "missing"), Query{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing root: err = %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+// ABOUTME: Markdown document templates: {{var}} placeholders filled in across frontmatter and body.
+// ABOUTME: Provides NewFromTemplate, CreateFromTemplate, and MissingVarsError, with date, datetime, and slug built in.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// templatePlaceholder matches a placeholder, "{{name}}" or "{{ name }}", capturing its
+// name, or an escaped "\{{", which stands for a literal "{{".
+var templatePlaceholder = regexp.MustCompile(`\\\{\{|\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// MissingVarsError is a template whose placeholders name variables that weren't given.
+type MissingVarsError struct {
+	Path  string   // the template
+	Names []string // every missing variable, in order of first use
+}
+
+func (e *MissingVarsError) Error() string {
+	return fmt.Sprintf("mdstore: template %s: missing variables: %s", e.Path, strings.Join(e.Names, ", "))
+}
+
+// NewFromTemplate reads the markdown template at templatePath and fills in its
+// placeholders, returning its frontmatter, decoded as ReadMarkdownFile decodes it, and
+// its body, normalized likewise. A placeholder is a variable's name in double braces,
+// "{{name}}", with optional spaces inside them; it may appear anywhere in the body,
+// and in the values, keys, and comments of YAML frontmatter, quoted or not. Write
+// "\{{" for a literal "{{". A placeholder that is the whole of an unquoted value takes
+// the type its text has in YAML, so "date: {{date}}" is a date; quote it to keep a
+// string. Values are inserted as they are, with no escaping, in the body.
+//
+// vars supplies the variables, and overrides these built in: date, the current date
+// as 2006-01-02; datetime, the current time as FormatTime writes it; and slug, the
+// Slugify of vars["title"], if there is one. If any placeholder names a variable
+// that's neither, the error is a *MissingVarsError listing them all. A missing
+// template returns a *NotFoundError, and TOML or JSON frontmatter an error.
+func NewFromTemplate(templatePath string, vars map[string]string) (meta map[string]interface{}, body string, err error) {
+	content, err := readTemplate(templatePath)
+	if err != nil {
+		return nil, "", err
+	}
+	doc, body, _, err := expandTemplate(templatePath, content, templateValues(vars))
+	if err != nil {
+		return nil, "", err
+	}
+	if doc.Kind != 0 {
+		if err := doc.Decode(&meta); err != nil {
+			return nil, "", newYAMLError(templatePath, err, 0)
+		}
+	}
+	return meta, body, nil
+}
+
+// CreateFromTemplate writes a new document under root from the template at
+// templatePath, filled in as NewFromTemplate fills it, with title as the title
+// variable, and returns its path. The file is named for UniqueSlug of title, with an
+// ".md" extension, so it never replaces another, and is chosen and written under
+// WithLock on root. The slug variable, unless vars sets it, is that file's slug, so a
+// second "Standup" gets standup-2 in both. The frontmatter keeps the template's key
+// order, comments, and indentation. Nothing is written if filling in fails.
+func CreateFromTemplate(root, templatePath, title string, vars map[string]string) (string, error) {
+	content, err := readTemplate(templatePath)
+	if err != nil {
+		return "", err
+	}
+	values := templateValues(vars)
+	values["title"] = title
+
+	var path string
+	err = WithLock(root, func() error {
+		slug := UniqueSlug(title, func(candidate string) bool {
+			_, err := os.Lstat(filepath.Join(root, candidate+".md"))
+			return !errors.Is(err, fs.ErrNotExist)
+		})
+		if _, ok := vars["slug"]; !ok {
+			values["slug"] = slug
+		}
+		doc, body, indent, err := expandTemplate(templatePath, content, values)
+		if err != nil {
+			return err
+		}
+		out, err := RenderFrontmatterOpts(doc, body, YAMLOptions{Indent: indent})
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(root, slug+".md")
+		return AtomicWrite(path, []byte(out))
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readTemplate reads the template at path.
+func readTemplate(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", &NotFoundError{Path: path}
+	}
+	return string(data), err
+}
+
+// templateValues returns the variables a template is filled in with: the built-in
+// ones, overridden by vars.
+func templateValues(vars map[string]string) map[string]string {
+	t := now()
+	values := map[string]string{"date": t.Format(time.DateOnly), "datetime": FormatTime(t)}
+	if title, ok := vars["title"]; ok {
+		values["slug"] = Slugify(title)
+	}
+	maps.Copy(values, vars)
+	return values
+}
+
+// expandTemplate fills in the placeholders of content, the template at path, from
+// values, returning its frontmatter's document node, empty if it has none, its body,
+// and the indentation of its frontmatter.
+func expandTemplate(path, content string, values map[string]string) (*yaml.Node, string, int, error) {
+	var missing []string
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(content, -1) {
+		if _, ok := values[m[1]]; m[1] != "" && !ok && !slices.Contains(missing, m[1]) {
+			missing = append(missing, m[1])
+		}
+	}
+	if len(missing) > 0 {
+		return nil, "", 0, &MissingVarsError{Path: path, Names: missing}
+	}
+
+	// Placeholders aren't YAML ("{{" opens a flow mapping), so each is swapped for a
+	// plain token while the frontmatter is found and parsed, and filled in after.
+	prefix := "mdstore-tpl"
+	for strings.Contains(content, prefix) {
+		prefix += "x"
+	}
+	var fills []string
+	src := templatePlaceholder.ReplaceAllStringFunc(content, func(m string) string {
+		fills = append(fills, fillPlaceholder(m, values))
+		return fmt.Sprintf("%s%d-", prefix, len(fills)-1)
+	})
+	token := regexp.MustCompile(regexp.QuoteMeta(prefix) + `(\d+)-`)
+	fill := func(s string) string {
+		return token.ReplaceAllStringFunc(s, func(tok string) string {
+			i, _ := strconv.Atoi(token.FindStringSubmatch(tok)[1])
+			return fills[i]
+		})
+	}
+
+	fm, raw, body, err := extractFrontmatter(src)
+	if err != nil {
+		return nil, "", 0, setFrontmatterErrorPath(err, path)
+	}
+	if fm.format == FormatTOML || fm.format == FormatJSON {
+		return nil, "", 0, notYAMLFrontmatterError(path, fm.format)
+	}
+	body = normalizeMarkdownBody(fill(body))
+	doc := new(yaml.Node)
+	if fm.format != FormatYAML {
+		return doc, body, 4, nil
+	}
+	if err := checkYAMLAliases(path, []byte(raw), fm.line); err != nil {
+		return nil, "", 0, err
+	}
+	if err := yaml.Unmarshal([]byte(raw), doc); err != nil {
+		return nil, "", 0, newYAMLError(path, err, fm.line)
+	}
+	fillYAMLNode(doc, fill)
+	return doc, body, detectYAMLIndent([]byte(raw)), nil
+}
+
+// fillPlaceholder returns the value of m, a match of templatePlaceholder, whose
+// variable is in values: "{{" for an escaped "\{{".
+func fillPlaceholder(m string, values map[string]string) string {
+	if m == `\{{` {
+		return "{{"
+	}
+	return values[templatePlaceholder.FindStringSubmatch(m)[1]]
+}
+
+// fillYAMLNode applies fill to the scalars and comments of the tree at node. A plain
+// scalar that fill changes is retagged as its new text resolves.
+func fillYAMLNode(node *yaml.Node, fill func(string) string) {
+	node.HeadComment = fill(node.HeadComment)
+	node.LineComment = fill(node.LineComment)
+	node.FootComment = fill(node.FootComment)
+	if node.Kind == yaml.ScalarNode {
+		if v := fill(node.Value); v != node.Value {
+			if node.Style == 0 && node.Tag == "!!str" {
+				node.Tag = (&yaml.Node{Kind: yaml.ScalarNode, Value: v}).ShortTag()
+			}
+			node.Value = v
+		}
+	}
+	for _, child := range node.Content {
+		fillYAMLNode(child, fill)
+	}
+}
@@ -0,0 +1,136 @@
+// ABOUTME: Tests for NewFromTemplate and CreateFromTemplate: placeholders in frontmatter and body, built-ins, and escapes.
+// ABOUTME: Also covers MissingVarsError listing every missing variable, and unique filenames under a store root.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const meetingTemplate = `---
+# Created {{date}}
+title: {{title}}
+date: {{date}}
+attendees: [{{host}}, guest]
+summary: "{{ title }} with {{host}}"
+slug: {{slug}}
+count: {{count}}
+---
+# {{title}}
+
+Hosted by {{host}}. Write \{{name}} for a placeholder.
+`
+
+func writeTemplate(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "template.md")
+	writeFileString(t, path, content)
+	return path
+}
+
+func TestNewFromTemplate(t *testing.T) {
+	useClock(t)
+	tpl := writeTemplate(t, meetingTemplate)
+
+	meta, body, err := NewFromTemplate(tpl, map[string]string{"title": "Weekly: Sync", "host": "Ada", "count": "3"})
+	if err != nil {
+		t.Fatalf("NewFromTemplate failed: %v", err)
+	}
+	today, _ := time.Parse(time.DateOnly, now().Format(time.DateOnly))
+	want := map[string]interface{}{
+		"title":     "Weekly: Sync",
+		"date":      today,
+		"attendees": []interface{}{"Ada", "guest"},
+		"summary":   "Weekly: Sync with Ada",
+		"slug":      "weekly-sync",
+		"count":     3,
+	}
+	if !reflect.DeepEqual(meta, want) {
+		t.Errorf("meta = %#v, want %#v", meta, want)
+	}
+	if want := "# Weekly: Sync\n\nHosted by Ada. Write {{name}} for a placeholder.\n"; body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+
+	// Variables override the built-ins.
+	meta, _, err = NewFromTemplate(tpl, map[string]string{"title": "T", "host": "Ada", "count": "1", "date": "2020-01-02", "slug": "custom"})
+	if err != nil {
+		t.Fatalf("NewFromTemplate failed: %v", err)
+	}
+	if meta["slug"] != "custom" || !meta["date"].(time.Time).Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("overrides ignored: %v", meta)
+	}
+}
+
+func TestNewFromTemplate_NoFrontmatter(t *testing.T) {
+	useClock(t)
+	tpl := writeTemplate(t, "# {{datetime}}\n\n{{ note }}\n\n")
+
+	meta, body, err := NewFromTemplate(tpl, map[string]string{"note": "x: {y}"})
+	if err != nil {
+		t.Fatalf("NewFromTemplate failed: %v", err)
+	}
+	if want := "# " + FormatTime(now()) + "\n\nx: {y}\n"; meta != nil || body != want {
+		t.Errorf("got %v, %q; want no metadata and %q", meta, body, want)
+	}
+}
+
+func TestNewFromTemplate_MissingVars(t *testing.T) {
+	tpl := writeTemplate(t, meetingTemplate)
+
+	_, _, err := NewFromTemplate(tpl, map[string]string{"count": "1"})
+	var missing *MissingVarsError
+	if !errors.As(err, &missing) {
+		t.Fatalf("got %v, want a *MissingVarsError", err)
+	}
+	// slug is built in only with a title.
+	if want := []string{"title", "host", "slug"}; !reflect.DeepEqual(missing.Names, want) || missing.Path != tpl {
+		t.Errorf("got %+v, want names %v", missing, want)
+	}
+
+	if _, _, err := NewFromTemplate(filepath.Join(t.TempDir(), "none.md"), nil); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing template: got %v", err)
+	}
+	if _, _, err := NewFromTemplate(writeTemplate(t, "+++\ntitle = \"{{title}}\"\n+++\n"), map[string]string{"title": "T"}); err == nil {
+		t.Error("TOML frontmatter should fail")
+	}
+}
+
+func TestCreateFromTemplate(t *testing.T) {
+	useClock(t)
+	tpl := writeTemplate(t, meetingTemplate)
+	root := filepath.Join(t.TempDir(), "notes")
+	vars := map[string]string{"host": "Ada", "count": "2"}
+
+	first, err := CreateFromTemplate(root, tpl, "Standup", vars)
+	if err != nil {
+		t.Fatalf("CreateFromTemplate failed: %v", err)
+	}
+	second, err := CreateFromTemplate(root, tpl, "Standup", vars)
+	if err != nil {
+		t.Fatalf("CreateFromTemplate failed: %v", err)
+	}
+	if first != filepath.Join(root, "standup.md") || second != filepath.Join(root, "standup-2.md") {
+		t.Errorf("paths = %s, %s", first, second)
+	}
+
+	want := "---\n# Created " + now().Format(time.DateOnly) + "\ntitle: Standup\ndate: " + now().Format(time.DateOnly) +
+		"\nattendees: [Ada, guest]\nsummary: \"Standup with Ada\"\nslug: standup-2\ncount: 2\n---\n" +
+		"# Standup\n\nHosted by Ada. Write {{name}} for a placeholder.\n"
+	if got := readFileString(t, second); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A failure writes nothing.
+	if _, err := CreateFromTemplate(root, tpl, "Retro", nil); err == nil {
+		t.Error("missing variables should fail")
+	}
+	if _, err := os.Stat(filepath.Join(root, "retro.md")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("retro.md written: %v", err)
+	}
+}
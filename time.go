@@ -1,10 +1,14 @@
 // ABOUTME: Time formatting and parsing helpers for consistent storage.
-// ABOUTME: Uses RFC3339Nano as primary format with RFC3339 fallback for parsing.
+// ABOUTME: Uses RFC3339Nano as primary format with RFC3339 fallback; StoredTime applies both in YAML and JSON.
 package mdstore
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // FormatTime formats a time in RFC3339Nano for consistent storage.
@@ -27,3 +31,79 @@ func ParseTime(s string) (time.Time, error) {
 
 	return time.Time{}, fmt.Errorf("mdstore: unable to parse time %q: expected RFC3339 or RFC3339Nano format", s)
 }
+
+// StoredTime is a time.Time that is written with FormatTime and read with ParseTime
+// in YAML and JSON, so time fields are stored alike throughout. The zero time is
+// written as null, and null or an empty string reads as the zero time (in YAML, null
+// leaves the field as it was, as yaml.v3 does for any struct). It reports IsZero, so
+// yaml "omitempty" (and json "omitzero") leave unset times out.
+type StoredTime struct{ time.Time }
+
+// MarshalYAML implements yaml.Marshaler.
+func (t StoredTime) MarshalYAML() (interface{}, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	return FormatTime(t.Time), nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (t *StoredTime) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && (node.ShortTag() == "!!null" || node.Value == "") {
+		t.Time = time.Time{}
+		return nil
+	}
+	if node.Kind == yaml.ScalarNode {
+		if parsed, err := ParseTime(node.Value); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	// A TypeError lets yaml.v3 carry on and report the line, as for its own types.
+	return &yaml.TypeError{Errors: []string{
+		fmt.Sprintf("line %d: cannot unmarshal %s into a time: expected RFC3339", node.Line, describeYAMLNode(node)),
+	}}
+}
+
+// describeYAMLNode names node for an error message: a scalar's value, or its kind.
+func describeYAMLNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return fmt.Sprintf("%q", node.Value)
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+	return "a value"
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t StoredTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(FormatTime(t.Time))
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *StoredTime) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("mdstore: cannot unmarshal %s into a time: expected an RFC3339 string", data)
+	}
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	parsed, err := ParseTime(s)
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
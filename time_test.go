@@ -0,0 +1,159 @@
+// ABOUTME: Tests for StoredTime: YAML, JSON, and frontmatter round trips, zero values, and bad input.
+// ABOUTME: Checks that nanoseconds and offsets survive and that omitempty leaves unset times out.
+package mdstore
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type timedEntry struct {
+	Name    string     `yaml:"name" json:"name"`
+	Created StoredTime `yaml:"created" json:"created"`
+	Updated StoredTime `yaml:"updated,omitempty" json:"updated,omitzero"`
+}
+
+var storedTimeCases = []StoredTime{
+	{time.Date(2026, 2, 5, 10, 4, 5, 123456789, time.UTC)},
+	{time.Date(2026, 2, 5, 10, 4, 5, 1, time.FixedZone("", -7*3600))},
+	{time.Date(2026, 2, 5, 10, 4, 5, 0, time.FixedZone("", 5*3600+1800))},
+}
+
+func TestStoredTime_YAMLRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.yaml")
+
+	for _, want := range storedTimeCases {
+		if err := WriteYAML(path, timedEntry{Name: "a", Created: want, Updated: want}); err != nil {
+			t.Fatalf("WriteYAML failed: %v", err)
+		}
+		if content := readFileString(t, path); !strings.Contains(content, "created: \""+FormatTime(want.Time)+"\"\n") {
+			t.Errorf("expected the FormatTime text in the file:\n%s", content)
+		}
+
+		var got timedEntry
+		if err := ReadYAML(path, &got); err != nil {
+			t.Fatalf("ReadYAML failed: %v", err)
+		}
+		if !got.Created.Equal(want.Time) || !got.Updated.Equal(want.Time) {
+			t.Errorf("got %v and %v, want %v", got.Created, got.Updated, want)
+		}
+		if FormatTime(got.Created.Time) != FormatTime(want.Time) {
+			t.Errorf("offset or precision lost: got %v, want %v", got.Created, want)
+		}
+	}
+}
+
+func TestStoredTime_YAMLZero(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.yaml")
+
+	if err := WriteYAML(path, timedEntry{Name: "a"}); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+	if got := readFileString(t, path); got != "name: a\ncreated: null\n" {
+		t.Errorf("zero times should be null, or left out with omitempty; got:\n%s", got)
+	}
+
+	for _, content := range []string{
+		"name: a\ncreated: null\n",
+		"name: a\ncreated: ''\nupdated: ~\n",
+		"name: a\ncreated:\n",
+		"name: a\n",
+	} {
+		writeFileString(t, path, content)
+		var got timedEntry
+		if err := ReadYAML(path, &got); err != nil {
+			t.Fatalf("ReadYAML(%q) failed: %v", content, err)
+		}
+		if !got.Created.IsZero() || !got.Updated.IsZero() {
+			t.Errorf("ReadYAML(%q) = %+v, want zero times", content, got)
+		}
+	}
+
+	// An empty string clears a time already set.
+	writeFileString(t, path, "created: ''\n")
+	got := timedEntry{Created: storedTimeCases[0]}
+	if err := ReadYAML(path, &got); err != nil || !got.Created.IsZero() {
+		t.Errorf("got %+v, %v; want the zero time", got, err)
+	}
+}
+
+func TestStoredTime_YAMLErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "entry.yaml")
+
+	for _, content := range []string{
+		"name: a\ncreated: yesterday\n",
+		"name: a\ncreated: 2026-02-05\n",
+		"name: a\ncreated: [2026]\n",
+	} {
+		writeFileString(t, path, content)
+		var got timedEntry
+		err := ReadYAML(path, &got)
+		yerr := asYAMLError(t, err)
+		if yerr.Path != path || yerr.Line != 2 || !strings.Contains(err.Error(), "expected RFC3339") {
+			t.Errorf("ReadYAML(%q): got %v, want an error at %s:2", content, err, path)
+		}
+		if got.Name != "a" {
+			t.Errorf("other fields should still be decoded, got %+v", got)
+		}
+	}
+}
+
+func TestStoredTime_JSON(t *testing.T) {
+	for _, want := range storedTimeCases {
+		data, err := json.Marshal(timedEntry{Name: "a", Created: want})
+		if err != nil {
+			t.Fatalf("json.Marshal failed: %v", err)
+		}
+		if exp := `{"name":"a","created":"` + FormatTime(want.Time) + `"}`; string(data) != exp {
+			t.Errorf("got %s, want %s", data, exp)
+		}
+
+		var got timedEntry
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("json.Unmarshal failed: %v", err)
+		}
+		if !got.Created.Equal(want.Time) || !got.Updated.IsZero() {
+			t.Errorf("got %+v, want created %v", got, want)
+		}
+	}
+
+	data, _ := json.Marshal(timedEntry{Name: "a"})
+	if string(data) != `{"name":"a","created":null}` {
+		t.Errorf("zero times: got %s", data)
+	}
+	for _, in := range []string{`{"created":null}`, `{"created":""}`} {
+		got := timedEntry{Created: storedTimeCases[0]}
+		if err := json.Unmarshal([]byte(in), &got); err != nil || !got.Created.IsZero() {
+			t.Errorf("json.Unmarshal(%s) = %+v, %v; want the zero time", in, got, err)
+		}
+	}
+	for _, in := range []string{`{"created":"yesterday"}`, `{"created":1770285845}`} {
+		var got timedEntry
+		if err := json.Unmarshal([]byte(in), &got); err == nil {
+			t.Errorf("json.Unmarshal(%s) should fail", in)
+		}
+	}
+}
+
+func TestStoredTime_Frontmatter(t *testing.T) {
+	want := storedTimeCases[0]
+	out, err := RenderFrontmatter(timedEntry{Name: "post", Created: want}, "# Post")
+	if err != nil {
+		t.Fatalf("RenderFrontmatter failed: %v", err)
+	}
+
+	var got timedEntry
+	body, err := DecodeFrontmatter("post.md", out, &got)
+	if err != nil {
+		t.Fatalf("DecodeFrontmatter failed: %v", err)
+	}
+	if !got.Created.Equal(want.Time) || got.Created.Nanosecond() != 123456789 || !got.Updated.IsZero() {
+		t.Errorf("got %+v, want created %v", got, want)
+	}
+	if body != "# Post" {
+		t.Errorf("body = %q", body)
+	}
+}
@@ -0,0 +1,84 @@
+// ABOUTME: Validation hook: values implementing Validator are checked after reads and before writes.
+// ABOUTME: Provides Validator, ValidationError, and SetValidation for switching the hook off.
+package mdstore
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// Validator is implemented by types that can check their own invariants: required
+// fields present, enums in range, dates parseable. When a value passed to mdstore
+// implements it, Validate is called on the decoded value after ReadYAML and friends,
+// and on the value to be written before WriteYAML, UpdateYAML, AppendYAML and friends
+// touch the file. Its error comes back wrapped in a *ValidationError.
+//
+// A value type whose Validate has a pointer receiver is validated too; mdstore takes
+// its address on a copy.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError reports a value that failed its Validate method, or a document that
+// failed its Schema (see MarkdownOptions), with Err the SchemaErrors.
+type ValidationError struct {
+	Path string // file read or to be written; empty if there was none
+	Err  error  // what Validate returned
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("mdstore: validation failed: %v", e.Err)
+	}
+	return fmt.Sprintf("mdstore: %s: validation failed: %v", e.Path, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+var validationOff atomic.Bool
+
+// SetValidation turns the Validator hook on or off for the whole process. It is on
+// by default; migration tooling that must read and rewrite files that don't satisfy
+// the current rules can switch it off.
+func SetValidation(enabled bool) {
+	validationOff.Store(!enabled)
+}
+
+// validate calls v's Validate method, if it has one and validation is on, and wraps
+// a failure in a *ValidationError for path.
+func validate(path string, v interface{}) error {
+	if validationOff.Load() {
+		return nil
+	}
+	val, ok := asValidator(v)
+	if !ok {
+		return nil
+	}
+	if err := val.Validate(); err != nil {
+		return &ValidationError{Path: path, Err: err}
+	}
+	return nil
+}
+
+// asValidator returns v as a Validator, taking the address of a copy when only *T
+// implements it. A nil pointer has nothing to validate.
+func asValidator(v interface{}) (Validator, bool) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || (rv.Kind() == reflect.Pointer && rv.IsNil()) {
+		return nil, false
+	}
+	if val, ok := v.(Validator); ok {
+		return val, true
+	}
+	if rv.Kind() == reflect.Pointer || !reflect.PointerTo(rv.Type()).Implements(validatorType) {
+		return nil, false
+	}
+	p := reflect.New(rv.Type())
+	p.Elem().Set(rv)
+	return p.Interface().(Validator), true
+}
+
+var validatorType = reflect.TypeFor[Validator]()
@@ -0,0 +1,214 @@
+// ABOUTME: Tests for the Validator hook on reads, writes, updates, and appends.
+// ABOUTME: Checks failing validation never touches the file and SetValidation(false) bypasses it.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var errBadLevel = errors.New("level must be low or high")
+
+// checkedConfig validates with a value receiver.
+type checkedConfig struct {
+	Name  string `yaml:"name"`
+	Level string `yaml:"level"`
+}
+
+func (c checkedConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	if c.Level != "low" && c.Level != "high" {
+		return errBadLevel
+	}
+	return nil
+}
+
+// checkedPtr validates with a pointer receiver.
+type checkedPtr struct {
+	Name string `yaml:"name"`
+}
+
+func (c *checkedPtr) Validate() error {
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+// asValidationError fails the test unless err is a *ValidationError for path.
+func asValidationError(t *testing.T, err error, path string) *ValidationError {
+	t.Helper()
+	var valErr *ValidationError
+	if !errors.As(err, &valErr) {
+		t.Fatalf("expected *ValidationError, got %T: %v", err, err)
+	}
+	if valErr.Path != path {
+		t.Errorf("ValidationError.Path = %q, want %q", valErr.Path, path)
+	}
+	return valErr
+}
+
+func TestValidate_ReadYAML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFileString(t, path, "name: app\nlevel: extreme\n")
+
+	var cfg checkedConfig
+	err := ReadYAML(path, &cfg)
+	asValidationError(t, err, path)
+	if !errors.Is(err, errBadLevel) || !strings.Contains(err.Error(), path) {
+		t.Errorf("error should wrap Validate's error and name the file: %v", err)
+	}
+	if err := ReadYAMLStrictFields(path, &cfg); !errors.Is(err, errBadLevel) {
+		t.Errorf("ReadYAMLStrictFields: expected errBadLevel, got %v", err)
+	}
+
+	// Nothing was decoded from a missing or empty file, so there's nothing to validate.
+	empty := filepath.Join(dir, "empty.yaml")
+	writeFileString(t, empty, "")
+	for _, p := range []string{filepath.Join(dir, "missing.yaml"), empty} {
+		var cfg checkedConfig
+		if err := ReadYAML(p, &cfg); err != nil {
+			t.Errorf("ReadYAML(%s) should not validate, got %v", filepath.Base(p), err)
+		}
+	}
+
+	writeFileString(t, path, "name: app\nlevel: low\n")
+	if err := ReadYAML(path, &cfg); err != nil {
+		t.Errorf("valid file failed: %v", err)
+	}
+}
+
+func TestValidate_WriteYAML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	err := WriteYAML(path, checkedConfig{Name: "app", Level: "extreme"})
+	asValidationError(t, err, path)
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Error("invalid value should not be written")
+	}
+
+	// A pointer-receiver Validate is found when the value is passed by value.
+	if err := WriteYAML(path, checkedPtr{}); err == nil {
+		t.Error("checkedPtr by value should be validated")
+	}
+	if err := WriteYAML(path, &checkedPtr{}); err == nil {
+		t.Error("*checkedPtr should be validated")
+	}
+	if err := WriteYAML(path, (*checkedPtr)(nil)); err != nil {
+		t.Errorf("nil pointer has nothing to validate, got %v", err)
+	}
+
+	if err := WriteYAML(path, checkedConfig{Name: "app", Level: "high"}); err != nil {
+		t.Errorf("valid value failed: %v", err)
+	}
+}
+
+func TestValidate_UpdateYAMLPreventsWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := WriteYAML(path, checkedConfig{Name: "app", Level: "low"}); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+	orig := readFileString(t, path)
+
+	err := UpdateYAML(filepath.Dir(path), path, func(c *checkedConfig) error {
+		c.Level = "extreme"
+		return nil
+	})
+	if !errors.Is(err, errBadLevel) {
+		t.Fatalf("expected errBadLevel, got %v", err)
+	}
+	if got := readFileString(t, path); got != orig {
+		t.Errorf("failed validation still wrote the file:\n%s", got)
+	}
+}
+
+func TestValidate_UpdateYAMLCanRepair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFileString(t, path, "name: app\nlevel: extreme\n")
+
+	err := UpdateYAML(filepath.Dir(path), path, func(c *checkedConfig) error {
+		c.Level = "high"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateYAML should read an invalid file it then repairs, got %v", err)
+	}
+	var cfg checkedConfig
+	if err := ReadYAML(path, &cfg); err != nil || cfg.Level != "high" {
+		t.Errorf("got %+v, %v", cfg, err)
+	}
+}
+
+func TestValidate_AppendEachItem(t *testing.T) {
+	dir := t.TempDir()
+	good := checkedConfig{Name: "a", Level: "low"}
+	bad := checkedConfig{Name: "b", Level: "extreme"}
+
+	for name, appendFn := range map[string]func(path string) error{
+		"AppendYAML":       func(path string) error { return AppendYAML(path, bad) },
+		"AppendYAMLLocked": func(path string) error { return AppendYAMLLocked(dir, path, bad) },
+		"AppendYAMLAll":    func(path string) error { return AppendYAMLAll(path, []checkedConfig{good, bad}) },
+		"AppendYAMLItems":  func(path string) error { return AppendYAMLItems(path, good, bad) },
+		"AppendYAMLDoc":    func(path string) error { return AppendYAMLDoc(path, bad) },
+	} {
+		path := filepath.Join(dir, name+".yaml")
+		if err := AppendYAML(path, good); err != nil {
+			t.Fatalf("%s: seeding failed: %v", name, err)
+		}
+		orig := readFileString(t, path)
+
+		asValidationError(t, appendFn(path), path)
+		if got := readFileString(t, path); got != orig {
+			t.Errorf("%s: invalid item changed the file:\n%s", name, got)
+		}
+	}
+}
+
+func TestValidate_StreamsAndFrontmatter(t *testing.T) {
+	dir := t.TempDir()
+	list := filepath.Join(dir, "list.yaml")
+	writeFileString(t, list, "- name: a\n  level: low\n- name: b\n  level: extreme\n")
+
+	var seen int
+	err := DecodeYAMLSeq(list, func(checkedConfig) error { seen++; return nil })
+	if asValidationError(t, err, list); seen != 1 {
+		t.Errorf("DecodeYAMLSeq: fn saw %d items before the invalid one, want 1", seen)
+	}
+
+	docs := filepath.Join(dir, "docs.yaml")
+	writeFileString(t, docs, "---\nname: a\nlevel: extreme\n")
+	_, err = ReadYAMLDocs[checkedConfig](docs)
+	asValidationError(t, err, docs)
+
+	var meta checkedConfig
+	_, err = DecodeFrontmatter("post.md", "---\nname: a\n---\nBody\n", &meta)
+	asValidationError(t, err, "post.md")
+
+	_, err = RenderFrontmatter(checkedConfig{Name: "a"}, "Body")
+	asValidationError(t, err, "")
+}
+
+func TestSetValidation_Off(t *testing.T) {
+	SetValidation(false)
+	t.Cleanup(func() { SetValidation(true) })
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	bad := checkedConfig{Name: "legacy", Level: "extreme"}
+	if err := WriteYAML(path, bad); err != nil {
+		t.Fatalf("WriteYAML with validation off failed: %v", err)
+	}
+	var cfg checkedConfig
+	if err := ReadYAML(path, &cfg); err != nil || cfg != bad {
+		t.Errorf("ReadYAML with validation off: got %+v, %v", cfg, err)
+	}
+	if err := AppendYAML(filepath.Join(t.TempDir(), "list.yaml"), bad); err != nil {
+		t.Errorf("AppendYAML with validation off failed: %v", err)
+	}
+}
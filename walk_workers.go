@@ -0,0 +1,64 @@
+// ABOUTME: A bounded worker pool over the files of a store walk, for reading many files at once.
+// ABOUTME: Provides walkGlobWorkers, which BuildIndex and Search feed from the walker through a channel.
+package mdstore
+
+import (
+	"io/fs"
+	"runtime"
+	"sync"
+)
+
+// walkWorkers returns the number of workers a walk runs with when asked for n: n if
+// it's positive, or else runtime.GOMAXPROCS.
+func walkWorkers(n int) int {
+	if n > 0 {
+		return n
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// walkGlobWorkers is walkGlob with fn called on up to workers goroutines at once (see
+// walkWorkers), handed the files through a channel as the walk finds them, each with
+// its index in the order of the walk, which is that of their paths. Once stop, if not
+// nil, reports true, no more files are handed out, and the calls under way finish.
+// With one worker, fn is called within the walk, as walkGlob calls it. fn must be
+// safe to call concurrently; results are put in order by their indexes.
+func walkGlobWorkers(root, glob string, workers int, stop func() bool, fn func(i int, path string, d fs.DirEntry)) error {
+	workers = walkWorkers(workers)
+	if workers == 1 {
+		i := 0
+		return walkGlob(root, glob, func(path string, d fs.DirEntry) {
+			if stop == nil || !stop() {
+				fn(i, path, d)
+				i++
+			}
+		})
+	}
+
+	type job struct {
+		i    int
+		path string
+		d    fs.DirEntry
+	}
+	jobs := make(chan job, workers)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				fn(j.i, j.path, j.d)
+			}
+		}()
+	}
+	i := 0
+	err := walkGlob(root, glob, func(path string, d fs.DirEntry) {
+		if stop == nil || !stop() {
+			jobs <- job{i, path, d}
+			i++
+		}
+	})
+	close(jobs)
+	wg.Wait()
+	return err
+}
@@ -1,19 +1,155 @@
-// ABOUTME: YAML file helpers for reading, writing, and appending YAML documents.
-// ABOUTME: Uses AtomicWrite for safe writes and gopkg.in/yaml.v3 for marshaling.
+// ABOUTME: YAML file helpers for reading (lenient, existence-reporting, or strict), writing, and appending.
+// ABOUTME: Uses AtomicWrite for safe writes, WithLock for UpdateYAML/AppendYAMLLocked, and yaml.v3 for marshaling.
 package mdstore
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"io/fs"
-	"os"
+	"path/filepath"
+	"reflect"
 
 	"gopkg.in/yaml.v3"
 )
 
+// NotFoundError reports that a YAML file read with ReadYAMLStrict does not exist.
+// It matches fs.ErrNotExist via errors.Is.
+type NotFoundError struct {
+	Path string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("mdstore: %s does not exist", e.Path)
+}
+
+// Is reports whether target is fs.ErrNotExist.
+func (e *NotFoundError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
 // ReadYAML reads a YAML file and unmarshals into dest.
-// Returns nil (not error) if the file doesn't exist.
+// Returns nil (not error) if the file doesn't exist; use ReadYAMLExists or
+// ReadYAMLStrict to tell a missing file from an empty one.
 func ReadYAML(path string, dest interface{}) error {
-	data, err := os.ReadFile(path)
+	_, err := ReadYAMLExists(path, dest)
+	return err
+}
+
+// ReadYAMLExists reads a YAML file and unmarshals into dest, reporting whether the
+// file exists. A missing file leaves dest untouched and returns false, nil; an empty
+// file (whitespace only, or a bare null) also leaves dest untouched and returns true, nil.
+// Malformed YAML returns a *YAMLError, and a file over the size limit (see
+// SetMaxYAMLSize) a *FileTooLargeError. If dest implements Validator, the decoded
+// value is validated (see SetValidation).
+func ReadYAMLExists(path string, dest interface{}) (found bool, err error) {
+	found, decoded, err := readYAMLFile(path, dest)
+	if err != nil || !decoded {
+		return found, err
+	}
+	return true, validate(path, dest)
+}
+
+// readYAMLFile is ReadYAMLExists without validation; decoded reports whether dest
+// was written to.
+func readYAMLFile(path string, dest interface{}) (found, decoded bool, err error) {
+	return readYAMLFileMax(path, dest, currentMaxYAMLSize())
+}
+
+// readYAMLFileMax is readYAMLFile with an explicit size limit (see readFileMax).
+func readYAMLFileMax(path string, dest interface{}, limit int64) (found, decoded bool, err error) {
+	data, err := readFileMax(path, limit)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	decoded, err = decodeYAMLData(path, data, dest)
+	return true, decoded, err
+}
+
+// decodeYAMLData unmarshals data, read from path, into dest like ReadYAML, without
+// validation; decoded reports whether dest was written to.
+func decodeYAMLData(path string, data []byte, dest interface{}) (decoded bool, err error) {
+	if isEncryptedYAML(data) {
+		return false, &EncryptionError{Path: path, Err: ErrEncrypted}
+	}
+	if isEmptyYAML(data) {
+		return false, nil
+	}
+	if err := checkYAMLAliases(path, data, 1); err != nil {
+		return false, err
+	}
+	if err := yaml.Unmarshal(data, dest); err != nil {
+		return true, newYAMLError(path, err, 1)
+	}
+	return true, nil
+}
+
+// isEmptyYAML reports whether data holds no value: nothing but whitespace, or a bare
+// null such as older versions of WriteYAML wrote for nil. Decoding a bare null would
+// reset dest to its zero value, unlike a missing file.
+func isEmptyYAML(data []byte) bool {
+	switch string(bytes.TrimSpace(data)) {
+	case "", "null", "~":
+		return true
+	}
+	return false
+}
+
+// ReadYAMLStrict is ReadYAML for files that must exist: a missing file returns a
+// *NotFoundError, which matches fs.ErrNotExist.
+func ReadYAMLStrict(path string, dest interface{}) error {
+	found, err := ReadYAMLExists(path, dest)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return &NotFoundError{Path: path}
+	}
+	return nil
+}
+
+// ReadYAMLOrDefault reads the YAML file at path over a copy of def, so keys the file
+// doesn't set keep their default values, and returns def itself if the file is missing
+// or empty. Maps, slices, and pointers in def are shared with the result, so decoding
+// may write into them; build def fresh for each call.
+func ReadYAMLOrDefault[T any](path string, def T) (T, error) {
+	v := def
+	if err := ReadYAML(path, &v); err != nil {
+		return def, err
+	}
+	return v, nil
+}
+
+// EnsureYAML is ReadYAMLOrDefault that also writes def to path, atomically, if the file
+// doesn't exist, so users find the defaults there to edit. It runs under WithLock on
+// path's directory, so concurrent callers create the file exactly once; created reports
+// whether this call did.
+func EnsureYAML[T any](path string, def T) (v T, created bool, err error) {
+	err = WithLock(filepath.Dir(path), func() error {
+		v = def
+		found, err := ReadYAMLExists(path, &v)
+		if err != nil || found {
+			return err
+		}
+		created = true
+		return WriteYAML(path, def)
+	})
+	if err != nil {
+		return def, false, err
+	}
+	return v, created, nil
+}
+
+// ReadYAMLStrictFields is ReadYAML rejecting keys that dest has no field for, so a
+// typo'd key in a hand-edited file ("tite:" for "title:") fails loudly instead of being
+// dropped on the next write. The error is a *YAMLError naming the file, line, and key.
+// Like ReadYAML, a missing or empty file leaves dest untouched and returns nil.
+func ReadYAMLStrictFields(path string, dest interface{}) error {
+	data, err := readFileMax(path, currentMaxYAMLSize())
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return nil
@@ -21,22 +157,253 @@ func ReadYAML(path string, dest interface{}) error {
 		return err
 	}
 
-	return yaml.Unmarshal(data, dest)
+	if isEncryptedYAML(data) {
+		return &EncryptionError{Path: path, Err: ErrEncrypted}
+	}
+	if isEmptyYAML(data) {
+		return nil
+	}
+	if err := checkYAMLAliases(path, data, 1); err != nil {
+		return err
+	}
+	if err := decodeYAMLKnownFields(data, dest); err != nil {
+		return newYAMLError(path, err, 1)
+	}
+	return validate(path, dest)
+}
+
+// decodeYAMLKnownFields unmarshals data into dest, failing on keys dest has no field
+// for. Empty input (see isEmptyYAML) leaves dest untouched.
+func decodeYAMLKnownFields(data []byte, dest interface{}) error {
+	if isEmptyYAML(data) {
+		return nil
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(dest); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// YAMLOptions controls how WriteYAMLOpts and RenderFrontmatterOpts encode YAML.
+// The zero value matches yaml.Marshal, which WriteYAML and RenderFrontmatter use.
+type YAMLOptions struct {
+	// Indent is the number of spaces per nesting level. Default 4.
+	Indent int
+
+	// NoWrap keeps long strings on one line. yaml.v3 never wraps them, so this is
+	// always the behavior; set it to make the intent explicit.
+	NoWrap bool
+
+	// Empty selects what WriteYAMLOpts writes for a nil or empty slice or map.
+	// Default EmptyCanonical.
+	Empty EmptyStyle
+
+	// Header, if set, is written by WriteYAMLOpts as "# " comment lines before the
+	// document, e.g. DefaultYAMLHeader. "{path}" and "{time}" in it are replaced with
+	// the file's path and the time of the write. Readers skip it like any comment, and
+	// UpdateYAMLNode keeps it. An empty file is written without one.
+	Header string
+
+	// NoAnchors writes every alias out in full, as a copy of the value its anchor
+	// names, and drops the anchors, for consumers whose YAML parsers mishandle them.
+	// yaml.v3 writes Go values without anchors even when pointers are shared, so this
+	// matters for yaml.Node trees, such as documents read with anchors and passed back
+	// to WriteYAMLOpts. The copies are subject to the alias limit (see
+	// SetMaxYAMLAliasNodes).
+	NoAnchors bool
+
+	// CRLF ends lines with \r\n rather than \n, for toolchains that expect Windows
+	// line endings. RenderFrontmatterOpts converts the body's line endings as well.
+	// Readers accept either.
+	CRLF bool
+
+	// Fence, if set, is the line RenderFrontmatterOpts writes before and after the
+	// frontmatter in place of "---": a longer run of dashes, such as "----", which
+	// ParseFrontmatter reads back, or a custom marker for ParseFrontmatterDelim.
+	// WriteYAMLOpts ignores it.
+	Fence string
+
+	// QuoteAmbiguousStrings double-quotes string values that a YAML 1.1 or 1.2 parser
+	// would read back as another type, such as "yes", "no", "null", "~", "007", "3.0",
+	// or "2024-01-15", and those that some parsers mishandle unquoted, such as
+	// "- item", "? x", or "a: b", so they stay strings for any reader. Other strings
+	// are written as yaml.v3 chooses. It applies to values, not keys, of Go values and
+	// yaml.Node trees alike; a tree passed in isn't modified.
+	QuoteAmbiguousStrings bool
+
+	// StoredTimes writes the time.Time values of Go values as StoredTime writes itself:
+	// with FormatTime, as yaml.v3 does, but with the zero time as null rather than
+	// 0001-01-01T00:00:00Z, except in lists, where yaml.v3 would drop a null. It pairs
+	// with FrontmatterOptions.StoredTimes for reading.
+	StoredTimes bool
 }
 
+// EmptyStyle is how WriteYAMLOpts writes an empty value (see YAMLOptions.Empty).
+// Whatever the style, nil itself and nil pointers write an empty file, never "null",
+// and ReadYAML treats an empty file exactly like a missing one.
+type EmptyStyle int
+
+const (
+	// EmptyCanonical writes "[]" for an empty slice and "{}" for an empty map.
+	EmptyCanonical EmptyStyle = iota
+
+	// EmptyFile writes a zero-byte file for an empty slice or map.
+	EmptyFile
+)
+
 // WriteYAML marshals src to YAML and writes atomically.
 func WriteYAML(path string, src interface{}) error {
-	data, err := yaml.Marshal(src)
+	return WriteYAMLOpts(path, src, YAMLOptions{})
+}
+
+// WriteYAMLOpts is WriteYAML with explicit encoding options, e.g. YAMLOptions{Indent: 2}
+// for files that must match a 2-space house style. If src implements Validator, it must
+// pass before the file is written (see SetValidation).
+func WriteYAMLOpts(path string, src interface{}, opts YAMLOptions) error {
+	if err := validate(path, src); err != nil {
+		return err
+	}
+
+	kind := emptyYAMLKind(src)
+	if kind == emptyNil || (kind == emptyCollection && opts.Empty == EmptyFile) {
+		if err := AtomicWrite(path, nil); err != nil {
+			return err
+		}
+		notifyGitWrite(path)
+		return nil
+	}
+
+	data, err := marshalYAML(src, opts)
 	if err != nil {
 		return err
 	}
+	if opts.Header != "" {
+		data = append(yamlHeader(opts.Header, path), data...)
+	}
+	if opts.CRLF {
+		data = []byte(toCRLF(string(data)))
+	}
+
+	if err := AtomicWrite(path, data); err != nil {
+		return err
+	}
+	notifyGitWrite(path)
+	return nil
+}
+
+const (
+	notEmpty = iota
+	emptyNil
+	emptyCollection
+)
+
+// emptyYAMLKind classifies src as nil (including nil pointers and interfaces), an
+// empty slice, array, or map, or anything else.
+func emptyYAMLKind(src interface{}) int {
+	v := reflect.ValueOf(src)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return emptyNil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		return emptyNil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if v.Len() == 0 {
+			return emptyCollection
+		}
+	}
+	return notEmpty
+}
+
+// marshalYAML encodes src as a single YAML document according to opts.
+func marshalYAML(src interface{}, opts YAMLOptions) ([]byte, error) {
+	indent := opts.Indent
+	if indent <= 0 {
+		indent = 4
+	}
 
-	return AtomicWrite(path, data)
+	if _, isNode := src.(*yaml.Node); opts.StoredTimes && !isNode {
+		node := new(yaml.Node)
+		if err := node.Encode(src); err != nil {
+			return nil, err
+		}
+		nullZeroTimes(node)
+		src = node
+	}
+
+	if opts.QuoteAmbiguousStrings {
+		node, ok := src.(*yaml.Node)
+		if !ok {
+			node = new(yaml.Node)
+			if err := node.Encode(src); err != nil {
+				return nil, err
+			}
+		}
+		src = quoteAmbiguousStrings(node)
+	}
+
+	if opts.NoAnchors {
+		node, ok := src.(*yaml.Node)
+		if !ok {
+			node = new(yaml.Node)
+			if err := node.Encode(src); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkYAMLNodeAliases("", node, 1); err != nil {
+			return nil, err
+		}
+		src = expandYAMLAliases(node)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	if err := enc.Encode(src); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UpdateYAML runs a read-modify-write of the YAML file at path under WithLock on dir:
+// it reads the file into a T (the zero value if the file doesn't exist), calls fn to
+// modify it, and writes the result back atomically. If fn returns an error, or the
+// result fails validation (see Validator), the file is left unchanged. The value read
+// isn't validated, so fn can repair a file that no longer passes. dir is normally the
+// directory containing path.
+func UpdateYAML[T any](dir, path string, fn func(*T) error) error {
+	return WithLock(dir, func() error {
+		var v T
+		if _, _, err := readYAMLFile(path, &v); err != nil {
+			return err
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+		return WriteYAML(path, v)
+	})
 }
 
 // AppendYAML reads a YAML file as a slice of T, appends item, and writes back atomically.
-// If the file doesn't exist, creates it with just [item].
+// If the file doesn't exist, creates it with just [item]. If T implements Validator,
+// item must pass before the file is touched.
+//
+// AppendYAML is not safe for concurrent use: two appenders (goroutines or processes)
+// can both read N items and both write N+1, losing one. Use AppendYAMLLocked, or call
+// it under WithLock, when more than one writer may append to the file.
 func AppendYAML[T any](path string, item T) error {
+	if err := validate(path, item); err != nil {
+		return err
+	}
+
 	var existing []T
 
 	if err := ReadYAML(path, &existing); err != nil {
@@ -47,3 +414,40 @@ func AppendYAML[T any](path string, item T) error {
 
 	return WriteYAML(path, existing)
 }
+
+// AppendYAMLLocked is AppendYAML under WithLock on dir (see UpdateYAML), so
+// concurrent appenders never lose items.
+func AppendYAMLLocked[T any](dir, path string, item T) error {
+	if err := validate(path, item); err != nil {
+		return err
+	}
+	return UpdateYAML(dir, path, func(items *[]T) error {
+		*items = append(*items, item)
+		return nil
+	})
+}
+
+// AppendYAMLAll appends items to the YAML list file at path with a single read and
+// write, under WithLock on path's directory like AppendYAMLLocked. Use it instead of
+// looping over AppendYAML, which rewrites the whole file once per item. Appending no
+// items is a no-op that doesn't touch the file. If T implements Validator, every item
+// must pass before the file is touched.
+func AppendYAMLAll[T any](path string, items []T) error {
+	if len(items) == 0 {
+		return nil
+	}
+	for _, item := range items {
+		if err := validate(path, item); err != nil {
+			return err
+		}
+	}
+	return UpdateYAML(filepath.Dir(path), path, func(existing *[]T) error {
+		*existing = append(*existing, items...)
+		return nil
+	})
+}
+
+// AppendYAMLItems is AppendYAMLAll taking the items as arguments.
+func AppendYAMLItems[T any](path string, items ...T) error {
+	return AppendYAMLAll(path, items)
+}
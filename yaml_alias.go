@@ -0,0 +1,145 @@
+// ABOUTME: Guard against YAML alias bombs ("billion laughs"), and anchor-free output for other parsers.
+// ABOUTME: Provides SetMaxYAMLAliasNodes, ErrAliasLimit, AliasLimitError, and the alias expansion behind YAMLOptions.NoAnchors.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultMaxYAMLAliasNodes is the most nodes the aliases in one YAML document may
+// expand to unless SetMaxYAMLAliasNodes says otherwise: about a million, far beyond
+// any honest use of anchors and far below what a crafted file can reach.
+const DefaultMaxYAMLAliasNodes = 1 << 20
+
+var maxYAMLAliasNodes atomic.Int64 // 0 means DefaultMaxYAMLAliasNodes
+
+// SetMaxYAMLAliasNodes sets how many nodes the aliases in a YAML document may expand
+// to, in total, before reading it fails with an *AliasLimitError. Each alias counts
+// the nodes of the value it refers to, including what the aliases within that value
+// expand to, so a few hundred bytes of nested aliases can't become gigabytes of
+// decoded data. The limit applies wherever this package decodes YAML: ReadYAML and the
+// functions built on it, DecodeFrontmatter, the stream readers, ReadYAMLKeys,
+// GetYAMLValue, and YAMLToJSON. Zero or negative restores DefaultMaxYAMLAliasNodes.
+func SetMaxYAMLAliasNodes(n int64) {
+	maxYAMLAliasNodes.Store(max(n, 0))
+}
+
+// currentMaxYAMLAliasNodes returns the limit set with SetMaxYAMLAliasNodes.
+func currentMaxYAMLAliasNodes() int64 {
+	if n := maxYAMLAliasNodes.Load(); n > 0 {
+		return n
+	}
+	return DefaultMaxYAMLAliasNodes
+}
+
+// ErrAliasLimit matches (via errors.Is) any AliasLimitError.
+var ErrAliasLimit = errors.New("mdstore: YAML aliases expand past the limit")
+
+// AliasLimitError reports a YAML document whose aliases expand to more nodes than the
+// limit (see SetMaxYAMLAliasNodes). The document isn't decoded.
+type AliasLimitError struct {
+	Path  string
+	Line  int // the line of the document, or of the frontmatter, in the file
+	Limit int64
+}
+
+func (e *AliasLimitError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("mdstore: YAML aliases expand to more than %d nodes", e.Limit)
+	}
+	return fmt.Sprintf("mdstore: %s:%d: YAML aliases expand to more than %d nodes", e.Path, e.Line, e.Limit)
+}
+
+// Is reports whether target is ErrAliasLimit.
+func (e *AliasLimitError) Is(target error) bool {
+	return target == ErrAliasLimit
+}
+
+// checkYAMLAliases applies the alias limit to data, read from path starting at
+// firstLine, before it's decoded. Data without both an anchor and an alias
+// indicator can't hold an alias and isn't parsed; data that fails to parse is left
+// for the decoder to report.
+func checkYAMLAliases(path string, data []byte, firstLine int) error {
+	if bytes.IndexByte(data, '&') < 0 || bytes.IndexByte(data, '*') < 0 {
+		return nil
+	}
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil {
+		return nil
+	}
+	return checkYAMLNodeAliases(path, &doc, firstLine)
+}
+
+// checkYAMLNodeAliases applies the alias limit to a parsed node tree. Node lines
+// count from firstLine.
+func checkYAMLNodeAliases(path string, node *yaml.Node, firstLine int) error {
+	limit := currentMaxYAMLAliasNodes()
+	if yamlAliasExpansion(node, limit) > limit {
+		return &AliasLimitError{Path: path, Line: firstLine + max(node.Line, 1) - 1, Limit: limit}
+	}
+	return nil
+}
+
+// yamlAliasExpansion returns the number of nodes the aliases in the tree at node
+// expand to, or a number over limit once it's known to exceed it. Each anchored
+// value's size is computed once, so the cost is linear in the size of the tree.
+func yamlAliasExpansion(node *yaml.Node, limit int64) int64 {
+	sizes := make(map[*yaml.Node]int64)
+	var expansion int64
+	var size func(n *yaml.Node) int64
+	size = func(n *yaml.Node) int64 {
+		if n.Kind == yaml.AliasNode && n.Alias != nil {
+			s, ok := sizes[n.Alias]
+			if !ok {
+				sizes[n.Alias] = limit + 1 // an alias within its own anchor
+				s = size(n.Alias)
+				sizes[n.Alias] = s
+			}
+			return s
+		}
+		total := int64(1)
+		for _, child := range n.Content {
+			total = min(total+size(child), limit+1)
+		}
+		return total
+	}
+
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		if expansion > limit {
+			return
+		}
+		if n.Kind == yaml.AliasNode && n.Alias != nil {
+			expansion = min(expansion+size(n), limit+1)
+			return
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+	return expansion
+}
+
+// expandYAMLAliases returns a copy of the tree at node with every alias replaced by a
+// copy of the value it refers to, and anchors dropped. The caller checks the alias
+// limit first.
+func expandYAMLAliases(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		expanded := expandYAMLAliases(node.Alias)
+		expanded.HeadComment, expanded.LineComment, expanded.FootComment = node.HeadComment, node.LineComment, node.FootComment
+		return expanded
+	}
+	out := *node
+	out.Anchor = ""
+	out.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		out.Content[i] = expandYAMLAliases(child)
+	}
+	return &out
+}
@@ -0,0 +1,159 @@
+// ABOUTME: Tests for the alias limit and YAMLOptions.NoAnchors, using the testdata/alias-bomb.yaml fixture.
+// ABOUTME: Every decoding entry point must refuse the bomb quickly; honest anchors still work.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func asAliasLimit(t *testing.T, err error) *AliasLimitError {
+	t.Helper()
+	var limitErr *AliasLimitError
+	if !errors.As(err, &limitErr) || !errors.Is(err, ErrAliasLimit) {
+		t.Fatalf("expected *AliasLimitError, got %T: %v", err, err)
+	}
+	return limitErr
+}
+
+func TestAliasLimit_Bomb(t *testing.T) {
+	path, bomb := copyFixture(t, "alias-bomb.yaml")
+	docsPath := filepath.Join(t.TempDir(), "docs.yaml")
+	writeFileString(t, docsPath, "---\nok: 1\n---\n"+bomb)
+
+	start := time.Now()
+	for name, read := range map[string]func() error{
+		"ReadYAML": func() error {
+			var v map[string]interface{}
+			return ReadYAML(path, &v)
+		},
+		"ReadYAMLStrictFields": func() error {
+			var v map[string]interface{}
+			return ReadYAMLStrictFields(path, &v)
+		},
+		"ReadYAMLKeys": func() error {
+			var v interface{}
+			_, err := ReadYAMLKeys(path, map[string]interface{}{"i": &v})
+			return err
+		},
+		"GetYAMLValue": func() error {
+			_, _, err := GetYAMLValue(path, "i")
+			return err
+		},
+		"DecodeYAMLDocs": func() error {
+			return DecodeYAMLDocs(docsPath, func(map[string]interface{}) error { return nil })
+		},
+		"TailYAMLDocs": func() error {
+			_, err := TailYAMLDocs[map[string]interface{}](docsPath, 1)
+			return err
+		},
+		"DecodeYAMLSeq": func() error {
+			return DecodeYAMLSeq(path, func(map[string]interface{}) error { return nil })
+		},
+		"ConvertYAMLFileToJSON": func() error {
+			return ConvertYAMLFileToJSON(path, filepath.Join(t.TempDir(), "out.json"))
+		},
+	} {
+		err := read()
+		if e := asAliasLimit(t, err); e.Limit != DefaultMaxYAMLAliasNodes {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if _, err := YAMLToJSON([]byte(bomb)); err == nil || err.Error() != "mdstore: YAML aliases expand to more than 1048576 nodes" {
+		t.Errorf("YAMLToJSON: %v", err)
+	}
+
+	var meta map[string]interface{}
+	_, err := DecodeFrontmatter("post.md", "---\n"+bomb+"---\nBody\n", &meta)
+	if e := asAliasLimit(t, err); e.Path != "post.md" || e.Line != 3 || meta != nil {
+		t.Errorf("DecodeFrontmatter: %+v, meta %v", e, meta)
+	}
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("refusing the bomb took %v", elapsed)
+	}
+}
+
+func TestAliasLimit_Configurable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anchors.yaml")
+	writeFileString(t, path, "base: &base {host: example.com, port: 80}\nprod: *base\nstaging:\n  <<: *base\n  port: 8080\n")
+
+	var cfg map[string]map[string]interface{}
+	if err := ReadYAML(path, &cfg); err != nil || cfg["prod"]["host"] != "example.com" || cfg["staging"]["port"] != 8080 {
+		t.Fatalf("honest anchors: %v, %v", cfg, err)
+	}
+
+	// Each alias expands to the mapping and its four scalars.
+	SetMaxYAMLAliasNodes(9)
+	t.Cleanup(func() { SetMaxYAMLAliasNodes(0) })
+	if e := asAliasLimit(t, ReadYAML(path, &cfg)); e.Limit != 9 || e.Line != 1 {
+		t.Errorf("unexpected error: %+v", e)
+	}
+	SetMaxYAMLAliasNodes(10)
+	if err := ReadYAML(path, &cfg); err != nil {
+		t.Errorf("at the limit: %v", err)
+	}
+}
+
+func TestYAMLAliasExpansion(t *testing.T) {
+	for src, want := range map[string]int64{
+		"a: 1\n":                       0,
+		"a: &x [1, 2]\nb: *x\nc: *x\n": 6,
+		"a: &x [1]\nb: &y [*x, *x]\nc: [*y, *y]\n": 2*2 + 2*(1+2*2),
+	} {
+		var doc yaml.Node
+		if err := yaml.Unmarshal([]byte(src), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if got := yamlAliasExpansion(&doc, 1000); got != want {
+			t.Errorf("yamlAliasExpansion(%q) = %d, want %d", src, got, want)
+		}
+	}
+}
+
+func TestWriteYAMLOpts_NoAnchors(t *testing.T) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte("base: &base\n    port: 80\nprod: *base\nname: &n Ada\nowner: *n # shared\n"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "anchored.yaml")
+	if err := WriteYAMLOpts(path, &doc, YAMLOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFileString(t, path); !strings.Contains(got, "&base") {
+		t.Fatalf("without NoAnchors the anchor should stay:\n%s", got)
+	}
+
+	path = filepath.Join(dir, "plain.yaml")
+	if err := WriteYAMLOpts(path, &doc, YAMLOptions{NoAnchors: true}); err != nil {
+		t.Fatal(err)
+	}
+	want := "base:\n    port: 80\nprod:\n    port: 80\nname: Ada\nowner: Ada # shared\n"
+	if got := readFileString(t, path); got != want {
+		t.Errorf("NoAnchors wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Go values never get anchors, even with shared pointers.
+	port := map[string]int{"port": 80}
+	data, err := marshalYAML(map[string]*map[string]int{"a": &port, "b": &port}, YAMLOptions{NoAnchors: true})
+	if err != nil || string(data) != "a:\n    port: 80\nb:\n    port: 80\n" {
+		t.Errorf("shared pointers: %q, %v", data, err)
+	}
+
+	bomb, err := os.ReadFile(filepath.Join("testdata", "alias-bomb.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(bomb, &doc); err != nil {
+		t.Fatal(err)
+	}
+	asAliasLimit(t, WriteYAMLOpts(filepath.Join(dir, "bomb.yaml"), &doc, YAMLOptions{NoAnchors: true}))
+}
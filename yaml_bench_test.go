@@ -0,0 +1,256 @@
+// ABOUTME: Benchmarks for YAML files: looped vs batched appends, streaming vs whole-file reads, caching, and tails.
+// ABOUTME: Shows the quadratic cost AppendYAMLAll avoids, the peak heap DecodeYAMLSeq saves, CachedYAML hits, and tail reads.
+package mdstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Numbers of items appended per benchmark iteration. The loop stops at 1k items:
+// being quadratic, 10k takes minutes per iteration where the batch takes ~100ms.
+var (
+	appendLoopBenchSizes  = []int{100, 1000}
+	appendBatchBenchSizes = []int{100, 1000, 10000}
+)
+
+func appendBenchItems(n int) []testItem {
+	items := make([]testItem, n)
+	for i := range items {
+		items[i] = testItem{Name: fmt.Sprintf("event-%d", i), Value: i}
+	}
+	return items
+}
+
+func BenchmarkAppendYAML_Loop(b *testing.B) {
+	for _, n := range appendLoopBenchSizes {
+		b.Run(fmt.Sprintf("items=%d", n), func(b *testing.B) {
+			items := appendBenchItems(n)
+			path := filepath.Join(b.TempDir(), "items.yaml")
+
+			for b.Loop() {
+				os.Remove(path)
+				for _, item := range items {
+					if err := AppendYAML(path, item); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAppendYAMLAll(b *testing.B) {
+	for _, n := range appendBatchBenchSizes {
+		b.Run(fmt.Sprintf("items=%d", n), func(b *testing.B) {
+			items := appendBenchItems(n)
+			path := filepath.Join(b.TempDir(), "items.yaml")
+
+			for b.Loop() {
+				os.Remove(path)
+				if err := AppendYAMLAll(path, items); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Number of items in the generated list file for the read benchmarks (~3 MB).
+const readBenchItems = 50000
+
+// writeReadBenchFixture writes a readBenchItems-long list file and returns its path.
+func writeReadBenchFixture(b *testing.B) string {
+	b.Helper()
+	type event struct {
+		Name  string   `yaml:"name"`
+		Value int      `yaml:"value"`
+		Tags  []string `yaml:"tags"`
+		Note  string   `yaml:"note"`
+	}
+	items := make([]event, readBenchItems)
+	for i := range items {
+		items[i] = event{
+			Name:  fmt.Sprintf("event-%d", i),
+			Value: i,
+			Tags:  []string{"alpha", "beta"},
+			Note:  "a short note that pads each item out to a realistic size",
+		}
+	}
+	path := filepath.Join(b.TempDir(), "items.yaml")
+	if err := WriteYAML(path, items); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+// reportPeakHeap runs fn and reports the highest live heap seen while it ran, above
+// the heap in use beforehand, as the peak-heap-B metric. The heap is sampled every
+// millisecond, so short spikes can be missed; it's meant for orders of magnitude.
+func reportPeakHeap(b *testing.B, fn func()) {
+	b.Helper()
+	var ms runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&ms)
+	base := ms.HeapAlloc
+
+	var (
+		mu   sync.Mutex
+		peak uint64
+		done = make(chan struct{})
+		wg   sync.WaitGroup
+	)
+	sample := func() {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		mu.Lock()
+		peak = max(peak, ms.HeapAlloc)
+		mu.Unlock()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tick := time.NewTicker(time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-tick.C:
+				sample()
+			}
+		}
+	}()
+
+	fn()
+	sample()
+	close(done)
+	wg.Wait()
+
+	if peak > base {
+		b.ReportMetric(float64(peak-base), "peak-heap-B")
+	}
+}
+
+func BenchmarkReadYAML_List(b *testing.B) {
+	path := writeReadBenchFixture(b)
+	b.ReportAllocs()
+
+	reportPeakHeap(b, func() {
+		for b.Loop() {
+			var items []map[string]interface{}
+			if err := ReadYAML(path, &items); err != nil {
+				b.Fatal(err)
+			}
+			if len(items) != readBenchItems {
+				b.Fatalf("read %d items", len(items))
+			}
+		}
+	})
+}
+
+func BenchmarkDecodeYAMLSeq_List(b *testing.B) {
+	path := writeReadBenchFixture(b)
+	b.ReportAllocs()
+
+	reportPeakHeap(b, func() {
+		for b.Loop() {
+			n := 0
+			err := DecodeYAMLSeq(path, func(map[string]interface{}) error {
+				n++
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if n != readBenchItems {
+				b.Fatalf("decoded %d items", n)
+			}
+		}
+	})
+}
+
+// writeIndexBenchFixture writes a 1000-entry mapping, the shape of a typical index.yaml.
+func writeIndexBenchFixture(b *testing.B) string {
+	b.Helper()
+	index := make(map[string]testItem, 1000)
+	for i := 0; i < 1000; i++ {
+		index[fmt.Sprintf("doc-%d", i)] = testItem{Name: fmt.Sprintf("Document %d", i), Value: i}
+	}
+	path := filepath.Join(b.TempDir(), "index.yaml")
+	if err := WriteYAML(path, index); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func BenchmarkReadYAML_Index(b *testing.B) {
+	path := writeIndexBenchFixture(b)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		var index map[string]testItem
+		if err := ReadYAML(path, &index); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCachedYAML_Index(b *testing.B) {
+	path := writeIndexBenchFixture(b)
+	c := NewCachedYAML[map[string]testItem](0)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := c.Read(path); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// writeDocsBenchFixture writes the readBenchItems items of writeReadBenchFixture as a
+// doc stream and returns its path.
+func writeDocsBenchFixture(b *testing.B) string {
+	b.Helper()
+	list := writeReadBenchFixture(b)
+	path := filepath.Join(filepath.Dir(list), "events.yaml")
+	if err := ConvertYAMLListToDocs(list, path); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func BenchmarkReadYAMLDocs_Last20(b *testing.B) {
+	path := writeDocsBenchFixture(b)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		items, err := ReadYAMLDocs[map[string]interface{}](path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if last := items[len(items)-20:]; last[19]["value"] != readBenchItems-1 {
+			b.Fatalf("last item is %v", last[19])
+		}
+	}
+}
+
+func BenchmarkTailYAMLDocs_Last20(b *testing.B) {
+	path := writeDocsBenchFixture(b)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		last, err := TailYAMLDocs[map[string]interface{}](path, 20)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(last) != 20 || last[19]["value"] != readBenchItems-1 {
+			b.Fatalf("last item is %v", last[len(last)-1])
+		}
+	}
+}
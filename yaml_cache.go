@@ -0,0 +1,170 @@
+// ABOUTME: Read cache for hot YAML files: decoded values keyed by path, revalidated by stat on each read.
+// ABOUTME: Provides CachedYAML with LRU eviction, explicit invalidation, and deduplicated reloads.
+package mdstore
+
+import (
+	"container/list"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// defaultYAMLCacheSize is the entry limit NewCachedYAML uses when given none.
+const defaultYAMLCacheSize = 256
+
+// CachedYAML caches decoded YAML files of type T, for files read far more often than
+// they change (an index.yaml read on every request). Each Read stats the file and
+// reuses the cached value while the file is the same one with the same modification
+// time and size; otherwise it reads the file again with ReadYAML. Since AtomicWrite
+// replaces files by renaming a new one into place, writes through this package
+// (WriteYAML, UpdateYAML, ...) are always noticed, even within the filesystem's mtime
+// granularity; external edits are noticed by their mtime or size.
+//
+// Concurrent Reads of a path that needs loading share one load. Values are shared
+// between callers and must be treated as read-only: mutate a copy, and write it with
+// WriteYAML or UpdateYAML.
+type CachedYAML[T any] struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*list.Element // of *yamlCacheEntry[T]
+	lru     *list.List               // most recently used at the front
+	loading map[string]*yamlCacheLoad[T]
+
+	load func(path string, dest *T) error // ReadYAML; replaced in tests
+}
+
+type yamlCacheEntry[T any] struct {
+	path string
+	fi   os.FileInfo
+	val  T
+}
+
+// yamlCacheLoad is a load in progress; done is closed once val and err are set.
+type yamlCacheLoad[T any] struct {
+	fi   os.FileInfo
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// NewCachedYAML returns an empty cache holding at most maxEntries files, evicting the
+// least recently read. maxEntries <= 0 means 256.
+func NewCachedYAML[T any](maxEntries int) *CachedYAML[T] {
+	if maxEntries <= 0 {
+		maxEntries = defaultYAMLCacheSize
+	}
+	return &CachedYAML[T]{
+		max:     maxEntries,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		loading: make(map[string]*yamlCacheLoad[T]),
+		load: func(path string, dest *T) error {
+			return ReadYAML(path, dest)
+		},
+	}
+}
+
+// Read returns the decoded content of the YAML file at path, from the cache if the
+// file hasn't changed since it was cached. Like ReadYAML, a missing file returns the
+// zero T and no error. Errors are not cached.
+func (c *CachedYAML[T]) Read(path string) (T, error) {
+	var zero T
+	fi, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			c.Invalidate(path)
+			return zero, nil
+		}
+		return zero, err
+	}
+	// On Windows, SameFile looks up a file's identity by path the first time it's
+	// needed; do it now, so fi keeps describing this file after it's replaced.
+	os.SameFile(fi, fi)
+
+	for {
+		c.mu.Lock()
+		if el, ok := c.entries[path]; ok {
+			e := el.Value.(*yamlCacheEntry[T])
+			if sameFileVersion(e.fi, fi) {
+				c.lru.MoveToFront(el)
+				c.mu.Unlock()
+				return e.val, nil
+			}
+		}
+
+		if l, ok := c.loading[path]; ok {
+			c.mu.Unlock()
+			<-l.done
+			if l.err != nil {
+				return zero, l.err
+			}
+			if sameFileVersion(l.fi, fi) {
+				return l.val, nil
+			}
+			// The load began before the file changed again; look again.
+			continue
+		}
+
+		l := &yamlCacheLoad[T]{fi: fi, done: make(chan struct{})}
+		c.loading[path] = l
+		c.mu.Unlock()
+
+		l.err = c.load(path, &l.val)
+
+		c.mu.Lock()
+		delete(c.loading, path)
+		if l.err == nil {
+			c.store(path, fi, l.val)
+		}
+		c.mu.Unlock()
+		close(l.done)
+		return l.val, l.err
+	}
+}
+
+// store caches val for path, evicting the least recently read entry if the cache
+// is full. The caller must hold c.mu.
+func (c *CachedYAML[T]) store(path string, fi os.FileInfo, val T) {
+	if el, ok := c.entries[path]; ok {
+		el.Value = &yamlCacheEntry[T]{path: path, fi: fi, val: val}
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[path] = c.lru.PushFront(&yamlCacheEntry[T]{path: path, fi: fi, val: val})
+	for c.lru.Len() > c.max {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*yamlCacheEntry[T]).path)
+	}
+}
+
+// Invalidate drops path from the cache, so the next Read loads it from disk.
+func (c *CachedYAML[T]) Invalidate(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[path]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, path)
+	}
+}
+
+// InvalidateAll empties the cache.
+func (c *CachedYAML[T]) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.lru.Init()
+}
+
+// Len returns the number of cached files.
+func (c *CachedYAML[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// sameFileVersion reports whether a and b describe the same file, unmodified.
+func sameFileVersion(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
@@ -0,0 +1,202 @@
+// ABOUTME: Tests for CachedYAML: hits, invalidation on writes and external edits, eviction, and dedup.
+// ABOUTME: Counts loads through the cache's load hook to tell hits from reloads.
+package mdstore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingCache returns a cache whose loads are counted in the returned counter.
+func countingCache[T any](maxEntries int) (*CachedYAML[T], *atomic.Int32) {
+	c := NewCachedYAML[T](maxEntries)
+	var loads atomic.Int32
+	load := c.load
+	c.load = func(path string, dest *T) error {
+		loads.Add(1)
+		return load(path, dest)
+	}
+	return c, &loads
+}
+
+func mustRead[T any](t *testing.T, c *CachedYAML[T], path string) T {
+	t.Helper()
+	v, err := c.Read(path)
+	if err != nil {
+		t.Fatalf("Read(%s) failed: %v", filepath.Base(path), err)
+	}
+	return v
+}
+
+func TestCachedYAML_Hits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.yaml")
+	if err := WriteYAML(path, testItem{Name: "a", Value: 1}); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+
+	c, loads := countingCache[testItem](0)
+	for i := 0; i < 3; i++ {
+		if got := mustRead(t, c, path); got.Name != "a" {
+			t.Fatalf("got %+v", got)
+		}
+	}
+	if n := loads.Load(); n != 1 {
+		t.Errorf("3 reads of an unchanged file loaded it %d times, want 1", n)
+	}
+}
+
+func TestCachedYAML_InvalidatedByWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.yaml")
+	if err := WriteYAML(path, testItem{Name: "a", Value: 1}); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+	c, loads := countingCache[testItem](0)
+	mustRead(t, c, path)
+
+	// Same size, and likely the same mtime: only the file's identity changes.
+	if err := WriteYAML(path, testItem{Name: "b", Value: 1}); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+	if got := mustRead(t, c, path); got.Name != "b" {
+		t.Errorf("after WriteYAML got %+v, want name b", got)
+	}
+
+	err := UpdateYAML(dir, path, func(it *testItem) error {
+		it.Value = 2
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateYAML failed: %v", err)
+	}
+	if got := mustRead(t, c, path); got.Value != 2 {
+		t.Errorf("after UpdateYAML got %+v, want value 2", got)
+	}
+	if n := loads.Load(); n != 3 {
+		t.Errorf("loads = %d, want 3", n)
+	}
+}
+
+func TestCachedYAML_InvalidatedByExternalEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.yaml")
+	writeFileString(t, path, "name: a\nvalue: 1\n")
+	c, _ := countingCache[testItem](0)
+	mustRead(t, c, path)
+
+	// In place, different size.
+	writeFileString(t, path, "name: a\nvalue: 10\n")
+	if got := mustRead(t, c, path); got.Value != 10 {
+		t.Errorf("after size change got %+v, want value 10", got)
+	}
+
+	// In place, same size: only the mtime tells.
+	writeFileString(t, path, "name: a\nvalue: 20\n")
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	if got := mustRead(t, c, path); got.Value != 20 {
+		t.Errorf("after mtime change got %+v, want value 20", got)
+	}
+
+	// Removed: the zero value, like ReadYAML, and the entry is dropped.
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if got := mustRead(t, c, path); got != (testItem{}) || c.Len() != 0 {
+		t.Errorf("after removal got %+v with %d entries, want zero value and none", got, c.Len())
+	}
+}
+
+func TestCachedYAML_InvalidateAndEvict(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 3)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, string(rune('a'+i))+".yaml")
+		writeFileString(t, paths[i], "name: x\n")
+	}
+
+	c, loads := countingCache[testItem](2)
+	mustRead(t, c, paths[0])
+	c.Invalidate(paths[0])
+	mustRead(t, c, paths[0])
+	if n := loads.Load(); n != 2 {
+		t.Errorf("Invalidate: loads = %d, want 2", n)
+	}
+
+	mustRead(t, c, paths[1])
+	mustRead(t, c, paths[0]) // now most recently used
+	mustRead(t, c, paths[2]) // evicts paths[1]
+	if c.Len() != 2 {
+		t.Errorf("Len = %d, want 2", c.Len())
+	}
+	loads.Store(0)
+	mustRead(t, c, paths[0])
+	mustRead(t, c, paths[1])
+	if n := loads.Load(); n != 1 {
+		t.Errorf("expected only the evicted file to reload, got %d loads", n)
+	}
+
+	c.InvalidateAll()
+	if c.Len() != 0 {
+		t.Errorf("Len after InvalidateAll = %d", c.Len())
+	}
+}
+
+func TestCachedYAML_ErrorsNotCached(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.yaml")
+	writeFileString(t, path, "name: [broken\n")
+
+	c := NewCachedYAML[testItem](0)
+	if _, err := c.Read(path); err == nil {
+		t.Fatal("expected a parse error")
+	}
+	if c.Len() != 0 {
+		t.Error("a failed load should not be cached")
+	}
+
+	writeFileString(t, path, "name: fixed\n")
+	if got := mustRead(t, c, path); got.Name != "fixed" {
+		t.Errorf("got %+v after fixing the file", got)
+	}
+}
+
+func TestCachedYAML_ConcurrentReadersShareLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.yaml")
+	writeFileString(t, path, "name: shared\n")
+
+	c := NewCachedYAML[testItem](0)
+	var loads atomic.Int32
+	release := make(chan struct{})
+	c.load = func(path string, dest *testItem) error {
+		loads.Add(1)
+		<-release
+		return ReadYAML(path, dest)
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := c.Read(path); err != nil || got.Name != "shared" {
+				t.Errorf("Read = %+v, %v", got, err)
+			}
+		}()
+	}
+	for loads.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // let the other readers queue up behind the load
+	close(release)
+	wg.Wait()
+
+	if got := loads.Load(); got != 1 {
+		t.Errorf("%d concurrent readers caused %d loads, want 1", n, got)
+	}
+}
@@ -0,0 +1,65 @@
+// ABOUTME: Keyed deduplication for YAML list files, for logs fed by at-least-once deliveries.
+// ABOUTME: Provides AppendYAMLUnique and DedupYAML, both under WithLock on the file's directory.
+package mdstore
+
+import (
+	"path/filepath"
+)
+
+// AppendYAMLUnique appends item to the YAML list file at path unless an item with the
+// same key(item) is already there, in which case the file is left untouched. It runs
+// under WithLock on path's directory, so concurrent deliveries of the same item still
+// leave one entry. If T implements Validator, item must pass.
+func AppendYAMLUnique[T any](path string, item T, key func(T) string) error {
+	if err := validate(path, item); err != nil {
+		return err
+	}
+
+	return WithLock(filepath.Dir(path), func() error {
+		var items []T
+		if _, _, err := readYAMLFile(path, &items); err != nil {
+			return err
+		}
+
+		k := key(item)
+		for _, existing := range items {
+			if key(existing) == k {
+				return nil
+			}
+		}
+		return WriteYAML(path, append(items, item))
+	})
+}
+
+// DedupYAML removes items with repeated keys from the YAML list file at path, keeping
+// the first occurrence of each, and reports how many it removed. The file is rewritten
+// atomically only if something was removed. It runs under WithLock on path's directory.
+func DedupYAML[T any](path string, key func(T) string) (removed int, err error) {
+	err = WithLock(filepath.Dir(path), func() error {
+		var items []T
+		if _, _, err := readYAMLFile(path, &items); err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool, len(items))
+		kept := items[:0]
+		for _, item := range items {
+			k := key(item)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			kept = append(kept, item)
+		}
+
+		removed = len(items) - len(kept)
+		if removed == 0 {
+			return nil
+		}
+		return WriteYAML(path, kept)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
@@ -0,0 +1,108 @@
+// ABOUTME: Tests for AppendYAMLUnique and DedupYAML, including concurrent duplicate deliveries.
+// ABOUTME: Items are keyed by name; the first occurrence of each key is the one kept.
+package mdstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func itemName(it testItem) string { return it.Name }
+
+func TestAppendYAMLUnique(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+
+	for _, it := range []testItem{{"a", 1}, {"b", 2}, {"a", 3}} {
+		if err := AppendYAMLUnique(path, it, itemName); err != nil {
+			t.Fatalf("AppendYAMLUnique(%+v) failed: %v", it, err)
+		}
+	}
+	orig := readFileString(t, path)
+
+	var items []testItem
+	if err := ReadYAML(path, &items); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if len(items) != 2 || items[0] != (testItem{"a", 1}) || items[1] != (testItem{"b", 2}) {
+		t.Errorf("got %+v, want a/1 and b/2", items)
+	}
+
+	if err := AppendYAMLUnique(path, testItem{"b", 9}, itemName); err != nil {
+		t.Fatalf("AppendYAMLUnique failed: %v", err)
+	}
+	if got := readFileString(t, path); got != orig {
+		t.Errorf("a duplicate rewrote the file:\n%s", got)
+	}
+}
+
+func TestAppendYAMLUnique_ConcurrentDuplicates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+
+	// Each of 5 events is delivered 10 times, all at once.
+	const events, deliveries = 5, 10
+	var wg sync.WaitGroup
+	for d := 0; d < deliveries; d++ {
+		for e := 0; e < events; e++ {
+			wg.Add(1)
+			go func(e int) {
+				defer wg.Done()
+				item := testItem{Name: fmt.Sprintf("event-%d", e), Value: e}
+				if err := AppendYAMLUnique(path, item, itemName); err != nil {
+					t.Errorf("AppendYAMLUnique failed: %v", err)
+				}
+			}(e)
+		}
+	}
+	wg.Wait()
+
+	var items []testItem
+	if err := ReadYAML(path, &items); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if len(items) != events {
+		t.Fatalf("expected %d items, got %d: %+v", events, len(items), items)
+	}
+	seen := map[string]bool{}
+	for _, it := range items {
+		if seen[it.Name] {
+			t.Errorf("duplicate %s", it.Name)
+		}
+		seen[it.Name] = true
+	}
+}
+
+func TestDedupYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	items := []testItem{{"a", 1}, {"b", 2}, {"a", 3}, {"c", 4}, {"b", 5}, {"a", 6}}
+	if err := WriteYAML(path, items); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+
+	removed, err := DedupYAML(path, itemName)
+	if err != nil || removed != 3 {
+		t.Fatalf("DedupYAML = %d, %v; want 3, nil", removed, err)
+	}
+	var got []testItem
+	if err := ReadYAML(path, &got); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	want := []testItem{{"a", 1}, {"b", 2}, {"c", 4}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// Nothing left to remove: the file isn't rewritten.
+	orig := readFileString(t, path)
+	if removed, err := DedupYAML(path, itemName); err != nil || removed != 0 {
+		t.Errorf("second DedupYAML = %d, %v; want 0, nil", removed, err)
+	}
+	if readFileString(t, path) != orig {
+		t.Error("DedupYAML rewrote a file without duplicates")
+	}
+
+	if removed, err := DedupYAML(filepath.Join(t.TempDir(), "missing.yaml"), itemName); err != nil || removed != 0 {
+		t.Errorf("missing file: %d, %v; want 0, nil", removed, err)
+	}
+}
@@ -0,0 +1,192 @@
+// ABOUTME: Multi-document YAML streams: an append-friendly alternative to a single YAML list file.
+// ABOUTME: Provides AppendYAMLDoc, ReadYAMLDocs, DecodeYAMLDocs, CompactYAMLDocs, and list<->stream converters.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A doc stream file holds one YAML document per item, each introduced by "---":
+//
+//	---
+//	name: first
+//	---
+//	name: second
+//
+// Appending writes only the new document, where a list file (AppendYAML) must be
+// parsed and rewritten whole. The two formats are distinct: ReadYAML on a stream
+// sees only its first document, and ReadYAMLDocs on a list file sees one item, the
+// list itself. ConvertYAMLListToDocs and ConvertYAMLDocsToList convert between them.
+
+// AppendYAMLDoc appends item to the doc stream at path as a new "---" document,
+// creating the file (and its parent directories) if needed. The document is written
+// with a single O_APPEND write, so the cost doesn't grow with the file; a file not
+// ending in a newline gets one first, so "---" starts its own line. It runs under
+// WithLock on path's directory, which keeps it from racing CompactYAMLDocs.
+func AppendYAMLDoc[T any](path string, item T) error {
+	if err := validate(path, item); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return appendLocked(path, append([]byte("---\n"), data...))
+}
+
+// ReadYAMLDocs reads every document in the doc stream at path.
+// Returns nil (not error) if the file doesn't exist, like ReadYAML.
+func ReadYAMLDocs[T any](path string) ([]T, error) {
+	var items []T
+	err := DecodeYAMLDocs(path, func(item T) error {
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+// DecodeYAMLDocs calls fn with each document in the doc stream at path, in order,
+// without holding the whole stream in memory. Empty documents are skipped. Iteration
+// stops at the first error from fn, which is returned, except for ErrStop, which ends
+// iteration and returns nil. A missing file is not an error.
+func DecodeYAMLDocs[T any](path string, fn func(T) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	err = eachYAMLDoc(path, f, func(_ int, node *yaml.Node) error {
+		if err := checkYAMLNodeAliases(path, node, 1); err != nil {
+			return err
+		}
+		var item T
+		if err := node.Decode(&item); err != nil {
+			return newYAMLError(path, err, 1)
+		}
+		if err := validate(path, item); err != nil {
+			return err
+		}
+		return fn(item)
+	})
+	if errors.Is(err, ErrStop) {
+		return nil
+	}
+	return err
+}
+
+// eachYAMLDoc calls fn with each non-empty document in r and its 1-based position.
+// Malformed YAML returns a *YAMLError naming path.
+func eachYAMLDoc(path string, r io.Reader, fn func(n int, node *yaml.Node) error) error {
+	dec := yaml.NewDecoder(r)
+	for n := 1; ; n++ {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return newYAMLError(path, err, 1)
+		}
+		if node.Kind == 0 || (len(node.Content) == 1 && isNullNode(node.Content[0])) {
+			continue
+		}
+		if err := fn(n, &node); err != nil {
+			return err
+		}
+	}
+}
+
+// isNullNode reports whether node is an empty (null) scalar.
+func isNullNode(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null" && node.Value == ""
+}
+
+// CompactYAMLDocs rewrites the doc stream at path canonically: every document is
+// re-encoded, introduced by "---", and empty documents are dropped. Comments and key
+// order are kept. It runs under WithLock on path's directory and replaces the file
+// atomically. A missing file is not an error.
+func CompactYAMLDocs(path string) error {
+	return WithLock(filepath.Dir(path), func() error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		var out bytes.Buffer
+		err = eachYAMLDoc(path, bytes.NewReader(data), func(_ int, node *yaml.Node) error {
+			return writeYAMLDoc(&out, node)
+		})
+		if err != nil {
+			return err
+		}
+		return AtomicWrite(path, out.Bytes())
+	})
+}
+
+// writeYAMLDoc appends node to buf as a "---" document.
+func writeYAMLDoc(buf *bytes.Buffer, node *yaml.Node) error {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	buf.WriteString("---\n")
+	buf.Write(data)
+	return nil
+}
+
+// ConvertYAMLListToDocs writes the items of the YAML list file at listPath to docsPath
+// as a doc stream, replacing docsPath atomically. A missing list file yields an empty stream.
+func ConvertYAMLListToDocs(listPath, docsPath string) error {
+	var list yaml.Node
+	if err := ReadYAML(listPath, &list); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if len(list.Content) == 1 {
+		seq := list.Content[0]
+		if seq.Kind != yaml.SequenceNode {
+			return fmt.Errorf("mdstore: %s is not a YAML list", listPath)
+		}
+		for _, item := range seq.Content {
+			if err := writeYAMLDoc(&out, item); err != nil {
+				return err
+			}
+		}
+	}
+	return AtomicWrite(docsPath, out.Bytes())
+}
+
+// ConvertYAMLDocsToList writes the documents of the doc stream at docsPath to listPath
+// as a single YAML list, replacing listPath atomically.
+func ConvertYAMLDocsToList(docsPath, listPath string) error {
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+
+	data, err := os.ReadFile(docsPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err = eachYAMLDoc(docsPath, bytes.NewReader(data), func(_ int, node *yaml.Node) error {
+		seq.Content = append(seq.Content, node.Content[0])
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return WriteYAML(listPath, seq)
+}
@@ -0,0 +1,223 @@
+// ABOUTME: Tests for multi-document YAML streams: appending, reading, compacting, and converting.
+// ABOUTME: Includes concurrent appends and round trips between list files and doc streams.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppendYAMLDoc_ReadBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "events.yaml")
+
+	for i := 0; i < 3; i++ {
+		if err := AppendYAMLDoc(path, testItem{Name: "event", Value: i}); err != nil {
+			t.Fatalf("AppendYAMLDoc failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if got := strings.Count(string(data), "---\n"); got != 3 {
+		t.Errorf("expected 3 document separators, got %d in:\n%s", got, data)
+	}
+
+	items, err := ReadYAMLDocs[testItem](path)
+	if err != nil {
+		t.Fatalf("ReadYAMLDocs failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("expected 3 items, got %d", len(items))
+	}
+	for i, it := range items {
+		if it.Value != i {
+			t.Errorf("item %d out of order: %+v", i, it)
+		}
+	}
+}
+
+func TestAppendYAMLDoc_NoTrailingNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	writeFileString(t, path, "---\nname: edited\nvalue: 1")
+
+	if err := AppendYAMLDoc(path, testItem{Name: "event", Value: 2}); err != nil {
+		t.Fatalf("AppendYAMLDoc failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if want := "---\nname: edited\nvalue: 1\n---\nname: event\nvalue: 2\n"; string(data) != want {
+		t.Errorf("file:\n%s\nwant:\n%s", data, want)
+	}
+	items, err := ReadYAMLDocs[testItem](path)
+	if err != nil {
+		t.Fatalf("ReadYAMLDocs failed: %v", err)
+	}
+	if len(items) != 2 || items[0].Value != 1 || items[1].Value != 2 {
+		t.Errorf("items = %+v", items)
+	}
+}
+
+func TestAppendYAMLDoc_Concurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := AppendYAMLDoc(path, testItem{Name: "event", Value: i}); err != nil {
+				t.Errorf("AppendYAMLDoc failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	items, err := ReadYAMLDocs[testItem](path)
+	if err != nil {
+		t.Fatalf("ReadYAMLDocs failed: %v", err)
+	}
+	if len(items) != n {
+		t.Errorf("expected %d items, got %d", n, len(items))
+	}
+}
+
+func TestReadYAMLDocs_MissingFile(t *testing.T) {
+	items, err := ReadYAMLDocs[testItem](filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil {
+		t.Fatalf("ReadYAMLDocs should return nil for missing file, got: %v", err)
+	}
+	if items != nil {
+		t.Errorf("expected no items, got %v", items)
+	}
+}
+
+func TestDecodeYAMLDocs_StopsOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	for i := 0; i < 5; i++ {
+		if err := AppendYAMLDoc(path, testItem{Value: i}); err != nil {
+			t.Fatalf("AppendYAMLDoc failed: %v", err)
+		}
+	}
+
+	stop := errors.New("stop")
+	seen := 0
+	err := DecodeYAMLDocs(path, func(it testItem) error {
+		seen++
+		if it.Value == 1 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	if seen != 2 {
+		t.Errorf("expected iteration to stop after 2 documents, saw %d", seen)
+	}
+}
+
+func TestDecodeYAMLDocs_Malformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	content := "---\nname: ok\n---\nname: [unclosed\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if _, err := ReadYAMLDocs[testItem](path); err == nil {
+		t.Error("expected error for malformed document, got nil")
+	}
+}
+
+func TestCompactYAMLDocs_Canonicalizes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	content := "name: first # no leading separator\nvalue: 1\n---\n---\n\nvalue:   2\nname: second\n...\n---\nname: third\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if err := CompactYAMLDocs(path); err != nil {
+		t.Fatalf("CompactYAMLDocs failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	want := "---\nname: first # no leading separator\nvalue: 1\n---\nvalue: 2\nname: second\n---\nname: third\n"
+	if string(data) != want {
+		t.Errorf("compacted stream:\n%s\nwant:\n%s", data, want)
+	}
+
+	items, err := ReadYAMLDocs[testItem](path)
+	if err != nil {
+		t.Fatalf("ReadYAMLDocs failed: %v", err)
+	}
+	if len(items) != 3 || items[1].Name != "second" || items[1].Value != 2 {
+		t.Errorf("unexpected items after compaction: %+v", items)
+	}
+}
+
+func TestCompactYAMLDocs_MissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.yaml")
+	if err := CompactYAMLDocs(path); err != nil {
+		t.Fatalf("CompactYAMLDocs should ignore a missing file, got: %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("compacting a missing file should not create it")
+	}
+}
+
+func TestConvertYAML_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	listPath := filepath.Join(dir, "list.yaml")
+	docsPath := filepath.Join(dir, "docs.yaml")
+	backPath := filepath.Join(dir, "back.yaml")
+
+	want := []testItem{{Name: "a", Value: 1}, {Name: "b", Value: 2}, {Name: "c", Value: 3}}
+	if err := WriteYAML(listPath, want); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+
+	if err := ConvertYAMLListToDocs(listPath, docsPath); err != nil {
+		t.Fatalf("ConvertYAMLListToDocs failed: %v", err)
+	}
+	docs, err := ReadYAMLDocs[testItem](docsPath)
+	if err != nil {
+		t.Fatalf("ReadYAMLDocs failed: %v", err)
+	}
+	if len(docs) != len(want) || docs[2] != want[2] {
+		t.Errorf("stream items = %+v, want %+v", docs, want)
+	}
+
+	if err := ConvertYAMLDocsToList(docsPath, backPath); err != nil {
+		t.Fatalf("ConvertYAMLDocsToList failed: %v", err)
+	}
+	var back []testItem
+	if err := ReadYAML(backPath, &back); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if len(back) != len(want) || back[0] != want[0] {
+		t.Errorf("list items = %+v, want %+v", back, want)
+	}
+}
+
+func TestConvertYAMLListToDocs_NotAList(t *testing.T) {
+	dir := t.TempDir()
+	listPath := filepath.Join(dir, "map.yaml")
+	if err := WriteYAML(listPath, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+
+	if err := ConvertYAMLListToDocs(listPath, filepath.Join(dir, "docs.yaml")); err == nil {
+		t.Error("expected error converting a non-list file, got nil")
+	}
+}
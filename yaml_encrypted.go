@@ -0,0 +1,154 @@
+// ABOUTME: Encrypted YAML at rest: AES-256-GCM with a random nonce behind a small versioned header.
+// ABOUTME: Provides WriteYAMLEncrypted, ReadYAMLEncrypted, DeriveYAMLKey (argon2id), and EncryptionError.
+package mdstore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"gopkg.in/yaml.v3"
+)
+
+// Encrypted files start with encMagic and a format version byte; version 1 follows
+// them with a 12-byte nonce and the AES-256-GCM ciphertext, authenticating the header.
+// The leading NUL keeps the magic from ever being valid YAML text.
+var encMagic = []byte("\x00MDS")
+
+const (
+	encVersion   = 1
+	encHeaderLen = 5 // magic + version
+	encKeyLen    = 32
+)
+
+var (
+	// ErrEncrypted matches reading an encrypted file with a plaintext reader such as ReadYAML.
+	ErrEncrypted = errors.New("mdstore: file is encrypted")
+
+	// ErrNotEncrypted matches reading a plaintext file with ReadYAMLEncrypted.
+	ErrNotEncrypted = errors.New("mdstore: file is not encrypted")
+
+	// ErrDecrypt matches an encrypted file that fails authentication: the key is
+	// wrong or the file was modified.
+	ErrDecrypt = errors.New("mdstore: decryption failed (wrong key or corrupted file)")
+
+	// ErrEncryptionVersion matches an encrypted file written in an unknown format version.
+	ErrEncryptionVersion = errors.New("mdstore: unsupported encryption format version")
+)
+
+// EncryptionError reports a file that couldn't be read as expected because it is, or
+// isn't, encrypted, or failed to decrypt. Err is one of ErrEncrypted, ErrNotEncrypted,
+// ErrDecrypt, or ErrEncryptionVersion.
+type EncryptionError struct {
+	Path string
+	Err  error
+}
+
+func (e *EncryptionError) Error() string {
+	return fmt.Sprintf("mdstore: %s: %s", e.Path, strings.TrimPrefix(e.Err.Error(), "mdstore: "))
+}
+
+func (e *EncryptionError) Unwrap() error {
+	return e.Err
+}
+
+// WriteYAMLEncrypted marshals src to YAML, encrypts it with key (32 bytes, AES-256-GCM,
+// fresh random nonce per write), and writes it atomically.
+func WriteYAMLEncrypted(path string, src interface{}, key []byte) error {
+	aead, err := newYAMLCipher(key)
+	if err != nil {
+		return err
+	}
+	if err := validate(path, src); err != nil {
+		return err
+	}
+	plain, err := yaml.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	header := append(append([]byte(nil), encMagic...), encVersion)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	out := append(header, nonce...)
+	out = aead.Seal(out, nonce, plain, header)
+
+	return AtomicWrite(path, out)
+}
+
+// ReadYAMLEncrypted reads a file written by WriteYAMLEncrypted, decrypts it with key,
+// and unmarshals into dest. Like ReadYAML, it returns nil if the file doesn't exist.
+// A plaintext file, a wrong key, or a tampered file returns an *EncryptionError.
+func ReadYAMLEncrypted(path string, dest interface{}, key []byte) error {
+	aead, err := newYAMLCipher(key)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	if !isEncryptedYAML(data) {
+		return &EncryptionError{Path: path, Err: ErrNotEncrypted}
+	}
+	if len(data) < encHeaderLen || data[len(encMagic)] != encVersion {
+		return &EncryptionError{Path: path, Err: ErrEncryptionVersion}
+	}
+	header, rest := data[:encHeaderLen], data[encHeaderLen:]
+	if len(rest) < aead.NonceSize() {
+		return &EncryptionError{Path: path, Err: ErrDecrypt}
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+
+	plain, err := aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return &EncryptionError{Path: path, Err: ErrDecrypt}
+	}
+	if isEmptyYAML(plain) {
+		return nil
+	}
+	if err := checkYAMLAliases(path, plain, 1); err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(plain, dest); err != nil {
+		return newYAMLError(path, err, 1)
+	}
+	return validate(path, dest)
+}
+
+// DeriveYAMLKey derives a 32-byte key for WriteYAMLEncrypted from a passphrase with
+// argon2id (3 passes, 64 MiB, 4 threads). salt should be at least 16 random bytes,
+// generated once and stored alongside the encrypted files; it need not be secret.
+func DeriveYAMLKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 3, 64*1024, 4, encKeyLen)
+}
+
+// newYAMLCipher returns the AES-256-GCM AEAD for key.
+func newYAMLCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != encKeyLen {
+		return nil, fmt.Errorf("mdstore: encryption key must be %d bytes, got %d", encKeyLen, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isEncryptedYAML reports whether data starts with the encrypted-file magic.
+func isEncryptedYAML(data []byte) bool {
+	return bytes.HasPrefix(data, encMagic)
+}
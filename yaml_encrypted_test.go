@@ -0,0 +1,138 @@
+// ABOUTME: Tests for encrypted YAML: round trips, wrong keys, tampering, and format mixups.
+// ABOUTME: Also checks DeriveYAMLKey is deterministic and that plaintext readers reject encrypted files.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestYAMLEncrypted_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	item := testItem{Name: "secret", Value: 7}
+
+	if err := WriteYAMLEncrypted(path, item, testKey(1)); err != nil {
+		t.Fatalf("WriteYAMLEncrypted failed: %v", err)
+	}
+
+	data := []byte(readFileString(t, path))
+	if bytes.Contains(data, []byte("secret")) {
+		t.Error("file contains plaintext")
+	}
+
+	var got testItem
+	if err := ReadYAMLEncrypted(path, &got, testKey(1)); err != nil {
+		t.Fatalf("ReadYAMLEncrypted failed: %v", err)
+	}
+	if got != item {
+		t.Errorf("got %+v, want %+v", got, item)
+	}
+
+	// A fresh nonce per write means identical content never produces identical files.
+	if err := WriteYAMLEncrypted(path, item, testKey(1)); err != nil {
+		t.Fatalf("WriteYAMLEncrypted failed: %v", err)
+	}
+	if bytes.Equal(data, []byte(readFileString(t, path))) {
+		t.Error("rewriting the same content produced an identical file")
+	}
+}
+
+func TestReadYAMLEncrypted_MissingFile(t *testing.T) {
+	var got testItem
+	if err := ReadYAMLEncrypted(filepath.Join(t.TempDir(), "missing.yaml"), &got, testKey(1)); err != nil {
+		t.Errorf("missing file should return nil, got %v", err)
+	}
+}
+
+func TestReadYAMLEncrypted_WrongKeyAndTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	if err := WriteYAMLEncrypted(path, testItem{Name: "x"}, testKey(1)); err != nil {
+		t.Fatalf("WriteYAMLEncrypted failed: %v", err)
+	}
+	orig := []byte(readFileString(t, path))
+
+	var got testItem
+	err := ReadYAMLEncrypted(path, &got, testKey(2))
+	var encErr *EncryptionError
+	if !errors.As(err, &encErr) || !errors.Is(err, ErrDecrypt) || encErr.Path != path {
+		t.Errorf("wrong key: expected EncryptionError wrapping ErrDecrypt, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		mut  func([]byte) []byte
+		want error
+	}{
+		{"flipped ciphertext", func(b []byte) []byte { b[len(b)-1] ^= 1; return b }, ErrDecrypt},
+		{"truncated", func(b []byte) []byte { return b[:encHeaderLen+4] }, ErrDecrypt},
+		{"unknown version", func(b []byte) []byte { b[len(encMagic)] = 9; return b }, ErrEncryptionVersion},
+	} {
+		data := tc.mut(append([]byte(nil), orig...))
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		if err := ReadYAMLEncrypted(path, &got, testKey(1)); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestYAMLEncrypted_FormatMixups(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain.yaml")
+	secret := filepath.Join(dir, "secret.yaml")
+	if err := WriteYAML(plain, testItem{Name: "p"}); err != nil {
+		t.Fatalf("WriteYAML failed: %v", err)
+	}
+	if err := WriteYAMLEncrypted(secret, testItem{Name: "s"}, testKey(1)); err != nil {
+		t.Fatalf("WriteYAMLEncrypted failed: %v", err)
+	}
+
+	var got testItem
+	if err := ReadYAMLEncrypted(plain, &got, testKey(1)); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("ReadYAMLEncrypted on plaintext: expected ErrNotEncrypted, got %v", err)
+	}
+	if err := ReadYAML(secret, &got); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("ReadYAML on encrypted file: expected ErrEncrypted, got %v", err)
+	}
+	if err := ReadYAMLStrictFields(secret, &got); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("ReadYAMLStrictFields on encrypted file: expected ErrEncrypted, got %v", err)
+	}
+}
+
+func TestYAMLEncrypted_KeyLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.yaml")
+	for _, n := range []int{0, 16, 31, 33} {
+		if err := WriteYAMLEncrypted(path, testItem{}, make([]byte, n)); err == nil {
+			t.Errorf("WriteYAMLEncrypted with %d-byte key should fail", n)
+		}
+		var got testItem
+		if err := ReadYAMLEncrypted(path, &got, make([]byte, n)); err == nil {
+			t.Errorf("ReadYAMLEncrypted with %d-byte key should fail", n)
+		}
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Error("a rejected key should not write the file")
+	}
+}
+
+func TestDeriveYAMLKey(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	a := DeriveYAMLKey("hunter2", salt)
+	if len(a) != 32 {
+		t.Fatalf("key length %d, want 32", len(a))
+	}
+	if !bytes.Equal(a, DeriveYAMLKey("hunter2", salt)) {
+		t.Error("same passphrase and salt should derive the same key")
+	}
+	if bytes.Equal(a, DeriveYAMLKey("hunter3", salt)) || bytes.Equal(a, DeriveYAMLKey("hunter2", []byte("fedcba9876543210"))) {
+		t.Error("different passphrase or salt should derive a different key")
+	}
+}
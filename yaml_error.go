@@ -0,0 +1,89 @@
+// ABOUTME: YAMLError, a YAML parse or decode error located by file path and line.
+// ABOUTME: Rebases yaml.v3's chunk-relative line numbers onto the file, e.g. for frontmatter.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLError is a YAML syntax or decode error in a file, reported the way compilers
+// report them: "notes/foo.md:3: mapping values are not allowed in this context".
+// Line counts from the start of the file, even when the YAML was frontmatter or one
+// item of a larger file. Err is the underlying yaml.v3 error. Path may be empty when
+// the YAML didn't come from a file.
+type YAMLError struct {
+	Path   string
+	Line   int // 1-based; 0 if unknown
+	Column int // 1-based; 0 if unknown (yaml.v3 reports lines only)
+	Err    error
+
+	msg string
+}
+
+func (e *YAMLError) Error() string {
+	var b strings.Builder
+	switch {
+	case e.Path != "":
+		b.WriteString(e.Path)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d", e.Line)
+			if e.Column > 0 {
+				fmt.Fprintf(&b, ":%d", e.Column)
+			}
+		}
+		b.WriteString(": ")
+	case e.Line > 0:
+		// Without a path, fall back to yaml.v3's own style.
+		fmt.Fprintf(&b, "yaml: line %d: ", e.Line)
+	default:
+		b.WriteString("yaml: ")
+	}
+	if e.msg != "" {
+		b.WriteString(e.msg)
+	} else if e.Err != nil {
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *YAMLError) Unwrap() error {
+	return e.Err
+}
+
+// yamlLinePrefix matches the "line N: " that yaml.v3 puts before its messages.
+var yamlLinePrefix = regexp.MustCompile(`^line (\d+): `)
+
+// newYAMLError wraps err, from decoding YAML that starts on line firstLine of the
+// file at path, as a *YAMLError. A decode error listing several problems is located
+// at the first, and the message counts the rest; Err keeps them all. yaml.v3 leaves
+// the line out of errors on the first line of its input, so when the YAML starts
+// below line 1 (frontmatter, or one item of a list) such errors are put at firstLine.
+func newYAMLError(path string, err error, firstLine int) error {
+	msg := strings.TrimPrefix(err.Error(), "yaml: ")
+	more := 0
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+		more = len(typeErr.Errors) - 1
+	}
+
+	e := &YAMLError{Path: path, Err: err}
+	if m := yamlLinePrefix.FindStringSubmatch(msg); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		e.Line = n + firstLine - 1
+		msg = msg[len(m[0]):]
+	} else if firstLine > 1 {
+		e.Line = firstLine
+	}
+	if more > 0 {
+		msg += fmt.Sprintf(" (and %d more)", more)
+	}
+	e.msg = msg
+	return e
+}
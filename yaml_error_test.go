@@ -0,0 +1,123 @@
+// ABOUTME: Tests for YAMLError: file paths and line numbers on malformed YAML and frontmatter.
+// ABOUTME: Uses broken fixtures in testdata and checks lines are rebased onto the whole file.
+package mdstore
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// asYAMLError fails the test unless err is a *YAMLError, which it returns.
+func asYAMLError(t *testing.T, err error) *YAMLError {
+	t.Helper()
+	var yamlErr *YAMLError
+	if !errors.As(err, &yamlErr) {
+		t.Fatalf("expected *YAMLError, got %T: %v", err, err)
+	}
+	return yamlErr
+}
+
+func TestReadYAML_SyntaxErrorHasPathAndLine(t *testing.T) {
+	path, _ := copyFixture(t, "broken.yaml")
+
+	var cfg map[string]interface{}
+	yamlErr := asYAMLError(t, ReadYAML(path, &cfg))
+	if yamlErr.Path != path || yamlErr.Line != 6 {
+		t.Errorf("got %s:%d, want %s:6", yamlErr.Path, yamlErr.Line, path)
+	}
+	want := path + ":6: mapping values are not allowed in this context"
+	if yamlErr.Error() != want {
+		t.Errorf("Error() = %q, want %q", yamlErr.Error(), want)
+	}
+}
+
+func TestReadYAML_TypeErrorHasLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "item.yaml")
+	writeFileString(t, path, "# item\nname: a\nvalue: lots\n")
+
+	var item testItem
+	yamlErr := asYAMLError(t, ReadYAML(path, &item))
+	if yamlErr.Line != 3 || !strings.HasPrefix(yamlErr.Error(), path+":3: cannot unmarshal") {
+		t.Errorf("got line %d, %q", yamlErr.Line, yamlErr)
+	}
+	var typeErr *yaml.TypeError
+	if !errors.As(yamlErr, &typeErr) {
+		t.Error("YAMLError should unwrap to the yaml.TypeError")
+	}
+
+	writeFileString(t, path, "name: [a]\nvalue: lots\n")
+	yamlErr = asYAMLError(t, ReadYAML(path, &item))
+	if yamlErr.Line != 1 || !strings.HasSuffix(yamlErr.Error(), "(and 1 more)") {
+		t.Errorf("several errors: got line %d, %q", yamlErr.Line, yamlErr)
+	}
+}
+
+func TestDecodeFrontmatter_ErrorLineCountsFromFileTop(t *testing.T) {
+	path, content := copyFixture(t, "broken-frontmatter.md")
+
+	var meta map[string]interface{}
+	body, err := DecodeFrontmatter(path, content, &meta)
+	yamlErr := asYAMLError(t, err)
+	if yamlErr.Line != 5 {
+		t.Errorf("got line %d, want 5 (the author line in the markdown file)", yamlErr.Line)
+	}
+	if !strings.HasPrefix(yamlErr.Error(), path+":5: ") {
+		t.Errorf("Error() = %q", yamlErr)
+	}
+	if body != "# Heading\n\nBody text." {
+		t.Errorf("body should still be split off, got %q", body)
+	}
+
+	var doc struct {
+		Count int `yaml:"count"`
+	}
+	_, err = DecodeFrontmatter("", "\r\n\r\n---\r\ntitle: x\r\ncount: many\r\n---\r\nbody", &doc)
+	yamlErr = asYAMLError(t, err)
+	if yamlErr.Line != 5 || !strings.HasPrefix(yamlErr.Error(), "yaml: line 5: cannot unmarshal") {
+		t.Errorf("CRLF, no path: got line %d, %q", yamlErr.Line, yamlErr)
+	}
+}
+
+func TestDecodeFrontmatter(t *testing.T) {
+	var meta struct {
+		Title string `yaml:"title"`
+	}
+	body, err := DecodeFrontmatter("a.md", "---\ntitle: Hello\n---\nBody\n", &meta)
+	if err != nil || meta.Title != "Hello" || body != "Body" {
+		t.Errorf("got %+v, %q, %v", meta, body, err)
+	}
+
+	meta.Title = "kept"
+	for _, content := range []string{"No frontmatter\n", "---\n\n---\nBody\n"} {
+		body, err := DecodeFrontmatter("a.md", content, &meta)
+		if err != nil || meta.Title != "kept" || body == "" {
+			t.Errorf("%q: got %+v, %q, %v; want dest untouched", content, meta, body, err)
+		}
+	}
+}
+
+func TestDecodeYAMLSeq_ErrorLineCountsFromFileTop(t *testing.T) {
+	_, err := decodeSeqAll[testItem](t, "- name: a\n- name: b\n\n  value: [x]\n")
+	if yamlErr := asYAMLError(t, err); yamlErr.Line != 4 {
+		t.Errorf("type error: got line %d, want 4", yamlErr.Line)
+	}
+
+	_, err = decodeSeqAll[interface{}](t, "# list\n- a\n- b: c: d\n")
+	if yamlErr := asYAMLError(t, err); yamlErr.Line != 3 {
+		t.Errorf("syntax error: got line %d, want 3: %v", yamlErr.Line, yamlErr)
+	}
+}
+
+func TestDecodeYAMLDocs_ErrorIsYAMLError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	writeFileString(t, path, "---\nname: a\n---\nname: b\nvalue: lots\n")
+
+	_, err := ReadYAMLDocs[testItem](path)
+	if yamlErr := asYAMLError(t, err); yamlErr.Path != path || yamlErr.Line != 5 {
+		t.Errorf("got %s:%d, want %s:5", yamlErr.Path, yamlErr.Line, path)
+	}
+}
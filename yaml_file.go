@@ -0,0 +1,62 @@
+// ABOUTME: YAMLFile[T], a handle on one YAML file for code that would rather not pass paths around.
+// ABOUTME: Composes CachedYAML for reads with UpdateYAML and WithLock for writes.
+package mdstore
+
+import (
+	"path/filepath"
+)
+
+// YAMLFile is a handle on the YAML file name in dir, holding a T. Get reads through a
+// cache revalidated on every call (see CachedYAML), so changes made by other handles
+// or processes are seen on the next Get; Update and Reset write under WithLock on dir.
+// A YAMLFile is safe for concurrent use.
+type YAMLFile[T any] struct {
+	dir, path string
+	cache     *CachedYAML[T]
+}
+
+// OpenYAMLFile returns a handle on the YAML file name in dir. Nothing is read or
+// created until the first call; a missing file reads as the zero T.
+func OpenYAMLFile[T any](dir, name string) *YAMLFile[T] {
+	return &YAMLFile[T]{
+		dir:   dir,
+		path:  filepath.Join(dir, name),
+		cache: NewCachedYAML[T](1),
+	}
+}
+
+// Path returns the file's path.
+func (f *YAMLFile[T]) Path() string {
+	return f.path
+}
+
+// Get returns the file's content, the zero T if it doesn't exist. It's cached while
+// the file is unchanged, and shared between callers: treat it as read-only, and make
+// changes with Update.
+func (f *YAMLFile[T]) Get() (T, error) {
+	return f.cache.Read(f.path)
+}
+
+// Update runs a read-modify-write of the file under WithLock on its directory (see
+// UpdateYAML): fn gets the current content, read fresh from disk rather than from the
+// cache, and returns the new content. If fn returns an error, the file is unchanged.
+func (f *YAMLFile[T]) Update(fn func(T) (T, error)) error {
+	// Invalidate after writing, not before, so no Get can cache the old content in between.
+	defer f.cache.Invalidate(f.path)
+	return UpdateYAML(f.dir, f.path, func(v *T) error {
+		next, err := fn(*v)
+		if err != nil {
+			return err
+		}
+		*v = next
+		return nil
+	})
+}
+
+// Reset replaces the file's content with v, under WithLock on its directory.
+func (f *YAMLFile[T]) Reset(v T) error {
+	defer f.cache.Invalidate(f.path)
+	return WithLock(f.dir, func() error {
+		return WriteYAML(f.path, v)
+	})
+}
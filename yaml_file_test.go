@@ -0,0 +1,158 @@
+// ABOUTME: Tests for YAMLFile: Get, Update, and Reset, external edits, and concurrent increments.
+// ABOUTME: The increment test checks that no update is lost across goroutines and handles.
+package mdstore
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestYAMLFile(t *testing.T) {
+	errAbort := errors.New("abort")
+	for _, tc := range []struct {
+		name    string
+		initial string // file content before the step; "" for no file
+		step    func(f *YAMLFile[testItem]) error
+		wantErr error
+		want    testItem
+	}{
+		{
+			name: "get missing",
+			step: func(f *YAMLFile[testItem]) error { return nil },
+		},
+		{
+			name:    "get existing",
+			initial: "name: a\nvalue: 1\n",
+			step:    func(f *YAMLFile[testItem]) error { return nil },
+			want:    testItem{Name: "a", Value: 1},
+		},
+		{
+			name: "update missing",
+			step: func(f *YAMLFile[testItem]) error {
+				return f.Update(func(it testItem) (testItem, error) {
+					it.Name = "new"
+					return it, nil
+				})
+			},
+			want: testItem{Name: "new"},
+		},
+		{
+			name:    "update existing",
+			initial: "name: a\nvalue: 1\n",
+			step: func(f *YAMLFile[testItem]) error {
+				return f.Update(func(it testItem) (testItem, error) {
+					it.Value++
+					return it, nil
+				})
+			},
+			want: testItem{Name: "a", Value: 2},
+		},
+		{
+			name:    "update aborted",
+			initial: "name: a\nvalue: 1\n",
+			step: func(f *YAMLFile[testItem]) error {
+				return f.Update(func(it testItem) (testItem, error) {
+					return testItem{Name: "discarded"}, errAbort
+				})
+			},
+			wantErr: errAbort,
+			want:    testItem{Name: "a", Value: 1},
+		},
+		{
+			name:    "reset",
+			initial: "name: a\nvalue: 1\n",
+			step:    func(f *YAMLFile[testItem]) error { return f.Reset(testItem{Name: "b"}) },
+			want:    testItem{Name: "b"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			f := OpenYAMLFile[testItem](dir, "state.yaml")
+			if f.Path() != filepath.Join(dir, "state.yaml") {
+				t.Errorf("Path = %q", f.Path())
+			}
+			if tc.initial != "" {
+				writeFileString(t, f.Path(), tc.initial)
+			}
+			if _, err := f.Get(); err != nil { // prime the cache
+				t.Fatalf("Get failed: %v", err)
+			}
+
+			if err := tc.step(f); !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			got, err := f.Get()
+			if err != nil || got != tc.want {
+				t.Errorf("Get = %+v, %v; want %+v", got, err, tc.want)
+			}
+			var onDisk testItem
+			if err := ReadYAML(f.Path(), &onDisk); err != nil || onDisk != tc.want {
+				t.Errorf("file holds %+v, %v; want %+v", onDisk, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestYAMLFile_SeesExternalChanges(t *testing.T) {
+	dir := t.TempDir()
+	f := OpenYAMLFile[testItem](dir, "state.yaml")
+	other := OpenYAMLFile[testItem](dir, "state.yaml")
+
+	if err := f.Reset(testItem{Name: "a"}); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if got, _ := other.Get(); got.Name != "a" {
+		t.Fatalf("other handle got %+v", got)
+	}
+
+	writeFileString(t, f.Path(), "name: edited-by-hand-and-longer\n")
+	if got, err := f.Get(); err != nil || got.Name != "edited-by-hand-and-longer" {
+		t.Errorf("after an external edit got %+v, %v", got, err)
+	}
+	if err := other.Reset(testItem{Name: "b"}); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if got, err := f.Get(); err != nil || got.Name != "b" {
+		t.Errorf("after a write through another handle got %+v, %v", got, err)
+	}
+}
+
+func TestYAMLFile_ConcurrentIncrements(t *testing.T) {
+	dir := t.TempDir()
+	handles := []*YAMLFile[testItem]{
+		OpenYAMLFile[testItem](dir, "counter.yaml"),
+		OpenYAMLFile[testItem](dir, "counter.yaml"),
+	}
+
+	const goroutines, increments = 10, 20
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(f *YAMLFile[testItem]) {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				err := f.Update(func(it testItem) (testItem, error) {
+					it.Value++
+					return it, nil
+				})
+				if err != nil {
+					t.Errorf("Update failed: %v", err)
+					return
+				}
+				if _, err := f.Get(); err != nil {
+					t.Errorf("Get failed: %v", err)
+					return
+				}
+			}
+		}(handles[i%len(handles)])
+	}
+	wg.Wait()
+
+	for _, f := range handles {
+		if got, err := f.Get(); err != nil || got.Value != goroutines*increments {
+			t.Errorf("counter = %d, %v; want %d", got.Value, err, goroutines*increments)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// ABOUTME: Header comments for machine-maintained YAML files (YAMLOptions.Header).
+// ABOUTME: Expands the {path} and {time} placeholders and renders the header as "# " lines.
+package mdstore
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// DefaultYAMLHeader is a header for files that programs maintain, such as indexes and
+// manifests, warning people off editing them by hand. Pass it as YAMLOptions.Header.
+const DefaultYAMLHeader = "Code generated by mdstore. DO NOT EDIT.\nWritten to {path} at {time}; changes made by hand may be lost."
+
+// yamlHeader renders header as a block of comment lines, followed by a blank line so
+// yaml.v3 reads it as the document's head comment rather than the first key's, which
+// keeps it in place when UpdateYAMLNode rewrites the file. {path} is replaced with
+// path, slash-separated, and {time} with the current time (see FormatTime).
+func yamlHeader(header, path string) []byte {
+	header = strings.NewReplacer(
+		"{path}", filepath.ToSlash(path),
+		"{time}", FormatTime(now().UTC()),
+	).Replace(header)
+
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(header, "\r\n"), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			b.WriteString("#\n")
+			continue
+		}
+		b.WriteString("# " + line + "\n")
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,72 @@
+// ABOUTME: Tests for YAMLOptions.Header: placeholder expansion, golden output, and survival across updates.
+// ABOUTME: Pins the clock so the {time} placeholder renders the same on every run.
+package mdstore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harperreed/mdstore/internal/clocktest"
+	"gopkg.in/yaml.v3"
+)
+
+// readHeaderGolden reads the file at path with dir, which varies between runs,
+// replaced by "data".
+func readHeaderGolden(t *testing.T, dir, path string) []byte {
+	t.Helper()
+	return []byte(strings.ReplaceAll(readFileString(t, path), filepath.ToSlash(dir), "data"))
+}
+
+func TestWriteYAMLOpts_Header(t *testing.T) {
+	SetClock(clocktest.New(time.Date(2026, 3, 4, 5, 6, 7, 0, time.FixedZone("", 3600))))
+	t.Cleanup(func() { SetClock(nil) })
+	dir := t.TempDir()
+	path := filepath.Join(dir, "index.yaml")
+
+	if err := WriteYAMLOpts(path, goldenValue, YAMLOptions{Indent: 2, Header: DefaultYAMLHeader}); err != nil {
+		t.Fatalf("WriteYAMLOpts failed: %v", err)
+	}
+	checkGolden(t, "config.header.golden.yaml", readHeaderGolden(t, dir, path))
+
+	var back goldenConfig
+	if err := ReadYAMLStrictFields(path, &back); err != nil || back.Title != goldenValue.Title {
+		t.Fatalf("reading back got %+v, %v", back, err)
+	}
+
+	// Updates keep the header, even when the first key goes.
+	err := UpdateYAMLNode(path, func(root *yaml.Node) error {
+		deleteYAMLNodeKeys(root, []string{"title"})
+		return SetYAMLPath(root, "server.port", 9090)
+	})
+	if err != nil {
+		t.Fatalf("UpdateYAMLNode failed: %v", err)
+	}
+	checkGolden(t, "config.header.updated.golden.yaml", readHeaderGolden(t, dir, path))
+}
+
+func TestYAMLHeader(t *testing.T) {
+	for _, tc := range []struct {
+		header, want string
+	}{
+		{"one line", "# one line\n\n"},
+		{"two\nlines\n", "# two\n# lines\n\n"},
+		{"gap\n\nafter  \r\n", "# gap\n#\n# after\n\n"},
+		{"for {path}", "# for dir/x.yaml\n\n"},
+	} {
+		if got := string(yamlHeader(tc.header, filepath.Join("dir", "x.yaml"))); got != tc.want {
+			t.Errorf("yamlHeader(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+
+	// No header on a file written empty.
+	path := filepath.Join(t.TempDir(), "empty.yaml")
+	if err := WriteYAMLOpts(path, []string{}, YAMLOptions{Empty: EmptyFile, Header: "generated"}); err != nil {
+		t.Fatalf("WriteYAMLOpts failed: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || len(data) != 0 {
+		t.Errorf("empty file got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,303 @@
+// ABOUTME: Conversion between YAML and JSON that keeps key order, number literals, and timestamps.
+// ABOUTME: Provides YAMLToJSON, JSONToYAML, and the file-level ConvertYAMLFileToJSON.
+package mdstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxYAMLJSONDepth bounds nesting (including through aliases) when converting to JSON.
+const maxYAMLJSONDepth = 1000
+
+// YAMLToJSON converts the first YAML document in data to compact JSON. Mapping keys
+// become strings and keep their order; numbers are copied literally when they are
+// already valid JSON (so 1.10 and 12345678901234567890 survive), and otherwise
+// converted (0x1F becomes 31); timestamps become JSON strings with their text
+// unchanged. Aliases are expanded and "<<" merge keys applied. Values JSON can't hold,
+// such as .inf or a mapping used as a key, are an error. Empty input yields null.
+func YAMLToJSON(data []byte) ([]byte, error) {
+	return yamlToJSON("", data)
+}
+
+func yamlToJSON(path string, data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, newYAMLError(path, err, 1)
+	}
+	if doc.Kind == 0 {
+		return []byte("null"), nil
+	}
+	if err := checkYAMLNodeAliases(path, &doc, 1); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSONNode(&buf, doc.Content[0], 0); err != nil {
+		if path != "" {
+			return nil, fmt.Errorf("mdstore: %s: %w", path, err)
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeJSONNode appends node to buf as JSON.
+func writeJSONNode(buf *bytes.Buffer, node *yaml.Node, depth int) error {
+	if depth > maxYAMLJSONDepth {
+		return errors.New("mdstore: YAML nested too deeply to convert to JSON")
+	}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		return writeJSONNode(buf, node.Alias, depth+1)
+
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeJSONNode(buf, item, depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+
+	case yaml.MappingNode:
+		keys, values, err := jsonMappingEntries(node, depth)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, key)
+			buf.WriteByte(':')
+			if err := writeJSONNode(buf, values[i], depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case yaml.ScalarNode:
+		return writeJSONScalar(buf, node)
+	}
+	return fmt.Errorf("mdstore: line %d: unsupported YAML node", node.Line)
+}
+
+// jsonMappingEntries returns the keys of a mapping node, as strings in document order,
+// and their values. "<<" merge keys contribute the entries of the mapping (or list of
+// mappings) they refer to, without overriding keys set explicitly; a repeated key
+// keeps its first position and takes its last value.
+func jsonMappingEntries(node *yaml.Node, depth int) ([]string, []*yaml.Node, error) {
+	var (
+		keys   []string
+		values []*yaml.Node
+		index  = map[string]int{}
+	)
+	set := func(key string, value *yaml.Node, fromMerge bool) {
+		i, ok := index[key]
+		switch {
+		case !ok:
+			index[key] = len(keys)
+			keys = append(keys, key)
+			values = append(values, value)
+		case fromMerge:
+			// Explicit keys and earlier merges win.
+		default:
+			values[i] = value
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		k, v := node.Content[i], node.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.Tag == "!!merge" {
+			sources := []*yaml.Node{v}
+			if v.Kind == yaml.SequenceNode {
+				sources = v.Content
+			}
+			for _, src := range sources {
+				for src.Kind == yaml.AliasNode {
+					src = src.Alias
+				}
+				if src.Kind != yaml.MappingNode {
+					return nil, nil, fmt.Errorf("mdstore: line %d: merge key must refer to a mapping", v.Line)
+				}
+				if depth > maxYAMLJSONDepth {
+					return nil, nil, errors.New("mdstore: YAML nested too deeply to convert to JSON")
+				}
+				mk, mv, err := jsonMappingEntries(src, depth+1)
+				if err != nil {
+					return nil, nil, err
+				}
+				for j := range mk {
+					set(mk[j], mv[j], true)
+				}
+			}
+			continue
+		}
+
+		for k.Kind == yaml.AliasNode {
+			k = k.Alias
+		}
+		if k.Kind != yaml.ScalarNode {
+			return nil, nil, fmt.Errorf("mdstore: line %d: JSON object keys must be scalars", k.Line)
+		}
+		set(k.Value, v, false)
+	}
+	return keys, values, nil
+}
+
+// writeJSONScalar appends a YAML scalar to buf as the closest JSON value.
+func writeJSONScalar(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.ShortTag() {
+	case "!!null":
+		buf.WriteString("null")
+	case "!!bool":
+		var b bool
+		if err := node.Decode(&b); err != nil {
+			return err
+		}
+		fmt.Fprint(buf, b)
+	case "!!int", "!!float":
+		if isJSONNumber(node.Value) {
+			buf.WriteString(node.Value)
+			return nil
+		}
+		var n interface{}
+		if err := node.Decode(&n); err != nil {
+			return err
+		}
+		data, err := json.Marshal(n)
+		if err != nil {
+			return fmt.Errorf("mdstore: line %d: %s can't be represented in JSON", node.Line, node.Value)
+		}
+		buf.Write(data)
+	default:
+		// Strings, timestamps, binary, and custom tags keep their text.
+		writeJSONString(buf, node.Value)
+	}
+	return nil
+}
+
+// isJSONNumber reports whether s is a number literal in JSON syntax.
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	var n json.Number
+	return json.Unmarshal([]byte(s), &n) == nil
+}
+
+// writeJSONString appends s to buf as a JSON string.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	data, _ := json.Marshal(s) // strings always marshal
+	buf.Write(data)
+}
+
+// JSONToYAML converts a JSON value to YAML, encoded like WriteYAML. Object keys keep
+// their order and numbers keep their literal text; strings that would read back as
+// another type (such as "true", "42", or an RFC3339 time) are quoted, so the result
+// converts back to the same JSON.
+func JSONToYAML(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := jsonToYAMLNode(dec)
+	if err != nil {
+		return nil, fmt.Errorf("mdstore: invalid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("mdstore: invalid JSON: trailing data after value")
+	}
+	return marshalYAML(node, YAMLOptions{})
+}
+
+// jsonToYAMLNode reads the next JSON value from dec as a YAML node.
+func jsonToYAMLNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			for dec.More() {
+				item, err := jsonToYAMLNode(dec)
+				if err != nil {
+					return nil, err
+				}
+				seq.Content = append(seq.Content, item)
+			}
+			_, err := dec.Token() // ']'
+			return seq, err
+		}
+
+		mapping := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := jsonToYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			mapping.Content = append(mapping.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)}, value)
+		}
+		_, err := dec.Token() // '}'
+		return mapping, err
+
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(string(t), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(t)}, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(t)}, nil
+	default: // nil
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+// ConvertYAMLFileToJSON converts the YAML file at src to JSON (see YAMLToJSON) and
+// writes it to dst atomically, indented by two spaces with a trailing newline. A
+// missing src returns a *NotFoundError.
+func ConvertYAMLFileToJSON(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &NotFoundError{Path: src}
+		}
+		return err
+	}
+
+	compact, err := yamlToJSON(src, data)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	return AtomicWrite(dst, out.Bytes())
+}
@@ -0,0 +1,164 @@
+// ABOUTME: Tests for YAMLToJSON, JSONToYAML, and ConvertYAMLFileToJSON.
+// ABOUTME: Round-trips testdata/convert.yaml and checks numbers, timestamps, merges, and key order.
+package mdstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// convertFixtureJSON is testdata/convert.yaml as YAMLToJSON renders it.
+const convertFixtureJSON = `{"name":"mdstore","version":1.10,"big":12345678901234567890,"hex":31,"ratio":1e3,` +
+	`"enabled":"yes","quoted_bool":"true","created":"2024-01-15T10:30:00Z","day":"2024-01-15","nothing":null,` +
+	`"defaults":{"retries":3,"timeout":"5s"},` +
+	`"servers":[{"host":"a.example.com","retries":5,"timeout":"5s"},` +
+	`{"host":"b.example.com","retries":3,"timeout":"5s","tags":["primary","42"]}],` +
+	`"notes":"First line.\nSecond line with \"quotes\".\n","folded":"folded text\n","1":"numeric key"}`
+
+func TestYAMLToJSON_Fixture(t *testing.T) {
+	_, content := copyFixture(t, "convert.yaml")
+
+	got, err := YAMLToJSON([]byte(content))
+	if err != nil {
+		t.Fatalf("YAMLToJSON failed: %v", err)
+	}
+	if string(got) != convertFixtureJSON {
+		t.Errorf("got:\n%s\nwant:\n%s", got, convertFixtureJSON)
+	}
+}
+
+func TestYAMLJSON_RoundTrip(t *testing.T) {
+	_, content := copyFixture(t, "convert.yaml")
+
+	first, err := YAMLToJSON([]byte(content))
+	if err != nil {
+		t.Fatalf("YAMLToJSON failed: %v", err)
+	}
+	yml, err := JSONToYAML(first)
+	if err != nil {
+		t.Fatalf("JSONToYAML failed: %v", err)
+	}
+	second, err := YAMLToJSON(yml)
+	if err != nil {
+		t.Fatalf("YAMLToJSON of converted YAML failed: %v", err)
+	}
+	if string(second) != string(first) {
+		t.Errorf("round trip changed the JSON:\n%s\nwant:\n%s\nvia YAML:\n%s", second, first, yml)
+	}
+
+	// Strings that look like other types stay strings in the YAML.
+	var back map[string]interface{}
+	if err := readYAMLBytes(t, yml, &back); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]interface{}{"quoted_bool": "true", "created": "2024-01-15T10:30:00Z", "day": "2024-01-15"} {
+		if back[key] != want {
+			t.Errorf("%s decoded as %#v, want the string %q", key, back[key], want)
+		}
+	}
+}
+
+// readYAMLBytes decodes data through a temp file with ReadYAML.
+func readYAMLBytes(t *testing.T, data []byte, dest interface{}) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.yaml")
+	writeFileString(t, path, string(data))
+	return ReadYAML(path, dest)
+}
+
+func TestJSONToYAML(t *testing.T) {
+	in := `{"z":1,"a":[{"k":"v"},{"k":"multi\nline"}],"n":null,"f":2.50,"b":false,"s":"123"}`
+
+	got, err := JSONToYAML([]byte(in))
+	if err != nil {
+		t.Fatalf("JSONToYAML failed: %v", err)
+	}
+	want := "z: 1\na:\n    - k: v\n    - k: |-\n        multi\n        line\nn: null\nf: 2.50\nb: false\ns: \"123\"\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	back, err := YAMLToJSON(got)
+	if err != nil || string(back) != in {
+		t.Errorf("back to JSON: %s, %v; want %s", back, err, in)
+	}
+
+	for _, bad := range []string{"", "{", `{"a":1} {"b":2}`, "[1,]"} {
+		if _, err := JSONToYAML([]byte(bad)); err == nil {
+			t.Errorf("JSONToYAML(%q) should fail", bad)
+		}
+	}
+}
+
+func TestYAMLToJSON_EdgeCases(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"", "null"},
+		{"# just a comment\n", "null"},
+		{"[]", "[]"},
+		{"{}", "{}"},
+		{"- +5\n- 0o17\n- 1_000\n- -0.5\n", "[5,15,1000,-0.5]"},
+		{"a: &x [1, 2]\nb: *x\n", `{"a":[1,2],"b":[1,2]}`},
+		{"a: 1\na: 2\nb: 3\n", `{"a":2,"b":3}`},
+		{"<<: [{a: 1, b: 1}, {b: 2, c: 2}]\nc: 3\n", `{"a":1,"b":1,"c":3}`},
+		{"true: yes\nnull: x\n", `{"true":"yes","null":"x"}`},
+		{"bin: !!binary aGVsbG8=\n", `{"bin":"aGVsbG8="}`},
+	} {
+		got, err := YAMLToJSON([]byte(tc.in))
+		if err != nil {
+			t.Errorf("YAMLToJSON(%q) failed: %v", tc.in, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("YAMLToJSON(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+		if !json.Valid(got) {
+			t.Errorf("YAMLToJSON(%q) produced invalid JSON: %s", tc.in, got)
+		}
+	}
+
+	for _, bad := range []string{"a: .inf\n", "? [a, b]\n: c\n", "<<: 1\n", "a: [\n"} {
+		if _, err := YAMLToJSON([]byte(bad)); err == nil {
+			t.Errorf("YAMLToJSON(%q) should fail", bad)
+		}
+	}
+}
+
+func TestConvertYAMLFileToJSON(t *testing.T) {
+	src, _ := copyFixture(t, "convert.yaml")
+	dst := filepath.Join(t.TempDir(), "out", "convert.json")
+
+	if err := ConvertYAMLFileToJSON(src, dst); err != nil {
+		t.Fatalf("ConvertYAMLFileToJSON failed: %v", err)
+	}
+	got := readFileString(t, dst)
+	if !strings.HasPrefix(got, "{\n  \"name\": \"mdstore\",\n") || !strings.HasSuffix(got, "}\n") {
+		t.Errorf("expected indented JSON with a trailing newline:\n%s", got)
+	}
+
+	var fromFile, fromFixture interface{}
+	if err := json.Unmarshal([]byte(got), &fromFile); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	json.Unmarshal([]byte(convertFixtureJSON), &fromFixture)
+	if !reflect.DeepEqual(fromFile, fromFixture) {
+		t.Errorf("file content differs from YAMLToJSON")
+	}
+
+	err := ConvertYAMLFileToJSON(filepath.Join(t.TempDir(), "missing.yaml"), dst)
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing source: expected fs.ErrNotExist, got %v", err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.yaml")
+	writeFileString(t, bad, "a: .nan\n")
+	if err := ConvertYAMLFileToJSON(bad, dst); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("unconvertible value: expected error naming %s, got %v", bad, err)
+	}
+}
@@ -0,0 +1,70 @@
+// ABOUTME: Partial decoding of YAML files: only the requested top-level keys, each into its own destination.
+// ABOUTME: Provides ReadYAMLKeys, which parses the file once as a yaml.Node tree.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReadYAMLKeys reads the YAML mapping in the file at path and decodes the value of each
+// top-level key in dests into the destination it maps to, leaving the rest of the
+// document undecoded: a consumer of one section of a large config needs neither the
+// whole struct nor the types of the other sections. The file is parsed once.
+//
+// Keys not in the file are returned in missing, sorted, and their destinations left
+// untouched; a missing or empty file has every key missing. As with ReadYAML, the file
+// is subject to the size limit (see SetMaxYAMLSize), malformed YAML or a value of the
+// wrong type returns a *YAMLError, and destinations implementing Validator are
+// validated. A document that isn't a mapping is a *YAMLError too.
+func ReadYAMLKeys(path string, dests map[string]interface{}) (missing []string, err error) {
+	keys := make([]string, 0, len(dests))
+	for key := range dests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data, err := readFileMax(path, currentMaxYAMLSize())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return keys, nil
+		}
+		return nil, err
+	}
+	if isEncryptedYAML(data) {
+		return nil, &EncryptionError{Path: path, Err: ErrEncrypted}
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, newYAMLError(path, err, 1)
+	}
+	if doc.Kind == 0 || doc.Content[0].Tag == "!!null" {
+		return keys, nil
+	}
+	if err := checkYAMLNodeAliases(path, &doc, 1); err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, newYAMLError(path, fmt.Errorf("line %d: expected a mapping of keys, got %s", root.Line, describeYAMLNode(root)), 1)
+	}
+
+	for _, key := range keys {
+		node := yamlMappingValue(root, key)
+		if node == nil {
+			missing = append(missing, key)
+			continue
+		}
+		if err := node.Decode(dests[key]); err != nil {
+			return nil, newYAMLError(path, err, 1)
+		}
+		if err := validate(path, dests[key]); err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
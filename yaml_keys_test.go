@@ -0,0 +1,88 @@
+// ABOUTME: Tests for ReadYAMLKeys against testdata/sections.yaml: one section requested, absent keys, and errors.
+// ABOUTME: Sections that aren't requested are never decoded, so their types don't matter.
+package mdstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type serverSection struct {
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+}
+
+func TestReadYAMLKeys(t *testing.T) {
+	path, _ := copyFixture(t, "sections.yaml")
+
+	// Only "server" is decoded; the other sections' types don't matter.
+	var server serverSection
+	missing, err := ReadYAMLKeys(path, map[string]interface{}{"server": &server})
+	if err != nil || missing != nil {
+		t.Fatalf("ReadYAMLKeys = %v, %v", missing, err)
+	}
+	if server != (serverSection{Host: "example.com", Port: 8080}) {
+		t.Errorf("server = %+v", server)
+	}
+
+	var pool struct {
+		Pool int `yaml:"pool"`
+	}
+	var features []string
+	var untouched struct{ Pool int }
+	missing, err = ReadYAMLKeys(path, map[string]interface{}{
+		"database": &pool,
+		"features": &features,
+		"logging":  &untouched,
+		"cache":    &untouched,
+	})
+	if err != nil {
+		t.Fatalf("ReadYAMLKeys failed: %v", err)
+	}
+	if !reflect.DeepEqual(missing, []string{"cache", "logging"}) || untouched.Pool != 0 {
+		t.Errorf("missing = %v, untouched = %+v", missing, untouched)
+	}
+	if pool.Pool != 10 || !reflect.DeepEqual(features, []string{"search", "export"}) {
+		t.Errorf("pool = %+v, features = %v", pool, features)
+	}
+}
+
+func TestReadYAMLKeys_MissingOrEmpty(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.yaml")
+	writeFileString(t, empty, "# nothing yet\n")
+	for _, path := range []string{filepath.Join(dir, "missing.yaml"), empty} {
+		var a, b int
+		missing, err := ReadYAMLKeys(path, map[string]interface{}{"b": &b, "a": &a})
+		if err != nil || !reflect.DeepEqual(missing, []string{"a", "b"}) {
+			t.Errorf("%s: got %v, %v", filepath.Base(path), missing, err)
+		}
+	}
+}
+
+func TestReadYAMLKeys_Errors(t *testing.T) {
+	path, _ := copyFixture(t, "sections.yaml")
+	var server serverSection
+	_, err := ReadYAMLKeys(path, map[string]interface{}{"features": &server})
+	if e := asYAMLError(t, err); e.Line != 9 {
+		t.Errorf("Line = %d, want 9: %v", e.Line, err)
+	}
+
+	list := filepath.Join(t.TempDir(), "list.yaml")
+	writeFileString(t, list, "- a\n- b\n")
+	_, err = ReadYAMLKeys(list, map[string]interface{}{"server": &server})
+	if e := asYAMLError(t, err); e.Line != 1 {
+		t.Errorf("Line = %d, want 1: %v", e.Line, err)
+	}
+
+	cfgPath := filepath.Join(t.TempDir(), "config.yaml")
+	writeFileString(t, cfgPath, "checked:\n  name: ''\n  level: low\n")
+	var cfg checkedConfig
+	_, err = ReadYAMLKeys(cfgPath, map[string]interface{}{"checked": &cfg})
+	asValidationError(t, err, cfgPath)
+
+	setMaxYAMLSize(t, 16)
+	_, err = ReadYAMLKeys(path, map[string]interface{}{"server": &server})
+	asFileTooLarge(t, err)
+}
@@ -0,0 +1,390 @@
+// ABOUTME: Comment- and order-preserving YAML updates through yaml.Node trees.
+// ABOUTME: Provides UpdateYAMLNode and SetYAMLPath; unchanged lines keep their original formatting.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxYAMLMergeCells bounds the line diff UpdateYAMLNode runs to keep original
+// formatting; bigger files are written exactly as the encoder produces them.
+const maxYAMLMergeCells = 1 << 22
+
+// UpdateYAMLNode runs a read-modify-write of the YAML file at path on its yaml.Node
+// tree, so comments and key order survive, under WithLock on path's directory. fn gets
+// the document node (with an empty mapping if the file is missing or empty) and may
+// change it in place; SetYAMLPath covers the common cases. If fn returns an error the
+// file is left unchanged.
+//
+// The tree is re-encoded with the file's own indentation, and lines fn didn't change
+// keep their original text, including blank lines the encoder would drop, so the diff
+// shows only the intended changes.
+func UpdateYAMLNode(path string, fn func(root *yaml.Node) error) error {
+	return WithLock(filepath.Dir(path), func() error {
+		src, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return updateYAMLNode(path, src, fn)
+	})
+}
+
+// updateYAMLNode is UpdateYAMLNode for a caller holding the lock, given the file's
+// current content src.
+func updateYAMLNode(path string, src []byte, fn func(root *yaml.Node) error) error {
+	doc, err := parseYAMLNode(path, src)
+	if err != nil {
+		return err
+	}
+	return rewriteYAMLNode(path, src, doc, func(root *yaml.Node) (bool, error) {
+		return true, fn(root)
+	})
+}
+
+// rewriteYAMLNode applies fn to doc, parsed from src, and writes the result to path
+// keeping src's formatting. Nothing is written if fn fails or reports no change.
+func rewriteYAMLNode(path string, src []byte, doc *yaml.Node, fn func(root *yaml.Node) (bool, error)) error {
+	indent := detectYAMLIndent(src)
+	before, err := encodeYAMLNode(doc, indent)
+	if err != nil {
+		return err
+	}
+	if changed, err := fn(doc); err != nil || !changed {
+		return err
+	}
+	after, err := encodeYAMLNode(doc, indent)
+	if err != nil {
+		return err
+	}
+
+	return AtomicWrite(path, keepYAMLFormatting(src, before, after))
+}
+
+// parseYAMLNode parses src, read from path, into a document node, substituting an
+// empty mapping for an empty file.
+func parseYAMLNode(path string, src []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, fmt.Errorf("mdstore: %s: %w", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	return &doc, nil
+}
+
+// SetYAMLPath sets the value at a dotted path such as "server.port" in a yaml.Node
+// tree (a document node or its content), encoding value as yaml.Marshal would.
+// Missing mapping keys are created, as are mappings in place of empty values along
+// the way; numeric segments index existing sequence items ("tags.0"). Write `\.` for
+// a dot within a key. The replaced node's comments are kept, and so is its quoting
+// when a string replaces a string.
+func SetYAMLPath(root *yaml.Node, dotted string, value interface{}) error {
+	return setYAMLNodeKeys(root, splitYAMLPath(dotted), value)
+}
+
+// setYAMLNodeKeys is SetYAMLPath with the path already split into keys.
+func setYAMLNodeKeys(root *yaml.Node, keys []string, value interface{}) error {
+	if len(keys) == 0 {
+		return errors.New("mdstore: empty YAML path")
+	}
+	var v yaml.Node
+	if err := v.Encode(value); err != nil {
+		return err
+	}
+
+	node := yamlContentNode(root)
+	for i, key := range keys {
+		if isNullNode(node) {
+			node.Kind, node.Tag, node.Style, node.Value = yaml.MappingNode, "!!map", 0, ""
+		}
+
+		var child *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			child = yamlMappingValue(node, key)
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+			}
+		case yaml.SequenceNode:
+			idx, ok := yamlIndex(key, len(node.Content))
+			if !ok {
+				return fmt.Errorf("mdstore: YAML path %q: no item %q in sequence", joinYAMLPath(keys), key)
+			}
+			child = node.Content[idx]
+		default:
+			return fmt.Errorf("mdstore: YAML path %q: %q is not a mapping", joinYAMLPath(keys), joinYAMLPath(keys[:i]))
+		}
+		node = child
+	}
+
+	replaceYAMLNode(node, &v)
+	return nil
+}
+
+// deleteYAMLNodeKeys removes the mapping entry or sequence item at keys, reporting
+// whether there was one.
+func deleteYAMLNodeKeys(root *yaml.Node, keys []string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	node := yamlContentNode(root)
+	for _, key := range keys[:len(keys)-1] {
+		if node = yamlChild(node, key); node == nil {
+			return false
+		}
+	}
+
+	last := keys[len(keys)-1]
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == last {
+				node.Content = append(node.Content[:i], node.Content[i+2:]...)
+				return true
+			}
+		}
+	case yaml.SequenceNode:
+		if idx, ok := yamlIndex(last, len(node.Content)); ok {
+			node.Content = append(node.Content[:idx], node.Content[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// yamlChild returns the mapping value or sequence item for key, or nil.
+func yamlChild(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		return yamlMappingValue(node, key)
+	case yaml.SequenceNode:
+		if idx, ok := yamlIndex(key, len(node.Content)); ok {
+			return node.Content[idx]
+		}
+	}
+	return nil
+}
+
+// yamlIndex parses key as an index into a sequence of length n.
+func yamlIndex(key string, n int) (int, bool) {
+	idx, err := strconv.Atoi(key)
+	if err != nil || idx < 0 || idx >= n {
+		return 0, false
+	}
+	return idx, true
+}
+
+// yamlHasComments reports whether any node in the tree carries a comment.
+func yamlHasComments(node *yaml.Node) bool {
+	if node.HeadComment != "" || node.LineComment != "" || node.FootComment != "" {
+		return true
+	}
+	for _, child := range node.Content {
+		if yamlHasComments(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// yamlContentNode returns the root content of a document node, adding an empty
+// mapping if the document has none. Other nodes are returned unchanged.
+func yamlContentNode(root *yaml.Node) *yaml.Node {
+	if root.Kind != yaml.DocumentNode {
+		return root
+	}
+	if len(root.Content) == 0 {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+	}
+	return root.Content[0]
+}
+
+// yamlMappingValue returns the value node for key in a mapping node, or nil.
+func yamlMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// replaceYAMLNode overwrites dst with src, keeping dst's comments and, when both are
+// strings, its quoting style.
+func replaceYAMLNode(dst, src *yaml.Node) {
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	style := dst.Style
+	keepStyle := dst.Kind == yaml.ScalarNode && src.Kind == yaml.ScalarNode &&
+		dst.Tag == "!!str" && src.Tag == "!!str" && style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0
+
+	*dst = *src
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+	if keepStyle {
+		dst.Style = style
+	}
+}
+
+// encodeYAMLNode encodes a node tree with the given indentation.
+func encodeYAMLNode(node *yaml.Node, indent int) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(indent)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// detectYAMLIndent guesses the indentation step of a YAML file: the smallest nonzero
+// indentation of any content line, or yaml.Marshal's 4 if nothing is indented.
+func detectYAMLIndent(src []byte) int {
+	indent := 0
+	for _, line := range strings.Split(string(src), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed[0] == '#' {
+			continue
+		}
+		if n := len(line) - len(trimmed); n > 0 && (indent == 0 || n < indent) {
+			indent = n
+		}
+	}
+	if indent < 2 || indent > 9 {
+		return 4
+	}
+	return indent
+}
+
+// keepYAMLFormatting rewrites after, the encoding of an updated tree, in terms of src,
+// the file it was read from, given before, the encoding of the tree as read. Lines of
+// before that survive into after are emitted as they appear in src, and src's extra
+// blank lines are kept; only lines that changed take the encoder's formatting. If src
+// and before don't line up apart from indentation and blank lines, after is returned.
+func keepYAMLFormatting(src, before, after []byte) []byte {
+	if len(src) == 0 {
+		return after
+	}
+	a, b, c := splitLines(src), splitLines(before), splitLines(after)
+	if len(b)*len(c) > maxYAMLMergeCells {
+		return after
+	}
+
+	// Map each line of before to its line in src; src may only add blank lines
+	// and a leading document marker.
+	srcLine := make([]int, len(b))
+	j := 0
+	for i, line := range a {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case j < len(b) && trimmed == strings.TrimSpace(b[j]):
+			srcLine[j] = i
+			j++
+		case trimmed == "", trimmed == "---" && j == 0:
+		default:
+			return after
+		}
+	}
+	if j < len(b) {
+		return after
+	}
+
+	var out []string
+	next := 0 // next src line to consider
+	emitUpTo := func(i int) {
+		for ; next < i; next++ {
+			out = append(out, a[next]) // lines only src has
+		}
+	}
+	for _, op := range diffLines(b, c) {
+		switch op.kind {
+		case lineEqual:
+			emitUpTo(srcLine[op.b])
+			out = append(out, a[srcLine[op.b]])
+			next++
+		case lineDelete:
+			emitUpTo(srcLine[op.b])
+			next++
+		case lineInsert:
+			out = append(out, c[op.c])
+		}
+	}
+	emitUpTo(len(a))
+
+	return []byte(strings.Join(out, "\n") + "\n")
+}
+
+// splitLines splits text into lines without their terminators.
+func splitLines(data []byte) []string {
+	s := strings.TrimSuffix(string(data), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+type lineOpKind int
+
+const (
+	lineEqual lineOpKind = iota
+	lineDelete
+	lineInsert
+)
+
+// lineOp is one step of a line diff: b and c index the old and new lines.
+type lineOp struct {
+	kind lineOpKind
+	b, c int
+}
+
+// diffLines returns a shortest edit script turning b into c, via a longest common
+// subsequence table. Deletions are ordered before insertions at each change.
+func diffLines(b, c []string) []lineOp {
+	n, m := len(b), len(c)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if b[i] == c[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []lineOp
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && b[i] == c[j]:
+			ops = append(ops, lineOp{lineEqual, i, j})
+			i++
+			j++
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, lineOp{lineDelete, i, j})
+			i++
+		default:
+			ops = append(ops, lineOp{lineInsert, i, j})
+			j++
+		}
+	}
+	return ops
+}
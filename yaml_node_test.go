@@ -0,0 +1,198 @@
+// ABOUTME: Tests for comment-preserving YAML updates: UpdateYAMLNode and SetYAMLPath.
+// ABOUTME: Round-trips testdata/commented.yaml and checks that only the intended lines change.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// copyFixture copies a file from testdata into a temp dir and returns its path and content.
+func copyFixture(t *testing.T, name string) (string, string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("reading fixture failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path, string(data)
+}
+
+// changedLines returns the lines a line diff removes from before and adds in after.
+func changedLines(before, after string) (removed, added []string) {
+	b, a := splitLines([]byte(before)), splitLines([]byte(after))
+	for _, op := range diffLines(b, a) {
+		switch op.kind {
+		case lineDelete:
+			removed = append(removed, b[op.b])
+		case lineInsert:
+			added = append(added, a[op.c])
+		}
+	}
+	return removed, added
+}
+
+func readFileString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	return string(data)
+}
+
+func TestUpdateYAMLNode_NoopKeepsFile(t *testing.T) {
+	path, orig := copyFixture(t, "commented.yaml")
+
+	if err := UpdateYAMLNode(path, func(*yaml.Node) error { return nil }); err != nil {
+		t.Fatalf("UpdateYAMLNode failed: %v", err)
+	}
+	if got := readFileString(t, path); got != orig {
+		t.Errorf("no-op update changed the file:\n%s", got)
+	}
+}
+
+func TestUpdateYAMLNode_ChangesOnlyTargetLine(t *testing.T) {
+	path, orig := copyFixture(t, "commented.yaml")
+
+	err := UpdateYAMLNode(path, func(root *yaml.Node) error {
+		return SetYAMLPath(root, "server.port", 9090)
+	})
+	if err != nil {
+		t.Fatalf("UpdateYAMLNode failed: %v", err)
+	}
+
+	removed, added := changedLines(orig, readFileString(t, path))
+	if len(removed) != 1 || removed[0] != "  port: 8080" || len(added) != 1 || added[0] != "  port: 9090" {
+		t.Errorf("expected only the port line to change, removed %q, added %q", removed, added)
+	}
+}
+
+func TestUpdateYAMLNode_AddsKeyInPlace(t *testing.T) {
+	path, orig := copyFixture(t, "commented.yaml")
+
+	err := UpdateYAMLNode(path, func(root *yaml.Node) error {
+		return SetYAMLPath(root, "server.timeout", "5s")
+	})
+	if err != nil {
+		t.Fatalf("UpdateYAMLNode failed: %v", err)
+	}
+
+	got := readFileString(t, path)
+	removed, added := changedLines(orig, got)
+	if len(removed) != 0 || len(added) != 1 || added[0] != "  timeout: 5s" {
+		t.Errorf("expected one added line, removed %q, added %q", removed, added)
+	}
+	if !strings.Contains(got, "  port: 8080\n  timeout: 5s\n\n# storage settings") {
+		t.Errorf("new key should follow the last server key:\n%s", got)
+	}
+}
+
+func TestUpdateYAMLNode_KeepsQuotingAndComments(t *testing.T) {
+	path, orig := copyFixture(t, "commented.yaml")
+
+	err := UpdateYAMLNode(path, func(root *yaml.Node) error {
+		if err := SetYAMLPath(root, "storage.path", "/srv/data"); err != nil {
+			return err
+		}
+		return SetYAMLPath(root, "name", "renamed")
+	})
+	if err != nil {
+		t.Fatalf("UpdateYAMLNode failed: %v", err)
+	}
+
+	removed, added := changedLines(orig, readFileString(t, path))
+	want := []string{"name: renamed # inline comment", `  path: "/srv/data"`}
+	if len(removed) != 2 || strings.Join(added, "\n") != strings.Join(want, "\n") {
+		t.Errorf("removed %q, added %q; want added %q", removed, added, want)
+	}
+}
+
+func TestUpdateYAMLNode_ErrorLeavesFileUnchanged(t *testing.T) {
+	path, orig := copyFixture(t, "commented.yaml")
+
+	boom := errors.New("boom")
+	err := UpdateYAMLNode(path, func(root *yaml.Node) error {
+		SetYAMLPath(root, "name", "changed")
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	if got := readFileString(t, path); got != orig {
+		t.Errorf("file changed despite error")
+	}
+}
+
+func TestUpdateYAMLNode_MissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.yaml")
+
+	err := UpdateYAMLNode(path, func(root *yaml.Node) error {
+		return SetYAMLPath(root, "server.port", 8080)
+	})
+	if err != nil {
+		t.Fatalf("UpdateYAMLNode failed: %v", err)
+	}
+
+	var cfg struct {
+		Server struct {
+			Port int `yaml:"port"`
+		} `yaml:"server"`
+	}
+	if err := ReadYAML(path, &cfg); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if cfg.Server.Port != 8080 {
+		t.Errorf("got port %d, want 8080", cfg.Server.Port)
+	}
+}
+
+func TestSetYAMLPath(t *testing.T) {
+	var root yaml.Node
+	src := "a:\n  b: 1\nempty:\nlist: [x, y]\nscalar: 3\n"
+	if err := yaml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		path  string
+		value interface{}
+	}{
+		{"a.b", 2},
+		{"a.c.d", "deep"},
+		{"empty.key", true},
+		{"list.1", "z"},
+	} {
+		if err := SetYAMLPath(&root, tc.path, tc.value); err != nil {
+			t.Errorf("SetYAMLPath(%q) failed: %v", tc.path, err)
+		}
+	}
+	for _, bad := range []string{"", "scalar.x", "list.5", "list.name"} {
+		if err := SetYAMLPath(&root, bad, 1); err == nil {
+			t.Errorf("SetYAMLPath(%q) should fail", bad)
+		}
+	}
+
+	var got map[string]interface{}
+	if err := root.Decode(&got); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	a := got["a"].(map[string]interface{})
+	if a["b"] != 2 || a["c"].(map[string]interface{})["d"] != "deep" {
+		t.Errorf("unexpected a: %v", a)
+	}
+	if got["empty"].(map[string]interface{})["key"] != true {
+		t.Errorf("unexpected empty: %v", got["empty"])
+	}
+	if list := got["list"].([]interface{}); list[1] != "z" {
+		t.Errorf("unexpected list: %v", list)
+	}
+}
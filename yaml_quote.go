@@ -0,0 +1,72 @@
+// ABOUTME: Double-quoting of string values that other YAML parsers would read as another type, or trip over.
+// ABOUTME: Backs YAMLOptions.QuoteAmbiguousStrings, setting node styles on a copy of the tree being written.
+package mdstore
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yaml11Number matches what YAML 1.1 parsers read as a number: integers in any base,
+// with underscores or base 60 ("1:20"), floats, infinity, and NaN. yaml.v3 reads some
+// of these, such as "007" or "0b101", as strings.
+var yaml11Number = regexp.MustCompile(`^[-+]?(?:[0-9][0-9_]*(?::[0-5]?[0-9])*(?:\.[0-9_]*)?(?:[eE][-+]?[0-9]+)?|\.[0-9_]+(?:[eE][-+]?[0-9]+)?|0[bB][01_]+|0[oO][0-7_]+|0[xX][0-9a-fA-F_]+|\.(?:inf|Inf|INF|nan|NaN|NAN))$`)
+
+// yaml11Date matches the start of what YAML 1.1 parsers read as a timestamp.
+var yaml11Date = regexp.MustCompile(`^[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}`)
+
+// quoteAmbiguousStrings returns a copy of the tree at node in which the string values
+// ambiguousYAMLString picks out, in mappings and sequences, are double-quoted. Keys
+// are left as they are. A "<<" value, which yaml.v3 tags as a merge key wherever it is,
+// is retagged as the string it is.
+func quoteAmbiguousStrings(node *yaml.Node) *yaml.Node {
+	out := *node
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!merge" {
+		out.Tag = "!!str"
+	}
+	if out.Kind == yaml.ScalarNode && out.ShortTag() == "!!str" && ambiguousYAMLString(out.Value) {
+		out.Style = yaml.DoubleQuotedStyle
+	}
+	if len(node.Content) > 0 {
+		out.Content = make([]*yaml.Node, len(node.Content))
+		for i, child := range node.Content {
+			if node.Kind == yaml.MappingNode && i%2 == 0 {
+				out.Content[i] = child
+				continue
+			}
+			out.Content[i] = quoteAmbiguousStrings(child)
+		}
+	}
+	return &out
+}
+
+// ambiguousYAMLString reports whether s, a single-line string, would be read back as
+// something else if written plain by a YAML 1.1 or 1.2 parser, as "yes", "~", "007",
+// or "2024-01-15" would, or needs quoting some parsers get wrong: an empty string, or
+// one with an indicator character at its start ("- x", "? x", "@x"), a ": " or " #"
+// inside, a tab, or a space at either end. Multi-line strings are written as blocks,
+// and don't count.
+func ambiguousYAMLString(s string) bool {
+	if strings.Contains(s, "\n") {
+		return false
+	}
+	if s == "" || (&yaml.Node{Kind: yaml.ScalarNode, Value: s}).ShortTag() != "!!str" {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "y", "n", "yes", "no", "on", "off", "=", "<<":
+		return true
+	}
+	if yaml11Number.MatchString(s) || yaml11Date.MatchString(s) {
+		return true
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	last, _ := utf8.DecodeLastRuneInString(s)
+	return strings.ContainsRune("-?:,[]{}#&*!|>'\"%@`", first) ||
+		unicode.IsSpace(first) || unicode.IsSpace(last) ||
+		strings.Contains(s, "\t") || strings.Contains(s, ": ") || strings.HasSuffix(s, ":") || strings.Contains(s, " #")
+}
@@ -0,0 +1,138 @@
+// ABOUTME: Tests for YAMLOptions.QuoteAmbiguousStrings: a matrix of strings that must round-trip as strings.
+// ABOUTME: Covers WriteYAMLOpts and RenderFrontmatterOpts, lists and nested maps, keys, and node input.
+package mdstore
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ambiguousStrings are read back as something other than the string they are, or
+// mishandled by some parser, if written plain.
+var ambiguousStrings = []string{
+	"", " ", "yes", "No", "ON", "off", "y", "n", "true", "False", "null", "Null", "~",
+	"3", "3.0", "-1", "+12", "1e3", "007", "0o17", "0x1F", "0b101", "1_000", "1:20",
+	".inf", "-.Inf", ".nan", "2024-01-15", "2024-1-5", "2024-01-15T10:00:00Z",
+	"2024-01-15 10:00:00", "=", "<<", "- item", "? key", ": x", "#tag", "&anchor",
+	"*alias", "!tag", "|", ">", "'quoted'", `"quoted"`, "%percent", "@handle", "`code`",
+	"[a]", "{a}", ",", "a: b", "a #b", "ends:", " padded", "padded ", "tab\there",
+}
+
+func TestQuoteAmbiguousStrings_RoundTrip(t *testing.T) {
+	meta := map[string]interface{}{}
+	for i, s := range ambiguousStrings {
+		meta["k"+string(rune('a'+i/26))+string(rune('a'+i%26))] = s
+	}
+	opts := YAMLOptions{QuoteAmbiguousStrings: true}
+
+	out, err := RenderFrontmatterOpts(meta, "Body\n", opts)
+	if err != nil {
+		t.Fatalf("RenderFrontmatterOpts failed: %v", err)
+	}
+	got, _, err := ParseFrontmatterAs[map[string]interface{}](out)
+	if err != nil {
+		t.Fatalf("parse failed: %v\n%s", err, out)
+	}
+	if !reflect.DeepEqual(got, meta) {
+		t.Errorf("frontmatter didn't round-trip:\n%s", out)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if _, value, ok := strings.Cut(line, ": "); ok && !strings.HasPrefix(value, `"`) {
+			t.Errorf("not double-quoted: %s", line)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "meta.yaml")
+	if err := WriteYAMLOpts(path, meta, opts); err != nil {
+		t.Fatalf("WriteYAMLOpts failed: %v", err)
+	}
+	got = nil
+	if err := ReadYAML(path, &got); err != nil {
+		t.Fatalf("ReadYAML failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, meta) {
+		t.Errorf("file didn't round-trip:\n%s", readFileString(t, path))
+	}
+}
+
+func TestQuoteAmbiguousStrings_Output(t *testing.T) {
+	type post struct {
+		Title string            `yaml:"title"`
+		Slug  string            `yaml:"slug"`
+		Count int               `yaml:"count"`
+		Draft bool              `yaml:"draft"`
+		Tags  []string          `yaml:"tags"`
+		Extra map[string]string `yaml:"extra"`
+		Notes string            `yaml:"notes"`
+	}
+	p := post{
+		Title: "hello world",
+		Slug:  "no",
+		Count: 3,
+		Draft: true,
+		Tags:  []string{"go", "null", "1.0"},
+		Extra: map[string]string{"yes": "on", "plain": "text"},
+		Notes: "line one\nline two",
+	}
+
+	out, err := RenderFrontmatterOpts(p, "", YAMLOptions{QuoteAmbiguousStrings: true})
+	if err != nil {
+		t.Fatalf("RenderFrontmatterOpts failed: %v", err)
+	}
+	// Only ambiguous strings are quoted, and keys keep yaml.v3's own quoting.
+	want := "---\ntitle: hello world\nslug: \"no\"\ncount: 3\ndraft: true\ntags:\n    - go\n    - \"null\"\n    - \"1.0\"\n" +
+		"extra:\n    plain: text\n    \"yes\": \"on\"\nnotes: |-\n    line one\n    line two\n---\n"
+	if out != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out, want)
+	}
+
+	back, _, err := ParseFrontmatterAs[post](out)
+	if err != nil || !reflect.DeepEqual(back, p) {
+		t.Errorf("round trip = %+v, %v", back, err)
+	}
+}
+
+func TestQuoteAmbiguousStrings_Node(t *testing.T) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("a: 'yes'\nb: [~, x]\nc: 1\n"), &node); err != nil {
+		t.Fatal(err)
+	}
+	before := encodeNodeForTest(t, &node)
+
+	out, err := RenderFrontmatterOpts(&node, "", YAMLOptions{QuoteAmbiguousStrings: true})
+	if err != nil {
+		t.Fatalf("RenderFrontmatterOpts failed: %v", err)
+	}
+	if want := "---\na: \"yes\"\nb: [~, x]\nc: 1\n---\n"; out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+	if after := encodeNodeForTest(t, &node); after != before {
+		t.Errorf("node modified:\n%s\nwas:\n%s", after, before)
+	}
+}
+
+func encodeNodeForTest(t *testing.T, node *yaml.Node) string {
+	t.Helper()
+	out, err := yaml.Marshal(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestAmbiguousYAMLString(t *testing.T) {
+	for _, s := range ambiguousStrings {
+		if !ambiguousYAMLString(s) {
+			t.Errorf("%q should be ambiguous", s)
+		}
+	}
+	for _, s := range []string{"hello", "hello world", "go-lang", "v1.2.3", "a:b", "C#", "e-mail", "nope", "yesterday", "12 apples", "multi\nline: yes"} {
+		if ambiguousYAMLString(s) {
+			t.Errorf("%q shouldn't be ambiguous", s)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// ABOUTME: Size-capped YAML list files that roll over into timestamped archives alongside them.
+// ABOUTME: Provides AppendYAMLRotating, ListRotated, ReadAllRotated, and the archive naming shared with RotateJSONL.
+package mdstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// rotatedStampLayout is the timestamp in an archive name: UTC, to the nanosecond with
+// trailing zeros kept, so every stamp has the same width and archive names sort in the
+// order they were made. Dashes stand in for colons, for names valid on every platform.
+const rotatedStampLayout = "2006-01-02T15-04-05.000000000Z"
+
+// RotateOptions sets the limits for AppendYAMLRotating. Zero limits are unset.
+type RotateOptions struct {
+	// MaxItems is the most items the live file holds.
+	MaxItems int
+	// MaxBytes is the largest the live file grows to, unless a single item is larger.
+	MaxBytes int64
+	// Compress gzips archives, naming them like events.<timestamp>.yaml.gz.
+	Compress bool
+}
+
+// AppendYAMLRotating appends item to the YAML list file at path like AppendYAML,
+// unless that would take the file past opts.MaxItems or opts.MaxBytes: then the file
+// is first moved to a timestamped archive alongside it (named like RotateJSONL's, and
+// gzipped if opts.Compress is set) and a fresh file is started with item. It runs
+// under WithLock on path's directory, so no item is lost or duplicated mid-rotation.
+// If T implements Validator, item must pass.
+func AppendYAMLRotating[T any](path string, item T, opts RotateOptions) error {
+	if err := validate(path, item); err != nil {
+		return err
+	}
+
+	return WithLock(filepath.Dir(path), func() error {
+		var items []T
+		if _, _, err := readYAMLFile(path, &items); err != nil {
+			return err
+		}
+
+		rotate := opts.MaxItems > 0 && len(items) >= opts.MaxItems
+		data, err := marshalYAML(append(items, item), YAMLOptions{})
+		if err != nil {
+			return err
+		}
+		if !rotate && opts.MaxBytes > 0 && len(items) > 0 && int64(len(data)) > opts.MaxBytes {
+			rotate = true
+		}
+
+		if rotate {
+			if err := rotateYAML(path, opts.Compress); err != nil {
+				return err
+			}
+			if data, err = marshalYAML([]T{item}, YAMLOptions{}); err != nil {
+				return err
+			}
+		}
+		return AtomicWrite(path, data)
+	})
+}
+
+// rotateYAML moves the file at path to a new archive, gzipping it if compress is set.
+// The caller must hold the lock on path's directory.
+func rotateYAML(path string, compress bool) error {
+	archive := rotatedName(path)
+	if err := os.Rename(path, archive); err != nil {
+		return err
+	}
+	if !compress {
+		return nil
+	}
+
+	// Compress after the rename, so the live file is never lost or left in place. If
+	// this is interrupted, ListRotated prefers the plain archive over a leftover .gz.
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := AtomicWrite(archive+".gz", buf.Bytes()); err != nil {
+		return err
+	}
+	return os.Remove(archive)
+}
+
+// rotatedName returns a free archive name for path: events.yaml becomes
+// events.2026-02-05T10-04-05.123456789Z.yaml, the current time formatted with
+// rotatedStampLayout. If an archive for that instant exists (compressed or not), the
+// time moves on by a nanosecond, keeping names in rotation order. The caller must hold
+// the lock on path's directory.
+func rotatedName(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for t := now().UTC(); ; t = t.Add(time.Nanosecond) {
+		name := base + "." + t.Format(rotatedStampLayout) + ext
+		if !fileExists(name) && !fileExists(name+".gz") {
+			return name
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// ListRotated returns the archives of path made by AppendYAMLRotating or RotateJSONL,
+// compressed or not, oldest first, which is the order of their names. Files alongside
+// path that don't parse as archive names are ignored. A missing directory yields none.
+func ListRotated(path string) ([]string, error) {
+	dir := filepath.Dir(path)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	ext := filepath.Ext(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), ext) + "."
+	var names []string
+	plain := make(map[string]bool)
+	for _, e := range entries {
+		name := e.Name()
+		stamp, ok := strings.CutPrefix(name, prefix)
+		if !ok || e.IsDir() {
+			continue
+		}
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		if stamp, ok = strings.CutSuffix(stamp, ext); !ok {
+			continue
+		}
+		if _, err := time.Parse(rotatedStampLayout, stamp); err != nil {
+			continue
+		}
+		if !strings.HasSuffix(name, ".gz") {
+			plain[name] = true
+		}
+		names = append(names, name)
+	}
+
+	var paths []string
+	for _, name := range names {
+		if strings.HasSuffix(name, ".gz") && plain[strings.TrimSuffix(name, ".gz")] {
+			continue // interrupted compression; the plain archive is the one kept
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	return paths, nil
+}
+
+// isRotatedArchive reports whether the file name looks like an archive made by
+// AppendYAMLRotating or RotateJSONL, whatever file it was rotated from.
+func isRotatedArchive(name string) bool {
+	name = strings.TrimSuffix(name, ".gz")
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	n := len(rotatedStampLayout)
+	if len(stem) <= n || stem[len(stem)-n-1] != '.' {
+		return false
+	}
+	_, err := time.Parse(rotatedStampLayout, stem[len(stem)-n:])
+	return err == nil
+}
+
+// ReadAllRotated reads the items of every archive of the YAML list file at path,
+// oldest first, followed by those of the live file. Gzipped archives are decompressed.
+// Each file, and each archive decompressed, is held to the size limit (see
+// SetMaxYAMLSize), failing with a *FileTooLargeError. It takes no lock, so it works
+// under a read-only root (see SetReadOnly); instead, if the archives change while it
+// reads, as a concurrent rotation makes them, it reads them again, so it never skips
+// or repeats items. If T implements Validator, every item must pass.
+func ReadAllRotated[T any](path string) ([]T, error) {
+	for {
+		archives, err := ListRotated(path)
+		if err != nil {
+			return nil, err
+		}
+		all, complete, err := readAllRotatedOnce[T](path, archives)
+		if err != nil {
+			return nil, err
+		}
+		if !complete {
+			continue
+		}
+		after, err := ListRotated(path)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Equal(archiveStamps(archives), archiveStamps(after)) {
+			return all, nil
+		}
+	}
+}
+
+// readAllRotatedOnce reads the items of archives, then of the live file at path. It
+// reports false if an archive is gone, removed by a rotation since they were listed.
+// A missing live file holds no items.
+func readAllRotatedOnce[T any](path string, archives []string) ([]T, bool, error) {
+	var all []T
+	for _, archive := range archives {
+		items, err := readRotatedYAML[T](archive)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		all = append(all, items...)
+	}
+	items, err := readRotatedYAML[T](path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, err
+	}
+	return append(all, items...), true, nil
+}
+
+// archiveStamps returns archives, paths from ListRotated, less any .gz suffix, so
+// compressing an archive doesn't change them.
+func archiveStamps(archives []string) []string {
+	stamps := make([]string, len(archives))
+	for i, archive := range archives {
+		stamps[i] = strings.TrimSuffix(archive, ".gz")
+	}
+	return stamps
+}
+
+// readRotatedYAML reads the YAML list file at path, gunzipping it if its name ends in
+// .gz. The file, and a gzipped one decompressed, are held to the size limit (see
+// SetMaxYAMLSize).
+func readRotatedYAML[T any](path string) ([]T, error) {
+	limit := currentMaxYAMLSize()
+	data, err := readFileMax(path, limit)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err == nil {
+			// Read one byte past the limit, so a gzip bomb is stopped there.
+			data, err = io.ReadAll(io.LimitReader(zr, limit+1))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mdstore: %s: %w", path, err)
+		}
+		if int64(len(data)) > limit {
+			return nil, &FileTooLargeError{Path: path, Size: int64(len(data)), Limit: limit}
+		}
+	}
+
+	var items []T
+	if _, err := decodeYAMLData(path, data, &items); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err := validate(path, item); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
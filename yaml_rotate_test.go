@@ -0,0 +1,297 @@
+// ABOUTME: Tests for AppendYAMLRotating, ListRotated, and ReadAllRotated.
+// ABOUTME: Pins the clock so archive names are predictable, and checks rotation under concurrent appends.
+package mdstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/harperreed/mdstore/internal/clocktest"
+)
+
+func rotateClock(t *testing.T) *clocktest.Clock {
+	t.Helper()
+	clock := clocktest.New(time.Date(2026, 2, 5, 10, 4, 5, 0, time.UTC))
+	SetClock(clock)
+	t.Cleanup(func() { SetClock(nil) })
+	return clock
+}
+
+func appendRotating(t *testing.T, path string, opts RotateOptions, items ...testItem) {
+	t.Helper()
+	for _, item := range items {
+		if err := AppendYAMLRotating(path, item, opts); err != nil {
+			t.Fatalf("AppendYAMLRotating(%+v) failed: %v", item, err)
+		}
+	}
+}
+
+func itemNames(items []testItem) string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func TestAppendYAMLRotating_MaxItems(t *testing.T) {
+	clock := rotateClock(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "activity.yaml")
+	opts := RotateOptions{MaxItems: 2}
+
+	appendRotating(t, path, opts, testItem{Name: "a"}, testItem{Name: "b"})
+	clock.Advance(time.Second)
+	appendRotating(t, path, opts, testItem{Name: "c"}, testItem{Name: "d"})
+	clock.Advance(1500 * time.Millisecond)
+	appendRotating(t, path, opts, testItem{Name: "e"})
+
+	archives, err := ListRotated(path)
+	if err != nil {
+		t.Fatalf("ListRotated failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "activity.2026-02-05T10-04-06.000000000Z.yaml"),
+		filepath.Join(dir, "activity.2026-02-05T10-04-07.500000000Z.yaml"),
+	}
+	if strings.Join(archives, "\n") != strings.Join(want, "\n") {
+		t.Errorf("archives:\n%s\nwant:\n%s", strings.Join(archives, "\n"), strings.Join(want, "\n"))
+	}
+
+	var live []testItem
+	if err := ReadYAML(path, &live); err != nil || itemNames(live) != "e" {
+		t.Errorf("live file = %v, %v; want only e", live, err)
+	}
+	all, err := ReadAllRotated[testItem](path)
+	if err != nil || itemNames(all) != "a,b,c,d,e" {
+		t.Errorf("ReadAllRotated = %v, %v; want a through e in order", all, err)
+	}
+}
+
+func TestAppendYAMLRotating_MaxBytes(t *testing.T) {
+	rotateClock(t)
+	path := filepath.Join(t.TempDir(), "activity.yaml")
+	opts := RotateOptions{MaxBytes: 64}
+	big := testItem{Name: strings.Repeat("x", 100)}
+
+	// An item larger than MaxBytes still goes in, alone.
+	appendRotating(t, path, opts, testItem{Name: "a"}, testItem{Name: "b"}, big, testItem{Name: "c"})
+
+	archives, err := ListRotated(path)
+	if err != nil || len(archives) != 2 {
+		t.Fatalf("expected 2 archives, got %v, %v", archives, err)
+	}
+	for _, archive := range append(archives, path) {
+		if info, err := os.Stat(archive); err != nil {
+			t.Fatal(err)
+		} else if info.Size() > opts.MaxBytes && !strings.Contains(readFileString(t, archive), big.Name) {
+			t.Errorf("%s is %d bytes, over MaxBytes", filepath.Base(archive), info.Size())
+		}
+	}
+	all, err := ReadAllRotated[testItem](path)
+	if err != nil || len(all) != 4 || all[2] != big || all[3].Name != "c" {
+		t.Errorf("ReadAllRotated = %v, %v", all, err)
+	}
+}
+
+func TestAppendYAMLRotating_Compress(t *testing.T) {
+	rotateClock(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "activity.yaml")
+	opts := RotateOptions{MaxItems: 1, Compress: true}
+
+	// The pinned clock makes every rotation want the same name.
+	appendRotating(t, path, opts, testItem{Name: "a"}, testItem{Name: "b"}, testItem{Name: "c"})
+
+	archives, err := ListRotated(path)
+	if err != nil {
+		t.Fatalf("ListRotated failed: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "activity.2026-02-05T10-04-05.000000000Z.yaml.gz"),
+		filepath.Join(dir, "activity.2026-02-05T10-04-05.000000001Z.yaml.gz"),
+	}
+	if strings.Join(archives, "\n") != strings.Join(want, "\n") {
+		t.Errorf("archives:\n%s\nwant:\n%s", strings.Join(archives, "\n"), strings.Join(want, "\n"))
+	}
+	if data := readFileString(t, archives[0]); !strings.HasPrefix(data, "\x1f\x8b") {
+		t.Errorf("archive should be gzipped, got %q", data)
+	}
+
+	all, err := ReadAllRotated[testItem](path)
+	if err != nil || itemNames(all) != "a,b,c" {
+		t.Errorf("ReadAllRotated = %v, %v; want a,b,c", all, err)
+	}
+}
+
+func TestReadAllRotated_SizeLimit(t *testing.T) {
+	setMaxYAMLSize(t, 4096)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "activity.yaml")
+
+	// A small archive that decompresses far past the limit fails without being read whole.
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(strings.Repeat("- name: x\n", 100_000)))
+	zw.Close()
+	if buf.Len() > 4096 {
+		t.Fatalf("fixture compressed to %d bytes, want it under the limit", buf.Len())
+	}
+	archive := filepath.Join(dir, "activity.2026-02-05T10-04-05.000000000Z.yaml.gz")
+	writeFileString(t, archive, buf.String())
+
+	_, err := ReadAllRotated[testItem](path)
+	if tooLarge := asFileTooLarge(t, err); tooLarge.Path != archive || tooLarge.Limit != 4096 || tooLarge.Size != 4097 {
+		t.Errorf("got %+v", tooLarge)
+	}
+
+	// Plain archives and the live file are held to it too.
+	if err := os.Remove(archive); err != nil {
+		t.Fatal(err)
+	}
+	writeFileString(t, path, strings.Repeat("- name: x\n", 500))
+	_, err = ReadAllRotated[testItem](path)
+	asFileTooLarge(t, err)
+}
+
+func TestReadAllRotated_ReadOnly(t *testing.T) {
+	rotateClock(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "activity.yaml")
+	appendRotating(t, path, RotateOptions{MaxItems: 1}, testItem{Name: "a"}, testItem{Name: "b"})
+	if err := os.Remove(filepath.Join(dir, ".lock")); err != nil {
+		t.Fatal(err)
+	}
+	useReadOnly(t, dir)
+
+	all, err := ReadAllRotated[testItem](path)
+	if err != nil || itemNames(all) != "a,b" {
+		t.Errorf("ReadAllRotated = %v, %v; want a,b", all, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".lock")); !os.IsNotExist(err) {
+		t.Errorf("reading made a lock file: %v", err)
+	}
+}
+
+func TestReadAllRotated_DuringRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "activity.yaml")
+	opts := RotateOptions{MaxItems: 3, Compress: true}
+
+	const n = 60
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			if err := AppendYAMLRotating(path, testItem{Name: "item", Value: i}, opts); err != nil {
+				t.Errorf("AppendYAMLRotating failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	// Every read sees the items appended so far, each once and in order.
+	for reading := true; reading; {
+		select {
+		case <-done:
+			reading = false
+		default:
+		}
+		all, err := ReadAllRotated[testItem](path)
+		if err != nil {
+			t.Fatalf("ReadAllRotated failed: %v", err)
+		}
+		for i, item := range all {
+			if item.Value != i {
+				t.Fatalf("read %d items, item %d is %d", len(all), i, item.Value)
+			}
+		}
+		if !reading && len(all) != n {
+			t.Errorf("read %d items after the appends, want %d", len(all), n)
+		}
+	}
+}
+
+func TestListRotated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.yaml")
+	for _, name := range []string{
+		"events.yaml",
+		"events.2026-02-05T10-04-05.500000000Z.yaml",
+		"events.2026-02-05T10-04-05.250000000Z.yaml.gz",
+		"events.2026-02-05T10-04-05.000000000Z.yaml",
+		"events.2026-02-05T10-04-06.000000000Z.yaml",
+		"events.2026-02-05T10-04-06.000000000Z.yaml.gz", // compression interrupted: plain one wins
+		"events.2026-02-05T10-04-06.000000000Z.yaml-copy",
+		"events.2026-02-05T10-04-07.000000000Z.jsonl",
+		"events.2026-02-05T10-04-08Z.yaml", // not fixed-width
+		"events.backup.yaml",
+		"other.2026-02-05T10-04-05.000000000Z.yaml",
+	} {
+		writeFileString(t, filepath.Join(dir, name), "")
+	}
+
+	got, err := ListRotated(path)
+	if err != nil {
+		t.Fatalf("ListRotated failed: %v", err)
+	}
+	var names []string
+	for _, p := range got {
+		names = append(names, filepath.Base(p))
+	}
+	want := "events.2026-02-05T10-04-05.000000000Z.yaml events.2026-02-05T10-04-05.250000000Z.yaml.gz " +
+		"events.2026-02-05T10-04-05.500000000Z.yaml events.2026-02-05T10-04-06.000000000Z.yaml"
+	if strings.Join(names, " ") != want {
+		t.Errorf("got  %s\nwant %s", strings.Join(names, " "), want)
+	}
+
+	// RotateJSONL archives are listed the same way.
+	jsonl, err := ListRotated(filepath.Join(dir, "events.jsonl"))
+	if err != nil || len(jsonl) != 1 || filepath.Base(jsonl[0]) != "events.2026-02-05T10-04-07.000000000Z.jsonl" {
+		t.Errorf("JSONL archives = %v, %v", jsonl, err)
+	}
+
+	if got, err := ListRotated(filepath.Join(dir, "missing", "events.yaml")); err != nil || got != nil {
+		t.Errorf("missing directory: %v, %v", got, err)
+	}
+}
+
+func TestAppendYAMLRotating_Concurrent(t *testing.T) {
+	rotateClock(t)
+	path := filepath.Join(t.TempDir(), "activity.yaml")
+	opts := RotateOptions{MaxItems: 3}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := AppendYAMLRotating(path, testItem{Name: "item", Value: i}, opts); err != nil {
+				t.Errorf("AppendYAMLRotating failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	all, err := ReadAllRotated[testItem](path)
+	if err != nil {
+		t.Fatalf("ReadAllRotated failed: %v", err)
+	}
+	seen := make(map[int]bool)
+	for _, item := range all {
+		seen[item.Value] = true
+	}
+	if len(all) != n || len(seen) != n {
+		t.Errorf("got %d items (%d distinct), want %d", len(all), len(seen), n)
+	}
+	archives, _ := ListRotated(path)
+	if len(archives) != (n-1)/opts.MaxItems {
+		t.Errorf("got %d archives, want %d", len(archives), (n-1)/opts.MaxItems)
+	}
+}
@@ -0,0 +1,193 @@
+// ABOUTME: Streaming decode of large YAML list files and doc streams, one item at a time.
+// ABOUTME: Provides DecodeYAMLSeq and the ErrStop sentinel for ending iteration early.
+package mdstore
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrStop can be returned from a DecodeYAMLSeq or DecodeYAMLDocs callback to end
+// iteration early. The decode function then returns nil.
+var ErrStop = errors.New("mdstore: stop iteration")
+
+// DecodeYAMLSeq calls fn with each item of the YAML file at path, in order: the
+// elements of a top-level list (as written by AppendYAML), or the documents of a doc
+// stream (as written by AppendYAMLDoc), where a document that is itself a list
+// contributes its elements. Empty documents are skipped and a missing file is not an
+// error. Iteration stops at the first error from fn, which is returned, except for
+// ErrStop, which ends iteration and returns nil. Malformed YAML returns a *YAMLError
+// with the line in the file, not in the item.
+//
+// A block-style top-level list is split into items by line and each item is parsed
+// on its own, so memory stays proportional to the largest item rather than the file.
+// The price is that an alias can't refer to an anchor in an earlier item. Documents
+// that aren't block lists (mappings, flow lists, scalars) are parsed whole.
+func DecodeYAMLSeq[T any](path string, fn func(item T) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	err = splitYAMLSeq(bufio.NewReader(f), func(chunk []byte, line int) error {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(chunk, &doc); err != nil {
+			return newYAMLError(path, err, line)
+		}
+		if doc.Kind == 0 {
+			return nil
+		}
+		if err := checkYAMLNodeAliases(path, &doc, line); err != nil {
+			return err
+		}
+		items := doc.Content
+		switch root := doc.Content[0]; {
+		case root.Kind == yaml.ScalarNode && root.Tag == "!!null":
+			// An empty or null document, like an empty file for ReadYAML.
+			return nil
+		case root.Kind == yaml.SequenceNode:
+			items = root.Content
+		}
+		for _, node := range items {
+			var item T
+			if err := node.Decode(&item); err != nil {
+				return newYAMLError(path, err, line)
+			}
+			if err := validate(path, item); err != nil {
+				return err
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrStop) {
+		return nil
+	}
+	return err
+}
+
+// Modes of splitYAMLSeq within a document.
+const (
+	seqModeStart = iota // before the document's first content line
+	seqModeList         // in a block list, one chunk per item
+	seqModeDoc          // in any other document, one chunk for the whole document
+)
+
+// splitYAMLSeq reads YAML from r and calls emit with chunks that each parse on their
+// own: a single item of a block-style top-level list, or a whole document otherwise.
+// line is the 1-based line of the chunk's first line in r. The chunk buffer is reused
+// between calls.
+func splitYAMLSeq(r *bufio.Reader, emit func(chunk []byte, line int) error) error {
+	var (
+		chunk      []byte
+		chunkLine  int
+		mode       = seqModeStart
+		listIndent int
+		line       []byte
+	)
+	flush := func() error {
+		mode = seqModeStart
+		if len(chunk) == 0 {
+			return nil
+		}
+		err := emit(chunk, chunkLine)
+		chunk = chunk[:0]
+		return err
+	}
+	start := func(l []byte, n int) {
+		chunk = append(chunk[:0], l...)
+		chunkLine = n
+	}
+
+	for n := 1; ; n++ {
+		var err error
+		line, err = readYAMLLine(r, line[:0])
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				return flush()
+			}
+			return err
+		}
+
+		text := bytes.TrimRight(line, "\r\n")
+		indent := len(text) - len(bytes.TrimLeft(text, " "))
+		rest := text[indent:]
+
+		switch {
+		case indent == 0 && isYAMLMarker(rest, "---"):
+			// A "---" right after directives belongs to their document.
+			if mode == seqModeDoc && !bytes.Contains(chunk, []byte("\n---")) && chunk[0] == '%' {
+				chunk = append(chunk, line...)
+				continue
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+			if after := bytes.TrimSpace(rest[3:]); len(after) > 0 && after[0] != '#' {
+				mode = seqModeDoc
+				start(line, n)
+			}
+		case indent == 0 && isYAMLMarker(rest, "..."):
+			if err := flush(); err != nil {
+				return err
+			}
+		case mode == seqModeStart:
+			switch {
+			case len(rest) == 0 || rest[0] == '#':
+				// Comments and blank lines between documents carry nothing.
+			case isYAMLListItem(rest):
+				mode, listIndent = seqModeList, indent
+				start(line, n)
+			default:
+				mode = seqModeDoc
+				start(line, n)
+			}
+		case mode == seqModeList && indent == listIndent && isYAMLListItem(rest):
+			if err := flush(); err != nil {
+				return err
+			}
+			mode = seqModeList
+			start(line, n)
+		default:
+			chunk = append(chunk, line...)
+		}
+
+		if err == io.EOF {
+			return flush()
+		}
+	}
+}
+
+// readYAMLLine appends the next line of r, including its newline, to buf.
+func readYAMLLine(r *bufio.Reader, buf []byte) ([]byte, error) {
+	for {
+		part, err := r.ReadSlice('\n')
+		buf = append(buf, part...)
+		if err != bufio.ErrBufferFull {
+			return buf, err
+		}
+	}
+}
+
+// isYAMLMarker reports whether text is the document marker m ("---" or "..."),
+// alone or followed by whitespace.
+func isYAMLMarker(text []byte, m string) bool {
+	return bytes.HasPrefix(text, []byte(m)) && (len(text) == 3 || text[3] == ' ' || text[3] == '\t')
+}
+
+// isYAMLListItem reports whether text (with indentation removed) starts a block list entry.
+func isYAMLListItem(text []byte) bool {
+	return len(text) > 0 && text[0] == '-' && (len(text) == 1 || text[1] == ' ' || text[1] == '\t')
+}
@@ -0,0 +1,143 @@
+// ABOUTME: Tests for DecodeYAMLSeq: list files, doc streams, early stop, and error positions.
+// ABOUTME: Checks that item splitting matches a whole-file decode on tricky block layouts.
+package mdstore
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// decodeSeqAll collects every item DecodeYAMLSeq yields from content.
+func decodeSeqAll[T any](t *testing.T, content string) ([]T, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "items.yaml")
+	writeFileString(t, path, content)
+
+	var items []T
+	err := DecodeYAMLSeq(path, func(item T) error {
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+func TestDecodeYAMLSeq_MatchesReadYAML(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"scalars", "- a\n- b\n- c\n"},
+		{"mappings", "- name: a\n  value: 1\n- name: b\n  value: 2\n"},
+		{"indented list", "  - a\n  - b\n"},
+		{"comments", "# header\n- a # inline\n# between\n\n- b\n# trailer\n"},
+		{"nested lists", "- - a\n  - b\n- - c\n"},
+		{"block scalar with dashes", "- |\n  - not an item\n  -also not\n- b\n"},
+		{"zero-indent nested list", "- tags:\n  - x\n  - y\n- tags: []\n"},
+		{"flow list", "[a, b, {c: d}]\n"},
+		{"multi-line flow item", "- [a,\n   b]\n- c\n"},
+		{"bare dash", "-\n- b\n"},
+		{"crlf", "- a\r\n- b\r\n"},
+		{"no trailing newline", "- a\n- b"},
+		{"anchor within item", "- &x {k: v}\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "want.yaml")
+			writeFileString(t, path, tc.content)
+			var want []interface{}
+			if err := ReadYAML(path, &want); err != nil {
+				t.Fatalf("ReadYAML failed: %v", err)
+			}
+
+			got, err := decodeSeqAll[interface{}](t, tc.content)
+			if err != nil {
+				t.Fatalf("DecodeYAMLSeq failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %#v, want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLSeq_DocStream(t *testing.T) {
+	content := "%YAML 1.1\n---\n- a\n- b\n---\nname: doc\n...\n---\n---\n- c\n--- [d, e]\n--- f\n"
+	got, err := decodeSeqAll[interface{}](t, content)
+	if err != nil {
+		t.Fatalf("DecodeYAMLSeq failed: %v", err)
+	}
+	want := []interface{}{"a", "b", map[string]interface{}{"name": "doc"}, "c", "d", "e", "f"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	for i := 0; i < 3; i++ {
+		if err := AppendYAMLDoc(path, testItem{Name: "event", Value: i}); err != nil {
+			t.Fatalf("AppendYAMLDoc failed: %v", err)
+		}
+	}
+	var items []testItem
+	err = DecodeYAMLSeq(path, func(item testItem) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil || len(items) != 3 || items[2].Value != 2 {
+		t.Errorf("doc stream: got %+v, %v", items, err)
+	}
+}
+
+func TestDecodeYAMLSeq_EmptyAndMissing(t *testing.T) {
+	for _, content := range []string{"", "# only a comment\n", "---\n", "null\n", "[]\n"} {
+		got, err := decodeSeqAll[interface{}](t, content)
+		if err != nil || len(got) != 0 {
+			t.Errorf("%q: got %v, %v; want no items", content, got, err)
+		}
+	}
+
+	err := DecodeYAMLSeq(filepath.Join(t.TempDir(), "missing.yaml"), func(interface{}) error {
+		t.Error("fn called for missing file")
+		return nil
+	})
+	if err != nil {
+		t.Errorf("missing file should return nil, got %v", err)
+	}
+}
+
+func TestDecodeYAMLSeq_Stop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.yaml")
+	writeFileString(t, path, "- 1\n- 2\n- 3\n- [broken\n")
+
+	var seen []int
+	err := DecodeYAMLSeq(path, func(n int) error {
+		seen = append(seen, n)
+		if n == 2 {
+			return ErrStop
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(seen, []int{1, 2}) {
+		t.Errorf("ErrStop: got %v, %v; want [1 2], nil", seen, err)
+	}
+
+	boom := errors.New("boom")
+	err = DecodeYAMLSeq(path, func(int) error { return boom })
+	if !errors.Is(err, boom) {
+		t.Errorf("expected fn's error, got %v", err)
+	}
+}
+
+func TestDecodeYAMLDocs_Stop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	writeFileString(t, path, "--- 1\n--- 2\n--- 3\n")
+
+	calls := 0
+	err := DecodeYAMLDocs(path, func(int) error {
+		calls++
+		return ErrStop
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("got %d calls, err %v; want 1, nil", calls, err)
+	}
+}
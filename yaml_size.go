@@ -0,0 +1,123 @@
+// ABOUTME: Size limit on YAML read whole into memory, so a huge or corrupt file fails fast.
+// ABOUTME: Provides SetMaxYAMLSize, ReadYAMLOpts, ErrFileTooLarge, and FileTooLargeError.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// DefaultMaxYAMLSize is the largest YAML file (or frontmatter block) read into memory
+// unless SetMaxYAMLSize or ReadOptions says otherwise: 64 MiB.
+const DefaultMaxYAMLSize = 64 << 20
+
+var maxYAMLSize atomic.Int64 // 0 means DefaultMaxYAMLSize
+
+// SetMaxYAMLSize sets the largest YAML file that ReadYAML and the functions built on it
+// (ReadYAMLStrict, ReadYAMLStrictFields, UpdateYAML, AppendYAML, CachedYAML,
+// ReadAllRotated, ...) read into memory, and the largest frontmatter block
+// DecodeFrontmatter extracts. Larger files return a *FileTooLargeError. Zero or
+// negative restores DefaultMaxYAMLSize.
+// Streaming readers (DecodeYAMLSeq, DecodeYAMLDocs, TailYAMLDocs) have no limit.
+func SetMaxYAMLSize(n int64) {
+	maxYAMLSize.Store(max(n, 0))
+}
+
+// currentMaxYAMLSize returns the limit set with SetMaxYAMLSize.
+func currentMaxYAMLSize() int64 {
+	if n := maxYAMLSize.Load(); n > 0 {
+		return n
+	}
+	return DefaultMaxYAMLSize
+}
+
+// ErrFileTooLarge matches (via errors.Is) any FileTooLargeError.
+var ErrFileTooLarge = errors.New("mdstore: file too large")
+
+// FileTooLargeError reports a YAML file, or a markdown file's frontmatter, larger than
+// the size limit (see SetMaxYAMLSize). For a gzipped archive read by ReadAllRotated,
+// Size counts the bytes decompressed before reading stopped, one past Limit.
+type FileTooLargeError struct {
+	Path        string
+	Size        int64 // bytes in the file, or in the frontmatter block
+	Limit       int64
+	Frontmatter bool // the frontmatter block, rather than the whole file, is too large
+}
+
+func (e *FileTooLargeError) Error() string {
+	if e.Frontmatter && e.Path == "" {
+		return fmt.Sprintf("mdstore: frontmatter is %d bytes, over the %d-byte limit", e.Size, e.Limit)
+	}
+	if e.Frontmatter {
+		return fmt.Sprintf("mdstore: %s: frontmatter is %d bytes, over the %d-byte limit", e.Path, e.Size, e.Limit)
+	}
+	return fmt.Sprintf("mdstore: %s is %d bytes, over the %d-byte limit for reading YAML whole; "+
+		"stream it with DecodeYAMLSeq", e.Path, e.Size, e.Limit)
+}
+
+// Is reports whether target is ErrFileTooLarge.
+func (e *FileTooLargeError) Is(target error) bool {
+	return target == ErrFileTooLarge
+}
+
+// ReadOptions adjusts ReadYAMLOpts.
+type ReadOptions struct {
+	// MaxSize is the largest file read, in bytes. Zero means the limit set with
+	// SetMaxYAMLSize; negative means no limit.
+	MaxSize int64
+
+	// MustExist makes a missing file a *NotFoundError, as with ReadYAMLStrict.
+	MustExist bool
+}
+
+// ReadYAMLOpts is ReadYAML (or ReadYAMLStrict, with opts.MustExist) with explicit
+// options, e.g. to read one known-large file past the package-wide size limit.
+func ReadYAMLOpts(path string, dest interface{}, opts ReadOptions) error {
+	limit := opts.MaxSize
+	if limit == 0 {
+		limit = currentMaxYAMLSize()
+	}
+	found, decoded, err := readYAMLFileMax(path, dest, limit)
+	switch {
+	case err != nil:
+		return err
+	case !found && opts.MustExist:
+		return &NotFoundError{Path: path}
+	case !decoded:
+		return nil
+	}
+	return validate(path, dest)
+}
+
+// readFileMax is os.ReadFile failing with a *FileTooLargeError if the file holds more
+// than limit bytes; a negative limit means none. The file is checked before reading,
+// and the read is bounded, in case it grows meanwhile.
+func readFileMax(path string, limit int64) ([]byte, error) {
+	if limit < 0 {
+		return os.ReadFile(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > limit {
+		return nil, &FileTooLargeError{Path: path, Size: info.Size(), Limit: limit}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, &FileTooLargeError{Path: path, Size: int64(len(data)), Limit: limit}
+	}
+	return data, nil
+}
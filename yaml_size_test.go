@@ -0,0 +1,124 @@
+// ABOUTME: Tests for the YAML size limit: SetMaxYAMLSize, ReadYAMLOpts, and the frontmatter cap.
+// ABOUTME: Lowers the limit to a few bytes so small files exercise it.
+package mdstore
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setMaxYAMLSize(t *testing.T, n int64) {
+	t.Helper()
+	SetMaxYAMLSize(n)
+	t.Cleanup(func() { SetMaxYAMLSize(0) })
+}
+
+func asFileTooLarge(t *testing.T, err error) *FileTooLargeError {
+	t.Helper()
+	var tooLarge *FileTooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("expected *FileTooLargeError, got %T: %v", err, err)
+	}
+	return tooLarge
+}
+
+func TestMaxYAMLSize_Read(t *testing.T) {
+	setMaxYAMLSize(t, 64)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.yaml")
+	content := "- name: " + strings.Repeat("x", 60) + "\n"
+	writeFileString(t, path, content)
+
+	var items []testItem
+	err := ReadYAML(path, &items)
+	tooLarge := asFileTooLarge(t, err)
+	if tooLarge.Path != path || tooLarge.Size != int64(len(content)) || tooLarge.Limit != 64 || tooLarge.Frontmatter {
+		t.Errorf("unexpected error fields: %+v", tooLarge)
+	}
+	if !strings.Contains(err.Error(), "DecodeYAMLSeq") || items != nil {
+		t.Errorf("error should point at the streaming decoder and leave dest alone: %v, %v", err, items)
+	}
+
+	asFileTooLarge(t, ReadYAMLStrict(path, &items))
+	asFileTooLarge(t, ReadYAMLStrictFields(path, &items))
+	asFileTooLarge(t, AppendYAML(path, testItem{Name: "y"}))
+	asFileTooLarge(t, UpdateYAML(dir, path, func(items *[]testItem) error { return nil }))
+
+	// Streaming has no limit.
+	n := 0
+	if err := DecodeYAMLSeq(path, func(testItem) error { n++; return nil }); err != nil || n != 1 {
+		t.Errorf("DecodeYAMLSeq = %d items, %v", n, err)
+	}
+
+	// A file right at the limit is fine, and SetMaxYAMLSize(0) restores the default.
+	writeFileString(t, path, "- name: "+strings.Repeat("x", 64-9)+"\n")
+	if err := ReadYAML(path, &items); err != nil || len(items) != 1 {
+		t.Errorf("file at the limit: %v, %v", items, err)
+	}
+	SetMaxYAMLSize(0)
+	if got := currentMaxYAMLSize(); got != DefaultMaxYAMLSize {
+		t.Errorf("limit after SetMaxYAMLSize(0) = %d, want %d", got, DefaultMaxYAMLSize)
+	}
+}
+
+func TestReadYAMLOpts(t *testing.T) {
+	setMaxYAMLSize(t, 16)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFileString(t, path, "name: a-fairly-long-name\nvalue: 3\n")
+
+	var item testItem
+	asFileTooLarge(t, ReadYAMLOpts(path, &item, ReadOptions{}))
+	err := ReadYAMLOpts(path, &item, ReadOptions{MaxSize: 10})
+	if tooLarge := asFileTooLarge(t, err); tooLarge.Limit != 10 {
+		t.Errorf("Limit = %d, want the per-call 10", tooLarge.Limit)
+	}
+
+	for _, limit := range []int64{1 << 10, -1} {
+		item = testItem{}
+		if err := ReadYAMLOpts(path, &item, ReadOptions{MaxSize: limit}); err != nil || item.Value != 3 {
+			t.Errorf("MaxSize %d: got %+v, %v", limit, item, err)
+		}
+	}
+
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	if err := ReadYAMLOpts(missing, &item, ReadOptions{}); err != nil {
+		t.Errorf("missing file: %v", err)
+	}
+	if err := ReadYAMLOpts(missing, &item, ReadOptions{MustExist: true}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file with MustExist: expected fs.ErrNotExist, got %v", err)
+	}
+
+	writeFileString(t, path, "name: ''\nlevel: low\n")
+	var cfg checkedConfig
+	asValidationError(t, ReadYAMLOpts(path, &cfg, ReadOptions{MaxSize: -1}), path)
+}
+
+func TestMaxYAMLSize_Frontmatter(t *testing.T) {
+	setMaxYAMLSize(t, 32)
+	content := fmt.Sprintf("---\ntitle: Post\nsummary: %s\n---\n# Post\n", strings.Repeat("x", 40))
+
+	yamlStr, body := ParseFrontmatter(content)
+	if yamlStr != "" || body != content {
+		t.Errorf("oversized frontmatter should be left in the body, got %q / %q", yamlStr, body)
+	}
+
+	var meta map[string]string
+	body, err := DecodeFrontmatter("post.md", content, &meta)
+	tooLarge := asFileTooLarge(t, err)
+	if tooLarge.Path != "post.md" || !tooLarge.Frontmatter || tooLarge.Size != 61 || meta != nil || body != content {
+		t.Errorf("got %+v, meta %v", tooLarge, meta)
+	}
+	if !strings.Contains(err.Error(), "post.md: frontmatter is 61 bytes") {
+		t.Errorf("unexpected message: %v", err)
+	}
+
+	// The body can be as large as it likes.
+	content = "---\ntitle: Post\n---\n" + strings.Repeat("text ", 100)
+	if _, err := DecodeFrontmatter("post.md", content, &meta); err != nil || meta["title"] != "Post" {
+		t.Errorf("small frontmatter, large body: %v, %v", meta, err)
+	}
+}
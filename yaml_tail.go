@@ -0,0 +1,177 @@
+// ABOUTME: Reads the last items of an appended YAML file without parsing the whole thing.
+// ABOUTME: Provides TailYAMLDocs, which scans a doc stream backwards for its final "---" documents.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tailBlockSize is how much TailYAMLDocs reads at a time, walking back from the end.
+var tailBlockSize int64 = 64 << 10 // shrunk in tests
+
+// TailYAMLDocs returns the last n items of the YAML file at path, oldest first. For a
+// doc stream (see AppendYAMLDoc), it reads the file backwards in blocks until it has
+// found n non-empty documents, and decodes only those, so the cost follows n rather
+// than the length of the file. A file with no "---" lines is taken to be a single list
+// (see AppendYAML) and read in full, keeping the last n of its items. It returns fewer
+// than n items if the file has fewer, and none for a missing or empty file. If T
+// implements Validator, every returned item must pass.
+func TailYAMLDocs[T any](path string, n int) ([]T, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		items    []T // newest first
+		tail     []byte
+		pos      = info.Size() // tail holds the file from pos to the end
+		segEnd   int           // end in tail of the documents not yet decoded
+		limit    int           // separators in tail below limit haven't been searched for
+		separate bool          // whether any "---" line was found
+	)
+	// decode prepends the items of seg, which starts at a "---" line or the file's
+	// start; ok is false if seg doesn't parse on its own.
+	decode := func(seg []byte) (ok bool, err error) {
+		var found []T
+		err = eachYAMLDoc(path, bytes.NewReader(seg), func(_ int, node *yaml.Node) error {
+			if err := checkYAMLNodeAliases(path, node, 1); err != nil {
+				return err // found again, with its line, by the full read
+			}
+			var item T
+			if err := node.Decode(&item); err != nil {
+				return err
+			}
+			found = append(found, item)
+			return nil
+		})
+		if err != nil {
+			return false, nil
+		}
+		for i := len(found) - 1; i >= 0; i-- {
+			if err := validate(path, found[i]); err != nil {
+				return false, err
+			}
+			items = append(items, found[i])
+		}
+		return true, nil
+	}
+
+	for len(items) < n {
+		if i := lastYAMLSeparator(tail, limit, pos == 0); i >= 0 {
+			separate = true
+			ok, err := decode(tail[i:segEnd])
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				// Something only a full parse gets right, such as a directive before
+				// a "---" or malformed YAML; that also locates any error properly.
+				return tailYAMLFull[T](path, n, true)
+			}
+			segEnd, limit = i, i
+			continue
+		}
+
+		if pos == 0 {
+			if !separate {
+				return tailYAMLFull[T](path, n, false)
+			}
+			// What precedes the first "---": a bare first document, or nothing.
+			ok, err := decode(tail[:segEnd])
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return tailYAMLFull[T](path, n, true)
+			}
+			break
+		}
+
+		size := min(pos, tailBlockSize)
+		pos -= size
+		block := make([]byte, size, int(size)+len(tail))
+		if _, err := f.ReadAt(block, pos); err != nil {
+			return nil, err
+		}
+		tail = append(block, tail...)
+		segEnd += int(size)
+		// A "---" line starting at the old front of tail only now shows its line start.
+		limit = min(segEnd, int(size)+3)
+	}
+
+	if len(items) > n {
+		items = items[:n]
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
+
+// lastYAMLSeparator returns the offset in data of the last "---" line starting before
+// end, or -1. Offset 0 counts only if atStart says data begins at the start of the
+// file. data must run to the end of the file, so that each line is seen whole.
+func lastYAMLSeparator(data []byte, end int, atStart bool) int {
+	for end > 0 {
+		i := bytes.LastIndex(data[:end], []byte("---"))
+		if i < 0 {
+			return -1
+		}
+		end = i
+		if i > 0 && data[i-1] != '\n' || i == 0 && !atStart {
+			continue
+		}
+		line := data[i:]
+		if nl := bytes.IndexByte(line, '\n'); nl >= 0 {
+			line = line[:nl]
+		}
+		if isYAMLMarker(bytes.TrimRight(line, "\r"), "---") {
+			return i
+		}
+	}
+	return -1
+}
+
+// tailYAMLFull reads the YAML file at path in full, as a doc stream if stream is set
+// and with DecodeYAMLSeq otherwise, keeping the last n items.
+func tailYAMLFull[T any](path string, n int, stream bool) ([]T, error) {
+	var ring []T
+	next := 0
+	keep := func(item T) error {
+		if len(ring) < n {
+			ring = append(ring, item)
+		} else {
+			ring[next] = item
+			next = (next + 1) % n
+		}
+		return nil
+	}
+
+	var err error
+	if stream {
+		err = DecodeYAMLDocs(path, keep)
+	} else {
+		err = DecodeYAMLSeq(path, keep)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(ring[next:], ring[:next]...), nil
+}
@@ -0,0 +1,116 @@
+// ABOUTME: Tests for TailYAMLDocs: last-n reads of doc streams and list files.
+// ABOUTME: Shrinks the read block size to cross block boundaries and compares against full reads.
+package mdstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTailYAMLDocs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	for i := 0; i < 50; i++ {
+		if err := AppendYAMLDoc(path, testItem{Name: fmt.Sprintf("e%d", i), Value: i}); err != nil {
+			t.Fatalf("AppendYAMLDoc failed: %v", err)
+		}
+	}
+	all, err := ReadYAMLDocs[testItem](path)
+	if err != nil {
+		t.Fatalf("ReadYAMLDocs failed: %v", err)
+	}
+
+	for _, block := range []int64{1, 2, 7, 64, 64 << 10} {
+		setTailBlockSize(t, block)
+		for _, n := range []int{1, 5, 49, 50, 100} {
+			got, err := TailYAMLDocs[testItem](path, n)
+			if err != nil {
+				t.Fatalf("block %d: TailYAMLDocs(%d) failed: %v", block, n, err)
+			}
+			want := all[max(0, len(all)-n):]
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("block %d: TailYAMLDocs(%d) = %v, want %v", block, n, got, want)
+			}
+		}
+	}
+
+	if got, err := TailYAMLDocs[testItem](path, 0); err != nil || got != nil {
+		t.Errorf("n=0: %v, %v", got, err)
+	}
+}
+
+func setTailBlockSize(t *testing.T, size int64) {
+	t.Helper()
+	old := tailBlockSize
+	tailBlockSize = size
+	t.Cleanup(func() { tailBlockSize = old })
+}
+
+func TestTailYAMLDocs_Shapes(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{"missing", "", ""},
+		{"empty", "\n", ""},
+		{"list", "- name: a\n- name: b\n- name: c\n", "b,c"},
+		{"bare first document", "name: a\n---\nname: b\n", "a,b"},
+		{"empty documents", "# log\n---\n---\nname: a\n---\n\n--- # comment\nname: b\n---\n", "a,b"},
+		{"markers in content", "---\nname: a\nnote: |\n  ---\n  ----\n---\nname: ---b\n", "a,---b"},
+		{"not markers", "---\nname: a\n---x: 1\n----: 2\n", "a"},
+		{"end markers", "---\nname: a\n...\n---\nname: b\n...\n", "a,b"},
+		{"directive", "%YAML 1.1\n---\nname: a\n---\nname: b\n", "a,b"},
+		{"crlf", "---\r\nname: a\r\n---\r\nname: b\r\n", "a,b"},
+		{"no final newline", "---\nname: a\n---\nname: b", "a,b"},
+		{"trailing marker", "---\nname: a\n---", "a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setTailBlockSize(t, 4)
+			path := filepath.Join(t.TempDir(), "events.yaml")
+			if tc.name != "missing" {
+				writeFileString(t, path, tc.content)
+			}
+
+			n := 2
+			if tc.name == "not markers" {
+				n = 5
+			}
+			got, err := TailYAMLDocs[map[string]string](path, n)
+			if err != nil {
+				t.Fatalf("TailYAMLDocs failed: %v", err)
+			}
+			var names []string
+			for _, item := range got {
+				names = append(names, item["name"])
+			}
+			if strings.Join(names, ",") != tc.want {
+				t.Errorf("got %q, want %q", strings.Join(names, ","), tc.want)
+			}
+		})
+	}
+}
+
+func TestTailYAMLDocs_Errors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.yaml")
+	writeFileString(t, path, "---\nname: a\n---\nname: [b\n---\nname: c\n")
+
+	// The broken document is never parsed when it isn't needed.
+	if got, err := TailYAMLDocs[testItem](path, 1); err != nil || len(got) != 1 || got[0].Name != "c" {
+		t.Errorf("TailYAMLDocs(1) = %v, %v", got, err)
+	}
+
+	// Otherwise the error is the one a full read reports, located in the file.
+	_, err := TailYAMLDocs[testItem](path, 2)
+	_, want := ReadYAMLDocs[testItem](path)
+	if yerr := asYAMLError(t, err); yerr.Path != path || yerr.Line < 3 || err.Error() != want.Error() {
+		t.Errorf("got %v, want %v", err, want)
+	}
+
+	writeFileString(t, path, "---\nname: a\nlevel: extreme\n---\nname: b\nlevel: low\n")
+	if _, err := TailYAMLDocs[checkedConfig](path, 1); err != nil {
+		t.Errorf("only the last item should be validated: %v", err)
+	}
+	_, err = TailYAMLDocs[checkedConfig](path, 2)
+	asValidationError(t, err, path)
+}
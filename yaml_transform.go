@@ -0,0 +1,207 @@
+// ABOUTME: Bulk edits of every YAML file under a directory, for schema migrations.
+// ABOUTME: Provides TransformYAMLDir, which rewrites changed files through comment-preserving yaml.Node trees.
+package mdstore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TransformOptions adjusts TransformYAMLDirOpts.
+type TransformOptions struct {
+	// DryRun applies fn and reports what would change, without writing anything.
+	DryRun bool
+}
+
+// TransformReport is the outcome of TransformYAMLDir.
+type TransformReport struct {
+	Matched int              // files that matched the pattern
+	Changed []string         // files rewritten (with DryRun, that would have been)
+	Failed  []TransformError // files that couldn't be read, transformed, or written
+}
+
+// Err returns the per-file errors joined into one, or nil if there were none.
+func (r *TransformReport) Err() error {
+	errs := make([]error, len(r.Failed))
+	for i := range r.Failed {
+		errs[i] = &r.Failed[i]
+	}
+	return errors.Join(errs...)
+}
+
+// TransformError is a failure on one file during TransformYAMLDir.
+type TransformError struct {
+	Path string
+	Err  error
+}
+
+func (e *TransformError) Error() string {
+	return fmt.Sprintf("mdstore: transform %s: %v", e.Path, e.Err)
+}
+
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
+
+// TransformYAMLDir applies fn to every YAML file under root whose name matches glob
+// (filepath.Match syntax, "*.yaml" if empty; a pattern containing "/" is matched
+// against the path relative to root, with forward slashes). Each file is loaded as a yaml.Node
+// document (an empty mapping for an empty file), and files for which fn reports a
+// change are rewritten atomically with their comments, key order, and untouched lines
+// kept, as UpdateYAMLNode does. A failure on one file is recorded in the report and
+// the walk goes on; the error return is for failures of the walk itself.
+//
+// Hidden files and directories, which include mdstore's own lock, audit, and temporary
+// files, are skipped, as are rotated archives (see AppendYAMLRotating) and
+// multi-document streams, which are reported as failures rather than cut down to
+// their first document. The whole run holds root's lock (see WithRootLock), which
+// excludes other writers under root when it is a lock root (see SetLockRoots).
+func TransformYAMLDir(root, glob string, fn func(path string, node *yaml.Node) (changed bool, err error)) (TransformReport, error) {
+	return TransformYAMLDirOpts(root, glob, fn, TransformOptions{})
+}
+
+// TransformYAMLDirOpts is TransformYAMLDir with explicit options.
+func TransformYAMLDirOpts(root, glob string, fn func(path string, node *yaml.Node) (changed bool, err error), opts TransformOptions) (TransformReport, error) {
+	var report TransformReport
+	if glob == "" {
+		glob = "*.yaml"
+	}
+	err := walkGlobLocked(root, glob, func(path string, _ fs.DirEntry) {
+		report.Matched++
+		changed, err := transformYAMLFile(path, fn, opts.DryRun)
+		switch {
+		case err != nil:
+			report.Failed = append(report.Failed, TransformError{Path: path, Err: err})
+		case changed:
+			report.Changed = append(report.Changed, path)
+		}
+	})
+	return report, err
+}
+
+// walkGlobLocked is walkGlob holding root's lock throughout.
+func walkGlobLocked(root, glob string, fn func(path string, d fs.DirEntry)) error {
+	if err := checkGlobRoot(root, glob); err != nil {
+		return err
+	}
+	return WithRootLock(root, func() error {
+		return walkGlobFiles(root, glob, fn)
+	})
+}
+
+// walkGlob calls fn with each regular file under root that matches glob (see
+// matchTransformGlob), skipping hidden files and directories and rotated archives, as
+// TransformYAMLDir describes. The error is for a bad pattern, a missing root, or a
+// failure of the walk itself.
+func walkGlob(root, glob string, fn func(path string, d fs.DirEntry)) error {
+	if err := checkGlobRoot(root, glob); err != nil {
+		return err
+	}
+	return walkGlobFiles(root, glob, fn)
+}
+
+// checkGlobRoot checks glob's syntax and that root exists, before a walk.
+func checkGlobRoot(root, glob string) error {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return fmt.Errorf("mdstore: bad pattern %q: %w", glob, err)
+	}
+	_, err := os.Stat(root)
+	return err
+}
+
+// walkGlobFiles is walkGlob once its arguments are checked.
+func walkGlobFiles(root, glob string, fn func(path string, d fs.DirEntry)) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := d.Name()
+		if path != root && strings.HasPrefix(name, ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || isRotatedArchive(name) {
+			return nil
+		}
+		if ok, err := matchTransformGlob(root, path, glob); err != nil || !ok {
+			return err
+		}
+		fn(path, d)
+		return nil
+	})
+}
+
+// matchTransformGlob reports whether path, under root, matches glob: its name, or its
+// slash-separated path relative to root if glob contains a slash.
+func matchTransformGlob(root, path, glob string) (bool, error) {
+	if !strings.Contains(glob, "/") {
+		return filepath.Match(glob, filepath.Base(path))
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false, err
+	}
+	return filepath.Match(glob, filepath.ToSlash(rel))
+}
+
+// transformYAMLFile applies fn to the YAML file at path, rewriting it if fn reports a
+// change and dryRun is unset. The caller holds the root lock.
+func transformYAMLFile(path string, fn func(path string, node *yaml.Node) (bool, error), dryRun bool) (bool, error) {
+	src, err := readFileMax(path, currentMaxYAMLSize())
+	if err != nil {
+		return false, err
+	}
+	if isEncryptedYAML(src) {
+		return false, ErrEncrypted
+	}
+	if multi, err := isMultiDocYAML(path, src); err != nil || multi {
+		if multi {
+			err = errors.New("multi-document stream; only single-document files are transformed")
+		}
+		return false, err
+	}
+	doc, err := parseYAMLNode(path, src)
+	if err != nil {
+		return false, err
+	}
+
+	var changed bool
+	transform := func(root *yaml.Node) (bool, error) {
+		c, err := fn(path, root)
+		changed = c && err == nil
+		return changed && !dryRun, err
+	}
+	if err := rewriteYAMLNode(path, src, doc, transform); err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+// isMultiDocYAML reports whether src, read from path, holds more than one YAML document.
+func isMultiDocYAML(path string, src []byte) (bool, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(src))
+	var first, second yaml.Node
+	if err := dec.Decode(&first); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, newYAMLError(path, err, 1)
+	}
+	if err := dec.Decode(&second); err != nil {
+		if err == io.EOF {
+			return false, nil
+		}
+		return false, newYAMLError(path, err, 1)
+	}
+	return true, nil
+}
@@ -0,0 +1,141 @@
+// ABOUTME: Tests for TransformYAMLDir: matching, skipped files, per-file errors, dry runs, and formatting.
+// ABOUTME: Migrates a "title" key to "name" across a small tree of YAML files.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// renameTitle renames a top-level "title" key to "name", reporting whether it did.
+func renameTitle(path string, doc *yaml.Node) (bool, error) {
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return false, errors.New("not a mapping")
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "title" {
+			root.Content[i].Value = "name"
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// transformTree is a tree of YAML files for writeIndexTree.
+var transformTree = map[string]string{
+	"a.yaml":                    "# first\ntitle: A # keep me\n\nvalue: 1\n",
+	"sub/b.yaml":                "title: B\nvalue: 2\n",
+	"sub/deeper/unchanged.yaml": "name: already\n",
+	"empty.yaml":                "",
+	"bad.yaml":                  "title: [broken\n",
+	"list.yaml":                 "- title: not a mapping\n",
+	"stream.yaml":               "---\ntitle: one\n---\ntitle: two\n",
+	"notes.yml":                 "title: other extension\n",
+	"log.2026-02-05T10-04-05.500000000Z.yaml":        "title: archived\n",
+	".lock-audit.yaml":                               "title: internal\n",
+	".hidden/c.yaml":                                 "title: hidden\n",
+	"sub/events.2026-02-05T10-04-05.000000000Z.yaml": "title: archived\n",
+}
+
+func TestTransformYAMLDir(t *testing.T) {
+	root := writeIndexTree(t, transformTree)
+
+	report, err := TransformYAMLDir(root, "*.yaml", renameTitle)
+	if err != nil {
+		t.Fatalf("TransformYAMLDir failed: %v", err)
+	}
+
+	if report.Matched != 7 {
+		t.Errorf("Matched = %d, want 7", report.Matched)
+	}
+	want := []string{filepath.Join(root, "a.yaml"), filepath.Join(root, "sub", "b.yaml")}
+	if !reflect.DeepEqual(report.Changed, want) {
+		t.Errorf("Changed = %v, want %v", report.Changed, want)
+	}
+	var failed []string
+	for _, f := range report.Failed {
+		failed = append(failed, filepath.Base(f.Path))
+	}
+	if strings.Join(failed, " ") != "bad.yaml list.yaml stream.yaml" {
+		t.Errorf("Failed = %v", report.Failed)
+	}
+	if err := report.Err(); err == nil || !strings.Contains(err.Error(), "not a mapping") {
+		t.Errorf("Err() = %v", err)
+	}
+
+	if got := readFileString(t, filepath.Join(root, "a.yaml")); got != "# first\nname: A # keep me\n\nvalue: 1\n" {
+		t.Errorf("a.yaml lost its formatting:\n%s", got)
+	}
+	for name, content := range map[string]string{
+		"stream.yaml": "---\ntitle: one\n---\ntitle: two\n",
+		"notes.yml":   "title: other extension\n",
+		"log.2026-02-05T10-04-05.500000000Z.yaml": "title: archived\n",
+		".lock-audit.yaml":                        "title: internal\n",
+		".hidden/c.yaml":                          "title: hidden\n",
+		"empty.yaml":                              "",
+	} {
+		if got := readFileString(t, filepath.Join(root, filepath.FromSlash(name))); got != content {
+			t.Errorf("%s should be untouched, got:\n%s", name, got)
+		}
+	}
+}
+
+func TestTransformYAMLDir_DryRun(t *testing.T) {
+	root := writeIndexTree(t, transformTree)
+	before := readFileString(t, filepath.Join(root, "a.yaml"))
+
+	report, err := TransformYAMLDirOpts(root, "", renameTitle, TransformOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("TransformYAMLDirOpts failed: %v", err)
+	}
+	if len(report.Changed) != 2 || len(report.Failed) != 3 {
+		t.Errorf("dry run should report the same outcome: %+v", report)
+	}
+	if got := readFileString(t, filepath.Join(root, "a.yaml")); got != before {
+		t.Errorf("dry run wrote a.yaml:\n%s", got)
+	}
+}
+
+func TestTransformYAMLDir_Patterns(t *testing.T) {
+	root := writeIndexTree(t, transformTree)
+
+	report, err := TransformYAMLDir(root, "sub/*.yaml", renameTitle)
+	if err != nil {
+		t.Fatalf("TransformYAMLDir failed: %v", err)
+	}
+	if report.Matched != 1 || len(report.Changed) != 1 || filepath.Base(report.Changed[0]) != "b.yaml" {
+		t.Errorf("relative pattern: %+v", report)
+	}
+
+	if _, err := TransformYAMLDir(root, "[", renameTitle); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+	if _, err := TransformYAMLDir(filepath.Join(root, "missing"), "*.yaml", renameTitle); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing root: expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestIsRotatedArchive(t *testing.T) {
+	for name, want := range map[string]bool{
+		"events.2026-02-05T10-04-05.000000000Z.yaml":    true,
+		"events.2026-02-05T10-04-05.123000000Z.jsonl":   true,
+		"events.2026-02-05T10-04-05.500000000Z.yaml.gz": true,
+		"my.events.2026-02-05T10-04-05.000000001Z.y":    true,
+		"events2026-02-05T10-04-05.000000000Z.yaml":     false,
+		"events.2026-02-05T10-04-05.5Z.yaml":            false,
+		"events.yaml":                                   false,
+		"2026-02-05T10-04-05Z.yaml":                     false,
+		"events.backup.yaml":                            false,
+	} {
+		if got := isRotatedArchive(name); got != want {
+			t.Errorf("isRotatedArchive(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// ABOUTME: Dotted-path access to single values in YAML files, for scripts that don't define structs.
+// ABOUTME: Provides Get/Set/DeleteYAMLValue and their []string-key variants, built on the yaml.Node helpers.
+package mdstore
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dotted paths name a value by its mapping keys and sequence indexes, separated by
+// dots: "server.port", "tags.0". A key containing a dot is written with `\.`
+// ("hosts.example\.com"), and a backslash with `\\`; or pass the keys separately to
+// the ...Keys variants.
+
+// GetYAMLValue returns the value at a dotted path in the YAML file at path, decoded
+// as by ReadYAML into an interface{}. found is false if the file or the path doesn't exist.
+func GetYAMLValue(path, dotted string) (value interface{}, found bool, err error) {
+	return GetYAMLValueKeys(path, splitYAMLPath(dotted))
+}
+
+// GetYAMLValueKeys is GetYAMLValue with the path given as separate keys.
+func GetYAMLValueKeys(path string, keys []string) (value interface{}, found bool, err error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	doc, err := parseYAMLNode(path, src)
+	if err != nil {
+		return nil, false, err
+	}
+
+	node := yamlContentNode(doc)
+	for _, key := range keys {
+		if node = yamlChild(node, key); node == nil {
+			return nil, false, nil
+		}
+	}
+	if err := checkYAMLNodeAliases(path, node, 1); err != nil {
+		return nil, false, err
+	}
+	if err := node.Decode(&value); err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// SetYAMLValue sets the value at a dotted path in the YAML file at path, creating the
+// file and any missing intermediate mappings (see SetYAMLPath). It runs under WithLock
+// on path's directory and writes atomically; a file with comments keeps them and its
+// formatting (see UpdateYAMLNode), others are re-encoded as yaml.Marshal would.
+func SetYAMLValue(path, dotted string, v interface{}) error {
+	return SetYAMLValueKeys(path, splitYAMLPath(dotted), v)
+}
+
+// SetYAMLValueKeys is SetYAMLValue with the path given as separate keys.
+func SetYAMLValueKeys(path string, keys []string, v interface{}) error {
+	return updateYAMLValue(path, func(root *yaml.Node) (bool, error) {
+		return true, setYAMLNodeKeys(root, keys, v)
+	})
+}
+
+// DeleteYAMLValue removes the mapping entry or sequence item at a dotted path in the
+// YAML file at path, like SetYAMLValue. Deleting a path that doesn't exist is a no-op
+// that leaves the file untouched.
+func DeleteYAMLValue(path, dotted string) error {
+	return DeleteYAMLValueKeys(path, splitYAMLPath(dotted))
+}
+
+// DeleteYAMLValueKeys is DeleteYAMLValue with the path given as separate keys.
+func DeleteYAMLValueKeys(path string, keys []string) error {
+	return updateYAMLValue(path, func(root *yaml.Node) (bool, error) {
+		return deleteYAMLNodeKeys(root, keys), nil
+	})
+}
+
+// updateYAMLValue applies fn to the node tree of the YAML file at path under WithLock
+// on its directory, writing the result only if fn reports a change.
+func updateYAMLValue(path string, fn func(root *yaml.Node) (bool, error)) error {
+	return WithLock(filepath.Dir(path), func() error {
+		src, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		doc, err := parseYAMLNode(path, src)
+		if err != nil {
+			return err
+		}
+
+		if yamlHasComments(doc) {
+			return rewriteYAMLNode(path, src, doc, fn)
+		}
+		if changed, err := fn(doc); err != nil || !changed {
+			return err
+		}
+		data, err := encodeYAMLNode(doc, 4)
+		if err != nil {
+			return err
+		}
+		return AtomicWrite(path, data)
+	})
+}
+
+// splitYAMLPath splits a dotted path into keys, unescaping `\.` and `\\`.
+func splitYAMLPath(dotted string) []string {
+	if dotted == "" {
+		return nil
+	}
+	var keys []string
+	var key strings.Builder
+	for i := 0; i < len(dotted); i++ {
+		switch c := dotted[i]; {
+		case c == '\\' && i+1 < len(dotted) && (dotted[i+1] == '.' || dotted[i+1] == '\\'):
+			i++
+			key.WriteByte(dotted[i])
+		case c == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(c)
+		}
+	}
+	return append(keys, key.String())
+}
+
+// joinYAMLPath is the inverse of splitYAMLPath.
+func joinYAMLPath(keys []string) string {
+	escaped := make([]string, len(keys))
+	for i, key := range keys {
+		key = strings.ReplaceAll(key, `\`, `\\`)
+		escaped[i] = strings.ReplaceAll(key, ".", `\.`)
+	}
+	return strings.Join(escaped, ".")
+}
@@ -0,0 +1,173 @@
+// ABOUTME: Tests for dotted-path YAML access: GetYAMLValue, SetYAMLValue, DeleteYAMLValue.
+// ABOUTME: Covers sequences, escaped dots, comment preservation, and the plain re-encode fallback.
+package mdstore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFileString(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func TestGetYAMLValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFileString(t, path, "server:\n  port: 8080\ntags: [a, b]\nhosts:\n  example.com: 1\nanchor: &x {k: v}\nalias: *x\n")
+
+	for _, tc := range []struct {
+		dotted string
+		want   interface{}
+		found  bool
+	}{
+		{"server.port", 8080, true},
+		{"server", map[string]interface{}{"port": 8080}, true},
+		{"tags.1", "b", true},
+		{`hosts.example\.com`, 1, true},
+		{"alias.k", "v", true},
+		{"server.missing", nil, false},
+		{"tags.2", nil, false},
+		{"server.port.deeper", nil, false},
+	} {
+		got, found, err := GetYAMLValue(path, tc.dotted)
+		if err != nil {
+			t.Errorf("GetYAMLValue(%q) failed: %v", tc.dotted, err)
+			continue
+		}
+		if found != tc.found || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("GetYAMLValue(%q) = %v, %v; want %v, %v", tc.dotted, got, found, tc.want, tc.found)
+		}
+	}
+
+	got, found, err := GetYAMLValueKeys(path, []string{"hosts", "example.com"})
+	if err != nil || !found || got != 1 {
+		t.Errorf("GetYAMLValueKeys = %v, %v, %v; want 1", got, found, err)
+	}
+
+	if _, found, err := GetYAMLValue(filepath.Join(t.TempDir(), "missing.yaml"), "a"); err != nil || found {
+		t.Errorf("missing file: found=%v err=%v, want not found and no error", found, err)
+	}
+}
+
+func TestSetYAMLValue_CreatesFileAndIntermediates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := SetYAMLValue(path, "server.port", 8080); err != nil {
+		t.Fatalf("SetYAMLValue failed: %v", err)
+	}
+	if err := SetYAMLValue(path, `hosts.example\.com.weight`, 3); err != nil {
+		t.Fatalf("SetYAMLValue failed: %v", err)
+	}
+	if err := SetYAMLValueKeys(path, []string{"server", "name"}, "main"); err != nil {
+		t.Fatalf("SetYAMLValueKeys failed: %v", err)
+	}
+
+	want := "server:\n    port: 8080\n    name: main\nhosts:\n    example.com:\n        weight: 3\n"
+	if got := readFileString(t, path); got != want {
+		t.Errorf("file content:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSetYAMLValue_SequenceIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFileString(t, path, "tags:\n- a\n- b\n")
+
+	if err := SetYAMLValue(path, "tags.0", "z"); err != nil {
+		t.Fatalf("SetYAMLValue failed: %v", err)
+	}
+	got, _, _ := GetYAMLValue(path, "tags")
+	if !reflect.DeepEqual(got, []interface{}{"z", "b"}) {
+		t.Errorf("tags = %v, want [z b]", got)
+	}
+
+	if err := SetYAMLValue(path, "tags.5", "x"); err == nil {
+		t.Error("setting a missing sequence index should fail")
+	}
+	if err := SetYAMLValue(path, "tags.0.name", "x"); err == nil {
+		t.Error("setting below a scalar should fail")
+	}
+}
+
+func TestSetYAMLValue_PreservesComments(t *testing.T) {
+	path, orig := copyFixture(t, "commented.yaml")
+
+	if err := SetYAMLValue(path, "storage.tags.1", "c"); err != nil {
+		t.Fatalf("SetYAMLValue failed: %v", err)
+	}
+
+	removed, added := changedLines(orig, readFileString(t, path))
+	if len(removed) != 1 || removed[0] != "    - b" || len(added) != 1 || added[0] != "    - c" {
+		t.Errorf("expected only the tag line to change, removed %q, added %q", removed, added)
+	}
+}
+
+func TestDeleteYAMLValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFileString(t, path, "server:\n    port: 8080\n    host: h\ntags:\n    - a\n    - b\n")
+
+	if err := DeleteYAMLValue(path, "server.port"); err != nil {
+		t.Fatalf("DeleteYAMLValue failed: %v", err)
+	}
+	if err := DeleteYAMLValueKeys(path, []string{"tags", "0"}); err != nil {
+		t.Fatalf("DeleteYAMLValueKeys failed: %v", err)
+	}
+
+	want := "server:\n    host: h\ntags:\n    - b\n"
+	if got := readFileString(t, path); got != want {
+		t.Errorf("file content:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDeleteYAMLValue_AbsentIsNoop(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	content := "a:   1 # odd spacing that a rewrite would normalize\n"
+	writeFileString(t, path, content)
+
+	for _, dotted := range []string{"b", "a.b", "c.d.e"} {
+		if err := DeleteYAMLValue(path, dotted); err != nil {
+			t.Fatalf("DeleteYAMLValue(%q) failed: %v", dotted, err)
+		}
+	}
+	if got := readFileString(t, path); got != content {
+		t.Errorf("deleting absent paths rewrote the file: %q", got)
+	}
+
+	missing := filepath.Join(dir, "missing.yaml")
+	if err := DeleteYAMLValue(missing, "a"); err != nil {
+		t.Fatalf("DeleteYAMLValue on missing file failed: %v", err)
+	}
+	if _, err := os.Stat(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Error("deleting from a missing file should not create it")
+	}
+}
+
+func TestSplitYAMLPath(t *testing.T) {
+	for _, tc := range []struct {
+		dotted string
+		keys   []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a.b.0", []string{"a", "b", "0"}},
+		{`a\.b.c`, []string{"a.b", "c"}},
+		{`a\\.b`, []string{`a\`, "b"}},
+		{`a\b`, []string{`a\b`}},
+	} {
+		keys := splitYAMLPath(tc.dotted)
+		if !reflect.DeepEqual(keys, tc.keys) {
+			t.Errorf("splitYAMLPath(%q) = %q, want %q", tc.dotted, keys, tc.keys)
+		}
+		if tc.keys != nil && tc.dotted != `a\b` {
+			if back := joinYAMLPath(keys); back != tc.dotted {
+				t.Errorf("joinYAMLPath(%q) = %q, want %q", keys, back, tc.dotted)
+			}
+		}
+	}
+}
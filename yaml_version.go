@@ -0,0 +1,108 @@
+// ABOUTME: Optimistic concurrency for YAML files: ReadYAMLVersioned and WriteYAMLIf.
+// ABOUTME: A Version is a hash of the file's content; WriteYAMLIf rechecks it under lock and fails with ErrConflict.
+package mdstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrConflict matches a *ConflictError: WriteYAMLIf found the file changed since it
+// was read.
+var ErrConflict = errors.New("mdstore: file changed since it was read")
+
+// ConflictError reports that WriteYAMLIf refused to write path because its content no
+// longer matches the Version the caller read. It matches ErrConflict via errors.Is.
+type ConflictError struct {
+	Path     string
+	Expected Version // the version the caller read
+	Actual   Version // the version on disk
+
+	// Changes are the differences, as DiffMeta finds them, between the file's content,
+	// as it is, and what the write would have made it, where both are mappings (or
+	// frontmatter, for a Document). So they include undoing whatever changed the file
+	// since it was read.
+	Changes []Change
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("mdstore: %s changed since it was read (expected version %q, found %q)", e.Path, e.Expected, e.Actual)
+}
+
+// Is reports whether target is ErrConflict.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// Version identifies the content of a file, as read by ReadYAMLVersioned. It's an
+// opaque string, fit for use as an HTTP ETag, that changes whenever the bytes of the
+// file do; rewriting a file with identical content keeps its version. The zero Version
+// stands for a missing file.
+type Version string
+
+// fileVersion returns the Version of data, the content of an existing file.
+func fileVersion(data []byte) Version {
+	sum := sha256.Sum256(data)
+	return Version(hex.EncodeToString(sum[:16]))
+}
+
+// currentVersion returns the Version of the file at path, hashing it as it's read
+// rather than loading it whole; a missing file has the zero Version.
+func currentVersion(path string) (Version, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return Version(hex.EncodeToString(h.Sum(nil)[:16])), nil
+}
+
+// ReadYAMLVersioned is ReadYAML that also returns the Version of the content read, to
+// pass to WriteYAMLIf when writing back. A missing file returns the zero Version.
+func ReadYAMLVersioned(path string, dest interface{}) (Version, error) {
+	data, err := readFileMax(path, currentMaxYAMLSize())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	v := fileVersion(data)
+	decoded, err := decodeYAMLData(path, data, dest)
+	if err != nil || !decoded {
+		return v, err
+	}
+	return v, validate(path, dest)
+}
+
+// WriteYAMLIf is WriteYAML for callers that read the file with ReadYAMLVersioned and
+// changed the value in memory, rather than in an UpdateYAML closure: under WithLock on
+// path's directory it checks that the file is still at version expected, and writes src
+// only if so. Otherwise it returns a *ConflictError and leaves the file alone; the
+// caller should read it again and redo its change, or report the conflict. The zero
+// Version means the file must not exist yet.
+func WriteYAMLIf(path string, src interface{}, expected Version) error {
+	return WithLock(filepath.Dir(path), func() error {
+		actual, err := currentVersion(path)
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			return &ConflictError{Path: path, Expected: expected, Actual: actual, Changes: yamlConflictChanges(path, src)}
+		}
+		return WriteYAML(path, src)
+	})
+}
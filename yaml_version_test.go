@@ -0,0 +1,109 @@
+// ABOUTME: Tests for ReadYAMLVersioned and WriteYAMLIf: clean writes, conflicts, and creation.
+// ABOUTME: Conflicts are provoked by writing between a versioned read and the conditional write.
+package mdstore
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func asConflict(t *testing.T, err error) *ConflictError {
+	t.Helper()
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected *ConflictError, got %T: %v", err, err)
+	}
+	return conflict
+}
+
+func TestWriteYAMLIf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.yaml")
+	if err := WriteYAML(path, testItem{Name: "a", Value: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two editors read the same version.
+	var first, second testItem
+	v1, err := ReadYAMLVersioned(path, &first)
+	if err != nil || v1 == "" || first.Value != 1 {
+		t.Fatalf("ReadYAMLVersioned = %q, %+v, %v", v1, first, err)
+	}
+	v2, err := ReadYAMLVersioned(path, &second)
+	if err != nil || v2 != v1 {
+		t.Fatalf("second read got version %q, want %q (%v)", v2, v1, err)
+	}
+
+	// The first write wins and changes the version...
+	first.Value = 2
+	if err := WriteYAMLIf(path, first, v1); err != nil {
+		t.Fatalf("WriteYAMLIf failed: %v", err)
+	}
+	var now testItem
+	v3, err := ReadYAMLVersioned(path, &now)
+	if err != nil || v3 == v1 || now.Value != 2 {
+		t.Fatalf("after the first write got %q, %+v, %v", v3, now, err)
+	}
+
+	// ...so the second conflicts and leaves the file alone.
+	second.Name = "b"
+	conflict := asConflict(t, WriteYAMLIf(path, second, v2))
+	if conflict.Path != path || conflict.Expected != v1 || conflict.Actual != v3 {
+		t.Errorf("unexpected conflict: %+v", conflict)
+	}
+	want := []Change{
+		{Path: "name", Kind: ChangeModified, Old: "a", New: "b"},
+		{Path: "value", Kind: ChangeModified, Old: 2, New: 1},
+	}
+	if !reflect.DeepEqual(conflict.Changes, want) {
+		t.Errorf("conflict changes = %+v, want %+v", conflict.Changes, want)
+	}
+	if err := ReadYAML(path, &now); err != nil || now != (testItem{Name: "a", Value: 2}) {
+		t.Errorf("file after the conflict holds %+v, %v", now, err)
+	}
+
+	// Rewriting the same content keeps the version.
+	if err := WriteYAML(path, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteYAMLIf(path, testItem{Name: "c"}, v3); err != nil {
+		t.Errorf("identical rewrite caused %v", err)
+	}
+}
+
+func TestWriteYAMLIf_Create(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.yaml")
+	var item testItem
+	v, err := ReadYAMLVersioned(path, &item)
+	if err != nil || v != "" {
+		t.Fatalf("missing file got version %q, %v", v, err)
+	}
+
+	if err := WriteYAMLIf(path, testItem{Name: "first"}, v); err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if conflict := asConflict(t, WriteYAMLIf(path, testItem{Name: "second"}, v)); conflict.Actual == "" {
+		t.Errorf("conflict should report the version on disk: %+v", conflict)
+	}
+	if err := ReadYAML(path, &item); err != nil || item.Name != "first" {
+		t.Errorf("file holds %+v, %v", item, err)
+	}
+
+	// A stale version of a file that's since been removed conflicts too.
+	cur, _ := ReadYAMLVersioned(path, &item)
+	if err := WriteYAMLIf(filepath.Join(filepath.Dir(path), "gone.yaml"), item, cur); err == nil {
+		t.Error("expected a conflict for a missing file")
+	}
+}
+
+func TestReadYAMLVersioned_Validates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFileString(t, path, "name: ''\nlevel: low\n")
+	var cfg checkedConfig
+	v, err := ReadYAMLVersioned(path, &cfg)
+	asValidationError(t, err, path)
+	if v == "" {
+		t.Error("a file that fails validation still has a version")
+	}
+}